@@ -0,0 +1,449 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/notify"
+)
+
+const (
+	// maxGroupsPerRule bounds the per-rule group map before idle groups are swept.
+	maxGroupsPerRule = 1024
+	// dryRunMaxEvents caps how many historical rows a dry run will replay.
+	dryRunMaxEvents = 50000
+	// dryRunMaxFirings caps how many firings a dry run returns.
+	dryRunMaxFirings = 200
+)
+
+// Notifier delivers alert notifications. *notify.Manager satisfies it.
+type Notifier interface {
+	Send(text string)
+	SendToChannel(channel, text string) error
+}
+
+// Firing describes one rule trigger.
+type Firing struct {
+	RuleID    uint      `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	Group     string    `json:"group,omitempty"`
+	GatewayID uint      `json:"gateway_id,omitempty"`
+	Count     int       `json:"count"`
+	Time      time.Time `json:"time"`
+	Risk      string    `json:"risk"`
+	Message   string    `json:"message"`
+	EventRef  string    `json:"event_ref,omitempty"` // activity event_id or lifecycle id of the triggering event
+	EventDesc string    `json:"event_desc,omitempty"`
+}
+
+// DryRunResult summarizes replaying a rule over historical events.
+type DryRunResult struct {
+	Since     time.Time `json:"since"`
+	Until     time.Time `json:"until"`
+	Evaluated int       `json:"evaluated"`
+	Matched   int       `json:"matched"`
+	Fired     int       `json:"fired"`
+	Firings   []Firing  `json:"firings"`
+	Truncated bool      `json:"truncated"`
+}
+
+// Engine evaluates alert rules in-process as events are recorded. Rules are
+// cached in memory and refreshed via Reload; sliding-window counters are kept
+// per rule and group so no database polling happens on the hot path.
+type Engine struct {
+	ruleRepo      *database.AlertRuleRepo
+	activityRepo  *database.ActivityRepo
+	lifecycleRepo *database.GatewayLifecycleRepo
+	alerts        *Manager
+
+	mu    sync.Mutex
+	rules []*Rule
+	eval  *evaluator
+}
+
+func NewEngine(alerts *Manager) *Engine {
+	return &Engine{
+		ruleRepo:      database.NewAlertRuleRepo(),
+		activityRepo:  database.NewActivityRepo(),
+		lifecycleRepo: database.NewGatewayLifecycleRepo(),
+		alerts:        alerts,
+		eval:          newEvaluator(),
+	}
+}
+
+// Reload re-reads enabled rules from the database. Window state is kept for
+// rules that were not modified since the last load.
+func (e *Engine) Reload() error {
+	records, err := e.ruleRepo.ListEnabled()
+	if err != nil {
+		return err
+	}
+	rules := make([]*Rule, 0, len(records))
+	for i := range records {
+		rule, err := RuleFromRecord(&records[i])
+		if err != nil {
+			logger.Alert.Warn().Err(err).Uint("rule_id", records[i].ID).Msg("skipping invalid alert rule")
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := make(map[uint]time.Time, len(e.rules))
+	for _, r := range e.rules {
+		prev[r.ID] = r.UpdatedAt
+	}
+	keep := make(map[uint]bool, len(rules))
+	for _, r := range rules {
+		if updatedAt, ok := prev[r.ID]; ok && updatedAt.Equal(r.UpdatedAt) {
+			keep[r.ID] = true
+		}
+	}
+	e.eval.retain(keep)
+	e.rules = rules
+	logger.Alert.Debug().Int("rules", len(rules)).Msg("alert rules reloaded")
+	return nil
+}
+
+// Rules returns the currently loaded (enabled) rules.
+func (e *Engine) Rules() []*Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]*Rule, len(e.rules))
+	copy(out, e.rules)
+	return out
+}
+
+// ObserveActivity evaluates all activity rules against a newly written activity.
+func (e *Engine) ObserveActivity(a *database.Activity) {
+	if a == nil {
+		return
+	}
+	ts := EventTime(a.Timestamp)
+
+	var fired []pendingFiring
+	e.mu.Lock()
+	for _, r := range e.rules {
+		if !r.MatchActivity(a) {
+			continue
+		}
+		if f, ok := e.eval.observeActivity(r, a, ts); ok {
+			fired = append(fired, pendingFiring{rule: r, firing: f})
+		}
+	}
+	e.mu.Unlock()
+
+	for _, p := range fired {
+		e.fire(p.rule, &p.firing)
+	}
+}
+
+// ObserveLifecycle evaluates all lifecycle rules against a newly recorded gateway
+// lifecycle event and auto-resolves alerts whose condition the event clears.
+func (e *Engine) ObserveLifecycle(ev *database.GatewayLifecycle) {
+	if ev == nil {
+		return
+	}
+	e.alerts.ResolveOnEvent(ev.GatewayID, ev.EventType)
+	ts := EventTime(ev.Timestamp)
+
+	var fired []pendingFiring
+	e.mu.Lock()
+	for _, r := range e.rules {
+		if !r.MatchLifecycle(ev) {
+			continue
+		}
+		if f, ok := e.eval.observeLifecycle(r, ev, ts); ok {
+			fired = append(fired, pendingFiring{rule: r, firing: f})
+		}
+	}
+	e.mu.Unlock()
+
+	for _, p := range fired {
+		e.fire(p.rule, &p.firing)
+	}
+}
+
+// DryRun replays historical events in [since, until] through the rule using a
+// fresh evaluator and reports what would have fired. Nothing is persisted.
+func (e *Engine) DryRun(rule *Rule, since, until time.Time) (*DryRunResult, error) {
+	res := &DryRunResult{Since: since, Until: until, Firings: []Firing{}}
+	ev := newEvaluator()
+
+	record := func(f Firing) {
+		res.Fired++
+		if len(res.Firings) < dryRunMaxFirings {
+			res.Firings = append(res.Firings, f)
+		}
+	}
+
+	switch rule.EventKind {
+	case KindActivity:
+		activities, err := e.activityRepo.ListRange(since, until, dryRunMaxEvents+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(activities) > dryRunMaxEvents {
+			activities = activities[:dryRunMaxEvents]
+			res.Truncated = true
+		}
+		for i := range activities {
+			a := &activities[i]
+			res.Evaluated++
+			if !rule.MatchActivity(a) {
+				continue
+			}
+			res.Matched++
+			if f, ok := ev.observeActivity(rule, a, EventTime(a.Timestamp)); ok {
+				record(f)
+			}
+		}
+	case KindLifecycle:
+		records, err := e.lifecycleRepo.ListRange(since, until, dryRunMaxEvents+1)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) > dryRunMaxEvents {
+			records = records[:dryRunMaxEvents]
+			res.Truncated = true
+		}
+		for i := range records {
+			rec := &records[i]
+			if rec.EventType == "remediation" {
+				continue // timeline annotations never reach live rules
+			}
+			res.Evaluated++
+			if !rule.MatchLifecycle(rec) {
+				continue
+			}
+			res.Matched++
+			if f, ok := ev.observeLifecycle(rule, rec, EventTime(rec.Timestamp)); ok {
+				record(f)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported event kind %q", rule.EventKind)
+	}
+	return res, nil
+}
+
+type pendingFiring struct {
+	rule   *Rule
+	firing Firing
+}
+
+// fire raises (or deduplicates) the alert and routes the notification.
+func (e *Engine) fire(r *Rule, f *Firing) {
+	detail, _ := json.Marshal(map[string]interface{}{
+		"rule_id":    f.RuleID,
+		"rule_name":  f.RuleName,
+		"group":      f.Group,
+		"gateway_id": f.GatewayID,
+		"count":      f.Count,
+		"event_ref":  f.EventRef,
+		"event_desc": f.EventDesc,
+	})
+	dedupKey := fmt.Sprintf("rule:%d", f.RuleID)
+	if f.Group != "" {
+		dedupKey += ":" + f.Group
+	}
+	if f.GatewayID != 0 {
+		dedupKey += fmt.Sprintf("@gw%d", f.GatewayID)
+	}
+	res, err := e.alerts.Raise(&Raise{
+		DedupKey:        dedupKey,
+		GatewayID:       f.GatewayID,
+		Risk:            f.Risk,
+		Message:         f.Message,
+		Detail:          string(detail),
+		ResolveOn:       r.ResolveOn,
+		EscalateAfter:   time.Duration(r.EscalateMin) * time.Minute,
+		EscalateChannel: r.EscalateTo,
+	})
+	if err != nil {
+		logger.Alert.Error().Err(err).Uint("rule_id", f.RuleID).Msg("failed to write rule alert")
+		return
+	}
+	logger.Alert.Info().Uint("rule_id", f.RuleID).Str("group", f.Group).Int("count", f.Count).
+		Bool("new", res.Created).Msg("alert rule fired")
+
+	notifier := e.alerts.notifier
+	if !r.Notify || res.Suppressed || notifier == nil {
+		return
+	}
+	text := notify.FormatAlert(f.Risk, f.Message, f.EventDesc)
+	channels := r.Channels
+	go func() {
+		if len(channels) == 0 {
+			notifier.Send(text)
+			return
+		}
+		for _, ch := range channels {
+			if err := notifier.SendToChannel(ch, text); err != nil {
+				logger.Alert.Warn().Err(err).Str("channel", ch).Uint("rule_id", f.RuleID).Msg("alert rule notification failed")
+			}
+		}
+	}()
+}
+
+// evaluator holds sliding-window state for a set of rules.
+type evaluator struct {
+	states map[uint]map[string]*groupState
+}
+
+type groupState struct {
+	hits      []time.Time // at most rule.Threshold most recent hits inside the window
+	lastFired time.Time
+}
+
+func newEvaluator() *evaluator {
+	return &evaluator{states: make(map[uint]map[string]*groupState)}
+}
+
+// retain drops state for every rule not in keep.
+func (ev *evaluator) retain(keep map[uint]bool) {
+	for id := range ev.states {
+		if !keep[id] {
+			delete(ev.states, id)
+		}
+	}
+}
+
+func (ev *evaluator) observeActivity(r *Rule, a *database.Activity, ts time.Time) (Firing, bool) {
+	group := r.groupKey(a)
+	count, ok := ev.observe(r, stateKey(group, a.GatewayID), ts)
+	if !ok {
+		return Firing{}, false
+	}
+	f := Firing{
+		RuleID:    r.ID,
+		RuleName:  r.Name,
+		Group:     group,
+		GatewayID: a.GatewayID,
+		Count:     count,
+		Time:      ts,
+		Risk:      r.Risk,
+		EventRef:  a.EventID,
+		EventDesc: a.Summary,
+	}
+	f.Message = renderMessage(r, &f, a.Category)
+	return f, true
+}
+
+func (ev *evaluator) observeLifecycle(r *Rule, rec *database.GatewayLifecycle, ts time.Time) (Firing, bool) {
+	count, ok := ev.observe(r, stateKey(GroupNone, rec.GatewayID), ts)
+	if !ok {
+		return Firing{}, false
+	}
+	desc := rec.EventType
+	if rec.ErrorDetail != "" {
+		desc += ": " + rec.ErrorDetail
+	} else if rec.Reason != "" {
+		desc += ": " + rec.Reason
+	}
+	f := Firing{
+		RuleID:    r.ID,
+		RuleName:  r.Name,
+		GatewayID: rec.GatewayID,
+		Count:     count,
+		Time:      ts,
+		Risk:      r.Risk,
+		EventRef:  strconv.FormatUint(uint64(rec.ID), 10),
+		EventDesc: desc,
+	}
+	f.Message = renderMessage(r, &f, rec.EventType)
+	return f, true
+}
+
+// stateKey keeps window state separate per gateway so one gateway's events
+// never count towards another's threshold.
+func stateKey(group string, gatewayID uint) string {
+	if gatewayID == 0 {
+		return group
+	}
+	return group + "@" + strconv.FormatUint(uint64(gatewayID), 10)
+}
+
+// observe records a hit for (rule, group) at ts and reports whether the
+// threshold was reached. The window is reset after each firing so a burst
+// produces one alert rather than one per additional event.
+func (ev *evaluator) observe(r *Rule, group string, ts time.Time) (int, bool) {
+	groups := ev.states[r.ID]
+	if groups == nil {
+		groups = make(map[string]*groupState)
+		ev.states[r.ID] = groups
+	}
+	g := groups[group]
+	if g == nil {
+		if len(groups) >= maxGroupsPerRule {
+			sweepGroups(r, groups, ts)
+		}
+		g = &groupState{}
+		groups[group] = g
+	}
+
+	g.hits = append(PruneHits(g.hits, ts, r.Window()), ts)
+	if len(g.hits) > r.Threshold {
+		g.hits = g.hits[len(g.hits)-r.Threshold:]
+	}
+	if len(g.hits) < r.Threshold {
+		return len(g.hits), false
+	}
+	if !g.lastFired.IsZero() && ts.Sub(g.lastFired) < r.Cooldown() {
+		return len(g.hits), false
+	}
+	count := len(g.hits)
+	g.lastFired = ts
+	g.hits = nil
+	return count, true
+}
+
+// sweepGroups removes groups with no hits inside the window and no active cooldown.
+func sweepGroups(r *Rule, groups map[string]*groupState, now time.Time) {
+	cutoff := now.Add(-r.Window())
+	for key, g := range groups {
+		if len(g.hits) > 0 && g.hits[len(g.hits)-1].After(cutoff) {
+			continue
+		}
+		if !g.lastFired.IsZero() && now.Sub(g.lastFired) < r.Cooldown() {
+			continue
+		}
+		delete(groups, key)
+	}
+}
+
+// renderMessage expands the rule's message template. Supported placeholders:
+// {rule}, {count}, {window}, {group}, {risk}, {event}, {summary}.
+func renderMessage(r *Rule, f *Firing, event string) string {
+	tmpl := r.Message
+	if tmpl == "" {
+		switch {
+		case r.EventKind == KindLifecycle && r.Threshold <= 1:
+			tmpl = "{rule}: gateway {event}"
+		case r.EventKind == KindLifecycle:
+			tmpl = "{rule}: gateway {event} {count}x in {window}"
+		case r.Threshold <= 1:
+			tmpl = "{rule}: {summary}"
+		case r.GroupBy != GroupNone:
+			tmpl = "{rule}: {count} events in {window} ({group})"
+		default:
+			tmpl = "{rule}: {count} events in {window}"
+		}
+	}
+	return strings.NewReplacer(
+		"{rule}", r.Name,
+		"{count}", strconv.Itoa(f.Count),
+		"{window}", FormatWindow(r.Window()),
+		"{group}", f.Group,
+		"{risk}", r.Risk,
+		"{event}", event,
+		"{summary}", f.EventDesc,
+	).Replace(tmpl)
+}
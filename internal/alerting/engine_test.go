@@ -0,0 +1,183 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeNotifier struct {
+	sent chan string
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{sent: make(chan string, 16)}
+}
+
+func (n *fakeNotifier) Send(text string) { n.sent <- "*:" + text }
+
+func (n *fakeNotifier) SendToChannel(channel, text string) error {
+	n.sent <- channel + ":" + text
+	return nil
+}
+
+func saveRule(t *testing.T, r *Rule) *Rule {
+	t.Helper()
+	require.NoError(t, r.Normalize())
+	rec, err := r.Record()
+	require.NoError(t, err)
+	require.NoError(t, database.NewAlertRuleRepo().Create(rec))
+	saved, err := RuleFromRecord(rec)
+	require.NoError(t, err)
+	return saved
+}
+
+func TestRuleNormalize(t *testing.T) {
+	r := &Rule{Name: " x ", EventKind: KindActivity}
+	require.NoError(t, r.Normalize())
+	assert.Equal(t, "x", r.Name)
+	assert.Equal(t, 1, r.Threshold)
+	assert.Equal(t, "medium", r.Risk)
+
+	assert.Error(t, (&Rule{Name: "x", EventKind: "bogus"}).Normalize())
+	assert.Error(t, (&Rule{Name: "x", EventKind: KindActivity, Threshold: 3}).Normalize(), "window required")
+	assert.Error(t, (&Rule{Name: "x", EventKind: KindLifecycle, GroupBy: GroupSession}).Normalize())
+	assert.Error(t, (&Rule{Name: "x", EventKind: KindActivity, Risk: "severe"}).Normalize())
+	assert.Error(t, (&Rule{Name: "x", EventKind: KindActivity, Match: Match{Sources: []string{"["}}}).Normalize())
+}
+
+func TestEngineThresholdPerGroup(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	notifier := newFakeNotifier()
+	engine := NewEngine(NewManager(nil, notifier))
+	saveRule(t, &Rule{
+		Name:      "shell burst",
+		Enabled:   true,
+		EventKind: KindActivity,
+		Match:     Match{Categories: []string{"shell"}},
+		Threshold: 3,
+		WindowSec: 60,
+		GroupBy:   GroupSession,
+		Risk:      "high",
+		Notify:    true,
+		Channels:  []string{"telegram"},
+	})
+	require.NoError(t, engine.Reload())
+	require.Len(t, engine.Rules(), 1)
+
+	base := time.Now().UTC()
+	observe := func(session, category string, offset time.Duration) {
+		engine.ObserveActivity(&database.Activity{
+			EventID:   session + offset.String(),
+			Timestamp: base.Add(offset),
+			Category:  category,
+			SessionID: session,
+		})
+	}
+
+	observe("a", "shell", 0)
+	observe("b", "shell", time.Second)
+	observe("a", "file", 2*time.Second)
+	observe("a", "shell", 3*time.Second)
+	alerts, _, err := database.NewAlertRepo().List(database.AlertFilter{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	observe("a", "shell", 4*time.Second)
+	alerts, _, err = database.NewAlertRepo().List(database.AlertFilter{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high", alerts[0].Risk)
+
+	select {
+	case msg := <-notifier.sent:
+		assert.Contains(t, msg, "telegram:")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected notification on configured channel")
+	}
+}
+
+func TestEngineDisabledRuleNotLoaded(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	saveRule(t, &Rule{Name: "off", Enabled: false, EventKind: KindLifecycle})
+	engine := NewEngine(NewManager(nil, nil))
+	require.NoError(t, engine.Reload())
+	assert.Empty(t, engine.Rules())
+}
+
+func TestEngineDryRun(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	repo := database.NewGatewayLifecycleRepo()
+	base := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, repo.Create(&database.GatewayLifecycle{
+			EventType: "crashed",
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+	require.NoError(t, repo.Create(&database.GatewayLifecycle{
+		EventType: "started",
+		Timestamp: base.Add(5 * time.Minute),
+	}))
+
+	engine := NewEngine(NewManager(nil, nil))
+	rule := &Rule{
+		Name:      "crash loop",
+		EventKind: KindLifecycle,
+		Match:     Match{EventTypes: []string{"crashed"}},
+		Threshold: 2,
+		WindowSec: 600,
+	}
+	require.NoError(t, rule.Normalize())
+
+	res, err := engine.DryRun(rule, base.Add(-time.Minute), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, 5, res.Evaluated)
+	assert.Equal(t, 4, res.Matched)
+	assert.Equal(t, 2, res.Fired)
+
+	alerts, _, err := database.NewAlertRepo().List(database.AlertFilter{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, alerts, "dry run must not persist alerts")
+}
+
+func TestEngineWindowsPerGateway(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	engine := NewEngine(NewManager(nil, nil))
+	saveRule(t, &Rule{
+		Name:      "crash loop",
+		Enabled:   true,
+		EventKind: KindLifecycle,
+		Match:     Match{EventTypes: []string{"crashed"}},
+		Threshold: 2,
+		WindowSec: 600,
+	})
+	require.NoError(t, engine.Reload())
+
+	base := time.Now().UTC()
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "crashed", Timestamp: base, GatewayID: 1})
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "crashed", Timestamp: base.Add(time.Second), GatewayID: 2})
+	alerts, _, err := database.NewAlertRepo().List(database.AlertFilter{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	assert.Empty(t, alerts, "one crash on each gateway must not reach the threshold")
+
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "crashed", Timestamp: base.Add(2 * time.Second), GatewayID: 2})
+	alerts, _, err = database.NewAlertRepo().List(database.AlertFilter{Page: 1, PageSize: 10})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, uint(2), alerts[0].GatewayID)
+	assert.Equal(t, "rule:1@gw2", alerts[0].DedupKey)
+}
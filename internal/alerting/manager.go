@@ -0,0 +1,350 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/notify"
+	"ClawDeckX/internal/web"
+
+	"gorm.io/gorm"
+)
+
+// Settings keys for the global escalation policy, used when a rule does not set its own.
+const (
+	SettingEscalateAfterMin = "alert_escalate_after_min"
+	SettingEscalateChannel  = "alert_escalate_channel"
+)
+
+// ErrInvalidTransition is returned when an alert cannot move to the requested state.
+var ErrInvalidTransition = errors.New("invalid alert state transition")
+
+// Raise describes an alert to open, or to fold into an existing unresolved
+// alert with the same DedupKey.
+type Raise struct {
+	AlertID         string
+	DedupKey        string // empty disables deduplication
+	Risk            string
+	Message         string
+	Detail          string
+	ResolveOn       []string      // lifecycle event types that auto-resolve the alert
+	EscalateAfter   time.Duration // 0 = global setting
+	EscalateChannel string        // "" = global setting
+	GatewayID       uint          // gateway the condition was observed on, 0 = active gateway
+}
+
+// RaiseResult reports what Raise did.
+type RaiseResult struct {
+	Alert   *database.Alert
+	Created bool
+	// Suppressed is true when the alert is acknowledged or silenced, in which
+	// case callers should not send notifications for the repeat.
+	Suppressed bool
+}
+
+// Manager owns alert state: deduplication, acknowledge/silence/resolve
+// transitions, auto-resolution and escalation.
+type Manager struct {
+	repo        *database.AlertRepo
+	settingRepo *database.SettingRepo
+	wsHub       *web.WSHub
+	notifier    Notifier
+
+	mu     sync.Mutex // serializes dedup lookups with inserts
+	stopCh chan struct{}
+}
+
+func NewManager(wsHub *web.WSHub, notifier Notifier) *Manager {
+	return &Manager{
+		repo:        database.NewAlertRepo(),
+		settingRepo: database.NewSettingRepo(),
+		wsHub:       wsHub,
+		notifier:    notifier,
+	}
+}
+
+// Raise opens a new alert or increments the counter of the active alert with the same dedup key.
+func (m *Manager) Raise(spec *Raise) (*RaiseResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	if spec.DedupKey != "" {
+		existing, err := m.repo.FindActiveByDedupKey(spec.DedupKey)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if existing != nil {
+			existing.Count++
+			existing.LastSeenAt = &now
+			existing.Risk = spec.Risk
+			existing.Message = spec.Message
+			existing.Detail = spec.Detail
+			suppressed := existing.Status == constants.AlertStatusAcknowledged ||
+				(existing.Status == constants.AlertStatusSilenced && existing.SilencedUntil != nil && existing.SilencedUntil.After(now))
+			// A suppressed repeat stays read: the operator already handled it.
+			if !suppressed {
+				existing.Notified = false
+			}
+			if err := m.repo.Save(existing); err != nil {
+				return nil, err
+			}
+			m.broadcast("alert_update", existing)
+			return &RaiseResult{Alert: existing, Suppressed: suppressed}, nil
+		}
+	}
+
+	alertID := spec.AlertID
+	if alertID == "" {
+		prefix := spec.DedupKey
+		if prefix == "" {
+			prefix = "alert"
+		}
+		alertID = fmt.Sprintf("%s:%d", prefix, now.UnixNano())
+	}
+	alert := &database.Alert{
+		AlertID:    alertID,
+		DedupKey:   spec.DedupKey,
+		Risk:       spec.Risk,
+		Message:    spec.Message,
+		Detail:     spec.Detail,
+		Status:     constants.AlertStatusOpen,
+		Count:      1,
+		LastSeenAt: &now,
+		ResolveOn:  strings.Join(spec.ResolveOn, ","),
+		GatewayID:  spec.GatewayID,
+		CreatedAt:  now,
+	}
+	after, channel := m.escalationPolicy(spec)
+	if after > 0 && channel != "" {
+		at := now.Add(after)
+		alert.EscalateAt = &at
+		alert.EscalateChannel = channel
+	}
+	if err := m.repo.Create(alert); err != nil {
+		return nil, err
+	}
+	m.broadcast("alert", alert)
+	return &RaiseResult{Alert: alert, Created: true}, nil
+}
+
+// Acknowledge marks an open or silenced alert as being handled by user.
+func (m *Manager) Acknowledge(id uint, user string) (*database.Alert, error) {
+	return m.transition(id, func(a *database.Alert, now time.Time) error {
+		if a.Status == constants.AlertStatusResolved || a.Status == constants.AlertStatusAcknowledged {
+			return ErrInvalidTransition
+		}
+		a.Status = constants.AlertStatusAcknowledged
+		a.AckedBy = user
+		a.AckedAt = &now
+		a.SilencedUntil = nil
+		a.Notified = true
+		return nil
+	})
+}
+
+// Silence suppresses notifications and escalation for an alert until the given time.
+func (m *Manager) Silence(id uint, until time.Time, user string) (*database.Alert, error) {
+	return m.transition(id, func(a *database.Alert, now time.Time) error {
+		if a.Status == constants.AlertStatusResolved || !until.After(now) {
+			return ErrInvalidTransition
+		}
+		u := until.UTC()
+		a.Status = constants.AlertStatusSilenced
+		a.SilencedUntil = &u
+		if a.AckedBy == "" {
+			a.AckedBy = user
+		}
+		a.Notified = true
+		return nil
+	})
+}
+
+// Resolve closes an alert. user is "auto" when the condition cleared on its own.
+func (m *Manager) Resolve(id uint, user string) (*database.Alert, error) {
+	return m.transition(id, func(a *database.Alert, now time.Time) error {
+		if a.Status == constants.AlertStatusResolved {
+			return ErrInvalidTransition
+		}
+		resolve(a, user, now)
+		return nil
+	})
+}
+
+// ResolveOnEvent auto-resolves active alerts raised for gatewayID that list
+// eventType in their resolve-on conditions.
+func (m *Manager) ResolveOnEvent(gatewayID uint, eventType string) int {
+	alerts, err := m.repo.ListActiveResolvable()
+	if err != nil {
+		logger.Alert.Warn().Err(err).Msg("failed to list resolvable alerts")
+		return 0
+	}
+	resolved := 0
+	for i := range alerts {
+		if alerts[i].GatewayID != gatewayID || !containsFold(splitList(alerts[i].ResolveOn), eventType) {
+			continue
+		}
+		if _, err := m.Resolve(alerts[i].ID, "auto"); err == nil {
+			resolved++
+		}
+	}
+	if resolved > 0 {
+		logger.Alert.Info().Str("event", eventType).Uint("gateway_id", gatewayID).Int("count", resolved).Msg("alerts auto-resolved")
+	}
+	return resolved
+}
+
+// ResolveMissing auto-resolves active alerts whose dedup key starts with prefix
+// but is not in present, e.g. security findings that no longer appear in a scan.
+func (m *Manager) ResolveMissing(prefix string, present map[string]bool) int {
+	alerts, err := m.repo.ListActiveByDedupPrefix(prefix)
+	if err != nil {
+		return 0
+	}
+	resolved := 0
+	for i := range alerts {
+		if present[alerts[i].DedupKey] {
+			continue
+		}
+		if _, err := m.Resolve(alerts[i].ID, "auto"); err == nil {
+			resolved++
+		}
+	}
+	return resolved
+}
+
+// Start runs the escalation and silence-expiry loop until Stop is called.
+func (m *Manager) Start(interval time.Duration) {
+	m.mu.Lock()
+	if m.stopCh != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stopCh = make(chan struct{})
+	stopCh := m.stopCh
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.tick(time.Now().UTC())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopCh != nil {
+		close(m.stopCh)
+		m.stopCh = nil
+	}
+}
+
+// tick reopens alerts whose silence expired and escalates overdue open alerts.
+func (m *Manager) tick(now time.Time) {
+	m.mu.Lock()
+	if expired, err := m.repo.ListExpiredSilences(now); err == nil {
+		for i := range expired {
+			a := &expired[i]
+			a.Status = constants.AlertStatusOpen
+			a.SilencedUntil = nil
+			if err := m.repo.Save(a); err == nil {
+				m.broadcast("alert_update", a)
+			}
+		}
+	}
+
+	due, err := m.repo.ListDueEscalation(now)
+	if err != nil {
+		m.mu.Unlock()
+		logger.Alert.Warn().Err(err).Msg("failed to list alerts due for escalation")
+		return
+	}
+	escalated := due[:0]
+	for i := range due {
+		a := due[i]
+		a.EscalatedAt = &now
+		if err := m.repo.Save(&a); err != nil {
+			continue
+		}
+		m.broadcast("alert_update", &a)
+		escalated = append(escalated, a)
+	}
+	m.mu.Unlock()
+
+	for i := range escalated {
+		a := &escalated[i]
+		logger.Alert.Info().Uint("id", a.ID).Str("channel", a.EscalateChannel).Msg("alert escalated")
+		if m.notifier == nil {
+			continue
+		}
+		detail := fmt.Sprintf("unacknowledged since %s, seen %d time(s)", a.CreatedAt.Format(time.RFC3339), a.Count)
+		text := notify.FormatAlert(a.Risk, "[ESCALATED] "+a.Message, detail)
+		if err := m.notifier.SendToChannel(a.EscalateChannel, text); err != nil {
+			logger.Alert.Warn().Err(err).Str("channel", a.EscalateChannel).Uint("id", a.ID).Msg("alert escalation failed")
+		}
+	}
+}
+
+func (m *Manager) transition(id uint, apply func(a *database.Alert, now time.Time) error) (*database.Alert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, err := m.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := apply(a, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := m.repo.Save(a); err != nil {
+		return nil, err
+	}
+	m.broadcast("alert_update", a)
+	return a, nil
+}
+
+// escalationPolicy returns the rule-level escalation settings, falling back to the global ones.
+func (m *Manager) escalationPolicy(spec *Raise) (time.Duration, string) {
+	after, channel := spec.EscalateAfter, spec.EscalateChannel
+	if after == 0 {
+		if v, err := m.settingRepo.Get(SettingEscalateAfterMin); err == nil {
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+				after = time.Duration(n) * time.Minute
+			}
+		}
+	}
+	if channel == "" {
+		if v, err := m.settingRepo.Get(SettingEscalateChannel); err == nil {
+			channel = strings.TrimSpace(v)
+		}
+	}
+	return after, channel
+}
+
+func (m *Manager) broadcast(event string, a *database.Alert) {
+	if m.wsHub == nil {
+		return
+	}
+	m.wsHub.Broadcast("alert", event, a)
+}
+
+func resolve(a *database.Alert, user string, now time.Time) {
+	a.Status = constants.AlertStatusResolved
+	a.ResolvedBy = user
+	a.ResolvedAt = &now
+	a.SilencedUntil = nil
+	a.Notified = true
+}
@@ -0,0 +1,156 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerDedupAndSuppression(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	m := NewManager(nil, nil)
+	spec := &Raise{DedupKey: "rule:1", Risk: "high", Message: "boom"}
+
+	first, err := m.Raise(spec)
+	require.NoError(t, err)
+	assert.True(t, first.Created)
+
+	second, err := m.Raise(spec)
+	require.NoError(t, err)
+	assert.False(t, second.Created)
+	assert.False(t, second.Suppressed)
+	assert.False(t, second.Alert.Notified)
+	assert.Equal(t, first.Alert.ID, second.Alert.ID)
+	assert.Equal(t, 2, second.Alert.Count)
+
+	_, err = m.Acknowledge(first.Alert.ID, "alice")
+	require.NoError(t, err)
+	require.NoError(t, database.NewAlertRepo().MarkNotified(first.Alert.ID))
+	third, err := m.Raise(spec)
+	require.NoError(t, err)
+	assert.True(t, third.Suppressed, "repeats of an acknowledged alert must not notify")
+	assert.True(t, third.Alert.Notified, "suppressed repeats stay read")
+	assert.Equal(t, constants.AlertStatusAcknowledged, third.Alert.Status)
+	assert.Equal(t, "alice", third.Alert.AckedBy)
+
+	_, err = m.Acknowledge(first.Alert.ID, "alice")
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+
+	_, err = m.Resolve(first.Alert.ID, "alice")
+	require.NoError(t, err)
+	fourth, err := m.Raise(spec)
+	require.NoError(t, err)
+	assert.True(t, fourth.Created, "a resolved alert starts a new one")
+}
+
+func TestManagerSilenceExpiry(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	m := NewManager(nil, nil)
+	res, err := m.Raise(&Raise{DedupKey: "k", Risk: "low", Message: "m"})
+	require.NoError(t, err)
+
+	_, err = m.Silence(res.Alert.ID, time.Now().Add(-time.Minute), "bob")
+	assert.ErrorIs(t, err, ErrInvalidTransition)
+
+	until := time.Now().Add(time.Hour)
+	a, err := m.Silence(res.Alert.ID, until, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, constants.AlertStatusSilenced, a.Status)
+
+	again, err := m.Raise(&Raise{DedupKey: "k", Risk: "low", Message: "m"})
+	require.NoError(t, err)
+	assert.True(t, again.Suppressed)
+
+	m.tick(until.Add(time.Second).UTC())
+	a, err = database.NewAlertRepo().GetByID(res.Alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, constants.AlertStatusOpen, a.Status)
+	assert.Nil(t, a.SilencedUntil)
+}
+
+func TestManagerAutoResolveAndEscalation(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	notifier := newFakeNotifier()
+	m := NewManager(nil, notifier)
+
+	down, err := m.Raise(&Raise{
+		DedupKey:        "rule:7",
+		Risk:            "critical",
+		Message:         "gateway unreachable",
+		ResolveOn:       []string{"recovered"},
+		EscalateAfter:   10 * time.Minute,
+		EscalateChannel: "pagerduty",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, down.Alert.EscalateAt)
+
+	m.tick(time.Now().UTC())
+	select {
+	case msg := <-notifier.sent:
+		t.Fatalf("escalated too early: %s", msg)
+	default:
+	}
+
+	m.tick(time.Now().UTC().Add(11 * time.Minute))
+	select {
+	case msg := <-notifier.sent:
+		assert.Contains(t, msg, "pagerduty:")
+		assert.Contains(t, msg, "ESCALATED")
+	default:
+		t.Fatal("expected escalation notification")
+	}
+	m.tick(time.Now().UTC().Add(12 * time.Minute))
+	assert.Empty(t, notifier.sent, "escalation fires once")
+
+	assert.Equal(t, 0, m.ResolveOnEvent(0, "started"))
+	assert.Equal(t, 1, m.ResolveOnEvent(0, "recovered"))
+	a, err := database.NewAlertRepo().GetByID(down.Alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, constants.AlertStatusResolved, a.Status)
+	assert.Equal(t, "auto", a.ResolvedBy)
+}
+
+func TestManagerGlobalEscalationSetting(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, database.NewSettingRepo().SetBatch(map[string]string{
+		SettingEscalateAfterMin: "5",
+		SettingEscalateChannel:  "slack",
+	}))
+	m := NewManager(nil, nil)
+	res, err := m.Raise(&Raise{Risk: "high", Message: "x"})
+	require.NoError(t, err)
+	require.NotNil(t, res.Alert.EscalateAt)
+	assert.Equal(t, "slack", res.Alert.EscalateChannel)
+}
+
+func TestManagerGatewayScopedResolve(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	m := NewManager(nil, nil)
+	first, err := m.Raise(&Raise{DedupKey: "rule:1@gw1", Risk: "high", Message: "down", ResolveOn: []string{"recovered"}, GatewayID: 1})
+	require.NoError(t, err)
+	second, err := m.Raise(&Raise{DedupKey: "rule:1@gw2", Risk: "high", Message: "down", ResolveOn: []string{"recovered"}, GatewayID: 2})
+	require.NoError(t, err)
+	assert.True(t, second.Created, "different gateways do not deduplicate")
+
+	assert.Equal(t, 1, m.ResolveOnEvent(2, "recovered"))
+	a, err := database.NewAlertRepo().GetByID(first.Alert.ID)
+	require.NoError(t, err)
+	assert.Equal(t, constants.AlertStatusOpen, a.Status, "recovery of another gateway must not resolve the alert")
+	assert.Equal(t, uint(1), a.GatewayID)
+}
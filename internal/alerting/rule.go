@@ -0,0 +1,285 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+)
+
+// Event kinds a rule can be bound to.
+const (
+	KindActivity  = "activity"
+	KindLifecycle = "lifecycle"
+)
+
+// Group-by keys: a rule's threshold is counted independently per group value.
+const (
+	GroupNone     = ""
+	GroupSession  = "session"
+	GroupSource   = "source"
+	GroupCategory = "category"
+)
+
+var (
+	lifecycleEventTypes = []string{"started", "shutdown", "crashed", "unreachable", "recovered"}
+	downEventTypes      = []string{"shutdown", "crashed", "unreachable"}
+)
+
+// Match describes which events a rule applies to. Empty lists match anything.
+type Match struct {
+	Categories      []string `json:"categories,omitempty"`
+	Risks           []string `json:"risks,omitempty"`
+	Sources         []string `json:"sources,omitempty"` // glob patterns (path.Match syntax)
+	ActionTaken     []string `json:"action_taken,omitempty"`
+	SummaryContains string   `json:"summary_contains,omitempty"`
+	EventTypes      []string `json:"event_types,omitempty"` // lifecycle: started, shutdown, crashed, unreachable, recovered
+}
+
+// Rule is the decoded form of database.AlertRule used by the engine and API.
+type Rule struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+	EventKind   string    `json:"event_kind"`
+	Match       Match     `json:"match"`
+	Threshold   int       `json:"threshold"`
+	WindowSec   int       `json:"window_sec"`
+	GroupBy     string    `json:"group_by"`
+	Risk        string    `json:"risk"`
+	Message     string    `json:"message"`
+	Notify      bool      `json:"notify"`
+	Channels    []string  `json:"channels"`
+	CooldownSec int       `json:"cooldown_sec"`
+	ResolveOn   []string  `json:"resolve_on"`
+	EscalateMin int       `json:"escalate_min"`
+	EscalateTo  string    `json:"escalate_to"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RuleFromRecord decodes a persisted rule.
+func RuleFromRecord(rec *database.AlertRule) (*Rule, error) {
+	r := &Rule{
+		ID:          rec.ID,
+		Name:        rec.Name,
+		Description: rec.Description,
+		Enabled:     rec.Enabled,
+		EventKind:   rec.EventKind,
+		Threshold:   rec.Threshold,
+		WindowSec:   rec.WindowSec,
+		GroupBy:     rec.GroupBy,
+		Risk:        rec.Risk,
+		Message:     rec.Message,
+		Notify:      rec.Notify,
+		Channels:    splitList(rec.Channels),
+		CooldownSec: rec.CooldownSec,
+		ResolveOn:   splitList(rec.ResolveOn),
+		EscalateMin: rec.EscalateMin,
+		EscalateTo:  rec.EscalateTo,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+	if rec.MatchJSON != "" {
+		if err := json.Unmarshal([]byte(rec.MatchJSON), &r.Match); err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match: %w", rec.ID, err)
+		}
+	}
+	return r, nil
+}
+
+// Record encodes the rule into its persisted form.
+func (r *Rule) Record() (*database.AlertRule, error) {
+	match, err := json.Marshal(r.Match)
+	if err != nil {
+		return nil, err
+	}
+	return &database.AlertRule{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Enabled:     r.Enabled,
+		EventKind:   r.EventKind,
+		MatchJSON:   string(match),
+		Threshold:   r.Threshold,
+		WindowSec:   r.WindowSec,
+		GroupBy:     r.GroupBy,
+		Risk:        r.Risk,
+		Message:     r.Message,
+		Notify:      r.Notify,
+		Channels:    strings.Join(r.Channels, ","),
+		CooldownSec: r.CooldownSec,
+		ResolveOn:   strings.Join(r.ResolveOn, ","),
+		EscalateMin: r.EscalateMin,
+		EscalateTo:  r.EscalateTo,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}, nil
+}
+
+// Normalize fills defaults and validates the rule.
+func (r *Rule) Normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch r.EventKind {
+	case KindActivity, KindLifecycle:
+	default:
+		return fmt.Errorf("event_kind must be %q or %q", KindActivity, KindLifecycle)
+	}
+	if r.Threshold <= 0 {
+		r.Threshold = 1
+	}
+	if r.WindowSec < 0 || r.CooldownSec < 0 {
+		return fmt.Errorf("window_sec and cooldown_sec must not be negative")
+	}
+	if r.Threshold > 1 && r.WindowSec == 0 {
+		return fmt.Errorf("window_sec is required when threshold is greater than 1")
+	}
+	switch r.GroupBy {
+	case GroupNone, GroupSession, GroupSource, GroupCategory:
+	default:
+		return fmt.Errorf("unsupported group_by %q", r.GroupBy)
+	}
+	if r.EventKind == KindLifecycle && r.GroupBy != GroupNone {
+		return fmt.Errorf("group_by is only supported for activity rules")
+	}
+	if r.Risk == "" {
+		r.Risk = constants.RiskMedium
+	}
+	validRisk := false
+	for _, lvl := range constants.AllRiskLevels {
+		if r.Risk == lvl {
+			validRisk = true
+			break
+		}
+	}
+	if !validRisk {
+		return fmt.Errorf("unsupported risk %q", r.Risk)
+	}
+	for _, pattern := range r.Match.Sources {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid source pattern %q", pattern)
+		}
+	}
+	var channels []string
+	for _, ch := range r.Channels {
+		if ch = strings.TrimSpace(ch); ch != "" {
+			channels = append(channels, ch)
+		}
+	}
+	r.Channels = channels
+
+	if r.EscalateMin < 0 {
+		return fmt.Errorf("escalate_min must not be negative")
+	}
+	r.EscalateTo = strings.TrimSpace(r.EscalateTo)
+	for _, ev := range r.ResolveOn {
+		if !containsFold(lifecycleEventTypes, ev) {
+			return fmt.Errorf("unsupported resolve_on event %q", ev)
+		}
+	}
+	// Gateway-down rules clear themselves once the gateway is back, unless told otherwise.
+	if r.ResolveOn == nil && r.EventKind == KindLifecycle && len(r.Match.EventTypes) > 0 {
+		down := true
+		for _, ev := range r.Match.EventTypes {
+			if !containsFold(downEventTypes, ev) {
+				down = false
+				break
+			}
+		}
+		if down {
+			r.ResolveOn = []string{"recovered", "started"}
+		}
+	}
+	return nil
+}
+
+// Window returns the rule's counting window.
+func (r *Rule) Window() time.Duration {
+	return time.Duration(r.WindowSec) * time.Second
+}
+
+// Cooldown returns the minimum interval between two firings for the same group.
+func (r *Rule) Cooldown() time.Duration {
+	return time.Duration(r.CooldownSec) * time.Second
+}
+
+// MatchActivity reports whether the activity satisfies the rule's criteria.
+func (r *Rule) MatchActivity(a *database.Activity) bool {
+	if r.EventKind != KindActivity {
+		return false
+	}
+	m := &r.Match
+	if !containsFold(m.Categories, a.Category) || !containsFold(m.Risks, a.Risk) || !containsFold(m.ActionTaken, a.ActionTaken) {
+		return false
+	}
+	if len(m.Sources) > 0 && !matchAnyGlob(m.Sources, a.Source) {
+		return false
+	}
+	if m.SummaryContains != "" && !strings.Contains(strings.ToLower(a.Summary), strings.ToLower(m.SummaryContains)) {
+		return false
+	}
+	return true
+}
+
+// MatchLifecycle reports whether the lifecycle event satisfies the rule's criteria.
+func (r *Rule) MatchLifecycle(ev *database.GatewayLifecycle) bool {
+	if r.EventKind != KindLifecycle {
+		return false
+	}
+	return containsFold(r.Match.EventTypes, ev.EventType)
+}
+
+// groupKey returns the value an activity is bucketed under for this rule.
+func (r *Rule) groupKey(a *database.Activity) string {
+	switch r.GroupBy {
+	case GroupSession:
+		return a.SessionID
+	case GroupSource:
+		return a.Source
+	case GroupCategory:
+		return a.Category
+	default:
+		return ""
+	}
+}
+
+// containsFold reports whether v is in list (case-insensitive). An empty list matches everything.
+func containsFold(list []string, v string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyGlob(patterns []string, v string) bool {
+	lower := strings.ToLower(v)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), lower); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
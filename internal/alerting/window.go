@@ -0,0 +1,44 @@
+package alerting
+
+import (
+	"fmt"
+	"time"
+)
+
+// PruneHits drops the hits at or before ts minus window, keeping the ones a
+// sliding window ending at ts still counts. A zero window keeps none. Hits
+// must be in ascending order.
+func PruneHits(hits []time.Time, ts time.Time, window time.Duration) []time.Time {
+	if window <= 0 {
+		return hits[:0]
+	}
+	cutoff := ts.Add(-window)
+	i := 0
+	for i < len(hits) && !hits[i].After(cutoff) {
+		i++
+	}
+	return hits[i:]
+}
+
+// FormatWindow renders a duration in its largest whole unit, e.g. "10m",
+// or to the second when it has none, e.g. "2h0m1s".
+func FormatWindow(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "0s"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	default:
+		return d.Truncate(time.Second).String()
+	}
+}
+
+// EventTime returns ts, or the current time for events that carry none.
+func EventTime(ts time.Time) time.Time {
+	if ts.IsZero() {
+		return time.Now().UTC()
+	}
+	return ts
+}
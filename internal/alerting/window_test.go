@@ -0,0 +1,26 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneHits(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	hits := []time.Time{base, base.Add(30 * time.Second), base.Add(90 * time.Second)}
+
+	now := base.Add(2 * time.Minute)
+	assert.Equal(t, hits[1:], PruneHits(hits, now, 2*time.Minute-time.Second), "drops hits at or before the cutoff")
+	assert.Equal(t, hits[2:], PruneHits(hits, now, 90*time.Second))
+	assert.Empty(t, PruneHits(hits, now, 0))
+}
+
+func TestFormatWindow(t *testing.T) {
+	assert.Equal(t, "0s", FormatWindow(0))
+	assert.Equal(t, "2h", FormatWindow(2*time.Hour))
+	assert.Equal(t, "10m", FormatWindow(10*time.Minute))
+	assert.Equal(t, "1m30s", FormatWindow(90*time.Second))
+	assert.Equal(t, "2h0m1s", FormatWindow(2*time.Hour+time.Second+time.Millisecond))
+}
@@ -0,0 +1,524 @@
+// Package availability computes gateway uptime, incident and SLO figures
+// from the gateway lifecycle timeline, and keeps daily rollups of them so
+// history survives lifecycle record pruning.
+package availability
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// Report bucket granularities.
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// SLO statuses.
+const (
+	SLOMet      = "met"
+	SLOAtRisk   = "at_risk"
+	SLOBreached = "breached"
+	SLONoData   = "no_data"
+)
+
+const (
+	// atRiskRemainingPct flags an SLO whose remaining error budget drops below it.
+	atRiskRemainingPct = 25
+	// fastBurnRate flags an SLO burning budget this fast over the last hour:
+	// at 14.4x a 30-day budget is gone in about two days.
+	fastBurnRate  = 14.4
+	maxWindowDays = 366
+)
+
+// Metrics are the availability figures of one period.
+type Metrics struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Stats
+	// UptimePct is up / (up + down). Maintenance and unknown time are not
+	// counted; nil when the gateway was neither up nor down in the period.
+	UptimePct *float64 `json:"uptime_pct"`
+	// MTBFSec is the up time per incident; nil without incidents.
+	MTBFSec *int64 `json:"mtbf_sec"`
+	// MTTRSec is the mean duration of the ended outages; nil when none ended.
+	MTTRSec *int64 `json:"mttr_sec"`
+}
+
+func newMetrics(start, end time.Time, s Stats) Metrics {
+	m := Metrics{Start: start, End: end, Stats: s}
+	if observed := s.UpSec + s.DownSec; observed > 0 {
+		pct := float64(s.UpSec) * 100 / float64(observed)
+		m.UptimePct = &pct
+	}
+	if s.Incidents > 0 {
+		mtbf := s.UpSec / int64(s.Incidents)
+		m.MTBFSec = &mtbf
+	}
+	if s.Repaired > 0 {
+		mttr := s.RepairSec / int64(s.Repaired)
+		m.MTTRSec = &mttr
+	}
+	return m
+}
+
+// Query selects a report. Since and Until are widened to whole UTC days.
+type Query struct {
+	Since       time.Time
+	Until       time.Time
+	Granularity string // day, week (ISO, from Monday) or month
+	GatewayID   *uint  // nil = every gateway
+}
+
+// GatewayReport is the availability of one gateway profile.
+type GatewayReport struct {
+	GatewayID   uint      `json:"gateway_id"`
+	ProfileName string    `json:"profile_name"`
+	Total       Metrics   `json:"total"`
+	Buckets     []Metrics `json:"buckets"`
+}
+
+// Report is the availability of each gateway over a query range.
+type Report struct {
+	Since       time.Time       `json:"since"`
+	Until       time.Time       `json:"until"`
+	Granularity string          `json:"granularity"`
+	Gateways    []GatewayReport `json:"gateways"`
+}
+
+// SLOStatus is an SLO evaluated for one gateway over its rolling window.
+type SLOStatus struct {
+	SLOID       uint      `json:"slo_id"`
+	Name        string    `json:"name"`
+	GatewayID   uint      `json:"gateway_id"`
+	ProfileName string    `json:"profile_name"`
+	TargetPct   float64   `json:"target_pct"`
+	WindowDays  int       `json:"window_days"`
+	WindowStart time.Time `json:"window_start"`
+	AttainedPct *float64  `json:"attained_pct"` // nil when nothing was observed
+	// BudgetSec is the downtime the target allows over the whole window.
+	BudgetSec    int64   `json:"budget_sec"`
+	ConsumedSec  int64   `json:"consumed_sec"`
+	RemainingSec int64   `json:"remaining_sec"`
+	RemainingPct float64 `json:"remaining_pct"`
+	// Burn rates compare the downtime share of the last hour or day with the
+	// share the target allows: 1 spends the budget exactly over the window.
+	BurnRate1h  *float64 `json:"burn_rate_1h"`
+	BurnRate24h *float64 `json:"burn_rate_24h"`
+	Status      string   `json:"status"` // met, at_risk, breached, no_data
+}
+
+// NormalizeSLO validates an SLO and fills in defaults.
+func NormalizeSLO(slo *database.GatewaySLO) error {
+	slo.Name = strings.TrimSpace(slo.Name)
+	if slo.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if slo.TargetPct <= 0 || slo.TargetPct >= 100 {
+		return fmt.Errorf("target_pct must be between 0 and 100, exclusive")
+	}
+	if slo.WindowDays == 0 {
+		slo.WindowDays = 30
+	}
+	if slo.WindowDays < 1 || slo.WindowDays > maxWindowDays {
+		return fmt.Errorf("window_days must be between 1 and %d", maxWindowDays)
+	}
+	return nil
+}
+
+// Service computes availability from lifecycle records and daily rollups.
+type Service struct {
+	lifecycle *database.GatewayLifecycleRepo
+	daily     *database.GatewayAvailabilityRepo
+	slos      *database.GatewaySLORepo
+	profiles  *database.GatewayProfileRepo
+	now       func() time.Time
+}
+
+func NewService() *Service {
+	return &Service{
+		lifecycle: database.NewGatewayLifecycleRepo(),
+		daily:     database.NewGatewayAvailabilityRepo(),
+		slos:      database.NewGatewaySLORepo(),
+		profiles:  database.NewGatewayProfileRepo(),
+		now:       time.Now,
+	}
+}
+
+type dayResult struct {
+	day      time.Time
+	stats    Stats
+	endState string
+	open     bool // an outage that started this day is still going on
+}
+
+// Rollup stores the rollups of complete days not rolled up yet. A day in
+// which a still-going outage started is held back so its repair time is
+// final, unless the day is on or before force's day: lifecycle records of
+// those days are about to be pruned.
+func (s *Service) Rollup(force time.Time) error {
+	ids, err := s.gatewayIDs()
+	if err != nil {
+		return err
+	}
+	today := dayOf(s.now())
+	forceDay := dayOf(force)
+	for _, gw := range ids {
+		from, ok, err := s.nextRollupDay(gw)
+		if err != nil {
+			return err
+		}
+		if !ok || !from.Before(today) {
+			continue
+		}
+		days, err := s.liveDays(gw, from, today)
+		if err != nil {
+			return err
+		}
+		for _, d := range days {
+			if d.open && d.day.After(forceDay) {
+				break
+			}
+			if err := s.daily.Upsert(d.record(gw)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Report computes availability per gateway and per bucket. Days already
+// rolled up come from the rollups, later ones from lifecycle records.
+func (s *Service) Report(q Query) (*Report, error) {
+	switch q.Granularity {
+	case "":
+		q.Granularity = GranularityDay
+	case GranularityDay, GranularityWeek, GranularityMonth:
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", q.Granularity)
+	}
+	from, to := dayOf(q.Since), dayOf(q.Until).AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return nil, fmt.Errorf("since must not be after until")
+	}
+	ids, err := s.scope(q.GatewayID)
+	if err != nil {
+		return nil, err
+	}
+	names := s.profileNames()
+	now := s.now().UTC()
+
+	report := &Report{Since: from, Until: earlier(to, now), Granularity: q.Granularity, Gateways: []GatewayReport{}}
+	for _, gw := range ids {
+		days, err := s.days(gw, from, to)
+		if err != nil {
+			return nil, err
+		}
+		gr := GatewayReport{GatewayID: gw, ProfileName: names[gw], Buckets: []Metrics{}}
+		var total, cur Stats
+		var curStart time.Time
+		flush := func(next time.Time) {
+			gr.Buckets = append(gr.Buckets, newMetrics(later(curStart, from), earlier(earlier(next, to), now), cur))
+		}
+		for _, d := range days {
+			start := bucketStart(d.day, q.Granularity)
+			if !curStart.IsZero() && !start.Equal(curStart) {
+				flush(start)
+				cur = Stats{}
+			}
+			curStart = start
+			cur.Add(d.stats)
+			total.Add(d.stats)
+		}
+		if !curStart.IsZero() {
+			flush(bucketEnd(curStart, q.Granularity))
+		}
+		gr.Total = newMetrics(from, earlier(to, now), total)
+		report.Gateways = append(report.Gateways, gr)
+	}
+	return report, nil
+}
+
+// SLOs evaluates every SLO for each gateway it covers.
+func (s *Service) SLOs() ([]SLOStatus, error) {
+	slos, err := s.slos.List()
+	if err != nil {
+		return nil, err
+	}
+	names := s.profileNames()
+	out := []SLOStatus{}
+	for i := range slos {
+		ids, err := s.scope(slos[i].GatewayID)
+		if err != nil {
+			return nil, err
+		}
+		for _, gw := range ids {
+			st, err := s.evaluate(&slos[i], gw)
+			if err != nil {
+				return nil, err
+			}
+			st.ProfileName = names[gw]
+			out = append(out, *st)
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) evaluate(slo *database.GatewaySLO, gw uint) (*SLOStatus, error) {
+	now := s.now().UTC()
+	from := dayOf(now).AddDate(0, 0, 1-slo.WindowDays)
+	days, err := s.days(gw, from, dayOf(now).AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	var window Stats
+	for _, d := range days {
+		window.Add(d.stats)
+	}
+	allowed := 1 - slo.TargetPct/100
+	st := &SLOStatus{
+		SLOID:       slo.ID,
+		Name:        slo.Name,
+		GatewayID:   gw,
+		TargetPct:   slo.TargetPct,
+		WindowDays:  slo.WindowDays,
+		WindowStart: from,
+		BudgetSec:   int64(math.Round(allowed * float64(slo.WindowDays) * 86400)),
+		ConsumedSec: window.DownSec,
+	}
+	st.RemainingSec = st.BudgetSec - st.ConsumedSec
+	if st.BudgetSec > 0 {
+		st.RemainingPct = float64(st.RemainingSec) * 100 / float64(st.BudgetSec)
+	}
+	st.AttainedPct = newMetrics(from, now, window).UptimePct
+	for _, w := range []struct {
+		d    time.Duration
+		rate **float64
+	}{{time.Hour, &st.BurnRate1h}, {24 * time.Hour, &st.BurnRate24h}} {
+		recent, err := s.window(gw, now.Add(-w.d), now)
+		if err != nil {
+			return nil, err
+		}
+		if observed := recent.UpSec + recent.DownSec; observed > 0 {
+			rate := float64(recent.DownSec) / float64(observed) / allowed
+			*w.rate = &rate
+		}
+	}
+
+	switch {
+	case st.AttainedPct == nil:
+		st.Status = SLONoData
+	case st.RemainingSec < 0:
+		st.Status = SLOBreached
+	case st.RemainingPct < atRiskRemainingPct, st.BurnRate1h != nil && *st.BurnRate1h >= fastBurnRate:
+		st.Status = SLOAtRisk
+	default:
+		st.Status = SLOMet
+	}
+	return st, nil
+}
+
+// days returns per-day stats for [from, to): stored rollups, then days
+// computed from lifecycle records.
+func (s *Service) days(gw uint, from, to time.Time) ([]dayResult, error) {
+	rows, err := s.daily.List(gw, from, to.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]dayResult, 0, len(rows))
+	for i := range rows {
+		out = append(out, dayResult{day: dayOf(rows[i].Day), stats: statsOf(&rows[i]), endState: rows[i].EndState})
+	}
+	liveFrom, ok, err := s.nextRollupDay(gw)
+	if err != nil || !ok {
+		return out, err
+	}
+	live, err := s.liveDays(gw, later(liveFrom, from), to)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, live...), nil
+}
+
+// liveDays computes per-day stats for [from, to) from lifecycle records.
+func (s *Service) liveDays(gw uint, from, to time.Time) ([]dayResult, error) {
+	now := s.now().UTC()
+	if !from.Before(to) || !from.Before(now) {
+		return nil, nil
+	}
+	tl, err := s.timeline(gw, from, now)
+	if err != nil {
+		return nil, err
+	}
+	var out []dayResult
+	for d := from; d.Before(to) && d.Before(now); d = d.AddDate(0, 0, 1) {
+		end := d.AddDate(0, 0, 1)
+		out = append(out, dayResult{
+			day:      d,
+			stats:    tl.stats(d, end),
+			endState: tl.stateAt(earlier(end, now)),
+			open:     tl.openOutage(d, end),
+		})
+	}
+	return out, nil
+}
+
+// window computes stats for an arbitrary [from, to) from lifecycle records.
+func (s *Service) window(gw uint, from, to time.Time) (Stats, error) {
+	tl, err := s.timeline(gw, from, to)
+	if err != nil {
+		return Stats{}, err
+	}
+	return tl.stats(from, to), nil
+}
+
+func (s *Service) timeline(gw uint, from, now time.Time) (*timeline, error) {
+	initial, err := s.stateBefore(gw, from)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.lifecycle.ListStates(gw, from, now)
+	if err != nil {
+		return nil, err
+	}
+	return buildTimeline(initial, events, from, now), nil
+}
+
+// stateBefore returns the state a gateway was in just before t, falling back
+// to the rollups once the lifecycle records have been pruned.
+func (s *Service) stateBefore(gw uint, t time.Time) (string, error) {
+	rec, err := s.lifecycle.LastStateBefore(gw, t)
+	if err == nil {
+		return stateOf(rec.EventType), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	day, err := s.daily.LastBefore(gw, t)
+	if err == nil {
+		return day.EndState, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	return StateUnknown, nil
+}
+
+// nextRollupDay returns the first day of a gateway not rolled up yet, and
+// false when the gateway has no history at all.
+func (s *Service) nextRollupDay(gw uint) (time.Time, bool, error) {
+	last, err := s.daily.Last(gw)
+	if err == nil {
+		return dayOf(last.Day).AddDate(0, 0, 1), true, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, err
+	}
+	first, err := s.lifecycle.FirstStateAt(gw)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return dayOf(first), true, nil
+}
+
+// scope returns the requested gateway, or every gateway with history.
+func (s *Service) scope(gatewayID *uint) ([]uint, error) {
+	if gatewayID != nil {
+		return []uint{*gatewayID}, nil
+	}
+	return s.gatewayIDs()
+}
+
+func (s *Service) gatewayIDs() ([]uint, error) {
+	fromEvents, err := s.lifecycle.GatewayIDs()
+	if err != nil {
+		return nil, err
+	}
+	fromRollups, err := s.daily.GatewayIDs()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, id := range append(fromEvents, fromRollups...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *Service) profileNames() map[uint]string {
+	names := make(map[uint]string)
+	profiles, err := s.profiles.List()
+	if err != nil {
+		return names
+	}
+	for _, p := range profiles {
+		names[p.ID] = p.Name
+	}
+	return names
+}
+
+func (d *dayResult) record(gw uint) *database.GatewayAvailabilityDaily {
+	return &database.GatewayAvailabilityDaily{
+		GatewayID:        gw,
+		Day:              d.day,
+		UpSec:            d.stats.UpSec,
+		DownSec:          d.stats.DownSec,
+		MaintenanceSec:   d.stats.MaintenanceSec,
+		UnknownSec:       d.stats.UnknownSec,
+		Incidents:        d.stats.Incidents,
+		Repaired:         d.stats.Repaired,
+		RepairSec:        d.stats.RepairSec,
+		LongestOutageSec: d.stats.LongestOutageSec,
+		EndState:         d.endState,
+	}
+}
+
+func statsOf(row *database.GatewayAvailabilityDaily) Stats {
+	return Stats{
+		UpSec:            row.UpSec,
+		DownSec:          row.DownSec,
+		MaintenanceSec:   row.MaintenanceSec,
+		UnknownSec:       row.UnknownSec,
+		Incidents:        row.Incidents,
+		Repaired:         row.Repaired,
+		RepairSec:        row.RepairSec,
+		LongestOutageSec: row.LongestOutageSec,
+	}
+}
+
+func bucketStart(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case GranularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func bucketEnd(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return start.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
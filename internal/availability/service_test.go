@@ -0,0 +1,183 @@
+package availability
+
+import (
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+
+func at(day, hour, min int) time.Time {
+	return time.Date(2026, 3, day, hour, min, 0, 0, time.UTC)
+}
+
+func record(t *testing.T, gw uint, eventType string, ts time.Time) {
+	t.Helper()
+	require.NoError(t, database.NewGatewayLifecycleRepo().Create(&database.GatewayLifecycle{
+		Timestamp: ts,
+		EventType: eventType,
+		GatewayID: gw,
+	}))
+}
+
+func newTestService() *Service {
+	s := NewService()
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+// seedHistory records two incidents for gateway 1, the second one spanning
+// midnight, plus a clean restart.
+func seedHistory(t *testing.T) {
+	record(t, 1, "started", at(1, 0, 0))
+	record(t, 1, "crashed", at(1, 10, 0))
+	record(t, 1, "recovered", at(1, 10, 30))
+	record(t, 1, "unreachable", at(2, 23, 0))
+	record(t, 1, "crashed", at(2, 23, 30)) // still down: same incident
+	record(t, 1, "recovered", at(3, 1, 0))
+	record(t, 1, "shutdown", at(3, 12, 0))
+	record(t, 1, "started", at(3, 13, 0))
+	record(t, 1, "remediation", at(3, 14, 0))
+}
+
+func TestReportPerDayAndWeek(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	seedHistory(t)
+	s := newTestService()
+
+	report, err := s.Report(Query{Since: at(1, 0, 0), Until: testNow, Granularity: GranularityDay})
+	require.NoError(t, err)
+	require.Len(t, report.Gateways, 1)
+	gw := report.Gateways[0]
+	require.Len(t, gw.Buckets, 4)
+
+	day1 := gw.Buckets[0]
+	assert.Equal(t, Stats{UpSec: 84600, DownSec: 1800, Incidents: 1, Repaired: 1, RepairSec: 1800, LongestOutageSec: 1800}, day1.Stats)
+	day2 := gw.Buckets[1]
+	assert.Equal(t, Stats{UpSec: 82800, DownSec: 3600, Incidents: 1, Repaired: 1, RepairSec: 7200, LongestOutageSec: 7200}, day2.Stats)
+	day3 := gw.Buckets[2]
+	assert.Equal(t, Stats{UpSec: 79200, DownSec: 3600, MaintenanceSec: 3600}, day3.Stats)
+	assert.Nil(t, day3.MTBFSec)
+	assert.Equal(t, testNow, gw.Buckets[3].End)
+	assert.EqualValues(t, 43200, gw.Buckets[3].UpSec)
+
+	total := gw.Total
+	assert.EqualValues(t, 289800, total.UpSec)
+	assert.EqualValues(t, 9000, total.DownSec)
+	assert.Equal(t, 2, total.Incidents)
+	assert.EqualValues(t, 4500, *total.MTTRSec)
+	assert.EqualValues(t, 144900, *total.MTBFSec)
+	assert.EqualValues(t, 7200, total.LongestOutageSec)
+	assert.InDelta(t, 96.99, *total.UptimePct, 0.01)
+
+	// 2026-03-01 is a Sunday: it closes one ISO week, the rest opens the next.
+	weekly, err := s.Report(Query{Since: at(1, 0, 0), Until: testNow, Granularity: GranularityWeek})
+	require.NoError(t, err)
+	buckets := weekly.Gateways[0].Buckets
+	require.Len(t, buckets, 2)
+	assert.Equal(t, at(1, 0, 0), buckets[0].Start)
+	assert.Equal(t, at(2, 0, 0), buckets[0].End)
+	assert.Equal(t, at(2, 0, 0), buckets[1].Start)
+	assert.Equal(t, 1, buckets[1].Incidents)
+}
+
+func TestRollupSurvivesPruning(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	seedHistory(t)
+	s := newTestService()
+
+	before, err := s.Report(Query{Since: at(1, 0, 0), Until: testNow})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Rollup(at(1, 0, 0)))
+	last, err := database.NewGatewayAvailabilityRepo().Last(1)
+	require.NoError(t, err)
+	assert.True(t, last.Day.Equal(at(3, 0, 0)), "today is never rolled up")
+	assert.Equal(t, StateUp, last.EndState)
+
+	// Prune everything but today's records.
+	require.NoError(t, database.DB.Where("timestamp < ?", at(4, 0, 0)).Delete(&database.GatewayLifecycle{}).Error)
+
+	after, err := s.Report(Query{Since: at(1, 0, 0), Until: testNow})
+	require.NoError(t, err)
+	assert.Equal(t, before.Gateways[0].Total, after.Gateways[0].Total)
+	assert.Equal(t, before.Gateways[0].Buckets, after.Gateways[0].Buckets)
+
+	// Rolling up again changes nothing.
+	require.NoError(t, s.Rollup(at(1, 0, 0)))
+	again, err := s.Report(Query{Since: at(1, 0, 0), Until: testNow})
+	require.NoError(t, err)
+	assert.Equal(t, after.Gateways[0].Total, again.Gateways[0].Total)
+}
+
+func TestRollupHoldsBackOpenOutage(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	record(t, 2, "started", at(2, 0, 0))
+	record(t, 2, "crashed", at(3, 22, 0))
+	s := newTestService()
+	repo := database.NewGatewayAvailabilityRepo()
+
+	require.NoError(t, s.Rollup(at(1, 0, 0)))
+	last, err := repo.Last(2)
+	require.NoError(t, err)
+	assert.True(t, last.Day.Equal(at(2, 0, 0)), "the day the outage started waits for it to end")
+
+	// Its records are about to be pruned: roll it up as it stands.
+	require.NoError(t, s.Rollup(at(3, 23, 0)))
+	last, err = repo.Last(2)
+	require.NoError(t, err)
+	assert.True(t, last.Day.Equal(at(3, 0, 0)))
+	assert.Equal(t, 1, last.Incidents)
+	assert.Equal(t, 0, last.Repaired)
+	assert.EqualValues(t, 14*3600, last.LongestOutageSec)
+	assert.Equal(t, StateDown, last.EndState)
+
+	report, err := s.Report(Query{Since: at(4, 0, 0), Until: testNow})
+	require.NoError(t, err)
+	today := report.Gateways[0].Total
+	assert.EqualValues(t, 12*3600, today.DownSec)
+	assert.Equal(t, 0, today.Incidents, "the outage belongs to the day it started")
+}
+
+func TestSLOErrorBudget(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	seedHistory(t)
+	s := newTestService()
+	gw := uint(1)
+	for _, slo := range []*database.GatewaySLO{
+		{Name: "three nines", GatewayID: &gw, TargetPct: 99.9},
+		{Name: "lenient", TargetPct: 90, WindowDays: 7},
+	} {
+		require.NoError(t, NormalizeSLO(slo))
+		require.NoError(t, database.NewGatewaySLORepo().Create(slo))
+	}
+	assert.Error(t, NormalizeSLO(&database.GatewaySLO{Name: "x", TargetPct: 100}))
+	assert.Error(t, NormalizeSLO(&database.GatewaySLO{Name: "x", TargetPct: 99, WindowDays: 1000}))
+
+	status, err := s.SLOs()
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+
+	strict := status[0]
+	assert.Equal(t, 30, strict.WindowDays)
+	assert.EqualValues(t, 2592, strict.BudgetSec)
+	assert.EqualValues(t, 9000, strict.ConsumedSec)
+	assert.Equal(t, SLOBreached, strict.Status)
+	require.NotNil(t, strict.BurnRate1h)
+	assert.Zero(t, *strict.BurnRate1h)
+
+	lenient := status[1]
+	assert.EqualValues(t, 60480, lenient.BudgetSec)
+	assert.Equal(t, SLOMet, lenient.Status)
+	assert.InDelta(t, 85.1, lenient.RemainingPct, 0.1)
+}
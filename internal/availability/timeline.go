@@ -0,0 +1,193 @@
+package availability
+
+import (
+	"time"
+
+	"ClawDeckX/internal/database"
+)
+
+// Gateway states derived from lifecycle events.
+const (
+	StateUp          = "up"
+	StateDown        = "down"        // crashed or unreachable: an incident
+	StateMaintenance = "maintenance" // cleanly shut down; not counted against availability
+	StateUnknown     = "unknown"     // nothing recorded yet
+)
+
+// stateOf maps a lifecycle event type to the state it starts. Other event
+// types (remediation) return "".
+func stateOf(eventType string) string {
+	switch eventType {
+	case "started", "recovered":
+		return StateUp
+	case "crashed", "unreachable":
+		return StateDown
+	case "shutdown":
+		return StateMaintenance
+	}
+	return ""
+}
+
+// Stats are availability totals over a period. An outage is attributed to
+// the period it started in, including the part of it after the period.
+type Stats struct {
+	UpSec            int64 `json:"up_sec"`
+	DownSec          int64 `json:"down_sec"`
+	MaintenanceSec   int64 `json:"maintenance_sec"`
+	UnknownSec       int64 `json:"unknown_sec"`
+	Incidents        int   `json:"incidents"`
+	Repaired         int   `json:"repaired"`
+	RepairSec        int64 `json:"repair_sec"`
+	LongestOutageSec int64 `json:"longest_outage_sec"`
+}
+
+// Add accumulates o into s.
+func (s *Stats) Add(o Stats) {
+	s.UpSec += o.UpSec
+	s.DownSec += o.DownSec
+	s.MaintenanceSec += o.MaintenanceSec
+	s.UnknownSec += o.UnknownSec
+	s.Incidents += o.Incidents
+	s.Repaired += o.Repaired
+	s.RepairSec += o.RepairSec
+	s.LongestOutageSec = max(s.LongestOutageSec, o.LongestOutageSec)
+}
+
+type segment struct {
+	state      string
+	start, end time.Time
+}
+
+type outage struct {
+	start, end time.Time
+	open       bool // still down at the end of the timeline
+}
+
+// timeline is a gateway's state history over [from, now]. outages holds the
+// outages that started inside it; one already going on at from is part of
+// an earlier period.
+type timeline struct {
+	now      time.Time
+	segments []segment
+	outages  []outage
+}
+
+// buildTimeline replays state-changing events, oldest first, on top of the
+// state the gateway was in at from.
+func buildTimeline(initial string, events []database.GatewayLifecycle, from, now time.Time) *timeline {
+	tl := &timeline{now: now}
+	cur, curStart := initial, from
+	var outStart time.Time
+	inOutage := false
+	for i := range events {
+		ts := events[i].Timestamp.UTC()
+		if ts.Before(from) {
+			ts = from
+		}
+		if ts.After(now) {
+			break
+		}
+		next := stateOf(events[i].EventType)
+		if next == "" || next == cur {
+			continue
+		}
+		tl.segments = append(tl.segments, segment{state: cur, start: curStart, end: ts})
+		if inOutage {
+			tl.outages = append(tl.outages, outage{start: outStart, end: ts})
+			inOutage = false
+		}
+		if next == StateDown {
+			inOutage, outStart = true, ts
+		}
+		cur, curStart = next, ts
+	}
+	tl.segments = append(tl.segments, segment{state: cur, start: curStart, end: now})
+	if inOutage {
+		tl.outages = append(tl.outages, outage{start: outStart, end: now, open: true})
+	}
+	return tl
+}
+
+// stats sums the timeline over [a, b).
+func (tl *timeline) stats(a, b time.Time) Stats {
+	if b.After(tl.now) {
+		b = tl.now
+	}
+	var s Stats
+	for _, seg := range tl.segments {
+		start, end := later(seg.start, a), earlier(seg.end, b)
+		if !end.After(start) {
+			continue
+		}
+		sec := seconds(end.Sub(start))
+		switch seg.state {
+		case StateUp:
+			s.UpSec += sec
+		case StateDown:
+			s.DownSec += sec
+		case StateMaintenance:
+			s.MaintenanceSec += sec
+		default:
+			s.UnknownSec += sec
+		}
+	}
+	for _, o := range tl.outages {
+		if o.start.Before(a) || !o.start.Before(b) {
+			continue
+		}
+		d := seconds(o.end.Sub(o.start))
+		s.Incidents++
+		if !o.open {
+			s.Repaired++
+			s.RepairSec += d
+		}
+		s.LongestOutageSec = max(s.LongestOutageSec, d)
+	}
+	return s
+}
+
+// stateAt returns the state the gateway was in just before t.
+func (tl *timeline) stateAt(t time.Time) string {
+	state := tl.segments[0].state
+	for _, seg := range tl.segments {
+		if !seg.start.Before(t) {
+			break
+		}
+		state = seg.state
+	}
+	return state
+}
+
+// openOutage reports whether an outage that started in [a, b) is still going on.
+func (tl *timeline) openOutage(a, b time.Time) bool {
+	for _, o := range tl.outages {
+		if o.open && !o.start.Before(a) && o.start.Before(b) {
+			return true
+		}
+	}
+	return false
+}
+
+func seconds(d time.Duration) int64 {
+	return int64(d / time.Second)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// dayOf returns the UTC midnight starting t's day.
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
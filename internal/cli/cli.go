@@ -52,6 +52,10 @@ func Run(args []string) int {
 		return commands.ListUsers(args[2:])
 	case "unlock":
 		return commands.Unlock(args[2:])
+	case "reset-2fa":
+		return commands.Reset2FA(args[2:])
+	case "audit":
+		return commands.Audit(args[2:])
 	default:
 		return commands.RunServe(args[1:])
 	}
@@ -81,6 +85,8 @@ func usage() string {
 	fmt.Fprintln(b, i18n.T(i18n.MsgCliCmdResetUsername))
 	fmt.Fprintln(b, i18n.T(i18n.MsgCliCmdListUsers))
 	fmt.Fprintln(b, i18n.T(i18n.MsgCliCmdUnlock))
+	fmt.Fprintln(b, i18n.T(i18n.MsgCliCmdReset2FA))
+	fmt.Fprintln(b, i18n.T(i18n.MsgCliCmdAudit))
 	fmt.Fprintln(b, "")
 	fmt.Fprintln(b, i18n.T(i18n.MsgCliExamples))
 	fmt.Fprintln(b, i18n.T(i18n.MsgCliExampleStart))
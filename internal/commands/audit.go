@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/webconfig"
+)
+
+func Audit(args []string) int {
+	if len(args) < 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "Usage: clawdeckx audit verify [export-file]")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Verify the audit log hash chain and its signed checkpoints.")
+		fmt.Fprintln(os.Stderr, "With a file, verify a chain exported with format=chain instead of the database.")
+		fmt.Fprintln(os.Stderr, "Exits with status 3 when the chain is broken.")
+		return 2
+	}
+
+	// Load config
+	cfg, err := webconfig.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	// Initialize logger
+	logger.Init(cfg.Log)
+
+	var res *database.AuditVerifyResult
+	if len(args) > 1 {
+		f, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open export: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		res, err = database.VerifyChainExport(f, true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to verify export: %v\n", err)
+			return 1
+		}
+	} else {
+		// Initialize database
+		if err := database.Init(cfg.Database, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+			return 1
+		}
+		defer database.Close()
+
+		res, err = database.NewAuditLogRepo().Verify()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to verify audit log: %v\n", err)
+			return 1
+		}
+	}
+
+	if !res.OK {
+		fmt.Printf("Audit chain BROKEN at record %d: %s\n", res.BrokenID, res.Reason)
+		fmt.Printf("%d records verified before the break.\n", res.Checked)
+		return 3
+	}
+	fmt.Printf("Audit chain OK: %d records, %d checkpoints verified.\n", res.Checked, res.Checkpoints)
+	if res.HeadID != 0 {
+		fmt.Printf("Head: record %d, hash %s\n", res.HeadID, res.HeadHash)
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/webconfig"
+)
+
+func Reset2FA(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: clawdeckx reset-2fa <username>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Remove two-factor authentication from a user who lost their authenticator and recovery codes.")
+		fmt.Fprintln(os.Stderr, "The user can log in with their password alone, or is asked to enroll again if policy requires 2FA.")
+		return 2
+	}
+
+	username := args[0]
+
+	// Load config
+	cfg, err := webconfig.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	// Initialize logger
+	logger.Init(cfg.Log)
+
+	// Initialize database
+	if err := database.Init(cfg.Database, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize database: %v\n", err)
+		return 1
+	}
+	defer database.Close()
+
+	// Initialize repositories
+	userRepo := database.NewUserRepo()
+	auditRepo := database.NewAuditLogRepo()
+
+	// Find user
+	user, err := userRepo.FindByUsername(username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "User '%s' not found\n", username)
+		return 1
+	}
+
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		fmt.Printf("User '%s' does not have two-factor authentication enabled.\n", username)
+		return 0
+	}
+
+	if err := userRepo.DisableTOTP(user.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reset two-factor authentication: %v\n", err)
+		return 1
+	}
+
+	// Create audit log
+	auditRepo.Create(&database.AuditLog{
+		UserID:   user.ID,
+		Username: user.Username,
+		Action:   constants.ActionTOTPReset,
+		Result:   "success",
+		Detail:   "2fa reset via CLI",
+		IP:       "127.0.0.1",
+	})
+
+	logger.Log.Info().Str("username", username).Msg("2fa reset successfully")
+
+	fmt.Printf("Two-factor authentication for '%s' has been removed.\n", username)
+	fmt.Println("Recovery codes were invalidated. The user should enroll again after logging in.")
+
+	return 0
+}
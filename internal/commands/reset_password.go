@@ -3,6 +3,7 @@
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/i18n"
@@ -57,6 +58,10 @@ func ResetPassword(args []string) int {
 		fmt.Fprintln(os.Stderr, i18n.T(i18n.MsgResetPasswordUpdateFailed, map[string]interface{}{"Error": err.Error()}))
 		return 1
 	}
+	// A reset password usually means the old one leaked: end every login session.
+	if _, err := database.NewSessionRepo().RevokeByUser(user.ID, "", time.Now().UTC(), "password_reset"); err != nil {
+		logger.Auth.Warn().Err(err).Str("username", username).Msg("failed to revoke sessions")
+	}
 
 	fmt.Println(i18n.T(i18n.MsgResetPasswordSuccess, map[string]interface{}{"Username": username}))
 	return 0
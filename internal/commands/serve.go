@@ -19,8 +19,10 @@ import (
 	"time"
 	"unicode"
 
+	"ClawDeckX/internal/alerting"
 	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/fleet"
 	"ClawDeckX/internal/handlers"
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
@@ -28,6 +30,10 @@ import (
 	"ClawDeckX/internal/notify"
 	"ClawDeckX/internal/openclaw"
 	"ClawDeckX/internal/proclock"
+	"ClawDeckX/internal/remediation"
+	"ClawDeckX/internal/retention"
+	"ClawDeckX/internal/riskpolicy"
+	"ClawDeckX/internal/search"
 	"ClawDeckX/internal/sentinel"
 	"ClawDeckX/internal/tray"
 	"ClawDeckX/internal/version"
@@ -131,6 +137,7 @@ func RunServe(args []string) int {
 	gwHost := cfg.OpenClaw.GatewayHost
 	gwPort := cfg.OpenClaw.GatewayPort
 	gwToken := cfg.OpenClaw.GatewayToken
+	var gwProfileID uint
 	{
 		profileRepo := database.NewGatewayProfileRepo()
 		// Load user language preference before creating default profile
@@ -161,6 +168,7 @@ func RunServe(args []string) int {
 			gwHost = activeProfile.Host
 			gwPort = activeProfile.Port
 			gwToken = activeProfile.Token
+			gwProfileID = activeProfile.ID
 			logger.Log.Info().
 				Str("name", activeProfile.Name).
 				Str("host", activeProfile.Host).
@@ -201,7 +209,7 @@ func RunServe(args []string) int {
 		Token: gwToken,
 	})
 	svc.SetGWClient(gwClient)
-	gwClient.SetRestartCallback(func() error {
+	restartGateway := func() error {
 		if svc.IsRemote() {
 			// Remote mode: only reconnect the WebSocket, never restart the remote gateway
 			// to avoid disrupting other clients due to transient network issues.
@@ -214,7 +222,8 @@ func RunServe(args []string) int {
 			return nil
 		}
 		return svc.Restart()
-	})
+	}
+	gwClient.SetRestartCallback(restartGateway)
 	if svc.IsRemote() {
 		// Remote gateways are subject to network jitter; raise the default
 		// failure threshold so transient connectivity loss does not trigger
@@ -267,6 +276,7 @@ func RunServe(args []string) int {
 
 	lifecycleRecorder := monitor.NewLifecycleRecorder(wsHub)
 	lifecycleRecorder.SetGatewayInfo(svc.GatewayHost, svc.GatewayPort, "", svc.IsRemote())
+	lifecycleRecorder.SetGatewayID(gwProfileID)
 	lifecycleRecorder.SetNotifyCallback(func(msg string) {
 		notifyMgr.Send(msg)
 	})
@@ -282,6 +292,12 @@ func RunServe(args []string) int {
 	lifecycleRecorder.StartCleanupLoop(90*24*time.Hour, 5000, 6*time.Hour)
 	defer lifecycleRecorder.StopCleanupLoop()
 
+	// Archive and prune activities, alerts, audit and connection logs per the
+	// retention settings every 6 hours.
+	retentionMgr := retention.NewManager(filepath.Join(webconfig.DataDir(), retention.DirName))
+	go retentionMgr.Start(6 * time.Hour)
+	defer retentionMgr.Stop()
+
 	gwClient.SetLifecycleCallback(func(event, detail string) {
 		switch event {
 		case "connected":
@@ -302,14 +318,71 @@ func RunServe(args []string) int {
 		}
 	})
 
+	alertMgr := alerting.NewManager(wsHub, notifyMgr)
+	go alertMgr.Start(time.Minute)
+	defer alertMgr.Stop()
+
+	alertEngine := alerting.NewEngine(alertMgr)
+	if err := alertEngine.Reload(); err != nil {
+		logger.Alert.Warn().Err(err).Msg("failed to load alert rules")
+	}
+	remediationActions := remediation.NewGatewayActions(svc, gwClient, restartGateway)
+	remediationEngine := remediation.NewEngine(remediationActions, alertMgr, notifyMgr)
+	remediationEngine.SetGatewayID(gwProfileID)
+	remediationEngine.SetRunCallback(lifecycleRecorder.RecordRemediation)
+	if err := remediationEngine.Reload(); err != nil {
+		logger.Gateway.Warn().Err(err).Msg("failed to load remediation policies")
+	}
+	gwClient.SetHealthFailureCallback(remediationEngine.HandleHealthFailure)
+	go remediationEngine.Start(30 * time.Second)
+	defer remediationEngine.Stop()
+	metricsHandler := handlers.NewMetricsHandler(cfg.Metrics, wsHub)
+	metricsHandler.SetGWClient(gwClient)
+	observeLifecycle := func(ev *database.GatewayLifecycle) {
+		metricsHandler.ObserveLifecycle(ev)
+		alertEngine.ObserveLifecycle(ev)
+		remediationEngine.ObserveLifecycle(ev)
+	}
+	lifecycleRecorder.SetEventCallback(observeLifecycle)
+
+	riskEngine := riskpolicy.NewEngine(filepath.Join(webconfig.DataDir(), riskpolicy.FileName))
+	if err := riskEngine.Load(); err != nil {
+		logger.Monitor.Warn().Err(err).Msg("failed to load risk policy, using the default")
+	}
+	riskEngine.StartRescore()
+
 	gwCollector := monitor.NewGWCollector(gwClient, wsHub, cfg.Monitor.IntervalSeconds)
+	gwCollector.SetGatewayID(gwProfileID)
+	gwCollector.SetRiskEngine(riskEngine)
 	gwCollector.SetLifecycleRecorder(lifecycleRecorder)
+	gwCollector.SetActivityCallback(alertEngine.ObserveActivity)
 	go gwCollector.Start()
 	defer gwCollector.Stop()
 
+	// Fleet mode: keep connections to every other enabled profile.
+	fleetMgr := fleet.NewManager(gwClient, wsHub, cfg.Monitor.IntervalSeconds)
+	fleetMgr.SetActivityCallback(alertEngine.ObserveActivity)
+	fleetMgr.SetRiskEngine(riskEngine)
+	fleetMgr.SetLifecycleCallback(observeLifecycle)
+	fleetMgr.SetNotifyCallback(func(msg string) {
+		notifyMgr.Send(msg)
+	})
+	fleetMgr.SetPrimary(gwProfileID)
+	defer fleetMgr.Stop()
+
+	// Session transcripts are indexed for search only when enabled in settings.
+	transcriptIndexer := search.NewTranscriptIndexer(gwClient)
+	transcriptIndexer.SetGatewayID(gwProfileID)
+	go transcriptIndexer.Start(2 * time.Minute)
+	defer transcriptIndexer.Stop()
+
 	monSvc := monitor.NewService(cfg.OpenClaw.ConfigPath, wsHub, cfg.Monitor.IntervalSeconds)
+	monSvc.SetActivityCallback(alertEngine.ObserveActivity)
+	monSvc.SetRiskEngine(riskEngine)
 
 	authHandler := handlers.NewAuthHandler(&cfg)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, cfg.Auth.OIDC, nil)
+	authHandler.SetOIDC(oidcHandler)
 	gatewayHandler := handlers.NewGatewayHandler(svc, wsHub)
 	gatewayHandler.SetGWClient(gwClient)
 	gatewayHandler.SetLifecycleRecorder(lifecycleRecorder)
@@ -321,6 +394,13 @@ func RunServe(args []string) int {
 	settingsHandler.SetGWClient(gwClient)
 	settingsHandler.SetGWService(svc)
 	alertHandler := handlers.NewAlertHandler()
+	alertHandler.SetManager(alertMgr)
+	alertRuleHandler := handlers.NewAlertRuleHandler(alertEngine)
+	remediationHandler := handlers.NewRemediationHandler(remediationEngine)
+	availabilityHandler := handlers.NewAvailabilityHandler()
+	riskPolicyHandler := handlers.NewRiskPolicyHandler(riskEngine)
+	searchHandler := handlers.NewSearchHandler()
+	retentionHandler := handlers.NewRetentionHandler(retentionMgr)
 	notifyHandler := handlers.NewNotifyHandler(notifyMgr)
 	notifyHandler.SetGWClient(gwClient)
 	auditHandler := handlers.NewAuditHandler()
@@ -328,19 +408,32 @@ func RunServe(args []string) int {
 	snapshotHandler := handlers.NewSnapshotHandler()
 	snapshotHandler.SetGWClient(gwClient)
 	snapshotHandler.SetGatewaySvc(svc)
+	metricsHandler.SetScheduler(snapshotHandler.Scheduler())
+	remediationActions.SetScheduler(snapshotHandler.Scheduler())
 	if identity, err := openclaw.LoadOrCreateDeviceIdentity(""); err == nil {
 		snapshotHandler.Scheduler().SetDeviceID(identity.DeviceID)
 	}
 	schedulerCtx, schedulerCancel := context.WithCancel(context.Background())
 	defer schedulerCancel()
 	go snapshotHandler.Scheduler().Start(schedulerCtx)
+	go snapshotHandler.ChangeWatcher().Start(schedulerCtx)
 	snapshotHandler.Service().StartTokenCleanup(schedulerCtx.Done())
+	snapshotTargetHandler := handlers.NewSnapshotTargetHandler(snapshotHandler.Service())
+	go snapshotTargetHandler.Replicator().Start(schedulerCtx)
+	sessionHandler := handlers.NewSessionHandler(cfg.IdleTimeoutDuration())
+	web.SetSessionFunc(sessionHandler.Validate)
+	web.SetSessionRevokedFunc(wsHub.CloseSessions)
+	sessionHandler.StartCleanup(schedulerCtx.Done())
+	auditHandler.StartCheckpoints(schedulerCtx.Done())
 	doctorHandler := handlers.NewDoctorHandler(svc)
 	doctorHandler.SetGWClient(gwClient)
+	doctorHandler.SetAlertManager(alertMgr)
 	llmHealthHandler := handlers.NewLLMHealthHandler(svc)
 	llmHealthHandler.SetGWClient(gwClient)
 	exportHandler := handlers.NewExportHandler()
 	userHandler := handlers.NewUserHandler()
+	roleHandler := handlers.NewRoleHandler()
+	apiTokenHandler := handlers.NewAPITokenHandler()
 	skillsHandler := handlers.NewSkillsHandler()
 	skillsHandler.SetGWClient(gwClient)
 	skillTransHandler := handlers.NewSkillTranslationHandler()
@@ -353,9 +446,16 @@ func RunServe(args []string) int {
 	gwProfileHandler := handlers.NewGatewayProfileHandler()
 	gwProfileHandler.SetGWClient(gwClient)
 	gwProfileHandler.SetGWService(svc)
-	gwProfileHandler.SetProfileSwitchCallback(func(host string, port int, name string, isRemote bool) {
+	gwProfileHandler.SetProfileSwitchCallback(func(id uint, host string, port int, name string, isRemote bool) {
 		lifecycleRecorder.SetGatewayInfo(host, port, name, isRemote)
+		lifecycleRecorder.SetGatewayID(id)
+		gwCollector.SetGatewayID(id)
+		remediationEngine.SetGatewayID(id)
+		transcriptIndexer.SetGatewayID(id)
+		fleetMgr.SetPrimary(id)
 	})
+	gwProfileHandler.SetProfilesChangedCallback(fleetMgr.Sync)
+	fleetHandler := handlers.NewFleetHandler(fleetMgr)
 	hostInfoHandler := handlers.NewHostInfoHandler()
 	selfUpdateHandler := handlers.NewSelfUpdateHandler()
 	selfUpdateHandler.SetGWClient(gwClient)
@@ -371,11 +471,33 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/auth/needs-setup", authHandler.NeedsSetup)
 	router.POST("/api/v1/auth/setup", authHandler.Setup)
 	router.POST("/api/v1/auth/login", authHandler.Login)
+	router.POST("/api/v1/auth/login/2fa", authHandler.LoginVerify)
+	router.POST("/api/v1/auth/login/2fa/enroll", authHandler.LoginEnroll)
+	router.GET("/api/v1/auth/oidc/config", oidcHandler.Config)
+	router.GET("/api/v1/auth/oidc/login", oidcHandler.Login)
+	router.GET("/api/v1/auth/oidc/callback", oidcHandler.Callback)
 	router.POST("/api/v1/auth/logout", authHandler.Logout)
 
 	router.GET("/api/v1/auth/me", authHandler.Me)
-	router.PUT("/api/v1/auth/password", authHandler.ChangePassword)
-	router.PUT("/api/v1/auth/username", authHandler.ChangeUsername)
+	router.PUT("/api/v1/auth/password", web.RequireSession(authHandler.ChangePassword))
+	router.PUT("/api/v1/auth/username", web.RequireSession(authHandler.ChangeUsername))
+
+	router.GET("/api/v1/auth/2fa", web.RequireSession(authHandler.TwoFactorStatus))
+	router.POST("/api/v1/auth/2fa/enroll", web.RequireSession(authHandler.TwoFactorEnroll))
+	router.POST("/api/v1/auth/2fa/verify", web.RequireSession(authHandler.TwoFactorVerify))
+	router.POST("/api/v1/auth/2fa/disable", web.RequireSession(authHandler.TwoFactorDisable))
+	router.POST("/api/v1/auth/2fa/recovery-codes", web.RequireSession(authHandler.TwoFactorRecoveryCodes))
+	router.GET("/api/v1/auth/2fa/policy", web.RequirePermission(constants.PermUsersManage, authHandler.TwoFactorPolicy))
+	router.PUT("/api/v1/auth/2fa/policy", web.RequirePermission(constants.PermUsersManage, authHandler.UpdateTwoFactorPolicy))
+
+	router.GET("/api/v1/sessions", web.RequireSession(sessionHandler.List))
+	router.GET("/api/v1/sessions/all", web.RequirePermission(constants.PermUsersManage, sessionHandler.ListAll))
+	router.DELETE("/api/v1/sessions", web.RequireSession(sessionHandler.Revoke))
+	router.POST("/api/v1/sessions/revoke-all", web.RequireSession(sessionHandler.RevokeAll))
+
+	router.GET("/api/v1/api-tokens", web.RequireSession(apiTokenHandler.List))
+	router.POST("/api/v1/api-tokens", web.RequireSession(apiTokenHandler.Create))
+	router.DELETE("/api/v1/api-tokens", web.RequireSession(apiTokenHandler.Revoke))
 
 	router.GET("/api/v1/dashboard", dashboardHandler.Get)
 	router.GET("/api/v1/host-info", hostInfoHandler.Get)
@@ -387,26 +509,26 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/self-update/check-channel", selfUpdateHandler.CheckChannel)
 	router.GET("/api/v1/self-update/history", selfUpdateHandler.History)
 	router.POST("/api/v1/self-update/translate-notes", selfUpdateHandler.TranslateNotes)
-	router.POST("/api/v1/self-update/apply", web.RequireAdmin(selfUpdateHandler.Apply))
+	router.POST("/api/v1/self-update/apply", web.RequirePermission(constants.PermSystemManage, selfUpdateHandler.Apply))
 
 	serviceHandler := handlers.NewServiceHandler(database.NewAuditLogRepo())
 	router.GET("/api/v1/service/status", serviceHandler.Status)
-	router.POST("/api/v1/service/openclaw/install", web.RequireAdmin(serviceHandler.InstallOpenClaw))
-	router.POST("/api/v1/service/openclaw/uninstall", web.RequireAdmin(serviceHandler.UninstallOpenClaw))
-	router.POST("/api/v1/service/clawdeckx/install", web.RequireAdmin(serviceHandler.InstallClawDeckX))
-	router.POST("/api/v1/service/clawdeckx/uninstall", web.RequireAdmin(serviceHandler.UninstallClawDeckX))
+	router.POST("/api/v1/service/openclaw/install", web.RequirePermission(constants.PermSystemManage, serviceHandler.InstallOpenClaw))
+	router.POST("/api/v1/service/openclaw/uninstall", web.RequirePermission(constants.PermSystemManage, serviceHandler.UninstallOpenClaw))
+	router.POST("/api/v1/service/clawdeckx/install", web.RequirePermission(constants.PermSystemManage, serviceHandler.InstallClawDeckX))
+	router.POST("/api/v1/service/clawdeckx/uninstall", web.RequirePermission(constants.PermSystemManage, serviceHandler.UninstallClawDeckX))
 
 	router.GET("/api/v1/server-config", serverConfigHandler.Get)
-	router.PUT("/api/v1/server-config", web.RequireAdmin(serverConfigHandler.Update))
+	router.PUT("/api/v1/server-config", web.RequirePermission(constants.PermSystemManage, serverConfigHandler.Update))
 
 	router.GET("/api/v1/gateway/status", gatewayHandler.Status)
-	router.POST("/api/v1/gateway/start", web.RequireAdmin(gatewayHandler.Start))
-	router.POST("/api/v1/gateway/stop", web.RequireAdmin(gatewayHandler.Stop))
-	router.POST("/api/v1/gateway/restart", web.RequireAdmin(gatewayHandler.Restart))
-	router.POST("/api/v1/gateway/kill", web.RequireAdmin(gatewayHandler.Kill))
+	router.POST("/api/v1/gateway/start", web.RequirePermission(constants.PermGatewayControl, gatewayHandler.Start))
+	router.POST("/api/v1/gateway/stop", web.RequirePermission(constants.PermGatewayControl, gatewayHandler.Stop))
+	router.POST("/api/v1/gateway/restart", web.RequirePermission(constants.PermGatewayControl, gatewayHandler.Restart))
+	router.POST("/api/v1/gateway/kill", web.RequirePermission(constants.PermGatewayControl, gatewayHandler.Kill))
 	router.GET("/api/v1/gateway/daemon/status", gatewayHandler.DaemonStatus)
-	router.POST("/api/v1/gateway/daemon/install", web.RequireAdmin(gatewayHandler.DaemonInstall))
-	router.POST("/api/v1/gateway/daemon/uninstall", web.RequireAdmin(gatewayHandler.DaemonUninstall))
+	router.POST("/api/v1/gateway/daemon/install", web.RequirePermission(constants.PermSystemManage, gatewayHandler.DaemonInstall))
+	router.POST("/api/v1/gateway/daemon/uninstall", web.RequirePermission(constants.PermSystemManage, gatewayHandler.DaemonUninstall))
 	router.GET("/api/v1/gateway/last-restart", gatewayHandler.LastRestart)
 
 	router.GET("/api/v1/activities", activityHandler.List)
@@ -416,64 +538,142 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/monitor/stats", monitorHandler.Stats)
 
 	router.GET("/api/v1/settings", settingsHandler.GetAll)
-	router.PUT("/api/v1/settings", web.RequireAdmin(settingsHandler.Update))
+	router.PUT("/api/v1/settings", web.RequirePermission(constants.PermConfigWrite, settingsHandler.Update))
 	router.GET("/api/v1/settings/language", settingsHandler.GetLanguage)
 	router.PUT("/api/v1/settings/language", settingsHandler.SetLanguage)
 	router.GET("/api/v1/settings/gateway", settingsHandler.GetGatewayConfig)
-	router.PUT("/api/v1/settings/gateway", web.RequireAdmin(settingsHandler.UpdateGatewayConfig))
+	router.PUT("/api/v1/settings/gateway", web.RequirePermission(constants.PermConfigWrite, settingsHandler.UpdateGatewayConfig))
 
 	router.GET("/api/v1/alerts", alertHandler.List)
-	router.POST("/api/v1/alerts/read-all", alertHandler.MarkAllNotified)
-	router.POST("/api/v1/alerts/", alertHandler.MarkNotified)
+	router.POST("/api/v1/alerts/read-all", web.RequirePermission(constants.PermAlertsManage, alertHandler.MarkAllNotified))
+	router.POST("/api/v1/alerts/", web.RequirePermission(constants.PermAlertsManage, alertHandler.MarkNotified))
+	router.GET("/api/v1/alerts/summary", alertHandler.Summary)
+	router.POST("/api/v1/alerts/ack", web.RequirePermission(constants.PermAlertsManage, alertHandler.Acknowledge))
+	router.POST("/api/v1/alerts/silence", web.RequirePermission(constants.PermAlertsManage, alertHandler.Silence))
+	router.POST("/api/v1/alerts/resolve", web.RequirePermission(constants.PermAlertsManage, alertHandler.Resolve))
+
+	router.GET("/api/v1/alert-rules", alertRuleHandler.List)
+	router.POST("/api/v1/alert-rules", web.RequirePermission(constants.PermAlertsManage, alertRuleHandler.Create))
+	router.PUT("/api/v1/alert-rules", web.RequirePermission(constants.PermAlertsManage, alertRuleHandler.Update))
+	router.DELETE("/api/v1/alert-rules", web.RequirePermission(constants.PermAlertsManage, alertRuleHandler.Delete))
+	router.POST("/api/v1/alert-rules/dry-run", web.RequirePermission(constants.PermAlertsManage, alertRuleHandler.DryRun))
+
+	// Gateway remediation policies
+	router.GET("/api/v1/remediation/policies", remediationHandler.List)
+	router.POST("/api/v1/remediation/policies", web.RequirePermission(constants.PermGatewayControl, remediationHandler.Create))
+	router.PUT("/api/v1/remediation/policies", web.RequirePermission(constants.PermGatewayControl, remediationHandler.Update))
+	router.DELETE("/api/v1/remediation/policies", web.RequirePermission(constants.PermGatewayControl, remediationHandler.Delete))
+	router.POST("/api/v1/remediation/policies/run", web.RequirePermission(constants.PermGatewayControl, remediationHandler.RunNow))
+	router.GET("/api/v1/remediation/runs", remediationHandler.Runs)
+
+	// Activity risk policy
+	router.GET("/api/v1/risk-policy", riskPolicyHandler.Get)
+	router.PUT("/api/v1/risk-policy", web.RequirePermission(constants.PermAlertsManage, riskPolicyHandler.Update))
+	router.POST("/api/v1/risk-policy/reload", web.RequirePermission(constants.PermAlertsManage, riskPolicyHandler.Reload))
+	router.POST("/api/v1/risk-policy/test", riskPolicyHandler.Test)
+	router.GET("/api/v1/risk-policy/rescore", riskPolicyHandler.RescoreStatus)
+	router.POST("/api/v1/risk-policy/rescore", web.RequirePermission(constants.PermAlertsManage, riskPolicyHandler.Rescore))
+
+	// Full-text search
+	router.GET("/api/v1/search", searchHandler.Search)
+
+	// Data retention, cold archive and compaction
+	router.GET("/api/v1/retention", retentionHandler.Get)
+	router.PUT("/api/v1/retention", web.RequirePermission(constants.PermSystemManage, retentionHandler.Update))
+	router.GET("/api/v1/retention/status", retentionHandler.Status)
+	router.POST("/api/v1/retention/prune", web.RequirePermission(constants.PermSystemManage, retentionHandler.Prune))
+	router.GET("/api/v1/retention/size", retentionHandler.Size)
+	router.POST("/api/v1/retention/compact", web.RequirePermission(constants.PermSystemManage, retentionHandler.Compact))
+	router.GET("/api/v1/retention/archives", retentionHandler.Archives)
+	router.GET("/api/v1/retention/archives/rows", retentionHandler.ArchiveRows)
+	router.GET("/api/v1/retention/archives/download", retentionHandler.DownloadArchive)
+	router.POST("/api/v1/retention/archives/import", web.RequirePermission(constants.PermSystemManage, retentionHandler.ImportArchive))
 
 	router.GET("/api/v1/notify/config", notifyHandler.GetConfig)
-	router.PUT("/api/v1/notify/config", web.RequireAdmin(notifyHandler.UpdateConfig))
-	router.POST("/api/v1/notify/test", web.RequireAdmin(notifyHandler.TestSend))
+	router.PUT("/api/v1/notify/config", web.RequirePermission(constants.PermAlertsManage, notifyHandler.UpdateConfig))
+	router.POST("/api/v1/notify/test", web.RequirePermission(constants.PermAlertsManage, notifyHandler.TestSend))
 
 	router.GET("/api/v1/audit-logs", auditHandler.List)
+	router.GET("/api/v1/audit-logs/verify", auditHandler.Verify)
+	router.GET("/api/v1/audit-logs/checkpoints", auditHandler.Checkpoints)
+	router.POST("/api/v1/audit-logs/checkpoints", web.RequirePermission(constants.PermSystemManage, auditHandler.CreateCheckpoint))
 
 	router.GET("/api/v1/config", configHandler.Get)
-	router.PUT("/api/v1/config", web.RequireAdmin(configHandler.Update))
-	router.POST("/api/v1/config/validate", web.RequireAdmin(configHandler.Validate))
-	router.POST("/api/v1/config/generate-default", web.RequireAdmin(configHandler.GenerateDefault))
-	router.POST("/api/v1/config/set-key", web.RequireAdmin(configHandler.SetKey))
-	router.POST("/api/v1/config/unset-key", web.RequireAdmin(configHandler.UnsetKey))
+	router.PUT("/api/v1/config", web.RequirePermission(constants.PermConfigWrite, configHandler.Update))
+	router.POST("/api/v1/config/validate", web.RequirePermission(constants.PermConfigWrite, configHandler.Validate))
+	router.POST("/api/v1/config/generate-default", web.RequirePermission(constants.PermConfigWrite, configHandler.GenerateDefault))
+	router.POST("/api/v1/config/set-key", web.RequirePermission(constants.PermConfigWrite, configHandler.SetKey))
+	router.POST("/api/v1/config/unset-key", web.RequirePermission(constants.PermConfigWrite, configHandler.UnsetKey))
 	router.GET("/api/v1/config/get-key", configHandler.GetKey)
 
 	router.GET("/api/v1/snapshots", snapshotHandler.List)
 	router.GET("/api/v1/snapshots/stats", snapshotHandler.Stats)
-	router.POST("/api/v1/snapshots", web.RequireAdmin(snapshotHandler.Create))
-	router.POST("/api/v1/snapshots/import", web.RequireAdmin(snapshotHandler.Import))
-	router.POST("/api/v1/snapshots/import-openclaw", web.RequireAdmin(snapshotHandler.ImportOpenClaw))
-	router.POST("/api/v1/snapshots/batch-delete", web.RequireAdmin(snapshotHandler.BatchDelete))
-	router.POST("/api/v1/snapshots/prune", web.RequireAdmin(snapshotHandler.PruneKeepN))
+	router.POST("/api/v1/snapshots", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.Create))
+	router.POST("/api/v1/snapshots/import", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.Import))
+	router.POST("/api/v1/snapshots/import-openclaw", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.ImportOpenClaw))
+	router.POST("/api/v1/snapshots/batch-delete", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.BatchDelete))
+	router.POST("/api/v1/snapshots/prune", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.PruneKeepN))
+	router.POST("/api/v1/snapshots/migrate", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.Migrate))
+	router.POST("/api/v1/snapshots/diff", web.RequirePermission(constants.PermSnapshotsRestore, snapshotHandler.Diff))
+	router.GET("/api/v1/snapshots/timeline", snapshotHandler.Timeline)
 	router.GET("/api/v1/snapshots/schedule", snapshotHandler.GetSchedule)
-	router.PUT("/api/v1/snapshots/schedule", web.RequireAdmin(snapshotHandler.UpdateSchedule))
+	router.PUT("/api/v1/snapshots/schedule", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.UpdateSchedule))
 	router.GET("/api/v1/snapshots/schedule/status", snapshotHandler.GetScheduleStatus)
-	router.POST("/api/v1/snapshots/schedule/run-now", web.RequireAdmin(snapshotHandler.ScheduleRunNow))
-	router.POST("/api/v1/snapshots/", web.RequireAdmin(snapshotHandler.Action))
-	router.DELETE("/api/v1/snapshots/", web.RequireAdmin(snapshotHandler.Delete))
+	router.POST("/api/v1/snapshots/schedule/run-now", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.ScheduleRunNow))
+	router.GET("/api/v1/snapshots/trees", snapshotHandler.GetTreeConfig)
+	router.PUT("/api/v1/snapshots/trees", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.UpdateTreeConfig))
+	router.GET("/api/v1/snapshots/trees/preview", snapshotHandler.PreviewTrees)
+	router.GET("/api/v1/snapshots/keys", snapshotHandler.GetKeyStatus)
+	// Key slots open every snapshot sealed after them, so they need system.manage like targets.
+	router.PUT("/api/v1/snapshots/keys", web.RequirePermission(constants.PermSystemManage, snapshotHandler.UpdateKeyConfig))
+	router.POST("/api/v1/snapshots/keys/recovery", web.RequirePermission(constants.PermSystemManage, snapshotHandler.GenerateRecoveryKey))
+	router.DELETE("/api/v1/snapshots/keys/recovery", web.RequirePermission(constants.PermSystemManage, snapshotHandler.RemoveRecoveryKey))
+	router.POST("/api/v1/snapshots/keys/rewrap", web.RequirePermission(constants.PermSystemManage, snapshotHandler.Rewrap))
+	router.GET("/api/v1/snapshots/auto", snapshotHandler.GetAutoSnapshot)
+	router.PUT("/api/v1/snapshots/auto", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.UpdateAutoSnapshot))
+	router.GET("/api/v1/snapshots/auto/status", snapshotHandler.GetAutoSnapshotStatus)
+	router.GET("/api/v1/snapshots/schedules", snapshotHandler.ListSchedules)
+	router.POST("/api/v1/snapshots/schedules", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.CreateSchedule))
+	router.PUT("/api/v1/snapshots/schedules", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.ReplaceSchedule))
+	router.DELETE("/api/v1/snapshots/schedules", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.DeleteSchedule))
+	router.GET("/api/v1/snapshots/targets", snapshotTargetHandler.List)
+	router.POST("/api/v1/snapshots/targets", web.RequirePermission(constants.PermSystemManage, snapshotTargetHandler.Create))
+	router.PUT("/api/v1/snapshots/targets", web.RequirePermission(constants.PermSystemManage, snapshotTargetHandler.Update))
+	router.DELETE("/api/v1/snapshots/targets", web.RequirePermission(constants.PermSystemManage, snapshotTargetHandler.Delete))
+	router.POST("/api/v1/snapshots/targets/test", web.RequirePermission(constants.PermSystemManage, snapshotTargetHandler.Test))
+	router.GET("/api/v1/snapshots/targets/remote", snapshotTargetHandler.Remote)
+	router.POST("/api/v1/snapshots/targets/import", web.RequirePermission(constants.PermSnapshotsWrite, snapshotTargetHandler.Import))
+	router.POST("/api/v1/snapshots/targets/upload", web.RequirePermission(constants.PermSnapshotsWrite, snapshotTargetHandler.Upload))
+	router.POST("/api/v1/snapshots/", web.RequirePermission(constants.PermSnapshotsRestore, snapshotHandler.Action))
+	router.DELETE("/api/v1/snapshots/", web.RequirePermission(constants.PermSnapshotsWrite, snapshotHandler.Delete))
 
 	router.GET("/api/v1/doctor", doctorHandler.Run)
 	router.GET("/api/v1/doctor/summary", doctorHandler.Summary)
 	router.GET("/api/v1/doctor/overview", doctorHandler.Overview)
-	router.POST("/api/v1/doctor/fix", web.RequireAdmin(doctorHandler.Fix))
+	router.POST("/api/v1/doctor/fix", web.RequirePermission(constants.PermConfigWrite, doctorHandler.Fix))
 
-	router.POST("/api/v1/recipe/apply-step", web.RequireAdmin(recipeHandler.ApplyStep))
+	router.POST("/api/v1/recipe/apply-step", web.RequirePermission(constants.PermConfigWrite, recipeHandler.ApplyStep))
 
 	router.GET("/api/v1/maintenance/context/analyze", maintenanceHandler.ContextAnalyze)
-	router.POST("/api/v1/maintenance/context/optimize", web.RequireAdmin(maintenanceHandler.ContextOptimize))
-	router.POST("/api/v1/maintenance/context/optimize-all", web.RequireAdmin(maintenanceHandler.ContextOptimizeAll))
+	router.POST("/api/v1/maintenance/context/optimize", web.RequirePermission(constants.PermConfigWrite, maintenanceHandler.ContextOptimize))
+	router.POST("/api/v1/maintenance/context/optimize-all", web.RequirePermission(constants.PermConfigWrite, maintenanceHandler.ContextOptimizeAll))
 
 	router.GET("/api/v1/llm/models-status", llmHealthHandler.ModelsStatus)
 	router.GET("/api/v1/llm/auth-health", llmHealthHandler.AuthHealth)
 	router.POST("/api/v1/llm/probe", llmHealthHandler.Probe)
-	router.POST("/api/v1/llm/exec", web.RequireAdmin(llmHealthHandler.Exec))
+	router.POST("/api/v1/llm/exec", web.RequirePermission(constants.PermSystemManage, llmHealthHandler.Exec))
 	router.GET("/api/v1/llm/exec-capability", llmHealthHandler.ExecCapability)
 
 	router.GET("/api/v1/users", userHandler.List)
-	router.POST("/api/v1/users", web.RequireAdmin(userHandler.Create))
-	router.DELETE("/api/v1/users/", web.RequireAdmin(userHandler.Delete))
+	router.POST("/api/v1/users", web.RequirePermission(constants.PermUsersManage, userHandler.Create))
+	router.PUT("/api/v1/users/", web.RequirePermission(constants.PermUsersManage, userHandler.UpdateRole))
+	router.DELETE("/api/v1/users/", web.RequirePermission(constants.PermUsersManage, userHandler.Delete))
+
+	router.GET("/api/v1/roles", roleHandler.List)
+	router.GET("/api/v1/roles/permissions", roleHandler.Permissions)
+	router.POST("/api/v1/roles", web.RequirePermission(constants.PermUsersManage, roleHandler.Create))
+	router.PUT("/api/v1/roles", web.RequirePermission(constants.PermUsersManage, roleHandler.Update))
+	router.DELETE("/api/v1/roles", web.RequirePermission(constants.PermUsersManage, roleHandler.Delete))
 
 	router.GET("/api/v1/skills", skillsHandler.List)
 	router.GET("/api/v1/skills/translations", skillTransHandler.Get)
@@ -481,25 +681,25 @@ func RunServe(args []string) int {
 
 	router.GET("/api/v1/setup/scan", setupWizardHandler.Scan)
 	router.GET("/api/v1/setup/status", setupWizardHandler.Status)
-	router.POST("/api/v1/setup/install-deps", web.RequireAdmin(setupWizardHandler.InstallDeps))
-	router.POST("/api/v1/setup/install-openclaw", web.RequireAdmin(setupWizardHandler.InstallOpenClaw))
-	router.POST("/api/v1/setup/configure", web.RequireAdmin(setupWizardHandler.Configure))
-	router.POST("/api/v1/setup/start-gateway", web.RequireAdmin(setupWizardHandler.StartGateway))
-	router.POST("/api/v1/setup/verify", web.RequireAdmin(setupWizardHandler.Verify))
-	router.POST("/api/v1/setup/auto-install", web.RequireAdmin(setupWizardHandler.AutoInstall))
-	router.POST("/api/v1/setup/uninstall", web.RequireAdmin(setupWizardHandler.Uninstall))
-	router.POST("/api/v1/setup/update-openclaw", web.RequireAdmin(setupWizardHandler.UpdateOpenClaw))
+	router.POST("/api/v1/setup/install-deps", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.InstallDeps))
+	router.POST("/api/v1/setup/install-openclaw", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.InstallOpenClaw))
+	router.POST("/api/v1/setup/configure", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.Configure))
+	router.POST("/api/v1/setup/start-gateway", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.StartGateway))
+	router.POST("/api/v1/setup/verify", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.Verify))
+	router.POST("/api/v1/setup/auto-install", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.AutoInstall))
+	router.POST("/api/v1/setup/uninstall", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.Uninstall))
+	router.POST("/api/v1/setup/update-openclaw", web.RequirePermission(constants.PermSystemManage, setupWizardHandler.UpdateOpenClaw))
 
 	wizardHandler := handlers.NewWizardHandler()
 	wizardHandler.SetGWClient(gwClient)
 	router.POST("/api/v1/setup/test-model", wizardHandler.TestModel)
 	router.POST("/api/v1/setup/discover-models", wizardHandler.DiscoverModels)
 	router.POST("/api/v1/setup/test-channel", wizardHandler.TestChannel)
-	router.POST("/api/v1/config/model-wizard", web.RequireAdmin(wizardHandler.SaveModel))
-	router.POST("/api/v1/config/channel-wizard", web.RequireAdmin(wizardHandler.SaveChannel))
+	router.POST("/api/v1/config/model-wizard", web.RequirePermission(constants.PermConfigWrite, wizardHandler.SaveModel))
+	router.POST("/api/v1/config/channel-wizard", web.RequirePermission(constants.PermConfigWrite, wizardHandler.SaveChannel))
 
 	router.GET("/api/v1/pairing/list", wizardHandler.ListPairingRequests)
-	router.POST("/api/v1/pairing/approve", web.RequireAdmin(wizardHandler.ApprovePairingRequest))
+	router.POST("/api/v1/pairing/approve", web.RequirePermission(constants.PermConfigWrite, wizardHandler.ApprovePairingRequest))
 
 	networkHandler := handlers.NewNetworkHandler()
 	router.GET("/api/v1/network/test-mirror", networkHandler.TestMirror)
@@ -507,37 +707,47 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/network/test-all", networkHandler.TestAllMirrors)
 
 	router.GET("/api/v1/monitor/config", monConfigHandler.GetConfig)
-	router.PUT("/api/v1/monitor/config", web.RequireAdmin(monConfigHandler.UpdateConfig))
-	router.POST("/api/v1/monitor/start", web.RequireAdmin(monConfigHandler.StartMonitor))
-	router.POST("/api/v1/monitor/stop", web.RequireAdmin(monConfigHandler.StopMonitor))
+	router.PUT("/api/v1/monitor/config", web.RequirePermission(constants.PermConfigWrite, monConfigHandler.UpdateConfig))
+	router.POST("/api/v1/monitor/start", web.RequirePermission(constants.PermGatewayControl, monConfigHandler.StartMonitor))
+	router.POST("/api/v1/monitor/stop", web.RequirePermission(constants.PermGatewayControl, monConfigHandler.StopMonitor))
 
 	router.GET("/api/v1/gateway/log", gwLogHandler.GetLog)
 
 	router.GET("/api/v1/gateway/health-check", gatewayHandler.GetHealthCheck)
-	router.PUT("/api/v1/gateway/health-check", web.RequireAdmin(gatewayHandler.SetHealthCheck))
+	router.PUT("/api/v1/gateway/health-check", web.RequirePermission(constants.PermConfigWrite, gatewayHandler.SetHealthCheck))
 
 	router.GET("/api/v1/gateway/lifecycle", gatewayHandler.Lifecycle)
 	router.GET("/api/v1/gateway/lifecycle/notify-config", gatewayHandler.GetLifecycleNotifyConfig)
-	router.PUT("/api/v1/gateway/lifecycle/notify-config", web.RequireAdmin(gatewayHandler.SetLifecycleNotifyConfig))
+	router.PUT("/api/v1/gateway/lifecycle/notify-config", web.RequirePermission(constants.PermConfigWrite, gatewayHandler.SetLifecycleNotifyConfig))
+
+	// Gateway availability and SLOs
+	router.GET("/api/v1/availability/report", availabilityHandler.Report)
+	router.GET("/api/v1/availability/export", availabilityHandler.Export)
+	router.GET("/api/v1/availability/slos", availabilityHandler.ListSLOs)
+	router.POST("/api/v1/availability/slos", web.RequirePermission(constants.PermAlertsManage, availabilityHandler.CreateSLO))
+	router.PUT("/api/v1/availability/slos", web.RequirePermission(constants.PermAlertsManage, availabilityHandler.UpdateSLO))
+	router.DELETE("/api/v1/availability/slos", web.RequirePermission(constants.PermAlertsManage, availabilityHandler.DeleteSLO))
 
 	router.POST("/api/v1/gateway/diagnose", gwDiagnoseHandler.Diagnose)
 
 	router.GET("/api/v1/gateway/profiles", gwProfileHandler.List)
-	router.POST("/api/v1/gateway/profiles", web.RequireAdmin(gwProfileHandler.Create))
-	router.PUT("/api/v1/gateway/profiles", web.RequireAdmin(gwProfileHandler.Update))
-	router.DELETE("/api/v1/gateway/profiles", web.RequireAdmin(gwProfileHandler.Delete))
-	router.POST("/api/v1/gateway/profiles/activate", web.RequireAdmin(gwProfileHandler.Activate))
+	router.POST("/api/v1/gateway/profiles", web.RequirePermission(constants.PermConfigWrite, gwProfileHandler.Create))
+	router.PUT("/api/v1/gateway/profiles", web.RequirePermission(constants.PermConfigWrite, gwProfileHandler.Update))
+	router.DELETE("/api/v1/gateway/profiles", web.RequirePermission(constants.PermConfigWrite, gwProfileHandler.Delete))
+	router.POST("/api/v1/gateway/profiles/activate", web.RequirePermission(constants.PermGatewayControl, gwProfileHandler.Activate))
 	router.POST("/api/v1/gateway/profiles/test", gwProfileHandler.TestConnection)
 
 	gwProxy := handlers.NewGWProxyHandler(gwClient)
+	gwProxy.SetFleet(fleetMgr)
+	router.GET("/api/v1/fleet", fleetHandler.Overview)
 	router.GET("/api/v1/gw/status", gwProxy.Status)
-	router.POST("/api/v1/gw/reconnect", web.RequireAdmin(gwProxy.Reconnect))
+	router.POST("/api/v1/gw/reconnect", web.RequirePermission(constants.PermGatewayControl, gwProxy.Reconnect))
 	router.GET("/api/v1/gw/health", gwProxy.Health)
 	router.GET("/api/v1/gw/info", gwProxy.GWStatus)
 	router.GET("/api/v1/gw/sessions", gwProxy.SessionsList)
 	router.POST("/api/v1/gw/sessions/preview", gwProxy.SessionsPreview)
-	router.POST("/api/v1/gw/sessions/reset", web.RequireAdmin(gwProxy.SessionsReset))
-	router.POST("/api/v1/gw/sessions/delete", web.RequireAdmin(gwProxy.SessionsDelete))
+	router.POST("/api/v1/gw/sessions/reset", web.RequirePermission(constants.PermGatewayControl, gwProxy.SessionsReset))
+	router.POST("/api/v1/gw/sessions/delete", web.RequirePermission(constants.PermGatewayControl, gwProxy.SessionsDelete))
 	router.GET("/api/v1/gw/models", gwProxy.ModelsList)
 	router.GET("/api/v1/gw/usage/status", gwProxy.UsageStatus)
 	router.GET("/api/v1/gw/usage/cost", gwProxy.UsageCost)
@@ -550,15 +760,15 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/gw/channels", gwProxy.ChannelsStatus)
 	router.GET("/api/v1/gw/logs/tail", gwProxy.LogsTail)
 	router.GET("/api/v1/gw/config/remote", gwProxy.ConfigGetRemote)
-	router.PUT("/api/v1/gw/config/remote", web.RequireAdmin(gwProxy.ConfigSetRemote))
-	router.POST("/api/v1/gw/config/reload", web.RequireAdmin(gwProxy.ConfigReload))
+	router.PUT("/api/v1/gw/config/remote", web.RequirePermission(constants.PermConfigWrite, gwProxy.ConfigSetRemote))
+	router.POST("/api/v1/gw/config/reload", web.RequirePermission(constants.PermConfigWrite, gwProxy.ConfigReload))
 	router.GET("/api/v1/gw/sessions/messages", gwProxy.SessionsPreviewMessages)
 	router.GET("/api/v1/gw/sessions/history", gwProxy.SessionsHistory)
-	router.POST("/api/v1/gw/proxy", web.RequireAdmin(gwProxy.GenericProxy))
-	router.POST("/api/v1/gw/skills/install-stream", web.RequireAdmin(gwProxy.DepInstallStreamSSE))
-	router.POST("/api/v1/gw/skills/install-async", web.RequireAdmin(gwProxy.DepInstallAsync))
+	router.POST("/api/v1/gw/proxy", web.RequirePermission(constants.PermConfigWrite, gwProxy.GenericProxy))
+	router.POST("/api/v1/gw/skills/install-stream", web.RequirePermission(constants.PermPluginsInstall, gwProxy.DepInstallStreamSSE))
+	router.POST("/api/v1/gw/skills/install-async", web.RequirePermission(constants.PermPluginsInstall, gwProxy.DepInstallAsync))
 	router.GET("/api/v1/gw/skills/config", gwProxy.SkillsConfigGet)
-	router.POST("/api/v1/gw/skills/configure", web.RequireAdmin(gwProxy.SkillsConfigure))
+	router.POST("/api/v1/gw/skills/configure", web.RequirePermission(constants.PermConfigWrite, gwProxy.SkillsConfigure))
 
 	templateHandler := handlers.NewTemplateHandler()
 	// Seed built-in templates on startup
@@ -567,18 +777,18 @@ func RunServe(args []string) int {
 	}
 	router.GET("/api/v1/templates", templateHandler.List)
 	router.GET("/api/v1/templates/", templateHandler.Get)
-	router.POST("/api/v1/templates", web.RequireAdmin(templateHandler.Create))
-	router.PUT("/api/v1/templates", web.RequireAdmin(templateHandler.Update))
-	router.DELETE("/api/v1/templates/", web.RequireAdmin(templateHandler.Delete))
+	router.POST("/api/v1/templates", web.RequirePermission(constants.PermConfigWrite, templateHandler.Create))
+	router.PUT("/api/v1/templates", web.RequirePermission(constants.PermConfigWrite, templateHandler.Update))
+	router.DELETE("/api/v1/templates/", web.RequirePermission(constants.PermConfigWrite, templateHandler.Delete))
 
 	clawHubHandler := handlers.NewClawHubHandler(gwClient)
 	router.GET("/api/v1/clawhub/list", clawHubHandler.List)
 	router.GET("/api/v1/clawhub/search", clawHubHandler.Search)
 	router.GET("/api/v1/clawhub/skill", clawHubHandler.SkillDetail)
-	router.POST("/api/v1/clawhub/install", web.RequireAdmin(clawHubHandler.Install))
-	router.POST("/api/v1/clawhub/install-stream", web.RequireAdmin(clawHubHandler.InstallStreamSSE))
-	router.POST("/api/v1/clawhub/uninstall", web.RequireAdmin(clawHubHandler.Uninstall))
-	router.POST("/api/v1/clawhub/update", web.RequireAdmin(clawHubHandler.Update))
+	router.POST("/api/v1/clawhub/install", web.RequirePermission(constants.PermPluginsInstall, clawHubHandler.Install))
+	router.POST("/api/v1/clawhub/install-stream", web.RequirePermission(constants.PermPluginsInstall, clawHubHandler.InstallStreamSSE))
+	router.POST("/api/v1/clawhub/uninstall", web.RequirePermission(constants.PermPluginsInstall, clawHubHandler.Uninstall))
+	router.POST("/api/v1/clawhub/update", web.RequirePermission(constants.PermPluginsInstall, clawHubHandler.Update))
 	router.GET("/api/v1/clawhub/installed", clawHubHandler.InstalledList)
 
 	pluginInstallHandler := handlers.NewPluginInstallHandler(gwClient)
@@ -586,31 +796,31 @@ func RunServe(args []string) int {
 	router.GET("/api/v1/plugins/status", pluginInstallHandler.Status)
 	router.GET("/api/v1/plugins/can-install", pluginInstallHandler.CanInstall)
 	router.GET("/api/v1/plugins/check", pluginInstallHandler.CheckInstalled)
-	router.POST("/api/v1/plugins/install", web.RequireAdmin(pluginInstallHandler.Install))
-	router.POST("/api/v1/plugins/uninstall", web.RequireAdmin(pluginInstallHandler.Uninstall))
-	router.POST("/api/v1/plugins/update", web.RequireAdmin(pluginInstallHandler.Update))
+	router.POST("/api/v1/plugins/install", web.RequirePermission(constants.PermPluginsInstall, pluginInstallHandler.Install))
+	router.POST("/api/v1/plugins/uninstall", web.RequirePermission(constants.PermPluginsInstall, pluginInstallHandler.Uninstall))
+	router.POST("/api/v1/plugins/update", web.RequirePermission(constants.PermPluginsInstall, pluginInstallHandler.Update))
 
 	skillHubHandler := handlers.NewSkillHubHandler(webconfig.DataDir(), cfg.SkillHub.DataURL)
 	skillHubHandler.SetGatewayClient(gwClient)
 	skillHubHandler.WarmCache()
 	router.GET("/api/v1/skillhub/cli-status", skillHubHandler.CLIStatus)
-	router.POST("/api/v1/skillhub/install", web.RequireAdmin(skillHubHandler.Install))
-	router.POST("/api/v1/skillhub/install-skill", web.RequireAdmin(skillHubHandler.InstallSkill))
+	router.POST("/api/v1/skillhub/install", web.RequirePermission(constants.PermPluginsInstall, skillHubHandler.Install))
+	router.POST("/api/v1/skillhub/install-skill", web.RequirePermission(constants.PermPluginsInstall, skillHubHandler.InstallSkill))
 	router.GET("/api/v1/skillhub/data", skillHubHandler.ProxyData)
 	router.GET("/api/v1/skillhub/skills", skillHubHandler.ListSkills)
 	router.GET("/api/v1/skillhub/search", skillHubHandler.SearchSkills)
 	router.GET("/api/v1/skillhub/installed", skillHubHandler.GetInstalledSkills)
 
 	multiAgentHandler := handlers.NewMultiAgentHandler(gwClient)
-	router.POST("/api/v1/multi-agent/deploy", web.RequireAdmin(multiAgentHandler.Deploy))
-	router.POST("/api/v1/multi-agent/preview", web.RequireAdmin(multiAgentHandler.Preview))
+	router.POST("/api/v1/multi-agent/deploy", web.RequirePermission(constants.PermConfigWrite, multiAgentHandler.Deploy))
+	router.POST("/api/v1/multi-agent/preview", web.RequirePermission(constants.PermConfigWrite, multiAgentHandler.Preview))
 	router.GET("/api/v1/multi-agent/status", multiAgentHandler.Status)
-	router.POST("/api/v1/multi-agent/delete", web.RequireAdmin(multiAgentHandler.Delete))
+	router.POST("/api/v1/multi-agent/delete", web.RequirePermission(constants.PermConfigWrite, multiAgentHandler.Delete))
 
 	workflowHandler := handlers.NewWorkflowHandler(gwClient)
-	router.POST("/api/v1/workflow/start", web.RequireAdmin(workflowHandler.Start))
+	router.POST("/api/v1/workflow/start", web.RequirePermission(constants.PermGatewayControl, workflowHandler.Start))
 	router.GET("/api/v1/workflow/status", workflowHandler.Status)
-	router.POST("/api/v1/workflow/stop", web.RequireAdmin(workflowHandler.Stop))
+	router.POST("/api/v1/workflow/stop", web.RequirePermission(constants.PermGatewayControl, workflowHandler.Stop))
 
 	router.GET("/api/v1/export/activities", exportHandler.ExportActivities)
 	router.GET("/api/v1/export/alerts", exportHandler.ExportAlerts)
@@ -620,6 +830,9 @@ func RunServe(args []string) int {
 
 	// WebSocket
 	router.GET("/api/v1/ws", wsHub.HandleWS(cfg.Auth.JWTSecret))
+	router.GET("/api/v1/ws/clients", web.RequirePermission(constants.PermSystemManage, wsHub.HandleStats))
+	// Server-sent events with the same messages, for clients without WebSockets
+	router.GET("/api/v1/events/stream", wsHub.HandleSSE)
 
 	router.GET("/api/v1/health", func(w http.ResponseWriter, r *http.Request) {
 		web.OK(w, r, map[string]interface{}{
@@ -628,6 +841,9 @@ func RunServe(args []string) int {
 		})
 	})
 
+	// Prometheus exporter (loopback or bearer-token protected, see webconfig.MetricsConfig)
+	router.GET("/metrics", metricsHandler.Serve)
+
 	// Static files fallback (SPA)
 	router.Handle("*", "/", spaHandler())
 
@@ -645,8 +861,15 @@ func RunServe(args []string) int {
 		})
 	})
 
+	web.SetAPITokenFunc(apiTokenHandler.Authenticate)
+
 	skipAuthPaths := []string{
 		"/api/v1/auth/login",
+		"/api/v1/auth/login/2fa",
+		"/api/v1/auth/login/2fa/enroll",
+		"/api/v1/auth/oidc/config",
+		"/api/v1/auth/oidc/login",
+		"/api/v1/auth/oidc/callback",
 		"/api/v1/auth/setup",
 		"/api/v1/auth/needs-setup",
 		"/api/v1/health",
@@ -656,7 +879,18 @@ func RunServe(args []string) int {
 	rlCtx, rlCancel := context.WithCancel(context.Background())
 	defer rlCancel()
 	loginLimiter := web.NewRateLimiter(10, time.Minute, rlCtx)
-	rateLimitPaths := []string{"/api/v1/auth/login", "/api/v1/auth/setup"}
+	// Credential and 2FA code checks, so codes cannot be brute-forced.
+	rateLimitPaths := []string{
+		"/api/v1/auth/login",
+		"/api/v1/auth/login/2fa",
+		"/api/v1/auth/login/2fa/enroll",
+		"/api/v1/auth/2fa/verify",
+		"/api/v1/auth/2fa/disable",
+		"/api/v1/auth/2fa/recovery-codes",
+		"/api/v1/auth/oidc/callback",
+		"/api/v1/auth/setup",
+	}
+	streamUploadPaths := []string{"/api/v1/snapshots/import", "/api/v1/snapshots/import-openclaw"}
 
 	handler := web.Chain(
 		router,
@@ -665,8 +899,9 @@ func RunServe(args []string) int {
 		web.SecurityHeadersMiddleware,
 		web.RequestIDMiddleware,
 		web.RequestLogMiddleware,
+		web.MetricsMiddleware(metricsHandler.HTTPLatency()),
 		web.CORSMiddleware(cfg.Server.CORSOrigins),
-		web.MaxBodySizeMiddleware(20<<20), // 20 MB (image attachments need ~13 MB base64 for 10 MB file)
+		web.MaxBodySizeMiddleware(20<<20, streamUploadPaths), // 20 MB (image attachments need ~13 MB base64 for 10 MB file)
 		web.RateLimitMiddleware(loginLimiter, rateLimitPaths),
 		web.InputSanitizeMiddleware,
 		web.AuthMiddleware(cfg.Auth.JWTSecret, skipAuthPaths),
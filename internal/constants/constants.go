@@ -10,12 +10,37 @@ const (
 
 var AllRiskLevels = []string{RiskLow, RiskMedium, RiskHigh, RiskCritical}
 
+// Alert states
+const (
+	AlertStatusOpen         = "open"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusSilenced     = "silenced"
+	AlertStatusResolved     = "resolved"
+)
+
 // User roles
 const (
 	RoleAdmin    = "admin"
 	RoleReadonly = "readonly"
 )
 
+// Permissions granted by roles. Admin implicitly holds all of them.
+const (
+	PermGatewayControl   = "gateway.control"   // start/stop/restart gateways, reconnect, reset sessions
+	PermConfigWrite      = "config.write"      // OpenClaw config, settings, profiles, templates, agents
+	PermAlertsManage     = "alerts.manage"     // alert rules, notification channels, ack/silence/resolve
+	PermSnapshotsWrite   = "snapshots.write"   // create, import, delete and schedule snapshots
+	PermSnapshotsRestore = "snapshots.restore" // restore, export and verify snapshots
+	PermPluginsInstall   = "plugins.install"   // install, update and remove skills and plugins
+	PermUsersManage      = "users.manage"      // users, roles and role assignment
+	PermSystemManage     = "system.manage"     // self-update, services, setup wizard, host exec, backup targets and keys
+)
+
+var AllPermissions = []string{
+	PermGatewayControl, PermConfigWrite, PermAlertsManage, PermSnapshotsWrite,
+	PermSnapshotsRestore, PermPluginsInstall, PermUsersManage, PermSystemManage,
+}
+
 // Audit actions
 const (
 	ActionLogin                  = "login"
@@ -38,17 +63,68 @@ const (
 	ActionSnapshotUnlock         = "snapshot.unlock_preview"
 	ActionSnapshotRestore        = "snapshot.restore"
 	ActionSnapshotDelete         = "snapshot.delete"
+	ActionSnapshotMigrate        = "snapshot.migrate"
 	ActionSnapshotScheduleUpdate = "snapshot.schedule.update"
 	ActionSnapshotScheduleRun    = "snapshot.schedule.run"
 	ActionSnapshotSchedulePrune  = "snapshot.schedule.prune"
+	ActionSnapshotScheduleCreate = "snapshot.schedule.create"
+	ActionSnapshotScheduleDelete = "snapshot.schedule.delete"
+	ActionSnapshotAutoUpdate     = "snapshot.auto.update"
+	ActionSnapshotAutoRun        = "snapshot.auto.run"
+	ActionSnapshotAutoPrune      = "snapshot.auto.prune"
+	ActionSnapshotTreesUpdate    = "snapshot.trees.update"
+	ActionSnapshotKeysUpdate     = "snapshot.keys.update"
+	ActionSnapshotRecoveryKey    = "snapshot.keys.recovery"
+	ActionSnapshotRewrap         = "snapshot.keys.rewrap"
+	ActionSnapshotTargetCreate   = "snapshot.target.create"
+	ActionSnapshotTargetUpdate   = "snapshot.target.update"
+	ActionSnapshotTargetDelete   = "snapshot.target.delete"
+	ActionSnapshotTargetPrune    = "snapshot.target.prune"
+	ActionSnapshotUpload         = "snapshot.upload"
+	ActionSnapshotRemoteImport   = "snapshot.remote_import"
 	ActionPolicyUpdate           = "policy.update"
 	ActionPasswordChange         = "password.change"
 	ActionSetup                  = "setup"
 	ActionSettingsUpdate         = "settings.update"
 	ActionAlertRead              = "alert.read"
+	ActionAlertAcknowledge       = "alert.acknowledge"
+	ActionAlertSilence           = "alert.silence"
+	ActionAlertResolve           = "alert.resolve"
+	ActionAlertRuleCreate        = "alert_rule.create"
+	ActionAlertRuleUpdate        = "alert_rule.update"
+	ActionAlertRuleDelete        = "alert_rule.delete"
+	ActionRemediationCreate      = "remediation.create"
+	ActionRemediationUpdate      = "remediation.update"
+	ActionRemediationDelete      = "remediation.delete"
+	ActionRemediationRun         = "remediation.run"
+	ActionSLOCreate              = "slo.create"
+	ActionSLOUpdate              = "slo.update"
+	ActionSLODelete              = "slo.delete"
+	ActionRiskPolicyUpdate       = "risk_policy.update"
+	ActionRiskPolicyReload       = "risk_policy.reload"
+	ActionRiskRescore            = "risk_policy.rescore"
+	ActionRetentionUpdate        = "retention.update"
+	ActionRetentionPrune         = "retention.prune"
+	ActionDatabaseCompact        = "database.compact"
+	ActionArchiveImport          = "archive.import"
 	ActionSelfUpdate             = "self.update"
 	ActionUserCreate             = "user.create"
 	ActionUserDelete             = "user.delete"
+	ActionUserRoleUpdate         = "user.role.update"
+	ActionRoleCreate             = "role.create"
+	ActionRoleUpdate             = "role.update"
+	ActionRoleDelete             = "role.delete"
+	ActionAPITokenCreate         = "api_token.create"
+	ActionAPITokenRevoke         = "api_token.revoke"
+	ActionAPITokenUse            = "api_token.use"
+	ActionTOTPEnable             = "totp.enable"
+	ActionTOTPDisable            = "totp.disable"
+	ActionTOTPReset              = "totp.reset"
+	ActionTOTPRecoveryRegen      = "totp.recovery_codes"
+	ActionTOTPRecoveryUse        = "totp.recovery_use"
+	ActionTOTPPolicyUpdate       = "totp.policy.update"
+	ActionSessionRevoke          = "session.revoke"
+	ActionSessionRevokeAll       = "session.revoke_all"
 )
 
 // Activity categories
@@ -0,0 +1,498 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"ClawDeckX/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// AuditChainFormat identifies the export format written by AuditLogRepo.ExportChain.
+const AuditChainFormat = "clawdeckx-audit-chain/v1"
+
+const auditVerifyBatch = 1000
+
+// AuditHash returns the chain hash of l given the hash of the previous row:
+// hex SHA-256 over prevHash and the row's fields, each written as
+// "<byte length>:<value>;" in the order prev_hash, created_at (RFC 3339, UTC,
+// microseconds), user_id, username, action, result, detail, ip.
+func AuditHash(prevHash string, l *AuditLog) string {
+	h := sha256.New()
+	for _, f := range []string{
+		prevHash,
+		auditTime(l.CreatedAt),
+		strconv.FormatUint(uint64(l.UserID), 10),
+		l.Username,
+		l.Action,
+		l.Result,
+		l.Detail,
+		l.IP,
+	} {
+		fmt.Fprintf(h, "%d:%s;", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// auditTime normalizes timestamps to what every supported database round-trips.
+func auditTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format("2006-01-02T15:04:05.000000Z")
+}
+
+// signCheckpoint returns the HMAC-SHA256 signature of a checkpoint.
+func signCheckpoint(key []byte, cp *AuditCheckpoint) string {
+	m := hmac.New(sha256.New, key)
+	fmt.Fprintf(m, "%d|%d|%s|%s", cp.LastLogID, cp.Count, cp.Hash, auditTime(cp.CreatedAt))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// auditCheckpointKey derives the checkpoint signing key from the server secret,
+// so checkpoints cannot be forged with database access alone.
+func auditCheckpointKey() ([]byte, error) {
+	secret := currentSecretKey()
+	if secret == "" {
+		return nil, errors.New("no server secret configured")
+	}
+	sum := sha256.Sum256([]byte("clawdeckx audit checkpoint\x00" + secret))
+	return sum[:], nil
+}
+
+// AuditVerifyResult reports the outcome of an audit chain verification.
+type AuditVerifyResult struct {
+	OK              bool   `json:"ok"`
+	Checked         int64  `json:"checked"`
+	Checkpoints     int    `json:"checkpoints"`
+	ArchivedThrough uint   `json:"archived_through,omitempty"` // rows up to this ID were archived; the chain is checked from there
+	HeadID          uint   `json:"head_id,omitempty"`
+	HeadHash        string `json:"head_hash,omitempty"`
+	BrokenID        uint   `json:"broken_id,omitempty"` // first row (or checkpoint row) that fails
+	Reason          string `json:"reason,omitempty"`
+}
+
+// auditVerifier walks a chain in ID order and stops at the first broken link.
+type auditVerifier struct {
+	key         []byte
+	checkpoints map[uint]AuditCheckpoint
+	prev        string
+	archived    int64 // rows before the first one checked, removed by archival
+	res         AuditVerifyResult
+}
+
+func newAuditVerifier(key []byte, checkpoints []AuditCheckpoint) *auditVerifier {
+	v := &auditVerifier{key: key, checkpoints: map[uint]AuditCheckpoint{}, res: AuditVerifyResult{OK: true}}
+	for _, cp := range checkpoints {
+		v.checkpoints[cp.LastLogID] = cp
+	}
+	return v
+}
+
+func (v *auditVerifier) fail(id uint, reason string) bool {
+	v.res.OK = false
+	v.res.BrokenID = id
+	v.res.Reason = reason
+	return false
+}
+
+// resume starts the chain after the archive checkpoint whose hash the first
+// stored row links to. Checkpoints it covers refer to archived rows.
+func (v *auditVerifier) resume(l *AuditLog) bool {
+	var anchor *AuditCheckpoint
+	for _, cp := range v.checkpoints {
+		if cp.Archive != "" && cp.Hash == l.PrevHash && cp.LastLogID < l.ID && (anchor == nil || cp.LastLogID > anchor.LastLogID) {
+			c := cp
+			anchor = &c
+		}
+	}
+	if anchor == nil {
+		return true
+	}
+	if v.key != nil && !hmac.Equal([]byte(signCheckpoint(v.key, anchor)), []byte(anchor.Signature)) {
+		return v.fail(anchor.LastLogID, fmt.Sprintf("checkpoint %d has an invalid signature", anchor.ID))
+	}
+	for id := range v.checkpoints {
+		if id <= anchor.LastLogID {
+			delete(v.checkpoints, id)
+		}
+	}
+	v.prev = anchor.Hash
+	v.archived = anchor.Count
+	v.res.ArchivedThrough = anchor.LastLogID
+	return true
+}
+
+// entry checks the next row and reports whether verification should continue.
+func (v *auditVerifier) entry(l *AuditLog) bool {
+	if v.res.Checked == 0 && v.prev == "" && l.PrevHash != "" && !v.resume(l) {
+		return false
+	}
+	if l.PrevHash != v.prev {
+		return v.fail(l.ID, "prev_hash does not match the previous row (row deleted, inserted or reordered)")
+	}
+	if AuditHash(l.PrevHash, l) != l.Hash {
+		return v.fail(l.ID, "hash does not match the row contents (row modified)")
+	}
+	v.prev = l.Hash
+	v.res.Checked++
+	v.res.HeadID = l.ID
+	v.res.HeadHash = l.Hash
+
+	if cp, ok := v.checkpoints[l.ID]; ok {
+		delete(v.checkpoints, l.ID)
+		if v.key != nil && !hmac.Equal([]byte(signCheckpoint(v.key, &cp)), []byte(cp.Signature)) {
+			return v.fail(l.ID, fmt.Sprintf("checkpoint %d has an invalid signature", cp.ID))
+		}
+		if cp.Hash != l.Hash || cp.Count != v.archived+v.res.Checked {
+			return v.fail(l.ID, fmt.Sprintf("chain does not match checkpoint %d", cp.ID))
+		}
+		v.res.Checkpoints++
+	}
+	return true
+}
+
+// finish reports checkpoints whose row never appeared, i.e. truncated history.
+func (v *auditVerifier) finish() AuditVerifyResult {
+	if v.res.OK {
+		var missing *AuditCheckpoint
+		for _, cp := range v.checkpoints {
+			if missing == nil || cp.LastLogID < missing.LastLogID {
+				c := cp
+				missing = &c
+			}
+		}
+		if missing != nil {
+			v.fail(missing.LastLogID, fmt.Sprintf("row covered by checkpoint %d is missing (log truncated)", missing.ID))
+		}
+	}
+	return v.res
+}
+
+// Verify walks the whole audit chain and its checkpoints and reports the
+// first broken link.
+func (r *AuditLogRepo) Verify() (*AuditVerifyResult, error) {
+	key, err := auditCheckpointKey()
+	if err != nil {
+		return nil, err
+	}
+	var checkpoints []AuditCheckpoint
+	if err := r.db.Order("id asc").Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	v := newAuditVerifier(key, checkpoints)
+
+	var batch []AuditLog
+	var lastID uint
+	for {
+		batch = batch[:0]
+		if err := r.db.Where("id > ?", lastID).Order("id asc").Limit(auditVerifyBatch).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			if !v.entry(&batch[i]) {
+				res := v.res
+				return &res, nil
+			}
+		}
+		if len(batch) < auditVerifyBatch {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+	res := v.finish()
+	return &res, nil
+}
+
+// Checkpoint signs the current chain head. It returns nil when nothing was
+// logged since the last checkpoint.
+func (r *AuditLogRepo) Checkpoint() (*AuditCheckpoint, error) {
+	key, err := auditCheckpointKey()
+	if err != nil {
+		return nil, err
+	}
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+
+	var head AuditLog
+	if err := r.db.Order("id desc").Limit(1).Find(&head).Error; err != nil {
+		return nil, err
+	}
+	if head.ID == 0 {
+		return nil, nil
+	}
+	var last AuditCheckpoint
+	if err := r.db.Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	if last.LastLogID == head.ID {
+		return nil, nil
+	}
+	cp := &AuditCheckpoint{LastLogID: head.ID, Hash: head.Hash, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	if cp.Count, err = r.countThrough(head.ID); err != nil {
+		return nil, err
+	}
+	cp.Signature = signCheckpoint(key, cp)
+	if err := r.db.Create(cp).Error; err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// countThrough returns the number of chain rows up to and including id,
+// archived rows included.
+func (r *AuditLogRepo) countThrough(id uint) (int64, error) {
+	var first AuditLog
+	if err := r.db.Select("id", "prev_hash").Order("id asc").Limit(1).Find(&first).Error; err != nil {
+		return 0, err
+	}
+	q := r.db.Model(&AuditLog{}).Where("id <= ?", id)
+	var base int64
+	if first.PrevHash != "" {
+		var anchor AuditCheckpoint
+		if err := r.db.Where("archive <> '' AND hash = ? AND last_log_id < ?", first.PrevHash, first.ID).
+			Order("last_log_id desc").Limit(1).Find(&anchor).Error; err != nil {
+			return 0, err
+		}
+		if anchor.ID != 0 {
+			base = anchor.Count
+			q = q.Where("id > ?", anchor.LastLogID)
+		}
+	}
+	var n int64
+	err := q.Count(&n).Error
+	return base + n, err
+}
+
+// CanArchive reports why ArchiveThrough would fail to sign its checkpoint,
+// or nil.
+func (r *AuditLogRepo) CanArchive() error {
+	_, err := auditCheckpointKey()
+	return err
+}
+
+// ArchiveThrough removes the rows up to and including id, which the caller
+// has archived, behind a signed checkpoint naming the archive. Verify then
+// checks the chain from that checkpoint on. It returns nil when there is
+// nothing to remove.
+func (r *AuditLogRepo) ArchiveThrough(id uint, archive string) (*AuditCheckpoint, error) {
+	key, err := auditCheckpointKey()
+	if err != nil {
+		return nil, err
+	}
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+
+	var last AuditLog
+	if err := r.db.Where("id <= ?", id).Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	if last.ID == 0 {
+		return nil, nil
+	}
+	cp := &AuditCheckpoint{LastLogID: last.ID, Hash: last.Hash, Archive: archive, CreatedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	if cp.Count, err = r.countThrough(last.ID); err != nil {
+		return nil, err
+	}
+	cp.Signature = signCheckpoint(key, cp)
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(cp).Error; err != nil {
+			return err
+		}
+		return tx.Where("id <= ?", last.ID).Delete(&AuditLog{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// ListCheckpoints returns the most recent checkpoints, newest first.
+func (r *AuditLogRepo) ListCheckpoints(limit int) ([]AuditCheckpoint, error) {
+	var list []AuditCheckpoint
+	err := r.db.Order("id desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+// auditExportLine is one NDJSON line of a chain export.
+type auditExportLine struct {
+	Type       string           `json:"type"` // header, checkpoint, entry
+	Format     string           `json:"format,omitempty"`
+	Hash       string           `json:"hash_algorithm,omitempty"`
+	ExportedAt string           `json:"exported_at,omitempty"`
+	Checkpoint *AuditCheckpoint `json:"checkpoint,omitempty"`
+	Entry      *AuditLog        `json:"entry,omitempty"`
+}
+
+// ExportChain writes the full chain as NDJSON: a header line, every
+// checkpoint, then every row in ID order. VerifyChainExport checks the result
+// without database access.
+func (r *AuditLogRepo) ExportChain(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(auditExportLine{
+		Type:       "header",
+		Format:     AuditChainFormat,
+		Hash:       "sha256",
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+	var checkpoints []AuditCheckpoint
+	if err := r.db.Order("id asc").Find(&checkpoints).Error; err != nil {
+		return err
+	}
+	for i := range checkpoints {
+		if err := enc.Encode(auditExportLine{Type: "checkpoint", Checkpoint: &checkpoints[i]}); err != nil {
+			return err
+		}
+	}
+	var batch []AuditLog
+	var lastID uint
+	for {
+		batch = batch[:0]
+		if err := r.db.Where("id > ?", lastID).Order("id asc").Limit(auditVerifyBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := enc.Encode(auditExportLine{Type: "entry", Entry: &batch[i]}); err != nil {
+				return err
+			}
+		}
+		if len(batch) < auditVerifyBatch {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// VerifyChainExport verifies an ExportChain stream. Checkpoint signatures are
+// checked only when the server secret is available (verifyCheckpoints).
+func VerifyChainExport(rd io.Reader, verifyCheckpoints bool) (*AuditVerifyResult, error) {
+	var key []byte
+	if verifyCheckpoints {
+		k, err := auditCheckpointKey()
+		if err != nil {
+			return nil, err
+		}
+		key = k
+	}
+	dec := json.NewDecoder(rd)
+	var header auditExportLine
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if header.Type != "header" || header.Format != AuditChainFormat {
+		return nil, fmt.Errorf("not a %s export", AuditChainFormat)
+	}
+
+	var v *auditVerifier
+	var checkpoints []AuditCheckpoint
+	for {
+		var line auditExportLine
+		if err := dec.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch {
+		case line.Type == "checkpoint" && line.Checkpoint != nil:
+			if v != nil {
+				return nil, errors.New("checkpoint after entries")
+			}
+			checkpoints = append(checkpoints, *line.Checkpoint)
+		case line.Type == "entry" && line.Entry != nil:
+			if v == nil {
+				v = newAuditVerifier(key, checkpoints)
+			}
+			if !v.entry(line.Entry) {
+				res := v.res
+				return &res, nil
+			}
+		}
+	}
+	if v == nil {
+		v = newAuditVerifier(key, checkpoints)
+	}
+	res := v.finish()
+	return &res, nil
+}
+
+// sealAuditChain hashes rows written before the chain existed, so the chain
+// starts at the first audit record. Runs before the append-only triggers
+// would refuse it.
+func sealAuditChain(db *gorm.DB) error {
+	var pending int64
+	if err := db.Model(&AuditLog{}).Where("hash = '' OR hash IS NULL").Count(&pending).Error; err != nil || pending == 0 {
+		return err
+	}
+	prev := ""
+	var lastID uint
+	var batch []AuditLog
+	for {
+		batch = batch[:0]
+		if err := db.Where("id > ?", lastID).Order("id asc").Limit(auditVerifyBatch).Find(&batch).Error; err != nil {
+			return err
+		}
+		for i := range batch {
+			l := &batch[i]
+			if l.Hash == "" {
+				l.PrevHash = prev
+				l.Hash = AuditHash(prev, l)
+				if err := db.Model(&AuditLog{}).Where("id = ?", l.ID).
+					Updates(map[string]interface{}{"prev_hash": l.PrevHash, "hash": l.Hash}).Error; err != nil {
+					return err
+				}
+			}
+			prev = l.Hash
+		}
+		if len(batch) < auditVerifyBatch {
+			break
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+	logger.DB.Info().Int64("rows", pending).Msg("audit log chain sealed")
+	return nil
+}
+
+// protectAuditLog installs triggers that refuse UPDATE and DELETE on audit
+// rows; only unsealed legacy rows may still receive their hash, and only rows
+// covered by an archive checkpoint may be deleted.
+func protectAuditLog(db *gorm.DB) error {
+	var stmts []string
+	switch db.Dialector.Name() {
+	case "sqlite":
+		stmts = []string{
+			`CREATE TRIGGER IF NOT EXISTS audit_logs_no_update BEFORE UPDATE ON audit_logs
+			 WHEN OLD.hash <> '' BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END`,
+			`DROP TRIGGER IF EXISTS audit_logs_no_delete`,
+			`CREATE TRIGGER audit_logs_no_delete BEFORE DELETE ON audit_logs
+			 WHEN OLD.id > (SELECT coalesce(max(last_log_id), 0) FROM audit_checkpoints WHERE archive <> '')
+			 BEGIN SELECT RAISE(ABORT, 'audit_logs is append-only'); END`,
+		}
+	case "postgres":
+		stmts = []string{
+			`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+			 BEGIN
+			   IF TG_OP = 'UPDATE' AND COALESCE(OLD.hash, '') = '' THEN RETURN NEW; END IF;
+			   IF TG_OP = 'DELETE' AND OLD.id <= (SELECT COALESCE(MAX(last_log_id), 0) FROM audit_checkpoints WHERE archive <> '') THEN
+			     RETURN OLD;
+			   END IF;
+			   RAISE EXCEPTION 'audit_logs is append-only';
+			 END; $$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs`,
+			`CREATE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs
+			 FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+		}
+	}
+	for _, s := range stmts {
+		if err := db.Exec(s).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
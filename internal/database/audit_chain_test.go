@@ -0,0 +1,130 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedAuditChain(t *testing.T, n int) *AuditLogRepo {
+	t.Helper()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+	repo := NewAuditLogRepo()
+	for i := 1; i <= n; i++ {
+		require.NoError(t, repo.Create(&AuditLog{UserID: 1, Username: "admin", Action: "login", Result: "success", Detail: fmt.Sprintf("entry %d", i), IP: "127.0.0.1"}))
+	}
+	return repo
+}
+
+func TestAuditChain_VerifyDetectsTampering(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := seedAuditChain(t, 5)
+
+	res, err := repo.Verify()
+	require.NoError(t, err)
+	assert.True(t, res.OK)
+	assert.EqualValues(t, 5, res.Checked)
+
+	// Edited row.
+	require.NoError(t, DB.Model(&AuditLog{}).Where("id = ?", 3).Update("detail", "nothing to see").Error)
+	res, err = repo.Verify()
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.EqualValues(t, 3, res.BrokenID)
+	assert.EqualValues(t, 2, res.Checked)
+
+	// Deleted row: the next row no longer links to its predecessor.
+	require.NoError(t, DB.Model(&AuditLog{}).Where("id = ?", 3).Update("detail", "entry 3").Error)
+	require.NoError(t, DB.Delete(&AuditLog{}, 2).Error)
+	res, err = repo.Verify()
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.EqualValues(t, 3, res.BrokenID)
+}
+
+func TestAuditChain_CheckpointDetectsTruncation(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := seedAuditChain(t, 4)
+
+	cp, err := repo.Checkpoint()
+	require.NoError(t, err)
+	require.NotNil(t, cp)
+	assert.EqualValues(t, 4, cp.LastLogID)
+	assert.EqualValues(t, 4, cp.Count)
+
+	again, err := repo.Checkpoint()
+	require.NoError(t, err)
+	assert.Nil(t, again, "no new rows, no new checkpoint")
+
+	res, err := repo.Verify()
+	require.NoError(t, err)
+	assert.True(t, res.OK)
+	assert.Equal(t, 1, res.Checkpoints)
+
+	// Dropping the tail leaves a consistent chain, but the checkpoint notices.
+	require.NoError(t, DB.Where("id >= ?", 3).Delete(&AuditLog{}).Error)
+	res, err = repo.Verify()
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.EqualValues(t, 4, res.BrokenID)
+
+	// A forged checkpoint is rejected.
+	require.NoError(t, DB.Model(&AuditCheckpoint{}).Where("id = ?", cp.ID).
+		Updates(map[string]interface{}{"last_log_id": 2, "count": 2, "hash": res.HeadHash}).Error)
+	res, err = repo.Verify()
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.Contains(t, res.Reason, "signature")
+}
+
+func TestAuditChain_ExportRoundTrip(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	repo := seedAuditChain(t, 3)
+	_, err := repo.Checkpoint()
+	require.NoError(t, err)
+	require.NoError(t, repo.Create(&AuditLog{Action: "logout", Result: "success"}))
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.ExportChain(&buf))
+	res, err := VerifyChainExport(bytes.NewReader(buf.Bytes()), true)
+	require.NoError(t, err)
+	assert.True(t, res.OK)
+	assert.EqualValues(t, 4, res.Checked)
+	assert.Equal(t, 1, res.Checkpoints)
+
+	tampered := bytes.Replace(buf.Bytes(), []byte(`"entry 2"`), []byte(`"entry X"`), 1)
+	res, err = VerifyChainExport(bytes.NewReader(tampered), false)
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.EqualValues(t, 2, res.BrokenID)
+}
+
+func TestAuditChain_SealAndProtect(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	// Rows written before the chain existed.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, DB.Create(&AuditLog{Action: "legacy", Result: "success"}).Error)
+	}
+	require.NoError(t, sealAuditChain(DB))
+	require.NoError(t, protectAuditLog(DB))
+
+	repo := NewAuditLogRepo()
+	require.NoError(t, repo.Create(&AuditLog{Action: "login", Result: "success"}))
+	res, err := repo.Verify()
+	require.NoError(t, err)
+	assert.True(t, res.OK)
+	assert.EqualValues(t, 4, res.Checked)
+
+	assert.Error(t, DB.Model(&AuditLog{}).Where("id = ?", 1).Update("detail", "x").Error)
+	assert.Error(t, DB.Delete(&AuditLog{}, 1).Error)
+}
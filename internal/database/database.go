@@ -63,6 +63,15 @@ func Init(cfg webconfig.DatabaseConfig, debug bool) error {
 	if err := autoMigrate(); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	if err := sealAuditChain(DB); err != nil {
+		return fmt.Errorf("failed to seal audit log: %w", err)
+	}
+	if err := protectAuditLog(DB); err != nil {
+		return fmt.Errorf("failed to protect audit log: %w", err)
+	}
+	if err := EnsureSearchIndex(DB); err != nil {
+		return fmt.Errorf("failed to create search index: %w", err)
+	}
 
 	logger.DB.Info().Msg(i18n.T(i18n.MsgLogDbInitComplete))
 	return nil
@@ -71,17 +80,33 @@ func Init(cfg webconfig.DatabaseConfig, debug bool) error {
 func autoMigrate() error {
 	return DB.AutoMigrate(
 		&User{},
+		&Role{},
+		&APIToken{},
+		&Session{},
 		&Activity{},
 		&Alert{},
+		&AlertRule{},
 		&AuditLog{},
+		&AuditCheckpoint{},
 		&MonitorState{},
+		&SessionFileState{},
+		&SessionTranscript{},
 		&SnapshotRecord{},
+		&SnapshotSchedule{},
+		&SnapshotBlob{},
+		&SnapshotBlobRef{},
 		&Setting{},
 		&CredentialScan{},
 		&ConnectionLog{},
 		&SkillHash{},
 		&GatewayProfile{},
+		&SnapshotTarget{},
+		&SnapshotUpload{},
 		&GatewayLifecycle{},
+		&GatewayAvailabilityDaily{},
+		&GatewaySLO{},
+		&RemediationPolicy{},
+		&RemediationRun{},
 		&Template{},
 		&SkillTranslation{},
 		&ReleaseNotesTranslation{},
@@ -25,13 +25,19 @@ func setupTestDB(t *testing.T) func() {
 		&Activity{},
 		&Alert{},
 		&AuditLog{},
+		&AuditCheckpoint{},
 		&MonitorState{},
 		&SnapshotRecord{},
+		&SnapshotSchedule{},
+		&SnapshotBlob{},
+		&SnapshotBlobRef{},
 		&Setting{},
 		&CredentialScan{},
 		&ConnectionLog{},
 		&SkillHash{},
 		&GatewayProfile{},
+		&SnapshotTarget{},
+		&SnapshotUpload{},
 		&Template{},
 		&SkillTranslation{},
 	)
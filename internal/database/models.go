@@ -11,34 +11,130 @@ type User struct {
 	Role           string     `gorm:"not null;default:admin" json:"role"`
 	LockedUntil    *time.Time `json:"locked_until,omitempty"`
 	FailedAttempts int        `gorm:"default:0" json:"-"`
+	TOTPSecret     string     `json:"-"` // encrypted; set on enrollment, before TOTPEnabled
+	TOTPEnabled    bool       `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastStep   int64      `gorm:"default:0" json:"-"`                          // last accepted time step, rejects code replay
+	RecoveryCodes  string     `gorm:"type:text" json:"-"`                          // comma-separated sha256 hashes of unused codes
+	AuthProvider   string     `gorm:"not null;default:local" json:"auth_provider"` // local or oidc
+	ExternalID     string     `gorm:"index" json:"-"`                              // issuer#subject for oidc users
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 }
 
+// Session is a login session. SessionID is carried in the JWT (jti) so the
+// token can be revoked before it expires.
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	SessionID    string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	Username     string     `json:"username"`
+	Method       string     `json:"method"` // password, totp, recovery_code, oidc
+	IP           string     `json:"ip"`
+	UserAgent    string     `json:"user_agent"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	ExpiresAt    time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt    *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+}
+
+// Role is a custom role. The built-in admin and readonly roles are not stored.
+type Role struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+	Permissions string    `gorm:"type:text" json:"permissions"` // comma-separated permission names
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// APIToken is a personal access token. Only the SHA-256 hash of the secret is
+// stored; Prefix keeps the first characters so users can tell tokens apart.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:text" json:"scopes"` // comma-separated permission names; empty = read-only
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 type Activity struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	EventID     string    `gorm:"index" json:"event_id"`
 	Timestamp   time.Time `gorm:"index" json:"timestamp"`
 	Category    string    `gorm:"index" json:"category"`
 	Risk        string    `gorm:"index" json:"risk"`
+	RiskScore   int       `json:"risk_score"`
+	RiskReasons string    `gorm:"type:text" json:"risk_reasons,omitempty"` // JSON list of the rules that scored it
+	RiskPolicy  string    `gorm:"index" json:"risk_policy,omitempty"`      // hash of the risk policy that scored it, "" = not policy-scored
 	Summary     string    `json:"summary"`
 	Detail      string    `gorm:"type:text" json:"detail,omitempty"`
 	Source      string    `json:"source"`
 	ActionTaken string    `json:"action_taken"`
 	SessionID   string    `json:"session_id"`
+	GatewayID   uint      `gorm:"index" json:"gateway_id"` // GatewayProfile ID, 0 = active gateway before profiles existed
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Alert is a raised alert. Alerts sharing a DedupKey collapse into one row
+// while unresolved: repeats bump Count and LastSeenAt instead of inserting.
 type Alert struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	AlertID   string    `gorm:"index" json:"alert_id"`
-	Risk      string    `gorm:"index" json:"risk"`
-	Message   string    `json:"message"`
-	Detail    string    `gorm:"type:text" json:"detail,omitempty"`
-	Notified  bool      `gorm:"default:false" json:"notified"`
-	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	AlertID         string     `gorm:"index" json:"alert_id"`
+	DedupKey        string     `gorm:"index" json:"dedup_key,omitempty"`
+	Risk            string     `gorm:"index" json:"risk"`
+	Message         string     `json:"message"`
+	Detail          string     `gorm:"type:text" json:"detail,omitempty"`
+	Notified        bool       `gorm:"default:false" json:"notified"`
+	Status          string     `gorm:"index;default:open" json:"status"` // open, acknowledged, silenced, resolved
+	Count           int        `gorm:"default:1" json:"count"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+	AckedBy         string     `json:"acked_by,omitempty"`
+	AckedAt         *time.Time `json:"acked_at,omitempty"`
+	SilencedUntil   *time.Time `json:"silenced_until,omitempty"`
+	ResolvedBy      string     `json:"resolved_by,omitempty"` // username, or "auto" when the condition cleared
+	ResolvedAt      *time.Time `json:"resolved_at,omitempty"`
+	ResolveOn       string     `json:"resolve_on,omitempty"` // comma-separated lifecycle event types that auto-resolve the alert
+	EscalateChannel string     `json:"escalate_channel,omitempty"`
+	EscalateAt      *time.Time `gorm:"index" json:"escalate_at,omitempty"`
+	EscalatedAt     *time.Time `json:"escalated_at,omitempty"`
+	GatewayID       uint       `gorm:"index" json:"gateway_id"`
+	CreatedAt       time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// AlertRule is a user-defined alert condition evaluated against Activity and
+// GatewayLifecycle events. MatchJSON holds the serialized match criteria.
+type AlertRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"not null" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	Enabled     bool      `gorm:"index" json:"enabled"`
+	EventKind   string    `gorm:"index;not null" json:"event_kind"` // activity, lifecycle
+	MatchJSON   string    `gorm:"type:text" json:"match"`
+	Threshold   int       `gorm:"not null;default:1" json:"threshold"`
+	WindowSec   int       `gorm:"default:0" json:"window_sec"`
+	GroupBy     string    `json:"group_by"` // "", session, source, category
+	Risk        string    `gorm:"not null;default:medium" json:"risk"`
+	Message     string    `gorm:"type:text" json:"message"`
+	Notify      bool      `json:"notify"`
+	Channels    string    `json:"channels"` // comma-separated notify channel names; empty = all
+	CooldownSec int       `gorm:"default:0" json:"cooldown_sec"`
+	ResolveOn   string    `json:"resolve_on"`                    // comma-separated lifecycle event types that auto-resolve fired alerts
+	EscalateMin int       `gorm:"default:0" json:"escalate_min"` // escalate if still unacknowledged after N minutes; 0 = use global setting
+	EscalateTo  string    `json:"escalate_to"`                   // notify channel used for escalation
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// AuditLog is an append-only, hash-chained audit record: Hash covers the
+// row's fields and PrevHash, the Hash of the row before it (see AuditHash).
 type AuditLog struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
 	UserID    uint      `gorm:"index" json:"user_id"`
@@ -48,6 +144,20 @@ type AuditLog struct {
 	Result    string    `json:"result"`
 	IP        string    `json:"ip"`
 	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	PrevHash  string    `gorm:"not null;default:''" json:"prev_hash"`
+	Hash      string    `gorm:"not null;default:''" json:"hash"`
+}
+
+// AuditCheckpoint is a signed record of the audit chain head. A checkpoint
+// detects rewriting of the whole chain and truncation of rows it covers.
+type AuditCheckpoint struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	LastLogID uint      `gorm:"index" json:"last_log_id"`
+	Count     int64     `json:"count"` // rows up to and including LastLogID
+	Hash      string    `json:"hash"`  // Hash of row LastLogID
+	Signature string    `json:"signature"`
+	Archive   string    `gorm:"not null;default:''" json:"archive,omitempty"` // set when rows up to LastLogID were archived and removed
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type MonitorState struct {
@@ -59,12 +169,40 @@ type MonitorState struct {
 	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
+// SessionFileState is how far one OpenClaw session log has been ingested,
+// with the file's identity so truncation and rotation can be told apart
+// from appends across restarts.
+type SessionFileState struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Path       string    `gorm:"uniqueIndex;not null" json:"path"`
+	Inode      uint64    `json:"inode"`     // 0 where the platform has none
+	HeadHash   string    `json:"head_hash"` // sha256 of the first line, empty until it is complete
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	ReadOffset int64     `json:"read_offset"` // byte offset after the last ingested line
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SessionTranscript is one message of a gateway session's chat history,
+// kept for full-text search when transcript indexing is enabled.
+type SessionTranscript struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	GatewayID  uint      `gorm:"uniqueIndex:idx_transcript_msg;index" json:"gateway_id"`
+	SessionKey string    `gorm:"uniqueIndex:idx_transcript_msg;not null" json:"session_key"`
+	Seq        int       `gorm:"uniqueIndex:idx_transcript_msg" json:"seq"` // position in the history
+	Role       string    `json:"role"`
+	Content    string    `gorm:"type:text" json:"content"`
+	Timestamp  time.Time `gorm:"index" json:"timestamp"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type SnapshotRecord struct {
 	ID                  uint      `gorm:"primaryKey" json:"id"`
 	SnapshotID          string    `gorm:"uniqueIndex;not null" json:"snapshot_id"`
 	SnapshotVersion     int       `gorm:"not null;default:1" json:"snapshot_version"`
 	Note                string    `json:"note"`
 	Trigger             string    `gorm:"index" json:"trigger"`
+	ScheduleID          uint      `gorm:"index;not null;default:0" json:"schedule_id,omitempty"` // SnapshotSchedule that created it
 	ResourceCount       int       `gorm:"not null" json:"resource_count"`
 	ResourceTypesJSON   string    `gorm:"type:text" json:"resource_types"`
 	ManifestSummaryJSON string    `gorm:"type:text" json:"manifest_summary"`
@@ -76,6 +214,7 @@ type SnapshotRecord struct {
 	WrappedDEKB64       string    `gorm:"type:text;not null" json:"wrapped_dek_b64"`
 	WrapNonceB64        string    `gorm:"type:text;not null" json:"wrap_nonce_b64"`
 	DataNonceB64        string    `gorm:"type:text;not null" json:"data_nonce_b64"`
+	KeySlotsJSON        string    `gorm:"type:text" json:"key_slots,omitempty"` // extra DEK slots besides the password one
 	Ciphertext          []byte    `gorm:"type:blob;not null" json:"-"`
 	CreatedAt           time.Time `gorm:"index" json:"created_at"`
 }
@@ -146,7 +285,7 @@ type ReleaseNotesTranslation struct {
 type GatewayLifecycle struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Timestamp   time.Time `gorm:"index" json:"timestamp"`
-	EventType   string    `gorm:"index;not null" json:"event_type"` // started, shutdown, crashed, unreachable, recovered
+	EventType   string    `gorm:"index;not null" json:"event_type"` // started, shutdown, crashed, unreachable, recovered, remediation
 	GatewayHost string    `json:"gateway_host"`
 	GatewayPort int       `json:"gateway_port"`
 	ProfileName string    `json:"profile_name"`
@@ -154,7 +293,70 @@ type GatewayLifecycle struct {
 	Reason      string    `json:"reason"`
 	ErrorDetail string    `gorm:"type:text" json:"error_detail,omitempty"`
 	UptimeSec   int64     `json:"uptime_sec"` // how long the gateway was up before this event (for shutdown/crash/unreachable)
-	CreatedAt   time.Time `json:"created_at"`
+	GatewayID   uint      `gorm:"index" json:"gateway_id"`
+	// RemediationRunID links a "remediation" timeline entry to its RemediationRun.
+	RemediationRunID uint      `gorm:"default:0" json:"remediation_run_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// GatewayAvailabilityDaily is one gateway's availability for one UTC day,
+// rolled up from GatewayLifecycle rows (see internal/availability). Rollups
+// are never pruned, so history outlives the lifecycle retention.
+type GatewayAvailabilityDaily struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	GatewayID        uint      `gorm:"uniqueIndex:idx_gw_availability_day;not null" json:"gateway_id"`
+	Day              time.Time `gorm:"uniqueIndex:idx_gw_availability_day;not null" json:"day"` // UTC midnight
+	UpSec            int64     `json:"up_sec"`
+	DownSec          int64     `json:"down_sec"`        // crashed or unreachable
+	MaintenanceSec   int64     `json:"maintenance_sec"` // after a clean shutdown
+	UnknownSec       int64     `json:"unknown_sec"`     // before the first recorded event
+	Incidents        int       `json:"incidents"`       // outages that started this day
+	Repaired         int       `json:"repaired"`        // of those, how many have ended
+	RepairSec        int64     `json:"repair_sec"`      // total duration of the repaired outages
+	LongestOutageSec int64     `json:"longest_outage_sec"`
+	EndState         string    `gorm:"not null" json:"end_state"` // up, down, maintenance, unknown
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// GatewaySLO is an availability target, for one gateway or for each of them.
+type GatewaySLO struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Name       string    `gorm:"not null" json:"name"`
+	GatewayID  *uint     `gorm:"index" json:"gateway_id"` // nil = every gateway
+	TargetPct  float64   `gorm:"not null" json:"target_pct"`
+	WindowDays int       `gorm:"not null;default:30" json:"window_days"` // rolling window
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// RemediationPolicy is a user-defined reaction to a gateway failure: a
+// trigger and the steps run when it fires (see internal/remediation).
+type RemediationPolicy struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	Name            string    `gorm:"not null" json:"name"`
+	Description     string    `gorm:"type:text" json:"description"`
+	Enabled         bool      `gorm:"index" json:"enabled"`
+	TriggerJSON     string    `gorm:"type:text;not null" json:"trigger"`
+	StepsJSON       string    `gorm:"type:text;not null" json:"steps"`
+	MaxRuns         int       `gorm:"not null;default:3" json:"max_runs"`          // runs allowed per RunWindowSec
+	RunWindowSec    int       `gorm:"not null;default:3600" json:"run_window_sec"` // rate-limit window
+	OnExhaustedJSON string    `gorm:"type:text" json:"on_exhausted"`               // steps run once when MaxRuns is reached
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// RemediationRun records one execution of a remediation policy.
+type RemediationRun struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	PolicyID   uint       `gorm:"index" json:"policy_id"`
+	PolicyName string     `json:"policy_name"`
+	GatewayID  uint       `gorm:"index" json:"gateway_id"`
+	Trigger    string     `gorm:"type:text" json:"trigger"`     // what fired the policy
+	Status     string     `gorm:"index;not null" json:"status"` // running, succeeded, failed, exhausted
+	StepsJSON  string     `gorm:"type:text" json:"steps"`       // []remediation.StepResult
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt  time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
 }
 
 type Template struct {
@@ -18,6 +18,42 @@ func (r *ActivityRepo) Create(activity *Activity) error {
 	return r.db.Create(activity).Error
 }
 
+// ExistingEventIDs returns which of the given event IDs are already stored.
+func (r *ActivityRepo) ExistingEventIDs(ids []string) (map[string]bool, error) {
+	found := make(map[string]bool)
+	for start := 0; start < len(ids); start += 500 {
+		end := min(start+500, len(ids))
+		var batch []string
+		if err := r.db.Model(&Activity{}).Where("event_id IN ?", ids[start:end]).Pluck("event_id", &batch).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range batch {
+			found[id] = true
+		}
+	}
+	return found, nil
+}
+
+// ListScoredBefore returns, oldest first, up to limit activities after
+// afterID that were scored by a risk policy other than policy.
+func (r *ActivityRepo) ListScoredBefore(policy string, afterID uint, limit int) ([]Activity, error) {
+	var activities []Activity
+	err := r.db.Where("risk_policy <> '' AND risk_policy <> ? AND id > ?", policy, afterID).
+		Order("id").Limit(limit).Find(&activities).Error
+	return activities, err
+}
+
+// UpdateRisk saves an activity's category and risk fields.
+func (r *ActivityRepo) UpdateRisk(a *Activity) error {
+	return r.db.Model(&Activity{}).Where("id = ?", a.ID).Updates(map[string]interface{}{
+		"category":     a.Category,
+		"risk":         a.Risk,
+		"risk_score":   a.RiskScore,
+		"risk_reasons": a.RiskReasons,
+		"risk_policy":  a.RiskPolicy,
+	}).Error
+}
+
 func (r *ActivityRepo) Count() (int64, error) {
 	var count int64
 	err := r.db.Model(&Activity{}).Count(&count).Error
@@ -72,6 +108,23 @@ func (r *ActivityRepo) CountByCategory(since time.Time) (map[string]int64, error
 	return counts, nil
 }
 
+// CategoryRiskCount is one row of ActivityRepo.CountByCategoryAndRisk.
+type CategoryRiskCount struct {
+	Category string
+	Risk     string
+	Count    int64
+}
+
+// CountByCategoryAndRisk returns all-time activity counts grouped by category and risk.
+func (r *ActivityRepo) CountByCategoryAndRisk() ([]CategoryRiskCount, error) {
+	var results []CategoryRiskCount
+	err := r.db.Model(&Activity{}).
+		Select("category, risk, count(*) as count").
+		Group("category, risk").
+		Find(&results).Error
+	return results, err
+}
+
 func (r *ActivityRepo) CountByTool(since time.Time) (map[string]int64, error) {
 	type result struct {
 		Source string
@@ -146,6 +199,9 @@ func (r *ActivityRepo) List(filter ActivityFilter) ([]Activity, int64, error) {
 	if filter.Risk != "" {
 		q = q.Where("risk = ?", filter.Risk)
 	}
+	if filter.GatewayID != nil {
+		q = q.Where("gateway_id = ?", *filter.GatewayID)
+	}
 	if filter.Keyword != "" {
 		q = q.Where("summary LIKE ?", "%"+filter.Keyword+"%")
 	}
@@ -185,6 +241,18 @@ func (r *ActivityRepo) GetByID(id uint) (*Activity, error) {
 	return &activity, nil
 }
 
+// ListRange returns activities with timestamps in [since, until], oldest first.
+// At most limit rows are returned.
+func (r *ActivityRepo) ListRange(since, until time.Time, limit int) ([]Activity, error) {
+	var activities []Activity
+	err := r.db.Model(&Activity{}).
+		Where("timestamp >= ? AND timestamp <= ?", since, until).
+		Order("timestamp asc").
+		Limit(limit).
+		Find(&activities).Error
+	return activities, err
+}
+
 func (r *ActivityRepo) RecentExceptions(limit int) ([]Activity, error) {
 	if limit <= 0 {
 		limit = 5
@@ -206,6 +274,7 @@ type ActivityFilter struct {
 	Category  string
 	Risk      string
 	Keyword   string
+	GatewayID *uint // nil = all gateways
 	StartTime string
 	EndTime   string
 }
@@ -1,6 +1,11 @@
 ﻿package database
 
 import (
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/constants"
+
 	"gorm.io/gorm"
 )
 
@@ -30,6 +35,16 @@ func (r *AlertRepo) List(filter AlertFilter) ([]Alert, int64, error) {
 	if filter.Risk != "" {
 		q = q.Where("risk = ?", filter.Risk)
 	}
+	if filter.GatewayID != nil {
+		q = q.Where("gateway_id = ?", *filter.GatewayID)
+	}
+	switch filter.Status {
+	case "":
+	case "active":
+		q = q.Where("status <> ?", constants.AlertStatusResolved)
+	default:
+		q = q.Where("status IN ?", strings.Split(filter.Status, ","))
+	}
 	if filter.StartTime != "" {
 		q = q.Where("created_at >= ?", filter.StartTime)
 	}
@@ -66,6 +81,60 @@ func (r *AlertRepo) GetByAlertID(alertID string) (*Alert, error) {
 	return &alert, nil
 }
 
+func (r *AlertRepo) GetByID(id uint) (*Alert, error) {
+	var alert Alert
+	if err := r.db.First(&alert, id).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// FindActiveByDedupKey returns the newest unresolved alert with the given dedup key.
+func (r *AlertRepo) FindActiveByDedupKey(key string) (*Alert, error) {
+	var alert Alert
+	err := r.db.Where("dedup_key = ? AND status <> ?", key, constants.AlertStatusResolved).
+		Order("id desc").First(&alert).Error
+	if err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// ListActiveByDedupPrefix returns unresolved alerts whose dedup key starts with prefix.
+func (r *AlertRepo) ListActiveByDedupPrefix(prefix string) ([]Alert, error) {
+	var alerts []Alert
+	err := r.db.Where("dedup_key LIKE ? AND status <> ?", prefix+"%", constants.AlertStatusResolved).Find(&alerts).Error
+	return alerts, err
+}
+
+// ListActiveResolvable returns unresolved alerts that carry auto-resolve conditions.
+func (r *AlertRepo) ListActiveResolvable() ([]Alert, error) {
+	var alerts []Alert
+	err := r.db.Where("resolve_on <> '' AND status <> ?", constants.AlertStatusResolved).Find(&alerts).Error
+	return alerts, err
+}
+
+// ListDueEscalation returns open alerts whose escalation deadline has passed.
+func (r *AlertRepo) ListDueEscalation(now time.Time) ([]Alert, error) {
+	var alerts []Alert
+	err := r.db.Where("status = ? AND escalated_at IS NULL AND escalate_at IS NOT NULL AND escalate_at <= ?", constants.AlertStatusOpen, now).
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// ListExpiredSilences returns silenced alerts whose silence window has ended.
+func (r *AlertRepo) ListExpiredSilences(now time.Time) ([]Alert, error) {
+	var alerts []Alert
+	err := r.db.Where("status = ? AND silenced_until IS NOT NULL AND silenced_until <= ?", constants.AlertStatusSilenced, now).
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// Save persists all fields of an existing alert.
+func (r *AlertRepo) Save(alert *Alert) error {
+	return r.db.Save(alert).Error
+}
+
 func (r *AlertRepo) MarkNotified(id uint) error {
 	return r.db.Model(&Alert{}).Where("id = ?", id).Update("notified", true).Error
 }
@@ -80,12 +149,44 @@ func (r *AlertRepo) CountUnread() (int64, error) {
 	return count, err
 }
 
+// CountByStatus returns the number of alerts per lifecycle state.
+func (r *AlertRepo) CountByStatus() (map[string]int64, error) {
+	rows, err := r.CountByStatusAndRisk()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64)
+	for _, row := range rows {
+		counts[row.Status] += row.Count
+	}
+	return counts, nil
+}
+
+// StatusRiskCount is one row of AlertRepo.CountByStatusAndRisk.
+type StatusRiskCount struct {
+	Status string
+	Risk   string
+	Count  int64
+}
+
+// CountByStatusAndRisk returns alert counts grouped by lifecycle state and risk.
+func (r *AlertRepo) CountByStatusAndRisk() ([]StatusRiskCount, error) {
+	var results []StatusRiskCount
+	err := r.db.Model(&Alert{}).
+		Select("status, risk, count(*) as count").
+		Group("status, risk").
+		Find(&results).Error
+	return results, err
+}
+
 type AlertFilter struct {
 	Page      int
 	PageSize  int
 	SortBy    string
 	SortOrder string
 	Risk      string
+	Status    string // comma-separated states, or "active" for everything not resolved
+	GatewayID *uint  // nil = all gateways
 	StartTime string
 	EndTime   string
 }
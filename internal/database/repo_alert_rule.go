@@ -0,0 +1,52 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// AlertRuleRepo manages user-defined alert rules.
+type AlertRuleRepo struct {
+	db *gorm.DB
+}
+
+func NewAlertRuleRepo() *AlertRuleRepo {
+	return &AlertRuleRepo{db: DB}
+}
+
+// List returns all alert rules ordered by creation time.
+func (r *AlertRuleRepo) List() ([]AlertRule, error) {
+	var rules []AlertRule
+	err := r.db.Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// ListEnabled returns only enabled alert rules.
+func (r *AlertRuleRepo) ListEnabled() ([]AlertRule, error) {
+	var rules []AlertRule
+	err := r.db.Where("enabled = ?", true).Order("id asc").Find(&rules).Error
+	return rules, err
+}
+
+// GetByID returns a single alert rule by its primary key.
+func (r *AlertRuleRepo) GetByID(id uint) (*AlertRule, error) {
+	var rule AlertRule
+	if err := r.db.First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Create inserts a new alert rule.
+func (r *AlertRuleRepo) Create(rule *AlertRule) error {
+	return r.db.Create(rule).Error
+}
+
+// Update saves changes to an existing alert rule.
+func (r *AlertRuleRepo) Update(rule *AlertRule) error {
+	return r.db.Save(rule).Error
+}
+
+// Delete removes an alert rule by primary key.
+func (r *AlertRuleRepo) Delete(id uint) error {
+	return r.db.Delete(&AlertRule{}, id).Error
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenRepo manages personal access tokens.
+type APITokenRepo struct {
+	db *gorm.DB
+}
+
+func NewAPITokenRepo() *APITokenRepo {
+	return &APITokenRepo{db: DB}
+}
+
+// Create inserts a new token.
+func (r *APITokenRepo) Create(t *APIToken) error {
+	return r.db.Create(t).Error
+}
+
+// ListByUser returns a user's tokens, newest first, including revoked ones.
+func (r *APITokenRepo) ListByUser(userID uint) ([]APIToken, error) {
+	var list []APIToken
+	err := r.db.Where("user_id = ?", userID).Order("id desc").Find(&list).Error
+	return list, err
+}
+
+// GetByID returns a single token by its primary key.
+func (r *APITokenRepo) GetByID(id uint) (*APIToken, error) {
+	var t APIToken
+	if err := r.db.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// FindByHash returns the token whose secret hashes to hash.
+func (r *APITokenRepo) FindByHash(hash string) (*APIToken, error) {
+	var t APIToken
+	if err := r.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Revoke marks a token as revoked; revoked tokens are kept for the audit trail.
+func (r *APITokenRepo) Revoke(id uint, at time.Time) error {
+	return r.db.Model(&APIToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", at).Error
+}
+
+// RevokeByUser revokes every active token of a user.
+func (r *APITokenRepo) RevokeByUser(userID uint, at time.Time) error {
+	return r.db.Model(&APIToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", at).Error
+}
+
+// Touch records when and from where a token was last used.
+func (r *APITokenRepo) Touch(id uint, at time.Time, ip string) error {
+	return r.db.Model(&APIToken{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_used_at": at,
+		"last_used_ip": ip,
+	}).Error
+}
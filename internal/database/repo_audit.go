@@ -1,6 +1,9 @@
 ﻿package database
 
 import (
+	"sync"
+	"time"
+
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
 
@@ -15,8 +18,44 @@ func NewAuditLogRepo() *AuditLogRepo {
 	return &AuditLogRepo{db: DB}
 }
 
+// auditChainMu serializes appends so every row links to the latest one.
+var auditChainMu sync.Mutex
+
+// auditChainLockKey names the Postgres advisory lock held while appending,
+// which serializes appends across processes, such as the CLI commands that
+// write while the server runs.
+const auditChainLockKey int64 = 0x61756469746c6f67 // "auditlog"
+
+// lockAuditChain takes the chain lock for the rest of tx. SQLite needs none:
+// a transaction whose read of the head went stale fails to write instead.
+func lockAuditChain(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockKey).Error
+}
+
+// Create appends log to the hash chain.
 func (r *AuditLogRepo) Create(log *AuditLog) error {
-	if err := r.db.Create(log).Error; err != nil {
+	auditChainMu.Lock()
+	defer auditChainMu.Unlock()
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+	log.CreatedAt = log.CreatedAt.UTC().Truncate(time.Microsecond)
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockAuditChain(tx); err != nil {
+			return err
+		}
+		var head AuditLog
+		if err := tx.Select("id", "hash").Order("id desc").Limit(1).Find(&head).Error; err != nil {
+			return err
+		}
+		log.PrevHash = head.Hash
+		log.Hash = AuditHash(log.PrevHash, log)
+		return tx.Create(log).Error
+	})
+	if err != nil {
 		logger.Audit.Error().Err(err).Str("action", log.Action).Msg(i18n.T(i18n.MsgLogAuditWriteFailed))
 		return err
 	}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GatewayAvailabilityRepo stores daily gateway availability rollups.
+type GatewayAvailabilityRepo struct {
+	db *gorm.DB
+}
+
+func NewGatewayAvailabilityRepo() *GatewayAvailabilityRepo {
+	return &GatewayAvailabilityRepo{db: DB}
+}
+
+// Upsert saves a rollup, replacing an existing one for the same gateway and day.
+func (r *GatewayAvailabilityRepo) Upsert(day *GatewayAvailabilityDaily) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "gateway_id"}, {Name: "day"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"up_sec", "down_sec", "maintenance_sec", "unknown_sec", "incidents",
+			"repaired", "repair_sec", "longest_outage_sec", "end_state",
+		}),
+	}).Create(day).Error
+}
+
+// List returns one gateway's rollups for days in [from, to], oldest first.
+func (r *GatewayAvailabilityRepo) List(gatewayID uint, from, to time.Time) ([]GatewayAvailabilityDaily, error) {
+	var days []GatewayAvailabilityDaily
+	err := r.db.Where("gateway_id = ? AND day >= ? AND day <= ?", gatewayID, from, to).
+		Order("day asc").Find(&days).Error
+	return days, err
+}
+
+// Last returns one gateway's most recent rollup.
+func (r *GatewayAvailabilityRepo) Last(gatewayID uint) (*GatewayAvailabilityDaily, error) {
+	var day GatewayAvailabilityDaily
+	if err := r.db.Where("gateway_id = ?", gatewayID).Order("day desc").First(&day).Error; err != nil {
+		return nil, err
+	}
+	return &day, nil
+}
+
+// LastBefore returns one gateway's latest rollup for a day before t.
+func (r *GatewayAvailabilityRepo) LastBefore(gatewayID uint, t time.Time) (*GatewayAvailabilityDaily, error) {
+	var day GatewayAvailabilityDaily
+	if err := r.db.Where("gateway_id = ? AND day < ?", gatewayID, t).Order("day desc").First(&day).Error; err != nil {
+		return nil, err
+	}
+	return &day, nil
+}
+
+// GatewayIDs returns the IDs of all gateways with rollups.
+func (r *GatewayAvailabilityRepo) GatewayIDs() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&GatewayAvailabilityDaily{}).Distinct("gateway_id").Order("gateway_id asc").Pluck("gateway_id", &ids).Error
+	return ids, err
+}
+
+// GatewaySLORepo manages availability targets.
+type GatewaySLORepo struct {
+	db *gorm.DB
+}
+
+func NewGatewaySLORepo() *GatewaySLORepo {
+	return &GatewaySLORepo{db: DB}
+}
+
+func (r *GatewaySLORepo) List() ([]GatewaySLO, error) {
+	var slos []GatewaySLO
+	err := r.db.Order("id asc").Find(&slos).Error
+	return slos, err
+}
+
+func (r *GatewaySLORepo) GetByID(id uint) (*GatewaySLO, error) {
+	var slo GatewaySLO
+	if err := r.db.First(&slo, id).Error; err != nil {
+		return nil, err
+	}
+	return &slo, nil
+}
+
+func (r *GatewaySLORepo) Create(slo *GatewaySLO) error {
+	return r.db.Create(slo).Error
+}
+
+func (r *GatewaySLORepo) Update(slo *GatewaySLO) error {
+	return r.db.Save(slo).Error
+}
+
+func (r *GatewaySLORepo) Delete(id uint) error {
+	return r.db.Delete(&GatewaySLO{}, id).Error
+}
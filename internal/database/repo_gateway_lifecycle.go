@@ -38,6 +38,9 @@ func (r *GatewayLifecycleRepo) List(filter GatewayLifecycleFilter) ([]GatewayLif
 	if filter.GatewayHost != "" {
 		q = q.Where("gateway_host = ?", filter.GatewayHost)
 	}
+	if filter.GatewayID != nil {
+		q = q.Where("gateway_id = ?", *filter.GatewayID)
+	}
 	if filter.Since != "" {
 		q = q.Where("timestamp >= ?", filter.Since)
 	}
@@ -77,6 +80,58 @@ func (r *GatewayLifecycleRepo) LastStarted() (*GatewayLifecycle, error) {
 	return &record, nil
 }
 
+// ListRange returns lifecycle records with timestamps in [since, until], oldest first.
+// At most limit rows are returned.
+func (r *GatewayLifecycleRepo) ListRange(since, until time.Time, limit int) ([]GatewayLifecycle, error) {
+	var records []GatewayLifecycle
+	err := r.db.Where("timestamp >= ? AND timestamp <= ?", since, until).
+		Order("timestamp asc").
+		Limit(limit).
+		Find(&records).Error
+	return records, err
+}
+
+// stateEventTypes are the event types that change a gateway's state;
+// remediation entries only annotate the timeline.
+var stateEventTypes = []string{"started", "shutdown", "crashed", "unreachable", "recovered"}
+
+// ListStates returns one gateway's state-changing records with timestamps in
+// [since, until], oldest first.
+func (r *GatewayLifecycleRepo) ListStates(gatewayID uint, since, until time.Time) ([]GatewayLifecycle, error) {
+	var records []GatewayLifecycle
+	err := r.db.Where("gateway_id = ? AND event_type IN ? AND timestamp >= ? AND timestamp <= ?",
+		gatewayID, stateEventTypes, since, until).
+		Order("timestamp asc, id asc").
+		Find(&records).Error
+	return records, err
+}
+
+// LastStateBefore returns one gateway's latest state-changing record before t.
+func (r *GatewayLifecycleRepo) LastStateBefore(gatewayID uint, t time.Time) (*GatewayLifecycle, error) {
+	var record GatewayLifecycle
+	err := r.db.Where("gateway_id = ? AND event_type IN ? AND timestamp < ?", gatewayID, stateEventTypes, t).
+		Order("timestamp desc, id desc").First(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FirstStateAt returns the timestamp of one gateway's oldest state-changing record.
+func (r *GatewayLifecycleRepo) FirstStateAt(gatewayID uint) (time.Time, error) {
+	var record GatewayLifecycle
+	err := r.db.Where("gateway_id = ? AND event_type IN ?", gatewayID, stateEventTypes).
+		Order("timestamp asc, id asc").First(&record).Error
+	return record.Timestamp, err
+}
+
+// GatewayIDs returns the IDs of all gateways with lifecycle records.
+func (r *GatewayLifecycleRepo) GatewayIDs() ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&GatewayLifecycle{}).Distinct("gateway_id").Order("gateway_id asc").Pluck("gateway_id", &ids).Error
+	return ids, err
+}
+
 // Cleanup removes records older than the given duration, keeping at most maxKeep records.
 func (r *GatewayLifecycleRepo) Cleanup(olderThan time.Duration, maxKeep int) error {
 	cutoff := time.Now().Add(-olderThan)
@@ -94,6 +149,7 @@ type GatewayLifecycleFilter struct {
 	PageSize    int
 	EventType   string
 	GatewayHost string
+	GatewayID   *uint // nil = all gateways
 	Since       string
 	Until       string
 }
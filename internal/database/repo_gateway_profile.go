@@ -13,6 +13,7 @@ type GatewayProfile struct {
 	Port      int            `gorm:"not null;default:18789" json:"port"`
 	Token     string         `gorm:"size:512" json:"token"`
 	IsActive  bool           `gorm:"default:false" json:"is_active"`
+	Enabled   bool           `gorm:"default:false" json:"enabled"` // keep a fleet connection open while not active
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -41,6 +42,22 @@ func (r *GatewayProfileRepo) List() ([]GatewayProfile, error) {
 	return list, nil
 }
 
+// ListEnabled returns profiles that take part in fleet mode.
+func (r *GatewayProfileRepo) ListEnabled() ([]GatewayProfile, error) {
+	var list []GatewayProfile
+	if err := r.db.Where("enabled = ?", true).Order("id asc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for i := range list {
+		token, err := decryptStoredValue(list[i].Token)
+		if err != nil {
+			return nil, err
+		}
+		list[i].Token = token
+	}
+	return list, nil
+}
+
 func (r *GatewayProfileRepo) GetByID(id uint) (*GatewayProfile, error) {
 	var p GatewayProfile
 	if err := r.db.First(&p, id).Error; err != nil {
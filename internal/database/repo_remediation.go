@@ -0,0 +1,136 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RemediationPolicyRepo manages gateway remediation policies.
+type RemediationPolicyRepo struct {
+	db *gorm.DB
+}
+
+func NewRemediationPolicyRepo() *RemediationPolicyRepo {
+	return &RemediationPolicyRepo{db: DB}
+}
+
+// List returns all policies ordered by creation time.
+func (r *RemediationPolicyRepo) List() ([]RemediationPolicy, error) {
+	var policies []RemediationPolicy
+	err := r.db.Order("id asc").Find(&policies).Error
+	return policies, err
+}
+
+// ListEnabled returns only enabled policies.
+func (r *RemediationPolicyRepo) ListEnabled() ([]RemediationPolicy, error) {
+	var policies []RemediationPolicy
+	err := r.db.Where("enabled = ?", true).Order("id asc").Find(&policies).Error
+	return policies, err
+}
+
+// GetByID returns a single policy by its primary key.
+func (r *RemediationPolicyRepo) GetByID(id uint) (*RemediationPolicy, error) {
+	var policy RemediationPolicy
+	if err := r.db.First(&policy, id).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Create inserts a new policy.
+func (r *RemediationPolicyRepo) Create(policy *RemediationPolicy) error {
+	return r.db.Create(policy).Error
+}
+
+// Update saves changes to an existing policy.
+func (r *RemediationPolicyRepo) Update(policy *RemediationPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+// Delete removes a policy by primary key. Its runs are kept.
+func (r *RemediationPolicyRepo) Delete(id uint) error {
+	return r.db.Delete(&RemediationPolicy{}, id).Error
+}
+
+// RemediationRunRepo records remediation runs.
+type RemediationRunRepo struct {
+	db *gorm.DB
+}
+
+func NewRemediationRunRepo() *RemediationRunRepo {
+	return &RemediationRunRepo{db: DB}
+}
+
+type RemediationRunFilter struct {
+	Page      int
+	PageSize  int
+	PolicyID  uint  // 0 = all policies
+	GatewayID *uint // nil = all gateways
+	Status    string
+}
+
+func (f *RemediationRunFilter) Offset() int {
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 {
+		f.PageSize = 20
+	}
+	return (f.Page - 1) * f.PageSize
+}
+
+func (r *RemediationRunRepo) Create(run *RemediationRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r *RemediationRunRepo) Update(run *RemediationRun) error {
+	return r.db.Save(run).Error
+}
+
+// GetByID returns a single run by its primary key.
+func (r *RemediationRunRepo) GetByID(id uint) (*RemediationRun, error) {
+	var run RemediationRun
+	if err := r.db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// List returns runs newest first.
+func (r *RemediationRunRepo) List(filter RemediationRunFilter) ([]RemediationRun, int64, error) {
+	q := r.db.Model(&RemediationRun{})
+	if filter.PolicyID != 0 {
+		q = q.Where("policy_id = ?", filter.PolicyID)
+	}
+	if filter.GatewayID != nil {
+		q = q.Where("gateway_id = ?", *filter.GatewayID)
+	}
+	if filter.Status != "" {
+		q = q.Where("status = ?", filter.Status)
+	}
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	offset := filter.Offset()
+	var runs []RemediationRun
+	err := q.Order("started_at desc, id desc").
+		Offset(offset).
+		Limit(filter.PageSize).
+		Find(&runs).Error
+	return runs, total, err
+}
+
+// MarkInterrupted fails runs left "running" by a previous process.
+func (r *RemediationRunRepo) MarkInterrupted() error {
+	now := time.Now().UTC()
+	return r.db.Model(&RemediationRun{}).Where("status = ?", "running").
+		Updates(map[string]interface{}{"status": "failed", "error": "interrupted by shutdown", "finished_at": now}).Error
+}
+
+// Cleanup deletes runs started before olderThan.
+func (r *RemediationRunRepo) Cleanup(olderThan time.Duration) error {
+	cutoff := time.Now().UTC().Add(-olderThan)
+	return r.db.Where("started_at < ?", cutoff).Delete(&RemediationRun{}).Error
+}
@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RetentionTable is a table pruned by the retention job. Expired rows are
+// handed out as JSON of the model, the same form Restore reads back.
+type RetentionTable struct {
+	Table     string // also names its settings and archive directory
+	TimeCol   string
+	TimeField string // Go field of TimeCol
+	Keep      string // SQL condition of rows never pruned, "" = none
+	Chain     bool   // audit hash chain: only a prefix can go, behind a checkpoint
+	newSlice  func() interface{}
+}
+
+// RetentionTables lists the tables the retention job manages.
+var RetentionTables = []RetentionTable{
+	{Table: "activities", TimeCol: "timestamp", TimeField: "Timestamp",
+		newSlice: func() interface{} { return &[]Activity{} }},
+	{Table: "alerts", TimeCol: "created_at", TimeField: "CreatedAt", Keep: "status IN ('open', 'acknowledged', 'silenced')",
+		newSlice: func() interface{} { return &[]Alert{} }},
+	{Table: "audit_logs", TimeCol: "created_at", TimeField: "CreatedAt", Chain: true,
+		newSlice: func() interface{} { return &[]AuditLog{} }},
+	{Table: "connection_logs", TimeCol: "created_at", TimeField: "CreatedAt",
+		newSlice: func() interface{} { return &[]ConnectionLog{} }},
+}
+
+// FindRetentionTable returns the retention table named name, or nil.
+func FindRetentionTable(name string) *RetentionTable {
+	for i := range RetentionTables {
+		if RetentionTables[i].Table == name {
+			return &RetentionTables[i]
+		}
+	}
+	return nil
+}
+
+// ExpiredRow is a row due for archival.
+type ExpiredRow struct {
+	ID   uint
+	Time time.Time
+	Data json.RawMessage
+}
+
+type RetentionRepo struct {
+	db *gorm.DB
+}
+
+func NewRetentionRepo() *RetentionRepo {
+	return &RetentionRepo{db: DB}
+}
+
+func (r *RetentionRepo) prunable(t *RetentionTable) *gorm.DB {
+	q := r.db.Table(t.Table)
+	if t.Keep != "" {
+		q = q.Where("NOT (" + t.Keep + ")")
+	}
+	return q
+}
+
+// Boundary returns the highest ID of the rows beyond the maxRows newest
+// (0 when maxRows is 0 or not exceeded). For a chain table, which can only
+// lose a prefix, it also covers the rows older than cutoff when not zero.
+func (r *RetentionRepo) Boundary(t *RetentionTable, cutoff time.Time, maxRows int) (uint, error) {
+	var boundary uint
+	if maxRows > 0 {
+		var ids []uint
+		if err := r.prunable(t).Order("id desc").Offset(maxRows).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return 0, err
+		}
+		if len(ids) > 0 {
+			boundary = ids[0]
+		}
+	}
+	if t.Chain && !cutoff.IsZero() {
+		var id *uint
+		if err := r.prunable(t).Where(t.TimeCol+" < ?", cutoff).Select("max(id)").Scan(&id).Error; err != nil {
+			return 0, err
+		}
+		if id != nil && *id > boundary {
+			boundary = *id
+		}
+	}
+	return boundary, nil
+}
+
+// Expired returns, in ID order, up to limit due rows after afterID: rows up
+// to boundary (see Boundary) and, except for chain tables, rows older than
+// cutoff.
+func (r *RetentionRepo) Expired(t *RetentionTable, cutoff time.Time, boundary, afterID uint, limit int) ([]ExpiredRow, error) {
+	q := r.prunable(t).Where("id > ?", afterID)
+	if t.Chain || cutoff.IsZero() {
+		q = q.Where("id <= ?", boundary)
+	} else {
+		q = q.Where("(id <= ? OR "+t.TimeCol+" < ?)", boundary, cutoff)
+	}
+	dest := t.newSlice()
+	if err := q.Order("id asc").Limit(limit).Find(dest).Error; err != nil {
+		return nil, err
+	}
+	list := reflect.ValueOf(dest).Elem()
+	rows := make([]ExpiredRow, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		item := list.Index(i)
+		data, err := json.Marshal(item.Interface())
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, ExpiredRow{
+			ID:   uint(item.FieldByName("ID").Uint()),
+			Time: item.FieldByName(t.TimeField).Interface().(time.Time),
+			Data: data,
+		})
+	}
+	return rows, nil
+}
+
+// Delete removes rows by ID. Chain tables go through AuditLogRepo.ArchiveThrough.
+func (r *RetentionRepo) Delete(t *RetentionTable, ids []uint) error {
+	if t.Chain {
+		return fmt.Errorf("%s rows are removed with ArchiveThrough", t.Table)
+	}
+	return r.db.Exec("DELETE FROM "+t.Table+" WHERE id IN ?", ids).Error
+}
+
+// Restore inserts archived rows (JSON of the model) and returns how many were
+// new; rows whose ID still exists are skipped.
+func (r *RetentionRepo) Restore(t *RetentionTable, rows []json.RawMessage) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	dest := t.newSlice()
+	list := reflect.ValueOf(dest).Elem()
+	for _, data := range rows {
+		item := reflect.New(list.Type().Elem())
+		if err := json.Unmarshal(data, item.Interface()); err != nil {
+			return 0, err
+		}
+		list = reflect.Append(list, item.Elem())
+	}
+	reflect.ValueOf(dest).Elem().Set(list)
+	res := r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(dest, 200)
+	return res.RowsAffected, res.Error
+}
+
+// TableSize is one table of a size report. Bytes is 0 when the database
+// cannot report it.
+type TableSize struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SizeReport describes the database's disk use.
+type SizeReport struct {
+	Driver    string      `json:"driver"`
+	Bytes     int64       `json:"bytes"`
+	FreeBytes int64       `json:"free_bytes"` // reclaimable by compaction (SQLite)
+	AutoVac   string      `json:"auto_vacuum,omitempty"`
+	Tables    []TableSize `json:"tables"`
+}
+
+// Size reports the database and per-table size, largest tables first.
+func (r *RetentionRepo) Size() (*SizeReport, error) {
+	rep := &SizeReport{Driver: r.db.Dialector.Name()}
+	switch rep.Driver {
+	case "sqlite":
+		var pageSize, pages, free, autoVac int64
+		for _, p := range []struct {
+			pragma string
+			dst    *int64
+		}{{"page_size", &pageSize}, {"page_count", &pages}, {"freelist_count", &free}, {"auto_vacuum", &autoVac}} {
+			if err := r.db.Raw("PRAGMA " + p.pragma).Scan(p.dst).Error; err != nil {
+				return nil, err
+			}
+		}
+		rep.Bytes, rep.FreeBytes = pages*pageSize, free*pageSize
+		rep.AutoVac = map[int64]string{0: "none", 1: "full", 2: "incremental"}[autoVac]
+
+		var names []string
+		if err := r.db.Raw(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+			AND sql NOT LIKE 'CREATE VIRTUAL TABLE%' AND name NOT GLOB '*_fts_*' ORDER BY name`).Scan(&names).Error; err != nil {
+			return nil, err
+		}
+		// dbstat is optional; without it only row counts are reported.
+		bytes := map[string]int64{}
+		var stats []struct {
+			Name  string
+			Bytes int64
+		}
+		if r.db.Raw("SELECT name, sum(pgsize) AS bytes FROM dbstat GROUP BY name").Scan(&stats).Error == nil {
+			for _, s := range stats {
+				bytes[s.Name] = s.Bytes
+			}
+		}
+		for _, name := range names {
+			ts := TableSize{Table: name, Bytes: bytes[name] + bytes[name+"_fts_data"]}
+			if err := r.db.Table(name).Count(&ts.Rows).Error; err != nil {
+				return nil, err
+			}
+			rep.Tables = append(rep.Tables, ts)
+		}
+	case "postgres":
+		if err := r.db.Raw("SELECT pg_database_size(current_database())").Scan(&rep.Bytes).Error; err != nil {
+			return nil, err
+		}
+		if err := r.db.Raw(`SELECT relname AS "table", n_live_tup AS rows, pg_total_relation_size(relid) AS bytes
+			FROM pg_stat_user_tables`).Scan(&rep.Tables).Error; err != nil {
+			return nil, err
+		}
+	}
+	sortTableSizes(rep.Tables)
+	return rep, nil
+}
+
+func sortTableSizes(tables []TableSize) {
+	sort.Slice(tables, func(i, j int) bool {
+		if tables[i].Bytes != tables[j].Bytes {
+			return tables[i].Bytes > tables[j].Bytes
+		}
+		return tables[i].Rows > tables[j].Rows
+	})
+}
+
+// Compact reclaims free space. The light form runs online: SQLite merges the
+// search index segments, returns free pages when auto_vacuum is incremental
+// and truncates the WAL; Postgres runs VACUUM ANALYZE. full runs VACUUM,
+// which rewrites the database and blocks writers meanwhile; on SQLite it also
+// switches to incremental auto-vacuum so later light runs can free pages.
+func (r *RetentionRepo) Compact(ctx context.Context, full bool) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	// auto_vacuum only takes effect through a VACUUM on the same connection.
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var stmts []string
+	switch r.db.Dialector.Name() {
+	case "sqlite":
+		for _, s := range SearchSources {
+			stmts = append(stmts, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('optimize')", s.FTSTable(), s.FTSTable()))
+		}
+		if full {
+			stmts = append(stmts, "PRAGMA auto_vacuum = INCREMENTAL", "VACUUM")
+		} else {
+			stmts = append(stmts, "PRAGMA incremental_vacuum")
+		}
+		stmts = append(stmts, "PRAGMA optimize", "PRAGMA wal_checkpoint(TRUNCATE)")
+	case "postgres":
+		if full {
+			stmts = append(stmts, "VACUUM (FULL, ANALYZE)")
+		} else {
+			stmts = append(stmts, "VACUUM (ANALYZE)")
+		}
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"gorm.io/gorm"
+)
+
+// RoleRepo manages custom roles.
+type RoleRepo struct {
+	db *gorm.DB
+}
+
+func NewRoleRepo() *RoleRepo {
+	return &RoleRepo{db: DB}
+}
+
+// List returns all custom roles ordered by creation time.
+func (r *RoleRepo) List() ([]Role, error) {
+	var roles []Role
+	err := r.db.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+// GetByID returns a single role by its primary key.
+func (r *RoleRepo) GetByID(id uint) (*Role, error) {
+	var role Role
+	if err := r.db.First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// FindByName returns a role by its unique name.
+func (r *RoleRepo) FindByName(name string) (*Role, error) {
+	var role Role
+	if err := r.db.Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create inserts a new role.
+func (r *RoleRepo) Create(role *Role) error {
+	return r.db.Create(role).Error
+}
+
+// Update saves changes to an existing role.
+func (r *RoleRepo) Update(role *Role) error {
+	return r.db.Save(role).Error
+}
+
+// Delete removes a role by primary key.
+func (r *RoleRepo) Delete(id uint) error {
+	return r.db.Delete(&Role{}, id).Error
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Search highlights wrap matched words in these private-use characters so
+// callers can escape the text before marking them up.
+const (
+	SearchMarkStart = "\uE000"
+	SearchMarkEnd   = "\uE001"
+)
+
+// SearchFilter restricts a column of a search source. A string Value
+// containing * is matched as a wildcard pattern.
+type SearchFilter struct {
+	Column string
+	Value  interface{}
+	Negate bool
+}
+
+// SearchQuery is a search run against one source.
+type SearchQuery struct {
+	Match   string // SQLite FTS5 MATCH expression; "" = no text condition
+	TSQuery string // Postgres tsquery SQL expression over TSArgs; "" = no text condition
+	TSArgs  []interface{}
+	Filters []SearchFilter
+	Since   *time.Time
+	Until   *time.Time
+	ByTime  bool // newest first instead of best match first
+	Limit   int
+}
+
+// SearchRow is one hit. Snippet carries SearchMarkStart/End around matches;
+// a higher Score is a better match.
+type SearchRow struct {
+	ID        uint
+	Timestamp time.Time
+	Title     string
+	Snippet   string
+	Score     float64
+	Fields    map[string]string
+}
+
+type SearchRepo struct {
+	db *gorm.DB
+}
+
+func NewSearchRepo() *SearchRepo {
+	return &SearchRepo{db: DB}
+}
+
+// Dialect returns the database dialect, which decides the query form used.
+func (r *SearchRepo) Dialect() string {
+	return r.db.Dialector.Name()
+}
+
+// Search returns the best (or newest) q.Limit hits of src and the total
+// number of matches.
+func (r *SearchRepo) Search(src *SearchSource, q *SearchQuery) ([]SearchRow, int64, error) {
+	var (
+		from, score, snippet string
+		where                []string
+		selArgs, whereArgs   []interface{}
+	)
+	switch {
+	case r.Dialect() == "postgres" && q.TSQuery != "":
+		from = src.Table + " t"
+		snippet = fmt.Sprintf("ts_headline('simple', %s, %s, ?)", src.Text("t."), q.TSQuery)
+		score = fmt.Sprintf("ts_rank(%s, %s)", src.Document("t."), q.TSQuery)
+		selArgs = append(append(selArgs, q.TSArgs...), fmt.Sprintf(
+			"StartSel=%s, StopSel=%s, MaxWords=24, MinWords=8, MaxFragments=2, FragmentDelimiter=\" … \"",
+			SearchMarkStart, SearchMarkEnd))
+		selArgs = append(selArgs, q.TSArgs...)
+		where = append(where, fmt.Sprintf("%s @@ %s", src.Document("t."), q.TSQuery))
+		whereArgs = append(whereArgs, q.TSArgs...)
+	case r.Dialect() == "sqlite" && q.Match != "":
+		fts := src.FTSTable()
+		from = fmt.Sprintf("%s JOIN %s t ON t.id = %s.rowid", fts, src.Table, fts)
+		snippet = fmt.Sprintf("snippet(%s, -1, ?, ?, ' … ', 24)", fts)
+		score = fmt.Sprintf("-bm25(%s)", fts)
+		selArgs = append(selArgs, SearchMarkStart, SearchMarkEnd)
+		where = append(where, fts+" MATCH ?")
+		whereArgs = append(whereArgs, q.Match)
+	default:
+		from = src.Table + " t"
+		snippet = fmt.Sprintf("substr(%s, 1, 200)", src.Text("t."))
+		score = "0"
+	}
+
+	for _, f := range q.Filters {
+		op := "="
+		value := f.Value
+		if s, ok := value.(string); ok && strings.Contains(s, "*") {
+			op = "LIKE"
+			value = strings.ReplaceAll(s, "*", "%")
+		}
+		if f.Negate {
+			if op == "=" {
+				op = "<>"
+			} else {
+				op = "NOT LIKE"
+			}
+		}
+		where = append(where, fmt.Sprintf("t.%s %s ?", f.Column, op))
+		whereArgs = append(whereArgs, value)
+	}
+	if q.Since != nil {
+		where = append(where, fmt.Sprintf("t.%s >= ?", src.TimeCol))
+		whereArgs = append(whereArgs, *q.Since)
+	}
+	if q.Until != nil {
+		where = append(where, fmt.Sprintf("t.%s < ?", src.TimeCol))
+		whereArgs = append(whereArgs, *q.Until)
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	if err := r.db.Raw("SELECT count(*) FROM "+from+cond, whereArgs...).Scan(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || q.Limit <= 0 {
+		return nil, total, nil
+	}
+
+	fieldNames := make([]string, 0, len(src.Fields))
+	cols := []string{"t.id", "t." + src.TimeCol, "t." + src.Title, snippet, score + " AS score"}
+	for name, col := range src.Fields {
+		fieldNames = append(fieldNames, name)
+		cols = append(cols, "t."+col)
+	}
+	order := "score DESC, t." + src.TimeCol + " DESC"
+	if q.ByTime || score == "0" {
+		order = "t." + src.TimeCol + " DESC, t.id DESC"
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT %d", strings.Join(cols, ", "), from, cond, order, q.Limit)
+
+	rows, err := r.db.Raw(stmt, append(selArgs, whereArgs...)...).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var out []SearchRow
+	for rows.Next() {
+		var (
+			row         SearchRow
+			title, snip sql.NullString
+			fields      = make([]sql.NullString, len(fieldNames))
+			dest        = []interface{}{&row.ID, &row.Timestamp, &title, &snip, &row.Score}
+		)
+		for i := range fields {
+			dest = append(dest, &fields[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		row.Title, row.Snippet = title.String, snip.String
+		row.Fields = make(map[string]string, len(fieldNames))
+		for i, name := range fieldNames {
+			row.Fields[name] = fields[i].String
+		}
+		out = append(out, row)
+	}
+	return out, total, rows.Err()
+}
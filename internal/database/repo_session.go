@@ -0,0 +1,109 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SessionRepo manages server-side login sessions.
+type SessionRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionRepo() *SessionRepo {
+	return &SessionRepo{db: DB}
+}
+
+// Create inserts a new session.
+func (r *SessionRepo) Create(s *Session) error {
+	return r.db.Create(s).Error
+}
+
+// GetByID returns a session by its primary key.
+func (r *SessionRepo) GetByID(id uint) (*Session, error) {
+	var s Session
+	if err := r.db.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FindBySessionID returns the session carried in a JWT.
+func (r *SessionRepo) FindBySessionID(sessionID string) (*Session, error) {
+	var s Session
+	if err := r.db.Where("session_id = ?", sessionID).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListActive returns unrevoked, unexpired sessions, most recently used first.
+// A zero userID lists sessions of all users.
+func (r *SessionRepo) ListActive(userID uint, now time.Time) ([]Session, error) {
+	q := r.db.Where("revoked_at IS NULL AND expires_at > ?", now)
+	if userID != 0 {
+		q = q.Where("user_id = ?", userID)
+	}
+	var list []Session
+	err := q.Order("last_seen_at desc").Find(&list).Error
+	return list, err
+}
+
+// Touch records activity on a session.
+func (r *SessionRepo) Touch(id uint, at time.Time, ip string) error {
+	return r.db.Model(&Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": at,
+		"ip":           ip,
+	}).Error
+}
+
+// Revoke ends a single session.
+func (r *SessionRepo) Revoke(id uint, at time.Time, reason string) error {
+	return r.db.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", id).Updates(map[string]interface{}{
+		"revoked_at":    at,
+		"revoke_reason": reason,
+	}).Error
+}
+
+// RevokeByUser ends every active session of a user except exceptSessionID
+// (may be empty) and returns the session IDs it revoked.
+func (r *SessionRepo) RevokeByUser(userID uint, exceptSessionID string, at time.Time, reason string) ([]string, error) {
+	q := r.db.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, at)
+	if exceptSessionID != "" {
+		q = q.Where("session_id <> ?", exceptSessionID)
+	}
+	var ids []string
+	if err := q.Pluck("session_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	err := r.db.Model(&Session{}).Where("session_id IN ?", ids).Updates(map[string]interface{}{
+		"revoked_at":    at,
+		"revoke_reason": reason,
+	}).Error
+	return ids, err
+}
+
+// RevokeIdle ends active sessions last seen before cutoff and returns their session IDs.
+func (r *SessionRepo) RevokeIdle(cutoff, at time.Time) ([]string, error) {
+	var ids []string
+	err := r.db.Model(&Session{}).Where("revoked_at IS NULL AND expires_at > ? AND last_seen_at < ?", at, cutoff).
+		Pluck("session_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	err = r.db.Model(&Session{}).Where("session_id IN ?", ids).Updates(map[string]interface{}{
+		"revoked_at":    at,
+		"revoke_reason": "idle_timeout",
+	}).Error
+	return ids, err
+}
+
+// DeleteExpired removes sessions that ended before cutoff.
+func (r *SessionRepo) DeleteExpired(cutoff time.Time) (int64, error) {
+	res := r.db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&Session{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,33 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SessionFileStateRepo stores session log ingestion positions.
+type SessionFileStateRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionFileStateRepo() *SessionFileStateRepo {
+	return &SessionFileStateRepo{db: DB}
+}
+
+func (r *SessionFileStateRepo) List() ([]SessionFileState, error) {
+	var states []SessionFileState
+	err := r.db.Order("path asc").Find(&states).Error
+	return states, err
+}
+
+// Upsert saves a state, replacing the one stored for the same path.
+func (r *SessionFileStateRepo) Upsert(state *SessionFileState) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "path"}},
+		DoUpdates: clause.AssignmentColumns([]string{"inode", "head_hash", "size", "mod_time", "read_offset", "updated_at"}),
+	}).Create(state).Error
+}
+
+func (r *SessionFileStateRepo) Delete(path string) error {
+	return r.db.Where("path = ?", path).Delete(&SessionFileState{}).Error
+}
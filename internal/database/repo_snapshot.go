@@ -1,6 +1,10 @@
 package database
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type SnapshotRepo struct {
 	db *gorm.DB
@@ -26,6 +30,36 @@ func (r *SnapshotRepo) ListByTrigger(trigger string) ([]SnapshotRecord, error) {
 	return records, err
 }
 
+// ListByTriggerSince returns the snapshots of a trigger created after since,
+// newest first, without their ciphertext.
+func (r *SnapshotRepo) ListByTriggerSince(trigger string, since time.Time) ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+	err := r.db.Omit("ciphertext").Where("trigger = ? AND created_at > ?", trigger, since).Order("created_at desc").Find(&records).Error
+	return records, err
+}
+
+// ListMeta returns all snapshots oldest first, without their ciphertext.
+func (r *SnapshotRepo) ListMeta() ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+	err := r.db.Omit("ciphertext").Order("created_at asc").Find(&records).Error
+	return records, err
+}
+
+// ListBySchedule returns the snapshots created by a schedule, newest first,
+// without their ciphertext.
+func (r *SnapshotRepo) ListBySchedule(scheduleID uint) ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+	err := r.db.Omit("ciphertext").Where("schedule_id = ?", scheduleID).Order("created_at desc").Find(&records).Error
+	return records, err
+}
+
+// AssignSchedule attributes snapshots of a trigger that have no schedule yet
+// to scheduleID.
+func (r *SnapshotRepo) AssignSchedule(trigger string, scheduleID uint) error {
+	return r.db.Model(&SnapshotRecord{}).Where("trigger = ? AND schedule_id = 0", trigger).
+		Update("schedule_id", scheduleID).Error
+}
+
 func (r *SnapshotRepo) FindBySnapshotID(id string) (*SnapshotRecord, error) {
 	var record SnapshotRecord
 	err := r.db.Where("snapshot_id = ?", id).First(&record).Error
@@ -35,6 +69,32 @@ func (r *SnapshotRepo) FindBySnapshotID(id string) (*SnapshotRecord, error) {
 	return &record, nil
 }
 
+// UpdateKeys saves the key material of a snapshot (password slot and extra
+// key slots) without touching its ciphertext.
+func (r *SnapshotRepo) UpdateKeys(record *SnapshotRecord) error {
+	return r.db.Model(&SnapshotRecord{}).Where("snapshot_id = ?", record.SnapshotID).
+		Select("KDFAlg", "KDFParamsJSON", "SaltB64", "WrappedDEKB64", "WrapNonceB64", "KeySlotsJSON").
+		Updates(record).Error
+}
+
+// DeleteBySnapshotID deletes a snapshot and the blobs only it referenced.
 func (r *SnapshotRepo) DeleteBySnapshotID(id string) error {
-	return r.db.Where("snapshot_id = ?", id).Delete(&SnapshotRecord{}).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return deleteSnapshot(tx, id)
+	})
+}
+
+// ListByVersion returns the snapshots stored in the given layout version.
+func (r *SnapshotRepo) ListByVersion(version int) ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+	err := r.db.Where("snapshot_version = ?", version).Order("created_at desc").Find(&records).Error
+	return records, err
+}
+
+// CiphertextBytes returns the total size of the ciphertext stored on
+// snapshot rows.
+func (r *SnapshotRepo) CiphertextBytes() (int64, error) {
+	var n int64
+	err := r.db.Model(&SnapshotRecord{}).Select("COALESCE(SUM(LENGTH(ciphertext)), 0)").Scan(&n).Error
+	return n, err
 }
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SnapshotBlob is one encrypted resource shared by every snapshot that
+// contains the same content. BlobID is derived from the content, so a file
+// that did not change between snapshots is stored once.
+type SnapshotBlob struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	BlobID      string    `gorm:"size:64;uniqueIndex;not null" json:"blob_id"`
+	SizeBytes   int64     `gorm:"not null" json:"size_bytes"`   // plaintext size
+	StoredBytes int64     `gorm:"not null" json:"stored_bytes"` // compressed and encrypted size
+	Data        []byte    `gorm:"type:blob;not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SnapshotBlobRef records that a snapshot uses a blob. A blob without refs
+// is garbage.
+type SnapshotBlobRef struct {
+	ID         uint   `gorm:"primarykey"`
+	SnapshotID string `gorm:"size:64;uniqueIndex:idx_snapshot_blob_ref;not null"`
+	BlobID     string `gorm:"size:64;uniqueIndex:idx_snapshot_blob_ref;index;not null"`
+}
+
+type SnapshotBlobRepo struct {
+	db *gorm.DB
+}
+
+func NewSnapshotBlobRepo() *SnapshotBlobRepo {
+	return &SnapshotBlobRepo{db: DB}
+}
+
+// GetMany returns the blobs with the given IDs, keyed by BlobID. Missing
+// blobs are absent from the map.
+func (r *SnapshotBlobRepo) GetMany(blobIDs []string) (map[string]SnapshotBlob, error) {
+	out := make(map[string]SnapshotBlob, len(blobIDs))
+	if len(blobIDs) == 0 {
+		return out, nil
+	}
+	var list []SnapshotBlob
+	if err := r.db.Where("blob_id IN ?", blobIDs).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range list {
+		out[b.BlobID] = b
+	}
+	return out, nil
+}
+
+// ListBySnapshot returns the blobs a snapshot references.
+func (r *SnapshotBlobRepo) ListBySnapshot(snapshotID string) ([]SnapshotBlob, error) {
+	var list []SnapshotBlob
+	err := r.db.Where("blob_id IN (?)", r.db.Model(&SnapshotBlobRef{}).Select("blob_id").Where("snapshot_id = ?", snapshotID)).
+		Order("blob_id asc").Find(&list).Error
+	return list, err
+}
+
+// ListMetaBySnapshot is ListBySnapshot without the blob data, for callers
+// that read blobs one at a time.
+func (r *SnapshotBlobRepo) ListMetaBySnapshot(snapshotID string) ([]SnapshotBlob, error) {
+	var list []SnapshotBlob
+	err := r.db.Omit("data").Where("blob_id IN (?)", r.db.Model(&SnapshotBlobRef{}).Select("blob_id").Where("snapshot_id = ?", snapshotID)).
+		Order("blob_id asc").Find(&list).Error
+	return list, err
+}
+
+// Ref records that a snapshot uses blobID before the blob is written, so
+// garbage collection cannot remove it in between. It returns the blob's
+// stored size, or ok=false when the blob is not stored yet.
+func (r *SnapshotBlobRepo) Ref(snapshotID, blobID string) (storedBytes int64, ok bool, err error) {
+	ref := SnapshotBlobRef{SnapshotID: snapshotID, BlobID: blobID}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&ref).Error; err != nil {
+		return 0, false, err
+	}
+	var list []SnapshotBlob
+	if err := r.db.Select("blob_id", "stored_bytes").Where("blob_id = ?", blobID).Limit(1).Find(&list).Error; err != nil {
+		return 0, false, err
+	}
+	if len(list) == 0 {
+		return 0, false, nil
+	}
+	return list[0].StoredBytes, true, nil
+}
+
+// Unref drops refs of a snapshot that is still being written, and the
+// blobs no other snapshot references.
+func (r *SnapshotBlobRepo) Unref(snapshotID string, blobIDs []string) error {
+	if len(blobIDs) == 0 {
+		return nil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("snapshot_id = ? AND blob_id IN ?", snapshotID, blobIDs).Delete(&SnapshotBlobRef{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("blob_id IN ? AND blob_id NOT IN (?)", blobIDs, tx.Model(&SnapshotBlobRef{}).Select("blob_id")).
+			Delete(&SnapshotBlob{}).Error
+	})
+}
+
+// Put stores a blob unless one with the same ID exists.
+func (r *SnapshotBlobRepo) Put(b *SnapshotBlob) error {
+	return r.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "blob_id"}}, DoNothing: true}).Create(b).Error
+}
+
+// Replace overwrites the data of an existing blob, used to repair a blob
+// whose stored copy does not decrypt to its content.
+func (r *SnapshotBlobRepo) Replace(b *SnapshotBlob) error {
+	return r.db.Model(&SnapshotBlob{}).Where("blob_id = ?", b.BlobID).
+		Updates(map[string]any{"data": b.Data, "size_bytes": b.SizeBytes, "stored_bytes": b.StoredBytes}).Error
+}
+
+// Usage returns the number of stored blobs and their total stored size.
+func (r *SnapshotBlobRepo) Usage() (count int64, storedBytes int64, err error) {
+	var row struct {
+		Count int64
+		Bytes int64
+	}
+	err = r.db.Model(&SnapshotBlob{}).Select("COUNT(*) AS count, COALESCE(SUM(stored_bytes), 0) AS bytes").Scan(&row).Error
+	return row.Count, row.Bytes, err
+}
+
+// CreateWithBlobs stores a snapshot together with the blobs it references.
+// Blobs that already exist are shared rather than stored again.
+func (r *SnapshotRepo) CreateWithBlobs(record *SnapshotRecord, blobs []SnapshotBlob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createWithBlobs(tx, record, blobs)
+	})
+}
+
+// ReplaceWithBlobs swaps a snapshot row for a new encoding of the same
+// snapshot, keeping its ID, and drops blobs only the old row used.
+func (r *SnapshotRepo) ReplaceWithBlobs(record *SnapshotRecord, blobs []SnapshotBlob) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteSnapshot(tx, record.SnapshotID); err != nil {
+			return err
+		}
+		record.ID = 0
+		return createWithBlobs(tx, record, blobs)
+	})
+}
+
+func createWithBlobs(tx *gorm.DB, record *SnapshotRecord, blobs []SnapshotBlob) error {
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+	for i := range blobs {
+		if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "blob_id"}}, DoNothing: true}).Create(&blobs[i]).Error; err != nil {
+			return err
+		}
+		ref := SnapshotBlobRef{SnapshotID: record.SnapshotID, BlobID: blobs[i].BlobID}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ref).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteSnapshot removes a snapshot row and its refs, and garbage-collects
+// the blobs that no other snapshot references.
+func deleteSnapshot(tx *gorm.DB, snapshotID string) error {
+	var blobIDs []string
+	if err := tx.Model(&SnapshotBlobRef{}).Where("snapshot_id = ?", snapshotID).Pluck("blob_id", &blobIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("snapshot_id = ?", snapshotID).Delete(&SnapshotRecord{}).Error; err != nil {
+		return err
+	}
+	if len(blobIDs) == 0 {
+		return nil
+	}
+	if err := tx.Where("snapshot_id = ?", snapshotID).Delete(&SnapshotBlobRef{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("blob_id IN ? AND blob_id NOT IN (?)", blobIDs, tx.Model(&SnapshotBlobRef{}).Select("blob_id")).
+		Delete(&SnapshotBlob{}).Error
+}
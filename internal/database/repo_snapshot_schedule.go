@@ -0,0 +1,79 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotSchedule is a cron-driven automatic backup with its own resource
+// selection and retention policy.
+type SnapshotSchedule struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	Name            string     `gorm:"size:100;not null" json:"name"`
+	Cron            string     `gorm:"size:100;not null" json:"cron"`
+	Timezone        string     `gorm:"size:64" json:"timezone"`
+	Enabled         bool       `gorm:"default:false" json:"enabled"`
+	ResourceIDsJSON string     `gorm:"type:text" json:"-"` // JSON array; empty for all resources
+	NoteTemplate    string     `gorm:"size:255" json:"note_template"`
+	KeepLast        int        `gorm:"not null;default:0" json:"keep_last"`
+	KeepHourly      int        `gorm:"not null;default:0" json:"keep_hourly"`
+	KeepDaily       int        `gorm:"not null;default:0" json:"keep_daily"`
+	KeepWeekly      int        `gorm:"not null;default:0" json:"keep_weekly"`
+	KeepMonthly     int        `gorm:"not null;default:0" json:"keep_monthly"`
+	NextRunAt       *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt   *time.Time `json:"last_success_at,omitempty"`
+	LastStatus      string     `gorm:"size:20" json:"last_status"`
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	LastSnapshotID  string     `gorm:"size:64" json:"last_snapshot_id,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type SnapshotScheduleRepo struct {
+	db *gorm.DB
+}
+
+func NewSnapshotScheduleRepo() *SnapshotScheduleRepo {
+	return &SnapshotScheduleRepo{db: DB}
+}
+
+// List returns all schedules, oldest first.
+func (r *SnapshotScheduleRepo) List() ([]SnapshotSchedule, error) {
+	var list []SnapshotSchedule
+	err := r.db.Order("id asc").Find(&list).Error
+	return list, err
+}
+
+func (r *SnapshotScheduleRepo) GetByID(id uint) (*SnapshotSchedule, error) {
+	var s SnapshotSchedule
+	if err := r.db.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// First returns the oldest schedule, which backs the single-schedule API.
+func (r *SnapshotScheduleRepo) First() (*SnapshotSchedule, error) {
+	var s SnapshotSchedule
+	if err := r.db.Order("id asc").First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *SnapshotScheduleRepo) Count() (int64, error) {
+	var n int64
+	err := r.db.Model(&SnapshotSchedule{}).Count(&n).Error
+	return n, err
+}
+
+// Save inserts or updates a schedule.
+func (r *SnapshotScheduleRepo) Save(s *SnapshotSchedule) error {
+	return r.db.Save(s).Error
+}
+
+func (r *SnapshotScheduleRepo) Delete(id uint) error {
+	return r.db.Delete(&SnapshotSchedule{}, id).Error
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotTarget is an off-site destination snapshots are copied to.
+// Config holds the JSON target configuration, encrypted at rest.
+type SnapshotTarget struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	Name           string    `gorm:"size:100;uniqueIndex;not null" json:"name"`
+	Type           string    `gorm:"size:20;not null" json:"type"`
+	Config         string    `gorm:"type:text" json:"-"`
+	Enabled        bool      `gorm:"default:false" json:"enabled"`
+	AutoUpload     bool      `gorm:"default:false" json:"auto_upload"`          // upload every new snapshot
+	RetentionCount int       `gorm:"not null;default:0" json:"retention_count"` // 0 keeps all uploads
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Snapshot upload states.
+const (
+	UploadPending = "pending"
+	UploadSuccess = "success"
+	UploadFailed  = "failed"
+	UploadPruned  = "pruned" // removed from the target by retention
+)
+
+// SnapshotUpload tracks the copy of one snapshot on one target.
+type SnapshotUpload struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	SnapshotID string     `gorm:"size:64;uniqueIndex:idx_snapshot_upload;not null" json:"snapshot_id"`
+	TargetID   uint       `gorm:"uniqueIndex:idx_snapshot_upload;index;not null" json:"target_id"`
+	Status     string     `gorm:"size:20;index;not null" json:"status"`
+	ObjectName string     `gorm:"size:255" json:"object_name"`
+	SizeBytes  int64      `json:"size_bytes"`
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	UploadedAt *time.Time `json:"uploaded_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type SnapshotTargetRepo struct {
+	db *gorm.DB
+}
+
+func NewSnapshotTargetRepo() *SnapshotTargetRepo {
+	return &SnapshotTargetRepo{db: DB}
+}
+
+func (r *SnapshotTargetRepo) List() ([]SnapshotTarget, error) {
+	var list []SnapshotTarget
+	if err := r.db.Order("id asc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return decryptTargets(list)
+}
+
+// ListAutoUpload returns enabled targets that receive every new snapshot.
+func (r *SnapshotTargetRepo) ListAutoUpload() ([]SnapshotTarget, error) {
+	var list []SnapshotTarget
+	if err := r.db.Where("enabled = ? AND auto_upload = ?", true, true).Order("id asc").Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return decryptTargets(list)
+}
+
+func (r *SnapshotTargetRepo) GetByID(id uint) (*SnapshotTarget, error) {
+	var t SnapshotTarget
+	if err := r.db.First(&t, id).Error; err != nil {
+		return nil, err
+	}
+	cfg, err := decryptStoredValue(t.Config)
+	if err != nil {
+		return nil, err
+	}
+	t.Config = cfg
+	return &t, nil
+}
+
+func (r *SnapshotTargetRepo) Create(t *SnapshotTarget) error {
+	stored := *t
+	cfg, err := encryptStoredValue(stored.Config)
+	if err != nil {
+		return err
+	}
+	stored.Config = cfg
+	if err := r.db.Create(&stored).Error; err != nil {
+		return err
+	}
+	t.ID = stored.ID
+	t.CreatedAt = stored.CreatedAt
+	t.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *SnapshotTargetRepo) Update(t *SnapshotTarget) error {
+	stored := *t
+	cfg, err := encryptStoredValue(stored.Config)
+	if err != nil {
+		return err
+	}
+	stored.Config = cfg
+	if err := r.db.Save(&stored).Error; err != nil {
+		return err
+	}
+	t.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// Delete removes a target and its upload records. Objects already stored on
+// the target are left in place.
+func (r *SnapshotTargetRepo) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("target_id = ?", id).Delete(&SnapshotUpload{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&SnapshotTarget{}, id).Error
+	})
+}
+
+func decryptTargets(list []SnapshotTarget) ([]SnapshotTarget, error) {
+	for i := range list {
+		cfg, err := decryptStoredValue(list[i].Config)
+		if err != nil {
+			return nil, err
+		}
+		list[i].Config = cfg
+	}
+	return list, nil
+}
+
+type SnapshotUploadRepo struct {
+	db *gorm.DB
+}
+
+func NewSnapshotUploadRepo() *SnapshotUploadRepo {
+	return &SnapshotUploadRepo{db: DB}
+}
+
+// Get returns the upload record of a snapshot on a target.
+func (r *SnapshotUploadRepo) Get(snapshotID string, targetID uint) (*SnapshotUpload, error) {
+	var u SnapshotUpload
+	if err := r.db.Where("snapshot_id = ? AND target_id = ?", snapshotID, targetID).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Save inserts or updates an upload record.
+func (r *SnapshotUploadRepo) Save(u *SnapshotUpload) error {
+	return r.db.Save(u).Error
+}
+
+// ListBySnapshots returns the upload records of the given snapshots.
+// An empty list returns the records of all snapshots.
+func (r *SnapshotUploadRepo) ListBySnapshots(snapshotIDs []string) ([]SnapshotUpload, error) {
+	q := r.db.Order("target_id asc")
+	if len(snapshotIDs) > 0 {
+		q = q.Where("snapshot_id IN ?", snapshotIDs)
+	}
+	var list []SnapshotUpload
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// ListByTarget returns the upload records of a target in the given state,
+// newest upload first.
+func (r *SnapshotUploadRepo) ListByTarget(targetID uint, status string) ([]SnapshotUpload, error) {
+	var list []SnapshotUpload
+	err := r.db.Where("target_id = ? AND status = ?", targetID, status).
+		Order("uploaded_at desc, id desc").Find(&list).Error
+	return list, err
+}
+
+// ListRetryable returns pending uploads and failed uploads that have been
+// attempted fewer than maxAttempts times, oldest first.
+func (r *SnapshotUploadRepo) ListRetryable(maxAttempts int) ([]SnapshotUpload, error) {
+	var list []SnapshotUpload
+	err := r.db.Where("status = ? OR (status = ? AND attempts < ?)", UploadPending, UploadFailed, maxAttempts).
+		Order("id asc").Find(&list).Error
+	return list, err
+}
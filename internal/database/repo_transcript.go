@@ -0,0 +1,35 @@
+package database
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionTranscriptRepo struct {
+	db *gorm.DB
+}
+
+func NewSessionTranscriptRepo() *SessionTranscriptRepo {
+	return &SessionTranscriptRepo{db: DB}
+}
+
+// Count returns how many messages of a session are stored.
+func (r *SessionTranscriptRepo) Count(gatewayID uint, sessionKey string) (int64, error) {
+	var count int64
+	err := r.db.Model(&SessionTranscript{}).
+		Where("gateway_id = ? AND session_key = ?", gatewayID, sessionKey).Count(&count).Error
+	return count, err
+}
+
+// Append stores messages, skipping positions already stored.
+func (r *SessionTranscriptRepo) Append(msgs []SessionTranscript) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(msgs, 200).Error
+}
+
+// DeleteSession removes a session's stored messages.
+func (r *SessionTranscriptRepo) DeleteSession(gatewayID uint, sessionKey string) error {
+	return r.db.Where("gateway_id = ? AND session_key = ?", gatewayID, sessionKey).Delete(&SessionTranscript{}).Error
+}
@@ -1,6 +1,8 @@
 ﻿package database
 
 import (
+	"crypto/subtle"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -27,6 +29,16 @@ func (r *UserRepo) FindByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// FindByExternalID looks up a single sign-on user by issuer#subject.
+func (r *UserRepo) FindByExternalID(externalID string) (*User, error) {
+	var user User
+	err := r.db.Where("external_id = ?", externalID).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *UserRepo) FindByID(id uint) (*User, error) {
 	var user User
 	err := r.db.First(&user, id).Error
@@ -85,6 +97,96 @@ func (r *UserRepo) UpdateUsername(id uint, username string) error {
 	return r.db.Model(&User{}).Where("id = ?", id).Update("username", username).Error
 }
 
+func (r *UserRepo) UpdateRole(id uint, role string) error {
+	return r.db.Model(&User{}).Where("id = ?", id).Update("role", role).Error
+}
+
+// CountByRole returns how many users are assigned the given role.
+func (r *UserRepo) CountByRole(role string) (int64, error) {
+	var count int64
+	err := r.db.Model(&User{}).Where("role = ?", role).Count(&count).Error
+	return count, err
+}
+
+// IDsByRole returns the IDs of users assigned the given role.
+func (r *UserRepo) IDsByRole(role string) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&User{}).Where("role = ?", role).Pluck("id", &ids).Error
+	return ids, err
+}
+
 func (r *UserRepo) Delete(id uint) error {
 	return r.db.Delete(&User{}, id).Error
 }
+
+// TOTPSecret returns the decrypted TOTP secret of user, or "" when none is set.
+func (r *UserRepo) TOTPSecret(user *User) (string, error) {
+	if user.TOTPSecret == "" {
+		return "", nil
+	}
+	return decryptStoredValue(user.TOTPSecret)
+}
+
+// EnableTOTP stores the verified secret (encrypted) and turns on the second
+// factor, replacing any previous secret and recovery codes.
+func (r *UserRepo) EnableTOTP(id uint, secret string, step int64, recoveryHashes string) error {
+	encrypted, err := encryptStoredValue(secret)
+	if err != nil {
+		return err
+	}
+	return r.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_enabled":   true,
+		"totp_last_step": step,
+		"recovery_codes": recoveryHashes,
+	}).Error
+}
+
+// DisableTOTP removes the secret and all recovery codes.
+func (r *UserRepo) DisableTOTP(id uint) error {
+	return r.db.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+		"recovery_codes": "",
+	}).Error
+}
+
+// UseTOTPStep records step as the last accepted one. It reports false when
+// a concurrent request already consumed this or a later step.
+func (r *UserRepo) UseTOTPStep(id uint, step int64) (bool, error) {
+	res := r.db.Model(&User{}).Where("id = ? AND totp_last_step < ?", id, step).Update("totp_last_step", step)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *UserRepo) SetRecoveryCodes(id uint, recoveryHashes string) error {
+	return r.db.Model(&User{}).Where("id = ?", id).Update("recovery_codes", recoveryHashes).Error
+}
+
+// UseRecoveryCode removes hash from the user's unused recovery codes.
+// It reports false when the code is unknown or was already used.
+func (r *UserRepo) UseRecoveryCode(id uint, hash string) (bool, error) {
+	user, err := r.FindByID(id)
+	if err != nil {
+		return false, err
+	}
+	var remaining []string
+	found := false
+	for _, h := range strings.Split(user.RecoveryCodes, ",") {
+		if h == "" {
+			continue
+		}
+		if !found && subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return false, nil
+	}
+	// Compare-and-swap so two requests cannot spend the same code.
+	res := r.db.Model(&User{}).Where("id = ? AND recovery_codes = ?", id, user.RecoveryCodes).
+		Update("recovery_codes", strings.Join(remaining, ","))
+	return res.RowsAffected == 1, res.Error
+}
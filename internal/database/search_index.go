@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SearchSource is a table indexed for full-text search.
+type SearchSource struct {
+	Kind    string // activity, alert, audit, transcript
+	Table   string
+	Columns []string // text columns indexed, in order
+	TimeCol string
+	Title   string            // column shown as a hit's title
+	Fields  map[string]string // query field name -> column, for field filters
+}
+
+// SearchSources lists every table the search index covers.
+var SearchSources = []SearchSource{
+	{
+		Kind: "activity", Table: "activities", Columns: []string{"summary", "detail"},
+		TimeCol: "timestamp", Title: "summary",
+		Fields: map[string]string{
+			"risk": "risk", "category": "category", "source": "source", "session": "session_id",
+			"gateway": "gateway_id", "action": "action_taken",
+		},
+	},
+	{
+		Kind: "alert", Table: "alerts", Columns: []string{"message", "detail"},
+		TimeCol: "created_at", Title: "message",
+		Fields: map[string]string{"risk": "risk", "status": "status", "gateway": "gateway_id"},
+	},
+	{
+		Kind: "audit", Table: "audit_logs", Columns: []string{"action", "username", "detail"},
+		TimeCol: "created_at", Title: "action",
+		Fields: map[string]string{"user": "username", "action": "action", "result": "result"},
+	},
+	{
+		Kind: "transcript", Table: "session_transcripts", Columns: []string{"content"},
+		TimeCol: "timestamp", Title: "session_key",
+		Fields: map[string]string{"session": "session_key", "role": "role", "gateway": "gateway_id"},
+	},
+}
+
+// FTSTable is the SQLite FTS5 table indexing the source.
+func (s *SearchSource) FTSTable() string {
+	return s.Table + "_fts"
+}
+
+// Text is the SQL expression joining the source's text columns.
+func (s *SearchSource) Text(alias string) string {
+	parts := make([]string, len(s.Columns))
+	for i, c := range s.Columns {
+		parts[i] = fmt.Sprintf("coalesce(%s%s, '')", alias, c)
+	}
+	return strings.Join(parts, " || ' ' || ")
+}
+
+// Document is the Postgres expression the source's text search index is
+// built on. Queries must use the same expression to hit the index.
+func (s *SearchSource) Document(alias string) string {
+	return "to_tsvector('simple', " + s.Text(alias) + ")"
+}
+
+// EnsureSearchIndex creates the full-text index of every search source:
+// FTS5 tables kept in sync by triggers on SQLite, GIN expression indexes on
+// Postgres. A newly created FTS5 table is filled from its source.
+func EnsureSearchIndex(db *gorm.DB) error {
+	for i := range SearchSources {
+		s := &SearchSources[i]
+		var err error
+		switch db.Dialector.Name() {
+		case "sqlite":
+			err = ensureFTS5(db, s)
+		case "postgres":
+			err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_search ON %s USING GIN (%s)",
+				s.Table, s.Table, s.Document(""))).Error
+		}
+		if err != nil {
+			return fmt.Errorf("search index for %s: %w", s.Table, err)
+		}
+	}
+	return nil
+}
+
+func ensureFTS5(db *gorm.DB, s *SearchSource) error {
+	fts := s.FTSTable()
+	var existing int64
+	if err := db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", fts).Scan(&existing).Error; err != nil {
+		return err
+	}
+
+	cols := strings.Join(s.Columns, ", ")
+	newCols := "new." + strings.Join(s.Columns, ", new.")
+	oldCols := "old." + strings.Join(s.Columns, ", old.")
+	remove := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s);", fts, fts, cols, oldCols)
+	insert := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.id, %s);", fts, cols, newCols)
+	stmts := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id', tokenize='unicode61')",
+			fts, cols, s.Table),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN %s END", fts, s.Table, insert),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN %s END", fts, s.Table, remove),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE OF %s ON %s BEGIN %s %s END", fts, cols, s.Table, remove, insert),
+	}
+	if existing == 0 {
+		stmts = append(stmts, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts))
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
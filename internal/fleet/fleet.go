@@ -0,0 +1,243 @@
+// Package fleet keeps concurrent connections to every enabled gateway
+// profile, each with its own activity collector and lifecycle recorder, next
+// to the primary connection used for the active profile.
+package fleet
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/monitor"
+	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/riskpolicy"
+	"ClawDeckX/internal/web"
+)
+
+// Gateway describes one connected gateway of the fleet.
+type Gateway struct {
+	ID      uint               `json:"id"`
+	Name    string             `json:"name"`
+	Host    string             `json:"host"`
+	Port    int                `json:"port"`
+	Primary bool               `json:"primary"`
+	Client  *openclaw.GWClient `json:"-"`
+}
+
+// member is a secondary gateway connection owned by the Manager.
+type member struct {
+	profile   database.GatewayProfile
+	client    *openclaw.GWClient
+	collector *monitor.GWCollector
+	recorder  *monitor.LifecycleRecorder
+}
+
+// Manager owns the secondary gateway connections. The active profile is always
+// served by the primary client, which the Manager only references.
+type Manager struct {
+	repo        *database.GatewayProfileRepo
+	wsHub       *web.WSHub
+	primary     *openclaw.GWClient
+	intervalSec int
+
+	onActivity  func(*database.Activity)
+	onLifecycle func(*database.GatewayLifecycle)
+	notify      func(string)
+	risk        *riskpolicy.Engine
+
+	mu        sync.RWMutex
+	primaryID uint
+	members   map[uint]*member
+}
+
+func NewManager(primary *openclaw.GWClient, wsHub *web.WSHub, intervalSec int) *Manager {
+	return &Manager{
+		repo:        database.NewGatewayProfileRepo(),
+		wsHub:       wsHub,
+		primary:     primary,
+		intervalSec: intervalSec,
+		members:     make(map[uint]*member),
+	}
+}
+
+// SetActivityCallback registers an observer for activities written by member collectors.
+func (m *Manager) SetActivityCallback(fn func(*database.Activity)) {
+	m.onActivity = fn
+}
+
+// SetLifecycleCallback registers an observer for lifecycle events of member gateways.
+func (m *Manager) SetLifecycleCallback(fn func(*database.GatewayLifecycle)) {
+	m.onLifecycle = fn
+}
+
+// SetRiskEngine sets the engine member collectors score tool calls with.
+func (m *Manager) SetRiskEngine(e *riskpolicy.Engine) {
+	m.risk = e
+}
+
+// SetNotifyCallback sets where member lifecycle notifications are sent.
+func (m *Manager) SetNotifyCallback(fn func(string)) {
+	m.notify = fn
+}
+
+// SetPrimary records which profile the primary client is connected to and
+// resyncs members so that profile is not connected twice.
+func (m *Manager) SetPrimary(profileID uint) {
+	m.mu.Lock()
+	m.primaryID = profileID
+	m.mu.Unlock()
+	m.Sync()
+}
+
+// PrimaryID returns the profile ID served by the primary client (0 if none).
+func (m *Manager) PrimaryID() uint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.primaryID
+}
+
+// Sync connects enabled profiles that are not yet connected, reconnects those
+// whose address or token changed and disconnects disabled or deleted ones.
+func (m *Manager) Sync() {
+	profiles, err := m.repo.ListEnabled()
+	if err != nil {
+		logger.Gateway.Warn().Err(err).Msg("fleet: failed to list enabled gateway profiles")
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := make(map[uint]database.GatewayProfile, len(profiles))
+	for _, p := range profiles {
+		if p.ID != m.primaryID {
+			wanted[p.ID] = p
+		}
+	}
+	for id, mem := range m.members {
+		p, ok := wanted[id]
+		if ok && p.Host == mem.profile.Host && p.Port == mem.profile.Port && p.Token == mem.profile.Token {
+			mem.profile.Name = p.Name
+			mem.recorder.SetGatewayInfo(p.Host, p.Port, p.Name, !isLocalHost(p.Host))
+			delete(wanted, id)
+			continue
+		}
+		mem.stop()
+		delete(m.members, id)
+	}
+	for id, p := range wanted {
+		m.members[id] = m.start(p)
+	}
+}
+
+// Stop disconnects all member gateways.
+func (m *Manager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, mem := range m.members {
+		mem.stop()
+		delete(m.members, id)
+	}
+}
+
+// Client returns the client for a gateway profile ID. ID 0 and the active
+// profile resolve to the primary client.
+func (m *Manager) Client(id uint) (*openclaw.GWClient, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id == 0 || id == m.primaryID {
+		return m.primary, m.primary != nil
+	}
+	mem, ok := m.members[id]
+	if !ok {
+		return nil, false
+	}
+	return mem.client, true
+}
+
+// Gateways lists the primary gateway followed by all members ordered by ID.
+func (m *Manager) Gateways() []Gateway {
+	m.mu.RLock()
+	primaryID := m.primaryID
+	out := make([]Gateway, 0, len(m.members)+1)
+	for id, mem := range m.members {
+		out = append(out, Gateway{
+			ID:     id,
+			Name:   mem.profile.Name,
+			Host:   mem.profile.Host,
+			Port:   mem.profile.Port,
+			Client: mem.client,
+		})
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+
+	if m.primary == nil {
+		return out
+	}
+	cfg := m.primary.GetConfig()
+	primary := Gateway{ID: primaryID, Host: cfg.Host, Port: cfg.Port, Primary: true, Client: m.primary}
+	if primaryID != 0 {
+		if p, err := m.repo.GetByID(primaryID); err == nil {
+			primary.Name = p.Name
+		}
+	}
+	return append([]Gateway{primary}, out...)
+}
+
+func (m *Manager) start(p database.GatewayProfile) *member {
+	client := openclaw.NewGWClient(openclaw.GWClientConfig{
+		Host:  p.Host,
+		Port:  p.Port,
+		Token: p.Token,
+	})
+
+	recorder := monitor.NewLifecycleRecorder(m.wsHub)
+	recorder.SetGatewayInfo(p.Host, p.Port, p.Name, !isLocalHost(p.Host))
+	recorder.SetGatewayID(p.ID)
+	if m.notify != nil {
+		recorder.SetNotifyCallback(m.notify)
+	}
+	if m.onLifecycle != nil {
+		recorder.SetEventCallback(m.onLifecycle)
+	}
+	// Member gateways are never restarted by ClawDeckX, so a lost connection
+	// is always reported as unreachable rather than crashed.
+	client.SetLifecycleCallback(func(event, detail string) {
+		switch event {
+		case "connected":
+			recorder.RecordStarted("ws_connected")
+		case "disconnected":
+			recorder.RecordUnreachable(detail)
+		}
+	})
+
+	collector := monitor.NewGWCollector(client, m.wsHub, m.intervalSec)
+	collector.SetFleetMember(p.ID)
+	collector.SetLifecycleRecorder(recorder)
+	if m.onActivity != nil {
+		collector.SetActivityCallback(m.onActivity)
+	}
+	if m.risk != nil {
+		collector.SetRiskEngine(m.risk)
+	}
+
+	client.Start()
+	go collector.Start()
+
+	logger.Gateway.Info().Uint("id", p.ID).Str("name", p.Name).Str("host", p.Host).Int("port", p.Port).
+		Msg("fleet: gateway connection started")
+	return &member{profile: p, client: client, collector: collector, recorder: recorder}
+}
+
+func (mem *member) stop() {
+	mem.collector.Stop()
+	mem.client.Stop()
+	logger.Gateway.Info().Uint("id", mem.profile.ID).Str("name", mem.profile.Name).Msg("fleet: gateway connection stopped")
+}
+
+func isLocalHost(host string) bool {
+	h := strings.TrimSpace(host)
+	return h == "" || h == "127.0.0.1" || h == "localhost" || h == "::1"
+}
@@ -0,0 +1,81 @@
+package fleet
+
+import (
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createProfile(t *testing.T, name string, port int, enabled bool) *database.GatewayProfile {
+	t.Helper()
+	p := &database.GatewayProfile{Name: name, Host: "127.0.0.1", Port: port, Enabled: enabled}
+	require.NoError(t, database.NewGatewayProfileRepo().Create(p))
+	return p
+}
+
+func TestManagerSyncMembers(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	primary := openclaw.NewGWClient(openclaw.GWClientConfig{Host: "127.0.0.1", Port: 1})
+	active := createProfile(t, "active", 1, true)
+	second := createProfile(t, "second", 2, true)
+	disabled := createProfile(t, "disabled", 3, false)
+
+	m := NewManager(primary, nil, 30)
+	defer m.Stop()
+	m.SetPrimary(active.ID)
+
+	c, ok := m.Client(0)
+	require.True(t, ok)
+	assert.Same(t, primary, c, "no selector resolves to the primary client")
+	c, ok = m.Client(active.ID)
+	require.True(t, ok)
+	assert.Same(t, primary, c, "the active profile is served by the primary client")
+
+	member, ok := m.Client(second.ID)
+	require.True(t, ok)
+	assert.NotSame(t, primary, member)
+	_, ok = m.Client(disabled.ID)
+	assert.False(t, ok)
+
+	gateways := m.Gateways()
+	require.Len(t, gateways, 2)
+	assert.True(t, gateways[0].Primary)
+	assert.Equal(t, "active", gateways[0].Name)
+	assert.Equal(t, second.ID, gateways[1].ID)
+
+	// Unchanged profiles keep their connection across syncs.
+	m.Sync()
+	again, _ := m.Client(second.ID)
+	assert.Same(t, member, again)
+
+	// Changing the address reconnects; disabling disconnects.
+	second.Port = 4
+	require.NoError(t, database.NewGatewayProfileRepo().Update(second))
+	m.Sync()
+	again, ok = m.Client(second.ID)
+	require.True(t, ok)
+	assert.NotSame(t, member, again)
+	assert.Equal(t, 4, again.GetConfig().Port)
+
+	second.Enabled = false
+	require.NoError(t, database.NewGatewayProfileRepo().Update(second))
+	m.Sync()
+	_, ok = m.Client(second.ID)
+	assert.False(t, ok)
+
+	// Activating a member profile hands it over to the primary client.
+	disabled.Enabled = true
+	require.NoError(t, database.NewGatewayProfileRepo().Update(disabled))
+	m.SetPrimary(disabled.ID)
+	c, _ = m.Client(disabled.ID)
+	assert.Same(t, primary, c)
+	_, ok = m.Client(active.ID)
+	assert.True(t, ok, "the previously active, still enabled profile becomes a member")
+}
@@ -23,6 +23,11 @@ func NewActivityHandler() *ActivityHandler {
 // List returns activity events with pagination, filters, and search.
 func (h *ActivityHandler) List(w http.ResponseWriter, r *http.Request) {
 	pq := web.ParsePageQuery(r)
+	gatewayID, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
 
 	filter := database.ActivityFilter{
 		Page:      pq.Page,
@@ -34,6 +39,7 @@ func (h *ActivityHandler) List(w http.ResponseWriter, r *http.Request) {
 		EndTime:   pq.EndTime,
 		Category:  r.URL.Query().Get("category"),
 		Risk:      r.URL.Query().Get("risk"),
+		GatewayID: gatewayID,
 	}
 
 	activities, total, err := h.activityRepo.List(filter)
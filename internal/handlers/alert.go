@@ -1,28 +1,48 @@
 ﻿package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"ClawDeckX/internal/alerting"
+	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/web"
+
+	"gorm.io/gorm"
 )
 
 // AlertHandler manages alert operations.
 type AlertHandler struct {
 	alertRepo *database.AlertRepo
+	auditRepo *database.AuditLogRepo
+	manager   *alerting.Manager
 }
 
 func NewAlertHandler() *AlertHandler {
 	return &AlertHandler{
 		alertRepo: database.NewAlertRepo(),
+		auditRepo: database.NewAuditLogRepo(),
 	}
 }
 
+// SetManager injects the alert lifecycle manager.
+func (h *AlertHandler) SetManager(m *alerting.Manager) {
+	h.manager = m
+}
+
 // List returns alerts with pagination and filters.
 func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 	pq := web.ParsePageQuery(r)
+	gatewayID, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
 
 	filter := database.AlertFilter{
 		Page:      pq.Page,
@@ -30,6 +50,8 @@ func (h *AlertHandler) List(w http.ResponseWriter, r *http.Request) {
 		SortBy:    pq.SortBy,
 		SortOrder: pq.SortOrder,
 		Risk:      r.URL.Query().Get("risk"),
+		Status:    r.URL.Query().Get("status"),
+		GatewayID: gatewayID,
 		StartTime: pq.StartTime,
 		EndTime:   pq.EndTime,
 	}
@@ -70,3 +92,106 @@ func (h *AlertHandler) MarkAllNotified(w http.ResponseWriter, r *http.Request) {
 
 	web.OK(w, r, map[string]string{"message": "ok"})
 }
+
+type alertActionRequest struct {
+	ID      uint   `json:"id"`
+	Until   string `json:"until"`   // silence: RFC3339 end time
+	Minutes int    `json:"minutes"` // silence: duration, used when until is empty
+}
+
+// Acknowledge marks an alert as being handled by the current user.
+func (h *AlertHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeAction(w, r)
+	if !ok {
+		return
+	}
+	alert, err := h.manager.Acknowledge(req.ID, web.GetUsername(r))
+	h.finishAction(w, r, alert, err, constants.ActionAlertAcknowledge)
+}
+
+// Silence suppresses notifications and escalation for an alert until a given time.
+func (h *AlertHandler) Silence(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeAction(w, r)
+	if !ok {
+		return
+	}
+	var until time.Time
+	switch {
+	case req.Until != "":
+		t, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam, "until must be RFC3339")
+			return
+		}
+		until = t
+	case req.Minutes > 0:
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	default:
+		web.FailErr(w, r, web.ErrInvalidParam, "until or minutes is required")
+		return
+	}
+	alert, err := h.manager.Silence(req.ID, until, web.GetUsername(r))
+	h.finishAction(w, r, alert, err, constants.ActionAlertSilence)
+}
+
+// Resolve closes an alert manually.
+func (h *AlertHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeAction(w, r)
+	if !ok {
+		return
+	}
+	alert, err := h.manager.Resolve(req.ID, web.GetUsername(r))
+	h.finishAction(w, r, alert, err, constants.ActionAlertResolve)
+}
+
+// Summary returns alert counts per lifecycle state.
+func (h *AlertHandler) Summary(w http.ResponseWriter, r *http.Request) {
+	counts, err := h.alertRepo.CountByStatus()
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertQueryFail)
+		return
+	}
+	unread, _ := h.alertRepo.CountUnread()
+	counts["unread"] = unread
+	web.OK(w, r, counts)
+}
+
+func (h *AlertHandler) decodeAction(w http.ResponseWriter, r *http.Request) (*alertActionRequest, bool) {
+	var req alertActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return nil, false
+	}
+	if req.ID == 0 {
+		web.FailErr(w, r, web.ErrInvalidParam, "id is required")
+		return nil, false
+	}
+	if h.manager == nil {
+		web.FailErr(w, r, web.ErrAlertUpdateFail)
+		return nil, false
+	}
+	return &req, true
+}
+
+func (h *AlertHandler) finishAction(w http.ResponseWriter, r *http.Request, alert *database.Alert, err error, action string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		web.FailErr(w, r, web.ErrAlertNotFound)
+		return
+	case errors.Is(err, alerting.ErrInvalidTransition):
+		web.FailErr(w, r, web.ErrAlertStateConflict)
+		return
+	case err != nil:
+		web.FailErr(w, r, web.ErrAlertUpdateFail)
+		return
+	}
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   "alert " + strconv.FormatUint(uint64(alert.ID), 10) + ": " + alert.Message,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+	web.OK(w, r, alert)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ClawDeckX/internal/alerting"
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/web"
+)
+
+// AlertRuleHandler manages user-defined alert rules.
+type AlertRuleHandler struct {
+	repo      *database.AlertRuleRepo
+	auditRepo *database.AuditLogRepo
+	engine    *alerting.Engine
+}
+
+func NewAlertRuleHandler(engine *alerting.Engine) *AlertRuleHandler {
+	return &AlertRuleHandler{
+		repo:      database.NewAlertRuleRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		engine:    engine,
+	}
+}
+
+// List returns all alert rules (enabled and disabled).
+func (h *AlertRuleHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := h.repo.List()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	rules := make([]*alerting.Rule, 0, len(records))
+	for i := range records {
+		rule, err := alerting.RuleFromRecord(&records[i])
+		if err != nil {
+			logger.Alert.Warn().Err(err).Msg("alert rule decode failed")
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	web.OK(w, r, rules)
+}
+
+// Create adds a new alert rule. Enabled and notify default to true when omitted.
+func (h *AlertRuleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	rule := alerting.Rule{Enabled: true, Notify: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := rule.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+		return
+	}
+	rule.ID = 0
+	rec, err := rule.Record()
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+		return
+	}
+	if err := h.repo.Create(rec); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleSaveFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionAlertRuleCreate, "created alert rule: "+rec.Name)
+
+	saved, _ := alerting.RuleFromRecord(rec)
+	web.OK(w, r, saved)
+}
+
+// Update replaces an existing alert rule (?id=).
+func (h *AlertRuleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleNotFound)
+		return
+	}
+
+	var rule alerting.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := rule.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+		return
+	}
+	rule.ID = existing.ID
+	rule.CreatedAt = existing.CreatedAt
+	rec, err := rule.Record()
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+		return
+	}
+	if err := h.repo.Update(rec); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleSaveFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionAlertRuleUpdate, "updated alert rule: "+rec.Name)
+
+	saved, _ := alerting.RuleFromRecord(rec)
+	web.OK(w, r, saved)
+}
+
+// Delete removes an alert rule (?id=).
+func (h *AlertRuleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleNotFound)
+		return
+	}
+	if err := h.repo.Delete(id); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleDeleteFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionAlertRuleDelete, "deleted alert rule: "+existing.Name)
+
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+// DryRun evaluates a saved rule (id) or an unsaved rule definition against
+// historical events without creating alerts or sending notifications.
+func (h *AlertRuleHandler) DryRun(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID    uint           `json:"id"`
+		Rule  *alerting.Rule `json:"rule"`
+		Since string         `json:"since"`
+		Until string         `json:"until"`
+		Hours int            `json:"hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+
+	var rule *alerting.Rule
+	switch {
+	case req.Rule != nil:
+		rule = req.Rule
+	case req.ID > 0:
+		rec, err := h.repo.GetByID(req.ID)
+		if err != nil {
+			web.FailErr(w, r, web.ErrAlertRuleNotFound)
+			return
+		}
+		decoded, err := alerting.RuleFromRecord(rec)
+		if err != nil {
+			web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+			return
+		}
+		rule = decoded
+	default:
+		web.FailErr(w, r, web.ErrInvalidParam, "id or rule is required")
+		return
+	}
+	if err := rule.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleInvalid, err.Error())
+		return
+	}
+
+	until := time.Now().UTC()
+	if req.Until != "" {
+		t, err := time.Parse(time.RFC3339, req.Until)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam, "until must be RFC3339")
+			return
+		}
+		until = t
+	}
+	hours := req.Hours
+	if hours <= 0 {
+		hours = 24
+	}
+	since := until.Add(-time.Duration(hours) * time.Hour)
+	if req.Since != "" {
+		t, err := time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam, "since must be RFC3339")
+			return
+		}
+		since = t
+	}
+	if !since.Before(until) {
+		web.FailErr(w, r, web.ErrInvalidParam, "since must be before until")
+		return
+	}
+
+	result, err := h.engine.DryRun(rule, since, until)
+	if err != nil {
+		web.FailErr(w, r, web.ErrAlertRuleDryRunFail, err.Error())
+		return
+	}
+	web.OK(w, r, result)
+}
+
+func (h *AlertRuleHandler) reloadEngine() {
+	if h.engine == nil {
+		return
+	}
+	if err := h.engine.Reload(); err != nil {
+		logger.Alert.Error().Err(err).Msg("alert rule reload failed")
+	}
+}
+
+func (h *AlertRuleHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
+
+// parseIDQuery reads a positive numeric ?id= query parameter.
+func parseIDQuery(r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/rbac"
+	"ClawDeckX/internal/web"
+)
+
+const (
+	apiTokenMaxName     = 64
+	apiTokenTouchPeriod = time.Minute // min interval between last-used writes from the same IP
+)
+
+var errAPITokenRejected = errors.New("api token rejected")
+
+// APITokenHandler manages personal access tokens and validates them for web.AuthMiddleware.
+type APITokenHandler struct {
+	repo      *database.APITokenRepo
+	userRepo  *database.UserRepo
+	auditRepo *database.AuditLogRepo
+}
+
+func NewAPITokenHandler() *APITokenHandler {
+	return &APITokenHandler{
+		repo:      database.NewAPITokenRepo(),
+		userRepo:  database.NewUserRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+	}
+}
+
+// APITokenResponse is a token as shown to its owner. Token is only set on creation.
+type APITokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+// List returns the current user's tokens, including revoked and expired ones.
+func (h *APITokenHandler) List(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.repo.ListByUser(web.GetUserID(r))
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	now := time.Now().UTC()
+	resp := make([]APITokenResponse, 0, len(tokens))
+	for i := range tokens {
+		resp = append(resp, apiTokenView(&tokens[i], now))
+	}
+	web.OK(w, r, resp)
+}
+
+// Create issues a token for the current user. Scopes are permission names the
+// user must hold; no scopes yields a read-only token. The secret is returned once.
+func (h *APITokenHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > apiTokenMaxName {
+		web.FailErr(w, r, web.ErrAPITokenInvalid, "name is required (max 64 characters)")
+		return
+	}
+	scopes, err := rbac.NormalizePermissions(req.Scopes)
+	if err != nil {
+		web.FailErr(w, r, web.ErrAPITokenInvalid, err.Error())
+		return
+	}
+	for _, s := range scopes {
+		if !web.HasPermission(r, s) {
+			web.FailErr(w, r, web.ErrForbidden, "scope not held by current user: "+s)
+			return
+		}
+	}
+	now := time.Now().UTC()
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			web.FailErr(w, r, web.ErrAPITokenInvalid, "expires_at must be RFC3339")
+			return
+		}
+		if !t.After(now) {
+			web.FailErr(w, r, web.ErrAPITokenInvalid, "expires_at must be in the future")
+			return
+		}
+		t = t.UTC()
+		expiresAt = &t
+	}
+
+	secret, err := generateAPIToken()
+	if err != nil {
+		web.FailErr(w, r, web.ErrEncrypt)
+		return
+	}
+	rec := &database.APIToken{
+		UserID:    web.GetUserID(r),
+		Name:      req.Name,
+		Prefix:    secret[:len(web.APITokenPrefix)+8],
+		TokenHash: hashAPIToken(secret),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.repo.Create(rec); err != nil {
+		web.FailErr(w, r, web.ErrAPITokenSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionAPITokenCreate, "created api token: "+rec.Name+" ["+rec.Scopes+"]")
+
+	logger.Auth.Info().Str("username", web.GetUsername(r)).Str("token", rec.Name).Str("scopes", rec.Scopes).Msg("api token created")
+	resp := apiTokenView(rec, now)
+	resp.Token = secret
+	web.OK(w, r, resp)
+}
+
+// Revoke revokes a token (?id=). Users can revoke their own tokens; users.manage can revoke any.
+func (h *APITokenHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	rec, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrAPITokenNotFound)
+		return
+	}
+	if rec.UserID != web.GetUserID(r) && !web.HasPermission(r, constants.PermUsersManage) {
+		web.FailErr(w, r, web.ErrAPITokenNotFound)
+		return
+	}
+	if err := h.repo.Revoke(rec.ID, time.Now().UTC()); err != nil {
+		web.FailErr(w, r, web.ErrAPITokenSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionAPITokenRevoke, "revoked api token: "+rec.Name)
+
+	logger.Auth.Info().Str("username", web.GetUsername(r)).Str("token", rec.Name).Msg("api token revoked")
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+// Authenticate validates a raw token for web.AuthMiddleware. The granted
+// permissions are the token's scopes limited to what its owner currently holds,
+// so demoting or deleting the owner also narrows or disables the token.
+func (h *APITokenHandler) Authenticate(token, ip string) (*web.APITokenIdentity, error) {
+	rec, err := h.repo.FindByHash(hashAPIToken(token))
+	if err != nil {
+		return nil, errAPITokenRejected
+	}
+	now := time.Now().UTC()
+	if rec.RevokedAt != nil || (rec.ExpiresAt != nil && !rec.ExpiresAt.After(now)) {
+		return nil, errAPITokenRejected
+	}
+	user, err := h.userRepo.FindByID(rec.UserID)
+	if err != nil {
+		return nil, errAPITokenRejected
+	}
+	held, err := rbac.Resolve(user.Role)
+	if err != nil {
+		held = nil
+	}
+	perms := []string{}
+	for _, s := range rbac.SplitPermissions(rec.Scopes) {
+		for _, p := range held {
+			if s == p {
+				perms = append(perms, s)
+				break
+			}
+		}
+	}
+
+	if rec.LastUsedAt == nil || rec.LastUsedIP != ip || now.Sub(*rec.LastUsedAt) >= apiTokenTouchPeriod {
+		if err := h.repo.Touch(rec.ID, now, ip); err != nil {
+			logger.Auth.Warn().Err(err).Str("token", rec.Name).Msg("failed to record api token use")
+		}
+	}
+
+	return &web.APITokenIdentity{
+		TokenID:   rec.ID,
+		TokenName: rec.Name,
+		UserID:    user.ID,
+		Role:      user.Role,
+		Perms:     perms,
+	}, nil
+}
+
+func (h *APITokenHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
+
+func apiTokenView(t *database.APIToken, now time.Time) APITokenResponse {
+	return APITokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     rbac.SplitPermissions(t.Scopes),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		RevokedAt:  t.RevokedAt,
+		Active:     t.RevokedAt == nil && (t.ExpiresAt == nil || t.ExpiresAt.After(now)),
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return web.APITokenPrefix + hex.EncodeToString(b), nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+	"ClawDeckX/internal/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createAPIToken(t *testing.T, h *APITokenHandler, user *database.User, perms []string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/api-tokens", bytes.NewBufferString(body))
+	req = web.SetUserInfo(req, user.ID, user.Username, user.Role, perms)
+	w := httptest.NewRecorder()
+	h.Create(w, req)
+	return w
+}
+
+func TestAPITokenLifecycle(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, database.NewRoleRepo().Create(&database.Role{Name: "operator", Permissions: constants.PermGatewayControl}))
+	user := &database.User{Username: "ci", PasswordHash: "x", Role: "operator"}
+	require.NoError(t, database.NewUserRepo().Create(user))
+	h := NewAPITokenHandler()
+
+	w := createAPIToken(t, h, user, []string{constants.PermGatewayControl}, `{"name":"deploy","scopes":["config.write"]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code, "scopes beyond the owner's permissions are rejected")
+
+	w = createAPIToken(t, h, user, []string{constants.PermGatewayControl}, `{"name":"deploy","scopes":["gateway.control"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data APITokenResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	secret := resp.Data.Token
+	require.NotEmpty(t, secret)
+	assert.Equal(t, secret[:len(resp.Data.Prefix)], resp.Data.Prefix)
+
+	stored, err := database.NewAPITokenRepo().GetByID(resp.Data.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, stored.TokenHash, secret, "the secret is not stored in clear")
+
+	id, err := h.Authenticate(secret, "10.0.0.5")
+	require.NoError(t, err)
+	assert.Equal(t, "deploy", id.TokenName)
+	assert.Equal(t, []string{constants.PermGatewayControl}, id.Perms)
+	stored, _ = database.NewAPITokenRepo().GetByID(resp.Data.ID)
+	require.NotNil(t, stored.LastUsedAt)
+	assert.Equal(t, "10.0.0.5", stored.LastUsedIP)
+
+	// Demoting the owner narrows the token.
+	require.NoError(t, database.NewUserRepo().UpdateRole(user.ID, constants.RoleReadonly))
+	id, err = h.Authenticate(secret, "10.0.0.5")
+	require.NoError(t, err)
+	assert.Empty(t, id.Perms)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/api-tokens?id=1", nil)
+	req = web.SetUserInfo(req, user.ID, user.Username, user.Role, nil)
+	rec := httptest.NewRecorder()
+	h.Revoke(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, err = h.Authenticate(secret, "10.0.0.5")
+	assert.Error(t, err, "revoked tokens are rejected")
+	_, err = h.Authenticate("cdx_unknown", "10.0.0.5")
+	assert.Error(t, err)
+}
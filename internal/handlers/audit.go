@@ -3,11 +3,16 @@
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/web"
 )
 
+// auditCheckpointInterval is how often the chain head is signed.
+const auditCheckpointInterval = time.Hour
+
 // AuditHandler manages audit log queries.
 type AuditHandler struct {
 	auditRepo *database.AuditLogRepo
@@ -49,3 +54,60 @@ func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	web.OKPage(w, r, logs, total, pq.Page, pq.PageSize)
 }
+
+// Verify walks the audit hash chain and its signed checkpoints and reports
+// the first broken link.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	res, err := h.auditRepo.Verify()
+	if err != nil {
+		web.FailErr(w, r, web.ErrAuditVerifyFail, err.Error())
+		return
+	}
+	if !res.OK {
+		logger.Audit.Warn().Uint("broken_id", res.BrokenID).Str("reason", res.Reason).Msg("audit chain verification failed")
+	}
+	web.OK(w, r, res)
+}
+
+// Checkpoints lists recent signed checkpoints.
+func (h *AuditHandler) Checkpoints(w http.ResponseWriter, r *http.Request) {
+	list, err := h.auditRepo.ListCheckpoints(100)
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	web.OK(w, r, list)
+}
+
+// CreateCheckpoint signs the current chain head now. Returns null data when
+// nothing was logged since the last checkpoint.
+func (h *AuditHandler) CreateCheckpoint(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.auditRepo.Checkpoint()
+	if err != nil {
+		web.FailErr(w, r, web.ErrAuditCheckpointFail, err.Error())
+		return
+	}
+	web.OK(w, r, cp)
+}
+
+// StartCheckpoints signs the chain head every auditCheckpointInterval while
+// new records arrive.
+func (h *AuditHandler) StartCheckpoints(done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(auditCheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				cp, err := h.auditRepo.Checkpoint()
+				if err != nil {
+					logger.Audit.Error().Err(err).Msg("audit checkpoint failed")
+				} else if cp != nil {
+					logger.Audit.Info().Uint("last_log_id", cp.LastLogID).Int64("count", cp.Count).Msg("audit checkpoint signed")
+				}
+			}
+		}
+	}()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"ClawDeckX/internal/constants"
@@ -11,6 +12,7 @@ import (
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/ratelimit"
+	"ClawDeckX/internal/rbac"
 	"ClawDeckX/internal/web"
 	"ClawDeckX/internal/webconfig"
 
@@ -23,18 +25,29 @@ const (
 )
 
 type AuthHandler struct {
-	userRepo  *database.UserRepo
-	auditRepo *database.AuditLogRepo
-	cfg       *webconfig.Config
-	ipLimiter *ratelimit.IPLimiter
+	userRepo    *database.UserRepo
+	auditRepo   *database.AuditLogRepo
+	settingRepo *database.SettingRepo
+	sessionRepo *database.SessionRepo
+	cfg         *webconfig.Config
+	ipLimiter   *ratelimit.IPLimiter
+	oidc        *OIDCHandler
+
+	mfaMu       sync.Mutex
+	challenges  map[string]*mfaChallenge // pending second-factor logins by token
+	enrollments map[uint]*totpEnrollment // unverified secrets by user ID
 }
 
 func NewAuthHandler(cfg *webconfig.Config) *AuthHandler {
 	return &AuthHandler{
-		userRepo:  database.NewUserRepo(),
-		auditRepo: database.NewAuditLogRepo(),
-		cfg:       cfg,
-		ipLimiter: ratelimit.New(ratelimit.DefaultConfig),
+		userRepo:    database.NewUserRepo(),
+		auditRepo:   database.NewAuditLogRepo(),
+		settingRepo: database.NewSettingRepo(),
+		sessionRepo: database.NewSessionRepo(),
+		cfg:         cfg,
+		ipLimiter:   ratelimit.New(ratelimit.DefaultConfig),
+		challenges:  map[string]*mfaChallenge{},
+		enrollments: map[uint]*totpEnrollment{},
 	}
 }
 
@@ -44,15 +57,18 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token     string        `json:"token"`
-	ExpiresAt string        `json:"expires_at"`
-	User      loginUserInfo `json:"user"`
+	Token         string        `json:"token"`
+	ExpiresAt     string        `json:"expires_at"`
+	User          loginUserInfo `json:"user"`
+	RecoveryCodes []string      `json:"recovery_codes,omitempty"` // set when 2FA was enrolled during this login
 }
 
 type loginUserInfo struct {
-	ID       uint   `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	ID          uint     `json:"id"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	TOTPEnabled bool     `json:"totp_enabled"`
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -65,6 +81,11 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.localLoginAllowed(r) {
+		web.FailErr(w, r, web.ErrLocalLoginDisabled)
+		return
+	}
+
 	var req loginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		web.FailErr(w, r, web.ErrInvalidBody)
@@ -107,44 +128,113 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		h.userRepo.IncrementFailedAttempts(user.ID)
+		h.recordLoginFailure(r, user, "wrong password")
+		web.FailErr(w, r, web.ErrInvalidPassword)
+		return
+	}
+
+	// Password is correct; accounts with a second factor get a challenge instead
+	// of a session, and failed attempts are only reset once it is passed.
+	required, err := h.twoFactorRequired(user)
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	if user.TOTPEnabled || required {
+		h.startMFAChallenge(w, r, user)
+		return
+	}
+
+	h.issueSession(w, r, user, "password", nil)
+}
+
+// recordLoginFailure counts a failed password or second-factor attempt
+// towards the account lock and the per-IP limiter.
+func (h *AuthHandler) recordLoginFailure(r *http.Request, user *database.User, detail string) {
+	h.userRepo.IncrementFailedAttempts(user.ID)
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   user.ID,
+		Username: user.Username,
+		Action:   constants.ActionLoginFailed,
+		Result:   "failed",
+		Detail:   detail,
+		IP:       r.RemoteAddr,
+	})
+	if user.FailedAttempts+1 >= maxFailedAttempts {
+		lockUntil := time.Now().UTC().Add(lockDuration)
+		h.userRepo.LockUntil(user.ID, lockUntil)
 		h.auditRepo.Create(&database.AuditLog{
 			UserID:   user.ID,
 			Username: user.Username,
-			Action:   constants.ActionLoginFailed,
-			Result:   "failed",
-			Detail:   "wrong password",
+			Action:   constants.ActionAccountLocked,
+			Result:   "locked",
+			Detail:   "too many failed attempts",
 			IP:       r.RemoteAddr,
 		})
-		if user.FailedAttempts+1 >= maxFailedAttempts {
-			lockUntil := time.Now().UTC().Add(lockDuration)
-			h.userRepo.LockUntil(user.ID, lockUntil)
-			h.auditRepo.Create(&database.AuditLog{
-				UserID:   user.ID,
-				Username: user.Username,
-				Action:   constants.ActionAccountLocked,
-				Result:   "locked",
-				Detail:   "too many failed attempts",
-				IP:       r.RemoteAddr,
-			})
-			logger.Auth.Warn().Str("username", req.Username).Str("ip", r.RemoteAddr).Msg("account locked")
-		}
-		logger.Auth.Warn().Str("username", req.Username).Str("ip", r.RemoteAddr).Msg("login failed: wrong password")
-		h.ipLimiter.RecordFailure(r.RemoteAddr)
-		web.FailErr(w, r, web.ErrInvalidPassword)
+		logger.Auth.Warn().Str("username", user.Username).Str("ip", r.RemoteAddr).Msg("account locked")
+	}
+	logger.Auth.Warn().Str("username", user.Username).Str("ip", r.RemoteAddr).Msg("login failed: " + detail)
+	h.ipLimiter.RecordFailure(r.RemoteAddr)
+}
+
+// issueSession completes a login and writes the login response.
+func (h *AuthHandler) issueSession(w http.ResponseWriter, r *http.Request, user *database.User, method string, recoveryCodes []string) {
+	token, expiresAt, perms, err := h.startSession(w, r, user, method)
+	if err != nil {
+		web.FailErr(w, r, web.ErrLoginFailed)
 		return
 	}
 
+	web.OK(w, r, loginResponse{
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		User: loginUserInfo{
+			ID:          user.ID,
+			Username:    user.Username,
+			Role:        user.Role,
+			Permissions: perms,
+			TOTPEnabled: user.TOTPEnabled || len(recoveryCodes) > 0,
+		},
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+// startSession clears failure counters, registers a server-side session,
+// signs the JWT, audits the login and sets the session cookie. method records
+// how the user authenticated.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *database.User, method string) (string, time.Time, []string, error) {
 	// Reset failed attempts (both per-user and per-IP)
 	h.userRepo.ResetFailedAttempts(user.ID)
 	h.ipLimiter.Reset(r.RemoteAddr)
 
-	// Generate JWT
-	token, expiresAt, err := web.GenerateJWT(user.ID, user.Username, user.Role, h.cfg.Auth.JWTSecret, h.cfg.JWTExpireDuration())
+	// Generate JWT; a role that no longer exists grants no permissions
+	perms, err := rbac.Resolve(user.Role)
+	if err != nil {
+		logger.Auth.Warn().Str("username", user.Username).Str("role", user.Role).Msg("login with unknown role")
+		perms = []string{}
+	}
+	sid, err := newSessionID()
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	token, expiresAt, err := web.GenerateJWT(user.ID, user.Username, user.Role, perms, sid, h.cfg.Auth.JWTSecret, h.cfg.JWTExpireDuration())
 	if err != nil {
 		logger.Auth.Error().Err(err).Msg("JWT generation failed")
-		web.FailErr(w, r, web.ErrLoginFailed)
-		return
+		return "", time.Time{}, nil, err
+	}
+	now := time.Now().UTC()
+	if err := h.sessionRepo.Create(&database.Session{
+		SessionID:  sid,
+		UserID:     user.ID,
+		Username:   user.Username,
+		Method:     method,
+		IP:         web.ClientIP(r),
+		UserAgent:  r.UserAgent(),
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt.UTC(),
+	}); err != nil {
+		logger.Auth.Error().Err(err).Msg("session registration failed")
+		return "", time.Time{}, nil, err
 	}
 
 	// Audit log
@@ -153,6 +243,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Username: user.Username,
 		Action:   constants.ActionLogin,
 		Result:   "success",
+		Detail:   method,
 		IP:       r.RemoteAddr,
 	})
 
@@ -167,16 +258,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 		// Secure:   true, // TODO: Enable in production with HTTPS
 	})
-
-	web.OK(w, r, loginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt.Format(time.RFC3339),
-		User: loginUserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Role:     user.Role,
-		},
-	})
+	return token, expiresAt, perms, nil
 }
 
 type setupRequest struct {
@@ -275,6 +357,8 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.userRepo.UpdatePassword(user.ID, string(hash))
+	// Sign out every other device; the session making the change stays.
+	revokeUserSessions(user.ID, web.GetSessionID(r), "password_changed")
 
 	h.auditRepo.Create(&database.AuditLog{
 		UserID:   user.ID,
@@ -350,10 +434,16 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		web.FailErr(w, r, web.ErrUserNotFound)
 		return
 	}
+	perms, err := rbac.Resolve(user.Role)
+	if err != nil {
+		perms = []string{}
+	}
 	web.OK(w, r, map[string]interface{}{
-		"id":       user.ID,
-		"username": user.Username,
-		"role":     user.Role,
+		"id":           user.ID,
+		"username":     user.Username,
+		"role":         user.Role,
+		"permissions":  perms,
+		"totp_enabled": user.TOTPEnabled,
 	})
 }
 
@@ -377,6 +467,12 @@ func (h *AuthHandler) NeedsSetup(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if sid := web.GetSessionID(r); sid != "" {
+		if s, err := h.sessionRepo.FindBySessionID(sid); err == nil {
+			h.sessionRepo.Revoke(s.ID, time.Now().UTC(), "logout")
+			web.NotifySessionsRevoked([]string{sid})
+		}
+	}
 	h.auditRepo.Create(&database.AuditLog{
 		UserID:   web.GetUserID(r),
 		Username: web.GetUsername(r),
@@ -393,5 +489,12 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
-	web.OK(w, r, map[string]string{"message": "logged out"})
+	resp := map[string]string{"message": "logged out"}
+	// SSO sessions also end at the provider when the client follows logout_url.
+	if h.oidc != nil {
+		if u := h.oidc.logoutURL(w, r); u != "" {
+			resp["logout_url"] = u
+		}
+	}
+	web.OK(w, r, resp)
 }
@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/totp"
 	"ClawDeckX/internal/webconfig"
 
 	"github.com/glebarez/sqlite"
@@ -31,6 +33,8 @@ func setupTestDB(t *testing.T) func() {
 	err = db.AutoMigrate(
 		&database.User{},
 		&database.AuditLog{},
+		&database.Setting{},
+		&database.Session{},
 	)
 	require.NoError(t, err, "failed to migrate test database")
 
@@ -211,6 +215,101 @@ func TestLogin_FailedAttemptsLock(t *testing.T) {
 
 // ============== Setup Tests ==============
 
+func postJSON(t *testing.T, fn http.HandlerFunc, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	fn(w, req)
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	data, _ := resp["data"].(map[string]interface{})
+	return w.Code, data
+}
+
+func TestLogin_TwoFactor(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	user := createTestUser(t, "admin", "password123")
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	userRepo := database.NewUserRepo()
+	require.NoError(t, userRepo.EnableTOTP(user.ID, secret, 0, totp.HashRecoveryCode("aaaaa-bbbbb")))
+
+	handler := NewAuthHandler(testConfig())
+	login := `{"username":"admin","password":"password123"}`
+
+	code, data := postJSON(t, handler.Login, login)
+	require.Equal(t, http.StatusOK, code)
+	assert.Nil(t, data["token"], "no session before second factor")
+	assert.Equal(t, true, data["mfa_required"])
+	assert.Equal(t, false, data["enroll_required"])
+	mfaToken := data["mfa_token"].(string)
+
+	code, _ = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","code":"000000"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	stored, _ := userRepo.FindByID(user.ID)
+	assert.Equal(t, 1, stored.FailedAttempts)
+
+	otp, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	code, data = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","code":"`+otp+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, data["token"])
+
+	// Challenge is single use.
+	code, _ = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","code":"`+otp+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Recovery codes work once.
+	_, data = postJSON(t, handler.Login, login)
+	mfaToken = data["mfa_token"].(string)
+	code, data = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","recovery_code":"AAAAABBBBB"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, data["token"])
+
+	_, data = postJSON(t, handler.Login, login)
+	mfaToken = data["mfa_token"].(string)
+	code, _ = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","recovery_code":"aaaaa-bbbbb"}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestLogin_TwoFactorPolicyEnroll(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	user := createTestUser(t, "admin", "password123")
+	require.NoError(t, database.NewSettingRepo().Set(settingRequire2FAAdmin, "true"))
+
+	handler := NewAuthHandler(testConfig())
+	code, data := postJSON(t, handler.Login, `{"username":"admin","password":"password123"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, data["enroll_required"])
+	mfaToken := data["mfa_token"].(string)
+
+	code, data = postJSON(t, handler.LoginEnroll, `{"mfa_token":"`+mfaToken+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	secret := data["secret"].(string)
+	assert.Contains(t, data["otpauth_uri"], "otpauth://totp/ClawDeckX:admin")
+
+	otp, err := totp.Code(secret, totp.Step(time.Now()))
+	require.NoError(t, err)
+	code, data = postJSON(t, handler.LoginVerify, `{"mfa_token":"`+mfaToken+`","code":"`+otp+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, data["token"])
+	assert.Len(t, data["recovery_codes"], recoveryCodeCount)
+
+	stored, err := database.NewUserRepo().FindByID(user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.TOTPEnabled)
+	got, err := database.NewUserRepo().TOTPSecret(stored)
+	require.NoError(t, err)
+	assert.Equal(t, secret, got)
+}
+
 func TestSetup_Success(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
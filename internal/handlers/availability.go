@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ClawDeckX/internal/availability"
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/web"
+)
+
+// AvailabilityHandler serves gateway availability reports and SLOs.
+type AvailabilityHandler struct {
+	svc       *availability.Service
+	sloRepo   *database.GatewaySLORepo
+	auditRepo *database.AuditLogRepo
+}
+
+func NewAvailabilityHandler() *AvailabilityHandler {
+	return &AvailabilityHandler{
+		svc:       availability.NewService(),
+		sloRepo:   database.NewGatewaySLORepo(),
+		auditRepo: database.NewAuditLogRepo(),
+	}
+}
+
+// Report returns uptime, MTBF, MTTR, incidents and longest outage per gateway
+// and per bucket. Query: since, until (RFC3339, default the last 30 days),
+// granularity (day, week, month), gateway.
+func (h *AvailabilityHandler) Report(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.report(w, r)
+	if !ok {
+		return
+	}
+	web.OK(w, r, report)
+}
+
+// Export downloads a report as CSV (one row per gateway and bucket) or JSON.
+// Takes the Report query plus format=csv|json.
+func (h *AvailabilityHandler) Export(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.report(w, r)
+	if !ok {
+		return
+	}
+	filename := fmt.Sprintf("availability_%s", time.Now().Format("20060102_150405"))
+
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".csv")
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"GatewayID", "Profile", "Start", "End", "UptimePct", "UpSec", "DownSec",
+			"MaintenanceSec", "UnknownSec", "Incidents", "MTBFSec", "MTTRSec", "LongestOutageSec"})
+		for _, gw := range report.Gateways {
+			for _, b := range gw.Buckets {
+				writer.Write([]string{
+					fmt.Sprintf("%d", gw.GatewayID),
+					gw.ProfileName,
+					b.Start.Format(time.RFC3339),
+					b.End.Format(time.RFC3339),
+					formatOptionalFloat(b.UptimePct),
+					fmt.Sprintf("%d", b.UpSec),
+					fmt.Sprintf("%d", b.DownSec),
+					fmt.Sprintf("%d", b.MaintenanceSec),
+					fmt.Sprintf("%d", b.UnknownSec),
+					fmt.Sprintf("%d", b.Incidents),
+					formatOptionalInt(b.MTBFSec),
+					formatOptionalInt(b.MTTRSec),
+					fmt.Sprintf("%d", b.LongestOutageSec),
+				})
+			}
+		}
+		writer.Flush()
+	default:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// ListSLOs returns the configured SLOs and, under "status", each evaluated
+// per gateway with its error budget and burn rates.
+func (h *AvailabilityHandler) ListSLOs(w http.ResponseWriter, r *http.Request) {
+	slos, err := h.sloRepo.List()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	status, err := h.svc.SLOs()
+	if err != nil {
+		logger.Gateway.Error().Err(err).Msg("failed to evaluate SLOs")
+		web.FailErr(w, r, web.ErrAvailabilityQueryFail)
+		return
+	}
+	web.OK(w, r, map[string]interface{}{
+		"slos":   slos,
+		"status": status,
+	})
+}
+
+// CreateSLO adds an SLO. window_days defaults to 30; an omitted gateway_id
+// applies it to every gateway.
+func (h *AvailabilityHandler) CreateSLO(w http.ResponseWriter, r *http.Request) {
+	var slo database.GatewaySLO
+	if err := json.NewDecoder(r.Body).Decode(&slo); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := availability.NormalizeSLO(&slo); err != nil {
+		web.FailErr(w, r, web.ErrSLOInvalid, err.Error())
+		return
+	}
+	slo.ID = 0
+	if err := h.sloRepo.Create(&slo); err != nil {
+		web.FailErr(w, r, web.ErrSLOSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionSLOCreate, "created SLO: "+slo.Name)
+	web.OK(w, r, slo)
+}
+
+// UpdateSLO replaces an existing SLO (?id=).
+func (h *AvailabilityHandler) UpdateSLO(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.sloRepo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrSLONotFound)
+		return
+	}
+	var slo database.GatewaySLO
+	if err := json.NewDecoder(r.Body).Decode(&slo); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := availability.NormalizeSLO(&slo); err != nil {
+		web.FailErr(w, r, web.ErrSLOInvalid, err.Error())
+		return
+	}
+	slo.ID = existing.ID
+	slo.CreatedAt = existing.CreatedAt
+	if err := h.sloRepo.Update(&slo); err != nil {
+		web.FailErr(w, r, web.ErrSLOSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionSLOUpdate, "updated SLO: "+slo.Name)
+	web.OK(w, r, slo)
+}
+
+// DeleteSLO removes an SLO (?id=).
+func (h *AvailabilityHandler) DeleteSLO(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.sloRepo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrSLONotFound)
+		return
+	}
+	if err := h.sloRepo.Delete(id); err != nil {
+		web.FailErr(w, r, web.ErrSLODeleteFail)
+		return
+	}
+	h.audit(r, constants.ActionSLODelete, "deleted SLO: "+existing.Name)
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+func (h *AvailabilityHandler) report(w http.ResponseWriter, r *http.Request) (*availability.Report, bool) {
+	q := r.URL.Query()
+	until := time.Now().UTC()
+	if v := q.Get("until"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam, "until must be RFC3339")
+			return nil, false
+		}
+		until = t
+	}
+	since := until.AddDate(0, 0, -29)
+	if v := q.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam, "since must be RFC3339")
+			return nil, false
+		}
+		since = t
+	}
+	gatewayID, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return nil, false
+	}
+	if since.After(until) {
+		web.FailErr(w, r, web.ErrAvailabilityInvalid, "since must not be after until")
+		return nil, false
+	}
+	if until.Sub(since) > 2*366*24*time.Hour {
+		web.FailErr(w, r, web.ErrAvailabilityInvalid, "range must not exceed two years")
+		return nil, false
+	}
+	granularity := q.Get("granularity")
+	switch granularity {
+	case "", availability.GranularityDay, availability.GranularityWeek, availability.GranularityMonth:
+	default:
+		web.FailErr(w, r, web.ErrAvailabilityInvalid, "granularity must be day, week or month")
+		return nil, false
+	}
+
+	report, err := h.svc.Report(availability.Query{
+		Since:       since,
+		Until:       until,
+		Granularity: granularity,
+		GatewayID:   gatewayID,
+	})
+	if err != nil {
+		logger.Gateway.Error().Err(err).Msg("failed to compute availability report")
+		web.FailErr(w, r, web.ErrAvailabilityQueryFail)
+		return nil, false
+	}
+	return report, true
+}
+
+func (h *AvailabilityHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', 4, 64)
+}
+
+func formatOptionalInt(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/openclaw"
 	"ClawDeckX/internal/web"
@@ -33,6 +34,9 @@ func (h *BadgeHandler) Counts(w http.ResponseWriter, r *http.Request) {
 	result := map[string]int64{
 		"alerts": unreadAlerts,
 	}
+	if byStatus, err := h.alertRepo.CountByStatus(); err == nil {
+		result["alerts_open"] = byStatus[constants.AlertStatusOpen]
+	}
 
 	// Query pending device pairing requests via gateway RPC
 	if h.gwClient != nil && h.gwClient.IsConnected() {
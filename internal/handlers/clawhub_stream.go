@@ -245,6 +245,10 @@ func (h *ClawHubHandler) streamOutput(pipe io.Reader, sendSSE func(string, map[s
 // DepInstallStreamSSE installs skill deps via SSE (skills.install via Gateway RPC).
 // Runs RPC in background, pushes heartbeat logs every 5s, then pushes result.
 func (h *GWProxyHandler) DepInstallStreamSSE(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params struct {
 		Name      string `json:"name"`
 		InstallId string `json:"installId"`
@@ -296,7 +300,7 @@ func (h *GWProxyHandler) DepInstallStreamSSE(w http.ResponseWriter, r *http.Requ
 	}
 	resultCh := make(chan rpcResult, 1)
 	go func() {
-		data, err := h.client.RequestWithTimeout("skills.install", rpcParams, 5*time.Minute)
+		data, err := client.RequestWithTimeout("skills.install", rpcParams, 5*time.Minute)
 		resultCh <- rpcResult{data, err}
 	}()
 
@@ -393,6 +397,10 @@ waitLoop:
 // DepInstallAsync installs skill deps asynchronously (returns 202, runs in background).
 // Frontend polls skills.status to check completion.
 func (h *GWProxyHandler) DepInstallAsync(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params struct {
 		Name      string `json:"name"`
 		InstallId string `json:"installId"`
@@ -410,7 +418,7 @@ func (h *GWProxyHandler) DepInstallAsync(w http.ResponseWriter, r *http.Request)
 
 	// run install in background
 	go func() {
-		data, err := h.client.RequestWithTimeout("skills.install", rpcParams, 5*time.Minute)
+		data, err := client.RequestWithTimeout("skills.install", rpcParams, 5*time.Minute)
 		if err != nil {
 			logger.Log.Error().Err(err).Str("name", params.Name).Msg("background skill dep install failed")
 			return
@@ -14,6 +14,7 @@ import (
 	"strings"
 	"time"
 
+	"ClawDeckX/internal/alerting"
 	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/logger"
@@ -29,6 +30,7 @@ type DoctorHandler struct {
 	auditRepo *database.AuditLogRepo
 	activity  *database.ActivityRepo
 	alert     *database.AlertRepo
+	alertMgr  *alerting.Manager
 
 	// Cache for collectSessionErrors to avoid hitting sessions.usage RPC on every Summary call.
 	sessErrCache    summarySessionErrors
@@ -51,6 +53,11 @@ func (h *DoctorHandler) SetGWClient(client *openclaw.GWClient) {
 	h.gwClient = client
 }
 
+// SetAlertManager injects the alert lifecycle manager used by SecurityScanAndAlert.
+func (h *DoctorHandler) SetAlertManager(m *alerting.Manager) {
+	h.alertMgr = m
+}
+
 // CheckItem is a single diagnostic check result.
 type CheckItem struct {
 	ID          string `json:"id"`
@@ -1831,24 +1838,38 @@ func (h *DoctorHandler) securityAuditChecks() []CheckItem {
 // SecurityScanAndAlert runs a security audit and writes new critical/warn
 // findings as alerts into the database. It compares against previously stored
 // alert IDs to avoid duplicates. Call this periodically (e.g. every 30 min).
+// With an alert manager, repeat findings bump the existing alert's counter and
+// findings that disappear from the report are auto-resolved.
 func (h *DoctorHandler) SecurityScanAndAlert() {
 	report, err := openclaw.RunSecurityAuditWithGW(h.gwClient)
 	if err != nil || report == nil {
 		return
 	}
+	present := map[string]bool{}
 	for _, f := range report.Findings {
 		if f.Severity == "info" {
 			continue
 		}
 		alertID := "sec:" + f.CheckID
-		existing, _ := h.alert.GetByAlertID(alertID)
-		if existing != nil {
-			continue
-		}
 		risk := "medium"
 		if f.Severity == "critical" {
 			risk = "critical"
 		}
+		if h.alertMgr != nil {
+			present[alertID] = true
+			_, _ = h.alertMgr.Raise(&alerting.Raise{
+				AlertID:  alertID,
+				DedupKey: alertID,
+				Risk:     risk,
+				Message:  f.Title,
+				Detail:   f.Detail,
+			})
+			continue
+		}
+		existing, _ := h.alert.GetByAlertID(alertID)
+		if existing != nil {
+			continue
+		}
 		_ = h.alert.Create(&database.Alert{
 			AlertID:   alertID,
 			Risk:      risk,
@@ -1857,4 +1878,7 @@ func (h *DoctorHandler) SecurityScanAndAlert() {
 			CreatedAt: time.Now(),
 		})
 	}
+	if h.alertMgr != nil {
+		h.alertMgr.ResolveMissing("sec:", present)
+	}
 }
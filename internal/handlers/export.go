@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/web"
 )
 
@@ -129,12 +130,23 @@ func (h *ExportHandler) ExportAlerts(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// ExportAuditLogs exports audit log records.
+// ExportAuditLogs exports audit log records. format=chain exports the whole
+// hash chain with its checkpoints as NDJSON for offline verification
+// (`clawdeckx audit verify <file>`); filters do not apply to it.
 func (h *ExportHandler) ExportAuditLogs(w http.ResponseWriter, r *http.Request) {
 	format := r.URL.Query().Get("format")
 	if format == "" {
 		format = "json"
 	}
+	if format == "chain" {
+		filename := fmt.Sprintf("audit_chain_%s.ndjson", time.Now().Format("20060102_150405"))
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		if err := h.auditRepo.ExportChain(w); err != nil {
+			logger.Audit.Error().Err(err).Msg("audit chain export failed")
+		}
+		return
+	}
 
 	filter := database.AuditFilter{
 		Page:      1,
@@ -157,7 +169,7 @@ func (h *ExportHandler) ExportAuditLogs(w http.ResponseWriter, r *http.Request)
 		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 		w.Header().Set("Content-Disposition", "attachment; filename="+filename+".csv")
 		writer := csv.NewWriter(w)
-		writer.Write([]string{"ID", "UserID", "Username", "Action", "Result", "Detail", "IP", "CreatedAt"})
+		writer.Write([]string{"ID", "UserID", "Username", "Action", "Result", "Detail", "IP", "CreatedAt", "PrevHash", "Hash"})
 		for _, l := range logs {
 			writer.Write([]string{
 				fmt.Sprintf("%d", l.ID),
@@ -168,6 +180,8 @@ func (h *ExportHandler) ExportAuditLogs(w http.ResponseWriter, r *http.Request)
 				l.Detail,
 				l.IP,
 				l.CreatedAt.Format(time.RFC3339),
+				l.PrevHash,
+				l.Hash,
 			})
 		}
 		writer.Flush()
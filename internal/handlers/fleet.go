@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"ClawDeckX/internal/fleet"
+	"ClawDeckX/internal/web"
+)
+
+// FleetHandler serves the aggregated view over all connected gateways.
+type FleetHandler struct {
+	fleet *fleet.Manager
+}
+
+func NewFleetHandler(f *fleet.Manager) *FleetHandler {
+	return &FleetHandler{fleet: f}
+}
+
+// FleetGateway is one row of the fleet overview.
+type FleetGateway struct {
+	fleet.Gateway
+	Connected      bool                   `json:"connected"`
+	Health         map[string]interface{} `json:"health"`
+	Sessions       int                    `json:"sessions"`
+	SessionTokens  int64                  `json:"session_tokens"`
+	TodayTokens    float64                `json:"today_tokens"`
+	TodayCost      float64                `json:"today_cost"`
+	UsageAvailable bool                   `json:"usage_available"`
+	Error          string                 `json:"error,omitempty"`
+}
+
+// FleetTotals aggregates the overview rows.
+type FleetTotals struct {
+	Gateways      int     `json:"gateways"`
+	Connected     int     `json:"connected"`
+	Sessions      int     `json:"sessions"`
+	SessionTokens int64   `json:"session_tokens"`
+	TodayTokens   float64 `json:"today_tokens"`
+	TodayCost     float64 `json:"today_cost"`
+}
+
+// Overview queries every gateway concurrently for health, sessions and today's cost.
+// GET /api/v1/fleet
+func (h *FleetHandler) Overview(w http.ResponseWriter, r *http.Request) {
+	gateways := h.fleet.Gateways()
+	rows := make([]FleetGateway, len(gateways))
+
+	var wg sync.WaitGroup
+	for i := range gateways {
+		rows[i] = FleetGateway{Gateway: gateways[i]}
+		wg.Add(1)
+		go func(row *FleetGateway) {
+			defer wg.Done()
+			client := row.Client
+			row.Connected = client.IsConnected()
+			row.Health = client.HealthStatus()
+			if !row.Connected {
+				row.Error = client.LastError()
+				return
+			}
+			u, err := fetchGatewayUsage(client)
+			if err != nil {
+				row.Error = err.Error()
+				return
+			}
+			row.Sessions = u.sessions
+			row.SessionTokens = u.sessionTokens
+			row.TodayTokens = u.todayTokens
+			row.TodayCost = u.todayCost
+			row.UsageAvailable = u.usageAvailable
+		}(&rows[i])
+	}
+	wg.Wait()
+
+	totals := FleetTotals{Gateways: len(rows)}
+	for _, row := range rows {
+		if row.Connected {
+			totals.Connected++
+		}
+		totals.Sessions += row.Sessions
+		totals.SessionTokens += row.SessionTokens
+		totals.TodayTokens += row.TodayTokens
+		totals.TodayCost += row.TodayCost
+	}
+
+	web.OK(w, r, map[string]interface{}{
+		"gateways": rows,
+		"totals":   totals,
+	})
+}
+
+// parseGatewayQuery parses the optional ?gateway=<profile id> selector.
+// A nil result means no selector was given.
+func parseGatewayQuery(r *http.Request) (*uint, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get("gateway"))
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	v := uint(id)
+	return &v, nil
+}
@@ -436,12 +436,18 @@ func (h *GatewayHandler) Lifecycle(w http.ResponseWriter, r *http.Request) {
 	if pageSize > 100 {
 		pageSize = 100
 	}
+	gatewayID, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
 
 	filter := database.GatewayLifecycleFilter{
 		Page:        page,
 		PageSize:    pageSize,
 		EventType:   q.Get("event_type"),
 		GatewayHost: q.Get("gateway_host"),
+		GatewayID:   gatewayID,
 		Since:       q.Get("since"),
 		Until:       q.Get("until"),
 	}
@@ -24,14 +24,21 @@ type GatewayProfileHandler struct {
 	auditRepo       *database.AuditLogRepo
 	gwClient        *openclaw.GWClient
 	gwService       *openclaw.Service
-	onProfileSwitch func(host string, port int, name string, isRemote bool)
+	onProfileSwitch func(id uint, host string, port int, name string, isRemote bool)
+	onChange        func()
 }
 
 // SetProfileSwitchCallback sets a callback invoked after a profile is activated/switched.
-func (h *GatewayProfileHandler) SetProfileSwitchCallback(fn func(host string, port int, name string, isRemote bool)) {
+// id is 0 when no profile is left and the local default gateway is used.
+func (h *GatewayProfileHandler) SetProfileSwitchCallback(fn func(id uint, host string, port int, name string, isRemote bool)) {
 	h.onProfileSwitch = fn
 }
 
+// SetProfilesChangedCallback sets a callback invoked after profiles are created, updated or deleted.
+func (h *GatewayProfileHandler) SetProfilesChangedCallback(fn func()) {
+	h.onChange = fn
+}
+
 func NewGatewayProfileHandler() *GatewayProfileHandler {
 	return &GatewayProfileHandler{
 		repo:      database.NewGatewayProfileRepo(),
@@ -71,10 +78,11 @@ func (h *GatewayProfileHandler) List(w http.ResponseWriter, r *http.Request) {
 // Create creates a gateway profile.
 func (h *GatewayProfileHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name  string `json:"name"`
-		Host  string `json:"host"`
-		Port  int    `json:"port"`
-		Token string `json:"token"`
+		Name    string `json:"name"`
+		Host    string `json:"host"`
+		Port    int    `json:"port"`
+		Token   string `json:"token"`
+		Enabled bool   `json:"enabled"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		web.FailErr(w, r, web.ErrInvalidBody)
@@ -90,15 +98,17 @@ func (h *GatewayProfileHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	profile := &database.GatewayProfile{
-		Name:  req.Name,
-		Host:  req.Host,
-		Port:  req.Port,
-		Token: req.Token,
+		Name:    req.Name,
+		Host:    req.Host,
+		Port:    req.Port,
+		Token:   req.Token,
+		Enabled: req.Enabled,
 	}
 	if err := h.repo.Create(profile); err != nil {
 		web.FailErr(w, r, web.ErrGWProfileSaveFail)
 		return
 	}
+	h.notifyChange()
 
 	h.auditRepo.Create(&database.AuditLog{
 		UserID:   web.GetUserID(r),
@@ -129,10 +139,11 @@ func (h *GatewayProfileHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name  string `json:"name"`
-		Host  string `json:"host"`
-		Port  int    `json:"port"`
-		Token string `json:"token"`
+		Name    string `json:"name"`
+		Host    string `json:"host"`
+		Port    int    `json:"port"`
+		Token   string `json:"token"`
+		Enabled *bool  `json:"enabled"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		web.FailErr(w, r, web.ErrInvalidBody)
@@ -150,11 +161,15 @@ func (h *GatewayProfileHandler) Update(w http.ResponseWriter, r *http.Request) {
 		profile.Port = req.Port
 	}
 	profile.Token = req.Token
+	if req.Enabled != nil {
+		profile.Enabled = *req.Enabled
+	}
 
 	if err := h.repo.Update(profile); err != nil {
 		web.FailErr(w, r, web.ErrGWProfileSaveFail)
 		return
 	}
+	h.notifyChange()
 
 	// if updating the active gateway, auto-reconnect
 	if profile.IsActive && h.gwClient != nil {
@@ -194,6 +209,7 @@ func (h *GatewayProfileHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		web.FailErr(w, r, web.ErrGWProfileDeleteFail)
 		return
 	}
+	h.notifyChange()
 
 	// If we deleted the active gateway, fall back to another profile or local default
 	if wasActive {
@@ -216,7 +232,7 @@ func (h *GatewayProfileHandler) Delete(w http.ResponseWriter, r *http.Request) {
 				})
 			}
 			if h.onProfileSwitch != nil {
-				h.onProfileSwitch("127.0.0.1", 18789, "Local Gateway", false)
+				h.onProfileSwitch(0, "127.0.0.1", 18789, "Local Gateway", false)
 			}
 		}
 	}
@@ -366,7 +382,13 @@ func (h *GatewayProfileHandler) applyProfile(p *database.GatewayProfile) {
 		})
 	}
 	if h.onProfileSwitch != nil {
-		h.onProfileSwitch(p.Host, p.Port, p.Name, isRemote)
+		h.onProfileSwitch(p.ID, p.Host, p.Port, p.Name, isRemote)
+	}
+}
+
+func (h *GatewayProfileHandler) notifyChange() {
+	if h.onChange != nil {
+		h.onChange()
 	}
 }
 
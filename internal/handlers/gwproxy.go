@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"ClawDeckX/internal/fleet"
 	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/openclaw"
 	"ClawDeckX/internal/web"
@@ -15,21 +16,58 @@ import (
 // GWProxyHandler proxies Gateway WebSocket methods as REST APIs.
 type GWProxyHandler struct {
 	client *openclaw.GWClient
+	fleet  *fleet.Manager
 }
 
 func NewGWProxyHandler(client *openclaw.GWClient) *GWProxyHandler {
 	return &GWProxyHandler{client: client}
 }
 
+// SetFleet injects the fleet manager used to resolve the ?gateway= selector.
+func (h *GWProxyHandler) SetFleet(f *fleet.Manager) {
+	h.fleet = f
+}
+
+// gateway resolves the optional ?gateway=<profile id> selector to a client,
+// defaulting to the active gateway. It writes the error response on failure.
+func (h *GWProxyHandler) gateway(w http.ResponseWriter, r *http.Request) (*openclaw.GWClient, bool) {
+	id, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return nil, false
+	}
+	if id == nil {
+		return h.client, true
+	}
+	if h.fleet == nil {
+		web.FailErr(w, r, web.ErrGWFleetNotConnected)
+		return nil, false
+	}
+	client, ok := h.fleet.Client(*id)
+	if !ok {
+		web.FailErr(w, r, web.ErrGWFleetNotConnected)
+		return nil, false
+	}
+	return client, true
+}
+
 // Status returns Gateway WS client connection status and diagnostics.
 func (h *GWProxyHandler) Status(w http.ResponseWriter, r *http.Request) {
-	web.OK(w, r, h.client.ConnectionStatus())
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	web.OK(w, r, client.ConnectionStatus())
 }
 
 // Reconnect triggers GWClient reconnect using current config.
 func (h *GWProxyHandler) Reconnect(w http.ResponseWriter, r *http.Request) {
-	cfg := h.client.GetConfig()
-	h.client.Reconnect(cfg)
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	cfg := client.GetConfig()
+	client.Reconnect(cfg)
 	web.OK(w, r, map[string]interface{}{
 		"message": "reconnecting",
 		"host":    cfg.Host,
@@ -39,7 +77,11 @@ func (h *GWProxyHandler) Reconnect(w http.ResponseWriter, r *http.Request) {
 
 // Health returns Gateway health info.
 func (h *GWProxyHandler) Health(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("health", map[string]interface{}{"probe": false})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("health", map[string]interface{}{"probe": false})
 	if err != nil {
 		web.Fail(w, r, "GW_HEALTH_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -49,7 +91,11 @@ func (h *GWProxyHandler) Health(w http.ResponseWriter, r *http.Request) {
 
 // GWStatus returns Gateway status info.
 func (h *GWProxyHandler) GWStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("status", nil)
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("status", nil)
 	if err != nil {
 		web.Fail(w, r, "GW_STATUS_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -59,7 +105,11 @@ func (h *GWProxyHandler) GWStatus(w http.ResponseWriter, r *http.Request) {
 
 // SessionsList returns session list.
 func (h *GWProxyHandler) SessionsList(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("sessions.list", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("sessions.list", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_SESSIONS_LIST_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -69,6 +119,10 @@ func (h *GWProxyHandler) SessionsList(w http.ResponseWriter, r *http.Request) {
 
 // SessionsPreview returns session previews.
 func (h *GWProxyHandler) SessionsPreview(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params struct {
 		Keys     []string `json:"keys"`
 		Limit    int      `json:"limit,omitempty"`
@@ -84,7 +138,7 @@ func (h *GWProxyHandler) SessionsPreview(w http.ResponseWriter, r *http.Request)
 	if params.MaxChars == 0 {
 		params.MaxChars = 240
 	}
-	data, err := h.client.Request("sessions.preview", params)
+	data, err := client.Request("sessions.preview", params)
 	if err != nil {
 		web.Fail(w, r, "GW_SESSIONS_PREVIEW_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -94,6 +148,10 @@ func (h *GWProxyHandler) SessionsPreview(w http.ResponseWriter, r *http.Request)
 
 // SessionsReset resets a session.
 func (h *GWProxyHandler) SessionsReset(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params struct {
 		Key string `json:"key"`
 	}
@@ -101,7 +159,7 @@ func (h *GWProxyHandler) SessionsReset(w http.ResponseWriter, r *http.Request) {
 		web.Fail(w, r, "INVALID_PARAMS", "key is required", http.StatusBadRequest)
 		return
 	}
-	data, err := h.client.Request("sessions.reset", params)
+	data, err := client.Request("sessions.reset", params)
 	if err != nil {
 		web.Fail(w, r, "GW_SESSIONS_RESET_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -111,6 +169,10 @@ func (h *GWProxyHandler) SessionsReset(w http.ResponseWriter, r *http.Request) {
 
 // SessionsDelete deletes a session.
 func (h *GWProxyHandler) SessionsDelete(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params struct {
 		Key              string `json:"key"`
 		DeleteTranscript bool   `json:"deleteTranscript"`
@@ -119,7 +181,7 @@ func (h *GWProxyHandler) SessionsDelete(w http.ResponseWriter, r *http.Request)
 		web.Fail(w, r, "INVALID_PARAMS", "key is required", http.StatusBadRequest)
 		return
 	}
-	data, err := h.client.Request("sessions.delete", params)
+	data, err := client.Request("sessions.delete", params)
 	if err != nil {
 		web.Fail(w, r, "GW_SESSIONS_DELETE_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -129,7 +191,11 @@ func (h *GWProxyHandler) SessionsDelete(w http.ResponseWriter, r *http.Request)
 
 // ModelsList returns model list.
 func (h *GWProxyHandler) ModelsList(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("models.list", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("models.list", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_MODELS_LIST_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -139,7 +205,11 @@ func (h *GWProxyHandler) ModelsList(w http.ResponseWriter, r *http.Request) {
 
 // UsageStatus returns usage status.
 func (h *GWProxyHandler) UsageStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("usage.status", nil)
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("usage.status", nil)
 	if err != nil {
 		web.Fail(w, r, "GW_USAGE_STATUS_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -149,6 +219,10 @@ func (h *GWProxyHandler) UsageStatus(w http.ResponseWriter, r *http.Request) {
 
 // UsageCost returns usage cost.
 func (h *GWProxyHandler) UsageCost(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	q := r.URL.Query()
 	params := map[string]interface{}{}
 	if v := q.Get("days"); v != "" {
@@ -162,7 +236,7 @@ func (h *GWProxyHandler) UsageCost(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("endDate"); v != "" {
 		params["endDate"] = v
 	}
-	data, err := h.client.RequestWithTimeout("usage.cost", params, 30*time.Second)
+	data, err := client.RequestWithTimeout("usage.cost", params, 30*time.Second)
 	if err != nil {
 		web.Fail(w, r, "GW_USAGE_COST_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -172,6 +246,10 @@ func (h *GWProxyHandler) UsageCost(w http.ResponseWriter, r *http.Request) {
 
 // SessionsUsage returns session usage details.
 func (h *GWProxyHandler) SessionsUsage(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	q := r.URL.Query()
 	params := map[string]interface{}{}
 	if v := q.Get("startDate"); v != "" {
@@ -189,7 +267,7 @@ func (h *GWProxyHandler) SessionsUsage(w http.ResponseWriter, r *http.Request) {
 		params["key"] = v
 	}
 	params["includeContextWeight"] = true
-	data, err := h.client.RequestWithTimeout("sessions.usage", params, 30*time.Second)
+	data, err := client.RequestWithTimeout("sessions.usage", params, 30*time.Second)
 	if err != nil {
 		web.Fail(w, r, "GW_SESSIONS_USAGE_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -199,7 +277,11 @@ func (h *GWProxyHandler) SessionsUsage(w http.ResponseWriter, r *http.Request) {
 
 // SkillsStatus returns skills status.
 func (h *GWProxyHandler) SkillsStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("skills.status", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("skills.status", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_SKILLS_STATUS_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -209,7 +291,11 @@ func (h *GWProxyHandler) SkillsStatus(w http.ResponseWriter, r *http.Request) {
 
 // ConfigGet returns OpenClaw config.
 func (h *GWProxyHandler) ConfigGet(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("config.get", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("config.get", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_CONFIG_GET_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -219,7 +305,11 @@ func (h *GWProxyHandler) ConfigGet(w http.ResponseWriter, r *http.Request) {
 
 // AgentsList returns agent list.
 func (h *GWProxyHandler) AgentsList(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("agents.list", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("agents.list", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_AGENTS_LIST_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -229,7 +319,11 @@ func (h *GWProxyHandler) AgentsList(w http.ResponseWriter, r *http.Request) {
 
 // CronList returns cron job list.
 func (h *GWProxyHandler) CronList(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("cron.list", map[string]interface{}{
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("cron.list", map[string]interface{}{
 		"includeDisabled": true,
 	})
 	if err != nil {
@@ -241,7 +335,11 @@ func (h *GWProxyHandler) CronList(w http.ResponseWriter, r *http.Request) {
 
 // CronStatus returns cron job status.
 func (h *GWProxyHandler) CronStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("cron.status", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("cron.status", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_CRON_STATUS_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -251,7 +349,11 @@ func (h *GWProxyHandler) CronStatus(w http.ResponseWriter, r *http.Request) {
 
 // ChannelsStatus returns channel status.
 func (h *GWProxyHandler) ChannelsStatus(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("channels.status", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("channels.status", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_CHANNELS_STATUS_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -261,6 +363,10 @@ func (h *GWProxyHandler) ChannelsStatus(w http.ResponseWriter, r *http.Request)
 
 // LogsTail returns remote OpenClaw runtime logs.
 func (h *GWProxyHandler) LogsTail(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var params interface{}
 	p := map[string]interface{}{}
 	if v := r.URL.Query().Get("lines"); v != "" {
@@ -281,7 +387,7 @@ func (h *GWProxyHandler) LogsTail(w http.ResponseWriter, r *http.Request) {
 	if len(p) > 0 {
 		params = p
 	}
-	data, err := h.client.RequestWithTimeout("logs.tail", params, 30*time.Second)
+	data, err := client.RequestWithTimeout("logs.tail", params, 30*time.Second)
 	if err != nil {
 		web.Fail(w, r, "GW_LOGS_TAIL_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -291,7 +397,11 @@ func (h *GWProxyHandler) LogsTail(w http.ResponseWriter, r *http.Request) {
 
 // ConfigGetRemote returns remote OpenClaw config via Gateway WS.
 func (h *GWProxyHandler) ConfigGetRemote(w http.ResponseWriter, r *http.Request) {
-	data, err := h.client.Request("config.get", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	data, err := client.Request("config.get", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_CONFIG_GET_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -302,6 +412,10 @@ func (h *GWProxyHandler) ConfigGetRemote(w http.ResponseWriter, r *http.Request)
 // ConfigSetRemote updates remote OpenClaw config.
 // Retries automatically on optimistic concurrency conflict (INVALID_REQUEST: config changed).
 func (h *GWProxyHandler) ConfigSetRemote(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var body map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		web.Fail(w, r, "INVALID_PARAMS", "invalid request body", http.StatusBadRequest)
@@ -317,7 +431,7 @@ func (h *GWProxyHandler) ConfigSetRemote(w http.ResponseWriter, r *http.Request)
 
 		// On retry, refresh baseHash from Gateway
 		if attempt > 0 {
-			freshHash := h.fetchFreshBaseHash()
+			freshHash := fetchFreshBaseHash(client)
 			if freshHash != "" {
 				rpcParams["baseHash"] = freshHash
 			}
@@ -339,7 +453,7 @@ func (h *GWProxyHandler) ConfigSetRemote(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		data, err := h.client.RequestWithTimeout("config.set", rpcParams, 15*time.Second)
+		data, err := client.RequestWithTimeout("config.set", rpcParams, 15*time.Second)
 		if err != nil {
 			if isConfigConflictError(err) && attempt < maxRetries-1 {
 				logger.Config.Warn().Int("attempt", attempt+1).Msg("config.set conflict, retrying with fresh baseHash")
@@ -363,6 +477,10 @@ func (h *GWProxyHandler) ConfigReload(w http.ResponseWriter, r *http.Request) {
 
 // SessionsPreviewMessages returns session message previews.
 func (h *GWProxyHandler) SessionsPreviewMessages(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	key := r.URL.Query().Get("key")
 	if key == "" {
 		web.Fail(w, r, "INVALID_PARAMS", "key is required", http.StatusBadRequest)
@@ -374,7 +492,7 @@ func (h *GWProxyHandler) SessionsPreviewMessages(w http.ResponseWriter, r *http.
 			limit = int(n)
 		}
 	}
-	data, err := h.client.RequestWithTimeout("sessions.preview", map[string]interface{}{
+	data, err := client.RequestWithTimeout("sessions.preview", map[string]interface{}{
 		"keys":     []string{key},
 		"limit":    limit,
 		"maxChars": 500,
@@ -388,12 +506,16 @@ func (h *GWProxyHandler) SessionsPreviewMessages(w http.ResponseWriter, r *http.
 
 // SessionsHistory returns full session history.
 func (h *GWProxyHandler) SessionsHistory(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	key := r.URL.Query().Get("key")
 	if key == "" {
 		web.Fail(w, r, "INVALID_PARAMS", "key is required", http.StatusBadRequest)
 		return
 	}
-	data, err := h.client.RequestWithTimeout("chat.history", map[string]interface{}{
+	data, err := client.RequestWithTimeout("chat.history", map[string]interface{}{
 		"sessionKey": key,
 	}, 30*time.Second)
 	if err != nil {
@@ -406,6 +528,10 @@ func (h *GWProxyHandler) SessionsHistory(w http.ResponseWriter, r *http.Request)
 // SkillsConfigure configures a skill (enable/disable/env vars etc.).
 // Retries the full get→modify→set cycle on optimistic concurrency conflicts.
 func (h *GWProxyHandler) SkillsConfigure(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	// parse request body first (can only read r.Body once)
 	var params struct {
 		SkillKey string                 `json:"skillKey"`
@@ -422,7 +548,7 @@ func (h *GWProxyHandler) SkillsConfigure(w http.ResponseWriter, r *http.Request)
 	const maxRetries = 3
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// get current config (fresh on each attempt)
-		raw, err := h.client.Request("config.get", map[string]interface{}{})
+		raw, err := client.Request("config.get", map[string]interface{}{})
 		if err != nil {
 			web.Fail(w, r, "GW_CONFIG_GET_FAILED", err.Error(), http.StatusBadGateway)
 			return
@@ -508,7 +634,7 @@ func (h *GWProxyHandler) SkillsConfigure(w http.ResponseWriter, r *http.Request)
 		if baseHash != "" {
 			setParams["baseHash"] = baseHash
 		}
-		saveData, err := h.client.RequestWithTimeout("config.set", setParams, 15*time.Second)
+		saveData, err := client.RequestWithTimeout("config.set", setParams, 15*time.Second)
 		if err != nil {
 			if isConfigConflictError(err) && attempt < maxRetries-1 {
 				logger.Config.Warn().Int("attempt", attempt+1).Str("skillKey", params.SkillKey).Msg("skills.configure config.set conflict, retrying")
@@ -526,7 +652,11 @@ func (h *GWProxyHandler) SkillsConfigure(w http.ResponseWriter, r *http.Request)
 
 // SkillsConfigGet returns skill config (skills.entries).
 func (h *GWProxyHandler) SkillsConfigGet(w http.ResponseWriter, r *http.Request) {
-	raw, err := h.client.Request("config.get", map[string]interface{}{})
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
+	raw, err := client.Request("config.get", map[string]interface{}{})
 	if err != nil {
 		web.Fail(w, r, "GW_CONFIG_GET_FAILED", err.Error(), http.StatusBadGateway)
 		return
@@ -569,8 +699,8 @@ func isConfigConflictError(err error) bool {
 }
 
 // fetchFreshBaseHash fetches a fresh config snapshot from Gateway and returns its hash.
-func (h *GWProxyHandler) fetchFreshBaseHash() string {
-	data, err := h.client.RequestWithTimeout("config.get", map[string]interface{}{}, 10*time.Second)
+func fetchFreshBaseHash(client *openclaw.GWClient) string {
+	data, err := client.RequestWithTimeout("config.get", map[string]interface{}{}, 10*time.Second)
 	if err != nil {
 		return ""
 	}
@@ -607,6 +737,10 @@ func proxyTimeoutForMethod(method string) time.Duration {
 
 // GenericProxy forwards any method to the Gateway.
 func (h *GWProxyHandler) GenericProxy(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.gateway(w, r)
+	if !ok {
+		return
+	}
 	var req struct {
 		Method string      `json:"method"`
 		Params interface{} `json:"params,omitempty"`
@@ -616,10 +750,10 @@ func (h *GWProxyHandler) GenericProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	timeout := proxyTimeoutForMethod(req.Method)
-	data, err := h.client.RequestWithTimeout(req.Method, req.Params, timeout)
+	data, err := client.RequestWithTimeout(req.Method, req.Params, timeout)
 	// One fast retry for chat history to smooth transient gateway hiccups.
 	if err != nil && req.Method == "chat.history" {
-		data, err = h.client.RequestWithTimeout(req.Method, req.Params, timeout)
+		data, err = client.RequestWithTimeout(req.Method, req.Params, timeout)
 	}
 	if err != nil {
 		web.Fail(w, r, "GW_PROXY_FAILED", err.Error(), http.StatusBadGateway)
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/metrics"
+	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/secretutil"
+	"ClawDeckX/internal/snapshots"
+	"ClawDeckX/internal/web"
+	"ClawDeckX/internal/webconfig"
+)
+
+// gatewayUsageTTL bounds how often a scrape may hit the gateway RPCs.
+const gatewayUsageTTL = 60 * time.Second
+
+// MetricsHandler serves the Prometheus /metrics endpoint.
+type MetricsHandler struct {
+	cfg          webconfig.MetricsConfig
+	gwClient     *openclaw.GWClient
+	wsHub        *web.WSHub
+	activityRepo *database.ActivityRepo
+	alertRepo    *database.AlertRepo
+	scheduler    *snapshots.Scheduler
+
+	httpLatency     *metrics.HistogramVec
+	lifecycleEvents *metrics.CounterVec
+
+	usageMu sync.Mutex
+	usage   *gatewayUsage
+	usageAt time.Time
+}
+
+type gatewayUsage struct {
+	sessions       int
+	sessionTokens  int64
+	todayTokens    float64
+	todayCost      float64
+	usageAvailable bool
+}
+
+func NewMetricsHandler(cfg webconfig.MetricsConfig, wsHub *web.WSHub) *MetricsHandler {
+	return &MetricsHandler{
+		cfg:          cfg,
+		wsHub:        wsHub,
+		activityRepo: database.NewActivityRepo(),
+		alertRepo:    database.NewAlertRepo(),
+		httpLatency: metrics.NewHistogramVec("clawdeckx_http_request_duration_seconds",
+			"HTTP request latency by method, route and status class.", metrics.DefaultBuckets),
+		lifecycleEvents: metrics.NewCounterVec("clawdeckx_gateway_lifecycle_events_total",
+			"Gateway lifecycle events recorded since process start."),
+	}
+}
+
+// SetGWClient injects the Gateway client reference.
+func (h *MetricsHandler) SetGWClient(client *openclaw.GWClient) {
+	h.gwClient = client
+}
+
+// SetScheduler injects the snapshot scheduler whose status is exported.
+func (h *MetricsHandler) SetScheduler(s *snapshots.Scheduler) {
+	h.scheduler = s
+}
+
+// HTTPLatency returns the request latency histogram fed by web.MetricsMiddleware.
+func (h *MetricsHandler) HTTPLatency() *metrics.HistogramVec {
+	return h.httpLatency
+}
+
+// ObserveLifecycle counts a recorded gateway lifecycle event.
+func (h *MetricsHandler) ObserveLifecycle(ev *database.GatewayLifecycle) {
+	h.lifecycleEvents.Inc(metrics.L("event", ev.EventType))
+}
+
+// Serve writes all metrics in Prometheus text format.
+// GET /metrics
+func (h *MetricsHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(w)
+
+	h.writeGateway(mw)
+	h.lifecycleEvents.WriteTo(mw)
+	h.writeActivities(mw)
+	h.writeAlerts(mw)
+	h.writeScheduler(mw)
+	h.writeUsage(mw)
+	h.httpLatency.WriteTo(mw)
+
+	h.writeWebSocket(mw)
+
+	_ = mw.Flush()
+}
+
+func (h *MetricsHandler) writeWebSocket(mw *metrics.Writer) {
+	var st web.HubStats
+	if h.wsHub != nil {
+		st = h.wsHub.Stats()
+	}
+	queued, lag := 0, uint64(0)
+	for _, c := range st.Clients {
+		queued += c.Queued
+		lag += c.Lag
+	}
+	mw.Gauge("clawdeckx_websocket_clients", "Connected WebSocket and SSE event stream clients.", float64(len(st.Clients)))
+	mw.Gauge("clawdeckx_websocket_queued_messages", "Messages queued to event stream clients.", float64(queued))
+	mw.Gauge("clawdeckx_websocket_lag_messages", "Messages published but not yet written to event stream clients.", float64(lag))
+	mw.Header("clawdeckx_websocket_evicted_total", "Event stream clients disconnected for a full send queue.", "counter")
+	mw.Sample("clawdeckx_websocket_evicted_total", nil, float64(st.Evicted))
+}
+
+// authorized allows loopback scrapers, and remote ones presenting the configured bearer token.
+func (h *MetricsHandler) authorized(r *http.Request) bool {
+	if web.IsLoopbackRequest(r) {
+		return true
+	}
+	if h.cfg.Token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return secretutil.SecretEqual(strings.TrimPrefix(auth, "Bearer "), h.cfg.Token)
+}
+
+func (h *MetricsHandler) writeGateway(mw *metrics.Writer) {
+	connected := h.gwClient != nil && h.gwClient.IsConnected()
+	mw.Gauge("clawdeckx_gateway_connected", "Whether the gateway WebSocket is connected (1) or not (0).", boolGauge(connected))
+
+	if h.gwClient == nil {
+		return
+	}
+	hs := h.gwClient.HealthStatus()
+	enabled, _ := hs["enabled"].(bool)
+	mw.Gauge("clawdeckx_gateway_health_check_enabled", "Whether gateway health checks are enabled.", boolGauge(enabled))
+	if v, ok := hs["fail_count"].(int); ok {
+		mw.Gauge("clawdeckx_gateway_health_check_failures", "Consecutive failed gateway health checks.", float64(v))
+	}
+	if v, ok := hs["max_fails"].(int); ok {
+		mw.Gauge("clawdeckx_gateway_health_check_max_failures", "Failed health checks tolerated before the gateway is restarted.", float64(v))
+	}
+	if v, _ := hs["last_ok"].(string); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			mw.Gauge("clawdeckx_gateway_health_check_last_success_timestamp_seconds", "Unix time of the last successful health check.", float64(t.Unix()))
+		}
+	}
+}
+
+func (h *MetricsHandler) writeActivities(mw *metrics.Writer) {
+	rows, err := h.activityRepo.CountByCategoryAndRisk()
+	if err != nil {
+		return
+	}
+	mw.Header("clawdeckx_activities", "Stored activity records by category and risk.", "gauge")
+	for _, row := range rows {
+		mw.Sample("clawdeckx_activities", metrics.L("category", row.Category, "risk", row.Risk), float64(row.Count))
+	}
+}
+
+func (h *MetricsHandler) writeAlerts(mw *metrics.Writer) {
+	rows, err := h.alertRepo.CountByStatusAndRisk()
+	if err != nil {
+		return
+	}
+	mw.Header("clawdeckx_alerts", "Stored alerts by state and risk.", "gauge")
+	for _, row := range rows {
+		mw.Sample("clawdeckx_alerts", metrics.L("status", row.Status, "risk", row.Risk), float64(row.Count))
+	}
+}
+
+func (h *MetricsHandler) writeScheduler(mw *metrics.Writer) {
+	if h.scheduler == nil {
+		return
+	}
+	if cfg, err := h.scheduler.GetConfig(); err == nil {
+		mw.Gauge("clawdeckx_snapshot_schedule_enabled", "Whether scheduled snapshots are enabled.", boolGauge(cfg.Enabled))
+	}
+	status, err := h.scheduler.GetStatus()
+	if err != nil {
+		return
+	}
+	mw.Gauge("clawdeckx_snapshot_schedule_running", "Whether a scheduled snapshot is currently running.", boolGauge(status.Running))
+	mw.Header("clawdeckx_snapshot_schedule_last_status", "Status of the last scheduled snapshot run (1 for the current status).", "gauge")
+	for _, st := range []string{snapshots.ScheduleStatusNever, snapshots.ScheduleStatusSuccess, snapshots.ScheduleStatusFailed, snapshots.ScheduleStatusSkipped} {
+		mw.Sample("clawdeckx_snapshot_schedule_last_status", metrics.L("status", st), boolGauge(status.LastStatus == st))
+	}
+	if t, err := time.Parse(time.RFC3339, status.LastRunAt); err == nil {
+		mw.Gauge("clawdeckx_snapshot_schedule_last_run_timestamp_seconds", "Unix time of the last scheduled snapshot run.", float64(t.Unix()))
+	}
+	if t, err := time.Parse(time.RFC3339, status.LastSuccessAt); err == nil {
+		mw.Gauge("clawdeckx_snapshot_schedule_last_success_timestamp_seconds", "Unix time of the last successful scheduled snapshot.", float64(t.Unix()))
+	}
+}
+
+func (h *MetricsHandler) writeUsage(mw *metrics.Writer) {
+	u := h.gatewayUsage()
+	if u == nil {
+		return
+	}
+	mw.Gauge("clawdeckx_gateway_sessions", "Sessions reported by the gateway.", float64(u.sessions))
+	mw.Gauge("clawdeckx_gateway_session_tokens", "Sum of total tokens across gateway sessions.", float64(u.sessionTokens))
+	if u.usageAvailable {
+		mw.Gauge("clawdeckx_gateway_usage_tokens_today", "Tokens used today as reported by usage.cost.", u.todayTokens)
+		mw.Gauge("clawdeckx_gateway_usage_cost_today", "Cost incurred today as reported by usage.cost.", u.todayCost)
+	}
+}
+
+// gatewayUsage returns cached session and usage figures, refreshing them at most once per gatewayUsageTTL.
+func (h *MetricsHandler) gatewayUsage() *gatewayUsage {
+	if h.gwClient == nil || !h.gwClient.IsConnected() {
+		return nil
+	}
+	h.usageMu.Lock()
+	defer h.usageMu.Unlock()
+	if h.usage != nil && time.Since(h.usageAt) < gatewayUsageTTL {
+		return h.usage
+	}
+
+	u, err := fetchGatewayUsage(h.gwClient)
+	if err != nil {
+		return h.usage
+	}
+	h.usage, h.usageAt = u, time.Now()
+	return u
+}
+
+// fetchGatewayUsage queries a gateway for its session count, session tokens and
+// today's usage. A failing usage.cost call only leaves usageAvailable false.
+func fetchGatewayUsage(client *openclaw.GWClient) (*gatewayUsage, error) {
+	raw, err := client.Request("sessions.list", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	var sessions struct {
+		Sessions []struct {
+			TotalTokens int64 `json:"totalTokens"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(raw, &sessions); err != nil {
+		return nil, err
+	}
+	u := &gatewayUsage{sessions: len(sessions.Sessions)}
+	for _, s := range sessions.Sessions {
+		u.sessionTokens += s.TotalTokens
+	}
+
+	if raw, err := client.RequestWithTimeout("usage.cost", map[string]interface{}{"days": 1}, 10*time.Second); err == nil {
+		var cost struct {
+			Totals struct {
+				TotalTokens json.Number `json:"totalTokens"`
+				TotalCost   json.Number `json:"totalCost"`
+			} `json:"totals"`
+		}
+		if json.Unmarshal(raw, &cost) == nil {
+			u.todayTokens = parseNumber(cost.Totals.TotalTokens)
+			u.todayCost = parseNumber(cost.Totals.TotalCost)
+			u.usageAvailable = true
+		}
+	}
+	return u, nil
+}
+
+func parseNumber(n json.Number) float64 {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/oidc"
+	"ClawDeckX/internal/rbac"
+	"ClawDeckX/internal/web"
+	"ClawDeckX/internal/webconfig"
+
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie   = "claw_oidc_state"
+	oidcIDTokenCookie = "claw_oidc_id" // id_token_hint for RP-initiated logout
+	oidcCookiePath    = "/api/v1/auth/"
+	oidcLoginTTL      = 10 * time.Minute
+	oidcMaxUsername   = 64
+
+	authProviderOIDC = "oidc"
+)
+
+// OIDCHandler implements single sign-on via the OpenID Connect
+// authorization-code flow. Sessions are issued by the AuthHandler.
+type OIDCHandler struct {
+	auth      *AuthHandler
+	cfg       webconfig.OIDCConfig
+	client    *oidc.Client
+	userRepo  *database.UserRepo
+	auditRepo *database.AuditLogRepo
+
+	mu      sync.Mutex
+	pending map[string]*oidcLogin // by state
+}
+
+// oidcLogin is an authorization request awaiting its callback.
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	redirect string
+	expires  time.Time
+}
+
+// NewOIDCHandler returns a handler for cfg. When SSO is disabled only Config
+// is functional. httpClient may be nil.
+func NewOIDCHandler(auth *AuthHandler, cfg webconfig.OIDCConfig, httpClient *http.Client) *OIDCHandler {
+	h := &OIDCHandler{
+		auth:      auth,
+		cfg:       cfg,
+		userRepo:  database.NewUserRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		pending:   map[string]*oidcLogin{},
+	}
+	if cfg.Enabled {
+		h.client = oidc.NewClient(oidc.Config{
+			Issuer:       cfg.Issuer,
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		}, httpClient)
+	}
+	return h
+}
+
+// Config tells the login screen whether SSO and password login are available.
+func (h *OIDCHandler) Config(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, map[string]interface{}{
+		"enabled":       h.client != nil,
+		"provider_name": h.cfg.ProviderName,
+		"local_login":   h.auth.localLoginAllowed(r),
+	})
+}
+
+// Login redirects the browser to the identity provider. An optional
+// ?redirect= path is where the browser lands after a successful login.
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if h.client == nil {
+		web.FailErr(w, r, web.ErrOIDCDisabled)
+		return
+	}
+	state, err1 := oidc.RandomString()
+	nonce, err2 := oidc.RandomString()
+	verifier, err3 := oidc.RandomString()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		web.FailErr(w, r, web.ErrLoginFailed)
+		return
+	}
+	authURL, err := h.client.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		logger.Auth.Error().Err(err).Msg("oidc provider unavailable")
+		web.FailErr(w, r, web.ErrOIDCProvider)
+		return
+	}
+
+	now := time.Now().UTC()
+	h.mu.Lock()
+	for k, p := range h.pending {
+		if now.After(p.expires) {
+			delete(h.pending, k)
+		}
+	}
+	h.pending[state] = &oidcLogin{
+		nonce:    nonce,
+		verifier: verifier,
+		redirect: safeRedirectPath(r.URL.Query().Get("redirect")),
+		expires:  now.Add(oidcLoginTTL),
+	}
+	h.mu.Unlock()
+
+	// Binds the callback to this browser. Lax so it survives the top-level
+	// redirect back from the provider.
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginTTL / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the flow: it checks state, redeems the code with the
+// PKCE verifier, validates the ID token, maps claims to a local user and
+// redirects the browser into the app with a session cookie.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	if h.client == nil {
+		web.FailErr(w, r, web.ErrOIDCDisabled)
+		return
+	}
+	q := r.URL.Query()
+	state := q.Get("state")
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if state == "" || err != nil || cookie.Value != state {
+		h.fail(w, r, "", "state_mismatch", nil)
+		return
+	}
+	h.mu.Lock()
+	login := h.pending[state]
+	delete(h.pending, state)
+	h.mu.Unlock()
+	if login == nil || time.Now().UTC().After(login.expires) {
+		h.fail(w, r, "", "state_expired", nil)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		h.fail(w, r, "", "provider_error", errors.New(e+": "+q.Get("error_description")))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+	tok, err := h.client.Exchange(ctx, q.Get("code"), login.verifier)
+	if err != nil {
+		h.fail(w, r, "", "exchange_failed", err)
+		return
+	}
+	id, err := h.client.Verify(ctx, tok.IDToken, login.nonce)
+	if err != nil {
+		h.fail(w, r, "", "invalid_token", err)
+		return
+	}
+
+	user, reason, err := h.resolveUser(r, id)
+	if user == nil {
+		h.fail(w, r, claimString(id.Claims, h.cfg.UsernameClaim), reason, err)
+		return
+	}
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now().UTC()) {
+		h.fail(w, r, user.Username, "account_locked", nil)
+		return
+	}
+
+	// The provider is responsible for additional factors, so local TOTP is not asked for.
+	if _, _, _, err := h.auth.startSession(w, r, user, "oidc"); err != nil {
+		h.fail(w, r, user.Username, "session_failed", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcIDTokenCookie,
+		Value:    tok.IDToken,
+		Path:     oidcCookiePath,
+		MaxAge:   int(h.auth.cfg.JWTExpireDuration() / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, login.redirect, http.StatusFound)
+}
+
+// resolveUser finds or provisions the local user for id and syncs its role.
+// On refusal it returns a nil user and a short reason code.
+func (h *OIDCHandler) resolveUser(r *http.Request, id *oidc.IDToken) (*database.User, string, error) {
+	role, ok := h.mapRole(id.Claims)
+	if !ok {
+		return nil, "no_role", nil
+	}
+	externalID := strings.TrimRight(h.cfg.Issuer, "/") + "#" + id.Subject
+
+	user, err := h.userRepo.FindByExternalID(externalID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "db_error", err
+	}
+	if user == nil {
+		if !h.cfg.AutoProvision {
+			return nil, "not_provisioned", nil
+		}
+		username := h.username(id)
+		if username == "" {
+			return nil, "no_username", nil
+		}
+		// Never attach SSO identities to existing local accounts by name.
+		if existing, _ := h.userRepo.FindByUsername(username); existing != nil {
+			return nil, "username_taken", nil
+		}
+		user = &database.User{
+			Username:     username,
+			PasswordHash: "!", // no bcrypt hash matches, so password login always fails
+			Role:         role,
+			AuthProvider: authProviderOIDC,
+			ExternalID:   externalID,
+		}
+		if err := h.userRepo.Create(user); err != nil {
+			return nil, "provision_failed", err
+		}
+		h.audit(r, user, constants.ActionUserCreate, "provisioned via oidc as "+role)
+		logger.Auth.Info().Str("username", username).Str("role", role).Msg("oidc user provisioned")
+		return user, "", nil
+	}
+
+	if user.Role != role {
+		if err := h.userRepo.UpdateRole(user.ID, role); err != nil {
+			return nil, "db_error", err
+		}
+		h.audit(r, user, constants.ActionUserRoleUpdate, "oidc role sync: "+user.Role+" -> "+role)
+		revokeUserSessions(user.ID, "", "role_changed")
+		user.Role = role
+	}
+	return user, "", nil
+}
+
+// mapRole returns the role for the first RoleClaim value present in
+// RoleMapping, falling back to DefaultRole. Unknown roles are skipped.
+func (h *OIDCHandler) mapRole(claims map[string]interface{}) (string, bool) {
+	for _, v := range claimStrings(claims, h.cfg.RoleClaim) {
+		role, ok := h.cfg.RoleMapping[v]
+		if !ok {
+			continue
+		}
+		if !rbac.Exists(role) {
+			logger.Auth.Warn().Str("claim", v).Str("role", role).Msg("oidc role mapping points at unknown role")
+			continue
+		}
+		return role, true
+	}
+	if h.cfg.DefaultRole != "" && rbac.Exists(h.cfg.DefaultRole) {
+		return h.cfg.DefaultRole, true
+	}
+	return "", false
+}
+
+func (h *OIDCHandler) username(id *oidc.IDToken) string {
+	for _, c := range []string{h.cfg.UsernameClaim, "preferred_username", "email"} {
+		if v := strings.TrimSpace(claimString(id.Claims, c)); v != "" && len(v) <= oidcMaxUsername {
+			return v
+		}
+	}
+	return ""
+}
+
+// logoutURL clears the ID token cookie and returns the provider's end-session
+// URL for SSO sessions, or "".
+func (h *OIDCHandler) logoutURL(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(oidcIDTokenCookie)
+	if err != nil || h.client == nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcIDTokenCookie, Path: oidcCookiePath, MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	return h.client.EndSessionURL(r.Context(), cookie.Value, h.cfg.PostLogoutRedirectURL)
+}
+
+// fail audits a refused SSO login and sends the browser back to the login
+// screen with a reason code.
+func (h *OIDCHandler) fail(w http.ResponseWriter, r *http.Request, username, reason string, err error) {
+	detail := "oidc: " + reason
+	if err != nil {
+		detail += ": " + err.Error()
+	}
+	h.auditRepo.Create(&database.AuditLog{
+		Username: username,
+		Action:   constants.ActionLoginFailed,
+		Result:   "failed",
+		Detail:   detail,
+		IP:       r.RemoteAddr,
+	})
+	logger.Auth.Warn().Str("username", username).Str("ip", r.RemoteAddr).Str("reason", reason).AnErr("error", err).Msg("oidc login failed")
+	http.Redirect(w, r, "/?sso_error="+url.QueryEscape(reason), http.StatusFound)
+}
+
+func (h *OIDCHandler) audit(r *http.Request, user *database.User, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   user.ID,
+		Username: user.Username,
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
+
+// localLoginAllowed reports whether password login is accepted from r.
+// Loopback clients keep it as a break-glass path when SSO is enforced.
+func (h *AuthHandler) localLoginAllowed(r *http.Request) bool {
+	o := h.cfg.Auth.OIDC
+	return !(o.Enabled && o.DisableLocalLogin) || web.IsLoopbackRequest(r)
+}
+
+// SetOIDC enables single sign-on logout integration.
+func (h *AuthHandler) SetOIDC(o *OIDCHandler) {
+	h.oidc = o
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return ""
+}
+
+// claimStrings reads a claim that may be a single string or an array of strings.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	if name == "" {
+		return nil
+	}
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// safeRedirectPath accepts only same-origin absolute paths.
+func safeRedirectPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/oidc/oidctest"
+	"ClawDeckX/internal/webconfig"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ssoLogin runs Login → mock IdP → Callback and returns the callback response.
+func ssoLogin(t *testing.T, h *OIDCHandler) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Login(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login?redirect=/dashboard", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	stateCookie := w.Result().Cookies()[0]
+
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noFollow.Get(w.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	cb, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+cb.RawQuery, nil)
+	req.AddCookie(stateCookie)
+	w = httptest.NewRecorder()
+	h.Callback(w, req)
+	return w
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) string {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "claw_token" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func TestOIDCLogin_ProvisionsAndMapsRole(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	idp := oidctest.New("deck")
+	defer idp.Close()
+
+	cfg := testConfig()
+	cfg.Auth.OIDC = webconfig.OIDCConfig{
+		Enabled:       true,
+		Issuer:        idp.Issuer(),
+		ClientID:      "deck",
+		RedirectURL:   "http://deck.local/api/v1/auth/oidc/callback",
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		RoleMapping:   map[string]string{"deck-admins": "admin"},
+		DefaultRole:   "readonly",
+		AutoProvision: true,
+	}
+	auth := NewAuthHandler(cfg)
+	h := NewOIDCHandler(auth, cfg.Auth.OIDC, nil)
+
+	idp.SetClaims(map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"staff"}})
+	w := ssoLogin(t, h)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/dashboard", w.Header().Get("Location"))
+	assert.NotEmpty(t, sessionCookie(w))
+
+	user, err := database.NewUserRepo().FindByUsername("alice")
+	require.NoError(t, err)
+	assert.Equal(t, "readonly", user.Role)
+	assert.Equal(t, authProviderOIDC, user.AuthProvider)
+
+	// Group change at the IdP is applied on the next login, to the same user.
+	idp.SetClaims(map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"deck-admins"}})
+	w = ssoLogin(t, h)
+	require.NotEmpty(t, sessionCookie(w))
+	again, err := database.NewUserRepo().FindByUsername("alice")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, again.ID)
+	assert.Equal(t, "admin", again.Role)
+}
+
+func TestOIDCLogin_Refusals(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	idp := oidctest.New("deck")
+	defer idp.Close()
+	createTestUser(t, "admin", "password123")
+
+	cfg := testConfig()
+	cfg.Auth.OIDC = webconfig.OIDCConfig{
+		Enabled:           true,
+		Issuer:            idp.Issuer(),
+		ClientID:          "deck",
+		RedirectURL:       "http://deck.local/api/v1/auth/oidc/callback",
+		UsernameClaim:     "preferred_username",
+		RoleClaim:         "groups",
+		RoleMapping:       map[string]string{"deck-admins": "admin"},
+		AutoProvision:     true,
+		DisableLocalLogin: true,
+	}
+	auth := NewAuthHandler(cfg)
+	h := NewOIDCHandler(auth, cfg.Auth.OIDC, nil)
+
+	// No mapped role and no default role.
+	idp.SetClaims(map[string]interface{}{"sub": "u-2", "preferred_username": "bob"})
+	w := ssoLogin(t, h)
+	assert.Equal(t, "/?sso_error=no_role", w.Header().Get("Location"))
+	assert.Empty(t, sessionCookie(w))
+
+	// SSO identities are never linked to an existing local account by name.
+	idp.SetClaims(map[string]interface{}{"sub": "u-3", "preferred_username": "admin", "groups": []string{"deck-admins"}})
+	w = ssoLogin(t, h)
+	assert.Equal(t, "/?sso_error=username_taken", w.Header().Get("Location"))
+
+	// Callback without the browser's state cookie.
+	w = httptest.NewRecorder()
+	h.Callback(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?state=x&code=y", nil))
+	assert.Equal(t, "/?sso_error=state_mismatch", w.Header().Get("Location"))
+
+	// Password login is refused for remote clients but kept for loopback.
+	code, _ := postJSONFrom(t, auth.Login, "203.0.113.5:4000", `{"username":"admin","password":"password123"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = postJSONFrom(t, auth.Login, "127.0.0.1:4000", `{"username":"admin","password":"password123"}`)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func postJSONFrom(t *testing.T, fn http.HandlerFunc, remoteAddr, body string) (int, map[string]interface{}) {
+	t.Helper()
+	return postJSON(t, func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = remoteAddr
+		r.Host = "localhost"
+		fn(w, r)
+	}, body)
+}
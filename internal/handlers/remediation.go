@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/remediation"
+	"ClawDeckX/internal/web"
+)
+
+// RemediationHandler manages gateway remediation policies and their runs.
+type RemediationHandler struct {
+	repo      *database.RemediationPolicyRepo
+	runRepo   *database.RemediationRunRepo
+	auditRepo *database.AuditLogRepo
+	engine    *remediation.Engine
+}
+
+func NewRemediationHandler(engine *remediation.Engine) *RemediationHandler {
+	return &RemediationHandler{
+		repo:      database.NewRemediationPolicyRepo(),
+		runRepo:   database.NewRemediationRunRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		engine:    engine,
+	}
+}
+
+// List returns all remediation policies (enabled and disabled).
+func (h *RemediationHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := h.repo.List()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	policies := make([]*remediation.Policy, 0, len(records))
+	for i := range records {
+		p, err := remediation.PolicyFromRecord(&records[i])
+		if err != nil {
+			logger.Gateway.Warn().Err(err).Msg("remediation policy decode failed")
+			continue
+		}
+		policies = append(policies, p)
+	}
+	web.OK(w, r, policies)
+}
+
+// Create adds a new remediation policy. Enabled defaults to true when omitted.
+func (h *RemediationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	p := remediation.Policy{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := p.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrRemediationInvalid, err.Error())
+		return
+	}
+	p.ID = 0
+	rec, err := p.Record()
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationInvalid, err.Error())
+		return
+	}
+	if err := h.repo.Create(rec); err != nil {
+		web.FailErr(w, r, web.ErrRemediationSaveFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionRemediationCreate, "created remediation policy: "+rec.Name)
+
+	saved, _ := remediation.PolicyFromRecord(rec)
+	web.OK(w, r, saved)
+}
+
+// Update replaces an existing remediation policy (?id=).
+func (h *RemediationHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationNotFound)
+		return
+	}
+
+	var p remediation.Policy
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := p.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrRemediationInvalid, err.Error())
+		return
+	}
+	p.ID = existing.ID
+	p.CreatedAt = existing.CreatedAt
+	rec, err := p.Record()
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationInvalid, err.Error())
+		return
+	}
+	if err := h.repo.Update(rec); err != nil {
+		web.FailErr(w, r, web.ErrRemediationSaveFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionRemediationUpdate, "updated remediation policy: "+rec.Name)
+
+	saved, _ := remediation.PolicyFromRecord(rec)
+	web.OK(w, r, saved)
+}
+
+// Delete removes a remediation policy (?id=). Its runs are kept.
+func (h *RemediationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationNotFound)
+		return
+	}
+	if err := h.repo.Delete(id); err != nil {
+		web.FailErr(w, r, web.ErrRemediationDeleteFail)
+		return
+	}
+	h.reloadEngine()
+	h.audit(r, constants.ActionRemediationDelete, "deleted remediation policy: "+existing.Name)
+
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+// RunNow runs a policy's steps immediately (?id=), ignoring its trigger and
+// run limit. The run continues in the background; poll Runs for its outcome.
+func (h *RemediationHandler) RunNow(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	existing, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationNotFound)
+		return
+	}
+	runID, err := h.engine.RunNow(id, web.GetUsername(r))
+	if errors.Is(err, remediation.ErrPolicyBusy) {
+		web.FailErr(w, r, web.ErrRemediationBusy)
+		return
+	}
+	if err != nil {
+		web.FailErr(w, r, web.ErrRemediationRunFail, err.Error())
+		return
+	}
+	h.audit(r, constants.ActionRemediationRun, "ran remediation policy: "+existing.Name)
+
+	web.OK(w, r, map[string]uint{"run_id": runID})
+}
+
+// Runs lists remediation runs newest first, or returns one run (?id=).
+// Filters: policy_id, gateway, status, page, page_size.
+func (h *RemediationHandler) Runs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("id") != "" {
+		id, ok := parseIDQuery(r)
+		if !ok {
+			web.FailErr(w, r, web.ErrInvalidParam)
+			return
+		}
+		rec, err := h.runRepo.GetByID(id)
+		if err != nil {
+			web.FailErr(w, r, web.ErrNotFound)
+			return
+		}
+		web.OK(w, r, remediation.RunFromRecord(rec))
+		return
+	}
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+	gatewayID, err := parseGatewayQuery(r)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	policyID, _ := strconv.ParseUint(q.Get("policy_id"), 10, 64)
+
+	records, total, err := h.runRepo.List(database.RemediationRunFilter{
+		Page:      page,
+		PageSize:  pageSize,
+		PolicyID:  uint(policyID),
+		GatewayID: gatewayID,
+		Status:    q.Get("status"),
+	})
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	runs := make([]*remediation.Run, 0, len(records))
+	for i := range records {
+		runs = append(runs, remediation.RunFromRecord(&records[i]))
+	}
+	web.OK(w, r, map[string]interface{}{
+		"records":   runs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (h *RemediationHandler) reloadEngine() {
+	if h.engine == nil {
+		return
+	}
+	if err := h.engine.Reload(); err != nil {
+		logger.Gateway.Error().Err(err).Msg("remediation policy reload failed")
+	}
+}
+
+func (h *RemediationHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/retention"
+	"ClawDeckX/internal/web"
+)
+
+// RetentionHandler manages data retention policies, the cold archive and
+// database compaction.
+type RetentionHandler struct {
+	mgr       *retention.Manager
+	repo      *database.RetentionRepo
+	auditRepo *database.AuditLogRepo
+}
+
+func NewRetentionHandler(mgr *retention.Manager) *RetentionHandler {
+	return &RetentionHandler{
+		mgr:       mgr,
+		repo:      database.NewRetentionRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+	}
+}
+
+// Get returns the retention policies, the archive directory and the status
+// of the last job.
+func (h *RetentionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.mgr.Policies()
+	if err != nil {
+		web.FailErr(w, r, web.ErrSettingsQueryFail)
+		return
+	}
+	web.OK(w, r, map[string]interface{}{
+		"policies":    policies,
+		"archive_dir": h.mgr.Archive().Dir(),
+		"status":      h.mgr.Status(),
+	})
+}
+
+// Update replaces the policies of the tables in the body.
+func (h *RetentionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Policies []retention.Policy `json:"policies"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Policies) == 0 {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	var changed []string
+	for i := range req.Policies {
+		p := &req.Policies[i]
+		if err := p.Validate(); err != nil {
+			web.FailErr(w, r, web.ErrRetentionInvalid, err.Error())
+			return
+		}
+		changed = append(changed, fmt.Sprintf("%s=%dd/%d", p.Table, p.MaxAgeDays, p.MaxRows))
+	}
+	if err := h.mgr.SavePolicies(req.Policies); err != nil {
+		logger.DB.Error().Err(err).Msg("failed to save retention policies")
+		web.FailErr(w, r, web.ErrSettingsUpdateFail)
+		return
+	}
+	h.audit(r, constants.ActionRetentionUpdate, "retention: "+strings.Join(changed, ", "))
+	h.Get(w, r)
+}
+
+// Prune starts archiving the rows past their policy.
+func (h *RetentionHandler) Prune(w http.ResponseWriter, r *http.Request) {
+	if err := h.mgr.StartPrune(); err != nil {
+		web.FailErr(w, r, web.ErrRetentionBusy, err.Error())
+		return
+	}
+	h.audit(r, constants.ActionRetentionPrune, "started retention prune")
+	web.OK(w, r, h.mgr.Status())
+}
+
+// Status returns the last or running prune or compaction.
+func (h *RetentionHandler) Status(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, h.mgr.Status())
+}
+
+// Size reports the database size per table and the archive size.
+func (h *RetentionHandler) Size(w http.ResponseWriter, r *http.Request) {
+	rep, err := h.repo.Size()
+	if err != nil {
+		logger.DB.Error().Err(err).Msg("database size report failed")
+		web.FailErr(w, r, web.ErrRetentionFail)
+		return
+	}
+	files, archiveBytes, err := h.mgr.Archive().Size()
+	if err != nil {
+		logger.DB.Warn().Err(err).Msg("archive size failed")
+	}
+	web.OK(w, r, map[string]interface{}{
+		"database":      rep,
+		"archive_files": files,
+		"archive_bytes": archiveBytes,
+	})
+}
+
+// Compact starts a database compaction; {"full": true} runs VACUUM.
+func (h *RetentionHandler) Compact(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Full bool `json:"full"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.FailErr(w, r, web.ErrInvalidBody)
+			return
+		}
+	}
+	if err := h.mgr.StartCompact(req.Full); err != nil {
+		web.FailErr(w, r, web.ErrRetentionBusy, err.Error())
+		return
+	}
+	h.audit(r, constants.ActionDatabaseCompact, fmt.Sprintf("started database compaction (full=%t)", req.Full))
+	web.OK(w, r, h.mgr.Status())
+}
+
+// Archives lists archive files, optionally of one table.
+func (h *RetentionHandler) Archives(w http.ResponseWriter, r *http.Request) {
+	table := r.URL.Query().Get("table")
+	if table != "" && database.FindRetentionTable(table) == nil {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	files, err := h.mgr.Archive().List(table)
+	if err != nil {
+		logger.DB.Error().Err(err).Msg("failed to list archives")
+		web.FailErr(w, r, web.ErrRetentionFail)
+		return
+	}
+	if files == nil {
+		files = []retention.ArchiveFile{}
+	}
+	web.OK(w, r, files)
+}
+
+// ArchiveRows pages through the rows of an archive file; keyword keeps the
+// rows whose JSON contains it.
+func (h *RetentionHandler) ArchiveRows(w http.ResponseWriter, r *http.Request) {
+	pq := web.ParsePageQuery(r)
+	table, date := r.URL.Query().Get("table"), r.URL.Query().Get("date")
+	if _, err := h.mgr.Archive().Path(table, date); err != nil {
+		web.FailErr(w, r, web.ErrRetentionInvalid, err.Error())
+		return
+	}
+	keyword := []byte(strings.ToLower(pq.Keyword))
+	start, end := pq.Offset(), pq.Offset()+pq.PageSize
+	var total int64
+	rows := []json.RawMessage{}
+	err := h.mgr.Archive().Read(table, date, func(row json.RawMessage) error {
+		if len(keyword) > 0 && !bytes.Contains(bytes.ToLower(row), keyword) {
+			return nil
+		}
+		if total >= int64(start) && total < int64(end) {
+			rows = append(rows, row)
+		}
+		total++
+		return nil
+	})
+	if !h.archiveOK(w, r, err) {
+		return
+	}
+	web.OKPage(w, r, rows, total, pq.Page, pq.PageSize)
+}
+
+// DownloadArchive serves an archive file as stored (gzip-compressed JSONL).
+func (h *RetentionHandler) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	table, date := r.URL.Query().Get("table"), r.URL.Query().Get("date")
+	path, err := h.mgr.Archive().Path(table, date)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRetentionInvalid, err.Error())
+		return
+	}
+	if _, err := os.Stat(path); !h.archiveOK(w, r, err) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+table+"_"+date+".jsonl.gz")
+	http.ServeFile(w, r, path)
+}
+
+// ImportArchive puts the rows of an archive file back into their table.
+func (h *RetentionHandler) ImportArchive(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Table string `json:"table"`
+		Date  string `json:"date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if _, err := h.mgr.Archive().Path(req.Table, req.Date); err != nil {
+		web.FailErr(w, r, web.ErrRetentionInvalid, err.Error())
+		return
+	}
+	res, err := h.mgr.Import(req.Table, req.Date)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		web.FailErr(w, r, web.ErrArchiveNotFound)
+		return
+	case errors.Is(err, retention.ErrReadOnly):
+		web.FailErr(w, r, web.ErrRetentionInvalid, err.Error())
+		return
+	case err != nil:
+		logger.DB.Error().Err(err).Str("table", req.Table).Str("date", req.Date).Msg("archive import failed")
+		web.FailErr(w, r, web.ErrArchiveImportFail, err.Error())
+		return
+	}
+	h.audit(r, constants.ActionArchiveImport, fmt.Sprintf("imported %s archive %s: %d of %d rows restored", req.Table, req.Date, res.Restored, res.Read))
+	web.OK(w, r, res)
+}
+
+// archiveOK writes the response for a failed archive access.
+func (h *RetentionHandler) archiveOK(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, os.ErrNotExist):
+		web.FailErr(w, r, web.ErrArchiveNotFound)
+	default:
+		logger.DB.Error().Err(err).Msg("archive read failed")
+		web.FailErr(w, r, web.ErrRetentionFail, err.Error())
+	}
+	return false
+}
+
+func (h *RetentionHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/riskpolicy"
+	"ClawDeckX/internal/web"
+)
+
+// RiskPolicyHandler manages the policy that classifies and scores tool activity.
+type RiskPolicyHandler struct {
+	engine    *riskpolicy.Engine
+	auditRepo *database.AuditLogRepo
+}
+
+func NewRiskPolicyHandler(engine *riskpolicy.Engine) *RiskPolicyHandler {
+	return &RiskPolicyHandler{
+		engine:    engine,
+		auditRepo: database.NewAuditLogRepo(),
+	}
+}
+
+// Get returns the current policy, its hash, the built-in default and the
+// status of the last rescore.
+func (h *RiskPolicyHandler) Get(w http.ResponseWriter, r *http.Request) {
+	policy, hash := h.engine.Policy()
+	web.OK(w, r, map[string]interface{}{
+		"policy":  policy,
+		"hash":    hash,
+		"path":    h.engine.Path(),
+		"default": riskpolicy.DefaultPolicy(),
+		"rescore": h.engine.RescoreStatus(),
+	})
+}
+
+// Update replaces the policy, writes the policy file and re-scores stored
+// activities in the background.
+func (h *RiskPolicyHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var policy riskpolicy.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := policy.Normalize(); err != nil {
+		web.FailErr(w, r, web.ErrRiskPolicyInvalid, err.Error())
+		return
+	}
+	if err := h.engine.Save(&policy); err != nil {
+		logger.Monitor.Error().Err(err).Msg("failed to save risk policy")
+		web.FailErr(w, r, web.ErrRiskPolicySaveFail)
+		return
+	}
+	_, hash := h.engine.Policy()
+	h.audit(r, constants.ActionRiskPolicyUpdate, "updated risk policy: "+hash)
+	h.Get(w, r)
+}
+
+// Reload re-reads the policy file after it was edited by hand.
+func (h *RiskPolicyHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if err := h.engine.Load(); err != nil {
+		web.FailErr(w, r, web.ErrRiskPolicyLoadFail, err.Error())
+		return
+	}
+	_, hash := h.engine.Policy()
+	h.audit(r, constants.ActionRiskPolicyReload, "reloaded risk policy: "+hash)
+	h.Get(w, r)
+}
+
+// testRequest is an event to score. Input, the tool's arguments, fills the
+// command, paths and URLs left empty. Policy, when set, is scored instead of
+// the current policy without being applied.
+type testRequest struct {
+	riskpolicy.Event
+	Input  map[string]interface{} `json:"input"`
+	Policy *riskpolicy.Policy     `json:"policy"`
+}
+
+// Test scores an event and returns its category, risk, score and reasons.
+func (h *RiskPolicyHandler) Test(w http.ResponseWriter, r *http.Request) {
+	var req testRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	ev := req.Event
+	if req.Input != nil {
+		derived := riskpolicy.EventFromInput(ev.Tool, req.Input)
+		if ev.Command == "" {
+			ev.Command = derived.Command
+		}
+		if len(ev.Paths) == 0 {
+			ev.Paths = derived.Paths
+		}
+		if len(ev.URLs) == 0 {
+			ev.URLs = derived.URLs
+		}
+	}
+	if ev.Agent == "" {
+		ev.Agent = riskpolicy.AgentFromSessionKey(ev.SessionID)
+	}
+
+	if req.Policy == nil {
+		web.OK(w, r, h.engine.Assess(ev))
+		return
+	}
+	assessment, err := riskpolicy.Test(req.Policy, ev)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRiskPolicyInvalid, err.Error())
+		return
+	}
+	web.OK(w, r, assessment)
+}
+
+// Rescore starts re-scoring stored activities scored by an older policy.
+func (h *RiskPolicyHandler) Rescore(w http.ResponseWriter, r *http.Request) {
+	h.engine.StartRescore()
+	h.audit(r, constants.ActionRiskRescore, "started risk rescore")
+	web.OK(w, r, h.engine.RescoreStatus())
+}
+
+// RescoreStatus returns the progress of the last rescore.
+func (h *RiskPolicyHandler) RescoreStatus(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, h.engine.RescoreStatus())
+}
+
+func (h *RiskPolicyHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
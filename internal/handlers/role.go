@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/rbac"
+	"ClawDeckX/internal/web"
+)
+
+// RoleHandler manages custom roles and exposes the permission catalog.
+type RoleHandler struct {
+	repo      *database.RoleRepo
+	userRepo  *database.UserRepo
+	auditRepo *database.AuditLogRepo
+}
+
+func NewRoleHandler() *RoleHandler {
+	return &RoleHandler{
+		repo:      database.NewRoleRepo(),
+		userRepo:  database.NewUserRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+	}
+}
+
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// Permissions returns every permission name a role can grant.
+func (h *RoleHandler) Permissions(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, constants.AllPermissions)
+}
+
+// List returns the built-in roles followed by custom roles.
+func (h *RoleHandler) List(w http.ResponseWriter, r *http.Request) {
+	records, err := h.repo.List()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	roles := rbac.BuiltInRoles()
+	for i := range records {
+		roles = append(roles, rbac.FromRecord(&records[i]))
+	}
+	web.OK(w, r, roles)
+}
+
+// Create adds a custom role granting only permissions the caller holds.
+func (h *RoleHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	rec := &database.Role{}
+	if !h.apply(w, r, rec, &req) {
+		return
+	}
+	if !checkGrantable(w, r, rbac.SplitPermissions(rec.Permissions)) {
+		return
+	}
+	if existing, _ := h.repo.FindByName(rec.Name); existing != nil {
+		web.FailErr(w, r, web.ErrRoleExists)
+		return
+	}
+	if err := h.repo.Create(rec); err != nil {
+		web.FailErr(w, r, web.ErrRoleSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionRoleCreate, "created role: "+rec.Name+" ["+rec.Permissions+"]")
+
+	logger.Auth.Info().Str("role", rec.Name).Str("permissions", rec.Permissions).Msg("role created")
+	web.OK(w, r, rbac.FromRecord(rec))
+}
+
+// Update changes the description and permissions of a custom role (?id=).
+// Renaming is not allowed because users reference roles by name.
+func (h *RoleHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	rec, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRoleNotFound)
+		return
+	}
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if req.Name != "" && req.Name != rec.Name {
+		web.FailErr(w, r, web.ErrRoleInvalid, "role name cannot be changed")
+		return
+	}
+	req.Name = rec.Name
+	// Both the permissions taken away and those granted must be the caller's own.
+	if !checkGrantable(w, r, rbac.SplitPermissions(rec.Permissions)) {
+		return
+	}
+	if !h.apply(w, r, rec, &req) {
+		return
+	}
+	if !checkGrantable(w, r, rbac.SplitPermissions(rec.Permissions)) {
+		return
+	}
+	if err := h.repo.Update(rec); err != nil {
+		web.FailErr(w, r, web.ErrRoleSaveFail)
+		return
+	}
+	h.audit(r, constants.ActionRoleUpdate, "updated role: "+rec.Name+" ["+rec.Permissions+"]")
+	// Permissions are baked into session JWTs, so holders of the role sign in again.
+	if ids, err := h.userRepo.IDsByRole(rec.Name); err == nil {
+		for _, uid := range ids {
+			revokeUserSessions(uid, "", "role_changed")
+		}
+	}
+
+	logger.Auth.Info().Str("role", rec.Name).Str("permissions", rec.Permissions).Msg("role updated")
+	web.OK(w, r, rbac.FromRecord(rec))
+}
+
+// Delete removes a custom role (?id=) that no user is assigned to.
+func (h *RoleHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	rec, err := h.repo.GetByID(id)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRoleNotFound)
+		return
+	}
+	count, err := h.userRepo.CountByRole(rec.Name)
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	if count > 0 {
+		web.FailErr(w, r, web.ErrRoleInUse)
+		return
+	}
+	if err := h.repo.Delete(id); err != nil {
+		web.FailErr(w, r, web.ErrRoleDeleteFail)
+		return
+	}
+	h.audit(r, constants.ActionRoleDelete, "deleted role: "+rec.Name)
+
+	logger.Auth.Info().Str("role", rec.Name).Msg("role deleted")
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+// apply validates req and copies it onto rec, writing the error response on failure.
+func (h *RoleHandler) apply(w http.ResponseWriter, r *http.Request, rec *database.Role, req *roleRequest) bool {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		web.FailErr(w, r, web.ErrRoleInvalid, "name is required")
+		return false
+	}
+	if rbac.IsBuiltIn(name) {
+		web.FailErr(w, r, web.ErrRoleBuiltIn)
+		return false
+	}
+	perms, err := rbac.NormalizePermissions(req.Permissions)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRoleInvalid, err.Error())
+		return false
+	}
+	rec.Name = name
+	rec.Description = strings.TrimSpace(req.Description)
+	rec.Permissions = strings.Join(perms, ",")
+	return true
+}
+
+// checkGrantable writes a 403 and returns false unless the caller holds every
+// permission in perms, so users.manage cannot hand out more than its holder has.
+func checkGrantable(w http.ResponseWriter, r *http.Request, perms []string) bool {
+	for _, p := range perms {
+		if !web.HasPermission(r, p) {
+			web.FailErr(w, r, web.ErrForbidden, "permission not held by current user: "+p)
+			return false
+		}
+	}
+	return true
+}
+
+// checkRoleGrantable is checkGrantable for the permissions of an assignable role.
+func checkRoleGrantable(w http.ResponseWriter, r *http.Request, role string) bool {
+	perms, err := rbac.Resolve(role)
+	if err != nil {
+		web.FailErr(w, r, web.ErrRoleNotFound)
+		return false
+	}
+	return checkGrantable(w, r, perms)
+}
+
+// checkUserManageable is checkRoleGrantable for an existing user, so callers
+// cannot delete, demote or sign out users holding permissions they lack.
+// Users whose role no longer exists hold no permissions.
+func checkUserManageable(w http.ResponseWriter, r *http.Request, user *database.User) bool {
+	if !rbac.Exists(user.Role) {
+		return true
+	}
+	return checkRoleGrantable(w, r, user.Role)
+}
+
+func (h *RoleHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Detail:   detail,
+		Result:   "success",
+		IP:       r.RemoteAddr,
+	})
+}
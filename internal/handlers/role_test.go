@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+	"ClawDeckX/internal/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asUserManager builds a request from a user holding only users.manage.
+func asUserManager(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	return web.SetUserInfo(req, 99, "manager", "user-manager", []string{constants.PermUsersManage})
+}
+
+func TestRolesCannotExceedCallerPermissions(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	roles := NewRoleHandler()
+	users := NewUserHandler()
+
+	w := httptest.NewRecorder()
+	roles.Create(w, asUserManager(http.MethodPost, "/api/v1/roles", `{"name":"root","permissions":["users.manage","system.manage"]}`))
+	assert.Equal(t, http.StatusForbidden, w.Code, "a role with permissions the caller lacks is rejected")
+	_, err := database.NewRoleRepo().FindByName("root")
+	assert.Error(t, err)
+
+	w = httptest.NewRecorder()
+	roles.Create(w, asUserManager(http.MethodPost, "/api/v1/roles", `{"name":"helpdesk","permissions":["users.manage"]}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	helpdesk, err := database.NewRoleRepo().FindByName("helpdesk")
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	roles.Update(w, asUserManager(http.MethodPut, fmt.Sprintf("/api/v1/roles?id=%d", helpdesk.ID), `{"permissions":["users.manage","config.write"]}`))
+	assert.Equal(t, http.StatusForbidden, w.Code, "a role cannot be widened beyond the caller")
+
+	w = httptest.NewRecorder()
+	users.Create(w, asUserManager(http.MethodPost, "/api/v1/users", `{"username":"mallory","password":"secret123","role":"admin"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code, "users cannot be created as admin")
+	w = httptest.NewRecorder()
+	users.Create(w, asUserManager(http.MethodPost, "/api/v1/users", `{"username":"mallory","password":"secret123","role":"helpdesk"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	mallory, err := database.NewUserRepo().FindByUsername("mallory")
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	users.UpdateRole(w, asUserManager(http.MethodPut, fmt.Sprintf("/api/v1/users/%d", mallory.ID), `{"role":"admin"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code, "users cannot be promoted to admin")
+	mallory, _ = database.NewUserRepo().FindByID(mallory.ID)
+	assert.Equal(t, "helpdesk", mallory.Role)
+
+	owner := &database.User{Username: "owner", PasswordHash: "x", Role: constants.RoleAdmin}
+	require.NoError(t, database.NewUserRepo().Create(owner))
+	w = httptest.NewRecorder()
+	users.UpdateRole(w, asUserManager(http.MethodPut, fmt.Sprintf("/api/v1/users/%d", owner.ID), `{"role":"readonly"}`))
+	assert.Equal(t, http.StatusForbidden, w.Code, "admins cannot be demoted by a less privileged caller")
+
+	w = httptest.NewRecorder()
+	req := web.SetUserInfo(httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/users/%d", mallory.ID), bytes.NewBufferString(`{"role":"admin"}`)),
+		owner.ID, owner.Username, constants.RoleAdmin, constants.AllPermissions)
+	users.UpdateRole(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "admins can grant any role")
+}
+
+func TestUserManagerCannotDeleteOrSignOutAdmins(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	users := database.NewUserRepo()
+	sessions := database.NewSessionRepo()
+	now := time.Now().UTC()
+	addSession := func(u *database.User, id string) *database.Session {
+		s := &database.Session{SessionID: id, UserID: u.ID, Username: u.Username, Method: "password", LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+		require.NoError(t, sessions.Create(s))
+		return s
+	}
+	owner := &database.User{Username: "owner", PasswordHash: "x", Role: constants.RoleAdmin}
+	require.NoError(t, users.Create(owner))
+	viewer := &database.User{Username: "viewer", PasswordHash: "x", Role: constants.RoleReadonly}
+	require.NoError(t, users.Create(viewer))
+	ownerSession := addSession(owner, "owner-1")
+	addSession(viewer, "viewer-1")
+
+	userHandler := NewUserHandler()
+	sessionHandler := NewSessionHandler(time.Hour)
+
+	w := httptest.NewRecorder()
+	userHandler.Delete(w, asUserManager(http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", owner.ID), ""))
+	assert.Equal(t, http.StatusForbidden, w.Code, "admins cannot be deleted by a less privileged caller")
+	_, err := users.FindByID(owner.ID)
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	sessionHandler.Revoke(w, asUserManager(http.MethodDelete, fmt.Sprintf("/api/v1/sessions?id=%d", ownerSession.ID), ""))
+	assert.Equal(t, http.StatusForbidden, w.Code, "an admin's session cannot be revoked")
+	w = httptest.NewRecorder()
+	sessionHandler.RevokeAll(w, asUserManager(http.MethodPost, "/api/v1/sessions/revoke-all", fmt.Sprintf(`{"user_id":%d}`, owner.ID)))
+	assert.Equal(t, http.StatusForbidden, w.Code, "an admin cannot be signed out everywhere")
+	s, err := sessions.GetByID(ownerSession.ID)
+	require.NoError(t, err)
+	assert.Nil(t, s.RevokedAt)
+
+	w = httptest.NewRecorder()
+	sessionHandler.RevokeAll(w, asUserManager(http.MethodPost, "/api/v1/sessions/revoke-all", fmt.Sprintf(`{"user_id":%d}`, viewer.ID)))
+	assert.Equal(t, http.StatusOK, w.Code, "less privileged users can be signed out")
+	w = httptest.NewRecorder()
+	userHandler.Delete(w, asUserManager(http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", viewer.ID), ""))
+	assert.Equal(t, http.StatusOK, w.Code, "less privileged users can be deleted")
+}
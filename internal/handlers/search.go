@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/search"
+	"ClawDeckX/internal/web"
+)
+
+// SearchHandler serves full-text search over activities, alerts, audit logs
+// and indexed session transcripts.
+type SearchHandler struct{}
+
+func NewSearchHandler() *SearchHandler {
+	return &SearchHandler{}
+}
+
+// Search runs the q query. kinds (comma separated) restricts the searched
+// kinds, sort is relevance (default) or time, start_time/end_time (RFC3339)
+// bound the time range unless the query sets since:/until:.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	pq := web.ParsePageQuery(r)
+	req := search.Request{
+		Query:    r.URL.Query().Get("q"),
+		Sort:     r.URL.Query().Get("sort"),
+		Page:     pq.Page,
+		PageSize: pq.PageSize,
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		web.FailErr(w, r, web.ErrSearchInvalid, "q is required")
+		return
+	}
+	if v := r.URL.Query().Get("kinds"); v != "" {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				req.Kinds = append(req.Kinds, k)
+			}
+		}
+	}
+	for _, p := range []struct {
+		value string
+		dst   **time.Time
+	}{{pq.StartTime, &req.Since}, {pq.EndTime, &req.Until}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, p.value)
+		if err != nil {
+			web.FailErr(w, r, web.ErrInvalidParam)
+			return
+		}
+		*p.dst = &t
+	}
+
+	res, err := search.Search(req)
+	if err != nil {
+		var invalid *search.InvalidError
+		if errors.As(err, &invalid) {
+			web.FailErr(w, r, web.ErrSearchInvalid, invalid.Msg)
+			return
+		}
+		logger.Log.Error().Err(err).Str("query", req.Query).Msg("search failed")
+		web.FailErr(w, r, web.ErrSearchFail)
+		return
+	}
+	web.OK(w, r, map[string]interface{}{
+		"list":      res.Hits,
+		"total":     res.Total,
+		"counts":    res.Counts,
+		"page":      pq.Page,
+		"page_size": pq.PageSize,
+	})
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/web"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// sessionTouchInterval limits last-seen writes to one per session per interval.
+	sessionTouchInterval = time.Minute
+	// sessionRetention keeps ended sessions listed in the database for a while
+	// so revocations can still be traced.
+	sessionRetention = 7 * 24 * time.Hour
+)
+
+// SessionHandler lists and revokes server-side login sessions and validates
+// the session behind every JWT.
+type SessionHandler struct {
+	repo      *database.SessionRepo
+	userRepo  *database.UserRepo
+	auditRepo *database.AuditLogRepo
+	idle      time.Duration
+}
+
+// NewSessionHandler creates a handler; idle <= 0 disables the idle timeout.
+func NewSessionHandler(idle time.Duration) *SessionHandler {
+	return &SessionHandler{
+		repo:      database.NewSessionRepo(),
+		userRepo:  database.NewUserRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		idle:      idle,
+	}
+}
+
+// SessionResponse is a session as listed to users.
+type SessionResponse struct {
+	database.Session
+	Current bool `json:"current"`
+}
+
+// Validate implements web.SessionFunc: the session must exist, belong to the
+// token's user, be unrevoked and unexpired, and have been used within the idle
+// timeout. Activity is recorded at most once per sessionTouchInterval.
+func (h *SessionHandler) Validate(sessionID string, userID uint, ip string) error {
+	s, err := h.repo.FindBySessionID(sessionID)
+	if err != nil || s.UserID != userID || s.RevokedAt != nil {
+		return web.ErrSessionInvalid
+	}
+	now := time.Now().UTC()
+	if !s.ExpiresAt.After(now) {
+		return web.ErrSessionInvalid
+	}
+	if h.idle > 0 && now.Sub(s.LastSeenAt) > h.idle {
+		if err := h.repo.Revoke(s.ID, now, "idle_timeout"); err != nil {
+			logger.Auth.Warn().Err(err).Uint("session", s.ID).Msg("failed to revoke idle session")
+		}
+		web.NotifySessionsRevoked([]string{s.SessionID})
+		return web.ErrSessionInvalid
+	}
+	if now.Sub(s.LastSeenAt) >= sessionTouchInterval || s.IP != ip {
+		if err := h.repo.Touch(s.ID, now, ip); err != nil {
+			logger.Auth.Warn().Err(err).Uint("session", s.ID).Msg("failed to record session activity")
+		}
+	}
+	return nil
+}
+
+// List returns the caller's active sessions.
+func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, web.GetUserID(r))
+}
+
+// ListAll returns active sessions of every user, or of ?user_id= (users.manage).
+func (h *SessionHandler) ListAll(w http.ResponseWriter, r *http.Request) {
+	var userID uint
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			web.FailErr(w, r, web.ErrInvalidParam)
+			return
+		}
+		userID = uint(id)
+	}
+	h.list(w, r, userID)
+}
+
+func (h *SessionHandler) list(w http.ResponseWriter, r *http.Request, userID uint) {
+	list, err := h.repo.ListActive(userID, time.Now().UTC())
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	current := web.GetSessionID(r)
+	resp := make([]SessionResponse, 0, len(list))
+	for _, s := range list {
+		resp = append(resp, SessionResponse{Session: s, Current: s.SessionID == current})
+	}
+	web.OK(w, r, resp)
+}
+
+// Revoke ends a single session (?id=). Users may revoke their own sessions;
+// revoking another user's session requires users.manage and every permission
+// that user holds.
+func (h *SessionHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseIDQuery(r)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	s, err := h.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			web.FailErr(w, r, web.ErrSessionNotFound)
+			return
+		}
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	if s.UserID != web.GetUserID(r) && !web.HasPermission(r, constants.PermUsersManage) {
+		web.FailErr(w, r, web.ErrSessionNotFound)
+		return
+	}
+	if s.UserID != web.GetUserID(r) && !h.checkTarget(w, r, s.UserID) {
+		return
+	}
+	if s.RevokedAt == nil {
+		if err := h.repo.Revoke(s.ID, time.Now().UTC(), "revoked"); err != nil {
+			web.FailErr(w, r, web.ErrDBQuery)
+			return
+		}
+		web.NotifySessionsRevoked([]string{s.SessionID})
+	}
+	h.audit(r, constants.ActionSessionRevoke, "revoked session "+strconv.FormatUint(uint64(s.ID), 10)+" of "+s.Username)
+
+	logger.Auth.Info().Str("username", s.Username).Uint("session", s.ID).Msg("session revoked")
+	web.OK(w, r, map[string]string{"message": "ok"})
+}
+
+// RevokeAll ends every session of a user. Without user_id it signs the caller
+// out everywhere else, keeping the current session; another user's sessions
+// require users.manage and every permission that user holds.
+func (h *SessionHandler) RevokeAll(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			web.FailErr(w, r, web.ErrInvalidBody)
+			return
+		}
+	}
+	self := web.GetUserID(r)
+	except := ""
+	if req.UserID == 0 || req.UserID == self {
+		req.UserID = self
+		except = web.GetSessionID(r)
+	} else if !web.HasPermission(r, constants.PermUsersManage) {
+		web.FailErr(w, r, web.ErrForbidden)
+		return
+	}
+	if req.UserID != self && !h.checkTarget(w, r, req.UserID) {
+		return
+	}
+
+	ids, err := h.repo.RevokeByUser(req.UserID, except, time.Now().UTC(), "revoked")
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	web.NotifySessionsRevoked(ids)
+	h.audit(r, constants.ActionSessionRevokeAll, "revoked "+strconv.Itoa(len(ids))+" sessions of user "+strconv.FormatUint(uint64(req.UserID), 10))
+
+	logger.Auth.Info().Uint("user_id", req.UserID).Int("count", len(ids)).Msg("sessions revoked")
+	web.OK(w, r, map[string]int{"revoked": len(ids)})
+}
+
+// checkTarget rejects acting on the sessions of a user who holds permissions
+// the caller lacks. Sessions of deleted users can always be ended.
+func (h *SessionHandler) checkTarget(w http.ResponseWriter, r *http.Request, userID uint) bool {
+	user, err := h.userRepo.FindByID(userID)
+	if err != nil {
+		return true
+	}
+	return checkUserManageable(w, r, user)
+}
+
+// StartCleanup periodically ends idle sessions, closing their WebSockets, and
+// purges sessions that ended more than sessionRetention ago.
+func (h *SessionHandler) StartCleanup(done <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(60 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				h.cleanup()
+			}
+		}
+	}()
+}
+
+func (h *SessionHandler) cleanup() {
+	now := time.Now().UTC()
+	if h.idle > 0 {
+		ids, err := h.repo.RevokeIdle(now.Add(-h.idle), now)
+		if err != nil {
+			logger.Auth.Warn().Err(err).Msg("failed to revoke idle sessions")
+		}
+		web.NotifySessionsRevoked(ids)
+	}
+	if _, err := h.repo.DeleteExpired(now.Add(-sessionRetention)); err != nil {
+		logger.Auth.Warn().Err(err).Msg("failed to delete expired sessions")
+	}
+}
+
+func (h *SessionHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Result:   "success",
+		Detail:   detail,
+		IP:       r.RemoteAddr,
+	})
+}
+
+// revokeUserSessions ends a user's sessions, except exceptSessionID when set,
+// and disconnects their WebSockets. Used when credentials or permissions change.
+func revokeUserSessions(userID uint, exceptSessionID, reason string) {
+	ids, err := database.NewSessionRepo().RevokeByUser(userID, exceptSessionID, time.Now().UTC(), reason)
+	if err != nil {
+		logger.Auth.Error().Err(err).Uint("user_id", userID).Str("reason", reason).Msg("failed to revoke sessions")
+		return
+	}
+	web.NotifySessionsRevoked(ids)
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginSession logs in and returns the session ID carried in the JWT.
+func loginSession(t *testing.T, h *AuthHandler, username, password string) string {
+	t.Helper()
+	code, data := postJSON(t, h.Login, `{"username":"`+username+`","password":"`+password+`"}`)
+	require.Equal(t, http.StatusOK, code)
+	claims, err := web.ValidateJWT(data["token"].(string), testConfig().Auth.JWTSecret)
+	require.NoError(t, err)
+	require.NotEmpty(t, claims.ID)
+	return claims.ID
+}
+
+func asSession(r *http.Request, user *database.User, sessionID string) *http.Request {
+	r = web.SetUserInfo(r, user.ID, user.Username, user.Role, nil)
+	return web.SetSessionID(r, sessionID)
+}
+
+func TestSessions_ListAndRevoke(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := createTestUser(t, "admin", "password123")
+	auth := NewAuthHandler(testConfig())
+	h := NewSessionHandler(time.Hour)
+
+	first := loginSession(t, auth, "admin", "password123")
+	second := loginSession(t, auth, "admin", "password123")
+	require.NoError(t, h.Validate(first, user.ID, "192.0.2.1"))
+	assert.ErrorIs(t, h.Validate(first, user.ID+1, "192.0.2.1"), web.ErrSessionInvalid)
+
+	w := httptest.NewRecorder()
+	h.List(w, asSession(httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil), user, second))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []SessionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+	current := 0
+	for _, s := range resp.Data {
+		assert.Equal(t, "password", s.Method)
+		if s.Current {
+			current++
+		}
+	}
+	assert.Equal(t, 1, current)
+
+	// Revoking one session ends it for the middleware and WebSocket hub.
+	s, err := database.NewSessionRepo().FindBySessionID(first)
+	require.NoError(t, err)
+	var notified []string
+	web.SetSessionRevokedFunc(func(ids []string) { notified = append(notified, ids...) })
+	defer web.SetSessionRevokedFunc(nil)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/sessions?id="+strconv.FormatUint(uint64(s.ID), 10), nil)
+	h.Revoke(w, asSession(req, user, second))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{first}, notified)
+	assert.ErrorIs(t, h.Validate(first, user.ID, "192.0.2.1"), web.ErrSessionInvalid)
+	assert.NoError(t, h.Validate(second, user.ID, "192.0.2.1"))
+
+	// Another user cannot see or revoke it.
+	other := createTestUser(t, "viewer", "password123")
+	other.Role = "readonly"
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/sessions?id="+strconv.FormatUint(uint64(s.ID), 10), nil)
+	h.Revoke(w, asSession(req, other, ""))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSessions_RevokedOnPasswordChange(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := createTestUser(t, "admin", "password123")
+	auth := NewAuthHandler(testConfig())
+	h := NewSessionHandler(0)
+
+	current := loginSession(t, auth, "admin", "password123")
+	elsewhere := loginSession(t, auth, "admin", "password123")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password", strings.NewReader(`{"old_password":"password123","new_password":"newpassword"}`))
+	auth.ChangePassword(w, asSession(req, user, current))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	assert.NoError(t, h.Validate(current, user.ID, "192.0.2.1"))
+	assert.ErrorIs(t, h.Validate(elsewhere, user.ID, "192.0.2.1"), web.ErrSessionInvalid)
+
+	// Logout ends the remaining session.
+	w = httptest.NewRecorder()
+	auth.Logout(w, asSession(httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", nil), user, current))
+	assert.ErrorIs(t, h.Validate(current, user.ID, "192.0.2.1"), web.ErrSessionInvalid)
+}
+
+func TestSessions_IdleTimeout(t *testing.T) {
+	cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user := createTestUser(t, "admin", "password123")
+	auth := NewAuthHandler(testConfig())
+	h := NewSessionHandler(30 * time.Minute)
+
+	active := loginSession(t, auth, "admin", "password123")
+	idle := loginSession(t, auth, "admin", "password123")
+	require.NoError(t, database.DB.Model(&database.Session{}).Where("session_id = ?", idle).
+		Update("last_seen_at", time.Now().UTC().Add(-time.Hour)).Error)
+
+	assert.NoError(t, h.Validate(active, user.ID, "192.0.2.1"))
+	assert.ErrorIs(t, h.Validate(idle, user.ID, "192.0.2.1"), web.ErrSessionInvalid)
+
+	s, err := database.NewSessionRepo().FindBySessionID(idle)
+	require.NoError(t, err)
+	require.NotNil(t, s.RevokedAt)
+	assert.Equal(t, "idle_timeout", s.RevokeReason)
+}
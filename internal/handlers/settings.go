@@ -60,6 +60,11 @@ func (h *SettingsHandler) Update(w http.ResponseWriter, r *http.Request) {
 		web.FailErr(w, r, web.ErrInvalidParam)
 		return
 	}
+	// Security policy has its own endpoint guarded by users.manage.
+	if _, ok := items[settingRequire2FAAdmin]; ok {
+		web.FailErr(w, r, web.ErrForbidden, settingRequire2FAAdmin+" is managed via /api/v1/auth/2fa/policy")
+		return
+	}
 
 	if err := h.settingRepo.SetBatch(items); err != nil {
 		web.FailErr(w, r, web.ErrSettingsUpdateFail)
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/openclaw"
 	"ClawDeckX/internal/snapshots"
 	"ClawDeckX/internal/web"
@@ -17,15 +21,18 @@ import (
 type SnapshotHandler struct {
 	svc        *snapshots.Service
 	scheduler  *snapshots.Scheduler
+	watcher    *snapshots.ChangeWatcher
 	auditRepo  *database.AuditLogRepo
 	gatewaySvc *openclaw.Service
 }
 
 func NewSnapshotHandler() *SnapshotHandler {
 	svc := snapshots.NewService()
+	scheduler := snapshots.NewScheduler(svc)
 	return &SnapshotHandler{
 		svc:       svc,
-		scheduler: snapshots.NewScheduler(svc),
+		scheduler: scheduler,
+		watcher:   snapshots.NewChangeWatcher(svc, scheduler),
 		auditRepo: database.NewAuditLogRepo(),
 	}
 }
@@ -38,6 +45,10 @@ func (h *SnapshotHandler) Scheduler() *snapshots.Scheduler {
 	return h.scheduler
 }
 
+func (h *SnapshotHandler) ChangeWatcher() *snapshots.ChangeWatcher {
+	return h.watcher
+}
+
 func (h *SnapshotHandler) SetGatewaySvc(svc *openclaw.Service) {
 	h.gatewaySvc = svc
 }
@@ -117,6 +128,211 @@ func (h *SnapshotHandler) GetScheduleStatus(w http.ResponseWriter, r *http.Reque
 	web.OK(w, r, status)
 }
 
+func (h *SnapshotHandler) GetAutoSnapshot(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, h.watcher.GetConfig())
+}
+
+func (h *SnapshotHandler) UpdateAutoSnapshot(w http.ResponseWriter, r *http.Request) {
+	var req snapshots.AutoSnapshotConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := h.watcher.UpdateConfig(req, web.GetUserID(r), web.GetUsername(r), r.RemoteAddr); err != nil {
+		web.FailErr(w, r, web.ErrSettingsUpdateFail, err.Error())
+		return
+	}
+	web.OK(w, r, h.watcher.GetConfig())
+}
+
+func (h *SnapshotHandler) GetAutoSnapshotStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.watcher.GetStatus()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		return
+	}
+	web.OK(w, r, status)
+}
+
+func (h *SnapshotHandler) GetTreeConfig(w http.ResponseWriter, r *http.Request) {
+	web.OK(w, r, h.svc.TreeConfig())
+}
+
+func (h *SnapshotHandler) UpdateTreeConfig(w http.ResponseWriter, r *http.Request) {
+	var req snapshots.TreeConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := h.svc.UpdateTreeConfig(req); err != nil {
+		web.FailErr(w, r, web.ErrSettingsUpdateFail, err.Error())
+		return
+	}
+	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotTreesUpdate, Result: "success",
+		Detail: fmt.Sprintf("workspace=%t,memory=%t,sessions=%t", req.Workspace.Enabled, req.Memory.Enabled, req.Sessions.Enabled), IP: r.RemoteAddr})
+	web.OK(w, r, h.svc.TreeConfig())
+}
+
+// PreviewTrees lists the workspace trees found and what a snapshot would
+// take from each under the current settings.
+func (h *SnapshotHandler) PreviewTrees(w http.ResponseWriter, r *http.Request) {
+	trees, err := h.svc.PreviewTrees()
+	if err != nil {
+		web.FailErr(w, r, web.ErrInternalError, err.Error())
+		return
+	}
+	web.OK(w, r, trees)
+}
+
+// GetKeyStatus returns the key configuration and how many snapshots the
+// current recovery and escrow keys cover.
+func (h *SnapshotHandler) GetKeyStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := h.svc.KeyStatus()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		return
+	}
+	web.OK(w, r, status)
+}
+
+func (h *SnapshotHandler) UpdateKeyConfig(w http.ResponseWriter, r *http.Request) {
+	var req snapshots.KeyConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if err := h.svc.UpdateKeyConfig(req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam, err.Error())
+		return
+	}
+	cfg := h.svc.KeyConfig()
+	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotKeysUpdate, Result: "success",
+		Detail: fmt.Sprintf("escrow=%q,kdf_memory=%d,kdf_iterations=%d", cfg.EscrowRecipient, cfg.KDF.Memory, cfg.KDF.Iterations), IP: r.RemoteAddr})
+	web.OK(w, r, cfg)
+}
+
+// GenerateRecoveryKey replaces the recovery key. The key is only ever
+// returned by this call.
+func (h *SnapshotHandler) GenerateRecoveryKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.svc.GenerateRecoveryKey()
+	if err != nil {
+		web.FailErr(w, r, web.ErrSettingsUpdateFail, err.Error())
+		return
+	}
+	cfg := h.svc.KeyConfig()
+	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotRecoveryKey, Result: "success", Detail: "generated " + cfg.RecoveryRecipient, IP: r.RemoteAddr})
+	web.OK(w, r, map[string]any{"recoveryKey": key, "recipient": cfg.RecoveryRecipient})
+}
+
+func (h *SnapshotHandler) RemoveRecoveryKey(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RemoveRecoveryKey(); err != nil {
+		web.FailErr(w, r, web.ErrSettingsUpdateFail, err.Error())
+		return
+	}
+	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotRecoveryKey, Result: "success", Detail: "removed", IP: r.RemoteAddr})
+	web.OK(w, r, h.svc.KeyConfig())
+}
+
+// Rewrap changes the password of every snapshot the old password, recovery
+// key or escrow identity opens, and the schedule password if it was the old
+// one.
+func (h *SnapshotHandler) Rewrap(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.OldPassword == "" || req.NewPassword == "" {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	result, err := h.svc.Rewrap(req.OldPassword, req.NewPassword)
+	if err != nil {
+		h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotRewrap, Result: "failed", Detail: err.Error(), IP: r.RemoteAddr})
+		web.FailErr(w, r, web.ErrInvalidParam, err.Error())
+		return
+	}
+	scheduleUpdated, err := h.scheduler.ReplacePassword(req.OldPassword, req.NewPassword)
+	if err != nil {
+		web.FailErr(w, r, web.ErrSettingsUpdateFail, err.Error())
+		return
+	}
+	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotRewrap, Result: "success",
+		Detail: fmt.Sprintf("rewrapped %d, skipped %d, schedule=%t", len(result.Rewrapped), len(result.Skipped), scheduleUpdated), IP: r.RemoteAddr})
+	web.OK(w, r, map[string]any{"rewrapped": result.Rewrapped, "skipped": result.Skipped, "scheduleUpdated": scheduleUpdated})
+}
+
+func (h *SnapshotHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	list, err := h.scheduler.ListSchedules()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		return
+	}
+	web.OK(w, r, list)
+}
+
+func (h *SnapshotHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req snapshots.ScheduleInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	view, err := h.scheduler.CreateSchedule(req, web.GetUserID(r), web.GetUsername(r), r.RemoteAddr)
+	if err != nil {
+		web.FailErr(w, r, web.ErrScheduleInvalid, err.Error())
+		return
+	}
+	web.OK(w, r, view)
+}
+
+// ReplaceSchedule handles PUT /api/v1/snapshots/schedules?id=N.
+func (h *SnapshotHandler) ReplaceSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleIDFromQuery(w, r)
+	if !ok {
+		return
+	}
+	var req snapshots.ScheduleInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	view, err := h.scheduler.UpdateSchedule(id, req, web.GetUserID(r), web.GetUsername(r), r.RemoteAddr)
+	if errors.Is(err, snapshots.ErrScheduleNotFound) {
+		web.FailErr(w, r, web.ErrScheduleNotFound)
+		return
+	}
+	if err != nil {
+		web.FailErr(w, r, web.ErrScheduleInvalid, err.Error())
+		return
+	}
+	web.OK(w, r, view)
+}
+
+func (h *SnapshotHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, ok := scheduleIDFromQuery(w, r)
+	if !ok {
+		return
+	}
+	err := h.scheduler.DeleteSchedule(id, web.GetUserID(r), web.GetUsername(r), r.RemoteAddr)
+	if errors.Is(err, snapshots.ErrScheduleNotFound) {
+		web.FailErr(w, r, web.ErrScheduleNotFound)
+		return
+	}
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		return
+	}
+	web.OK(w, r, map[string]any{"deleted": true, "id": id})
+}
+
+func scheduleIDFromQuery(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id == 0 {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return 0, false
+	}
+	return uint(id), true
+}
+
 func (h *SnapshotHandler) Action(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 	switch {
@@ -217,42 +433,58 @@ func (h *SnapshotHandler) Restore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// SSE streaming mode
-	flusher, ok := w.(http.Flusher)
+	stream, ok := startProgressStream(w)
 	if !ok {
 		web.FailErr(w, r, web.ErrInvalidParam)
 		return
 	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no")
-
-	sendSSE := func(evt snapshots.RestoreProgressEvent) {
-		data, _ := json.Marshal(evt)
-		fmt.Fprintf(w, "data: %s\n\n", data)
-		flusher.Flush()
-	}
-	res, err := h.svc.RestoreWithProgress(req.PreviewToken, req.RestorePlan, req.CreatePreRestoreSnapshot, req.Password, func(evt snapshots.RestoreProgressEvent) {
-		sendSSE(evt)
-	})
+	res, err := h.svc.RestoreWithProgress(req.PreviewToken, req.RestorePlan, req.CreatePreRestoreSnapshot, req.Password, stream.Send)
 	if err != nil {
-		sendSSE(snapshots.RestoreProgressEvent{Phase: "error", Error: err.Error()})
+		stream.Send(snapshots.RestoreProgressEvent{Phase: "error", Error: err.Error()})
 		return
 	}
 	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotRestore, Result: "success", Detail: snapshotID, IP: r.RemoteAddr})
 	// Auto-restart gateway if needed
 	if res.NeedsGatewayRestart && h.gatewaySvc != nil {
-		sendSSE(snapshots.RestoreProgressEvent{Phase: "restarting", File: "gateway"})
+		stream.Send(snapshots.RestoreProgressEvent{Phase: "restarting", File: "gateway"})
 		if err := h.gatewaySvc.Restart(); err != nil {
 			res.GatewayRestartError = err.Error()
 		} else {
 			res.GatewayRestarted = true
 		}
 	}
-	// Send final result
-	finalData, _ := json.Marshal(res)
-	fmt.Fprintf(w, "event: result\ndata: %s\n\n", finalData)
-	flusher.Flush()
+	stream.Result(res)
+}
+
+// progressStream reports snapshot progress events as server-sent events,
+// ending with an "event: result" carrying the response.
+type progressStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func startProgressStream(w http.ResponseWriter) (*progressStream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	return &progressStream{w: w, flusher: flusher}, true
+}
+
+func (s *progressStream) Send(evt snapshots.RestoreProgressEvent) {
+	data, _ := json.Marshal(evt)
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	s.flusher.Flush()
+}
+
+func (s *progressStream) Result(v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(s.w, "event: result\ndata: %s\n\n", data)
+	s.flusher.Flush()
 }
 
 func (h *SnapshotHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -270,7 +502,21 @@ func (h *SnapshotHandler) Delete(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *SnapshotHandler) ScheduleRunNow(w http.ResponseWriter, r *http.Request) {
-	resp, err := h.scheduler.RunNow(web.GetUserID(r), web.GetUsername(r), r.RemoteAddr)
+	// The body is optional; without a schedule_id the first schedule runs.
+	var req struct {
+		ScheduleID uint `json:"schedule_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+			web.FailErr(w, r, web.ErrInvalidBody)
+			return
+		}
+	}
+	resp, err := h.scheduler.RunNow(req.ScheduleID, web.GetUserID(r), web.GetUsername(r), r.RemoteAddr)
+	if errors.Is(err, snapshots.ErrScheduleNotFound) {
+		web.FailErr(w, r, web.ErrScheduleNotFound)
+		return
+	}
 	if err != nil {
 		web.FailErr(w, r, web.ErrSnapshotCreateFailed, err.Error())
 		return
@@ -278,45 +524,59 @@ func (h *SnapshotHandler) ScheduleRunNow(w http.ResponseWriter, r *http.Request)
 	web.OK(w, r, resp)
 }
 
-func (h *SnapshotHandler) Import(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(200 << 20); err != nil {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "file too large or invalid multipart form")
-		return
+// snapshotUploadMemory is how much of an uploaded archive is buffered in
+// memory; the rest is spooled to a temporary file.
+const snapshotUploadMemory = 8 << 20
+
+// openSnapshotUpload returns the "file" part of a multipart upload of at
+// most maxBytes.
+func openSnapshotUpload(w http.ResponseWriter, r *http.Request, maxBytes int64) (multipart.File, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	if err := r.ParseMultipartForm(snapshotUploadMemory); err != nil {
+		return nil, errors.New("file too large or invalid multipart form")
 	}
-	file, _, err := r.FormFile("file")
+	file, hdr, err := r.FormFile("file")
 	if err != nil {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "missing file field")
-		return
+		return nil, errors.New("missing file field")
 	}
-	defer file.Close()
+	if hdr.Size > maxBytes {
+		file.Close()
+		return nil, errors.New("file too large")
+	}
+	return file, nil
+}
 
-	data, err := io.ReadAll(io.LimitReader(file, 200<<20+1))
-	if err != nil || int64(len(data)) > 200<<20 {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "file too large")
+func (h *SnapshotHandler) Import(w http.ResponseWriter, r *http.Request) {
+	file, err := openSnapshotUpload(w, r, snapshots.MaxBundleBytes)
+	if err != nil {
+		web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
 		return
 	}
-	if len(data) < 8 {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "invalid backup file: too small")
+	defer file.Close()
+
+	// Non-streaming response unless the form asks for progress events
+	if r.FormValue("stream") != "true" {
+		rec, err := h.svc.ImportClawbak(file, nil)
+		if err != nil {
+			web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
+			return
+		}
+		h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotImport, Result: "success", Detail: rec.SnapshotID, IP: r.RemoteAddr})
+		web.OK(w, r, map[string]any{"snapshotId": rec.SnapshotID, "resourceCount": rec.ResourceCount, "sizeBytes": rec.SizeBytes})
 		return
 	}
-
-	// Parse: 8 bytes big-endian header length + header JSON + ciphertext
-	headerLen := uint64(data[0])<<56 | uint64(data[1])<<48 | uint64(data[2])<<40 | uint64(data[3])<<32 |
-		uint64(data[4])<<24 | uint64(data[5])<<16 | uint64(data[6])<<8 | uint64(data[7])
-	if headerLen == 0 || 8+headerLen > uint64(len(data)) {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "invalid backup file format")
+	stream, ok := startProgressStream(w)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
 		return
 	}
-	headerJSON := data[8 : 8+headerLen]
-	ciphertext := data[8+headerLen:]
-
-	rec, err := h.svc.ImportSnapshot(headerJSON, ciphertext)
+	rec, err := h.svc.ImportClawbak(file, stream.Send)
 	if err != nil {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
+		stream.Send(snapshots.RestoreProgressEvent{Phase: "error", Error: err.Error()})
 		return
 	}
 	h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotImport, Result: "success", Detail: rec.SnapshotID, IP: r.RemoteAddr})
-	web.OK(w, r, map[string]any{"snapshotId": rec.SnapshotID, "resourceCount": rec.ResourceCount, "sizeBytes": rec.SizeBytes})
+	stream.Result(map[string]any{"snapshotId": rec.SnapshotID, "resourceCount": rec.ResourceCount, "sizeBytes": rec.SizeBytes})
 }
 
 func (h *SnapshotHandler) Export(w http.ResponseWriter, r *http.Request) {
@@ -326,54 +586,24 @@ func (h *SnapshotHandler) Export(w http.ResponseWriter, r *http.Request) {
 		web.FailErr(w, r, web.ErrInvalidParam)
 		return
 	}
-	rec, err := h.svc.ExportSnapshot(snapshotID)
+	exp, err := h.svc.PrepareClawbak(snapshotID)
 	if err != nil {
 		web.FailErr(w, r, web.ErrDBQuery, err.Error())
 		return
 	}
-	exportName := "backup-" + rec.CreatedAt.Format("2006-01-02_150405") + ".clawbak"
+	exportName := "backup-" + exp.Record.CreatedAt.Format("2006-01-02_150405") + ".clawbak"
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+exportName+"\"")
-	envelope := map[string]any{
-		"version":       rec.SnapshotVersion,
-		"snapshotId":    rec.SnapshotID,
-		"note":          rec.Note,
-		"trigger":       rec.Trigger,
-		"cipherAlg":     rec.CipherAlg,
-		"kdfAlg":        rec.KDFAlg,
-		"kdfParams":     rec.KDFParamsJSON,
-		"salt":          rec.SaltB64,
-		"wrappedDEK":    rec.WrappedDEKB64,
-		"wrapNonce":     rec.WrapNonceB64,
-		"dataNonce":     rec.DataNonceB64,
-		"resourceCount": rec.ResourceCount,
-		"sizeBytes":     rec.SizeBytes,
-	}
-	header, _ := json.Marshal(envelope)
-	// Write header length (8 bytes big-endian) + header JSON + ciphertext
-	headerLen := uint64(len(header))
-	buf := make([]byte, 8)
-	buf[0] = byte(headerLen >> 56)
-	buf[1] = byte(headerLen >> 48)
-	buf[2] = byte(headerLen >> 40)
-	buf[3] = byte(headerLen >> 32)
-	buf[4] = byte(headerLen >> 24)
-	buf[5] = byte(headerLen >> 16)
-	buf[6] = byte(headerLen >> 8)
-	buf[7] = byte(headerLen)
-	w.Write(buf)
-	w.Write(header)
-	w.Write(rec.Ciphertext)
+	w.Header().Set("Content-Length", strconv.FormatInt(exp.Size, 10))
+	if _, err := exp.WriteTo(w); err != nil {
+		logger.Backup.Warn().Err(err).Str("snapshot_id", snapshotID).Msg("snapshot export interrupted")
+	}
 }
 
 func (h *SnapshotHandler) ImportOpenClaw(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(200 << 20); err != nil {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "file too large or invalid multipart form")
-		return
-	}
-	file, _, err := r.FormFile("file")
+	file, err := openSnapshotUpload(w, r, snapshots.MaxBundleBytes)
 	if err != nil {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "missing file field")
+		web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
 		return
 	}
 	defer file.Close()
@@ -381,13 +611,7 @@ func (h *SnapshotHandler) ImportOpenClaw(w http.ResponseWriter, r *http.Request)
 	password := r.FormValue("password")
 	note := r.FormValue("note")
 
-	data, err := io.ReadAll(io.LimitReader(file, 200<<20+1))
-	if err != nil || int64(len(data)) > 200<<20 {
-		web.FailErr(w, r, web.ErrSnapshotImportFailed, "file too large")
-		return
-	}
-
-	result, err := h.svc.ImportFromTarGz(data, password, note)
+	result, err := h.svc.ImportFromTarGz(file, password, note)
 	if err != nil {
 		web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
 		return
@@ -410,15 +634,18 @@ func (h *SnapshotHandler) ExportOpenClaw(w http.ResponseWriter, r *http.Request)
 		web.FailErr(w, r, web.ErrInvalidBody)
 		return
 	}
-	data, exportName, err := h.svc.ExportAsOpenClawTarGz(snapshotID, req.Password)
+	exp, err := h.svc.ExportAsOpenClawTarGz(snapshotID, req.Password)
 	if err != nil {
 		web.FailErr(w, r, web.ErrSnapshotExportFailed, err.Error())
 		return
 	}
+	// The archive is compressed while it is written, so its length is not
+	// known up front.
 	w.Header().Set("Content-Type", "application/gzip")
-	w.Header().Set("Content-Disposition", "attachment; filename=\""+exportName+"\"")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
-	w.Write(data)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+exp.Name+"\"")
+	if _, err := exp.WriteTo(w); err != nil {
+		logger.Backup.Warn().Err(err).Str("snapshot_id", snapshotID).Msg("openclaw export interrupted")
+	}
 }
 
 func (h *SnapshotHandler) Verify(w http.ResponseWriter, r *http.Request) {
@@ -430,17 +657,32 @@ func (h *SnapshotHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	}
 	var req struct {
 		Password string `json:"password"`
+		Stream   bool   `json:"stream"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		web.FailErr(w, r, web.ErrInvalidBody)
 		return
 	}
-	result, err := h.svc.VerifyIntegrity(snapshotID, req.Password)
+	if !req.Stream {
+		result, err := h.svc.VerifyIntegrity(snapshotID, req.Password)
+		if err != nil {
+			web.FailErr(w, r, web.ErrDBQuery, err.Error())
+			return
+		}
+		web.OK(w, r, result)
+		return
+	}
+	stream, ok := startProgressStream(w)
+	if !ok {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	result, err := h.svc.VerifyIntegrityWithProgress(snapshotID, req.Password, stream.Send)
 	if err != nil {
-		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		stream.Send(snapshots.RestoreProgressEvent{Phase: "error", Error: err.Error()})
 		return
 	}
-	web.OK(w, r, result)
+	stream.Result(result)
 }
 
 func (h *SnapshotHandler) PreviewFile(w http.ResponseWriter, r *http.Request) {
@@ -533,3 +775,60 @@ func (h *SnapshotHandler) PruneKeepN(w http.ResponseWriter, r *http.Request) {
 	}
 	web.OK(w, r, map[string]any{"deleted": deleted, "kept": req.KeepN})
 }
+
+// Migrate converts the legacy snapshots the given password opens to
+// deduplicated storage.
+func (h *SnapshotHandler) Migrate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	result, err := h.svc.MigrateLegacy(req.Password)
+	if err != nil {
+		h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotMigrate, Result: "failed", Detail: err.Error(), IP: r.RemoteAddr})
+		web.FailErr(w, r, web.ErrSnapshotCreateFailed, err.Error())
+		return
+	}
+	if len(result.Migrated) > 0 {
+		h.auditRepo.Create(&database.AuditLog{UserID: web.GetUserID(r), Username: web.GetUsername(r), Action: constants.ActionSnapshotMigrate, Result: "success", Detail: fmt.Sprintf("migrated %d, skipped %d, saved %d bytes", len(result.Migrated), len(result.Skipped), result.SavedBytes), IP: r.RemoteAddr})
+	}
+	web.OK(w, r, result)
+}
+
+// Diff compares two unlocked snapshots, or one against the live state when
+// toToken is empty.
+func (h *SnapshotHandler) Diff(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		FromToken string   `json:"fromToken"`
+		ToToken   string   `json:"toToken"`
+		Paths     []string `json:"paths"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.FromToken == "" {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	diff, err := h.svc.Diff(req.FromToken, req.ToToken, req.Paths)
+	if err != nil {
+		web.FailErr(w, r, web.ErrInvalidParam, err.Error())
+		return
+	}
+	web.OK(w, r, diff)
+}
+
+// Timeline lists the snapshots in which ?path= changed.
+func (h *SnapshotHandler) Timeline(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		web.FailErr(w, r, web.ErrInvalidParam, "path is required")
+		return
+	}
+	entries, err := h.svc.Timeline(path)
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery, err.Error())
+		return
+	}
+	web.OK(w, r, entries)
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/snapshots"
+	"ClawDeckX/internal/snapshots/targets"
+	"ClawDeckX/internal/web"
+
+	"gorm.io/gorm"
+)
+
+// targetProbeTimeout bounds connection tests and remote listings.
+const targetProbeTimeout = 30 * time.Second
+
+// SnapshotTargetHandler manages off-site backup targets and the snapshot
+// copies stored on them.
+type SnapshotTargetHandler struct {
+	repo       *database.SnapshotTargetRepo
+	auditRepo  *database.AuditLogRepo
+	replicator *snapshots.Replicator
+}
+
+func NewSnapshotTargetHandler(svc *snapshots.Service) *SnapshotTargetHandler {
+	return &SnapshotTargetHandler{
+		repo:       database.NewSnapshotTargetRepo(),
+		auditRepo:  database.NewAuditLogRepo(),
+		replicator: snapshots.NewReplicator(svc),
+	}
+}
+
+func (h *SnapshotTargetHandler) Replicator() *snapshots.Replicator {
+	return h.replicator
+}
+
+// SnapshotTargetResponse is a target with its configuration, secrets masked.
+type SnapshotTargetResponse struct {
+	database.SnapshotTarget
+	Config targets.Config `json:"config"`
+}
+
+type snapshotTargetRequest struct {
+	Name           string          `json:"name"`
+	Enabled        *bool           `json:"enabled"`
+	AutoUpload     *bool           `json:"auto_upload"`
+	RetentionCount *int            `json:"retention_count"`
+	Config         *targets.Config `json:"config"`
+}
+
+func targetResponse(t *database.SnapshotTarget) SnapshotTargetResponse {
+	cfg, _ := snapshots.TargetConfig(t)
+	return SnapshotTargetResponse{SnapshotTarget: *t, Config: cfg.Masked()}
+}
+
+// List returns all targets.
+func (h *SnapshotTargetHandler) List(w http.ResponseWriter, r *http.Request) {
+	list, err := h.repo.List()
+	if err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	out := make([]SnapshotTargetResponse, 0, len(list))
+	for i := range list {
+		out = append(out, targetResponse(&list[i]))
+	}
+	web.OK(w, r, out)
+}
+
+// Create adds a target.
+func (h *SnapshotTargetHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req snapshotTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		web.FailErr(w, r, web.ErrSnapshotTargetInvalid, "name is required")
+		return
+	}
+	if req.Config == nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetInvalid, "config is required")
+		return
+	}
+	t := &database.SnapshotTarget{Name: req.Name, Enabled: true, AutoUpload: true}
+	if !h.applyRequest(w, r, t, &req, req.Config.MergeSecrets(targets.Config{})) {
+		return
+	}
+	if err := h.repo.Create(t); err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetExists)
+		return
+	}
+	h.audit(r, constants.ActionSnapshotTargetCreate, t.Name+" ("+t.Type+")")
+	web.OK(w, r, targetResponse(t))
+}
+
+// Update changes a target. Secrets sent back masked or empty are kept.
+func (h *SnapshotTargetHandler) Update(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.targetFromQuery(w, r)
+	if !ok {
+		return
+	}
+	var req snapshotTargetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		t.Name = name
+	}
+	cfg, _ := snapshots.TargetConfig(t)
+	if req.Config != nil {
+		if req.Config.Type == "" {
+			req.Config.Type = t.Type
+		}
+		if req.Config.Type == t.Type {
+			cfg = req.Config.MergeSecrets(cfg)
+		} else {
+			cfg = req.Config.MergeSecrets(targets.Config{})
+		}
+	}
+	if !h.applyRequest(w, r, t, &req, cfg) {
+		return
+	}
+	if err := h.repo.Update(t); err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetExists)
+		return
+	}
+	h.audit(r, constants.ActionSnapshotTargetUpdate, t.Name)
+	web.OK(w, r, targetResponse(t))
+}
+
+// applyRequest validates cfg and the settings in req and copies them onto t.
+func (h *SnapshotTargetHandler) applyRequest(w http.ResponseWriter, r *http.Request, t *database.SnapshotTarget, req *snapshotTargetRequest, cfg targets.Config) bool {
+	if err := cfg.Validate(); err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetInvalid, err.Error())
+		return false
+	}
+	if req.RetentionCount != nil {
+		if *req.RetentionCount < 0 || *req.RetentionCount > 1000 {
+			web.FailErr(w, r, web.ErrSnapshotTargetInvalid, "retention_count must be between 0 and 1000")
+			return false
+		}
+		t.RetentionCount = *req.RetentionCount
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+	if req.AutoUpload != nil {
+		t.AutoUpload = *req.AutoUpload
+	}
+	raw, _ := json.Marshal(cfg)
+	t.Type = cfg.Type
+	t.Config = string(raw)
+	return true
+}
+
+// Delete removes a target. Snapshots already stored on it are kept there.
+func (h *SnapshotTargetHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.targetFromQuery(w, r)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(t.ID); err != nil {
+		web.FailErr(w, r, web.ErrDBQuery)
+		return
+	}
+	h.audit(r, constants.ActionSnapshotTargetDelete, t.Name)
+	web.OK(w, r, map[string]any{"deleted": true, "id": t.ID})
+}
+
+// Test checks a target configuration by writing, listing and deleting a
+// probe object. With an id, secrets missing from the request are taken from
+// the saved target. An SFTP config without host_key returns the server's key
+// for the operator to confirm instead.
+func (h *SnapshotTargetHandler) Test(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     uint           `json:"id"`
+		Config targets.Config `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	cfg := req.Config
+	if req.ID != 0 {
+		t, err := h.repo.GetByID(req.ID)
+		if err != nil {
+			web.FailErr(w, r, web.ErrSnapshotTargetNotFound)
+			return
+		}
+		if cfg.Type == "" {
+			cfg.Type = t.Type
+		}
+		if cfg.Type == t.Type {
+			prev, _ := snapshots.TargetConfig(t)
+			cfg = cfg.MergeSecrets(prev)
+		}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), targetProbeTimeout)
+	defer cancel()
+	if cfg.Type == targets.TypeSFTP && cfg.HostKey == "" && cfg.Host != "" {
+		key, err := targets.ScanHostKey(ctx, cfg.Host, cfg.Port)
+		if err != nil {
+			web.FailErr(w, r, web.ErrSnapshotTargetFailed, err.Error())
+			return
+		}
+		web.OK(w, r, map[string]any{"ok": false, "host_key": key})
+		return
+	}
+	if err := cfg.Validate(); err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetInvalid, err.Error())
+		return
+	}
+	if err := h.replicator.Test(ctx, cfg); err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetFailed, err.Error())
+		return
+	}
+	web.OK(w, r, map[string]any{"ok": true})
+}
+
+// Remote lists the snapshot files stored on a target.
+func (h *SnapshotTargetHandler) Remote(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.targetFromQuery(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), targetProbeTimeout)
+	defer cancel()
+	list, err := h.replicator.ListRemote(ctx, t.ID)
+	if err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetFailed, err.Error())
+		return
+	}
+	web.OK(w, r, list)
+}
+
+// Import downloads a snapshot file from a target and adds it to the local
+// snapshot list.
+func (h *SnapshotTargetHandler) Import(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TargetID uint   `json:"target_id"`
+		Name     string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if req.TargetID == 0 || req.Name == "" {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	rec, err := h.replicator.ImportFromTarget(r.Context(), req.TargetID, req.Name)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		web.FailErr(w, r, web.ErrSnapshotTargetNotFound)
+		return
+	case errors.Is(err, targets.ErrNotFound):
+		web.FailErr(w, r, web.ErrSnapshotImportFailed, "file not found on target")
+		return
+	case err != nil:
+		web.FailErr(w, r, web.ErrSnapshotImportFailed, err.Error())
+		return
+	}
+	h.audit(r, constants.ActionSnapshotRemoteImport, rec.SnapshotID+" <- "+req.Name)
+	web.OK(w, r, map[string]any{"snapshotId": rec.SnapshotID, "resourceCount": rec.ResourceCount, "sizeBytes": rec.SizeBytes})
+}
+
+// Upload copies a snapshot to a target now, e.g. to retry a failed upload
+// or to send an older snapshot to a new target.
+func (h *SnapshotTargetHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SnapshotID string `json:"snapshot_id"`
+		TargetID   uint   `json:"target_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	if req.SnapshotID == "" || req.TargetID == 0 {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+	u, err := h.replicator.Upload(r.Context(), req.SnapshotID, req.TargetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		web.FailErr(w, r, web.ErrSnapshotTargetNotFound)
+		return
+	}
+	if err != nil {
+		web.FailErr(w, r, web.ErrSnapshotUploadFailed, err.Error())
+		return
+	}
+	web.OK(w, r, u)
+}
+
+func (h *SnapshotTargetHandler) targetFromQuery(w http.ResponseWriter, r *http.Request) (*database.SnapshotTarget, bool) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil || id == 0 {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return nil, false
+	}
+	t, err := h.repo.GetByID(uint(id))
+	if err != nil {
+		web.FailErr(w, r, web.ErrSnapshotTargetNotFound)
+		return nil, false
+	}
+	return t, true
+}
+
+func (h *SnapshotTargetHandler) audit(r *http.Request, action, detail string) {
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   action,
+		Result:   "success",
+		Detail:   detail,
+		IP:       r.RemoteAddr,
+	})
+}
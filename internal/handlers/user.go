@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/rbac"
 	"ClawDeckX/internal/web"
 
 	"golang.org/x/crypto/bcrypt"
@@ -17,12 +19,14 @@ import (
 // UserHandler manages user CRUD operations.
 type UserHandler struct {
 	userRepo  *database.UserRepo
+	tokenRepo *database.APITokenRepo
 	auditRepo *database.AuditLogRepo
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
 		userRepo:  database.NewUserRepo(),
+		tokenRepo: database.NewAPITokenRepo(),
 		auditRepo: database.NewAuditLogRepo(),
 	}
 }
@@ -56,9 +60,9 @@ func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
 	web.OK(w, r, resp)
 }
 
-// Create creates a new user (admin only).
+// Create creates a new user (users.manage) with a role whose permissions the caller holds.
 func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
-	if web.GetRole(r) != constants.RoleAdmin {
+	if !web.HasPermission(r, constants.PermUsersManage) {
 		web.FailErr(w, r, web.ErrForbidden)
 		return
 	}
@@ -81,6 +85,13 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 	if req.Role == "" {
 		req.Role = constants.RoleReadonly
 	}
+	if !rbac.Exists(req.Role) {
+		web.FailErr(w, r, web.ErrRoleNotFound)
+		return
+	}
+	if !checkRoleGrantable(w, r, req.Role) {
+		return
+	}
 
 	if existing, _ := h.userRepo.FindByUsername(req.Username); existing != nil {
 		web.FailErr(w, r, web.ErrUserExists)
@@ -121,9 +132,82 @@ func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Delete removes a user (admin only, cannot delete self).
+// UpdateRole assigns a built-in or custom role to a user (users.manage, cannot change self).
+// The caller must hold every permission of both the old and the new role.
+// The user's sessions are revoked so the new permissions apply on the next login.
+func (h *UserHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil || id == 0 {
+		web.FailErr(w, r, web.ErrInvalidParam)
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		web.FailErr(w, r, web.ErrInvalidBody)
+		return
+	}
+	req.Role = strings.TrimSpace(req.Role)
+	if req.Role == "" {
+		web.FailErr(w, r, web.ErrInvalidParam, "role is required")
+		return
+	}
+
+	if uint(id) == web.GetUserID(r) {
+		web.FailErr(w, r, web.ErrUserSelfRole)
+		return
+	}
+	if !rbac.Exists(req.Role) {
+		web.FailErr(w, r, web.ErrRoleNotFound)
+		return
+	}
+
+	if !checkRoleGrantable(w, r, req.Role) {
+		return
+	}
+
+	user, err := h.userRepo.FindByID(uint(id))
+	if err != nil {
+		web.FailErr(w, r, web.ErrUserNotFound)
+		return
+	}
+	// Users holding permissions the caller lacks cannot be demoted by them either.
+	if !checkUserManageable(w, r, user) {
+		return
+	}
+	if err := h.userRepo.UpdateRole(user.ID, req.Role); err != nil {
+		web.FailErr(w, r, web.ErrUserUpdateFail)
+		return
+	}
+	if user.Role != req.Role {
+		revokeUserSessions(user.ID, "", "role_changed")
+	}
+
+	h.auditRepo.Create(&database.AuditLog{
+		UserID:   web.GetUserID(r),
+		Username: web.GetUsername(r),
+		Action:   constants.ActionUserRoleUpdate,
+		Result:   "success",
+		Detail:   user.Username + ": " + user.Role + " -> " + req.Role,
+		IP:       r.RemoteAddr,
+	})
+
+	logger.Auth.Info().Str("username", user.Username).Str("old", user.Role).Str("new", req.Role).Msg("user role changed")
+	web.OK(w, r, UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Role:      req.Role,
+		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// Delete removes a user (users.manage, cannot delete self) whose permissions
+// the caller holds.
 func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	if web.GetRole(r) != constants.RoleAdmin {
+	if !web.HasPermission(r, constants.PermUsersManage) {
 		web.FailErr(w, r, web.ErrForbidden)
 		return
 	}
@@ -145,11 +229,18 @@ func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		web.FailErr(w, r, web.ErrUserNotFound)
 		return
 	}
+	if !checkUserManageable(w, r, user) {
+		return
+	}
 
 	if err := h.userRepo.Delete(uint(id)); err != nil {
 		web.FailErr(w, r, web.ErrUserDeleteFail)
 		return
 	}
+	if err := h.tokenRepo.RevokeByUser(uint(id), time.Now().UTC()); err != nil {
+		logger.Auth.Warn().Err(err).Str("username", user.Username).Msg("failed to revoke API tokens of deleted user")
+	}
+	revokeUserSessions(user.ID, "", "user_deleted")
 
 	h.auditRepo.Create(&database.AuditLog{
 		UserID:   web.GetUserID(r),
@@ -146,6 +146,8 @@ const (
 	MsgCliCmdResetUsername = "cli.cmd_reset_username"
 	MsgCliCmdListUsers     = "cli.cmd_list_users"
 	MsgCliCmdUnlock        = "cli.cmd_unlock"
+	MsgCliCmdReset2FA      = "cli.cmd_reset_2fa"
+	MsgCliCmdAudit         = "cli.cmd_audit"
 	MsgCliExamples         = "cli.examples"
 	MsgCliExampleStart     = "cli.example_start"
 	MsgCliExamplePort      = "cli.example_port"
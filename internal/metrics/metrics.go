@@ -0,0 +1,222 @@
+// Package metrics implements the small subset of the Prometheus text
+// exposition format ClawDeckX needs: labelled counters, histograms and a
+// writer for gauges computed at scrape time.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition content type.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds suited to HTTP handlers.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Labels is an ordered list of label name/value pairs.
+type Labels []string
+
+// L builds a Labels list from alternating name/value arguments.
+func L(pairs ...string) Labels {
+	return Labels(pairs)
+}
+
+func (l Labels) key() string {
+	return strings.Join(l, "\xff")
+}
+
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(l); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(l[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	if !strings.ContainsAny(v, "\\\"\n") {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+// CounterVec is a set of monotonically increasing counters keyed by labels.
+type CounterVec struct {
+	name, help string
+
+	mu     sync.Mutex
+	values map[string]*counterEntry
+}
+
+type counterEntry struct {
+	labels Labels
+	value  float64
+}
+
+func NewCounterVec(name, help string) *CounterVec {
+	return &CounterVec{name: name, help: help, values: map[string]*counterEntry{}}
+}
+
+// Inc adds one to the counter with the given labels.
+func (c *CounterVec) Inc(labels Labels) {
+	c.Add(labels, 1)
+}
+
+// Add adds v to the counter with the given labels.
+func (c *CounterVec) Add(labels Labels, v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := labels.key()
+	e, ok := c.values[k]
+	if !ok {
+		e = &counterEntry{labels: append(Labels(nil), labels...)}
+		c.values[k] = e
+	}
+	e.value += v
+}
+
+// WriteTo writes the counter family in exposition format.
+func (c *CounterVec) WriteTo(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header(c.name, c.help, "counter")
+	for _, k := range sortedKeys(c.values) {
+		e := c.values[k]
+		w.Sample(c.name, e.labels, e.value)
+	}
+}
+
+// HistogramVec tracks value distributions keyed by labels.
+type HistogramVec struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramEntry
+}
+
+type histogramEntry struct {
+	labels Labels
+	counts []uint64 // per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+func NewHistogramVec(name, help string, buckets []float64) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{name: name, help: help, buckets: b, values: map[string]*histogramEntry{}}
+}
+
+// Observe records v for the given labels.
+func (h *HistogramVec) Observe(labels Labels, v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := labels.key()
+	e, ok := h.values[k]
+	if !ok {
+		e = &histogramEntry{labels: append(Labels(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = e
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			e.counts[i]++
+			break
+		}
+	}
+	e.count++
+	e.sum += v
+}
+
+// WriteTo writes the histogram family in exposition format.
+func (h *HistogramVec) WriteTo(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w.Header(h.name, h.help, "histogram")
+	for _, k := range sortedKeys(h.values) {
+		e := h.values[k]
+		var cum uint64
+		for i, ub := range h.buckets {
+			cum += e.counts[i]
+			w.Sample(h.name+"_bucket", append(append(Labels(nil), e.labels...), "le", formatFloat(ub)), float64(cum))
+		}
+		w.Sample(h.name+"_bucket", append(append(Labels(nil), e.labels...), "le", "+Inf"), float64(e.count))
+		w.Sample(h.name+"_sum", e.labels, e.sum)
+		w.Sample(h.name+"_count", e.labels, float64(e.count))
+	}
+}
+
+// Writer emits metric families in the Prometheus text format.
+type Writer struct {
+	bw *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{bw: bufio.NewWriter(w)}
+}
+
+// Header writes the HELP and TYPE lines for a metric family.
+func (w *Writer) Header(name, help, typ string) {
+	fmt.Fprintf(w.bw, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(help, "\n", " "), name, typ)
+}
+
+// Sample writes one sample line.
+func (w *Writer) Sample(name string, labels Labels, v float64) {
+	w.bw.WriteString(name)
+	w.bw.WriteString(labels.String())
+	w.bw.WriteByte(' ')
+	w.bw.WriteString(formatFloat(v))
+	w.bw.WriteByte('\n')
+}
+
+// Gauge writes a single unlabelled gauge family.
+func (w *Writer) Gauge(name, help string, v float64) {
+	w.Header(name, help, "gauge")
+	w.Sample(name, nil, v)
+}
+
+// Flush flushes buffered output.
+func (w *Writer) Flush() error {
+	return w.bw.Flush()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
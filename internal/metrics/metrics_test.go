@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHistogramExposition(t *testing.T) {
+	h := NewHistogramVec("req_seconds", "Request latency.", []float64{0.1, 1})
+	h.Observe(L("route", "/a"), 0.05)
+	h.Observe(L("route", "/a"), 0.5)
+	h.Observe(L("route", "/a"), 3)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	h.WriteTo(w)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"# TYPE req_seconds histogram",
+		`req_seconds_bucket{route="/a",le="0.1"} 1`,
+		`req_seconds_bucket{route="/a",le="1"} 2`,
+		`req_seconds_bucket{route="/a",le="+Inf"} 3`,
+		`req_seconds_sum{route="/a"} 3.55`,
+		`req_seconds_count{route="/a"} 3`,
+	}
+	for _, line := range want {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %q in output:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestCounterAndLabelEscaping(t *testing.T) {
+	c := NewCounterVec("events_total", "Events.")
+	c.Inc(L("event", `a"b`))
+	c.Add(L("event", `a"b`), 2)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	c.WriteTo(w)
+	w.Gauge("up", "Up.", 1)
+	_ = w.Flush()
+
+	out := buf.String()
+	if !strings.Contains(out, `events_total{event="a\"b"} 3`+"\n") {
+		t.Errorf("unexpected counter output:\n%s", out)
+	}
+	if !strings.Contains(out, "# TYPE up gauge\nup 1\n") {
+		t.Errorf("unexpected gauge output:\n%s", out)
+	}
+}
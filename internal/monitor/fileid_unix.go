@@ -0,0 +1,17 @@
+//go:build !windows
+
+package monitor
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of a file, used to recognise a session log
+// after it was renamed or replaced.
+func fileInode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package monitor
+
+import "os"
+
+// fileInode returns 0: os.FileInfo carries no file index on Windows, so
+// session logs are identified by their first line alone.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/riskpolicy"
 	"ClawDeckX/internal/web"
 )
 
@@ -18,8 +22,14 @@ type GWCollector struct {
 	activityRepo *database.ActivityRepo
 	wsHub        *web.WSHub
 	interval     time.Duration
-	stopCh       chan struct{}
-	running      bool
+
+	// stopCh is closed once by Stop; mu guards running and stopped so Start
+	// and Stop may race, as when a fleet member is removed right after it
+	// was added.
+	mu      sync.Mutex
+	stopCh  chan struct{}
+	running bool
+	stopped bool
 
 	lastSessions map[string]sessionSnapshot
 
@@ -28,6 +38,18 @@ type GWCollector struct {
 	logPollCount int
 
 	lifecycleRecorder *LifecycleRecorder
+
+	// onActivity is invoked after each activity is persisted (e.g. alert rule evaluation).
+	onActivity func(*database.Activity)
+
+	// gatewayID is the GatewayProfile ID stamped on written activities.
+	gatewayID atomic.Uint64
+	// fleetMember collectors watch a non-active gateway: they record activities
+	// but leave gw_event relays and badge updates to the primary collector.
+	fleetMember bool
+
+	// risk scores tool calls.
+	risk *riskpolicy.Engine
 }
 
 type sessionSnapshot struct {
@@ -49,6 +71,7 @@ func NewGWCollector(client *openclaw.GWClient, wsHub *web.WSHub, intervalSec int
 		stopCh:       make(chan struct{}),
 		lastSessions: make(map[string]sessionSnapshot),
 		logCursor:    -1,
+		risk:         riskpolicy.NewEngine(""),
 	}
 }
 
@@ -57,8 +80,38 @@ func (c *GWCollector) SetLifecycleRecorder(lr *LifecycleRecorder) {
 	c.lifecycleRecorder = lr
 }
 
+// SetActivityCallback registers an observer invoked after each activity is written.
+func (c *GWCollector) SetActivityCallback(fn func(*database.Activity)) {
+	c.onActivity = fn
+}
+
+// SetRiskEngine sets the engine that scores tool calls.
+func (c *GWCollector) SetRiskEngine(e *riskpolicy.Engine) {
+	c.risk = e
+}
+
+// SetGatewayID sets the GatewayProfile ID stamped on written activities.
+func (c *GWCollector) SetGatewayID(id uint) {
+	c.gatewayID.Store(uint64(id))
+}
+
+// SetFleetMember marks the collector as watching a secondary fleet gateway.
+func (c *GWCollector) SetFleetMember(id uint) {
+	c.SetGatewayID(id)
+	c.fleetMember = true
+}
+
+// Start runs the collector until Stop is called. It returns at once if the
+// collector is already running or has been stopped; a stopped collector
+// cannot be restarted.
 func (c *GWCollector) Start() {
+	c.mu.Lock()
+	if c.running || c.stopped {
+		c.mu.Unlock()
+		return
+	}
 	c.running = true
+	c.mu.Unlock()
 	logger.Monitor.Info().
 		Dur("interval", c.interval).
 		Msg(i18n.T(i18n.MsgLogGwCollectorStarted))
@@ -79,11 +132,15 @@ func (c *GWCollector) Start() {
 		select {
 		case <-ticker.C:
 			c.poll()
-			c.broadcastBadges()
+			if !c.fleetMember {
+				c.broadcastBadges()
+			}
 		case <-logTicker.C:
 			c.pollLogs(false)
 		case <-c.stopCh:
+			c.mu.Lock()
 			c.running = false
+			c.mu.Unlock()
 			logger.Monitor.Info().Msg(i18n.T(i18n.MsgLogGwCollectorStopped))
 			return
 		}
@@ -91,21 +148,27 @@ func (c *GWCollector) Start() {
 }
 
 func (c *GWCollector) Stop() {
-	if c.running {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.stopped {
+		c.stopped = true
 		close(c.stopCh)
-		c.stopCh = make(chan struct{})
 	}
 }
 
 func (c *GWCollector) IsRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.running
 }
 
 func (c *GWCollector) handleEvent(event string, payload json.RawMessage) {
-	c.wsHub.Broadcast("gw_event", event, payload)
-	// Compatibility alias: some UIs listen for "chat" only.
-	if event == "session.message" {
-		c.wsHub.Broadcast("gw_event", "chat", payload)
+	if !c.fleetMember {
+		c.wsHub.Broadcast("gw_event", event, payload)
+		// Compatibility alias: some UIs listen for "chat" only.
+		if event == "session.message" {
+			c.wsHub.Broadcast("gw_event", "chat", payload)
+		}
 	}
 
 	switch {
@@ -224,9 +287,7 @@ func (c *GWCollector) handleToolEvent(event string, payload json.RawMessage) {
 		toolName = data.Name
 	}
 
-	category := classifyTool(toolName)
-	risk := "low"
-	actionTaken := "allow"
+	assessment := c.risk.Assess(riskpolicy.EventFromDetail(string(payload)))
 
 	input := data.Input
 	if strings.HasPrefix(strings.TrimSpace(input), "{") {
@@ -241,7 +302,9 @@ func (c *GWCollector) handleToolEvent(event string, payload json.RawMessage) {
 		summary += " → " + input
 	}
 
-	c.writeActivity(category, risk, summary, string(payload), toolName, actionTaken, data.SessionID)
+	activity := c.newActivity(summary, string(payload), toolName, "allow", data.SessionID)
+	assessment.Apply(activity)
+	c.recordActivity(activity)
 }
 
 func (c *GWCollector) handleErrorEvent(payload json.RawMessage) {
@@ -281,6 +344,9 @@ func (c *GWCollector) broadcastBadges() {
 	if n, err := alertRepo.CountUnread(); err == nil {
 		badges["alerts"] = n
 	}
+	if byStatus, err := alertRepo.CountByStatus(); err == nil {
+		badges["alerts_open"] = byStatus[constants.AlertStatusOpen]
+	}
 	if c.client.IsConnected() {
 		if raw, err := c.client.Request("device.pair.list", nil); err == nil {
 			var resp struct {
@@ -424,54 +490,48 @@ func (c *GWCollector) poll() {
 }
 
 func (c *GWCollector) writeActivity(category, risk, summary, detail, source, actionTaken, sessionID string) {
-	eventID := fmt.Sprintf("gw-%d", time.Now().UnixNano())
+	activity := c.newActivity(summary, detail, source, actionTaken, sessionID)
+	activity.Category = category
+	activity.Risk = risk
+	c.recordActivity(activity)
+}
 
-	activity := &database.Activity{
-		EventID:     eventID,
+func (c *GWCollector) newActivity(summary, detail, source, actionTaken, sessionID string) *database.Activity {
+	return &database.Activity{
+		EventID:     fmt.Sprintf("gw-%d", time.Now().UnixNano()),
 		Timestamp:   time.Now().UTC(),
-		Category:    category,
-		Risk:        risk,
 		Summary:     summary,
 		Detail:      detail,
 		Source:      source,
 		ActionTaken: actionTaken,
 		SessionID:   sessionID,
+		GatewayID:   uint(c.gatewayID.Load()),
 	}
+}
 
+// recordActivity persists an activity, then notifies the observer and WS clients.
+func (c *GWCollector) recordActivity(activity *database.Activity) {
 	if err := c.activityRepo.Create(activity); err != nil {
-		logger.Monitor.Warn().Str("event_id", eventID).Err(err).Msg(i18n.T(i18n.MsgLogGwActivityWriteFailed))
+		logger.Monitor.Warn().Str("event_id", activity.EventID).Err(err).Msg(i18n.T(i18n.MsgLogGwActivityWriteFailed))
 		return
 	}
+	if c.onActivity != nil {
+		c.onActivity(activity)
+	}
 
 	c.wsHub.Broadcast("activity", "activity", map[string]interface{}{
-		"event_id":     eventID,
+		"event_id":     activity.EventID,
 		"timestamp":    activity.Timestamp.Format(time.RFC3339),
-		"category":     category,
-		"risk":         risk,
-		"summary":      summary,
-		"source":       source,
-		"action_taken": actionTaken,
+		"category":     activity.Category,
+		"risk":         activity.Risk,
+		"risk_score":   activity.RiskScore,
+		"summary":      activity.Summary,
+		"source":       activity.Source,
+		"action_taken": activity.ActionTaken,
+		"gateway_id":   activity.GatewayID,
 	})
 }
 
-func classifyTool(tool string) string {
-	lower := strings.ToLower(tool)
-	switch {
-	case strings.Contains(lower, "bash") || strings.Contains(lower, "shell") || strings.Contains(lower, "exec") || strings.Contains(lower, "command"):
-		return "Shell"
-	case strings.Contains(lower, "file") || strings.Contains(lower, "read") || strings.Contains(lower, "write") || strings.Contains(lower, "edit"):
-		return "File"
-	case strings.Contains(lower, "http") || strings.Contains(lower, "fetch") || strings.Contains(lower, "curl") || strings.Contains(lower, "request") || strings.Contains(lower, "network"):
-		return "Network"
-	case strings.Contains(lower, "browser") || strings.Contains(lower, "web") || strings.Contains(lower, "screenshot"):
-		return "Browser"
-	case strings.Contains(lower, "memory") || strings.Contains(lower, "store") || strings.Contains(lower, "cache"):
-		return "Memory"
-	default:
-		return "System"
-	}
-}
-
 // handleLogEvent processes gateway log events (event type: "log")
 func (c *GWCollector) handleLogEvent(payload json.RawMessage) {
 	var data struct {
@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/web"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGWCollector_StopBeforeStart(t *testing.T) {
+	client := openclaw.NewGWClient(openclaw.GWClientConfig{Host: "127.0.0.1", Port: 1})
+	c := NewGWCollector(client, web.NewWSHub(), 30)
+	c.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start kept running after Stop")
+	}
+	assert.False(t, c.IsRunning())
+	c.Stop()
+}
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"ClawDeckX/internal/availability"
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/logger"
 	"ClawDeckX/internal/web"
@@ -12,9 +13,10 @@ import (
 
 // LifecycleRecorder records gateway process lifecycle events and sends notifications.
 type LifecycleRecorder struct {
-	repo   *database.GatewayLifecycleRepo
-	wsHub  *web.WSHub
-	notify func(string) // notification callback
+	repo         *database.GatewayLifecycleRepo
+	availability *availability.Service
+	wsHub        *web.WSHub
+	notify       func(string) // notification callback
 
 	mu             sync.Mutex
 	lastEventType  string
@@ -24,6 +26,7 @@ type LifecycleRecorder struct {
 	gatewayPort    int
 	profileName    string
 	isRemote       bool
+	gatewayID      uint
 	cooldownPeriod time.Duration // min interval between same-type notifications
 	debouncePeriod time.Duration // min interval between same-type DB writes
 
@@ -41,6 +44,9 @@ type LifecycleRecorder struct {
 	// Local process detection callback (injected by serve.go)
 	isLocalProcessAlive func() bool
 
+	// Event observer invoked for every persisted lifecycle record (e.g. alert rules)
+	onEvent func(*database.GatewayLifecycle)
+
 	// Cleanup control
 	cleanupStopCh chan struct{}
 }
@@ -57,6 +63,7 @@ type aggEntry struct {
 func NewLifecycleRecorder(wsHub *web.WSHub) *LifecycleRecorder {
 	return &LifecycleRecorder{
 		repo:           database.NewGatewayLifecycleRepo(),
+		availability:   availability.NewService(),
 		wsHub:          wsHub,
 		cooldownPeriod: 5 * time.Minute,
 		debouncePeriod: 30 * time.Second,
@@ -81,6 +88,13 @@ func (lr *LifecycleRecorder) SetGatewayInfo(host string, port int, profileName s
 	lr.isRemote = isRemote
 }
 
+// SetGatewayID sets the GatewayProfile ID stamped on recorded events.
+func (lr *LifecycleRecorder) SetGatewayID(id uint) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.gatewayID = id
+}
+
 // SetNotifyShutdown controls whether shutdown events trigger notifications.
 func (lr *LifecycleRecorder) SetNotifyShutdown(enabled bool) {
 	lr.mu.Lock()
@@ -95,6 +109,14 @@ func (lr *LifecycleRecorder) SetLocalProcessAliveCallback(fn func() bool) {
 	lr.isLocalProcessAlive = fn
 }
 
+// SetEventCallback registers an observer invoked after each lifecycle record is persisted.
+// The callback runs while the recorder lock is held and must not call back into the recorder.
+func (lr *LifecycleRecorder) SetEventCallback(fn func(*database.GatewayLifecycle)) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.onEvent = fn
+}
+
 // IsLocalProcessAlive checks if the local gateway process is still running.
 // Returns true if no callback is set (fail-open).
 func (lr *LifecycleRecorder) IsLocalProcessAlive() bool {
@@ -108,7 +130,8 @@ func (lr *LifecycleRecorder) IsLocalProcessAlive() bool {
 }
 
 // StartCleanupLoop starts a background goroutine to periodically remove old lifecycle records.
-// Keeps records for maxAge and at most maxKeep total records.
+// Keeps records for maxAge and at most maxKeep total records. Daily availability rollups
+// are brought up to date first, so pruned history still counts in availability reports.
 func (lr *LifecycleRecorder) StartCleanupLoop(maxAge time.Duration, maxKeep int, interval time.Duration) {
 	lr.mu.Lock()
 	if lr.cleanupStopCh != nil {
@@ -125,6 +148,10 @@ func (lr *LifecycleRecorder) StartCleanupLoop(maxAge time.Duration, maxKeep int,
 		for {
 			select {
 			case <-ticker.C:
+				if err := lr.availability.Rollup(time.Now().Add(-maxAge)); err != nil {
+					logger.Monitor.Warn().Err(err).Msg("availability rollup failed, skipping lifecycle cleanup")
+					continue
+				}
 				if err := lr.repo.Cleanup(maxAge, maxKeep); err != nil {
 					logger.Monitor.Warn().Err(err).Msg("lifecycle cleanup failed")
 				}
@@ -179,6 +206,7 @@ func (lr *LifecycleRecorder) RecordStarted(reason string) {
 		GatewayPort: lr.gatewayPort,
 		ProfileName: lr.profileName,
 		IsRemote:    lr.isRemote,
+		GatewayID:   lr.gatewayID,
 		Reason:      reason,
 	}
 	if err := lr.repo.Create(record); err != nil {
@@ -186,7 +214,7 @@ func (lr *LifecycleRecorder) RecordStarted(reason string) {
 		return
 	}
 
-	lr.broadcast(record)
+	lr.publish(record)
 	lr.enqueueNotification(eventType, reason, 0)
 }
 
@@ -211,6 +239,7 @@ func (lr *LifecycleRecorder) RecordShutdown(reason string) {
 		GatewayPort: lr.gatewayPort,
 		ProfileName: lr.profileName,
 		IsRemote:    lr.isRemote,
+		GatewayID:   lr.gatewayID,
 		Reason:      reason,
 		UptimeSec:   uptimeSec,
 	}
@@ -219,7 +248,7 @@ func (lr *LifecycleRecorder) RecordShutdown(reason string) {
 		return
 	}
 
-	lr.broadcast(record)
+	lr.publish(record)
 	if lr.notifyShutdown {
 		lr.enqueueNotification("shutdown", reason, uptimeSec)
 	}
@@ -248,6 +277,7 @@ func (lr *LifecycleRecorder) RecordCrashed(errorDetail string) {
 		GatewayPort: lr.gatewayPort,
 		ProfileName: lr.profileName,
 		IsRemote:    lr.isRemote,
+		GatewayID:   lr.gatewayID,
 		ErrorDetail: errorDetail,
 		UptimeSec:   uptimeSec,
 	}
@@ -256,7 +286,7 @@ func (lr *LifecycleRecorder) RecordCrashed(errorDetail string) {
 		return
 	}
 
-	lr.broadcast(record)
+	lr.publish(record)
 	lr.enqueueNotification("crashed", errorDetail, uptimeSec)
 }
 
@@ -281,6 +311,7 @@ func (lr *LifecycleRecorder) RecordUnreachable(errorDetail string) {
 		GatewayPort: lr.gatewayPort,
 		ProfileName: lr.profileName,
 		IsRemote:    lr.isRemote,
+		GatewayID:   lr.gatewayID,
 		ErrorDetail: errorDetail,
 		UptimeSec:   uptimeSec,
 	}
@@ -289,10 +320,40 @@ func (lr *LifecycleRecorder) RecordUnreachable(errorDetail string) {
 		return
 	}
 
-	lr.broadcast(record)
+	lr.publish(record)
 	lr.enqueueNotification("unreachable", errorDetail, uptimeSec)
 }
 
+// RecordRemediation adds a finished remediation run to the timeline. The
+// entry is broadcast but not passed to the event observer: it annotates the
+// timeline and is not a change of the gateway's state.
+func (lr *LifecycleRecorder) RecordRemediation(run *database.RemediationRun) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	now := time.Now().UTC()
+	if run.FinishedAt != nil {
+		now = *run.FinishedAt
+	}
+	record := &database.GatewayLifecycle{
+		Timestamp:        now,
+		EventType:        "remediation",
+		GatewayHost:      lr.gatewayHost,
+		GatewayPort:      lr.gatewayPort,
+		ProfileName:      lr.profileName,
+		IsRemote:         lr.isRemote,
+		GatewayID:        run.GatewayID,
+		Reason:           fmt.Sprintf("%s: %s", run.PolicyName, run.Status),
+		ErrorDetail:      run.Error,
+		RemediationRunID: run.ID,
+	}
+	if err := lr.repo.Create(record); err != nil {
+		logger.Monitor.Error().Err(err).Msg("failed to record remediation event")
+		return
+	}
+	lr.broadcast(record)
+}
+
 // Recent returns the latest lifecycle records.
 func (lr *LifecycleRecorder) Recent(limit int) ([]database.GatewayLifecycle, error) {
 	return lr.repo.Recent(limit)
@@ -317,21 +378,32 @@ func (lr *LifecycleRecorder) calcUptime(now time.Time) int64 {
 	return int64(now.Sub(lr.startedAt).Seconds())
 }
 
+// publish fans a persisted record out to WebSocket clients and the event observer.
+// Must be called with lr.mu held.
+func (lr *LifecycleRecorder) publish(record *database.GatewayLifecycle) {
+	lr.broadcast(record)
+	if lr.onEvent != nil {
+		lr.onEvent(record)
+	}
+}
+
 func (lr *LifecycleRecorder) broadcast(record *database.GatewayLifecycle) {
 	if lr.wsHub == nil {
 		return
 	}
 	lr.wsHub.Broadcast("gw_lifecycle", record.EventType, map[string]interface{}{
-		"id":           record.ID,
-		"timestamp":    record.Timestamp.Format(time.RFC3339),
-		"event_type":   record.EventType,
-		"gateway_host": record.GatewayHost,
-		"gateway_port": record.GatewayPort,
-		"profile_name": record.ProfileName,
-		"is_remote":    record.IsRemote,
-		"reason":       record.Reason,
-		"error_detail": record.ErrorDetail,
-		"uptime_sec":   record.UptimeSec,
+		"id":                 record.ID,
+		"timestamp":          record.Timestamp.Format(time.RFC3339),
+		"event_type":         record.EventType,
+		"gateway_host":       record.GatewayHost,
+		"gateway_port":       record.GatewayPort,
+		"profile_name":       record.ProfileName,
+		"is_remote":          record.IsRemote,
+		"reason":             record.Reason,
+		"error_detail":       record.ErrorDetail,
+		"uptime_sec":         record.UptimeSec,
+		"gateway_id":         record.GatewayID,
+		"remediation_run_id": record.RemediationRunID,
 	})
 }
 
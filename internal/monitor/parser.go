@@ -2,15 +2,25 @@
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/riskpolicy"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 type RawEvent struct {
@@ -33,62 +43,362 @@ type NormalizedEvent struct {
 	Detail    string    `json:"detail"`
 	Source    string    `json:"source"`
 	SessionID string    `json:"session_id"`
+
+	Assessment riskpolicy.Assessment `json:"-"`
 }
 
+const (
+	// fullScanInterval is how often the sessions dir is globbed while it is
+	// watched, to catch events the watcher missed.
+	fullScanInterval = time.Minute
+	// headBytes bounds the first line hashed as a log's identity.
+	headBytes = 4096
+	// maxLineBytes is the longest line parsed; longer ones are skipped.
+	maxLineBytes = 1024 * 1024
+)
+
+// SessionParser ingests new lines of the OpenClaw session logs
+// (sessions/*.jsonl). Read positions are kept in the database together with
+// each file's identity (inode, size, hash of the first line), so a restart
+// resumes where it stopped and a truncated or rotated log is read again from
+// its start. Event IDs are derived from the file identity and the line, so
+// lines read twice map to the same Activity.
+//
+// Files are found through a directory watcher when one is available; only
+// changed files are stat'ed, and only files that grew or changed are opened.
+// Without a watcher every tick globs the dir instead.
 type SessionParser struct {
 	sessionsDir string
-	offsets     map[string]int64 // filename -> read offset
+	repo        *database.SessionFileStateRepo
+
+	mu           sync.Mutex
+	files        map[string]*fileState // path -> committed state
+	pending      map[string]*fileState // path -> state after the last read, nil = forget; applied by Commit
+	dirty        map[string]bool       // paths the watcher saw change
+	loaded       bool
+	watcher      *fsnotify.Watcher
+	watching     bool
+	fullScanDue  bool
+	lastFullScan time.Time
+	wake         chan struct{}
+	risk         *riskpolicy.Engine
+}
+
+type fileState struct {
+	inode    uint64
+	headHash string
+	size     int64
+	modTime  time.Time
+	offset   int64
 }
 
 func NewSessionParser(openclawDir string) *SessionParser {
 	return &SessionParser{
 		sessionsDir: filepath.Join(openclawDir, "sessions"),
-		offsets:     make(map[string]int64),
+		repo:        database.NewSessionFileStateRepo(),
+		files:       make(map[string]*fileState),
+		pending:     make(map[string]*fileState),
+		dirty:       make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		risk:        riskpolicy.NewEngine(""),
 	}
 }
 
-func (p *SessionParser) ReadNewEvents() ([]NormalizedEvent, error) {
-	var allEvents []NormalizedEvent
+// SetRiskEngine sets the engine that scores parsed events.
+func (p *SessionParser) SetRiskEngine(e *riskpolicy.Engine) {
+	p.risk = e
+}
 
-	files, err := filepath.Glob(filepath.Join(p.sessionsDir, "*.jsonl"))
+// Watch starts watching the sessions dir. It reports false when no watcher
+// could be created, in which case ReadNewEvents polls.
+func (p *SessionParser) Watch() bool {
+	w, err := fsnotify.NewWatcher()
 	if err != nil {
+		logger.Monitor.Warn().Err(err).Msg("session log watcher unavailable, polling instead")
+		return false
+	}
+	p.mu.Lock()
+	p.watcher = w
+	p.addWatchLocked()
+	p.mu.Unlock()
+	go p.watchLoop(w)
+	return true
+}
+
+// StopWatching closes the watcher started by Watch.
+func (p *SessionParser) StopWatching() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.watcher != nil {
+		p.watcher.Close()
+		p.watcher = nil
+		p.watching = false
+	}
+}
+
+// Changes signals when the watcher saw a session log change.
+func (p *SessionParser) Changes() <-chan struct{} {
+	return p.wake
+}
+
+func (p *SessionParser) watchLoop(w *fsnotify.Watcher) {
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Ext(ev.Name) != ".jsonl" || ev.Op == fsnotify.Chmod {
+				continue
+			}
+			p.mu.Lock()
+			p.dirty[ev.Name] = true
+			if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				p.fullScanDue = true
+			}
+			p.mu.Unlock()
+			select {
+			case p.wake <- struct{}{}:
+			default:
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			logger.Monitor.Warn().Err(err).Msg("session log watcher")
+			p.mu.Lock()
+			p.fullScanDue = true
+			p.mu.Unlock()
+		}
+	}
+}
+
+// addWatchLocked watches the sessions dir once it exists.
+func (p *SessionParser) addWatchLocked() {
+	if p.watcher == nil || p.watching {
+		return
+	}
+	if err := p.watcher.Add(p.sessionsDir); err != nil {
+		return
+	}
+	p.watching = true
+	p.fullScanDue = true
+	logger.Monitor.Info().Str("dir", p.sessionsDir).Msg("watching session logs")
+}
+
+// ReadNewEvents returns the events of lines appended since the last Commit.
+// The read positions it reaches take effect only once Commit is called, so
+// lines whose activities could not be stored are read again.
+func (p *SessionParser) ReadNewEvents() ([]NormalizedEvent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.loadLocked(); err != nil {
 		return nil, err
 	}
+	p.pending = make(map[string]*fileState)
 
-	for _, filePath := range files {
-		events, err := p.readFile(filePath)
+	p.addWatchLocked()
+	var paths []string
+	full := !p.watching || p.fullScanDue || time.Since(p.lastFullScan) >= fullScanInterval
+	if full {
+		files, err := filepath.Glob(filepath.Join(p.sessionsDir, "*.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		paths = files
+		p.adoptRenamedLocked(files)
+		p.fullScanDue = false
+		p.lastFullScan = time.Now()
+	} else {
+		for path := range p.dirty {
+			if _, err := os.Stat(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+	}
+	p.dirty = make(map[string]bool)
+
+	var allEvents []NormalizedEvent
+	for _, filePath := range paths {
+		events, next, err := p.readFile(filePath, p.stateLocked(filePath))
 		if err != nil {
 			logger.Monitor.Warn().Str("file", filePath).Err(err).Msg(i18n.T(i18n.MsgLogParseSessionFileFailed))
 			continue
 		}
+		if next != nil {
+			p.pending[filePath] = next
+		}
 		allEvents = append(allEvents, events...)
 	}
 
 	return allEvents, nil
 }
 
-func (p *SessionParser) readFile(filePath string) ([]NormalizedEvent, error) {
-	fileName := filepath.Base(filePath)
-	offset := p.offsets[fileName]
+// Commit makes the read positions reached by ReadNewEvents durable.
+func (p *SessionParser) Commit() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var firstErr error
+	for path, st := range p.pending {
+		var err error
+		if st == nil {
+			delete(p.files, path)
+			err = p.repo.Delete(path)
+		} else {
+			p.files[path] = st
+			err = p.repo.Upsert(&database.SessionFileState{
+				Path:       path,
+				Inode:      st.inode,
+				HeadHash:   st.headHash,
+				Size:       st.size,
+				ModTime:    st.modTime,
+				ReadOffset: st.offset,
+			})
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.pending = make(map[string]*fileState)
+	return firstErr
+}
+
+func (p *SessionParser) loadLocked() error {
+	if p.loaded {
+		return nil
+	}
+	states, err := p.repo.List()
+	if err != nil {
+		return err
+	}
+	for _, st := range states {
+		p.files[st.Path] = &fileState{
+			inode:    st.Inode,
+			headHash: st.HeadHash,
+			size:     st.Size,
+			modTime:  st.ModTime,
+			offset:   st.ReadOffset,
+		}
+	}
+	p.loaded = true
+	return nil
+}
+
+// stateLocked returns the state a file is read from: the pending one when
+// the current read already moved it, else the committed one.
+func (p *SessionParser) stateLocked(path string) *fileState {
+	if st, ok := p.pending[path]; ok {
+		return st
+	}
+	return p.files[path]
+}
+
+// adoptRenamedLocked hands the position of a log that disappeared to a new
+// path with the same inode and first line, so a renamed log is not read
+// again, and forgets logs that are gone.
+func (p *SessionParser) adoptRenamedLocked(present []string) {
+	exists := make(map[string]bool, len(present))
+	for _, path := range present {
+		exists[path] = true
+	}
+	var gone []string
+	for path := range p.files {
+		if !exists[path] {
+			gone = append(gone, path)
+		}
+	}
+	if len(gone) == 0 {
+		return
+	}
+	sort.Strings(gone)
+	for _, path := range present {
+		if _, known := p.files[path]; known {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		inode := fileInode(info)
+		for i, old := range gone {
+			st := p.files[old]
+			if st == nil || inode == 0 || st.inode != inode || st.headHash == "" {
+				continue
+			}
+			if head, err := headHashOf(path); err != nil || head != st.headHash {
+				continue
+			}
+			logger.Monitor.Debug().Str("from", old).Str("to", path).Msg("session log renamed")
+			p.pending[path] = st
+			p.pending[old] = nil
+			gone[i] = ""
+			break
+		}
+	}
+	for _, path := range gone {
+		if path != "" {
+			p.pending[path] = nil
+		}
+	}
+}
+
+// readFile parses the complete lines of a file past prev's position. It
+// returns a nil state when the file is unchanged since prev, without
+// opening it. A trailing line without newline is left for the next read.
+func (p *SessionParser) readFile(filePath string, prev *fileState) ([]NormalizedEvent, *fileState, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	inode := fileInode(info)
+	if prev != nil && prev.inode == inode && prev.size == info.Size() && prev.modTime.Equal(info.ModTime()) {
+		return nil, nil, nil
+	}
 
 	f, err := os.Open(filePath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
 
-	if offset > 0 {
-		if _, err := f.Seek(offset, 0); err != nil {
-			return nil, err
+	head, err := readHeadHash(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	var offset int64
+	if prev != nil {
+		switch {
+		case prev.headHash != "" && head != prev.headHash:
+			logger.Monitor.Info().Str("file", filePath).Msg("session log replaced, reading it from the start")
+		case info.Size() < prev.offset:
+			logger.Monitor.Info().Str("file", filePath).Msg("session log truncated, reading it from the start")
+		default:
+			offset = prev.offset
 		}
 	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
 
 	var events []NormalizedEvent
-	scanner := bufio.NewScanner(f)
-	scanner.Buffer(make([]byte, 0, 256*1024), 1024*1024)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+	reader := bufio.NewReaderSize(f, 64*1024)
+	pos := offset
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break // incomplete last line
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		lineStart := pos
+		pos += int64(len(data))
+		if len(data) > maxLineBytes {
+			logger.Monitor.Debug().Str("file", filePath).Int64("offset", lineStart).Msg(i18n.T(i18n.MsgLogSkipUnparseableLine))
+			continue
+		}
+		line := strings.TrimSpace(string(data))
 		if line == "" {
 			continue
 		}
@@ -99,101 +409,79 @@ func (p *SessionParser) readFile(filePath string) ([]NormalizedEvent, error) {
 			continue
 		}
 
-		event := normalizeEvent(raw)
+		event := normalizeEvent(raw, p.risk)
 		if event != nil {
+			event.EventID = lineEventID(head, lineStart, line)
 			events = append(events, *event)
 		}
 	}
 
-	newOffset, _ := f.Seek(0, 1) // get current position
-	p.offsets[fileName] = newOffset
-
-	return events, scanner.Err()
+	next := &fileState{
+		inode:    inode,
+		headHash: head,
+		size:     info.Size(),
+		modTime:  info.ModTime(),
+		offset:   pos,
+	}
+	return events, next, nil
 }
 
-func normalizeEvent(raw RawEvent) *NormalizedEvent {
-	ts := parseTimestamp(raw.Timestamp)
-	category := classifyCategory(raw.Tool, raw.Type)
-	risk := assessRisk(raw.Tool, raw.Input)
-	summary := buildSummary(raw)
-	detail, _ := json.Marshal(raw)
-
-	eventID := "evt_" + ts.Format("20060102150405") + "_" + sanitize(raw.Tool)
-
-	return &NormalizedEvent{
-		EventID:   eventID,
-		Timestamp: ts,
-		Category:  category,
-		Risk:      risk,
-		Summary:   summary,
-		Detail:    string(detail),
-		Source:    raw.Tool,
-		SessionID: raw.SessionID,
+// readHeadHash hashes the first line of f, or its first headBytes when the
+// line is longer. It returns "" while the first line is incomplete.
+func readHeadHash(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
 	}
+	buf := make([]byte, headBytes)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	head := buf[:n]
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		head = head[:i]
+	} else if n < headBytes {
+		return "", nil
+	}
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:]), nil
 }
 
-func classifyCategory(tool, eventType string) string {
-	tool = strings.ToLower(tool)
-
-	switch {
-	case strings.Contains(tool, "bash") || strings.Contains(tool, "shell") || strings.Contains(tool, "command"):
-		return constants.CategoryShell
-	case strings.Contains(tool, "file") || strings.Contains(tool, "read") || strings.Contains(tool, "write") || strings.Contains(tool, "edit"):
-		return constants.CategoryFile
-	case strings.Contains(tool, "http") || strings.Contains(tool, "fetch") || strings.Contains(tool, "curl") || strings.Contains(tool, "network"):
-		return constants.CategoryNetwork
-	case strings.Contains(tool, "browser") || strings.Contains(tool, "chrome") || strings.Contains(tool, "puppeteer"):
-		return constants.CategoryBrowser
-	case strings.Contains(tool, "message") || strings.Contains(tool, "chat") || strings.Contains(tool, "telegram") || strings.Contains(tool, "slack"):
-		return constants.CategoryMessage
-	case strings.Contains(tool, "memory") || strings.Contains(tool, "remember"):
-		return constants.CategoryMemory
-	default:
-		return constants.CategorySystem
+func headHashOf(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
 	}
+	defer f.Close()
+	return readHeadHash(f)
 }
 
-func assessRisk(tool string, input map[string]interface{}) string {
-	tool = strings.ToLower(tool)
-
-	if strings.Contains(tool, "bash") || strings.Contains(tool, "shell") {
-		cmd := extractCommand(input)
-		cmdLower := strings.ToLower(cmd)
-
-		highRiskPatterns := []string{
-			"rm -rf", "rm -r /", "mkfs", "dd if=",
-			"chmod 777", "curl | sh", "wget | sh",
-			"ssh ", "scp ", "rsync ",
-			"> /dev/", "shutdown", "reboot",
-			"passwd", "useradd", "userdel",
-		}
-		for _, p := range highRiskPatterns {
-			if strings.Contains(cmdLower, p) {
-				return constants.RiskHigh
-			}
-		}
+// lineEventID identifies a line by the log it is in and its position and
+// content, so reading it again yields the same ID.
+func lineEventID(headHash string, offset int64, line string) string {
+	sum := sha256.Sum256([]byte(headHash + ":" + strconv.FormatInt(offset, 10) + ":" + line))
+	return "evt_" + hex.EncodeToString(sum[:12])
+}
 
-		mediumRiskPatterns := []string{
-			"sudo ", "pip install", "npm install",
-			"apt install", "yum install", "brew install",
-			"chmod ", "chown ", "kill ",
-		}
-		for _, p := range mediumRiskPatterns {
-			if strings.Contains(cmdLower, p) {
-				return constants.RiskMedium
-			}
-		}
-	}
+func normalizeEvent(raw RawEvent, risk *riskpolicy.Engine) *NormalizedEvent {
+	ts := parseTimestamp(raw.Timestamp)
+	summary := buildSummary(raw)
+	detail, _ := json.Marshal(raw)
+	assessment := risk.Assess(riskpolicy.EventFromDetail(string(detail)))
 
-	if strings.Contains(tool, "http") || strings.Contains(tool, "fetch") {
-		return constants.RiskMedium
-	}
+	eventID := "evt_" + ts.Format("20060102150405") + "_" + sanitize(raw.Tool)
 
-	if strings.Contains(tool, "write") || strings.Contains(tool, "edit") {
-		return constants.RiskLow
+	return &NormalizedEvent{
+		EventID:    eventID,
+		Timestamp:  ts,
+		Category:   assessment.Category,
+		Risk:       assessment.Risk,
+		Summary:    summary,
+		Detail:     string(detail),
+		Source:     raw.Tool,
+		SessionID:  raw.SessionID,
+		Assessment: assessment,
 	}
-
-	return constants.RiskLow
 }
 
 func buildSummary(raw RawEvent) string {
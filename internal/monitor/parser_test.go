@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+	"ClawDeckX/internal/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sessionLine(tool, cmd string) string {
+	return fmt.Sprintf(`{"type":"tool_call","timestamp":"2026-03-01T10:00:00Z","tool":%q,"input":{"command":%q},"session_id":"s1"}`+"\n", tool, cmd)
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func readAndCommit(t *testing.T, p *SessionParser) []NormalizedEvent {
+	t.Helper()
+	events, err := p.ReadNewEvents()
+	require.NoError(t, err)
+	require.NoError(t, p.Commit())
+	return events
+}
+
+func newSessionsDir(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sessions"), 0o755))
+	return dir, filepath.Join(dir, "sessions", "a.jsonl")
+}
+
+func TestSessionParser_ResumesAfterRestart(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir, log := newSessionsDir(t)
+	first := sessionLine("bash", "ls")
+	appendFile(t, log, first+sessionLine("bash", "pwd")+`{"type":"tool_call","tool":"ba`)
+
+	events := readAndCommit(t, NewSessionParser(dir))
+	require.Len(t, events, 2, "the incomplete last line waits")
+	assert.NotEqual(t, events[0].EventID, events[1].EventID)
+
+	appendFile(t, log, `sh"}`+"\n"+sessionLine("bash", "whoami"))
+	restarted := NewSessionParser(dir)
+	events = readAndCommit(t, restarted)
+	require.Len(t, events, 2)
+	assert.Equal(t, "Execute whoami", events[1].Summary)
+	assert.Empty(t, readAndCommit(t, restarted))
+
+	// Lines read again keep their event IDs.
+	require.NoError(t, database.DB.Where("1 = 1").Delete(&database.SessionFileState{}).Error)
+	again := readAndCommit(t, NewSessionParser(dir))
+	require.Len(t, again, 4)
+	assert.Equal(t, events[1].EventID, again[3].EventID)
+}
+
+func TestSessionParser_DetectsTruncationAndRotation(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir, log := newSessionsDir(t)
+	appendFile(t, log, sessionLine("bash", "one")+sessionLine("bash", "two"))
+	p := NewSessionParser(dir)
+	require.Len(t, readAndCommit(t, p), 2)
+
+	// Truncated and rewritten with the same first line.
+	require.NoError(t, os.WriteFile(log, []byte(sessionLine("bash", "one")), 0o644))
+	events := readAndCommit(t, p)
+	require.Len(t, events, 1)
+	assert.Equal(t, "Execute one", events[0].Summary)
+
+	// Rotated: moved aside and replaced by a new log that has grown past
+	// the old position.
+	require.NoError(t, os.Rename(log, log+".1"))
+	appendFile(t, log, sessionLine("bash", "three")+sessionLine("bash", "four")+sessionLine("bash", "five"))
+	events = readAndCommit(t, p)
+	require.Len(t, events, 3)
+	assert.Equal(t, "Execute three", events[0].Summary)
+
+	// Renamed to another log name: nothing is read again.
+	renamed := filepath.Join(dir, "sessions", "b.jsonl")
+	require.NoError(t, os.Rename(log, renamed))
+	assert.Empty(t, readAndCommit(t, p))
+	states, err := database.NewSessionFileStateRepo().List()
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, renamed, states[0].Path)
+}
+
+func TestService_IngestsExactlyOnce(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir, log := newSessionsDir(t)
+	appendFile(t, log, sessionLine("bash", "ls")+sessionLine("bash", "pwd"))
+
+	NewService(dir, web.NewWSHub(), 5).scan()
+	// A crash before the positions were saved: the lines are read again.
+	require.NoError(t, database.DB.Where("1 = 1").Delete(&database.SessionFileState{}).Error)
+	appendFile(t, log, sessionLine("bash", "id"))
+	NewService(dir, web.NewWSHub(), 5).scan()
+
+	count, err := database.NewActivityRepo().Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+}
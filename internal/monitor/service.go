@@ -6,6 +6,7 @@ import (
 	"ClawDeckX/internal/database"
 	"ClawDeckX/internal/i18n"
 	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/riskpolicy"
 	"ClawDeckX/internal/web"
 )
 
@@ -16,6 +17,8 @@ type Service struct {
 	interval     time.Duration
 	stopCh       chan struct{}
 	running      bool
+
+	onActivity func(*database.Activity)
 }
 
 func NewService(openclawDir string, wsHub *web.WSHub, intervalSec int) *Service {
@@ -28,6 +31,16 @@ func NewService(openclawDir string, wsHub *web.WSHub, intervalSec int) *Service
 	}
 }
 
+// SetActivityCallback registers an observer invoked after each activity is written.
+func (s *Service) SetActivityCallback(fn func(*database.Activity)) {
+	s.onActivity = fn
+}
+
+// SetRiskEngine sets the engine that scores session log events.
+func (s *Service) SetRiskEngine(e *riskpolicy.Engine) {
+	s.parser.SetRiskEngine(e)
+}
+
 func (s *Service) IsRunning() bool {
 	return s.running
 }
@@ -38,6 +51,8 @@ func (s *Service) Start() {
 		Dur("interval", s.interval).
 		Msg(i18n.T(i18n.MsgLogMonitorStarted))
 
+	s.parser.Watch()
+	defer s.parser.StopWatching()
 	s.scan()
 
 	ticker := time.NewTicker(s.interval)
@@ -47,6 +62,8 @@ func (s *Service) Start() {
 		select {
 		case <-ticker.C:
 			s.scan()
+		case <-s.parser.Changes():
+			s.scan()
 		case <-s.stopCh:
 			s.running = false
 			logger.Monitor.Info().Msg(i18n.T(i18n.MsgLogMonitorStopped))
@@ -62,6 +79,10 @@ func (s *Service) Stop() {
 	}
 }
 
+// scan stores the activities of new session log lines. Lines already
+// stored under their event ID are skipped, so a read repeated after a failed
+// write or a crash does not duplicate them. Read positions are committed
+// only once every activity is stored.
 func (s *Service) scan() {
 	events, err := s.parser.ReadNewEvents()
 	if err != nil {
@@ -69,41 +90,65 @@ func (s *Service) scan() {
 		return
 	}
 
-	if len(events) == 0 {
-		return
+	if len(events) > 0 {
+		logger.Monitor.Debug().Int("count", len(events)).Msg(i18n.T(i18n.MsgLogMonitorNewEvents))
 	}
 
-	logger.Monitor.Debug().Int("count", len(events)).Msg(i18n.T(i18n.MsgLogMonitorNewEvents))
+	ids := make([]string, 0, len(events))
+	for _, evt := range events {
+		ids = append(ids, evt.EventID)
+	}
+	stored, err := s.activityRepo.ExistingEventIDs(ids)
+	if err != nil {
+		logger.Monitor.Error().Err(err).Msg(i18n.T(i18n.MsgLogMonitorScanFailed))
+		return
+	}
 
+	failed := false
 	for _, evt := range events {
+		if stored[evt.EventID] {
+			continue
+		}
 		actionTaken := "allow"
 		risk := evt.Risk
 
 		activity := &database.Activity{
 			EventID:     evt.EventID,
 			Timestamp:   evt.Timestamp,
-			Category:    evt.Category,
-			Risk:        risk,
 			Summary:     evt.Summary,
 			Detail:      evt.Detail,
 			Source:      evt.Source,
 			ActionTaken: actionTaken,
 			SessionID:   evt.SessionID,
 		}
+		evt.Assessment.Apply(activity)
 
 		if err := s.activityRepo.Create(activity); err != nil {
 			logger.Monitor.Warn().Str("event_id", evt.EventID).Err(err).Msg(i18n.T(i18n.MsgLogMonitorActivityWriteFailed))
+			failed = true
 			continue
 		}
+		stored[evt.EventID] = true
+		if s.onActivity != nil {
+			s.onActivity(activity)
+		}
 
 		s.wsHub.Broadcast("activity", "activity", map[string]interface{}{
 			"event_id":     evt.EventID,
 			"timestamp":    evt.Timestamp.Format(time.RFC3339),
 			"category":     evt.Category,
 			"risk":         risk,
+			"risk_score":   activity.RiskScore,
 			"summary":      evt.Summary,
 			"source":       evt.Source,
 			"action_taken": actionTaken,
 		})
 	}
+
+	if failed {
+		return // read the lines again next time
+	}
+	if err := s.parser.Commit(); err != nil {
+		logger.Monitor.Warn().Err(err).Msg("failed to save session log positions")
+	}
 }
@@ -249,6 +249,12 @@ func (m *Manager) Send(text string) {
 
 // SendAlert formats and sends an alert notification.
 func (m *Manager) SendAlert(risk, message, detail string) {
+	m.Send(FormatAlert(risk, message, detail))
+}
+
+// FormatAlert renders an alert as a single notification message prefixed
+// with a risk-level emoji. Short details are appended on a second line.
+func FormatAlert(risk, message, detail string) string {
 	emoji := "\u26a0\ufe0f"
 	switch risk {
 	case "critical":
@@ -264,7 +270,7 @@ func (m *Manager) SendAlert(risk, message, detail string) {
 	if detail != "" && len(detail) < 200 {
 		text += "\n" + detail
 	}
-	m.Send(text)
+	return text
 }
 
 // SendToChannel dispatches a message to a specific channel by name.
@@ -0,0 +1,97 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"ClawDeckX/internal/oidc"
+	"ClawDeckX/internal/oidc/oidctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authorize follows the mock IdP's authorization redirect and returns the code and state.
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.New("deck")
+	defer idp.Close()
+	idp.SetClaims(map[string]interface{}{"sub": "u-42", "preferred_username": "alice", "groups": []string{"ops"}})
+
+	ctx := context.Background()
+	c := oidc.NewClient(oidc.Config{Issuer: idp.Issuer(), ClientID: "deck", RedirectURL: "http://deck.local/cb"}, nil)
+
+	verifier, _ := oidc.RandomString()
+	authURL, err := c.AuthCodeURL(ctx, "st", "nn", verifier)
+	require.NoError(t, err)
+	assert.Contains(t, authURL, "code_challenge_method=S256")
+
+	code, state := authorize(t, authURL)
+	assert.Equal(t, "st", state)
+
+	tok, err := c.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+	id, err := c.Verify(ctx, tok.IDToken, "nn")
+	require.NoError(t, err)
+	assert.Equal(t, "u-42", id.Subject)
+	assert.Equal(t, "alice", id.Claims["preferred_username"])
+
+	_, err = c.Verify(ctx, tok.IDToken, "other")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	assert.Contains(t, c.EndSessionURL(ctx, "", "http://deck.local/"), idp.Issuer()+"/logout?")
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	idp := oidctest.New("deck")
+	defer idp.Close()
+
+	ctx := context.Background()
+	c := oidc.NewClient(oidc.Config{Issuer: idp.Issuer(), ClientID: "deck", RedirectURL: "http://deck.local/cb"}, nil)
+	verifier, _ := oidc.RandomString()
+	authURL, err := c.AuthCodeURL(ctx, "st", "nn", verifier)
+	require.NoError(t, err)
+	code, _ := authorize(t, authURL)
+
+	_, err = c.Exchange(ctx, code, "not-the-verifier")
+	assert.Error(t, err)
+}
+
+func TestVerifyRejectsOtherAudience(t *testing.T) {
+	idp := oidctest.New("deck")
+	defer idp.Close()
+
+	ctx := context.Background()
+	c := oidc.NewClient(oidc.Config{Issuer: idp.Issuer(), ClientID: "deck", RedirectURL: "http://deck.local/cb"}, nil)
+	verifier, _ := oidc.RandomString()
+	authURL, _ := c.AuthCodeURL(ctx, "st", "nn", verifier)
+	code, _ := authorize(t, authURL)
+	tok, err := c.Exchange(ctx, code, verifier)
+	require.NoError(t, err)
+
+	other := oidc.NewClient(oidc.Config{Issuer: idp.Issuer(), ClientID: "someone-else"}, nil)
+	_, err = other.Verify(ctx, tok.IDToken, "nn")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := oidctest.New("deck")
+	defer idp.Close()
+
+	c := oidc.NewClient(oidc.Config{Issuer: idp.Issuer() + "/tenant", ClientID: "deck"}, nil)
+	_, err := c.Provider(context.Background())
+	assert.Error(t, err)
+}
@@ -121,6 +121,7 @@ type GWClient struct {
 	onRestart        func() error                      // restart callback (injected externally)
 	onNotify         func(string)                      // notify callback (injected externally)
 	onLifecycle      func(event string, detail string) // lifecycle event callback
+	onHealthFailure  func(consecutiveFails int) bool   // returns true when a remediation policy handles the failure
 }
 
 func NewGWClient(cfg GWClientConfig) *GWClient {
@@ -151,6 +152,15 @@ func (c *GWClient) SetNotifyCallback(fn func(string)) {
 	c.onNotify = fn
 }
 
+// SetHealthFailureCallback sets a handler consulted when the heartbeat
+// watchdog reaches its failure threshold. When it returns true the built-in
+// restart is skipped.
+func (c *GWClient) SetHealthFailureCallback(fn func(consecutiveFails int) bool) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+	c.onHealthFailure = fn
+}
+
 func (c *GWClient) SetLifecycleCallback(fn func(event string, detail string)) {
 	c.healthMu.Lock()
 	defer c.healthMu.Unlock()
@@ -281,6 +291,22 @@ func (c *GWClient) healthCheckLoop() {
 					Int("max_fails", c.healthMaxFails).
 					Msg(i18n.T(i18n.MsgLogHeartbeatFailed))
 
+				if c.healthFailCount >= c.healthMaxFails && c.onHealthFailure != nil {
+					failureFn := c.onHealthFailure
+					fails := c.healthFailCount
+					c.healthMu.Unlock()
+					if failureFn(fails) {
+						logger.Gateway.Warn().
+							Int("consecutive_fails", fails).
+							Msg("heartbeat threshold reached, handed to remediation policy")
+						c.healthMu.Lock()
+						c.healthFailCount = 0
+						c.healthGraceUntil = time.Now().Add(restartGracePeriod)
+						c.healthMu.Unlock()
+						continue
+					}
+					c.healthMu.Lock()
+				}
 				if c.healthFailCount >= c.healthMaxFails && c.onRestart != nil {
 					logger.Gateway.Warn().
 						Int("consecutive_fails", c.healthFailCount).
@@ -0,0 +1,113 @@
+// Package rbac resolves role names to permission sets. The built-in admin and
+// readonly roles are fixed in code; custom roles live in the roles table.
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+)
+
+// ErrUnknownRole is returned when a role name is neither built-in nor stored.
+var ErrUnknownRole = errors.New("unknown role")
+
+// Role is the API view of a role with its permissions expanded.
+type Role struct {
+	ID          uint     `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"built_in"`
+}
+
+// IsBuiltIn reports whether name is one of the fixed roles.
+func IsBuiltIn(name string) bool {
+	return name == constants.RoleAdmin || name == constants.RoleReadonly
+}
+
+// BuiltInRoles returns the fixed roles in display order.
+func BuiltInRoles() []Role {
+	return []Role{
+		{Name: constants.RoleAdmin, Description: "Full access", Permissions: append([]string(nil), constants.AllPermissions...), BuiltIn: true},
+		{Name: constants.RoleReadonly, Description: "Read-only access", Permissions: []string{}, BuiltIn: true},
+	}
+}
+
+// ValidPermission reports whether name is a known permission.
+func ValidPermission(name string) bool {
+	for _, p := range constants.AllPermissions {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizePermissions trims, deduplicates and sorts perms, rejecting unknown names.
+func NormalizePermissions(perms []string) ([]string, error) {
+	seen := make(map[string]bool, len(perms))
+	out := make([]string, 0, len(perms))
+	for _, p := range perms {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[p] {
+			continue
+		}
+		if !ValidPermission(p) {
+			return nil, fmt.Errorf("unknown permission %q", p)
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// FromRecord converts a stored custom role to its API view.
+func FromRecord(rec *database.Role) Role {
+	return Role{
+		ID:          rec.ID,
+		Name:        rec.Name,
+		Description: rec.Description,
+		Permissions: SplitPermissions(rec.Permissions),
+	}
+}
+
+// SplitPermissions parses the comma-separated permission column.
+func SplitPermissions(s string) []string {
+	out := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Resolve returns the permissions granted to role. Unknown roles resolve to
+// ErrUnknownRole so callers can fall back to no permissions.
+func Resolve(role string) ([]string, error) {
+	switch role {
+	case constants.RoleAdmin:
+		return append([]string(nil), constants.AllPermissions...), nil
+	case constants.RoleReadonly:
+		return []string{}, nil
+	}
+	rec, err := database.NewRoleRepo().FindByName(role)
+	if err != nil {
+		return nil, ErrUnknownRole
+	}
+	return FromRecord(rec).Permissions, nil
+}
+
+// Exists reports whether role can be assigned to a user.
+func Exists(role string) bool {
+	if IsBuiltIn(role) {
+		return true
+	}
+	_, err := database.NewRoleRepo().FindByName(role)
+	return err == nil
+}
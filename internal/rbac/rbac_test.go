@@ -0,0 +1,48 @@
+package rbac
+
+import (
+	"testing"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	require.NoError(t, database.NewRoleRepo().Create(&database.Role{
+		Name:        "operator",
+		Permissions: "gateway.control, snapshots.restore",
+	}))
+
+	perms, err := Resolve(constants.RoleAdmin)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, constants.AllPermissions, perms)
+
+	perms, err = Resolve(constants.RoleReadonly)
+	require.NoError(t, err)
+	assert.Empty(t, perms)
+
+	perms, err = Resolve("operator")
+	require.NoError(t, err)
+	assert.Equal(t, []string{constants.PermGatewayControl, constants.PermSnapshotsRestore}, perms)
+
+	_, err = Resolve("ghost")
+	assert.ErrorIs(t, err, ErrUnknownRole)
+	assert.True(t, Exists("operator"))
+	assert.False(t, Exists("ghost"))
+}
+
+func TestNormalizePermissions(t *testing.T) {
+	perms, err := NormalizePermissions([]string{" config.write", "gateway.control", "config.write", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"config.write", "gateway.control"}, perms)
+
+	_, err = NormalizePermissions([]string{"everything"})
+	assert.Error(t, err)
+}
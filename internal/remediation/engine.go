@@ -0,0 +1,678 @@
+package remediation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/alerting"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/notify"
+)
+
+const (
+	// runRetention is how long finished runs are kept.
+	runRetention = 90 * 24 * time.Hour
+	// maxTriggerDesc bounds the trigger text stored with a run.
+	maxTriggerDesc = 500
+)
+
+// healthPollInterval is how often verify_health probes the gateway.
+var healthPollInterval = 2 * time.Second
+
+// Step result statuses.
+const (
+	StepOK      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+// ErrPolicyBusy is returned by RunNow while the policy is already running.
+var ErrPolicyBusy = errors.New("policy is already running")
+
+// Actions carries out remediation steps against the primary gateway.
+// *GatewayActions implements it.
+type Actions interface {
+	Restart() error
+	Healthy() bool
+	// Diagnose returns the overall result (pass, warn, fail) and the full report.
+	Diagnose() (summary, report string, err error)
+	// SetConcurrency sets agents.defaults.maxConcurrent, halving it when n is 0.
+	SetConcurrency(n int) (prev, next int, err error)
+	ConfigModTime() (time.Time, error)
+	// RollbackConfig restores openclaw.json from the newest snapshot taken before.
+	RollbackConfig(before time.Time) (string, error)
+	// TailLogs returns gateway log lines written after cursor. A negative
+	// cursor starts at the current end of the log.
+	TailLogs(cursor int64) (lines []string, next int64, err error)
+}
+
+// StepResult is the outcome of one step of a run.
+type StepResult struct {
+	Action     string    `json:"action"`
+	Status     string    `json:"status"` // ok, failed, skipped
+	Detail     string    `json:"detail,omitempty"`
+	Output     string    `json:"output,omitempty"` // e.g. the diagnose report
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Run is the decoded form of database.RemediationRun returned by the API.
+type Run struct {
+	ID         uint         `json:"id"`
+	PolicyID   uint         `json:"policy_id"`
+	PolicyName string       `json:"policy_name"`
+	GatewayID  uint         `json:"gateway_id"`
+	Trigger    string       `json:"trigger"`
+	Status     string       `json:"status"`
+	Steps      []StepResult `json:"steps"`
+	Error      string       `json:"error,omitempty"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+}
+
+// RunFromRecord decodes a persisted run.
+func RunFromRecord(rec *database.RemediationRun) *Run {
+	run := &Run{
+		ID:         rec.ID,
+		PolicyID:   rec.PolicyID,
+		PolicyName: rec.PolicyName,
+		GatewayID:  rec.GatewayID,
+		Trigger:    rec.Trigger,
+		Status:     rec.Status,
+		Steps:      []StepResult{},
+		Error:      rec.Error,
+		StartedAt:  rec.StartedAt,
+		FinishedAt: rec.FinishedAt,
+	}
+	if rec.StepsJSON != "" {
+		_ = json.Unmarshal([]byte(rec.StepsJSON), &run.Steps)
+	}
+	return run
+}
+
+// Engine runs remediation policies for the primary gateway. Policies are
+// cached in memory and refreshed via Reload. Lifecycle events, watchdog
+// failures and gateway log lines are counted per policy; a policy whose
+// threshold is reached runs its steps in the background, at most MaxRuns
+// times per RunWindowSec, after which its on_exhausted steps run once.
+type Engine struct {
+	policyRepo *database.RemediationPolicyRepo
+	runRepo    *database.RemediationRunRepo
+	actions    Actions
+	alerts     *alerting.Manager
+	notifier   alerting.Notifier
+	onRun      func(*database.RemediationRun)
+	afterFunc  func(time.Duration, func()) *time.Timer
+
+	mu        sync.Mutex
+	gatewayID uint
+	policies  []*Policy
+	states    map[uint]*policyState
+	logCursor int64
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+type policyState struct {
+	hits      []time.Time // at most Trigger.Threshold most recent hits inside the window
+	runs      []time.Time // run start times inside the run window
+	exhausted bool        // on_exhausted already ran for the current window
+	running   bool
+	pending   *time.Timer // for_sec timer waiting to see if the gateway stays down
+	updatedAt time.Time
+}
+
+// NewEngine creates an engine and closes runs a previous process left running.
+func NewEngine(actions Actions, alerts *alerting.Manager, notifier alerting.Notifier) *Engine {
+	runRepo := database.NewRemediationRunRepo()
+	if err := runRepo.MarkInterrupted(); err != nil {
+		logger.Gateway.Warn().Err(err).Msg("failed to close interrupted remediation runs")
+	}
+	return &Engine{
+		policyRepo: database.NewRemediationPolicyRepo(),
+		runRepo:    runRepo,
+		actions:    actions,
+		alerts:     alerts,
+		notifier:   notifier,
+		afterFunc:  time.AfterFunc,
+		states:     make(map[uint]*policyState),
+		logCursor:  -1,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// SetRunCallback sets the observer called once a run has finished, e.g. to
+// add it to the lifecycle timeline.
+func (e *Engine) SetRunCallback(fn func(*database.RemediationRun)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onRun = fn
+}
+
+// SetGatewayID selects the gateway whose events the engine reacts to.
+// Pending for_sec timers of the previous gateway are dropped.
+func (e *Engine) SetGatewayID(id uint) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.gatewayID == id {
+		return
+	}
+	e.gatewayID = id
+	e.logCursor = -1
+	for _, st := range e.states {
+		st.stopPending()
+		st.hits = nil
+	}
+}
+
+// Reload re-reads enabled policies from the database. Counters and run
+// history are kept for policies that were not modified since the last load.
+func (e *Engine) Reload() error {
+	records, err := e.policyRepo.ListEnabled()
+	if err != nil {
+		return err
+	}
+	policies := make([]*Policy, 0, len(records))
+	for i := range records {
+		p, err := PolicyFromRecord(&records[i])
+		if err != nil {
+			logger.Gateway.Warn().Err(err).Uint("policy_id", records[i].ID).Msg("skipping invalid remediation policy")
+			continue
+		}
+		policies = append(policies, p)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	keep := make(map[uint]bool, len(policies))
+	for _, p := range policies {
+		if st, ok := e.states[p.ID]; ok && st.updatedAt.Equal(p.UpdatedAt) {
+			keep[p.ID] = true
+		}
+	}
+	for id, st := range e.states {
+		if !keep[id] && !st.running {
+			st.stopPending()
+			delete(e.states, id)
+		}
+	}
+	for _, p := range policies {
+		if st, ok := e.states[p.ID]; ok && !keep[p.ID] {
+			// Modified while running: keep the running flag, restart counting.
+			st.stopPending()
+			st.hits, st.runs, st.exhausted = nil, nil, false
+			st.updatedAt = p.UpdatedAt
+		}
+	}
+	e.policies = policies
+	logger.Gateway.Debug().Int("policies", len(policies)).Msg("remediation policies reloaded")
+	return nil
+}
+
+// Policies returns the currently loaded (enabled) policies.
+func (e *Engine) Policies() []*Policy {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]*Policy, len(e.policies))
+	copy(out, e.policies)
+	return out
+}
+
+// Start polls the gateway log for log-triggered policies every interval and
+// prunes old runs, until Stop is called.
+func (e *Engine) Start(interval time.Duration) {
+	if err := e.runRepo.Cleanup(runRetention); err != nil {
+		logger.Gateway.Warn().Err(err).Msg("remediation run cleanup failed")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(6 * time.Hour)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case <-ticker.C:
+			e.pollLogs()
+		case <-cleanup.C:
+			if err := e.runRepo.Cleanup(runRetention); err != nil {
+				logger.Gateway.Warn().Err(err).Msg("remediation run cleanup failed")
+			}
+		}
+	}
+}
+
+// Stop ends the log poller, drops pending timers and interrupts waiting steps.
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() {
+		close(e.stopCh)
+		e.mu.Lock()
+		for _, st := range e.states {
+			st.stopPending()
+		}
+		e.mu.Unlock()
+	})
+}
+
+// ObserveLifecycle counts a lifecycle event of the primary gateway towards
+// lifecycle policies. A gateway coming back cancels pending for_sec timers.
+func (e *Engine) ObserveLifecycle(ev *database.GatewayLifecycle) {
+	if ev == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.GatewayID != e.gatewayID {
+		return
+	}
+	if ev.EventType == "started" || ev.EventType == "recovered" {
+		for _, st := range e.states {
+			st.stopPending()
+		}
+	}
+	desc := ev.EventType
+	if ev.ErrorDetail != "" {
+		desc += ": " + ev.ErrorDetail
+	} else if ev.Reason != "" {
+		desc += ": " + ev.Reason
+	}
+	ts := alerting.EventTime(ev.Timestamp)
+	for _, p := range e.policies {
+		if !p.matchLifecycle(ev.EventType) {
+			continue
+		}
+		if p.Trigger.ForSec == 0 {
+			e.hitLocked(p, desc, ts)
+			continue
+		}
+		st := e.stateLocked(p)
+		if st.pending != nil {
+			continue
+		}
+		p, forDesc := p, fmt.Sprintf("%s (still down after %s)", desc, alerting.FormatWindow(time.Duration(p.Trigger.ForSec)*time.Second))
+		var timer *time.Timer
+		timer = e.afterFunc(time.Duration(p.Trigger.ForSec)*time.Second, func() {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			if st.pending != timer {
+				return // cancelled, or replaced after a reload
+			}
+			st.pending = nil
+			e.hitLocked(p, forDesc, time.Now().UTC())
+		})
+		st.pending = timer
+	}
+}
+
+// HandleHealthFailure is called by the heartbeat watchdog when it reached
+// its failure threshold. It reports whether a health_check policy took over,
+// in which case the watchdog skips its built-in restart.
+func (e *Engine) HandleHealthFailure(consecutiveFails int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	handled := false
+	desc := fmt.Sprintf("health check failed %d times in a row", consecutiveFails)
+	for _, p := range e.policies {
+		if p.Trigger.Kind != TriggerHealthCheck {
+			continue
+		}
+		handled = true
+		e.hitLocked(p, desc, time.Now().UTC())
+	}
+	return handled
+}
+
+// ObserveLogLines counts gateway log lines towards log policies.
+func (e *Engine) ObserveLogLines(lines []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := time.Now().UTC()
+	for _, line := range lines {
+		for _, p := range e.policies {
+			if p.matchLog(line) {
+				e.hitLocked(p, "log: "+strings.TrimSpace(line), now)
+			}
+		}
+	}
+}
+
+// RunNow runs a saved policy's steps immediately, regardless of its trigger
+// and run limit. It returns the ID of the started run.
+func (e *Engine) RunNow(policyID uint, by string) (uint, error) {
+	rec, err := e.policyRepo.GetByID(policyID)
+	if err != nil {
+		return 0, err
+	}
+	p, err := PolicyFromRecord(rec)
+	if err != nil {
+		return 0, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	st := e.stateLocked(p)
+	if st.running {
+		return 0, ErrPolicyBusy
+	}
+	run, err := e.beginLocked(p, st, "manual run by "+by, RunRunning)
+	if err != nil {
+		return 0, err
+	}
+	e.wg.Add(1)
+	go e.execute(p, st, run, p.Steps)
+	return run.ID, nil
+}
+
+func (e *Engine) pollLogs() {
+	e.mu.Lock()
+	needed := false
+	for _, p := range e.policies {
+		if p.Trigger.Kind == TriggerLog {
+			needed = true
+			break
+		}
+	}
+	cursor := e.logCursor
+	e.mu.Unlock()
+	if !needed || e.actions == nil {
+		return
+	}
+	lines, next, err := e.actions.TailLogs(cursor)
+	if err != nil {
+		logger.Gateway.Debug().Err(err).Msg("remediation log poll failed")
+		return
+	}
+	e.mu.Lock()
+	if e.logCursor != cursor {
+		// The gateway changed while polling.
+		e.mu.Unlock()
+		return
+	}
+	e.logCursor = next
+	e.mu.Unlock()
+	e.ObserveLogLines(lines)
+}
+
+func (e *Engine) stateLocked(p *Policy) *policyState {
+	st := e.states[p.ID]
+	if st == nil {
+		st = &policyState{updatedAt: p.UpdatedAt}
+		e.states[p.ID] = st
+	}
+	return st
+}
+
+// hitLocked records a trigger hit and starts a run once the threshold is
+// reached, unless the policy is running or out of runs. Must be called with
+// e.mu held.
+func (e *Engine) hitLocked(p *Policy, desc string, ts time.Time) {
+	st := e.stateLocked(p)
+	t := &p.Trigger
+	st.hits = append(alerting.PruneHits(st.hits, ts, t.Window()), ts)
+	if len(st.hits) < t.Threshold {
+		return
+	}
+	if t.Threshold > 1 {
+		desc = fmt.Sprintf("%s (%dx in %s)", desc, len(st.hits), alerting.FormatWindow(t.Window()))
+	}
+	st.hits = nil
+	if st.running {
+		logger.Gateway.Debug().Uint("policy_id", p.ID).Msg("remediation policy already running, trigger ignored")
+		return
+	}
+
+	st.runs = alerting.PruneHits(st.runs, ts, p.RunWindow())
+	steps, status := p.Steps, RunRunning
+	if len(st.runs) >= p.MaxRuns {
+		if st.exhausted {
+			logger.Gateway.Debug().Uint("policy_id", p.ID).Msg("remediation policy out of runs, trigger ignored")
+			return
+		}
+		st.exhausted = true
+		steps, status = p.OnExhausted, RunExhausted
+		desc = fmt.Sprintf("%s; %d runs in %s already, remediation stopped", desc, len(st.runs), alerting.FormatWindow(p.RunWindow()))
+	} else {
+		st.runs = append(st.runs, ts)
+		st.exhausted = false
+	}
+
+	run, err := e.beginLocked(p, st, desc, status)
+	if err != nil {
+		logger.Gateway.Error().Err(err).Uint("policy_id", p.ID).Msg("failed to record remediation run")
+		return
+	}
+	e.wg.Add(1)
+	go e.execute(p, st, run, steps)
+}
+
+// beginLocked persists a new run and marks the policy running.
+func (e *Engine) beginLocked(p *Policy, st *policyState, desc, status string) (*database.RemediationRun, error) {
+	if len(desc) > maxTriggerDesc {
+		desc = desc[:maxTriggerDesc] + "…"
+	}
+	run := &database.RemediationRun{
+		PolicyID:   p.ID,
+		PolicyName: p.Name,
+		GatewayID:  e.gatewayID,
+		Trigger:    desc,
+		Status:     status,
+		StepsJSON:  "[]",
+		StartedAt:  time.Now().UTC(),
+	}
+	if err := e.runRepo.Create(run); err != nil {
+		return nil, err
+	}
+	st.running = true
+	logger.Gateway.Info().Uint("policy_id", p.ID).Uint("run_id", run.ID).Str("trigger", desc).
+		Msg("remediation policy triggered")
+	return run, nil
+}
+
+// execute runs the steps of a run and records its outcome.
+func (e *Engine) execute(p *Policy, st *policyState, run *database.RemediationRun, steps []Step) {
+	defer e.wg.Done()
+	results := e.runSteps(p, run, steps)
+
+	failed := false
+	for _, r := range results {
+		if r.Status == StepFailed {
+			failed = true
+			run.Error = r.Action + ": " + r.Detail
+			break
+		}
+	}
+	switch {
+	case run.Status == RunExhausted:
+	case failed:
+		run.Status = RunFailed
+	default:
+		run.Status = RunSucceeded
+	}
+	stepsJSON, _ := json.Marshal(results)
+	run.StepsJSON = string(stepsJSON)
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	if err := e.runRepo.Update(run); err != nil {
+		logger.Gateway.Error().Err(err).Uint("run_id", run.ID).Msg("failed to save remediation run")
+	}
+	logger.Gateway.Info().Uint("policy_id", p.ID).Uint("run_id", run.ID).Str("status", run.Status).
+		Msg("remediation run finished")
+
+	e.mu.Lock()
+	st.running = false
+	onRun := e.onRun
+	e.mu.Unlock()
+	if onRun != nil {
+		onRun(run)
+	}
+}
+
+func (e *Engine) runSteps(p *Policy, run *database.RemediationRun, steps []Step) []StepResult {
+	results := make([]StepResult, 0, len(steps))
+	failed := false
+	for i := range steps {
+		s := &steps[i]
+		start := time.Now().UTC()
+		res := StepResult{Action: s.Action, StartedAt: start}
+		if (s.When == WhenFailed && !failed) || (s.When == WhenOK && failed) {
+			res.Status, res.Detail = StepSkipped, "condition not met"
+		} else {
+			res.Status, res.Detail, res.Output = e.runStep(p, run, s, results)
+		}
+		res.DurationMs = time.Since(start).Milliseconds()
+		if res.Status == StepFailed {
+			failed = true
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+// runStep carries out one step. done holds the results of the steps before it.
+func (e *Engine) runStep(p *Policy, run *database.RemediationRun, s *Step, done []StepResult) (status, detail, output string) {
+	if e.actions == nil && s.Action != ActionAlert && s.Action != ActionWait {
+		return StepFailed, "gateway actions unavailable", ""
+	}
+	switch s.Action {
+	case ActionRestart:
+		if err := e.actions.Restart(); err != nil {
+			return StepFailed, err.Error(), ""
+		}
+		return StepOK, "gateway restart requested", ""
+
+	case ActionReduceConcurrency:
+		prev, next, err := e.actions.SetConcurrency(s.Concurrency)
+		if err != nil {
+			return StepFailed, err.Error(), ""
+		}
+		if prev == next {
+			return StepSkipped, fmt.Sprintf("maxConcurrent already %d", next), ""
+		}
+		return StepOK, fmt.Sprintf("maxConcurrent %d → %d", prev, next), ""
+
+	case ActionVerifyHealth:
+		timeout := s.timeout()
+		deadline := time.Now().Add(timeout)
+		for {
+			if e.actions.Healthy() {
+				return StepOK, "gateway is healthy", ""
+			}
+			if !time.Now().Before(deadline) {
+				return StepFailed, fmt.Sprintf("gateway not healthy after %s", alerting.FormatWindow(timeout)), ""
+			}
+			if !e.sleep(healthPollInterval) {
+				return StepFailed, "interrupted by shutdown", ""
+			}
+		}
+
+	case ActionDiagnose:
+		summary, report, err := e.actions.Diagnose()
+		if err != nil {
+			return StepFailed, err.Error(), ""
+		}
+		return StepOK, "diagnose result: " + summary, report
+
+	case ActionRollback:
+		modified, err := e.actions.ConfigModTime()
+		if err != nil {
+			return StepFailed, err.Error(), ""
+		}
+		if s.ChangedWithinSec > 0 {
+			if age := time.Since(modified); age > time.Duration(s.ChangedWithinSec)*time.Second {
+				return StepSkipped, fmt.Sprintf("config unchanged for %s", alerting.FormatWindow(age.Truncate(time.Second))), ""
+			}
+		}
+		desc, err := e.actions.RollbackConfig(modified)
+		if err != nil {
+			return StepFailed, err.Error(), ""
+		}
+		return StepOK, desc, ""
+
+	case ActionAlert:
+		return e.raiseAlert(p, run, s, done)
+
+	case ActionWait:
+		if !e.sleep(s.timeout()) {
+			return StepFailed, "interrupted by shutdown", ""
+		}
+		return StepOK, "waited " + alerting.FormatWindow(s.timeout()), ""
+	}
+	return StepFailed, "unsupported action", ""
+}
+
+// raiseAlert opens an alert for the run carrying the results of the steps
+// so far, diagnose reports included, and notifies unless it is suppressed.
+func (e *Engine) raiseAlert(p *Policy, run *database.RemediationRun, s *Step, done []StepResult) (string, string, string) {
+	if e.alerts == nil {
+		return StepFailed, "alerting unavailable", ""
+	}
+	status := "ok"
+	for _, r := range done {
+		if r.Status == StepFailed {
+			status = "failed"
+		}
+	}
+	tmpl := s.Message
+	if tmpl == "" {
+		if run.Status == RunExhausted {
+			tmpl = "{policy}: remediation stopped after reaching its run limit"
+		} else {
+			tmpl = "{policy}: gateway remediation {status}"
+		}
+	}
+	message := strings.NewReplacer(
+		"{policy}", p.Name,
+		"{trigger}", run.Trigger,
+		"{status}", status,
+	).Replace(tmpl)
+	detail, _ := json.Marshal(map[string]interface{}{
+		"policy_id":   p.ID,
+		"policy_name": p.Name,
+		"run_id":      run.ID,
+		"gateway_id":  run.GatewayID,
+		"trigger":     run.Trigger,
+		"steps":       done,
+	})
+	dedupKey := fmt.Sprintf("remediation:%d", p.ID)
+	if run.GatewayID != 0 {
+		dedupKey += fmt.Sprintf("@gw%d", run.GatewayID)
+	}
+	res, err := e.alerts.Raise(&alerting.Raise{
+		DedupKey:  dedupKey,
+		GatewayID: run.GatewayID,
+		Risk:      s.Risk,
+		Message:   message,
+		Detail:    string(detail),
+	})
+	if err != nil {
+		return StepFailed, err.Error(), ""
+	}
+	if !res.Suppressed && e.notifier != nil {
+		e.notifier.Send(notify.FormatAlert(s.Risk, message, run.Trigger))
+	}
+	return StepOK, "alert " + res.Alert.AlertID, ""
+}
+
+// sleep waits for d, returning false if the engine stopped first.
+func (e *Engine) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-e.stopCh:
+		return false
+	}
+}
+
+func (st *policyState) stopPending() {
+	if st.pending != nil {
+		st.pending.Stop()
+		st.pending = nil
+	}
+}
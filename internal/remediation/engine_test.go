@@ -0,0 +1,354 @@
+package remediation
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/alerting"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeActions struct {
+	mu          sync.Mutex
+	calls       []string
+	restartErr  error
+	healthy     bool
+	concurrency int
+	configMod   time.Time
+	rolledBack  []time.Time
+}
+
+func (a *fakeActions) record(call string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, call)
+}
+
+func (a *fakeActions) Calls() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.calls...)
+}
+
+func (a *fakeActions) Restart() error {
+	a.record(ActionRestart)
+	return a.restartErr
+}
+
+func (a *fakeActions) Healthy() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.healthy
+}
+
+func (a *fakeActions) Diagnose() (string, string, error) {
+	a.record(ActionDiagnose)
+	return "fail", `{"summary":"fail","message":"port 18789 closed"}`, nil
+}
+
+func (a *fakeActions) SetConcurrency(n int) (int, int, error) {
+	a.record(ActionReduceConcurrency)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev := a.concurrency
+	if n == 0 {
+		n = max(prev/2, 1)
+	}
+	a.concurrency = n
+	return prev, n, nil
+}
+
+func (a *fakeActions) ConfigModTime() (time.Time, error) {
+	return a.configMod, nil
+}
+
+func (a *fakeActions) RollbackConfig(before time.Time) (string, error) {
+	a.record(ActionRollback)
+	a.rolledBack = append(a.rolledBack, before)
+	return "restored", nil
+}
+
+func (a *fakeActions) TailLogs(cursor int64) ([]string, int64, error) {
+	return nil, cursor, nil
+}
+
+type fakeNotifier struct {
+	sent chan string
+}
+
+func (n *fakeNotifier) Send(text string) { n.sent <- text }
+
+func (n *fakeNotifier) SendToChannel(channel, text string) error {
+	n.sent <- text
+	return nil
+}
+
+func savePolicy(t *testing.T, p *Policy) *Policy {
+	t.Helper()
+	p.Enabled = true
+	require.NoError(t, p.Normalize())
+	rec, err := p.Record()
+	require.NoError(t, err)
+	require.NoError(t, database.NewRemediationPolicyRepo().Create(rec))
+	saved, err := PolicyFromRecord(rec)
+	require.NoError(t, err)
+	return saved
+}
+
+func newTestEngine(t *testing.T, actions Actions) (*Engine, *[]*database.RemediationRun, *fakeNotifier) {
+	t.Helper()
+	notifier := &fakeNotifier{sent: make(chan string, 16)}
+	engine := NewEngine(actions, alerting.NewManager(nil, notifier), notifier)
+	var mu sync.Mutex
+	var finished []*database.RemediationRun
+	engine.SetRunCallback(func(run *database.RemediationRun) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished = append(finished, run)
+	})
+	t.Cleanup(engine.Stop)
+	return engine, &finished, notifier
+}
+
+func crashed() *database.GatewayLifecycle {
+	return &database.GatewayLifecycle{ID: 1, EventType: "crashed", ErrorDetail: "exit status 137", Timestamp: time.Now().UTC()}
+}
+
+func TestPolicyNormalize(t *testing.T) {
+	p := &Policy{Name: " x ", Trigger: Trigger{Kind: TriggerLifecycle, EventTypes: []string{"crashed"}}, Steps: []Step{{Action: ActionAlert}}}
+	require.NoError(t, p.Normalize())
+	assert.Equal(t, "x", p.Name)
+	assert.Equal(t, 1, p.Trigger.Threshold)
+	assert.Equal(t, defaultMaxRuns, p.MaxRuns)
+	assert.Equal(t, defaultRunWindowSec, p.RunWindowSec)
+	assert.Equal(t, "high", p.Steps[0].Risk)
+
+	steps := []Step{{Action: ActionRestart}}
+	for name, bad := range map[string]*Policy{
+		"no name":        {Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: steps},
+		"bad kind":       {Name: "x", Trigger: Trigger{Kind: "cron"}, Steps: steps},
+		"no events":      {Name: "x", Trigger: Trigger{Kind: TriggerLifecycle}, Steps: steps},
+		"bad event":      {Name: "x", Trigger: Trigger{Kind: TriggerLifecycle, EventTypes: []string{"exploded"}}, Steps: steps},
+		"for_sec on up":  {Name: "x", Trigger: Trigger{Kind: TriggerLifecycle, EventTypes: []string{"started"}, ForSec: 60}, Steps: steps},
+		"no window":      {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck, Threshold: 3}, Steps: steps},
+		"bad pattern":    {Name: "x", Trigger: Trigger{Kind: TriggerLog, Pattern: "("}, Steps: steps},
+		"stray pattern":  {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck, Pattern: "oom"}, Steps: steps},
+		"no steps":       {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}},
+		"bad action":     {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: []Step{{Action: "reboot"}}},
+		"bad when":       {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: []Step{{Action: ActionRestart, When: "sometimes"}}},
+		"bad risk":       {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: []Step{{Action: ActionAlert, Risk: "severe"}}},
+		"long timeout":   {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: []Step{{Action: ActionWait, TimeoutSec: 3600}}},
+		"bad exhausted":  {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: steps, OnExhausted: []Step{{Action: "panic"}}},
+		"negative limit": {Name: "x", Trigger: Trigger{Kind: TriggerHealthCheck}, Steps: steps, RunWindowSec: -1},
+	} {
+		assert.Error(t, bad.Normalize(), name)
+	}
+}
+
+func TestEngine_RestartsUntilExhaustedThenAlerts(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	actions := &fakeActions{}
+	engine, finished, notifier := newTestEngine(t, actions)
+	savePolicy(t, &Policy{
+		Name:         "crash restart",
+		Trigger:      Trigger{Kind: TriggerLifecycle, EventTypes: []string{"crashed"}},
+		Steps:        []Step{{Action: ActionRestart}},
+		MaxRuns:      3,
+		RunWindowSec: 900,
+		OnExhausted:  []Step{{Action: ActionAlert, Risk: "critical"}},
+	})
+	require.NoError(t, engine.Reload())
+
+	for i := 0; i < 5; i++ {
+		engine.ObserveLifecycle(crashed())
+		engine.wg.Wait()
+	}
+	assert.Equal(t, []string{ActionRestart, ActionRestart, ActionRestart}, actions.Calls())
+	require.Len(t, *finished, 4, "three restarts and one exhausted run; later crashes are ignored")
+
+	runs, total, err := database.NewRemediationRunRepo().List(database.RemediationRunFilter{})
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, total)
+	exhausted := RunFromRecord(&runs[0])
+	assert.Equal(t, RunExhausted, exhausted.Status)
+	assert.Contains(t, exhausted.Trigger, "remediation stopped")
+	require.Len(t, exhausted.Steps, 1)
+	assert.Equal(t, StepOK, exhausted.Steps[0].Status)
+	assert.Equal(t, RunSucceeded, runs[1].Status)
+	assert.NotNil(t, runs[1].FinishedAt)
+
+	alerts, _, err := database.NewAlertRepo().List(database.AlertFilter{})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "critical", alerts[0].Risk)
+	assert.Contains(t, alerts[0].Message, "crash restart")
+	assert.Contains(t, <-notifier.sent, "crash restart")
+
+	// Events of other gateways are not ours to remediate.
+	other := crashed()
+	other.GatewayID = 7
+	engine.ObserveLifecycle(other)
+	engine.wg.Wait()
+	assert.Len(t, *finished, 4)
+}
+
+func TestEngine_SustainedDownRunsDiagnoseAndAttachesReport(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	actions := &fakeActions{}
+	engine, finished, _ := newTestEngine(t, actions)
+	var fire func()
+	engine.afterFunc = func(d time.Duration, f func()) *time.Timer {
+		assert.Equal(t, 5*time.Minute, d)
+		fire = f
+		return time.NewTimer(time.Hour)
+	}
+	savePolicy(t, &Policy{
+		Name:    "unreachable diagnose",
+		Trigger: Trigger{Kind: TriggerLifecycle, EventTypes: []string{"unreachable"}, ForSec: 300},
+		Steps:   []Step{{Action: ActionDiagnose}, {Action: ActionAlert}},
+	})
+	require.NoError(t, engine.Reload())
+
+	unreachable := &database.GatewayLifecycle{ID: 2, EventType: "unreachable"}
+	engine.ObserveLifecycle(unreachable)
+	require.NotNil(t, fire)
+	engine.ObserveLifecycle(&database.GatewayLifecycle{ID: 3, EventType: "recovered"})
+	fire()
+	engine.wg.Wait()
+	assert.Empty(t, actions.Calls(), "the gateway came back in time")
+
+	fire = nil
+	engine.ObserveLifecycle(unreachable)
+	require.NotNil(t, fire)
+	fire()
+	engine.wg.Wait()
+	assert.Equal(t, []string{ActionDiagnose}, actions.Calls())
+	require.Len(t, *finished, 1)
+	assert.Contains(t, (*finished)[0].Trigger, "still down after 5m")
+
+	alerts, _, err := database.NewAlertRepo().List(database.AlertFilter{})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	var detail struct {
+		Steps []StepResult `json:"steps"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(alerts[0].Detail), &detail))
+	require.Len(t, detail.Steps, 1)
+	assert.Contains(t, detail.Steps[0].Output, "port 18789 closed")
+}
+
+func TestEngine_LogPatternReducesConcurrency(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	actions := &fakeActions{concurrency: 8}
+	engine, finished, _ := newTestEngine(t, actions)
+	savePolicy(t, &Policy{
+		Name:    "oom",
+		Trigger: Trigger{Kind: TriggerLog, Pattern: `(?i)out of memory`, Threshold: 2, WindowSec: 600},
+		Steps:   []Step{{Action: ActionReduceConcurrency}, {Action: ActionRestart}},
+	})
+	require.NoError(t, engine.Reload())
+
+	engine.ObserveLogLines([]string{"agent started", "FATAL ERROR: JavaScript heap out of memory"})
+	engine.wg.Wait()
+	assert.Empty(t, actions.Calls())
+	engine.ObserveLogLines([]string{"Out of memory: killed process 42"})
+	engine.wg.Wait()
+	assert.Equal(t, []string{ActionReduceConcurrency, ActionRestart}, actions.Calls())
+	assert.Equal(t, 4, actions.concurrency)
+	require.Len(t, *finished, 1)
+	run := RunFromRecord((*finished)[0])
+	assert.Equal(t, "maxConcurrent 8 → 4", run.Steps[0].Detail)
+	assert.Contains(t, run.Trigger, "2x in 10m")
+}
+
+func TestEngine_AfterRestartRollsBackRecentConfigChange(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	healthPollInterval = time.Millisecond
+	defer func() { healthPollInterval = 2 * time.Second }()
+	actions := &fakeActions{configMod: time.Now().Add(-10 * time.Minute)}
+	engine, finished, _ := newTestEngine(t, actions)
+	savePolicy(t, &Policy{
+		Name:    "verify after restart",
+		Trigger: Trigger{Kind: TriggerLifecycle, EventTypes: []string{"started"}},
+		Steps: []Step{
+			{Action: ActionVerifyHealth, TimeoutSec: 1},
+			{Action: ActionRollback, When: WhenFailed, ChangedWithinSec: 3600},
+			{Action: ActionRestart, When: WhenFailed},
+		},
+	})
+	require.NoError(t, engine.Reload())
+
+	actions.healthy = true
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "started"})
+	engine.wg.Wait()
+	require.Len(t, *finished, 1)
+	run := RunFromRecord((*finished)[0])
+	assert.Equal(t, RunSucceeded, run.Status)
+	assert.Equal(t, []string{StepOK, StepSkipped, StepSkipped}, stepStatuses(run))
+
+	actions.mu.Lock()
+	actions.healthy = false
+	actions.mu.Unlock()
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "started"})
+	engine.wg.Wait()
+	require.Len(t, *finished, 2)
+	run = RunFromRecord((*finished)[1])
+	assert.Equal(t, RunFailed, run.Status)
+	assert.Equal(t, []string{StepFailed, StepOK, StepOK}, stepStatuses(run))
+	assert.Equal(t, []string{ActionRollback, ActionRestart}, actions.Calls())
+	assert.Equal(t, []time.Time{actions.configMod}, actions.rolledBack, "restores the snapshot taken before the change")
+
+	// An old config change is left alone.
+	actions.configMod = time.Now().Add(-2 * time.Hour)
+	engine.ObserveLifecycle(&database.GatewayLifecycle{EventType: "started"})
+	engine.wg.Wait()
+	run = RunFromRecord((*finished)[2])
+	assert.Equal(t, []string{StepFailed, StepSkipped, StepOK}, stepStatuses(run))
+	assert.Contains(t, run.Steps[1].Detail, "config unchanged for 2h")
+}
+
+func TestEngine_HealthCheckPolicyReplacesWatchdogRestart(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	actions := &fakeActions{restartErr: errors.New("systemctl failed")}
+	engine, finished, _ := newTestEngine(t, actions)
+	assert.False(t, engine.HandleHealthFailure(3), "no policy: the watchdog restarts as before")
+
+	p := savePolicy(t, &Policy{
+		Name:    "watchdog",
+		Trigger: Trigger{Kind: TriggerHealthCheck},
+		Steps:   []Step{{Action: ActionRestart}, {Action: ActionAlert, When: WhenFailed}},
+	})
+	require.NoError(t, engine.Reload())
+	assert.True(t, engine.HandleHealthFailure(3))
+	engine.wg.Wait()
+	require.Len(t, *finished, 1)
+	assert.Equal(t, RunFailed, (*finished)[0].Status)
+	assert.Equal(t, "restart: systemctl failed", (*finished)[0].Error)
+
+	runID, err := engine.RunNow(p.ID, "admin")
+	require.NoError(t, err)
+	engine.wg.Wait()
+	run, err := database.NewRemediationRunRepo().GetByID(runID)
+	require.NoError(t, err)
+	assert.Equal(t, "manual run by admin", run.Trigger)
+}
+
+func stepStatuses(run *Run) []string {
+	out := make([]string, len(run.Steps))
+	for i, s := range run.Steps {
+		out[i] = s.Status
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package remediation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/openclaw"
+	"ClawDeckX/internal/snapshots"
+)
+
+const (
+	concurrencyConfigKey = "agents.defaults.maxConcurrent"
+	logTailLimit         = 500
+	logTailMaxBytes      = 250000
+)
+
+// GatewayActions carries out remediation steps against the primary gateway.
+// Config changes (reduce_concurrency, rollback) need a local gateway.
+type GatewayActions struct {
+	svc       *openclaw.Service
+	client    *openclaw.GWClient
+	scheduler *snapshots.Scheduler
+	restart   func() error
+}
+
+// NewGatewayActions wires the actions to the gateway. restart is the same
+// function the heartbeat watchdog uses, so remote gateways are reconnected
+// rather than restarted.
+func NewGatewayActions(svc *openclaw.Service, client *openclaw.GWClient, restart func() error) *GatewayActions {
+	return &GatewayActions{svc: svc, client: client, restart: restart}
+}
+
+// SetScheduler sets the snapshot scheduler whose stored password unlocks
+// snapshots for rollback.
+func (a *GatewayActions) SetScheduler(s *snapshots.Scheduler) {
+	a.scheduler = s
+}
+
+func (a *GatewayActions) Restart() error {
+	return a.restart()
+}
+
+// Healthy reports whether the gateway answers, over its WebSocket or TCP.
+func (a *GatewayActions) Healthy() bool {
+	if a.client != nil && a.client.IsConnected() {
+		return true
+	}
+	addr := net.JoinHostPort(a.svc.GatewayHost, strconv.Itoa(a.svc.GatewayPort))
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func (a *GatewayActions) Diagnose() (string, string, error) {
+	result := openclaw.DiagnoseGateway(a.svc.GatewayHost, a.svc.GatewayPort)
+	report, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	return result.Summary, string(report), nil
+}
+
+func (a *GatewayActions) SetConcurrency(n int) (int, int, error) {
+	if a.svc.IsRemote() {
+		return 0, 0, fmt.Errorf("changing concurrency is not supported for remote gateways")
+	}
+	prev := 0
+	if out, err := openclaw.ConfigGet(concurrencyConfigKey); err == nil {
+		prev, _ = strconv.Atoi(strings.Trim(strings.TrimSpace(out), `"`))
+	}
+	next := n
+	if next == 0 {
+		if prev == 0 {
+			return 0, 0, fmt.Errorf("%s is not set; give the step an explicit concurrency", concurrencyConfigKey)
+		}
+		next = max(prev/2, 1)
+	}
+	if next == prev {
+		return prev, next, nil
+	}
+	if err := openclaw.ConfigSet(concurrencyConfigKey, strconv.Itoa(next)); err != nil {
+		return prev, prev, err
+	}
+	return prev, next, nil
+}
+
+func (a *GatewayActions) ConfigModTime() (time.Time, error) {
+	if a.svc.IsRemote() {
+		return time.Time{}, fmt.Errorf("config modification time is unavailable for remote gateways")
+	}
+	path := openclaw.ResolveConfigPath()
+	if path == "" {
+		return time.Time{}, fmt.Errorf("openclaw config not found")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+func (a *GatewayActions) RollbackConfig(before time.Time) (string, error) {
+	if a.scheduler == nil {
+		return "", fmt.Errorf("snapshots unavailable")
+	}
+	res, err := a.scheduler.RollbackConfig(before)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("restored openclaw.json from snapshot %s (%s); replaced config kept in %s",
+		res.SnapshotID, res.SnapshotAt.UTC().Format(time.RFC3339), res.PreRestoreSnapshotID), nil
+}
+
+// TailLogs reads the gateway log through logs.tail, which needs a connected gateway.
+func (a *GatewayActions) TailLogs(cursor int64) ([]string, int64, error) {
+	if a.client == nil || !a.client.IsConnected() {
+		return nil, cursor, fmt.Errorf("gateway not connected")
+	}
+	params := map[string]interface{}{"limit": logTailLimit, "maxBytes": logTailMaxBytes}
+	if cursor >= 0 {
+		params["cursor"] = cursor
+	} else {
+		params["limit"] = 1
+	}
+	data, err := a.client.RequestWithTimeout("logs.tail", params, 15*time.Second)
+	if err != nil {
+		return nil, cursor, err
+	}
+	var result struct {
+		Cursor int64    `json:"cursor"`
+		Lines  []string `json:"lines"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, cursor, err
+	}
+	if cursor < 0 {
+		// First poll: start after what is already in the log.
+		return nil, result.Cursor, nil
+	}
+	return result.Lines, result.Cursor, nil
+}
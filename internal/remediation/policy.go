@@ -0,0 +1,317 @@
+package remediation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+)
+
+// Trigger kinds a policy can be bound to.
+const (
+	TriggerLifecycle   = "lifecycle"    // gateway lifecycle events
+	TriggerLog         = "log"          // gateway log lines matching a pattern
+	TriggerHealthCheck = "health_check" // the heartbeat watchdog reached its failure threshold
+)
+
+// Step actions.
+const (
+	ActionRestart           = "restart"            // restart the gateway (reconnect when remote)
+	ActionReduceConcurrency = "reduce_concurrency" // lower agents.defaults.maxConcurrent
+	ActionVerifyHealth      = "verify_health"      // wait for the gateway to answer again
+	ActionDiagnose          = "diagnose"           // run gateway diagnose and keep the report
+	ActionRollback          = "rollback"           // restore openclaw.json from the last snapshot before it changed
+	ActionAlert             = "alert"              // raise an alert carrying the run's step results
+	ActionWait              = "wait"               // pause before the next step
+)
+
+// Step conditions.
+const (
+	WhenAlways = ""
+	WhenFailed = "failed" // only after an earlier step failed
+	WhenOK     = "ok"     // only while no step has failed
+)
+
+// Run statuses.
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunExhausted = "exhausted" // the policy hit its run limit and ran its on_exhausted steps
+)
+
+const (
+	defaultMaxRuns      = 3
+	defaultRunWindowSec = 3600
+	defaultStepTimeout  = 60
+	maxStepTimeout      = 600
+)
+
+var (
+	lifecycleEventTypes = []string{"started", "shutdown", "crashed", "unreachable", "recovered"}
+	downEventTypes      = []string{"shutdown", "crashed", "unreachable"}
+)
+
+// Trigger describes when a policy runs.
+type Trigger struct {
+	Kind       string   `json:"kind"`
+	EventTypes []string `json:"event_types,omitempty"` // lifecycle: started, shutdown, crashed, unreachable, recovered
+	ForSec     int      `json:"for_sec,omitempty"`     // lifecycle: only once the gateway stayed down this long
+	Pattern    string   `json:"pattern,omitempty"`     // log: regular expression matched against each line
+	Threshold  int      `json:"threshold"`             // matching events within WindowSec needed to run
+	WindowSec  int      `json:"window_sec"`
+}
+
+// Step is one action of a policy.
+type Step struct {
+	Action string `json:"action"`
+	When   string `json:"when,omitempty"` // "", failed, ok
+
+	// TimeoutSec bounds verify_health and is the pause of wait.
+	TimeoutSec int `json:"timeout_sec,omitempty"`
+	// Concurrency is the new maxConcurrent for reduce_concurrency; 0 halves the current value.
+	Concurrency int `json:"concurrency,omitempty"`
+	// ChangedWithinSec limits rollback to configs modified this recently; 0 always rolls back.
+	ChangedWithinSec int `json:"changed_within_sec,omitempty"`
+	// Risk and Message configure alert. Message supports {policy}, {trigger} and {status}.
+	Risk    string `json:"risk,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Policy is the decoded form of database.RemediationPolicy used by the engine and API.
+type Policy struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Enabled      bool      `json:"enabled"`
+	Trigger      Trigger   `json:"trigger"`
+	Steps        []Step    `json:"steps"`
+	MaxRuns      int       `json:"max_runs"`
+	RunWindowSec int       `json:"run_window_sec"`
+	OnExhausted  []Step    `json:"on_exhausted"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	pattern *regexp.Regexp
+}
+
+// PolicyFromRecord decodes a persisted policy.
+func PolicyFromRecord(rec *database.RemediationPolicy) (*Policy, error) {
+	p := &Policy{
+		ID:           rec.ID,
+		Name:         rec.Name,
+		Description:  rec.Description,
+		Enabled:      rec.Enabled,
+		MaxRuns:      rec.MaxRuns,
+		RunWindowSec: rec.RunWindowSec,
+		CreatedAt:    rec.CreatedAt,
+		UpdatedAt:    rec.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(rec.TriggerJSON), &p.Trigger); err != nil {
+		return nil, fmt.Errorf("policy %d: invalid trigger: %w", rec.ID, err)
+	}
+	if err := json.Unmarshal([]byte(rec.StepsJSON), &p.Steps); err != nil {
+		return nil, fmt.Errorf("policy %d: invalid steps: %w", rec.ID, err)
+	}
+	if rec.OnExhaustedJSON != "" {
+		if err := json.Unmarshal([]byte(rec.OnExhaustedJSON), &p.OnExhausted); err != nil {
+			return nil, fmt.Errorf("policy %d: invalid on_exhausted: %w", rec.ID, err)
+		}
+	}
+	if p.Trigger.Pattern != "" {
+		re, err := regexp.Compile(p.Trigger.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("policy %d: invalid pattern: %w", rec.ID, err)
+		}
+		p.pattern = re
+	}
+	return p, nil
+}
+
+// Record encodes the policy into its persisted form.
+func (p *Policy) Record() (*database.RemediationPolicy, error) {
+	trigger, err := json.Marshal(p.Trigger)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := json.Marshal(p.Steps)
+	if err != nil {
+		return nil, err
+	}
+	onExhausted, err := json.Marshal(p.OnExhausted)
+	if err != nil {
+		return nil, err
+	}
+	return &database.RemediationPolicy{
+		ID:              p.ID,
+		Name:            p.Name,
+		Description:     p.Description,
+		Enabled:         p.Enabled,
+		TriggerJSON:     string(trigger),
+		StepsJSON:       string(steps),
+		MaxRuns:         p.MaxRuns,
+		RunWindowSec:    p.RunWindowSec,
+		OnExhaustedJSON: string(onExhausted),
+		CreatedAt:       p.CreatedAt,
+		UpdatedAt:       p.UpdatedAt,
+	}, nil
+}
+
+// Normalize fills defaults and validates the policy.
+func (p *Policy) Normalize() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := p.Trigger.normalize(); err != nil {
+		return err
+	}
+	p.pattern = nil
+	if p.Trigger.Kind == TriggerLog {
+		p.pattern = regexp.MustCompile(p.Trigger.Pattern)
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	for i := range p.Steps {
+		if err := p.Steps[i].normalize(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	for i := range p.OnExhausted {
+		if err := p.OnExhausted[i].normalize(); err != nil {
+			return fmt.Errorf("on_exhausted step %d: %w", i+1, err)
+		}
+	}
+	// Every policy is rate limited so a remediation can never loop forever.
+	if p.MaxRuns <= 0 {
+		p.MaxRuns = defaultMaxRuns
+	}
+	if p.RunWindowSec < 0 {
+		return fmt.Errorf("run_window_sec must not be negative")
+	}
+	if p.RunWindowSec == 0 {
+		p.RunWindowSec = defaultRunWindowSec
+	}
+	return nil
+}
+
+func (t *Trigger) normalize() error {
+	if t.Threshold <= 0 {
+		t.Threshold = 1
+	}
+	if t.WindowSec < 0 || t.ForSec < 0 {
+		return fmt.Errorf("window_sec and for_sec must not be negative")
+	}
+	if t.Threshold > 1 && t.WindowSec == 0 {
+		return fmt.Errorf("window_sec is required when threshold is greater than 1")
+	}
+	switch t.Kind {
+	case TriggerLifecycle:
+		if len(t.EventTypes) == 0 {
+			return fmt.Errorf("event_types is required for lifecycle triggers")
+		}
+		for _, ev := range t.EventTypes {
+			if !containsFold(lifecycleEventTypes, ev) {
+				return fmt.Errorf("unsupported event type %q", ev)
+			}
+			if t.ForSec > 0 && !containsFold(downEventTypes, ev) {
+				return fmt.Errorf("for_sec only applies to shutdown, crashed and unreachable events")
+			}
+		}
+	case TriggerLog:
+		if strings.TrimSpace(t.Pattern) == "" {
+			return fmt.Errorf("pattern is required for log triggers")
+		}
+		if _, err := regexp.Compile(t.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+	case TriggerHealthCheck:
+	default:
+		return fmt.Errorf("trigger kind must be %q, %q or %q", TriggerLifecycle, TriggerLog, TriggerHealthCheck)
+	}
+	if t.Kind != TriggerLifecycle && (len(t.EventTypes) > 0 || t.ForSec > 0) {
+		return fmt.Errorf("event_types and for_sec only apply to lifecycle triggers")
+	}
+	if t.Kind != TriggerLog && t.Pattern != "" {
+		return fmt.Errorf("pattern only applies to log triggers")
+	}
+	return nil
+}
+
+func (s *Step) normalize() error {
+	switch s.Action {
+	case ActionRestart, ActionReduceConcurrency, ActionVerifyHealth, ActionDiagnose, ActionRollback, ActionAlert, ActionWait:
+	default:
+		return fmt.Errorf("unsupported action %q", s.Action)
+	}
+	switch s.When {
+	case WhenAlways, WhenFailed, WhenOK:
+	default:
+		return fmt.Errorf("when must be %q or %q", WhenFailed, WhenOK)
+	}
+	if s.TimeoutSec < 0 || s.Concurrency < 0 || s.ChangedWithinSec < 0 {
+		return fmt.Errorf("timeout_sec, concurrency and changed_within_sec must not be negative")
+	}
+	if s.TimeoutSec > maxStepTimeout {
+		return fmt.Errorf("timeout_sec must be at most %d", maxStepTimeout)
+	}
+	if s.Action == ActionAlert {
+		if s.Risk == "" {
+			s.Risk = constants.RiskHigh
+		}
+		validRisk := false
+		for _, lvl := range constants.AllRiskLevels {
+			if s.Risk == lvl {
+				validRisk = true
+				break
+			}
+		}
+		if !validRisk {
+			return fmt.Errorf("unsupported risk %q", s.Risk)
+		}
+	}
+	return nil
+}
+
+// timeout returns how long verify_health waits or wait pauses.
+func (s *Step) timeout() time.Duration {
+	if s.TimeoutSec == 0 {
+		return defaultStepTimeout * time.Second
+	}
+	return time.Duration(s.TimeoutSec) * time.Second
+}
+
+// Window returns the trigger's counting window.
+func (t *Trigger) Window() time.Duration {
+	return time.Duration(t.WindowSec) * time.Second
+}
+
+// RunWindow returns the window MaxRuns is counted in.
+func (p *Policy) RunWindow() time.Duration {
+	return time.Duration(p.RunWindowSec) * time.Second
+}
+
+// matchLifecycle reports whether a lifecycle event type starts this policy.
+func (p *Policy) matchLifecycle(eventType string) bool {
+	return p.Trigger.Kind == TriggerLifecycle && containsFold(p.Trigger.EventTypes, eventType)
+}
+
+// matchLog reports whether a gateway log line counts towards this policy.
+func (p *Policy) matchLog(line string) bool {
+	return p.Trigger.Kind == TriggerLog && p.pattern != nil && p.pattern.MatchString(line)
+}
+
+// containsFold reports whether v is in list (case-insensitive).
+func containsFold(list []string, v string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/database"
+)
+
+const (
+	archiveExt  = ".jsonl.gz"
+	archiveDate = "2006-01-02"
+)
+
+// Archive stores archived rows as <dir>/<table>/<YYYY-MM-DD>.jsonl.gz, one
+// JSON row per line, partitioned by the UTC day of the row's time. Every
+// append adds a gzip member, which readers see as one continuous stream.
+type Archive struct {
+	dir string
+}
+
+func NewArchive(dir string) *Archive {
+	return &Archive{dir: dir}
+}
+
+// Dir returns the archive root directory.
+func (a *Archive) Dir() string {
+	return a.dir
+}
+
+// ArchiveFile is one day of a table's archive.
+type ArchiveFile struct {
+	Table   string    `json:"table"`
+	Date    string    `json:"date"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Path returns the file of a table's day, validating both.
+func (a *Archive) Path(table, date string) (string, error) {
+	if database.FindRetentionTable(table) == nil {
+		return "", fmt.Errorf("unknown table %q", table)
+	}
+	if _, err := time.Parse(archiveDate, date); err != nil {
+		return "", fmt.Errorf("invalid date %q", date)
+	}
+	return filepath.Join(a.dir, table, date+archiveExt), nil
+}
+
+// Append writes rows to the files of their days and returns the dates
+// written. Files are synced before returning, so the rows can be deleted.
+func (a *Archive) Append(table string, rows []database.ExpiredRow) ([]string, error) {
+	byDate := map[string][]database.ExpiredRow{}
+	for _, row := range rows {
+		date := row.Time.UTC().Format(archiveDate)
+		byDate[date] = append(byDate[date], row)
+	}
+	dates := make([]string, 0, len(byDate))
+	for date := range byDate {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	if err := os.MkdirAll(filepath.Join(a.dir, table), 0o700); err != nil {
+		return nil, err
+	}
+	for _, date := range dates {
+		path, err := a.Path(table, date)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendGzip(path, byDate[date]); err != nil {
+			return nil, fmt.Errorf("archive %s/%s: %w", table, date, err)
+		}
+	}
+	return dates, nil
+}
+
+// appendGzip adds rows as a new gzip member. A failed write is cut off again,
+// so it cannot hide the members appended after it.
+func appendGzip(path string, rows []database.ExpiredRow) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Truncate(info.Size())
+		}
+	}()
+	zw := gzip.NewWriter(f)
+	for _, row := range rows {
+		if _, err := zw.Write(append(row.Data, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// List returns the archive files of table ("" = every table), newest first.
+func (a *Archive) List(table string) ([]ArchiveFile, error) {
+	var files []ArchiveFile
+	for _, t := range database.RetentionTables {
+		if table != "" && t.Table != table {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(a.dir, t.Table))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			date := strings.TrimSuffix(e.Name(), archiveExt)
+			if e.IsDir() || date == e.Name() {
+				continue
+			}
+			if _, err := time.Parse(archiveDate, date); err != nil {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, ArchiveFile{Table: t.Table, Date: date, Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Date != files[j].Date {
+			return files[i].Date > files[j].Date
+		}
+		return files[i].Table < files[j].Table
+	})
+	return files, nil
+}
+
+// Size returns the total size of the archive files.
+func (a *Archive) Size() (files int, bytes int64, err error) {
+	list, err := a.List("")
+	for _, f := range list {
+		files++
+		bytes += f.Size
+	}
+	return files, bytes, err
+}
+
+// Read calls fn with every row of a table's day, in the order archived.
+func (a *Archive) Read(table, date string, fn func(row json.RawMessage) error) error {
+	path, err := a.Path(table, date)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(json.RawMessage(append([]byte(nil), line...))); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,82 @@
+// Package retention prunes old activities, alerts, audit logs and connection
+// logs into compressed, date-partitioned JSONL archives and compacts the
+// database.
+package retention
+
+import (
+	"fmt"
+	"strconv"
+
+	"ClawDeckX/internal/database"
+)
+
+// Policy limits how much of a table is kept. Rows past either limit are
+// archived, then deleted. Both limits 0 keeps the table forever.
+type Policy struct {
+	Table      string `json:"table"`
+	MaxAgeDays int    `json:"max_age_days"`
+	MaxRows    int    `json:"max_rows"`
+}
+
+// Audit logs are kept until a limit is configured: pruning them needs the
+// server secret to sign the archive checkpoint.
+var defaultPolicies = map[string]Policy{
+	"activities":      {MaxAgeDays: 90, MaxRows: 500000},
+	"alerts":          {MaxAgeDays: 180, MaxRows: 100000},
+	"audit_logs":      {},
+	"connection_logs": {MaxAgeDays: 30, MaxRows: 200000},
+}
+
+// SettingKey is the setting holding a limit of a table, e.g.
+// retention_activities_max_age_days.
+func SettingKey(table, limit string) string {
+	return "retention_" + table + "_" + limit
+}
+
+// LoadPolicies returns the policy of every retention table, read from
+// settings over the defaults.
+func LoadPolicies(settings *database.SettingRepo) ([]Policy, error) {
+	all, err := settings.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]Policy, 0, len(database.RetentionTables))
+	for _, t := range database.RetentionTables {
+		p := defaultPolicies[t.Table]
+		p.Table = t.Table
+		for limit, dst := range map[string]*int{"max_age_days": &p.MaxAgeDays, "max_rows": &p.MaxRows} {
+			if v, ok := all[SettingKey(t.Table, limit)]; ok && v != "" {
+				if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+					*dst = n
+				}
+			}
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// Validate checks the policy's table and limits.
+func (p *Policy) Validate() error {
+	if database.FindRetentionTable(p.Table) == nil {
+		return fmt.Errorf("unknown table %q", p.Table)
+	}
+	if p.MaxAgeDays < 0 || p.MaxRows < 0 {
+		return fmt.Errorf("%s: limits must not be negative", p.Table)
+	}
+	return nil
+}
+
+// SavePolicies validates policies and stores them in settings.
+func SavePolicies(settings *database.SettingRepo, policies []Policy) error {
+	items := make(map[string]string, 2*len(policies))
+	for i := range policies {
+		p := &policies[i]
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		items[SettingKey(p.Table, "max_age_days")] = strconv.Itoa(p.MaxAgeDays)
+		items[SettingKey(p.Table, "max_rows")] = strconv.Itoa(p.MaxRows)
+	}
+	return settings.SetBatch(items)
+}
@@ -0,0 +1,341 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+)
+
+// DirName is the archive directory under the data directory.
+const DirName = "archive"
+
+const (
+	pruneBatch  = 500
+	importBatch = 200
+)
+
+const (
+	JobPrune   = "prune"
+	JobCompact = "compact"
+)
+
+// ErrReadOnly is returned when importing an audit log archive.
+var ErrReadOnly = errors.New("audit log archives can be browsed and downloaded but not re-imported")
+
+// TableResult reports what a prune did to one table.
+type TableResult struct {
+	Table    string   `json:"table"`
+	Archived int      `json:"archived"`
+	Dates    []string `json:"dates,omitempty"` // archive files written to
+	Error    string   `json:"error,omitempty"`
+}
+
+// Status reports the last or running job.
+type Status struct {
+	Running     bool          `json:"running"`
+	Job         string        `json:"job,omitempty"`
+	Full        bool          `json:"full,omitempty"` // full compaction
+	Tables      []TableResult `json:"tables,omitempty"`
+	BytesBefore int64         `json:"bytes_before,omitempty"`
+	BytesAfter  int64         `json:"bytes_after,omitempty"`
+	StartedAt   *time.Time    `json:"started_at,omitempty"`
+	FinishedAt  *time.Time    `json:"finished_at,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Manager runs the retention policies and database compaction, one job at
+// a time.
+type Manager struct {
+	archive  *Archive
+	repo     *database.RetentionRepo
+	audit    *database.AuditLogRepo
+	settings *database.SettingRepo
+
+	mu       sync.Mutex
+	status   Status
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewManager returns a manager archiving into dir.
+func NewManager(dir string) *Manager {
+	return &Manager{
+		archive:  NewArchive(dir),
+		repo:     database.NewRetentionRepo(),
+		audit:    database.NewAuditLogRepo(),
+		settings: database.NewSettingRepo(),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Archive returns the archive store.
+func (m *Manager) Archive() *Archive {
+	return m.archive
+}
+
+// Policies returns the configured policies.
+func (m *Manager) Policies() ([]Policy, error) {
+	return LoadPolicies(m.settings)
+}
+
+// SavePolicies stores policies in settings.
+func (m *Manager) SavePolicies(policies []Policy) error {
+	return SavePolicies(m.settings, policies)
+}
+
+// Status returns the last or running job.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Start prunes every interval, following a prune that archived rows with a
+// light compaction, until Stop is called.
+func (m *Manager) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			st, err := m.Prune()
+			if err != nil {
+				logger.DB.Warn().Err(err).Msg("retention prune failed")
+			}
+			archived := 0
+			for _, t := range st.Tables {
+				archived += t.Archived
+			}
+			if archived == 0 {
+				continue
+			}
+			if _, err := m.Compact(false); err != nil {
+				logger.DB.Warn().Err(err).Msg("database compaction failed")
+			}
+		}
+	}
+}
+
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
+func (m *Manager) begin(job string, full bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.status.Running {
+		return fmt.Errorf("a %s job is already running", m.status.Job)
+	}
+	now := time.Now().UTC()
+	m.status = Status{Running: true, Job: job, Full: full, StartedAt: &now}
+	return nil
+}
+
+func (m *Manager) finish(err error) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	m.status.Running = false
+	m.status.FinishedAt = &now
+	if err != nil {
+		m.status.Error = err.Error()
+	}
+	return m.status
+}
+
+// StartPrune prunes in the background. It fails when a job is running.
+func (m *Manager) StartPrune() error {
+	if err := m.begin(JobPrune, false); err != nil {
+		return err
+	}
+	go func() {
+		if err := m.prune(); err != nil {
+			logger.DB.Warn().Err(err).Msg("retention prune failed")
+		}
+	}()
+	return nil
+}
+
+// Prune archives and deletes the rows past their table's policy.
+func (m *Manager) Prune() (Status, error) {
+	if err := m.begin(JobPrune, false); err != nil {
+		return Status{}, err
+	}
+	err := m.prune()
+	return m.Status(), err
+}
+
+func (m *Manager) prune() error {
+	policies, err := m.Policies()
+	if err != nil {
+		m.finish(err)
+		return err
+	}
+	now := time.Now()
+	var failed error
+	for _, p := range policies {
+		res, err := m.pruneTable(p, now)
+		if err != nil {
+			res.Error = err.Error()
+			if failed == nil {
+				failed = fmt.Errorf("%s: %w", p.Table, err)
+			}
+		}
+		if res.Archived > 0 || err != nil {
+			logger.DB.Info().Str("table", p.Table).Int("archived", res.Archived).Err(err).Msg("retention prune")
+		}
+		m.mu.Lock()
+		m.status.Tables = append(m.status.Tables, res)
+		m.mu.Unlock()
+	}
+	m.finish(failed)
+	return failed
+}
+
+// pruneTable archives the expired rows in batches, deleting each batch once
+// written. Audit rows go together at the end, behind a signed checkpoint.
+func (m *Manager) pruneTable(p Policy, now time.Time) (TableResult, error) {
+	res := TableResult{Table: p.Table}
+	if p.MaxAgeDays == 0 && p.MaxRows == 0 {
+		return res, nil
+	}
+	t := database.FindRetentionTable(p.Table)
+	var cutoff time.Time
+	if p.MaxAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -p.MaxAgeDays)
+	}
+	if t.Chain {
+		if err := m.audit.CanArchive(); err != nil {
+			return res, err
+		}
+	}
+	boundary, err := m.repo.Boundary(t, cutoff, p.MaxRows)
+	if err != nil || (t.Chain && boundary == 0) {
+		return res, err
+	}
+
+	seen := map[string]bool{}
+	var last uint
+	for {
+		rows, err := m.repo.Expired(t, cutoff, boundary, last, pruneBatch)
+		if err != nil || len(rows) == 0 {
+			if err == nil && t.Chain && last > 0 {
+				archive := fmt.Sprintf("%s/%s..%s", t.Table, res.Dates[0], res.Dates[len(res.Dates)-1])
+				_, err = m.audit.ArchiveThrough(last, archive)
+			}
+			return res, err
+		}
+		dates, err := m.archive.Append(t.Table, rows)
+		if err != nil {
+			return res, err
+		}
+		last = rows[len(rows)-1].ID
+		if !t.Chain {
+			ids := make([]uint, len(rows))
+			for i, row := range rows {
+				ids[i] = row.ID
+			}
+			if err := m.repo.Delete(t, ids); err != nil {
+				return res, err
+			}
+		}
+		res.Archived += len(rows)
+		for _, d := range dates {
+			if !seen[d] {
+				seen[d] = true
+				res.Dates = append(res.Dates, d)
+			}
+		}
+	}
+}
+
+// StartCompact compacts in the background. It fails when a job is running.
+func (m *Manager) StartCompact(full bool) error {
+	if err := m.begin(JobCompact, full); err != nil {
+		return err
+	}
+	go func() {
+		if err := m.compact(full); err != nil {
+			logger.DB.Warn().Err(err).Msg("database compaction failed")
+		}
+	}()
+	return nil
+}
+
+// Compact reclaims free database space; see database.RetentionRepo.Compact.
+func (m *Manager) Compact(full bool) (Status, error) {
+	if err := m.begin(JobCompact, full); err != nil {
+		return Status{}, err
+	}
+	err := m.compact(full)
+	return m.Status(), err
+}
+
+func (m *Manager) compact(full bool) error {
+	if rep, err := m.repo.Size(); err == nil {
+		m.mu.Lock()
+		m.status.BytesBefore = rep.Bytes
+		m.mu.Unlock()
+	}
+	err := m.repo.Compact(context.Background(), full)
+	if rep, sizeErr := m.repo.Size(); sizeErr == nil {
+		m.mu.Lock()
+		m.status.BytesAfter = rep.Bytes
+		m.mu.Unlock()
+	}
+	st := m.finish(err)
+	if err == nil {
+		logger.DB.Info().Bool("full", full).Int64("bytes_before", st.BytesBefore).Int64("bytes_after", st.BytesAfter).
+			Msg("database compacted")
+	}
+	return err
+}
+
+// ImportResult reports an archive re-import.
+type ImportResult struct {
+	Table    string `json:"table"`
+	Date     string `json:"date"`
+	Read     int64  `json:"read"`
+	Restored int64  `json:"restored"` // rows still in the database are skipped
+}
+
+// Import puts the rows of an archive file back into their table. Rows still
+// past the table's policy are archived again by the next prune. Audit log
+// archives are read-only: restored rows would leave gaps in the hash chain.
+func (m *Manager) Import(table, date string) (*ImportResult, error) {
+	t := database.FindRetentionTable(table)
+	if t == nil {
+		return nil, fmt.Errorf("unknown table %q", table)
+	}
+	if t.Chain {
+		return nil, ErrReadOnly
+	}
+	res := &ImportResult{Table: table, Date: date}
+	var batch []json.RawMessage
+	flush := func() error {
+		n, err := m.repo.Restore(t, batch)
+		res.Restored += n
+		batch = batch[:0]
+		return err
+	}
+	err := m.archive.Read(table, date, func(row json.RawMessage) error {
+		res.Read++
+		batch = append(batch, row)
+		if len(batch) < importBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	return res, err
+}
@@ -0,0 +1,204 @@
+package retention
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func count(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	require.NoError(t, database.DB.Model(model).Count(&n).Error)
+	return n
+}
+
+func TestPruneArchivesAndImports(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	m := NewManager(t.TempDir())
+	require.NoError(t, m.SavePolicies([]Policy{
+		{Table: "activities", MaxAgeDays: 30},
+		{Table: "alerts", MaxAgeDays: 30},
+		{Table: "connection_logs", MaxRows: 2},
+	}))
+
+	now := time.Now()
+	old := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	activities := database.NewActivityRepo()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, activities.Create(&database.Activity{
+			EventID: fmt.Sprintf("old%d", i), Timestamp: old.Add(time.Duration(i) * 12 * time.Hour), Summary: "archived heartbeat",
+		}))
+	}
+	require.NoError(t, activities.Create(&database.Activity{EventID: "new", Timestamp: now, Summary: "fresh heartbeat"}))
+	alerts := database.NewAlertRepo()
+	require.NoError(t, alerts.Create(&database.Alert{AlertID: "open", Status: "open", Message: "still open", CreatedAt: old}))
+	require.NoError(t, alerts.Create(&database.Alert{AlertID: "done", Status: "resolved", Message: "resolved long ago", CreatedAt: old}))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, database.DB.Create(&database.ConnectionLog{IPAddress: fmt.Sprintf("10.0.0.%d", i), CreatedAt: now}).Error)
+	}
+
+	st, err := m.Prune()
+	require.NoError(t, err)
+	assert.False(t, st.Running)
+	archived := map[string]int{}
+	for _, tr := range st.Tables {
+		archived[tr.Table] = tr.Archived
+	}
+	assert.Equal(t, map[string]int{"activities": 4, "alerts": 1, "audit_logs": 0, "connection_logs": 3}, archived)
+	assert.EqualValues(t, 1, count(t, &database.Activity{}))
+	assert.EqualValues(t, 1, count(t, &database.Alert{}), "open alerts are kept")
+	assert.EqualValues(t, 2, count(t, &database.ConnectionLog{}))
+
+	files, err := m.Archive().List("activities")
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "2024-05-02", files[0].Date)
+	assert.Equal(t, "2024-05-01", files[1].Date)
+
+	var got []database.Activity
+	require.NoError(t, m.Archive().Read("activities", "2024-05-01", func(row json.RawMessage) error {
+		var a database.Activity
+		require.NoError(t, json.Unmarshal(row, &a))
+		got = append(got, a)
+		return nil
+	}))
+	require.Len(t, got, 2)
+	assert.Equal(t, "old0", got[0].EventID)
+
+	// Nothing is due any more; a second prune writes nothing.
+	st, err = m.Prune()
+	require.NoError(t, err)
+	for _, tr := range st.Tables {
+		assert.Zero(t, tr.Archived, tr.Table)
+	}
+
+	res, err := m.Import("activities", "2024-05-01")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, res.Read)
+	assert.EqualValues(t, 2, res.Restored)
+	assert.EqualValues(t, 3, count(t, &database.Activity{}))
+	res, err = m.Import("activities", "2024-05-01")
+	require.NoError(t, err)
+	assert.Zero(t, res.Restored, "rows already present are skipped")
+
+	_, err = m.Import("activities", "2024-06-01")
+	assert.Error(t, err)
+	_, err = m.Archive().Path("users", "2024-05-01")
+	assert.Error(t, err)
+}
+
+func TestPruneKeepsLiveAlerts(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	m := NewManager(t.TempDir())
+	require.NoError(t, m.SavePolicies([]Policy{{Table: "alerts", MaxAgeDays: 30}}))
+
+	old := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	alerts := database.NewAlertRepo()
+	for _, status := range []string{
+		constants.AlertStatusOpen, constants.AlertStatusAcknowledged,
+		constants.AlertStatusSilenced, constants.AlertStatusResolved,
+	} {
+		require.NoError(t, alerts.Create(&database.Alert{AlertID: status, Status: status, Message: status, CreatedAt: old}))
+	}
+
+	_, err := m.Prune()
+	require.NoError(t, err)
+	var left []string
+	require.NoError(t, database.DB.Model(&database.Alert{}).Order("id").Pluck("status", &left).Error)
+	assert.Equal(t, []string{
+		constants.AlertStatusOpen, constants.AlertStatusAcknowledged, constants.AlertStatusSilenced,
+	}, left, "only resolved alerts are archived")
+}
+
+func TestPruneAuditChain(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+	repo := database.NewAuditLogRepo()
+	old := time.Now().AddDate(0, 0, -400).Truncate(24 * time.Hour).Add(10 * time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repo.Create(&database.AuditLog{Action: "login", Result: "success", CreatedAt: old.Add(time.Duration(i) * time.Minute)}))
+	}
+	_, err := repo.Checkpoint()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, repo.Create(&database.AuditLog{Action: "logout", Result: "success"}))
+	}
+
+	m := NewManager(t.TempDir())
+	require.NoError(t, m.SavePolicies([]Policy{{Table: "audit_logs", MaxAgeDays: 365}}))
+	_, err = m.Prune()
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count(t, &database.AuditLog{}))
+
+	res, err := repo.Verify()
+	require.NoError(t, err)
+	assert.True(t, res.OK, res.Reason)
+	assert.EqualValues(t, 3, res.ArchivedThrough)
+	assert.EqualValues(t, 2, res.Checked)
+
+	// Checkpoints keep counting the archived rows.
+	cp, err := repo.Checkpoint()
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, cp.Count)
+
+	var buf bytes.Buffer
+	require.NoError(t, repo.ExportChain(&buf))
+	res, err = database.VerifyChainExport(&buf, true)
+	require.NoError(t, err)
+	assert.True(t, res.OK, res.Reason)
+	assert.Equal(t, 1, res.Checkpoints)
+
+	files, err := m.Archive().List("audit_logs")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	_, err = m.Import("audit_logs", files[0].Date)
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestSizeAndCompact(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	for i := 0; i < 50; i++ {
+		require.NoError(t, database.NewActivityRepo().Create(&database.Activity{EventID: fmt.Sprintf("e%d", i), Summary: "row"}))
+	}
+
+	rep, err := database.NewRetentionRepo().Size()
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite", rep.Driver)
+	assert.Positive(t, rep.Bytes)
+	var rows int64 = -1
+	for _, ts := range rep.Tables {
+		if ts.Table == "activities" {
+			rows = ts.Rows
+		}
+		assert.NotContains(t, ts.Table, "_fts", "search index tables are not listed")
+	}
+	assert.EqualValues(t, 50, rows)
+
+	m := NewManager(t.TempDir())
+	st, err := m.Compact(false)
+	require.NoError(t, err)
+	assert.Equal(t, JobCompact, st.Job)
+	st, err = m.Compact(true)
+	require.NoError(t, err)
+	assert.True(t, st.Full)
+	assert.Positive(t, st.BytesAfter)
+
+	rep, err = database.NewRetentionRepo().Size()
+	require.NoError(t, err)
+	assert.Equal(t, "incremental", rep.AutoVac)
+}
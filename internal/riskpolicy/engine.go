@@ -0,0 +1,396 @@
+package riskpolicy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+)
+
+// rescoreBatch is how many activities a rescore loads at a time.
+const rescoreBatch = 500
+
+// Reason is one contribution to a score.
+type Reason struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Score       int    `json:"score"`
+}
+
+// Assessment is the outcome of scoring an event.
+type Assessment struct {
+	Category string   `json:"category"`
+	Risk     string   `json:"risk"`
+	Score    int      `json:"score"`
+	Reasons  []Reason `json:"reasons"`
+	Allowed  bool     `json:"allowed,omitempty"` // exempted by an allow entry
+	Policy   string   `json:"policy"`            // hash of the policy applied
+}
+
+// Apply stores the assessment on an activity.
+func (a *Assessment) Apply(act *database.Activity) {
+	act.Category = a.Category
+	act.Risk = a.Risk
+	act.RiskScore = a.Score
+	act.RiskPolicy = a.Policy
+	act.RiskReasons = ""
+	if len(a.Reasons) > 0 {
+		data, _ := json.Marshal(a.Reasons)
+		act.RiskReasons = string(data)
+	}
+}
+
+// RescoreStatus reports the progress of re-scoring stored activities.
+type RescoreStatus struct {
+	Running    bool       `json:"running"`
+	Policy     string     `json:"policy,omitempty"`
+	Scanned    int        `json:"scanned"`
+	Changed    int        `json:"changed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Engine scores events against the current policy. Saving or reloading a
+// changed policy re-scores stored activities in the background.
+type Engine struct {
+	path string
+
+	mu     sync.RWMutex
+	policy *compiled
+
+	rescoreMu sync.Mutex
+	status    RescoreStatus
+	again     bool // the policy changed while a rescore was running
+}
+
+// NewEngine returns an engine using the default policy. path is the policy
+// file read by Load and written by Save; "" keeps the policy in memory.
+func NewEngine(path string) *Engine {
+	p := DefaultPolicy()
+	c, err := compile(p)
+	if err != nil {
+		panic("riskpolicy: invalid default policy: " + err.Error())
+	}
+	return &Engine{path: path, policy: c}
+}
+
+// Path returns the policy file.
+func (e *Engine) Path() string {
+	return e.path
+}
+
+// Load reads the policy file. A missing file keeps the current policy.
+func (e *Engine) Load() error {
+	if e.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%s: %w", e.path, err)
+	}
+	if err := p.Normalize(); err != nil {
+		return fmt.Errorf("%s: %w", e.path, err)
+	}
+	return e.install(&p)
+}
+
+// Save validates p, writes it to the policy file and applies it.
+func (e *Engine) Save(p *Policy) error {
+	if err := p.Normalize(); err != nil {
+		return err
+	}
+	if e.path != "" {
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(e.path), 0o700); err != nil {
+			return err
+		}
+		tmp := e.path + ".tmp"
+		if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, e.path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return e.install(p)
+}
+
+func (e *Engine) install(p *Policy) error {
+	c, err := compile(p)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	changed := e.policy.hash != c.hash
+	e.policy = c
+	e.mu.Unlock()
+	if changed {
+		logger.Monitor.Info().Str("policy", c.hash).Msg("risk policy changed")
+		e.StartRescore()
+	}
+	return nil
+}
+
+// Policy returns the current policy and its hash.
+func (e *Engine) Policy() (*Policy, string) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy.policy, e.policy.hash
+}
+
+// Assess scores ev against the current policy.
+func (e *Engine) Assess(ev Event) Assessment {
+	e.mu.RLock()
+	c := e.policy
+	e.mu.RUnlock()
+	return c.assess(&ev)
+}
+
+// Test scores ev against p without applying p.
+func Test(p *Policy, ev Event) (Assessment, error) {
+	if err := p.Normalize(); err != nil {
+		return Assessment{}, err
+	}
+	c, err := compile(p)
+	if err != nil {
+		return Assessment{}, err
+	}
+	return c.assess(&ev), nil
+}
+
+func (c *compiled) assess(ev *Event) Assessment {
+	a := Assessment{Category: constants.CategorySystem, Risk: constants.RiskLow, Policy: c.hash, Reasons: []Reason{}}
+	for _, cat := range c.categories {
+		if anyMatch(cat.tools, ev.Tool) {
+			a.Category = cat.name
+			break
+		}
+	}
+
+	domains := ev.domains()
+	var overrides []*compiledOverride
+	for i := range c.overrides {
+		o := &c.overrides[i]
+		if (len(o.agents) == 0 || anyMatch(o.agents, ev.Agent)) &&
+			(len(o.sessions) == 0 || anyMatch(o.sessions, ev.SessionID)) {
+			overrides = append(overrides, o)
+		}
+	}
+
+	allow := c.allow
+	for _, o := range overrides {
+		allow = append(allow[:len(allow):len(allow)], o.allow...)
+	}
+	for _, al := range allow {
+		if al.match.matches(ev, domains) {
+			a.Allowed = true
+			a.Reasons = append(a.Reasons, Reason{Rule: "allow", Description: al.name})
+			return a
+		}
+	}
+
+	disabled := func(id string) bool {
+		for _, o := range overrides {
+			if o.disable[id] {
+				return true
+			}
+		}
+		return false
+	}
+	rules := c.rules
+	for _, o := range overrides {
+		rules = append(rules[:len(rules):len(rules)], o.rules...)
+	}
+	for _, r := range rules {
+		if disabled(r.rule.ID) || !r.match.matches(ev, domains) {
+			continue
+		}
+		a.Score += r.rule.Score
+		a.Reasons = append(a.Reasons, Reason{Rule: r.rule.ID, Description: r.rule.Description, Score: r.rule.Score})
+	}
+	for _, o := range overrides {
+		if o.override.Adjust != 0 {
+			a.Score += o.override.Adjust
+			a.Reasons = append(a.Reasons, Reason{Rule: "override", Description: o.override.Name, Score: o.override.Adjust})
+		}
+	}
+
+	a.Score = max(0, min(a.Score, maxScore))
+	t := c.policy.Thresholds
+	switch {
+	case a.Score >= t.Critical:
+		a.Risk = constants.RiskCritical
+	case a.Score >= t.High:
+		a.Risk = constants.RiskHigh
+	case a.Score >= t.Medium:
+		a.Risk = constants.RiskMedium
+	}
+	return a
+}
+
+func (m *matcher) matches(ev *Event, domains []string) bool {
+	if len(m.tools) > 0 && !anyMatch(m.tools, ev.Tool) {
+		return false
+	}
+	if len(m.commands) > 0 && (ev.Command == "" || !anyMatch(m.commands, ev.Command)) {
+		return false
+	}
+	if len(m.paths) > 0 && !anyMatch(m.paths, ev.Paths...) {
+		return false
+	}
+	if len(m.urls) > 0 && !anyMatch(m.urls, ev.URLs...) {
+		return false
+	}
+	if len(m.domains) > 0 && !anyMatch(m.domains, domains...) {
+		return false
+	}
+	return true
+}
+
+// anyMatch reports whether any pattern matches any value.
+func anyMatch(patterns []*regexp.Regexp, values ...string) bool {
+	for _, v := range values {
+		for _, re := range patterns {
+			if re.MatchString(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RescoreStatus returns the progress of the last rescore.
+func (e *Engine) RescoreStatus() RescoreStatus {
+	e.rescoreMu.Lock()
+	defer e.rescoreMu.Unlock()
+	return e.status
+}
+
+// StartRescore re-scores, in the background, stored activities scored by
+// another policy. A rescore already running starts over once done.
+func (e *Engine) StartRescore() {
+	e.rescoreMu.Lock()
+	defer e.rescoreMu.Unlock()
+	if e.status.Running {
+		e.again = true
+		return
+	}
+	e.beginLocked()
+	go func() {
+		if err := e.run(); err != nil {
+			logger.Monitor.Warn().Err(err).Msg("risk rescore failed")
+		}
+	}()
+}
+
+// Rescore re-scores stored activities scored by another policy and returns
+// how many changed risk or category. Activities that were never scored by a
+// policy (session, message and log entries) are left alone.
+func (e *Engine) Rescore() (int, error) {
+	e.rescoreMu.Lock()
+	if e.status.Running {
+		e.rescoreMu.Unlock()
+		return 0, fmt.Errorf("a rescore is already running")
+	}
+	e.beginLocked()
+	e.rescoreMu.Unlock()
+
+	err := e.run()
+	return e.RescoreStatus().Changed, err
+}
+
+func (e *Engine) beginLocked() {
+	now := time.Now().UTC()
+	_, hash := e.Policy()
+	e.again = false
+	e.status = RescoreStatus{Running: true, Policy: hash, StartedAt: &now}
+}
+
+// run rescores until no policy change arrived meanwhile.
+func (e *Engine) run() error {
+	for {
+		err := e.rescore()
+		e.rescoreMu.Lock()
+		if err == nil && e.again {
+			e.beginLocked()
+			e.rescoreMu.Unlock()
+			continue
+		}
+		now := time.Now().UTC()
+		e.status.Running = false
+		e.status.FinishedAt = &now
+		if err != nil {
+			e.status.Error = err.Error()
+		} else {
+			logger.Monitor.Info().Int("scanned", e.status.Scanned).Int("changed", e.status.Changed).
+				Str("policy", e.status.Policy).Msg("risk rescore finished")
+		}
+		e.rescoreMu.Unlock()
+		return err
+	}
+}
+
+func (e *Engine) rescore() error {
+	e.mu.RLock()
+	c := e.policy
+	e.mu.RUnlock()
+
+	repo := database.NewActivityRepo()
+	var afterID uint
+	for {
+		batch, err := repo.ListScoredBefore(c.hash, afterID, rescoreBatch)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		changed := 0
+		for i := range batch {
+			act := &batch[i]
+			afterID = act.ID
+			prevRisk, prevCategory := act.Risk, act.Category
+			ev := EventFromDetail(act.Detail)
+			if ev.Tool == "" {
+				ev.Tool = act.Source
+			}
+			a := c.assess(&ev)
+			a.Apply(act)
+			if err := repo.UpdateRisk(act); err != nil {
+				return err
+			}
+			if act.Risk != prevRisk || act.Category != prevCategory {
+				changed++
+			}
+		}
+
+		e.rescoreMu.Lock()
+		e.status.Scanned += len(batch)
+		e.status.Changed += changed
+		stop := e.again
+		e.rescoreMu.Unlock()
+		if stop {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package riskpolicy
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Event is the part of a tool call the policy looks at.
+type Event struct {
+	Tool      string   `json:"tool"`
+	Command   string   `json:"command,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	URLs      []string `json:"urls,omitempty"`
+	Agent     string   `json:"agent,omitempty"`
+	SessionID string   `json:"session_id,omitempty"`
+}
+
+var (
+	commandKeys = []string{"command", "cmd", "script", "code"}
+	pathKeys    = []string{"path", "file_path", "filePath", "file", "filename", "dir", "directory", "paths", "files"}
+	urlKeys     = []string{"url", "urls", "uri", "href"}
+
+	urlInText = regexp.MustCompile(`(?i)\b(?:https?|ftp|wss?)://[^\s'"<>|;&()]+`)
+)
+
+// EventFromInput builds an event from a tool name and its input arguments.
+// URLs are also picked out of the command.
+func EventFromInput(tool string, input map[string]interface{}) Event {
+	ev := Event{Tool: tool}
+	for _, key := range commandKeys {
+		if v, ok := input[key].(string); ok && v != "" {
+			ev.Command = v
+			break
+		}
+	}
+	for _, key := range pathKeys {
+		ev.Paths = append(ev.Paths, stringsOf(input[key])...)
+	}
+	for _, key := range urlKeys {
+		ev.URLs = append(ev.URLs, stringsOf(input[key])...)
+	}
+	ev.URLs = append(ev.URLs, urlInText.FindAllString(ev.Command, -1)...)
+	return ev
+}
+
+// EventFromDetail rebuilds the event of a stored activity from its detail:
+// a session log line or a gateway tool event payload. An input that is a
+// plain string is taken as the command.
+func EventFromDetail(detail string) Event {
+	var d struct {
+		Tool         string                 `json:"tool"`
+		Name         string                 `json:"name"`
+		Input        json.RawMessage        `json:"input"`
+		SessionID    string                 `json:"session_id"`
+		GatewaySesID string                 `json:"sessionId"`
+		Key          string                 `json:"key"`
+		Extra        map[string]interface{} `json:"extra"`
+	}
+	if json.Unmarshal([]byte(detail), &d) != nil {
+		return Event{}
+	}
+	tool := d.Tool
+	if tool == "" {
+		tool = d.Name
+	}
+
+	var input map[string]interface{}
+	var text string
+	if json.Unmarshal(d.Input, &input) != nil && json.Unmarshal(d.Input, &text) == nil {
+		if strings.HasPrefix(strings.TrimSpace(text), "{") {
+			json.Unmarshal([]byte(text), &input)
+		}
+	}
+	ev := EventFromInput(tool, input)
+	if input == nil && text != "" {
+		ev.Command = text
+		ev.URLs = urlInText.FindAllString(text, -1)
+	}
+
+	ev.SessionID = d.SessionID
+	if ev.SessionID == "" {
+		ev.SessionID = d.GatewaySesID
+	}
+	if agent, ok := d.Extra["agent"].(string); ok {
+		ev.Agent = agent
+	} else if agent, ok := d.Extra["agentId"].(string); ok {
+		ev.Agent = agent
+	} else {
+		ev.Agent = AgentFromSessionKey(d.Key)
+	}
+	return ev
+}
+
+// AgentFromSessionKey returns the agent of an OpenClaw session key
+// ("agent:<id>:<rest>"), or "".
+func AgentFromSessionKey(key string) string {
+	parts := strings.SplitN(key, ":", 3)
+	if len(parts) < 2 || parts[0] != "agent" {
+		return ""
+	}
+	return parts[1]
+}
+
+// domains returns the hosts of the event's URLs.
+func (ev *Event) domains() []string {
+	var out []string
+	for _, raw := range ev.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		out = append(out, strings.ToLower(u.Hostname()))
+	}
+	return out
+}
+
+func stringsOf(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
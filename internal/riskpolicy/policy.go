@@ -0,0 +1,404 @@
+// Package riskpolicy classifies and scores tool activity against a
+// configurable policy. The policy lives in a JSON file in the data dir and is
+// shared by the gateway collector and the session log parser.
+package riskpolicy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"ClawDeckX/internal/constants"
+)
+
+// FileName is the policy file kept in the data dir.
+const FileName = "risk_policy.json"
+
+const maxScore = 100
+
+// Pattern matches a whole value, case-insensitively. "re:" starts a regular
+// expression (unanchored); anything else is a glob where * matches any run
+// of characters, / included, and ? matches one.
+type Pattern = string
+
+// Match selects events. Within a field any pattern may match; every
+// non-empty field must match.
+type Match struct {
+	Tools    []Pattern `json:"tools,omitempty"`
+	Commands []Pattern `json:"commands,omitempty"`
+	Paths    []Pattern `json:"paths,omitempty"`   // any file path of the event
+	URLs     []Pattern `json:"urls,omitempty"`    // any URL of the event
+	Domains  []Pattern `json:"domains,omitempty"` // any host of the event's URLs
+}
+
+func (m *Match) empty() bool {
+	return len(m.Tools)+len(m.Commands)+len(m.Paths)+len(m.URLs)+len(m.Domains) == 0
+}
+
+// Rule adds Score to an event it matches.
+type Rule struct {
+	ID          string `json:"id"`
+	Description string `json:"description,omitempty"`
+	Match       Match  `json:"match"`
+	Score       int    `json:"score"`
+}
+
+// Allow exempts matching events: they score 0 whatever rules match.
+type Allow struct {
+	Name  string `json:"name"`
+	Match Match  `json:"match"`
+}
+
+// Override changes the policy for some agents or sessions. An empty Agents
+// or Sessions list matches any.
+type Override struct {
+	Name     string    `json:"name"`
+	Agents   []Pattern `json:"agents,omitempty"`
+	Sessions []Pattern `json:"sessions,omitempty"`
+	Disable  []string  `json:"disable,omitempty"` // rule IDs not applied
+	Rules    []Rule    `json:"rules,omitempty"`   // applied in addition
+	Allow    []Allow   `json:"allow,omitempty"`
+	Adjust   int       `json:"adjust,omitempty"` // added to the score
+}
+
+// Category names the category of events using the matching tools. The
+// first matching entry wins; unmatched events are System.
+type Category struct {
+	Category string    `json:"category"`
+	Tools    []Pattern `json:"tools"`
+}
+
+// Thresholds are the lowest scores of each risk level above low.
+type Thresholds struct {
+	Medium   int `json:"medium"`
+	High     int `json:"high"`
+	Critical int `json:"critical"`
+}
+
+// Policy is the contents of the policy file.
+type Policy struct {
+	Thresholds Thresholds `json:"thresholds"`
+	Categories []Category `json:"categories"`
+	Rules      []Rule     `json:"rules"`
+	Allow      []Allow    `json:"allow,omitempty"`
+	Overrides  []Override `json:"overrides,omitempty"`
+}
+
+var shellTools = []Pattern{"*bash*", "*shell*", "*exec*", "*command*"}
+
+// DefaultPolicy returns the policy used until one is saved. It scores the
+// patterns ClawDeckX always flagged.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Thresholds: Thresholds{Medium: 30, High: 60, Critical: 90},
+		Categories: []Category{
+			{Category: constants.CategoryShell, Tools: shellTools},
+			{Category: constants.CategoryFile, Tools: []Pattern{"*file*", "*read*", "*write*", "*edit*"}},
+			{Category: constants.CategoryNetwork, Tools: []Pattern{"*http*", "*fetch*", "*curl*", "*request*", "*network*"}},
+			{Category: constants.CategoryBrowser, Tools: []Pattern{"*browser*", "*chrome*", "*puppeteer*", "*web*", "*screenshot*"}},
+			{Category: constants.CategoryMessage, Tools: []Pattern{"*message*", "*chat*", "*telegram*", "*slack*"}},
+			{Category: constants.CategoryMemory, Tools: []Pattern{"*memory*", "*remember*", "*store*", "*cache*"}},
+		},
+		Rules: []Rule{
+			{ID: "destructive-delete", Description: "recursive delete or disk wipe", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*rm -rf*", "*rm -r /*", "*mkfs*", "*dd if=*", "*> /dev/*"},
+			}},
+			{ID: "pipe-to-shell", Description: "downloaded script piped into a shell", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{`re:(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`},
+			}},
+			{ID: "world-writable", Description: "world-writable permissions", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*chmod 777*"},
+			}},
+			{ID: "remote-access", Description: "remote login or copy", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*ssh *", "*scp *", "*rsync *"},
+			}},
+			{ID: "system-power", Description: "shutdown or reboot", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*shutdown*", "*reboot*"},
+			}},
+			{ID: "account-change", Description: "user account change", Score: 70, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*passwd*", "*useradd*", "*userdel*"},
+			}},
+			{ID: "privilege", Description: "runs as root", Score: 40, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*sudo *"},
+			}},
+			{ID: "package-install", Description: "installs packages", Score: 40, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*pip install*", "*npm install*", "*apt install*", "*yum install*", "*brew install*"},
+			}},
+			{ID: "permissions", Description: "changes ownership, permissions or processes", Score: 40, Match: Match{
+				Tools:    shellTools,
+				Commands: []Pattern{"*chmod *", "*chown *", "*kill *"},
+			}},
+			{ID: "network-tool", Description: "outbound request", Score: 40, Match: Match{
+				Tools: []Pattern{"*http*", "*fetch*"},
+			}},
+			{ID: "sensitive-path", Description: "touches credentials or system files", Score: 50, Match: Match{
+				Paths: []Pattern{"/etc/*", "*/.ssh/*", "*/.aws/*", "*.pem", "*/.env"},
+			}},
+		},
+	}
+}
+
+// Normalize fills defaults and validates the policy.
+func (p *Policy) Normalize() error {
+	t := &p.Thresholds
+	if *t == (Thresholds{}) {
+		*t = DefaultPolicy().Thresholds
+	}
+	if t.Medium <= 0 || t.Medium > t.High || t.High > t.Critical || t.Critical > maxScore {
+		return fmt.Errorf("thresholds must satisfy 0 < medium <= high <= critical <= %d", maxScore)
+	}
+	for i := range p.Categories {
+		c := &p.Categories[i]
+		c.Category = strings.TrimSpace(c.Category)
+		if c.Category == "" || len(c.Tools) == 0 {
+			return fmt.Errorf("categories[%d]: category and tools are required", i)
+		}
+	}
+	ids := map[string]bool{}
+	if err := normalizeRules(p.Rules, "rules", ids); err != nil {
+		return err
+	}
+	if err := normalizeAllow(p.Allow, "allow"); err != nil {
+		return err
+	}
+	for i := range p.Overrides {
+		o := &p.Overrides[i]
+		where := fmt.Sprintf("overrides[%d]", i)
+		o.Name = strings.TrimSpace(o.Name)
+		if o.Name == "" {
+			return fmt.Errorf("%s: name is required", where)
+		}
+		if len(o.Agents) == 0 && len(o.Sessions) == 0 {
+			return fmt.Errorf("%s: agents or sessions is required", where)
+		}
+		if err := normalizeRules(o.Rules, where+".rules", ids); err != nil {
+			return err
+		}
+		if err := normalizeAllow(o.Allow, where+".allow"); err != nil {
+			return err
+		}
+	}
+	for _, o := range p.Overrides {
+		for _, id := range o.Disable {
+			if !ids[id] {
+				return fmt.Errorf("override %q disables unknown rule %q", o.Name, id)
+			}
+		}
+	}
+	_, err := compile(p)
+	return err
+}
+
+func normalizeRules(rules []Rule, where string, ids map[string]bool) error {
+	for i := range rules {
+		r := &rules[i]
+		r.ID = strings.TrimSpace(r.ID)
+		if r.ID == "" {
+			return fmt.Errorf("%s[%d]: id is required", where, i)
+		}
+		if ids[r.ID] {
+			return fmt.Errorf("%s[%d]: duplicate rule id %q", where, i, r.ID)
+		}
+		ids[r.ID] = true
+		if r.Match.empty() {
+			return fmt.Errorf("rule %q: match is empty", r.ID)
+		}
+		if r.Score < -maxScore || r.Score > maxScore {
+			return fmt.Errorf("rule %q: score must be between -%d and %d", r.ID, maxScore, maxScore)
+		}
+	}
+	return nil
+}
+
+func normalizeAllow(allow []Allow, where string) error {
+	for i := range allow {
+		a := &allow[i]
+		a.Name = strings.TrimSpace(a.Name)
+		if a.Name == "" {
+			return fmt.Errorf("%s[%d]: name is required", where, i)
+		}
+		if a.Match.empty() {
+			return fmt.Errorf("allow %q: match is empty", a.Name)
+		}
+	}
+	return nil
+}
+
+// Hash identifies the policy's content. Activities record the hash of the
+// policy that scored them.
+func (p *Policy) Hash() string {
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// compiled is a policy with its patterns compiled.
+type compiled struct {
+	policy     *Policy
+	hash       string
+	categories []compiledCategory
+	rules      []compiledRule
+	allow      []compiledAllow
+	overrides  []compiledOverride
+}
+
+type compiledCategory struct {
+	name  string
+	tools []*regexp.Regexp
+}
+
+type compiledRule struct {
+	rule  Rule
+	match *matcher
+}
+
+type compiledAllow struct {
+	name  string
+	match *matcher
+}
+
+type compiledOverride struct {
+	override Override
+	agents   []*regexp.Regexp
+	sessions []*regexp.Regexp
+	disable  map[string]bool
+	rules    []compiledRule
+	allow    []compiledAllow
+}
+
+type matcher struct {
+	tools, commands, paths, urls, domains []*regexp.Regexp
+}
+
+func compile(p *Policy) (*compiled, error) {
+	c := &compiled{policy: p, hash: p.Hash()}
+	for _, cat := range p.Categories {
+		tools, err := compilePatterns(cat.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("category %q: %w", cat.Category, err)
+		}
+		c.categories = append(c.categories, compiledCategory{name: cat.Category, tools: tools})
+	}
+	var err error
+	if c.rules, err = compileRules(p.Rules); err != nil {
+		return nil, err
+	}
+	if c.allow, err = compileAllow(p.Allow); err != nil {
+		return nil, err
+	}
+	for _, o := range p.Overrides {
+		co := compiledOverride{override: o, disable: map[string]bool{}}
+		if co.agents, err = compilePatterns(o.Agents); err != nil {
+			return nil, fmt.Errorf("override %q: %w", o.Name, err)
+		}
+		if co.sessions, err = compilePatterns(o.Sessions); err != nil {
+			return nil, fmt.Errorf("override %q: %w", o.Name, err)
+		}
+		for _, id := range o.Disable {
+			co.disable[id] = true
+		}
+		if co.rules, err = compileRules(o.Rules); err != nil {
+			return nil, err
+		}
+		if co.allow, err = compileAllow(o.Allow); err != nil {
+			return nil, err
+		}
+		c.overrides = append(c.overrides, co)
+	}
+	return c, nil
+}
+
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	out := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		m, err := compileMatch(&r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.ID, err)
+		}
+		out = append(out, compiledRule{rule: r, match: m})
+	}
+	return out, nil
+}
+
+func compileAllow(allow []Allow) ([]compiledAllow, error) {
+	out := make([]compiledAllow, 0, len(allow))
+	for _, a := range allow {
+		m, err := compileMatch(&a.Match)
+		if err != nil {
+			return nil, fmt.Errorf("allow %q: %w", a.Name, err)
+		}
+		out = append(out, compiledAllow{name: a.Name, match: m})
+	}
+	return out, nil
+}
+
+func compileMatch(m *Match) (*matcher, error) {
+	var out matcher
+	var err error
+	for _, f := range []struct {
+		dst  *[]*regexp.Regexp
+		src  []Pattern
+		name string
+	}{
+		{&out.tools, m.Tools, "tools"},
+		{&out.commands, m.Commands, "commands"},
+		{&out.paths, m.Paths, "paths"},
+		{&out.urls, m.URLs, "urls"},
+		{&out.domains, m.Domains, "domains"},
+	} {
+		if *f.dst, err = compilePatterns(f.src); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return &out, nil
+}
+
+func compilePatterns(patterns []Pattern) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func compilePattern(p Pattern) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(p, "re:"); ok {
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expr, err)
+		}
+		return re, nil
+	}
+	if strings.TrimSpace(p) == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range p {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()), nil
+}
@@ -0,0 +1,311 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"ClawDeckX/internal/database"
+)
+
+// Query is a parsed search string.
+//
+// Syntax:
+//
+//	word            documents containing word
+//	"two words"     the exact phrase
+//	pre*            words starting with pre
+//	a OR b          either term
+//	-word           documents not containing word
+//	field:value     field filter, e.g. risk:high, user:admin, session:"agent:main:*"
+//	-field:value    negated field filter
+//	kind:alert      restrict to a kind (activity, alert, audit, transcript)
+//	since:7d        time range; durations (30m, 24h, 7d, 2w), dates (2025-01-31) or RFC3339
+//	until:2025-02-01
+type Query struct {
+	Raw     string
+	Terms   []Term
+	Filters []Filter
+	Kinds   []string
+	Since   *time.Time
+	Until   *time.Time
+}
+
+// Term is one word or phrase of the text condition.
+type Term struct {
+	Text   string
+	Phrase bool
+	Prefix bool
+	Negate bool
+	Or     bool // joined to the previous term with OR
+}
+
+// Filter is a field:value condition.
+type Filter struct {
+	Field  string
+	Value  string
+	Negate bool
+}
+
+var kindAliases = map[string]string{
+	"activity": "activity", "activities": "activity",
+	"alert": "alert", "alerts": "alert",
+	"audit": "audit", "audit_log": "audit",
+	"transcript": "transcript", "transcripts": "transcript", "chat": "transcript",
+}
+
+var relativeTime = regexp.MustCompile(`^(\d+)([mhdw])$`)
+
+// filterFields reports the field names usable as filters: every field of any
+// search source.
+func filterFields() map[string]bool {
+	fields := map[string]bool{}
+	for _, s := range database.SearchSources {
+		for name := range s.Fields {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// Parse parses a search string. Relative times are resolved against now.
+func Parse(raw string, now time.Time) (*Query, error) {
+	q := &Query{Raw: raw}
+	fields := filterFields()
+	s := []rune(strings.TrimSpace(raw))
+	or := false
+
+	for i := 0; i < len(s); {
+		if unicode.IsSpace(s[i]) {
+			i++
+			continue
+		}
+		negate := false
+		if s[i] == '-' && i+1 < len(s) && !unicode.IsSpace(s[i+1]) {
+			negate = true
+			i++
+		}
+
+		// field:value
+		if name, value, next, ok := readField(s, i); ok {
+			field := strings.ToLower(name)
+			switch {
+			case field == "kind" || field == "in":
+				if negate {
+					return nil, fmt.Errorf("kind: cannot be negated")
+				}
+				kind, known := kindAliases[strings.ToLower(value)]
+				if !known {
+					return nil, fmt.Errorf("unknown kind %q", value)
+				}
+				q.Kinds = append(q.Kinds, kind)
+				i = next
+				continue
+			case field == "since" || field == "until":
+				if negate {
+					return nil, fmt.Errorf("%s: cannot be negated", field)
+				}
+				t, err := parseTime(value, now, field == "until")
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", field, err)
+				}
+				if field == "since" {
+					q.Since = &t
+				} else {
+					q.Until = &t
+				}
+				i = next
+				continue
+			case fields[field]:
+				if value == "" {
+					return nil, fmt.Errorf("%s: needs a value", field)
+				}
+				q.Filters = append(q.Filters, Filter{Field: field, Value: value, Negate: negate})
+				i = next
+				continue
+			}
+			// Unknown fields (e.g. URLs) are searched as text.
+		}
+
+		var t Term
+		if s[i] == '"' {
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				j++
+			}
+			t = Term{Text: string(s[i+1 : j]), Phrase: true}
+			i = j + 1
+		} else {
+			j := i
+			for j < len(s) && !unicode.IsSpace(s[j]) {
+				j++
+			}
+			word := string(s[i:j])
+			i = j
+			if word == "OR" && !negate {
+				or = len(q.Terms) > 0
+				continue
+			}
+			if strings.HasSuffix(word, "*") {
+				t.Prefix = true
+				word = strings.TrimRight(word, "*")
+			}
+			t.Text = word
+		}
+		if !hasWordChar(t.Text) {
+			or = false
+			continue
+		}
+		t.Negate = negate
+		t.Or = or && !negate
+		or = false
+		q.Terms = append(q.Terms, t)
+	}
+
+	if q.Since != nil && q.Until != nil && !q.Until.After(*q.Since) {
+		return nil, fmt.Errorf("until must be after since")
+	}
+	if len(q.Terms) > 0 && len(q.groups()) == 0 {
+		return nil, fmt.Errorf("exclusions need at least one search term")
+	}
+	return q, nil
+}
+
+// readField reads a field:value token at s[i:]. The value may be quoted.
+func readField(s []rune, i int) (name, value string, next int, ok bool) {
+	j := i
+	for j < len(s) && (unicode.IsLetter(s[j]) || s[j] == '_') {
+		j++
+	}
+	if j == i || j >= len(s) || s[j] != ':' {
+		return "", "", 0, false
+	}
+	name = string(s[i:j])
+	j++
+	if j < len(s) && s[j] == '"' {
+		k := j + 1
+		for k < len(s) && s[k] != '"' {
+			k++
+		}
+		return name, string(s[j+1 : k]), k + 1, true
+	}
+	k := j
+	for k < len(s) && !unicode.IsSpace(s[k]) {
+		k++
+	}
+	return name, string(s[j:k]), k, true
+}
+
+func parseTime(v string, now time.Time, end bool) (time.Time, error) {
+	if m := relativeTime.FindStringSubmatch(v); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := map[string]time.Duration{"m": time.Minute, "h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, now.Location()); err == nil {
+		if end {
+			// until:<date> includes the whole day.
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+func hasWordChar(s string) bool {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// groups splits the positive terms into AND-ed groups of OR-ed alternatives.
+func (q *Query) groups() [][]Term {
+	var groups [][]Term
+	for _, t := range q.Terms {
+		if t.Negate {
+			continue
+		}
+		if t.Or && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], t)
+		} else {
+			groups = append(groups, []Term{t})
+		}
+	}
+	return groups
+}
+
+// HasText reports whether the query has a text condition.
+func (q *Query) HasText() bool {
+	return len(q.Terms) > 0
+}
+
+// FTS5 renders the text condition as an SQLite FTS5 MATCH expression.
+func (q *Query) FTS5() string {
+	lit := func(t Term) string {
+		s := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+		if t.Prefix {
+			s += "*"
+		}
+		return s
+	}
+	var parts []string
+	for _, g := range q.groups() {
+		alts := make([]string, len(g))
+		for i, t := range g {
+			alts[i] = lit(t)
+		}
+		if len(alts) == 1 {
+			parts = append(parts, alts[0])
+		} else {
+			parts = append(parts, "("+strings.Join(alts, " OR ")+")")
+		}
+	}
+	expr := strings.Join(parts, " AND ")
+	for _, t := range q.Terms {
+		if t.Negate {
+			expr += " NOT " + lit(t)
+		}
+	}
+	return expr
+}
+
+// TSQuery renders the text condition as a Postgres tsquery expression and
+// its arguments.
+func (q *Query) TSQuery() (string, []interface{}) {
+	var args []interface{}
+	render := func(t Term) string {
+		if !t.Prefix {
+			args = append(args, t.Text)
+			return "phraseto_tsquery('simple', ?)"
+		}
+		words := strings.FieldsFunc(t.Text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		args = append(args, strings.ToLower(strings.Join(words, " <-> "))+":*")
+		return "to_tsquery('simple', ?)"
+	}
+	var parts []string
+	for _, g := range q.groups() {
+		alts := make([]string, len(g))
+		for i, t := range g {
+			alts[i] = render(t)
+		}
+		parts = append(parts, "("+strings.Join(alts, " || ")+")")
+	}
+	expr := strings.Join(parts, " && ")
+	for _, t := range q.Terms {
+		if t.Negate {
+			expr += " && !!" + render(t)
+		}
+	}
+	return "(" + expr + ")", args
+}
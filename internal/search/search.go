@@ -0,0 +1,197 @@
+// Package search implements full-text search over activities, alerts, audit
+// logs and stored session transcripts.
+package search
+
+import (
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClawDeckX/internal/database"
+)
+
+// MaxWindow bounds how deep a result list can be paged.
+const MaxWindow = 1000
+
+const (
+	SortRelevance = "relevance"
+	SortTime      = "time"
+)
+
+// Request is one search.
+type Request struct {
+	Query    string
+	Kinds    []string // empty = all kinds
+	Since    *time.Time
+	Until    *time.Time
+	Sort     string
+	Page     int
+	PageSize int
+}
+
+// Hit is one search result. Snippet is HTML with matches wrapped in <mark>.
+type Hit struct {
+	Kind      string            `json:"kind"`
+	ID        uint              `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Title     string            `json:"title"`
+	Snippet   string            `json:"snippet"`
+	Score     float64           `json:"score"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// Result is a page of hits across all searched kinds.
+type Result struct {
+	Hits   []Hit            `json:"hits"`
+	Total  int64            `json:"total"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+// InvalidError reports a malformed query or request.
+type InvalidError struct {
+	Msg string
+}
+
+func (e *InvalidError) Error() string { return e.Msg }
+
+func invalid(format string, args ...interface{}) error {
+	return &InvalidError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// Search runs req against every selected kind and merges the results.
+func Search(req Request) (*Result, error) {
+	now := time.Now()
+	q, err := Parse(req.Query, now)
+	if err != nil {
+		return nil, invalid("%s", err.Error())
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = 20
+	}
+	if req.Sort == "" {
+		req.Sort = SortRelevance
+	}
+	if req.Sort != SortRelevance && req.Sort != SortTime {
+		return nil, invalid("sort must be %q or %q", SortRelevance, SortTime)
+	}
+	window := req.Page * req.PageSize
+	if window > MaxWindow {
+		return nil, invalid("only the first %d results can be paged; narrow the query", MaxWindow)
+	}
+	since, until := q.Since, q.Until
+	if since == nil {
+		since = req.Since
+	}
+	if until == nil {
+		until = req.Until
+	}
+
+	repo := database.NewSearchRepo()
+	sq := database.SearchQuery{Since: since, Until: until, ByTime: req.Sort == SortTime, Limit: window}
+	if q.HasText() {
+		if repo.Dialect() == "postgres" {
+			sq.TSQuery, sq.TSArgs = q.TSQuery()
+		} else {
+			sq.Match = q.FTS5()
+		}
+	}
+
+	res := &Result{Hits: []Hit{}, Counts: map[string]int64{}}
+	for i := range database.SearchSources {
+		src := &database.SearchSources[i]
+		if !wanted(src.Kind, q.Kinds) || !wanted(src.Kind, req.Kinds) {
+			continue
+		}
+		filters, ok, err := sourceFilters(src, q.Filters)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		kq := sq
+		kq.Filters = filters
+		rows, total, err := repo.Search(src, &kq)
+		if err != nil {
+			return nil, fmt.Errorf("search %s: %w", src.Kind, err)
+		}
+		res.Counts[src.Kind] = total
+		res.Total += total
+		for _, row := range rows {
+			res.Hits = append(res.Hits, Hit{
+				Kind:      src.Kind,
+				ID:        row.ID,
+				Timestamp: row.Timestamp,
+				Title:     row.Title,
+				Snippet:   highlight(row.Snippet),
+				Score:     row.Score,
+				Fields:    row.Fields,
+			})
+		}
+	}
+
+	sort.SliceStable(res.Hits, func(i, j int) bool {
+		a, b := res.Hits[i], res.Hits[j]
+		if req.Sort == SortRelevance && a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Timestamp.After(b.Timestamp)
+	})
+	start := (req.Page - 1) * req.PageSize
+	if start > len(res.Hits) {
+		start = len(res.Hits)
+	}
+	end := start + req.PageSize
+	if end > len(res.Hits) {
+		end = len(res.Hits)
+	}
+	res.Hits = res.Hits[start:end]
+	return res, nil
+}
+
+func wanted(kind string, kinds []string) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceFilters maps query filters to src's columns. ok is false when src
+// lacks one of the filtered fields and so cannot match.
+func sourceFilters(src *database.SearchSource, filters []Filter) (out []database.SearchFilter, ok bool, err error) {
+	for _, f := range filters {
+		col, has := src.Fields[f.Field]
+		if !has {
+			return nil, false, nil
+		}
+		var value interface{} = f.Value
+		if f.Field == "gateway" {
+			id, err := strconv.ParseUint(f.Value, 10, 64)
+			if err != nil {
+				return nil, false, invalid("gateway: %q is not a gateway id", f.Value)
+			}
+			value = uint(id)
+		}
+		out = append(out, database.SearchFilter{Column: col, Value: value, Negate: f.Negate})
+	}
+	return out, true, nil
+}
+
+// highlight escapes a snippet for HTML and turns the match markers into
+// <mark> tags.
+func highlight(snippet string) string {
+	s := html.EscapeString(snippet)
+	s = strings.ReplaceAll(s, database.SearchMarkStart, "<mark>")
+	return strings.ReplaceAll(s, database.SearchMarkEnd, "</mark>")
+}
@@ -0,0 +1,220 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	q, err := Parse(`rm -rf "etc passwd" deploy* risk:high -status:resolved kind:alerts session:"agent:main:*" since:7d until:2025-03-09 https://x.io`, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Term{
+		{Text: "rm"},
+		{Text: "rf", Negate: true},
+		{Text: "etc passwd", Phrase: true},
+		{Text: "deploy", Prefix: true},
+		{Text: "https://x.io"},
+	}, q.Terms)
+	assert.Equal(t, []Filter{
+		{Field: "risk", Value: "high"},
+		{Field: "status", Value: "resolved", Negate: true},
+		{Field: "session", Value: "agent:main:*"},
+	}, q.Filters)
+	assert.Equal(t, []string{"alert"}, q.Kinds)
+	assert.Equal(t, now.AddDate(0, 0, -7), *q.Since)
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), *q.Until, "until a date includes that day")
+	assert.Equal(t, `"rm" AND "etc passwd" AND "deploy"* AND "https://x.io" NOT "rf"`, q.FTS5())
+
+	q, err = Parse(`timeout OR refused gateway OR "connection reset"`, now)
+	require.NoError(t, err)
+	assert.Equal(t, `("timeout" OR "refused") AND ("gateway" OR "connection reset")`, q.FTS5())
+	expr, args := q.TSQuery()
+	assert.Equal(t, "((phraseto_tsquery('simple', ?) || phraseto_tsquery('simple', ?)) && (phraseto_tsquery('simple', ?) || phraseto_tsquery('simple', ?)))", expr)
+	assert.Len(t, args, 4)
+
+	q, err = Parse(`Deploy.Prod*`, now)
+	require.NoError(t, err)
+	_, args = q.TSQuery()
+	assert.Equal(t, []interface{}{"deploy <-> prod:*"}, args)
+
+	for _, bad := range []string{`-only -negative`, `kind:nope`, `since:yesterdayish`, `since:1d until:2d`, `risk:`, `-kind:alert`} {
+		_, err := Parse(bad, now)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	now := time.Now()
+
+	activities := database.NewActivityRepo()
+	require.NoError(t, activities.Create(&database.Activity{
+		EventID: "a1", Timestamp: now.Add(-time.Hour), Category: "Shell", Risk: "high", Source: "bash",
+		Summary: "exec: rm -rf /var/lib/app", Detail: `{"command":"rm -rf /var/lib/app"}`, GatewayID: 1,
+	}))
+	require.NoError(t, activities.Create(&database.Activity{
+		EventID: "a2", Timestamp: now.Add(-2 * time.Hour), Category: "Network", Risk: "low", Source: "web_fetch",
+		Summary: "fetch docs", Detail: `{"url":"https://docs.example.com"}`, GatewayID: 2,
+	}))
+	require.NoError(t, database.NewAlertRepo().Create(&database.Alert{
+		AlertID: "x1", Risk: "high", Status: "open", Message: "Dangerous command: rm -rf <root>", GatewayID: 1,
+	}))
+	require.NoError(t, database.NewAuditLogRepo().Create(&database.AuditLog{
+		Username: "admin", Action: "gateway.restart", Detail: "restart after deploy", Result: "success",
+	}))
+	require.NoError(t, database.NewSessionTranscriptRepo().Append([]database.SessionTranscript{
+		{GatewayID: 1, SessionKey: "agent:main:main", Seq: 0, Role: "user", Content: "please deploy the release", Timestamp: now},
+		{GatewayID: 1, SessionKey: "agent:main:main", Seq: 1, Role: "assistant", Content: "Deploying now", Timestamp: now},
+	}))
+
+	res, err := Search(Request{Query: "rm"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, res.Total)
+	assert.Equal(t, map[string]int64{"activity": 1, "alert": 1, "audit": 0, "transcript": 0}, res.Counts)
+	for _, h := range res.Hits {
+		assert.Contains(t, h.Snippet, "<mark>rm</mark>")
+	}
+	alertHit := res.Hits[0]
+	if alertHit.Kind != "alert" {
+		alertHit = res.Hits[1]
+	}
+	assert.Contains(t, alertHit.Snippet, "&lt;root&gt;", "snippets are HTML-escaped")
+
+	res, err = Search(Request{Query: "rm risk:high gateway:1"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, res.Total)
+	_, err = Search(Request{Query: "rm gateway:main"})
+	var invalid *InvalidError
+	assert.ErrorAs(t, err, &invalid)
+
+	res, err = Search(Request{Query: "rm source:bash"})
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1, "source only exists on activities")
+	assert.Equal(t, "activity", res.Hits[0].Kind)
+	assert.Equal(t, "bash", res.Hits[0].Fields["source"])
+
+	res, err = Search(Request{Query: "deploy*", Sort: SortTime})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, res.Total)
+	assert.Equal(t, map[string]int64{"activity": 0, "alert": 0, "audit": 1, "transcript": 2}, res.Counts)
+
+	res, err = Search(Request{Query: "deploy* role:user"})
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, "agent:main:main", res.Hits[0].Title)
+
+	res, err = Search(Request{Query: "deploy* -release", Kinds: []string{"transcript"}})
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1)
+	assert.Equal(t, "assistant", res.Hits[0].Fields["role"])
+
+	since := now.Add(-90 * time.Minute)
+	res, err = Search(Request{Query: "category:*", Since: &since})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, res.Total, "field filter without text, bounded in time")
+
+	_, err = Search(Request{Query: "x", Page: 100, PageSize: 100})
+	assert.ErrorAs(t, err, &invalid)
+}
+
+func TestSearchPaging(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	repo := database.NewActivityRepo()
+	now := time.Now()
+	for i := 0; i < 25; i++ {
+		require.NoError(t, repo.Create(&database.Activity{
+			EventID: fmt.Sprintf("e%d", i), Timestamp: now.Add(-time.Duration(i) * time.Minute),
+			Summary: fmt.Sprintf("heartbeat %d", i),
+		}))
+	}
+	var seen []uint
+	for page := 1; page <= 3; page++ {
+		res, err := Search(Request{Query: "heartbeat", Sort: SortTime, Page: page, PageSize: 10})
+		require.NoError(t, err)
+		assert.EqualValues(t, 25, res.Total)
+		for i, h := range res.Hits {
+			if i > 0 {
+				assert.False(t, h.Timestamp.After(res.Hits[i-1].Timestamp))
+			}
+			seen = append(seen, h.ID)
+		}
+	}
+	assert.Len(t, seen, 25)
+
+	// Deleted rows leave the index.
+	require.NoError(t, database.DB.Where("event_id = ?", "e0").Delete(&database.Activity{}).Error)
+	res, err := Search(Request{Query: "heartbeat"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 24, res.Total)
+}
+
+func TestTranscriptIndexer(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	gw := &fakeGateway{
+		updatedAt: 1,
+		history: []map[string]interface{}{
+			{"role": "user", "content": "find the invoice", "timestamp": 1700000000000},
+			{"role": "assistant", "content": []map[string]string{{"type": "text", "text": "Invoice found"}, {"type": "tool_use"}}},
+		},
+	}
+	x := NewTranscriptIndexer(gw)
+	x.SetGatewayID(3)
+	require.NoError(t, x.IndexOnce())
+	require.NoError(t, x.IndexOnce())
+	assert.Equal(t, 1, gw.historyCalls, "unchanged sessions are not fetched again")
+
+	repo := database.NewSessionTranscriptRepo()
+	n, err := repo.Count(3, "agent:main:main")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	gw.history = append(gw.history, map[string]interface{}{"role": "user", "content": "thanks"})
+	gw.updatedAt = 2
+	require.NoError(t, x.IndexOnce())
+	n, _ = repo.Count(3, "agent:main:main")
+	assert.EqualValues(t, 3, n)
+
+	// A reset session is stored anew.
+	gw.history = gw.history[:1]
+	gw.history[0] = map[string]interface{}{"role": "user", "content": "new topic"}
+	gw.updatedAt = 3
+	require.NoError(t, x.IndexOnce())
+	res, err := Search(Request{Query: "invoice OR topic", Kinds: []string{"transcript"}})
+	require.NoError(t, err)
+	require.Len(t, res.Hits, 1)
+	assert.Contains(t, res.Hits[0].Snippet, "<mark>topic</mark>")
+}
+
+type fakeGateway struct {
+	updatedAt    int64
+	history      []map[string]interface{}
+	historyCalls int
+}
+
+func (g *fakeGateway) IsConnected() bool { return true }
+
+func (g *fakeGateway) RequestWithTimeout(method string, params interface{}, timeout time.Duration) (json.RawMessage, error) {
+	switch method {
+	case "sessions.list":
+		return json.Marshal(map[string]interface{}{
+			"sessions": []map[string]interface{}{{"key": "agent:main:main", "updatedAt": g.updatedAt}},
+		})
+	case "chat.history":
+		g.historyCalls++
+		return json.Marshal(map[string]interface{}{"messages": g.history})
+	}
+	return nil, fmt.Errorf("unexpected method %s", method)
+}
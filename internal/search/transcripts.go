@@ -0,0 +1,195 @@
+package search
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+)
+
+// SettingTranscripts enables transcript indexing when set to "true".
+const SettingTranscripts = "search_transcripts"
+
+// Gateway is the part of the gateway client the transcript indexer uses.
+type Gateway interface {
+	IsConnected() bool
+	RequestWithTimeout(method string, params interface{}, timeout time.Duration) (json.RawMessage, error)
+}
+
+// TranscriptIndexer copies the chat history of gateway sessions into the
+// database so it can be searched. Only sessions updated since the last pass
+// are fetched; a history that got shorter (reset or compacted) is stored anew.
+type TranscriptIndexer struct {
+	gw       Gateway
+	repo     *database.SessionTranscriptRepo
+	settings *database.SettingRepo
+
+	mu        sync.Mutex
+	gatewayID uint
+	indexed   map[string]int64 // session key -> updatedAt of the indexed history
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewTranscriptIndexer(gw Gateway) *TranscriptIndexer {
+	return &TranscriptIndexer{
+		gw:       gw,
+		repo:     database.NewSessionTranscriptRepo(),
+		settings: database.NewSettingRepo(),
+		indexed:  make(map[string]int64),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// SetGatewayID selects the gateway whose sessions are indexed.
+func (x *TranscriptIndexer) SetGatewayID(id uint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.gatewayID != id {
+		x.gatewayID = id
+		x.indexed = make(map[string]int64)
+	}
+}
+
+// Enabled reports whether transcript indexing is switched on.
+func (x *TranscriptIndexer) Enabled() bool {
+	v, _ := x.settings.Get(SettingTranscripts)
+	return v == "true"
+}
+
+// Start indexes every interval until Stop is called.
+func (x *TranscriptIndexer) Start(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-x.stopCh:
+			return
+		case <-ticker.C:
+			if !x.Enabled() || !x.gw.IsConnected() {
+				continue
+			}
+			if err := x.IndexOnce(); err != nil {
+				logger.Monitor.Debug().Err(err).Msg("transcript indexing failed")
+			}
+		}
+	}
+}
+
+func (x *TranscriptIndexer) Stop() {
+	x.stopOnce.Do(func() { close(x.stopCh) })
+}
+
+// IndexOnce stores new messages of every session updated since the last pass.
+func (x *TranscriptIndexer) IndexOnce() error {
+	raw, err := x.gw.RequestWithTimeout("sessions.list", map[string]interface{}{}, 15*time.Second)
+	if err != nil {
+		return err
+	}
+	var list struct {
+		Sessions []struct {
+			Key       string `json:"key"`
+			UpdatedAt int64  `json:"updatedAt"`
+		} `json:"sessions"`
+	}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	gatewayID := x.gatewayID
+	x.mu.Unlock()
+	for _, s := range list.Sessions {
+		x.mu.Lock()
+		done := s.Key == "" || (x.indexed[s.Key] == s.UpdatedAt && s.UpdatedAt != 0)
+		x.mu.Unlock()
+		if done {
+			continue
+		}
+		if err := x.indexSession(gatewayID, s.Key); err != nil {
+			logger.Monitor.Debug().Err(err).Str("session", s.Key).Msg("transcript indexing failed")
+			continue
+		}
+		x.mu.Lock()
+		if x.gatewayID == gatewayID {
+			x.indexed[s.Key] = s.UpdatedAt
+		}
+		x.mu.Unlock()
+	}
+	return nil
+}
+
+func (x *TranscriptIndexer) indexSession(gatewayID uint, key string) error {
+	raw, err := x.gw.RequestWithTimeout("chat.history", map[string]interface{}{"sessionKey": key}, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	var history struct {
+		Messages []struct {
+			Role      string          `json:"role"`
+			Content   json.RawMessage `json:"content"`
+			Timestamp int64           `json:"timestamp"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return err
+	}
+
+	stored, err := x.repo.Count(gatewayID, key)
+	if err != nil {
+		return err
+	}
+	if int64(len(history.Messages)) < stored {
+		if err := x.repo.DeleteSession(gatewayID, key); err != nil {
+			return err
+		}
+		stored = 0
+	}
+	var msgs []database.SessionTranscript
+	for i := int(stored); i < len(history.Messages); i++ {
+		m := history.Messages[i]
+		text := messageText(m.Content)
+		if text == "" {
+			continue
+		}
+		ts := time.Now()
+		if m.Timestamp > 0 {
+			ts = time.UnixMilli(m.Timestamp)
+		}
+		msgs = append(msgs, database.SessionTranscript{
+			GatewayID:  gatewayID,
+			SessionKey: key,
+			Seq:        i,
+			Role:       m.Role,
+			Content:    text,
+			Timestamp:  ts,
+		})
+	}
+	return x.repo.Append(msgs)
+}
+
+// messageText returns the text of a chat message, whose content is either a
+// string or a list of blocks of which the text blocks are kept.
+func messageText(content json.RawMessage) string {
+	var s string
+	if json.Unmarshal(content, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(content, &blocks) != nil {
+		return ""
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" && strings.TrimSpace(b.Text) != "" {
+			parts = append(parts, strings.TrimSpace(b.Text))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,384 @@
+package snapshots
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Escrow and recovery key slots hold the snapshot DEK as a small file in the
+// age v1 format (https://age-encryption.org/v1) sealed to an X25519
+// recipient, so an escrow holder can extract it with the standard age tool
+// and without ClawDeckX. Only the X25519 recipient type is supported.
+
+const (
+	ageIntro          = "age-encryption.org/v1"
+	ageRecipientHRP   = "age"
+	ageIdentityHRP    = "age-secret-key-"
+	ageX25519Label    = "age-encryption.org/v1/X25519"
+	ageStanzaColumns  = 64
+	ageFileKeySize    = 16
+	agePayloadNonceSz = 16
+	ageMaxPayload     = 64 * 1024 // one STREAM chunk is plenty for a DEK
+)
+
+var b64raw = base64.RawStdEncoding
+
+// parseAgeRecipient decodes an "age1..." X25519 recipient.
+func parseAgeRecipient(s string) (*ecdh.PublicKey, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient: %w", err)
+	}
+	if hrp != ageRecipientHRP {
+		return nil, errors.New("invalid age recipient: not an X25519 recipient")
+	}
+	pub, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient: %w", err)
+	}
+	return pub, nil
+}
+
+// parseAgeIdentity decodes an "AGE-SECRET-KEY-1..." X25519 identity.
+func parseAgeIdentity(s string) (*ecdh.PrivateKey, error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identity: %w", err)
+	}
+	if hrp != ageIdentityHRP {
+		return nil, errors.New("invalid age identity: not an X25519 identity")
+	}
+	return ecdh.X25519().NewPrivateKey(data)
+}
+
+func encodeAgeRecipient(pub *ecdh.PublicKey) string {
+	return bech32Encode(ageRecipientHRP, pub.Bytes())
+}
+
+func encodeAgeIdentity(key *ecdh.PrivateKey) string {
+	return strings.ToUpper(bech32Encode(ageIdentityHRP, key.Bytes()))
+}
+
+// ageSeal encrypts plaintext to a single X25519 recipient.
+func ageSeal(recipient *ecdh.PublicKey, plaintext []byte) ([]byte, error) {
+	if len(plaintext) > ageMaxPayload {
+		return nil, errors.New("age payload too large")
+	}
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	share := ephemeral.PublicKey().Bytes()
+	wrapKey, err := hkdf.Key(sha256.New, shared, append(append([]byte{}, share...), recipient.Bytes()...), ageX25519Label, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	body, err := chachaSeal(wrapKey, make([]byte, chacha20poly1305.NonceSize), fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var hdr bytes.Buffer
+	hdr.WriteString(ageIntro + "\n")
+	hdr.WriteString("-> X25519 " + b64raw.EncodeToString(share) + "\n")
+	writeAgeBody(&hdr, body)
+	hdr.WriteString("---")
+	mac, err := ageHeaderMAC(fileKey, hdr.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	hdr.WriteString(" " + b64raw.EncodeToString(mac) + "\n")
+
+	nonce := make([]byte, agePayloadNonceSz)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	payloadKey, err := hkdf.Key(sha256.New, fileKey, nonce, "payload", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := chachaSeal(payloadKey, ageLastChunkNonce(), plaintext)
+	if err != nil {
+		return nil, err
+	}
+	out := hdr.Bytes()
+	out = append(out, nonce...)
+	return append(out, chunk...), nil
+}
+
+// ageOpen decrypts a file produced by ageSeal, or by the age tool for an
+// X25519 recipient, whose payload fits in a single chunk.
+func ageOpen(identity *ecdh.PrivateKey, file []byte) ([]byte, error) {
+	stanzas, headerNoMAC, mac, payload, err := parseAgeHeader(file)
+	if err != nil {
+		return nil, err
+	}
+	var fileKey []byte
+	for _, st := range stanzas {
+		if len(st.args) != 2 || st.args[0] != "X25519" {
+			continue
+		}
+		share, err := b64raw.DecodeString(st.args[1])
+		if err != nil || len(share) != 32 {
+			continue
+		}
+		pub, err := ecdh.X25519().NewPublicKey(share)
+		if err != nil {
+			continue
+		}
+		shared, err := identity.ECDH(pub)
+		if err != nil {
+			continue
+		}
+		salt := append(append([]byte{}, share...), identity.PublicKey().Bytes()...)
+		wrapKey, err := hkdf.Key(sha256.New, shared, salt, ageX25519Label, chacha20poly1305.KeySize)
+		if err != nil {
+			return nil, err
+		}
+		if fk, err := chachaOpen(wrapKey, make([]byte, chacha20poly1305.NonceSize), st.body); err == nil && len(fk) == ageFileKeySize {
+			fileKey = fk
+			break
+		}
+	}
+	if fileKey == nil {
+		return nil, errors.New("no matching age recipient")
+	}
+	want, err := ageHeaderMAC(fileKey, headerNoMAC)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(want, mac) {
+		return nil, errors.New("age header MAC mismatch")
+	}
+	if len(payload) < agePayloadNonceSz {
+		return nil, errors.New("age payload truncated")
+	}
+	payloadKey, err := hkdf.Key(sha256.New, fileKey, payload[:agePayloadNonceSz], "payload", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := chachaOpen(payloadKey, ageLastChunkNonce(), payload[agePayloadNonceSz:])
+	if err != nil {
+		return nil, errors.New("age payload decryption failed")
+	}
+	return plain, nil
+}
+
+type ageStanza struct {
+	args []string
+	body []byte
+}
+
+// parseAgeHeader splits an age file into its stanzas, the header bytes the
+// MAC covers, the MAC and the payload.
+func parseAgeHeader(file []byte) (stanzas []ageStanza, headerNoMAC, mac, payload []byte, err error) {
+	rest := file
+	next := func() (string, bool) {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			return "", false
+		}
+		line := string(rest[:i])
+		rest = rest[i+1:]
+		return line, true
+	}
+	bad := errors.New("invalid age header")
+	if line, ok := next(); !ok || line != ageIntro {
+		return nil, nil, nil, nil, bad
+	}
+	for {
+		start := len(file) - len(rest)
+		line, ok := next()
+		if !ok {
+			return nil, nil, nil, nil, bad
+		}
+		if strings.HasPrefix(line, "--- ") {
+			headerNoMAC = file[:start+3]
+			if mac, err = b64raw.DecodeString(line[4:]); err != nil {
+				return nil, nil, nil, nil, bad
+			}
+			return stanzas, headerNoMAC, mac, rest, nil
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, nil, nil, nil, bad
+		}
+		st := ageStanza{args: strings.Split(line[3:], " ")}
+		for {
+			bodyLine, ok := next()
+			if !ok || len(bodyLine) > ageStanzaColumns {
+				return nil, nil, nil, nil, bad
+			}
+			chunk, err := b64raw.DecodeString(bodyLine)
+			if err != nil {
+				return nil, nil, nil, nil, bad
+			}
+			st.body = append(st.body, chunk...)
+			if len(bodyLine) < ageStanzaColumns {
+				break
+			}
+		}
+		stanzas = append(stanzas, st)
+	}
+}
+
+func writeAgeBody(w *bytes.Buffer, body []byte) {
+	enc := b64raw.EncodeToString(body)
+	for len(enc) >= ageStanzaColumns {
+		w.WriteString(enc[:ageStanzaColumns] + "\n")
+		enc = enc[ageStanzaColumns:]
+	}
+	w.WriteString(enc + "\n")
+}
+
+func ageHeaderMAC(fileKey, header []byte) ([]byte, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, nil, "header", sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(header)
+	return h.Sum(nil), nil
+}
+
+// ageLastChunkNonce is the STREAM nonce of chunk 0 when it is also the last.
+func ageLastChunkNonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	nonce[len(nonce)-1] = 1
+	return nonce
+}
+
+func chachaSeal(key, nonce, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func chachaOpen(key, nonce, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// Bech32 (BIP 173) without the 90 character limit, as age uses it.
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+func bech32Encode(hrp string, data []byte) string {
+	values, _ := convertBits(data, 8, 5, true)
+	check := append(bech32HRPExpand(hrp), values...)
+	mod := bech32Polymod(append(check, 0, 0, 0, 0, 0, 0)) ^ 1
+	var sb strings.Builder
+	sb.WriteString(hrp + "1")
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(mod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("bad separator position")
+	}
+	hrp := s[:pos]
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, errors.New("invalid character")
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("bad checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to)+1)
+	for _, b := range data {
+		if uint32(b)>>from != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
@@ -0,0 +1,617 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	settingAutoEnabled      = "snapshot_auto_enabled"
+	settingAutoDebounce     = "snapshot_auto_debounce_seconds"
+	settingAutoMinInterval  = "snapshot_auto_min_interval_minutes"
+	settingAutoMaxPerDay    = "snapshot_auto_max_per_day"
+	settingAutoTriggerTypes = "snapshot_auto_trigger_types"
+	settingAutoRetention    = "snapshot_auto_retention"
+	settingAutoLastRunAt    = "snapshot_auto_last_run_at"
+	settingAutoLastStatus   = "snapshot_auto_last_status"
+	settingAutoLastError    = "snapshot_auto_last_error"
+	settingAutoLastSnapshot = "snapshot_auto_last_snapshot_id"
+)
+
+const (
+	// autoNoteFiles is how many changed files an auto-change note names.
+	autoNoteFiles = 5
+	// autoRescanInterval is how often watched directories are resynced, so
+	// a state dir or agent created later is picked up.
+	autoRescanInterval = time.Minute
+	// autoRetryDelay is the wait after a failed rate-limit lookup.
+	autoRetryDelay = time.Minute
+)
+
+// AutoResourceTypes are the resource types that can trigger an auto-change
+// snapshot.
+var AutoResourceTypes = []string{"config_json", "include_config", "markdown", "json", "env", "credential"}
+
+// defaultAutoTriggerTypes leaves out credentials, which OAuth token refreshes
+// rewrite without any user action.
+var defaultAutoTriggerTypes = []string{"config_json", "include_config", "markdown", "json", "env"}
+
+var defaultAutoRetention = RetentionPolicy{KeepLast: 20, KeepDaily: 7}
+
+// AutoSnapshotConfig controls change-triggered snapshots. They are sealed
+// with the schedule password.
+type AutoSnapshotConfig struct {
+	Enabled            bool            `json:"enabled"`
+	DebounceSeconds    int             `json:"debounceSeconds"`
+	MinIntervalMinutes int             `json:"minIntervalMinutes"`
+	MaxPerDay          int             `json:"maxPerDay"`
+	TriggerTypes       []string        `json:"triggerTypes"`
+	Retention          RetentionPolicy `json:"retention"`
+	PasswordSet        bool            `json:"passwordSet"`
+}
+
+type AutoSnapshotStatus struct {
+	Watching       bool       `json:"watching"`
+	WatchedDirs    []string   `json:"watchedDirs"`
+	Pending        []string   `json:"pending"` // changed logical paths waiting for a snapshot
+	DueAt          *time.Time `json:"dueAt,omitempty"`
+	RunsLast24h    int        `json:"runsLast24h"`
+	LastRunAt      *time.Time `json:"lastRunAt,omitempty"`
+	LastStatus     string     `json:"lastStatus"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastSnapshotID string     `json:"lastSnapshotId,omitempty"`
+}
+
+// ChangeWatcher creates a snapshot when files of the OpenClaw state dir are
+// changed outside ClawDeckX. Changes are collected until none arrived for
+// the debounce window, then snapshotted at most once per minimum interval
+// and MaxPerDay times in 24 hours; later changes wait for the next slot.
+type ChangeWatcher struct {
+	svc       *Service
+	sched     *Scheduler
+	setting   *database.SettingRepo
+	auditRepo *database.AuditLogRepo
+	wake      chan struct{}
+
+	mu       sync.Mutex
+	cfg      *AutoSnapshotConfig
+	pending  map[string]string // logical path -> resource type
+	due      time.Time
+	watched  map[string]bool
+	watching bool
+}
+
+func NewChangeWatcher(svc *Service, sched *Scheduler) *ChangeWatcher {
+	return &ChangeWatcher{
+		svc:       svc,
+		sched:     sched,
+		setting:   database.NewSettingRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		wake:      make(chan struct{}, 1),
+		pending:   map[string]string{},
+		watched:   map[string]bool{},
+	}
+}
+
+// Start watches the state dir until ctx is done.
+func (w *ChangeWatcher) Start(ctx context.Context) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Backup.Error().Err(err).Msg("start snapshot change watcher")
+		return
+	}
+	defer fw.Close()
+	w.setWatching(true)
+	defer w.setWatching(false)
+
+	w.syncWatches(fw)
+	rescan := time.NewTicker(autoRescanInterval)
+	defer rescan.Stop()
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	arm := func(at time.Time) {
+		timer.Stop()
+		select {
+		case <-timer.C:
+		default:
+		}
+		timer.Reset(time.Until(at))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+					w.syncWatches(fw)
+				}
+			}
+			if due, ok := w.observe(ev.Name, time.Now()); ok {
+				arm(due)
+			}
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return
+			}
+			logger.Backup.Warn().Err(err).Msg("snapshot change watcher")
+		case <-rescan.C:
+			w.syncWatches(fw)
+		case <-w.wake:
+			if due, ok := w.dueAt(); ok {
+				arm(due)
+			}
+		case <-timer.C:
+			if next, ok := w.flush(time.Now()); ok {
+				arm(next)
+			}
+		}
+	}
+}
+
+// GetConfig returns the auto-change snapshot settings.
+func (w *ChangeWatcher) GetConfig() *AutoSnapshotConfig {
+	cfg := *w.config()
+	cfg.TriggerTypes = append([]string(nil), cfg.TriggerTypes...)
+	cfg.PasswordSet = w.sched.passwordSet()
+	return &cfg
+}
+
+// UpdateConfig validates and stores the auto-change snapshot settings.
+func (w *ChangeWatcher) UpdateConfig(in AutoSnapshotConfig, userID uint, username, ip string) error {
+	if in.DebounceSeconds < 5 || in.DebounceSeconds > 3600 {
+		return fmt.Errorf("debounce must be between 5 and 3600 seconds")
+	}
+	if in.MinIntervalMinutes < 0 || in.MinIntervalMinutes > 1440 {
+		return fmt.Errorf("minimum interval must be between 0 and 1440 minutes")
+	}
+	if in.MaxPerDay < 1 || in.MaxPerDay > 288 {
+		return fmt.Errorf("max snapshots per day must be between 1 and 288")
+	}
+	types := []string{}
+	for _, t := range in.TriggerTypes {
+		if !containsString(AutoResourceTypes, t) {
+			return fmt.Errorf("unknown resource type %q", t)
+		}
+		if !containsString(types, t) {
+			types = append(types, t)
+		}
+	}
+	if in.Enabled && len(types) == 0 {
+		return fmt.Errorf("at least one trigger type is required")
+	}
+	if err := in.Retention.validate(); err != nil {
+		return err
+	}
+	if in.Enabled && !w.sched.passwordSet() {
+		return fmt.Errorf("schedule password required")
+	}
+	retention, _ := json.Marshal(in.Retention)
+	if err := w.setting.SetBatch(map[string]string{
+		settingAutoEnabled:      strconv.FormatBool(in.Enabled),
+		settingAutoDebounce:     strconv.Itoa(in.DebounceSeconds),
+		settingAutoMinInterval:  strconv.Itoa(in.MinIntervalMinutes),
+		settingAutoMaxPerDay:    strconv.Itoa(in.MaxPerDay),
+		settingAutoTriggerTypes: strings.Join(types, ","),
+		settingAutoRetention:    string(retention),
+	}); err != nil {
+		return err
+	}
+	cfg := in
+	cfg.TriggerTypes = types
+	cfg.PasswordSet = false
+	w.mu.Lock()
+	w.cfg = &cfg
+	if !cfg.Enabled {
+		w.pending = map[string]string{}
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	_ = w.auditRepo.Create(&database.AuditLog{
+		UserID:   userID,
+		Username: username,
+		Action:   constants.ActionSnapshotAutoUpdate,
+		Result:   "success",
+		Detail: fmt.Sprintf("enabled=%t,debounce=%ds,interval=%dm,max_per_day=%d,types=%s", cfg.Enabled,
+			cfg.DebounceSeconds, cfg.MinIntervalMinutes, cfg.MaxPerDay, strings.Join(types, ",")),
+		IP: ip,
+	})
+	return nil
+}
+
+// GetStatus reports what is watched, what is pending and the last run.
+func (w *ChangeWatcher) GetStatus() (*AutoSnapshotStatus, error) {
+	recent, err := w.svc.repo.ListByTriggerSince(AutoChangeSnapshotTag, time.Now().Add(-24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	st := &AutoSnapshotStatus{
+		WatchedDirs:    []string{},
+		Pending:        []string{},
+		RunsLast24h:    len(recent),
+		LastRunAt:      w.sched.getTime(settingAutoLastRunAt),
+		LastStatus:     w.sched.getString(settingAutoLastStatus, ScheduleStatusNever),
+		LastError:      w.sched.getString(settingAutoLastError, ""),
+		LastSnapshotID: w.sched.getString(settingAutoLastSnapshot, ""),
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st.Watching = w.watching
+	for d := range w.watched {
+		st.WatchedDirs = append(st.WatchedDirs, d)
+	}
+	for p := range w.pending {
+		st.Pending = append(st.Pending, p)
+	}
+	if len(w.pending) > 0 {
+		due := w.due
+		st.DueAt = &due
+	}
+	sort.Strings(st.WatchedDirs)
+	sort.Strings(st.Pending)
+	return st, nil
+}
+
+func (w *ChangeWatcher) config() *AutoSnapshotConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cfg == nil {
+		w.cfg = w.loadConfig()
+	}
+	return w.cfg
+}
+
+func (w *ChangeWatcher) loadConfig() *AutoSnapshotConfig {
+	cfg := &AutoSnapshotConfig{
+		Enabled:            w.sched.getBool(settingAutoEnabled, false),
+		DebounceSeconds:    w.sched.getInt(settingAutoDebounce, 60),
+		MinIntervalMinutes: w.sched.getInt(settingAutoMinInterval, 15),
+		MaxPerDay:          w.sched.getInt(settingAutoMaxPerDay, 24),
+		TriggerTypes:       defaultAutoTriggerTypes,
+		Retention:          defaultAutoRetention,
+	}
+	if v, err := w.setting.Get(settingAutoTriggerTypes); err == nil && v != "" {
+		cfg.TriggerTypes = strings.Split(v, ",")
+	}
+	if v, err := w.setting.Get(settingAutoRetention); err == nil && v != "" {
+		var p RetentionPolicy
+		if json.Unmarshal([]byte(v), &p) == nil {
+			cfg.Retention = p
+		}
+	}
+	return cfg
+}
+
+func (w *ChangeWatcher) setWatching(on bool) {
+	w.mu.Lock()
+	w.watching = on
+	w.mu.Unlock()
+}
+
+// observe records a change of path and returns when the pending changes
+// are due. ok is false when the change does not count as a trigger.
+func (w *ChangeWatcher) observe(path string, now time.Time) (due time.Time, ok bool) {
+	cfg := w.config()
+	if !cfg.Enabled {
+		return time.Time{}, false
+	}
+	logicalPath, resType, ok := classifyStatePath(resolveStateDir(), path)
+	if !ok || !containsString(cfg.TriggerTypes, resType) {
+		return time.Time{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[logicalPath] = resType
+	w.due = now.Add(time.Duration(cfg.DebounceSeconds) * time.Second)
+	return w.due, true
+}
+
+func (w *ChangeWatcher) dueAt() (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.due, len(w.pending) > 0
+}
+
+// flush snapshots the pending changes once they are due and the rate
+// limits allow it. It returns when to try again if changes remain pending.
+func (w *ChangeWatcher) flush(now time.Time) (next time.Time, ok bool) {
+	cfg := w.config()
+	w.mu.Lock()
+	if len(w.pending) == 0 {
+		w.mu.Unlock()
+		return time.Time{}, false
+	}
+	if now.Before(w.due) {
+		defer w.mu.Unlock()
+		return w.due, true
+	}
+	w.mu.Unlock()
+
+	recent, err := w.svc.repo.ListByTriggerSince(AutoChangeSnapshotTag, now.Add(-24*time.Hour))
+	if err != nil {
+		logger.Backup.Error().Err(err).Msg("list auto-change snapshots")
+		return w.postpone(now.Add(autoRetryDelay)), true
+	}
+	if len(recent) > 0 && cfg.MinIntervalMinutes > 0 {
+		if at := recent[0].CreatedAt.Add(time.Duration(cfg.MinIntervalMinutes) * time.Minute); now.Before(at) {
+			return w.postpone(at), true
+		}
+	}
+	if len(recent) >= cfg.MaxPerDay {
+		// Wait until enough of the last 24 hours' snapshots age out.
+		at := recent[cfg.MaxPerDay-1].CreatedAt.Add(24 * time.Hour)
+		logger.Backup.Info().Int("max_per_day", cfg.MaxPerDay).Time("until", at).Msg("auto-change snapshot rate limited")
+		return w.postpone(at), true
+	}
+
+	w.mu.Lock()
+	paths := make([]string, 0, len(w.pending))
+	for p := range w.pending {
+		paths = append(paths, p)
+	}
+	w.pending = map[string]string{}
+	w.mu.Unlock()
+	sort.Strings(paths)
+	w.run(paths, cfg)
+	return time.Time{}, false
+}
+
+func (w *ChangeWatcher) postpone(at time.Time) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if at.After(w.due) {
+		w.due = at
+	}
+	return w.due
+}
+
+// run creates the auto-change snapshot for paths, unless their content
+// matches the newest snapshot, as after a save without edits.
+func (w *ChangeWatcher) run(paths []string, cfg *AutoSnapshotConfig) {
+	now := time.Now().UTC()
+	resources, err := w.svc.collectResources(nil)
+	if err != nil {
+		w.finish(now, ScheduleStatusFailed, err, "", paths)
+		return
+	}
+	changed := w.changedPaths(paths, resources)
+	if len(changed) == 0 {
+		w.finish(now, ScheduleStatusSkipped, nil, "", paths)
+		return
+	}
+	password, err := w.sched.password()
+	if err != nil {
+		w.finish(now, ScheduleStatusFailed, err, "", changed)
+		return
+	}
+	rec, err := w.svc.createFrom(autoChangeNote(changed), AutoChangeSnapshotTag, password, resources, w.svc.selectTrees(nil), 0)
+	if err != nil {
+		w.finish(now, ScheduleStatusFailed, err, "", changed)
+		return
+	}
+	w.finish(now, ScheduleStatusSuccess, nil, rec.SnapshotID, changed)
+
+	pruned, err := w.svc.PruneTrigger(AutoChangeSnapshotTag, cfg.Retention, time.Local)
+	if err != nil {
+		_ = w.auditRepo.Create(&database.AuditLog{Action: constants.ActionSnapshotAutoPrune, Result: "failed", Detail: err.Error(), IP: "system"})
+	} else if len(pruned) > 0 {
+		_ = w.auditRepo.Create(&database.AuditLog{
+			Action: constants.ActionSnapshotAutoPrune,
+			Result: "success",
+			Detail: fmt.Sprintf("last=%d,hourly=%d,daily=%d,weekly=%d,monthly=%d,pruned=%d", cfg.Retention.KeepLast,
+				cfg.Retention.KeepHourly, cfg.Retention.KeepDaily, cfg.Retention.KeepWeekly, cfg.Retention.KeepMonthly, len(pruned)),
+			IP: "system",
+		})
+	}
+}
+
+// changedPaths returns the paths whose content differs from the newest
+// snapshot. Without per-file fingerprints every path counts as changed.
+func (w *ChangeWatcher) changedPaths(paths []string, resources []ResourceContent) []string {
+	current := map[string]string{}
+	for _, r := range resources {
+		current[r.Definition.LogicalPath] = blobIDForKey(blobKey(r.Content))
+	}
+	var previous map[string]string
+	if records, err := w.svc.repo.ListMeta(); err == nil && len(records) > 0 {
+		previous, _ = resourceBlobs(records[len(records)-1].ManifestSummaryJSON)
+	}
+	changed := []string{}
+	for _, p := range paths {
+		if previous == nil || current[p] != previous[p] {
+			changed = append(changed, p)
+		}
+	}
+	return changed
+}
+
+func (w *ChangeWatcher) finish(at time.Time, status string, runErr error, snapshotID string, paths []string) {
+	errText := ""
+	if runErr != nil {
+		errText = runErr.Error()
+	}
+	items := map[string]string{
+		settingAutoLastRunAt:  at.Format(time.RFC3339),
+		settingAutoLastStatus: status,
+		settingAutoLastError:  errText,
+	}
+	if snapshotID != "" {
+		items[settingAutoLastSnapshot] = snapshotID
+	}
+	_ = w.setting.SetBatch(items)
+	if status == ScheduleStatusSkipped {
+		return
+	}
+	detail := strings.Join(paths, ", ")
+	result := "success"
+	if runErr != nil {
+		result = "failed"
+		detail = errText + ": " + detail
+		logger.Backup.Error().Err(runErr).Strs("paths", paths).Msg("auto-change snapshot failed")
+	} else {
+		detail = snapshotID + ": " + detail
+	}
+	_ = w.auditRepo.Create(&database.AuditLog{
+		Action: constants.ActionSnapshotAutoRun,
+		Result: result,
+		Detail: detail,
+		IP:     "system",
+	})
+}
+
+// syncWatches watches the directories holding snapshot resources and drops
+// the watches of directories that are gone.
+func (w *ChangeWatcher) syncWatches(fw *fsnotify.Watcher) {
+	want := map[string]bool{}
+	for _, d := range stateWatchDirs(resolveStateDir()) {
+		want[d] = true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for d := range w.watched {
+		if !want[d] {
+			_ = fw.Remove(d)
+			delete(w.watched, d)
+		}
+	}
+	for d := range want {
+		if w.watched[d] {
+			continue
+		}
+		if err := fw.Add(d); err != nil {
+			logger.Backup.Debug().Err(err).Str("dir", d).Msg("watch snapshot resource dir")
+			continue
+		}
+		w.watched[d] = true
+	}
+}
+
+// stateWatchDirs lists the existing directories that may hold resources of
+// defaultRegistry.
+func stateWatchDirs(stateDir string) []string {
+	if stateDir == "" {
+		return nil
+	}
+	candidates := []string{
+		stateDir,
+		filepath.Join(stateDir, "agents"),
+		filepath.Join(stateDir, "personas"),
+		filepath.Join(stateDir, "credentials"),
+	}
+	if entries, err := os.ReadDir(filepath.Join(stateDir, "agents")); err == nil {
+		for _, e := range entries {
+			if e.IsDir() {
+				candidates = append(candidates, filepath.Join(stateDir, "agents", e.Name()))
+			}
+		}
+	}
+	for _, def := range discoverIncludeSubFiles(stateDir) {
+		candidates = append(candidates, filepath.Dir(def.ResolvePath()))
+	}
+	seen := map[string]bool{}
+	var dirs []string
+	for _, d := range candidates {
+		d = filepath.Clean(d)
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+		if st, err := os.Stat(d); err == nil && st.IsDir() {
+			dirs = append(dirs, d)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// classifyStatePath maps a file under stateDir to the logical path and type
+// of the resource defaultRegistry would back it up as. It also works for
+// removed files, except for $include files, which are found through the
+// current config.
+func classifyStatePath(stateDir, path string) (logicalPath, resType string, ok bool) {
+	if stateDir == "" {
+		return "", "", false
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(stateDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		name := parts[len(parts)-1]
+		ignored := strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")
+		switch {
+		case rel == "openclaw.json":
+			return configLogicalPath, "config_json", true
+		case rel == ".env":
+			return "files/config/.env", "env", true
+		case len(parts) == 3 && parts[0] == "agents" && isAgentMarkdownFile(name):
+			return "files/agents/" + parts[1] + "/" + name, "markdown", true
+		case len(parts) == 2 && parts[0] == "personas" && !ignored && strings.HasSuffix(strings.ToLower(name), ".json"):
+			return "files/personas/" + name, "json", true
+		case len(parts) == 2 && parts[0] == "credentials" && !ignored:
+			return "files/credentials/" + name, "credential", true
+		}
+	}
+	for _, def := range discoverIncludeSubFiles(stateDir) {
+		if filepath.Clean(def.ResolvePath()) == path {
+			return def.LogicalPath, def.Type, true
+		}
+	}
+	return "", "", false
+}
+
+func isAgentMarkdownFile(name string) bool {
+	for _, spec := range agentMarkdownFiles {
+		if spec.fileName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// autoChangeNote names the changed files, without the files/ prefix.
+func autoChangeNote(paths []string) string {
+	names := make([]string, 0, autoNoteFiles)
+	for i, p := range paths {
+		if i == autoNoteFiles {
+			break
+		}
+		names = append(names, strings.TrimPrefix(p, "files/"))
+	}
+	note := "auto change: " + strings.Join(names, ", ")
+	if extra := len(paths) - len(names); extra > 0 {
+		note += fmt.Sprintf(" and %d more", extra)
+	}
+	return note
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package snapshots
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeStateFile(t *testing.T, dir, rel, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestClassifyStatePath(t *testing.T) {
+	dir := t.TempDir()
+	writeStateFile(t, dir, "openclaw.json", `{"agents":{"$include":"extra/agents.json5"}}`)
+	writeStateFile(t, dir, "extra/agents.json5", "{}")
+
+	cases := []struct {
+		rel, logical, typ string
+	}{
+		{"openclaw.json", "files/config/openclaw.json", "config_json"},
+		{".env", "files/config/.env", "env"},
+		{"agents/main/SOUL.md", "files/agents/main/SOUL.md", "markdown"},
+		{"personas/coach.json", "files/personas/coach.json", "json"},
+		{"credentials/oauth.json", "files/credentials/oauth.json", "credential"},
+		{"extra/agents.json5", "files/config/extra/agents.json5", "include_config"},
+		{"agents/main/notes.md", "", ""},
+		{"agents/main/sessions/SOUL.md", "", ""},
+		{"personas/.coach.json.swp", "", ""},
+		{"openclaw.json.tmp", "", ""},
+	}
+	for _, c := range cases {
+		logical, typ, ok := classifyStatePath(dir, filepath.Join(dir, filepath.FromSlash(c.rel)))
+		assert.Equal(t, c.logical != "", ok, c.rel)
+		assert.Equal(t, c.logical, logical, c.rel)
+		assert.Equal(t, c.typ, typ, c.rel)
+	}
+	assert.Contains(t, stateWatchDirs(dir), filepath.Join(dir, "extra"))
+}
+
+func TestChangeWatcher_DebounceAndRateLimit(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	writeStateFile(t, dir, "openclaw.json", `{"gateway":{"port":18789}}`)
+	soul := writeStateFile(t, dir, "agents/main/SOUL.md", "calm\n")
+	cred := writeStateFile(t, dir, "credentials/oauth.json", "{}")
+
+	svc := NewService()
+	sched := NewScheduler(svc)
+	require.NoError(t, sched.savePassword(testPassword))
+	w := NewChangeWatcher(svc, sched)
+	require.NoError(t, w.UpdateConfig(AutoSnapshotConfig{
+		Enabled: true, DebounceSeconds: 30, MinIntervalMinutes: 10, MaxPerDay: 2,
+		TriggerTypes: []string{"markdown", "config_json"}, Retention: RetentionPolicy{KeepLast: 5},
+	}, 1, "admin", "127.0.0.1"))
+
+	now := time.Now()
+	_, ok := w.observe(cred, now)
+	assert.False(t, ok, "credential changes are not a trigger")
+	due, ok := w.observe(soul, now)
+	require.True(t, ok)
+	assert.Equal(t, now.Add(30*time.Second), due)
+
+	// Nothing happens inside the debounce window.
+	next, ok := w.flush(now.Add(10 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, due, next)
+
+	_, ok = w.flush(due)
+	assert.False(t, ok)
+	list, err := database.NewSnapshotRepo().ListByTrigger(AutoChangeSnapshotTag)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "auto change: agents/main/SOUL.md", list[0].Note)
+	logs, err := database.NewAuditLogRepo().ListByAction(constants.ActionSnapshotAutoRun, 10)
+	require.NoError(t, err)
+	assert.Len(t, logs, 1)
+
+	// A second edit waits for the minimum interval.
+	require.NoError(t, os.WriteFile(soul, []byte("calmer\n"), 0o600))
+	w.observe(soul, now.Add(time.Minute))
+	next, ok = w.flush(now.Add(2 * time.Minute))
+	require.True(t, ok)
+	assert.WithinDuration(t, list[0].CreatedAt.Add(10*time.Minute), next, time.Second)
+
+	_, ok = w.flush(now.Add(11 * time.Minute))
+	assert.False(t, ok)
+	list, _ = database.NewSnapshotRepo().ListByTrigger(AutoChangeSnapshotTag)
+	assert.Len(t, list, 2)
+
+	// The daily cap postpones further snapshots by a day.
+	require.NoError(t, os.WriteFile(soul, []byte("calmest\n"), 0o600))
+	w.observe(soul, now.Add(30*time.Minute))
+	next, ok = w.flush(now.Add(31 * time.Minute))
+	require.True(t, ok)
+	assert.True(t, next.After(now.Add(23*time.Hour)), next)
+	status, err := w.GetStatus()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"files/agents/main/SOUL.md"}, status.Pending)
+	assert.Equal(t, 2, status.RunsLast24h)
+}
+
+func TestChangeWatcher_SkipsUnchangedContent(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	cfgPath := writeStateFile(t, dir, "openclaw.json", `{"gateway":{"port":18789}}`)
+
+	svc := NewService()
+	sched := NewScheduler(svc)
+	require.NoError(t, sched.savePassword(testPassword))
+	_, err := svc.Create("baseline", DefaultSnapshotTag, testPassword, nil)
+	require.NoError(t, err)
+
+	w := NewChangeWatcher(svc, sched)
+	require.NoError(t, w.UpdateConfig(AutoSnapshotConfig{
+		Enabled: true, DebounceSeconds: 5, MaxPerDay: 10, TriggerTypes: []string{"config_json"},
+	}, 1, "admin", "127.0.0.1"))
+
+	now := time.Now()
+	w.observe(cfgPath, now)
+	_, ok := w.flush(now.Add(time.Minute))
+	assert.False(t, ok)
+	list, err := database.NewSnapshotRepo().ListByTrigger(AutoChangeSnapshotTag)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	status, err := w.GetStatus()
+	require.NoError(t, err)
+	assert.Equal(t, ScheduleStatusSkipped, status.LastStatus)
+	assert.Empty(t, status.Pending)
+}
+
+func TestAutoChangeNote(t *testing.T) {
+	assert.Equal(t, "auto change: a, b, c, d, e and 2 more",
+		autoChangeNote([]string{"files/a", "files/b", "files/c", "files/d", "files/e", "files/f", "files/g"}))
+}
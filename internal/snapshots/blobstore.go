@@ -0,0 +1,393 @@
+package snapshots
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"ClawDeckX/internal/database"
+)
+
+// Snapshots since SnapshotVersion2 are content-addressed. Each resource is
+// stored once as a blob in snapshot_blobs; the snapshot row only holds a
+// small index (manifest plus blob references) sealed with the password
+// envelope. Since SnapshotVersion3 files larger than blobChunkSize are
+// split into several blobs, see stream.go.
+//
+// Blobs use convergent encryption: the blob key is a hash of the content and
+// the blob ID a hash of the key, so identical content always produces the
+// same blob and can be shared across snapshots with different passwords. The
+// keys only live inside the password-protected index, so a blob cannot be
+// read without a snapshot that references it.
+
+// blobIndex is the plaintext sealed in a version 2 snapshot row.
+type blobIndex struct {
+	Manifest SnapshotManifest `json:"manifest"`
+	Objects  []blobObject     `json:"objects"`
+}
+
+type blobObject struct {
+	Path   string      `json:"path"`             // logical path
+	Blob   string      `json:"blob,omitempty"`   // blob ID
+	Key    string      `json:"key,omitempty"`    // base64 blob key
+	Size   int64       `json:"size,omitempty"`   // plaintext size, unset before SnapshotVersion3
+	Chunks []blobChunk `json:"chunks,omitempty"` // instead of Blob and Key for files split by putObject
+}
+
+func blobKey(content []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("clawdeckx-blob-key\x00"))
+	h.Write(content)
+	return h.Sum(nil)
+}
+
+func blobIDForKey(key []byte) string {
+	h := sha256.Sum256(append([]byte("clawdeckx-blob-id\x00"), key...))
+	return hex.EncodeToString(h[:])
+}
+
+// sealBlob compresses and encrypts content under its own key. Each key
+// encrypts exactly one plaintext, so a fixed nonce is safe and the output
+// is deterministic.
+func sealBlob(content []byte) (database.SnapshotBlob, []byte, error) {
+	key := blobKey(content)
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return database.SnapshotBlob{}, nil, err
+	}
+	if _, err := fw.Write(content); err != nil {
+		return database.SnapshotBlob{}, nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return database.SnapshotBlob{}, nil, err
+	}
+	gcm, err := blobCipher(key)
+	if err != nil {
+		return database.SnapshotBlob{}, nil, err
+	}
+	data := gcm.Seal(nil, make([]byte, gcm.NonceSize()), buf.Bytes(), nil)
+	return database.SnapshotBlob{
+		BlobID:      blobIDForKey(key),
+		SizeBytes:   int64(len(content)),
+		StoredBytes: int64(len(data)),
+		Data:        data,
+	}, key, nil
+}
+
+// errBlobMismatch marks a stored blob that decrypts under its key but to
+// other content, as one planted by an imported backup could.
+var errBlobMismatch = errors.New("blob does not match its content")
+
+// blobHolds reports whether a stored blob decrypts to content.
+func blobHolds(stored database.SnapshotBlob, key, content []byte) bool {
+	got, err := openBlob(stored.Data, key)
+	return err == nil && bytes.Equal(got, content)
+}
+
+func openBlob(data, key []byte) ([]byte, error) {
+	gcm, err := blobCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), data, nil)
+	if err != nil {
+		return nil, err
+	}
+	fr := flate.NewReader(bytes.NewReader(compressed))
+	defer fr.Close()
+	content, err := io.ReadAll(io.LimitReader(fr, MaxSnapshotSizeBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > MaxSnapshotSizeBytes {
+		return nil, errors.New("blob exceeds snapshot size limit")
+	}
+	return content, nil
+}
+
+func blobCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the resources of a snapshot into record and returns the
+// blobs it references. Blobs already in the store are checked and repaired
+// if their stored copy no longer decrypts to the content. stored are the
+// objects already written with putObject, such as tree files.
+func (s *Service) seal(record *database.SnapshotRecord, manifest SnapshotManifest, resources []ResourceContent, stored []blobObject, password string) ([]database.SnapshotBlob, error) {
+	index := blobIndex{Manifest: manifest, Objects: make([]blobObject, 0, len(resources))}
+	blobs := make([]database.SnapshotBlob, 0, len(resources))
+	keys := map[string][]byte{}
+	contents := map[string][]byte{}
+	for _, res := range resources {
+		blob, key, err := sealBlob(res.Content)
+		if err != nil {
+			return nil, err
+		}
+		index.Objects = append(index.Objects, blobObject{
+			Path: res.Definition.LogicalPath,
+			Blob: blob.BlobID,
+			Key:  base64.StdEncoding.EncodeToString(key),
+			Size: int64(len(res.Content)),
+		})
+		if _, dup := keys[blob.BlobID]; dup {
+			continue
+		}
+		keys[blob.BlobID] = key
+		contents[blob.BlobID] = res.Content
+		blobs = append(blobs, blob)
+	}
+
+	ids := make([]string, 0, len(blobs))
+	for _, b := range blobs {
+		ids = append(ids, b.BlobID)
+	}
+	existing, err := s.blobs.GetMany(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range blobs {
+		old, ok := existing[blobs[i].BlobID]
+		if !ok {
+			continue
+		}
+		if blobHolds(old, keys[old.BlobID], contents[old.BlobID]) {
+			continue
+		}
+		if err := s.blobs.Replace(&blobs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	index.Objects = append(index.Objects, stored...)
+	plain, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	// Record which blob holds each path so per-file history can be shown
+	// without unlocking every snapshot. Blob IDs only reveal whether two
+	// snapshots share content, which the blob refs already do.
+	summary := map[string]any{}
+	if record.ManifestSummaryJSON != "" {
+		_ = json.Unmarshal([]byte(record.ManifestSummaryJSON), &summary)
+	}
+	pathBlobs := make(map[string]string, len(index.Objects))
+	for _, o := range index.Objects {
+		pathBlobs[o.Path] = o.contentID()
+	}
+	summary["resource_blobs"] = pathBlobs
+	summaryJSON, _ := json.Marshal(summary)
+	record.ManifestSummaryJSON = string(summaryJSON)
+	if err := s.sealEnvelope(record, password, plain); err != nil {
+		return nil, err
+	}
+	size := int64(len(record.Ciphertext))
+	for _, b := range blobs {
+		size += b.StoredBytes
+	}
+	record.SnapshotVersion = SnapshotVersion3
+	record.SizeBytes = size
+	record.CipherAlg = "aes-256-gcm"
+	return blobs, nil
+}
+
+// openSnapshot decrypts a snapshot of any version into its manifest and
+// file contents.
+func (s *Service) openSnapshot(record *database.SnapshotRecord, password string) (SnapshotManifest, map[string][]byte, error) {
+	manifest, files, lazy, err := s.openIndex(record, password)
+	if err != nil {
+		return SnapshotManifest{}, nil, err
+	}
+	for path, o := range lazy {
+		content, err := s.loadObject(o)
+		if err != nil {
+			return SnapshotManifest{}, nil, err
+		}
+		files[path] = content
+	}
+	return manifest, files, nil
+}
+
+// openIndex decrypts a snapshot like openSnapshot but leaves tree files
+// and chunked files unread; they are returned as index objects to load with
+// loadObject or stream with writeObject. The
+// password may also be a recovery key or escrow identity, see recordDEK.
+func (s *Service) openIndex(record *database.SnapshotRecord, password string) (SnapshotManifest, map[string][]byte, map[string]blobObject, error) {
+	dek, err := recordDEK(record, password)
+	if err != nil {
+		return SnapshotManifest{}, nil, nil, err
+	}
+	plain, err := decryptWithDEK(dek, record.DataNonceB64, record.Ciphertext)
+	if err != nil {
+		return SnapshotManifest{}, nil, nil, err
+	}
+	if record.SnapshotVersion < SnapshotVersion2 {
+		manifest, files, err := unpackBundle(plain)
+		return manifest, files, nil, err
+	}
+	var index blobIndex
+	if err := json.Unmarshal(plain, &index); err != nil {
+		return SnapshotManifest{}, nil, nil, fmt.Errorf("invalid snapshot index: %w", err)
+	}
+	lazy := map[string]blobObject{}
+	ids := make([]string, 0, len(index.Objects))
+	for _, o := range index.Objects {
+		if o.lazy() {
+			lazy[o.Path] = o
+			continue
+		}
+		ids = append(ids, o.Blob)
+	}
+	stored, err := s.blobs.GetMany(ids)
+	if err != nil {
+		return SnapshotManifest{}, nil, nil, err
+	}
+	files := make(map[string][]byte, len(index.Objects))
+	for _, o := range index.Objects {
+		if o.lazy() {
+			continue
+		}
+		blob, ok := stored[o.Blob]
+		if !ok {
+			return SnapshotManifest{}, nil, nil, fmt.Errorf("blob %s for %s is missing", o.Blob, o.Path)
+		}
+		content, err := openObject(o, blob)
+		if err != nil {
+			return SnapshotManifest{}, nil, nil, err
+		}
+		files[o.Path] = content
+	}
+	return index.Manifest, files, lazy, nil
+}
+
+// loadObject reads and decrypts a single index object into memory.
+func (s *Service) loadObject(o blobObject) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := s.writeObject(o, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// loadChunk reads and decrypts one blob of an object.
+func (s *Service) loadChunk(path string, c blobChunk) ([]byte, error) {
+	stored, err := s.blobs.GetMany([]string{c.Blob})
+	if err != nil {
+		return nil, err
+	}
+	blob, ok := stored[c.Blob]
+	if !ok {
+		return nil, fmt.Errorf("blob %s for %s is missing", c.Blob, path)
+	}
+	return openObject(blobObject{Path: path, Blob: c.Blob, Key: c.Key}, blob)
+}
+
+func openObject(o blobObject, blob database.SnapshotBlob) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(o.Key)
+	if err != nil {
+		return nil, err
+	}
+	content, err := openBlob(blob.Data, key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s failed: %w", o.Path, err)
+	}
+	if !bytes.Equal(blobKey(content), key) {
+		return nil, fmt.Errorf("blob %s for %s: %w", o.Blob, o.Path, errBlobMismatch)
+	}
+	return content, nil
+}
+
+// store seals the resources into record and saves it with its blobs.
+func (s *Service) store(record *database.SnapshotRecord, manifest SnapshotManifest, resources []ResourceContent, password string) error {
+	blobs, err := s.seal(record, manifest, resources, nil, password)
+	if err != nil {
+		return err
+	}
+	return s.repo.CreateWithBlobs(record, blobs)
+}
+
+// MigrateResult reports the outcome of MigrateLegacy.
+type MigrateResult struct {
+	Migrated   []string `json:"migrated"`
+	Skipped    []string `json:"skipped"` // not opened by the password
+	SavedBytes int64    `json:"saved_bytes"`
+}
+
+// MigrateLegacy converts the version 1 snapshots that password opens to
+// content-addressed storage, keeping their IDs, notes and dates. Snapshots
+// sealed with another password are skipped and can be migrated with theirs.
+func (s *Service) MigrateLegacy(password string) (*MigrateResult, error) {
+	records, err := s.repo.ListByVersion(SnapshotVersion1)
+	if err != nil {
+		return nil, err
+	}
+	before, err := s.physicalSize()
+	if err != nil {
+		return nil, err
+	}
+	result := &MigrateResult{Migrated: []string{}, Skipped: []string{}}
+	for i := range records {
+		old := &records[i]
+		manifest, files, err := s.openSnapshot(old, password)
+		if err != nil {
+			result.Skipped = append(result.Skipped, old.SnapshotID)
+			continue
+		}
+		resources := make([]ResourceContent, 0, len(manifest.Resources))
+		for _, mr := range manifest.Resources {
+			content, ok := files[mr.LogicalPath]
+			if !ok {
+				continue
+			}
+			resources = append(resources, ResourceContent{Definition: ResourceDefinition{ID: mr.ID, LogicalPath: mr.LogicalPath}, Content: content})
+		}
+		rec := &database.SnapshotRecord{
+			SnapshotID:          old.SnapshotID,
+			Note:                old.Note,
+			Trigger:             old.Trigger,
+			ScheduleID:          old.ScheduleID,
+			ResourceCount:       old.ResourceCount,
+			ResourceTypesJSON:   old.ResourceTypesJSON,
+			ManifestSummaryJSON: old.ManifestSummaryJSON,
+			CreatedAt:           old.CreatedAt,
+		}
+		blobs, err := s.seal(rec, manifest, resources, nil, password)
+		if err != nil {
+			return result, err
+		}
+		if err := s.repo.ReplaceWithBlobs(rec, blobs); err != nil {
+			return result, err
+		}
+		result.Migrated = append(result.Migrated, old.SnapshotID)
+	}
+	if after, err := s.physicalSize(); err == nil {
+		result.SavedBytes = before - after
+	}
+	return result, nil
+}
+
+// physicalSize is the space snapshots take in the database: index or legacy
+// ciphertext on snapshot rows plus every stored blob.
+func (s *Service) physicalSize() (int64, error) {
+	rows, err := s.repo.CiphertextBytes()
+	if err != nil {
+		return 0, err
+	}
+	_, blobs, err := s.blobs.Usage()
+	if err != nil {
+		return 0, err
+	}
+	return rows + blobs, nil
+}
@@ -0,0 +1,208 @@
+package snapshots
+
+import (
+	"bytes"
+	"compress/flate"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassword = "correct horse"
+
+// exportClawbak writes a snapshot's .clawbak file to memory.
+func exportClawbak(t *testing.T, svc *Service, snapshotID string) []byte {
+	t.Helper()
+	exp, err := svc.PrepareClawbak(snapshotID)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	n, err := exp.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, exp.Size, n)
+	return buf.Bytes()
+}
+
+func testResources(files map[string]string) []ResourceContent {
+	var out []ResourceContent
+	for path, content := range files {
+		out = append(out, ResourceContent{
+			Definition: ResourceDefinition{ID: path, Type: "document", LogicalPath: path, RestoreMode: RestoreModeFile},
+			Content:    []byte(content),
+		})
+	}
+	return out
+}
+
+func storeTestSnapshot(t *testing.T, svc *Service, files map[string]string) *database.SnapshotRecord {
+	t.Helper()
+	resources := testResources(files)
+	manifest, err := buildManifest(resources)
+	require.NoError(t, err)
+	rec := &database.SnapshotRecord{SnapshotID: newSnapshotID(), Trigger: DefaultSnapshotTag, ResourceCount: len(resources)}
+	require.NoError(t, svc.store(rec, manifest, resources, testPassword))
+	return rec
+}
+
+func TestBlobStore_DeduplicatesAndCollects(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	svc := NewService()
+	blobs := database.NewSnapshotBlobRepo()
+	first := storeTestSnapshot(t, svc, map[string]string{
+		"files/agents/main/AGENTS.md": "agent instructions",
+		"files/agents/main/SOUL.md":   "persona",
+	})
+	second := storeTestSnapshot(t, svc, map[string]string{
+		"files/agents/main/AGENTS.md": "agent instructions, edited",
+		"files/agents/main/SOUL.md":   "persona",
+	})
+	count, _, err := blobs.Usage()
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	stats, err := svc.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, first.SizeBytes+second.SizeBytes, stats.LogicalSizeBytes)
+	assert.Less(t, stats.PhysicalSizeBytes, stats.LogicalSizeBytes)
+	assert.Zero(t, stats.LegacyCount)
+
+	manifest, files, err := svc.openSnapshot(first, testPassword)
+	require.NoError(t, err)
+	assert.Len(t, manifest.Resources, 2)
+	assert.Equal(t, "agent instructions", string(files["files/agents/main/AGENTS.md"]))
+
+	_, _, err = svc.openSnapshot(first, "wrong password")
+	assert.Error(t, err)
+
+	// Deleting the first snapshot drops only the blob nothing else uses.
+	require.NoError(t, svc.Delete(first.SnapshotID))
+	count, _, err = blobs.Usage()
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, count)
+	_, files, err = svc.openSnapshot(second, testPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "persona", string(files["files/agents/main/SOUL.md"]))
+
+	require.NoError(t, svc.Delete(second.SnapshotID))
+	count, _, err = blobs.Usage()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestBlobStore_ExportImportRoundTrip(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	svc := NewService()
+	rec := storeTestSnapshot(t, svc, map[string]string{
+		"files/agents/main/AGENTS.md": "agent instructions",
+		"files/personas/a.md":         "persona",
+	})
+	data := exportClawbak(t, svc, rec.SnapshotID)
+	require.NoError(t, svc.Delete(rec.SnapshotID))
+
+	header, payload, err := DecodeClawbak(data)
+	require.NoError(t, err)
+	imported, err := svc.ImportSnapshot(header, payload)
+	require.NoError(t, err)
+	assert.Equal(t, rec.SnapshotID, imported.SnapshotID)
+	assert.Equal(t, SnapshotVersion3, imported.SnapshotVersion)
+
+	_, files, err := svc.openSnapshot(imported, testPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "persona", string(files["files/personas/a.md"]))
+
+	// A truncated file is rejected rather than stored with missing blobs.
+	require.NoError(t, svc.Delete(rec.SnapshotID))
+	_, err = svc.ImportSnapshot(header, payload[:len(payload)-1])
+	assert.Error(t, err)
+}
+
+// forgeBlob seals content under a key that belongs to other content, as a
+// crafted backup could to plant data under a known blob ID.
+func forgeBlob(t *testing.T, key []byte, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+	gcm, err := blobCipher(key)
+	require.NoError(t, err)
+	return gcm.Seal(nil, make([]byte, gcm.NonceSize()), buf.Bytes(), nil)
+}
+
+func TestBlobStore_ReportsAndRepairsMismatchedBlobs(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	svc := NewService()
+	rec := storeTestSnapshot(t, svc, map[string]string{"files/agents/main/SOUL.md": "persona"})
+	key := blobKey([]byte("persona"))
+	forged := forgeBlob(t, key, "forged persona")
+	require.NoError(t, database.DB.Model(&database.SnapshotBlob{}).Where("blob_id = ?", blobIDForKey(key)).Update("data", forged).Error)
+
+	res, err := svc.VerifyIntegrity(rec.SnapshotID, testPassword)
+	require.NoError(t, err)
+	assert.False(t, res.OK)
+	assert.Contains(t, res.Error, "does not match its content")
+	_, _, err = svc.openSnapshot(rec, testPassword)
+	assert.ErrorIs(t, err, errBlobMismatch)
+
+	// The next snapshot of the same content replaces the planted blob.
+	storeTestSnapshot(t, svc, map[string]string{"files/agents/main/SOUL.md": "persona"})
+	res, err = svc.VerifyIntegrity(rec.SnapshotID, testPassword)
+	require.NoError(t, err)
+	assert.True(t, res.OK, res.Error)
+}
+
+func TestBlobStore_MigratesLegacySnapshots(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	svc := NewService()
+	legacy := func(id, password string) {
+		resources := testResources(map[string]string{"files/agents/main/AGENTS.md": "shared", "files/personas/" + id: id})
+		manifest, err := buildManifest(resources)
+		require.NoError(t, err)
+		bundle, err := packBundle(manifest, resources)
+		require.NoError(t, err)
+		kdf, salt, dek, wrapNonce, dataNonce, ct, err := encryptBundleWithEnvelope(password, bundle)
+		require.NoError(t, err)
+		require.NoError(t, database.NewSnapshotRepo().Create(&database.SnapshotRecord{
+			SnapshotID: id, SnapshotVersion: SnapshotVersion1, Note: "old", Trigger: DefaultSnapshotTag, ResourceCount: 2,
+			SizeBytes: int64(len(ct)), CipherAlg: "aes-256-gcm", KDFAlg: "argon2id", KDFParamsJSON: kdf, SaltB64: salt,
+			WrappedDEKB64: dek, WrapNonceB64: wrapNonce, DataNonceB64: dataNonce, Ciphertext: ct,
+		}))
+	}
+	legacy("snap_one", testPassword)
+	legacy("snap_two", testPassword)
+	legacy("snap_other", "another password")
+
+	result, err := svc.MigrateLegacy(testPassword)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"snap_one", "snap_two"}, result.Migrated)
+	assert.Equal(t, []string{"snap_other"}, result.Skipped)
+
+	rec, err := database.NewSnapshotRepo().FindBySnapshotID("snap_one")
+	require.NoError(t, err)
+	assert.Equal(t, SnapshotVersion3, rec.SnapshotVersion)
+	assert.Equal(t, "old", rec.Note)
+	_, files, err := svc.openSnapshot(rec, testPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", string(files["files/agents/main/AGENTS.md"]))
+
+	count, _, err := database.NewSnapshotBlobRepo().Usage()
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, count)
+
+	stats, err := svc.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.LegacyCount)
+}
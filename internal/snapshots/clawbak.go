@@ -0,0 +1,312 @@
+package snapshots
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"ClawDeckX/internal/database"
+)
+
+// ClawbakExt is the file extension of exported snapshots.
+const ClawbakExt = ".clawbak"
+
+// ClawbakName is the file name an exported snapshot is saved under.
+func ClawbakName(rec *database.SnapshotRecord) string {
+	return "backup-" + rec.CreatedAt.UTC().Format("2006-01-02_150405") + "-" + rec.SnapshotID + ClawbakExt
+}
+
+// clawbakBlob describes a blob carried in a version 2 .clawbak file.
+type clawbakBlob struct {
+	ID          string `json:"id"`
+	SizeBytes   int64  `json:"sizeBytes"`
+	StoredBytes int64  `json:"storedBytes"`
+}
+
+// maxClawbakHeaderBytes bounds the header read before a .clawbak payload.
+const maxClawbakHeaderBytes = 16 << 20
+
+// clawbakHeader is the JSON header of a .clawbak file.
+type clawbakHeader struct {
+	Version    int    `json:"version"`
+	SnapshotID string `json:"snapshotId"`
+	Note       string `json:"note"`
+	Trigger    string `json:"trigger"`
+	CipherAlg  string `json:"cipherAlg"`
+	KDFAlg     string `json:"kdfAlg"`
+	KDFParams  string `json:"kdfParams"`
+	Salt       string `json:"salt"`
+	WrappedDEK string `json:"wrappedDEK"`
+	WrapNonce  string `json:"wrapNonce"`
+	DataNonce  string `json:"dataNonce"`
+	KeySlots   string `json:"keySlots,omitempty"`
+	ResCount   int    `json:"resourceCount"`
+	SizeBytes  int64  `json:"sizeBytes"`
+
+	ManifestSummary string        `json:"manifestSummary,omitempty"`
+	ResourceTypes   string        `json:"resourceTypes,omitempty"`
+	CiphertextBytes int64         `json:"ciphertextBytes,omitempty"`
+	Blobs           []clawbakBlob `json:"blobs,omitempty"`
+}
+
+// ClawbakExport is a snapshot ready to be written as a .clawbak file:
+// 8 bytes big-endian header length + header JSON + ciphertext.
+// The ciphertext stays encrypted with the snapshot's password envelope.
+// Content-addressed snapshots append the blobs they reference after the
+// ciphertext, so the file stays self-contained.
+type ClawbakExport struct {
+	Record *database.SnapshotRecord
+	Size   int64 // size of the whole file
+
+	svc    *Service
+	header []byte
+	blobs  []clawbakBlob
+}
+
+// PrepareClawbak looks up what exporting a snapshot writes, without
+// reading its blobs yet.
+func (s *Service) PrepareClawbak(snapshotID string) (*ClawbakExport, error) {
+	rec, err := s.repo.FindBySnapshotID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	h := clawbakHeader{
+		Version:    rec.SnapshotVersion,
+		SnapshotID: rec.SnapshotID,
+		Note:       rec.Note,
+		Trigger:    rec.Trigger,
+		CipherAlg:  rec.CipherAlg,
+		KDFAlg:     rec.KDFAlg,
+		KDFParams:  rec.KDFParamsJSON,
+		Salt:       rec.SaltB64,
+		WrappedDEK: rec.WrappedDEKB64,
+		WrapNonce:  rec.WrapNonceB64,
+		DataNonce:  rec.DataNonceB64,
+		KeySlots:   rec.KeySlotsJSON,
+		ResCount:   rec.ResourceCount,
+		SizeBytes:  rec.SizeBytes,
+	}
+	if rec.ManifestSummaryJSON != "" {
+		h.ManifestSummary = rec.ManifestSummaryJSON
+		h.ResourceTypes = rec.ResourceTypesJSON
+	}
+	size := int64(len(rec.Ciphertext))
+	if rec.SnapshotVersion >= SnapshotVersion2 {
+		meta, err := s.blobs.ListMetaBySnapshot(snapshotID)
+		if err != nil {
+			return nil, err
+		}
+		h.CiphertextBytes = int64(len(rec.Ciphertext))
+		h.Blobs = make([]clawbakBlob, 0, len(meta))
+		for _, b := range meta {
+			h.Blobs = append(h.Blobs, clawbakBlob{ID: b.BlobID, SizeBytes: b.SizeBytes, StoredBytes: b.StoredBytes})
+			size += b.StoredBytes
+		}
+	}
+	headerJSON, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return &ClawbakExport{
+		Record: rec,
+		Size:   8 + int64(len(headerJSON)) + size,
+		svc:    s,
+		header: headerJSON,
+		blobs:  h.Blobs,
+	}, nil
+}
+
+// WriteTo writes the .clawbak file to w, reading one blob at a time.
+func (e *ClawbakExport) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	write := func(b []byte) error {
+		written, err := w.Write(b)
+		n += int64(written)
+		return err
+	}
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, uint64(len(e.header)))
+	for _, b := range [][]byte{prefix, e.header, e.Record.Ciphertext} {
+		if err := write(b); err != nil {
+			return n, err
+		}
+	}
+	for _, b := range e.blobs {
+		stored, err := e.svc.blobs.GetMany([]string{b.ID})
+		if err != nil {
+			return n, err
+		}
+		blob, ok := stored[b.ID]
+		if !ok || int64(len(blob.Data)) != b.StoredBytes {
+			return n, fmt.Errorf("blob %s changed during export", b.ID)
+		}
+		if err := write(blob.Data); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// DecodeClawbak splits a .clawbak file into its header JSON and payload
+// (the ciphertext, followed by blobs for version 2 files).
+func DecodeClawbak(data []byte) (headerJSON, payload []byte, err error) {
+	if len(data) < 8 {
+		return nil, nil, errors.New("invalid backup file: too small")
+	}
+	headerLen := binary.BigEndian.Uint64(data)
+	if headerLen == 0 || headerLen > uint64(len(data)-8) {
+		return nil, nil, errors.New("invalid backup file format")
+	}
+	return data[8 : 8+headerLen], data[8+headerLen:], nil
+}
+
+// ImportClawbak imports a .clawbak file read from r. Blobs are stored as
+// they arrive, so the file never has to fit in memory; progressFn, if not
+// nil, is told about each one.
+func (s *Service) ImportClawbak(r io.Reader, progressFn ProgressFn) (*database.SnapshotRecord, error) {
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, errors.New("invalid backup file: too small")
+	}
+	headerLen := binary.BigEndian.Uint64(prefix)
+	if headerLen == 0 || headerLen > maxClawbakHeaderBytes {
+		return nil, errors.New("invalid backup file format")
+	}
+	headerJSON, err := readExactly(r, int64(headerLen), "header")
+	if err != nil {
+		return nil, err
+	}
+	return s.importClawbak(headerJSON, r, progressFn)
+}
+
+// importClawbak stores the snapshot described by headerJSON, reading its
+// payload from r: the ciphertext, then for version 2 files each blob in
+// the order the header lists them.
+func (s *Service) importClawbak(headerJSON []byte, r io.Reader, progressFn ProgressFn) (*database.SnapshotRecord, error) {
+	if progressFn == nil {
+		progressFn = func(RestoreProgressEvent) {}
+	}
+	existing, _ := s.repo.List()
+	if len(existing) >= MaxSnapshotCount {
+		return nil, fmt.Errorf("snapshot limit reached (%d), please delete old snapshots first", MaxSnapshotCount)
+	}
+	var h clawbakHeader
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, fmt.Errorf("invalid backup file header: %w", err)
+	}
+	if h.CipherAlg == "" || h.Salt == "" || h.WrappedDEK == "" {
+		return nil, errors.New("invalid backup file: missing encryption fields")
+	}
+	// Avoid duplicate import by snapshot ID
+	if h.SnapshotID != "" {
+		if _, err := s.repo.FindBySnapshotID(h.SnapshotID); err == nil {
+			return nil, errors.New("this backup has already been imported")
+		}
+	}
+	var ciphertext []byte
+	var err error
+	if h.Version >= SnapshotVersion2 {
+		if h.CiphertextBytes <= 0 || h.CiphertextBytes > MaxSnapshotSizeBytes {
+			return nil, errors.New("invalid backup file: bad ciphertext length")
+		}
+		ciphertext, err = readExactly(r, h.CiphertextBytes, "ciphertext")
+	} else {
+		if len(h.Blobs) > 0 {
+			return nil, errors.New("invalid backup file: unexpected blobs")
+		}
+		ciphertext, err = io.ReadAll(io.LimitReader(r, MaxSnapshotSizeBytes+1))
+		if err == nil && int64(len(ciphertext)) > MaxSnapshotSizeBytes {
+			err = fmt.Errorf("import file too large (max %d MB)", MaxSnapshotSizeBytes/(1024*1024))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	total := int64(len(ciphertext))
+	for _, b := range h.Blobs {
+		if len(b.ID) != 64 || !isHex(b.ID) {
+			return nil, fmt.Errorf("invalid backup file: bad blob id %q", b.ID)
+		}
+		if b.StoredBytes <= 0 || b.StoredBytes > MaxSnapshotSizeBytes {
+			return nil, errors.New("invalid backup file: bad blob length")
+		}
+		if total += b.StoredBytes; total > MaxBundleBytes {
+			return nil, fmt.Errorf("import file too large (max %d MB)", MaxBundleBytes/(1024*1024))
+		}
+	}
+
+	snapshotID := h.SnapshotID
+	if snapshotID == "" {
+		snapshotID = newSnapshotID()
+	}
+	record := &database.SnapshotRecord{
+		SnapshotID:      snapshotID,
+		SnapshotVersion: h.Version,
+		Note:            h.Note,
+		Trigger:         "import",
+		ResourceCount:   h.ResCount,
+		SizeBytes:       total,
+
+		ManifestSummaryJSON: h.ManifestSummary,
+		ResourceTypesJSON:   h.ResourceTypes,
+		CipherAlg:           h.CipherAlg,
+		KDFAlg:              h.KDFAlg,
+		KDFParamsJSON:       h.KDFParams,
+		SaltB64:             h.Salt,
+		WrappedDEKB64:       h.WrappedDEK,
+		WrapNonceB64:        h.WrapNonce,
+		DataNonceB64:        h.DataNonce,
+		KeySlotsJSON:        h.KeySlots,
+		Ciphertext:          ciphertext,
+	}
+	if err := s.importBlobs(snapshotID, h.Blobs, r, progressFn); err != nil {
+		_ = s.repo.DeleteBySnapshotID(snapshotID)
+		return nil, err
+	}
+	if err := s.repo.Create(record); err != nil {
+		_ = s.repo.DeleteBySnapshotID(snapshotID)
+		return nil, err
+	}
+	progressFn(RestoreProgressEvent{Phase: "done", Current: len(h.Blobs), Total: len(h.Blobs), Bytes: total})
+	return record, nil
+}
+
+// importBlobs reads the blobs of a .clawbak payload from r and stores
+// those not already present, referenced by snapshotID. Their keys are in
+// the sealed index, so the data cannot be checked here: a blob that does not
+// match its ID fails verify and restore, and is replaced the next time a
+// snapshot stores its content (see seal and putChunk).
+func (s *Service) importBlobs(snapshotID string, list []clawbakBlob, r io.Reader, progressFn ProgressFn) error {
+	var done int64
+	for i, b := range list {
+		data, err := readExactly(r, b.StoredBytes, "blob data")
+		if err != nil {
+			return err
+		}
+		done += b.StoredBytes
+		progressFn(RestoreProgressEvent{Phase: "import", Current: i + 1, Total: len(list), File: b.ID, Bytes: done})
+		_, ok, err := s.blobs.Ref(snapshotID, b.ID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		blob := database.SnapshotBlob{BlobID: b.ID, SizeBytes: b.SizeBytes, StoredBytes: b.StoredBytes, Data: data}
+		if err := s.blobs.Put(&blob); err != nil {
+			return err
+		}
+	}
+	if n, _ := io.ReadFull(r, make([]byte, 1)); n > 0 {
+		return errors.New("invalid backup file: trailing data")
+	}
+	return nil
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
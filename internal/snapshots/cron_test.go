@@ -0,0 +1,66 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "x * * * *", "@often"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	base := time.Date(2026, 3, 14, 10, 17, 30, 0, time.UTC) // Saturday
+	cases := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 3, 15, 3, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 3, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"30 2 1 * *", time.Date(2026, 4, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 20th or any Monday, whichever is first.
+		{"0 0 20 * 1", time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)},
+		// A stepped "*/n" day field still counts as unrestricted, so both must match:
+		// an odd day that is a Monday, and the 20th on an even weekday.
+		{"0 0 */2 * 1", time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * */2", time.Date(2026, 6, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		require.NoError(t, err, c.expr)
+		assert.Equal(t, c.want, cron.Next(base), c.expr)
+	}
+
+	never, err := ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, never.Next(base).IsZero())
+}
+
+func TestCronSchedule_NextAcrossDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	cron, err := ParseCron("30 2 * * *")
+	require.NoError(t, err)
+	// 02:30 does not exist on 2026-03-29; the run moves to the next valid minute.
+	next := cron.Next(time.Date(2026, 3, 28, 12, 0, 0, 0, loc))
+	assert.True(t, next.After(time.Date(2026, 3, 29, 0, 0, 0, 0, loc)))
+	assert.True(t, next.Before(time.Date(2026, 3, 30, 3, 0, 0, 0, loc)))
+
+	runs := cron.NextN(time.Date(2026, 3, 25, 0, 0, 0, 0, loc), 7)
+	assert.Len(t, runs, 7)
+	for i := 1; i < len(runs); i++ {
+		assert.True(t, runs[i].After(runs[i-1]))
+	}
+}
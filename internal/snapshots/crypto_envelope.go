@@ -29,20 +29,44 @@ func deriveKEK(password string, salt []byte, p KDFParams) []byte {
 }
 
 func encryptBundleWithEnvelope(password string, bundle []byte) (kdfJSON string, saltB64, wrappedDEKB64, wrapNonceB64, dataNonceB64 string, ciphertext []byte, err error) {
-	params := defaultKDFParams()
-	salt := make([]byte, 16)
-	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+	dek, err := newDEK()
+	if err != nil {
 		return
 	}
-	kek := deriveKEK(password, salt, params)
-	dek := make([]byte, 32)
-	if _, err = io.ReadFull(rand.Reader, dek); err != nil {
+	ciphertext, dataNonce, err := aesGCMEncrypt(dek, bundle)
+	if err != nil {
 		return
 	}
-	ciphertext, dataNonce, err := aesGCMEncrypt(dek, bundle)
+	if kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, err = wrapDEK(password, dek, defaultKDFParams()); err != nil {
+		return
+	}
+	dataNonceB64 = base64.StdEncoding.EncodeToString(dataNonce)
+	return
+}
+
+func decryptBundleWithEnvelope(password, kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, dataNonceB64 string, ciphertext []byte) ([]byte, error) {
+	dek, err := unwrapDEK(password, kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64)
 	if err != nil {
+		return nil, err
+	}
+	return decryptWithDEK(dek, dataNonceB64, ciphertext)
+}
+
+func newDEK() ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	return dek, nil
+}
+
+// wrapDEK encrypts dek under a key derived from password with a fresh salt.
+func wrapDEK(password string, dek []byte, params KDFParams) (kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64 string, err error) {
+	salt := make([]byte, 16)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
 		return
 	}
+	kek := deriveKEK(password, salt, params)
 	wrappedDEK, wrapNonce, err := aesGCMEncrypt(kek, dek)
 	if err != nil {
 		return
@@ -52,11 +76,10 @@ func encryptBundleWithEnvelope(password string, bundle []byte) (kdfJSON string,
 	saltB64 = base64.StdEncoding.EncodeToString(salt)
 	wrappedDEKB64 = base64.StdEncoding.EncodeToString(wrappedDEK)
 	wrapNonceB64 = base64.StdEncoding.EncodeToString(wrapNonce)
-	dataNonceB64 = base64.StdEncoding.EncodeToString(dataNonce)
 	return
 }
 
-func decryptBundleWithEnvelope(password, kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, dataNonceB64 string, ciphertext []byte) ([]byte, error) {
+func unwrapDEK(password, kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64 string) ([]byte, error) {
 	var p KDFParams
 	if err := json.Unmarshal([]byte(kdfJSON), &p); err != nil {
 		return nil, err
@@ -73,15 +96,19 @@ func decryptBundleWithEnvelope(password, kdfJSON, saltB64, wrappedDEKB64, wrapNo
 	if err != nil {
 		return nil, err
 	}
-	dataNonce, err := base64.StdEncoding.DecodeString(dataNonceB64)
-	if err != nil {
-		return nil, err
-	}
 	kek := deriveKEK(password, salt, p)
 	dek, err := aesGCMDecrypt(kek, wrappedDEK, wrapNonce)
 	if err != nil {
 		return nil, fmt.Errorf("unwrap dek failed: %w", err)
 	}
+	return dek, nil
+}
+
+func decryptWithDEK(dek []byte, dataNonceB64 string, ciphertext []byte) ([]byte, error) {
+	dataNonce, err := base64.StdEncoding.DecodeString(dataNonceB64)
+	if err != nil {
+		return nil, err
+	}
 	bundle, err := aesGCMDecrypt(dek, ciphertext, dataNonce)
 	if err != nil {
 		return nil, fmt.Errorf("decrypt bundle failed: %w", err)
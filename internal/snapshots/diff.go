@@ -0,0 +1,397 @@
+package snapshots
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change states reported by Diff and Timeline.
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeChanged   = "changed"
+	ChangeUnchanged = "unchanged"
+	ChangeUnknown   = "unknown" // legacy snapshot without per-file fingerprints
+)
+
+// LiveSide names the current state in a diff.
+const LiveSide = "live"
+
+const configLogicalPath = "files/config/openclaw.json"
+
+// SnapshotDiff compares two snapshots, or a snapshot and the live state.
+type SnapshotDiff struct {
+	From      string              `json:"from"` // snapshot ID or "live"
+	To        string              `json:"to"`
+	Summary   DiffSummary         `json:"summary"`
+	Resources []ResourceChange    `json:"resources"`
+	Config    []ConfigFieldChange `json:"config_fields,omitempty"`
+}
+
+type DiffSummary struct {
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// ResourceChange is the change of one logical path. Diff holds a unified
+// diff for text files; DiffOmitted explains why it is missing otherwise.
+type ResourceChange struct {
+	LogicalPath string `json:"logical_path"`
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Status      string `json:"status"`
+	FromSize    int64  `json:"from_size"`
+	ToSize      int64  `json:"to_size"`
+	FromSHA256  string `json:"from_sha256,omitempty"`
+	ToSHA256    string `json:"to_sha256,omitempty"`
+	Diff        string `json:"diff,omitempty"`
+	DiffOmitted string `json:"diff_omitted,omitempty"` // "binary" or "too_large"
+}
+
+// ConfigFieldChange is a field-level change in openclaw.json. Values are
+// only set for scalar fields.
+type ConfigFieldChange struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	FromKind  string `json:"from_kind,omitempty"`
+	ToKind    string `json:"to_kind,omitempty"`
+	FromValue any    `json:"from_value"`
+	ToValue   any    `json:"to_value"`
+}
+
+// TimelineEntry is a snapshot in which a logical path changed.
+type TimelineEntry struct {
+	SnapshotID string    `json:"snapshot_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Note       string    `json:"note"`
+	Trigger    string    `json:"trigger"`
+	Status     string    `json:"status"`
+	ContentID  string    `json:"content_id,omitempty"` // equal IDs mean equal content
+}
+
+type diffSide struct {
+	label    string
+	manifest SnapshotManifest
+	files    map[string][]byte
+	load     func(path string) []byte // files not in files, such as tree files
+}
+
+func (d diffSide) content(path string) []byte {
+	if b, ok := d.files[path]; ok || d.load == nil {
+		return b
+	}
+	return d.load(path)
+}
+
+// Diff compares the unlocked snapshot behind fromToken with the one behind
+// toToken, or with the live state when toToken is empty. paths limits the
+// comparison to the given logical paths.
+func (s *Service) Diff(fromToken, toToken string, paths []string) (*SnapshotDiff, error) {
+	from, err := s.tokenSide(fromToken)
+	if err != nil {
+		return nil, err
+	}
+	var to diffSide
+	if toToken == "" {
+		to, err = s.liveSide()
+	} else {
+		to, err = s.tokenSide(toToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return diffSides(from, to, paths), nil
+}
+
+func (s *Service) tokenSide(token string) (diffSide, error) {
+	ub, err := s.getToken(token)
+	if err != nil {
+		return diffSide{}, err
+	}
+	load := func(path string) []byte {
+		b, _, _ := s.bundleFile(ub, path)
+		return b
+	}
+	return diffSide{label: ub.SnapshotID, manifest: ub.Manifest, files: ub.Files, load: load}, nil
+}
+
+func (s *Service) liveSide() (diffSide, error) {
+	resources, err := s.collectResources(nil)
+	if err != nil {
+		return diffSide{}, err
+	}
+	manifest, err := buildManifest(resources)
+	if err != nil {
+		return diffSide{}, err
+	}
+	files := make(map[string][]byte, len(resources))
+	for _, r := range resources {
+		files[r.Definition.LogicalPath] = r.Content
+	}
+	// Tree files are hashed now and read again only if a diff needs them.
+	cfg := s.TreeConfig()
+	for _, src := range s.selectTrees(nil) {
+		tm, err := walkTree(src, cfg.forType(src.Type), func(rel string, r io.Reader) error {
+			h := sha256.New()
+			n, err := io.Copy(h, r)
+			if err != nil {
+				return err
+			}
+			manifest.Resources = append(manifest.Resources, ManifestResource{
+				ID: src.ID + ":" + rel, Type: src.Type, DisplayName: rel, LogicalPath: treeLogicalPath(src.ID, rel),
+				RestoreMode: RestoreModeFile, Size: n, SHA256: hex.EncodeToString(h.Sum(nil)),
+			})
+			return nil
+		})
+		if err != nil {
+			return diffSide{}, err
+		}
+		manifest.Trees = append(manifest.Trees, tm)
+	}
+	load := func(path string) []byte {
+		b, _ := os.ReadFile(treeFilePath(path))
+		return b
+	}
+	return diffSide{label: LiveSide, manifest: manifest, files: files, load: load}, nil
+}
+
+func diffSides(from, to diffSide, paths []string) *SnapshotDiff {
+	only := map[string]bool{}
+	for _, p := range paths {
+		only[p] = true
+	}
+	fromRes := map[string]ManifestResource{}
+	toRes := map[string]ManifestResource{}
+	var all []string
+	for _, r := range from.manifest.Resources {
+		fromRes[r.LogicalPath] = r
+		all = append(all, r.LogicalPath)
+	}
+	for _, r := range to.manifest.Resources {
+		if _, ok := fromRes[r.LogicalPath]; !ok {
+			all = append(all, r.LogicalPath)
+		}
+		toRes[r.LogicalPath] = r
+	}
+	sort.Strings(all)
+
+	out := &SnapshotDiff{From: from.label, To: to.label, Resources: []ResourceChange{}}
+	for _, path := range all {
+		if len(only) > 0 && !only[path] {
+			continue
+		}
+		fr, inFrom := fromRes[path]
+		tr, inTo := toRes[path]
+		c := ResourceChange{LogicalPath: path}
+		switch {
+		case !inTo:
+			c.Status = ChangeRemoved
+			out.Summary.Removed++
+		case !inFrom:
+			c.Status = ChangeAdded
+			out.Summary.Added++
+		case fr.SHA256 != tr.SHA256:
+			c.Status = ChangeChanged
+			out.Summary.Changed++
+		default:
+			c.Status = ChangeUnchanged
+			out.Summary.Unchanged++
+		}
+		if inFrom {
+			c.ID, c.Type, c.FromSize, c.FromSHA256 = fr.ID, fr.Type, fr.Size, fr.SHA256
+		}
+		if inTo {
+			c.ID, c.Type, c.ToSize, c.ToSHA256 = tr.ID, tr.Type, tr.Size, tr.SHA256
+		}
+		if c.Status != ChangeUnchanged {
+			c.Diff, c.DiffOmitted = textDiff(path, from, to)
+		}
+		out.Resources = append(out.Resources, c)
+	}
+	if len(only) == 0 || only[configLogicalPath] {
+		out.Config = diffConfigFields(from, to)
+	}
+	return out
+}
+
+func textDiff(path string, from, to diffSide) (diff, omitted string) {
+	a, b := from.content(path), to.content(path)
+	if !isTextContent(a) || !isTextContent(b) {
+		return "", "binary"
+	}
+	if len(a) > maxDiffBytes || len(b) > maxDiffBytes {
+		return "", "too_large"
+	}
+	d, ok := unifiedDiff(from.label+"/"+path, to.label+"/"+path, string(a), string(b))
+	if !ok {
+		return "", "too_large"
+	}
+	return d, ""
+}
+
+// diffConfigFields compares the openclaw.json field hashes of both sides.
+// Changed containers are left out in favour of the fields that changed in
+// them, and an added or removed subtree is reported once at its root.
+func diffConfigFields(from, to diffSide) []ConfigFieldChange {
+	if len(from.manifest.ConfigFields) == 0 && len(to.manifest.ConfigFields) == 0 {
+		return nil
+	}
+	fromFields := map[string]ConfigFieldEntry{}
+	for _, f := range from.manifest.ConfigFields {
+		fromFields[f.Path] = f
+	}
+	toFields := map[string]ConfigFieldEntry{}
+	for _, f := range to.manifest.ConfigFields {
+		toFields[f.Path] = f
+	}
+	fromValues := configScalars(from.content(configLogicalPath))
+	toValues := configScalars(to.content(configLogicalPath))
+
+	changes := []ConfigFieldChange{}
+	for path, f := range fromFields {
+		if path == "" {
+			continue
+		}
+		t, ok := toFields[path]
+		switch {
+		case !ok:
+			if configSubtreeReplaced(configParent(path), fromFields, toFields) {
+				continue
+			}
+			changes = append(changes, ConfigFieldChange{Path: path, Status: ChangeRemoved, FromKind: f.Kind, FromValue: fromValues[path]})
+		case f.Hash != t.Hash && (f.Kind != t.Kind || !isContainerKind(f.Kind)):
+			changes = append(changes, ConfigFieldChange{Path: path, Status: ChangeChanged, FromKind: f.Kind, ToKind: t.Kind,
+				FromValue: fromValues[path], ToValue: toValues[path]})
+		}
+	}
+	for path, t := range toFields {
+		if path == "" {
+			continue
+		}
+		if _, ok := fromFields[path]; ok {
+			continue
+		}
+		if configSubtreeReplaced(configParent(path), fromFields, toFields) {
+			continue
+		}
+		changes = append(changes, ConfigFieldChange{Path: path, Status: ChangeAdded, ToKind: t.Kind, ToValue: toValues[path]})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// configSubtreeReplaced reports whether the container at parent was added,
+// removed or changed kind, in which case the change is reported there.
+func configSubtreeReplaced(parent string, fromFields, toFields map[string]ConfigFieldEntry) bool {
+	if parent == "" {
+		return false
+	}
+	f, inFrom := fromFields[parent]
+	t, inTo := toFields[parent]
+	return !inFrom || !inTo || f.Kind != t.Kind
+}
+
+func isContainerKind(kind string) bool {
+	return kind == "object" || kind == "array"
+}
+
+// configParent returns the path of the object or array containing path.
+func configParent(path string) string {
+	if strings.HasSuffix(path, "]") {
+		if i := strings.LastIndexByte(path, '['); i >= 0 {
+			return path[:i]
+		}
+	}
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// configScalars maps the path of every scalar field in a JSON config to its
+// value.
+func configScalars(data []byte) map[string]any {
+	out := map[string]any{}
+	var root any
+	if len(data) == 0 || json.Unmarshal(data, &root) != nil {
+		return out
+	}
+	walkConfig("", root, func(path string, v any) {
+		if !isContainerKind(jsonKind(v)) {
+			out[path] = v
+		}
+	})
+	return out
+}
+
+// Timeline lists, newest first, the snapshots in which logicalPath was
+// added, changed or removed compared with the snapshot before. Legacy
+// snapshots that carry no per-file fingerprints are reported as unknown.
+func (s *Service) Timeline(logicalPath string) ([]TimelineEntry, error) {
+	if logicalPath == "" {
+		return nil, errors.New("logical path is required")
+	}
+	records, err := s.repo.ListMeta()
+	if err != nil {
+		return nil, err
+	}
+	entries := []TimelineEntry{}
+	prev, havePrev := "", false
+	for _, r := range records {
+		entry := TimelineEntry{SnapshotID: r.SnapshotID, CreatedAt: r.CreatedAt, Note: r.Note, Trigger: r.Trigger}
+		blobs, ok := resourceBlobs(r.ManifestSummaryJSON)
+		if !ok {
+			entry.Status = ChangeUnknown
+			entries = append(entries, entry)
+			continue
+		}
+		cur := blobs[logicalPath]
+		switch {
+		case cur == prev && (havePrev || cur == ""):
+			havePrev = true
+			continue
+		case cur == "":
+			entry.Status = ChangeRemoved
+		case prev == "":
+			entry.Status = ChangeAdded
+		default:
+			entry.Status = ChangeChanged
+		}
+		if cur != "" {
+			entry.ContentID = contentID(cur)
+		}
+		prev, havePrev = cur, true
+		entries = append(entries, entry)
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// resourceBlobs returns the logical path to blob ID map recorded in a
+// snapshot's manifest summary.
+func resourceBlobs(manifestSummaryJSON string) (map[string]string, bool) {
+	var summary struct {
+		ResourceBlobs map[string]string `json:"resource_blobs"`
+	}
+	if manifestSummaryJSON == "" || json.Unmarshal([]byte(manifestSummaryJSON), &summary) != nil || summary.ResourceBlobs == nil {
+		return nil, false
+	}
+	return summary.ResourceBlobs, true
+}
+
+// contentID is a short display ID for the content stored in a blob.
+func contentID(blobID string) string {
+	h := sha256.Sum256([]byte(blobID))
+	return hex.EncodeToString(h[:6])
+}
@@ -0,0 +1,112 @@
+package snapshots
+
+import (
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSide(t *testing.T, label string, files map[string]string) diffSide {
+	t.Helper()
+	var resources []ResourceContent
+	contents := map[string][]byte{}
+	for path, content := range files {
+		def := ResourceDefinition{ID: path, Type: "document", LogicalPath: path, RestoreMode: RestoreModeFile}
+		if path == configLogicalPath {
+			def.ID = "openclaw.config"
+		}
+		resources = append(resources, ResourceContent{Definition: def, Content: []byte(content)})
+		contents[path] = []byte(content)
+	}
+	manifest, err := buildManifest(resources)
+	require.NoError(t, err)
+	return diffSide{label: label, manifest: manifest, files: contents}
+}
+
+func TestDiffSides(t *testing.T) {
+	from := testSide(t, "snap_a", map[string]string{
+		"files/agents/main/AGENTS.md": "be helpful\n",
+		"files/agents/main/SOUL.md":   "calm\n",
+		"files/config/.env":           "A=1\n",
+		configLogicalPath:             `{"gateway":{"port":18789,"bind":"loopback"},"agents":{"list":[{"id":"main"}]}}`,
+	})
+	to := testSide(t, LiveSide, map[string]string{
+		"files/agents/main/AGENTS.md": "be very helpful\n",
+		"files/config/.env":           "A=1\n",
+		"files/personas/new.md":       "hi\n",
+		configLogicalPath:             `{"gateway":{"port":18790,"bind":"loopback","auth":{"mode":"token"}},"agents":{"list":[]}}`,
+	})
+
+	diff := diffSides(from, to, nil)
+	assert.Equal(t, DiffSummary{Added: 1, Removed: 1, Changed: 2, Unchanged: 1}, diff.Summary)
+
+	byPath := map[string]ResourceChange{}
+	for _, c := range diff.Resources {
+		byPath[c.LogicalPath] = c
+	}
+	assert.Equal(t, ChangeChanged, byPath["files/agents/main/AGENTS.md"].Status)
+	assert.Contains(t, byPath["files/agents/main/AGENTS.md"].Diff, "-be helpful\n+be very helpful\n")
+	assert.Equal(t, ChangeRemoved, byPath["files/agents/main/SOUL.md"].Status)
+	assert.Equal(t, ChangeAdded, byPath["files/personas/new.md"].Status)
+	assert.Equal(t, ChangeUnchanged, byPath["files/config/.env"].Status)
+	assert.Empty(t, byPath["files/config/.env"].Diff)
+
+	fields := map[string]ConfigFieldChange{}
+	for _, c := range diff.Config {
+		fields[c.Path] = c
+	}
+	assert.Len(t, fields, 3, diff.Config)
+	assert.Equal(t, ChangeChanged, fields["gateway.port"].Status)
+	assert.Equal(t, 18789.0, fields["gateway.port"].FromValue)
+	assert.Equal(t, 18790.0, fields["gateway.port"].ToValue)
+	assert.Equal(t, ChangeAdded, fields["gateway.auth"].Status)
+	assert.Equal(t, ChangeRemoved, fields["agents.list[0]"].Status)
+
+	only := diffSides(from, to, []string{"files/config/.env"})
+	assert.Len(t, only.Resources, 1)
+	assert.Empty(t, only.Config)
+}
+
+func TestTimeline(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	svc := NewService()
+	const path = "files/agents/main/AGENTS.md"
+	versions := []map[string]string{
+		{"files/personas/a.md": "a"},
+		{"files/personas/a.md": "a", path: "v1"},
+		{"files/personas/a.md": "b", path: "v1"},
+		{"files/personas/a.md": "b", path: "v2"},
+		{"files/personas/a.md": "b"},
+	}
+	base := time.Now().Add(-time.Hour)
+	var ids []string
+	for i, files := range versions {
+		rec := storeTestSnapshot(t, svc, files)
+		require.NoError(t, database.DB.Model(rec).Update("created_at", base.Add(time.Duration(i)*time.Minute)).Error)
+		ids = append(ids, rec.SnapshotID)
+	}
+
+	entries, err := svc.Timeline(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, ids[4], entries[0].SnapshotID)
+	assert.Equal(t, ChangeRemoved, entries[0].Status)
+	assert.Equal(t, ids[3], entries[1].SnapshotID)
+	assert.Equal(t, ChangeChanged, entries[1].Status)
+	assert.Equal(t, ids[1], entries[2].SnapshotID)
+	assert.Equal(t, ChangeAdded, entries[2].Status)
+	assert.NotEqual(t, entries[1].ContentID, entries[2].ContentID)
+
+	// Legacy snapshots carry no fingerprints.
+	addTestSnapshot(t, "snap_legacy", time.Now())
+	entries, err = svc.Timeline(path)
+	require.NoError(t, err)
+	assert.Equal(t, ChangeUnknown, entries[0].Status)
+}
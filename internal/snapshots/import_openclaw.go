@@ -2,7 +2,6 @@ package snapshots
 
 import (
 	"archive/tar"
-	"bytes"
 	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
@@ -60,9 +59,11 @@ type OpenClawImportResult struct {
 	CreatedAt     string `json:"created_at,omitempty"`
 }
 
-// ImportFromTarGz imports an OpenClaw `.tar.gz` backup archive, re-encrypts it
-// as a ClawDeckX snapshot using the provided password, and stores it.
-func (s *Service) ImportFromTarGz(data []byte, password, note string) (*OpenClawImportResult, error) {
+// ImportFromTarGz imports an OpenClaw `.tar.gz` backup archive read from r,
+// re-encrypts it as a ClawDeckX snapshot using the provided password, and
+// stores it. Archive entries are stored as blobs while they are read, so
+// the archive never has to fit in memory.
+func (s *Service) ImportFromTarGz(r io.Reader, password, note string) (*OpenClawImportResult, error) {
 	if len(password) < 6 {
 		return nil, errors.New("password too short")
 	}
@@ -71,31 +72,45 @@ func (s *Service) ImportFromTarGz(data []byte, password, note string) (*OpenClaw
 		return nil, fmt.Errorf("snapshot limit reached (%d), please delete old snapshots first", MaxSnapshotCount)
 	}
 
-	ocManifest, files, err := parseTarGz(data)
+	snapshotID := newSnapshotID()
+	record, ocManifest, err := s.importTarGz(snapshotID, r, password, note)
 	if err != nil {
-		return nil, fmt.Errorf("invalid OpenClaw backup: %w", err)
-	}
-
-	resources := convertOpenClawToResources(ocManifest, files)
-	if len(resources) == 0 {
-		return nil, errors.New("no importable resources found in the backup archive")
+		_ = s.repo.DeleteBySnapshotID(snapshotID)
+		return nil, err
 	}
+	return &OpenClawImportResult{
+		SnapshotID:    record.SnapshotID,
+		ResourceCount: record.ResourceCount,
+		SizeBytes:     record.SizeBytes,
+		Platform:      ocManifest.Platform,
+		RuntimeVer:    ocManifest.RuntimeVersion,
+		CreatedAt:     ocManifest.CreatedAt,
+	}, nil
+}
 
-	manifest, err := buildManifest(resources)
+// importTarGz stores the files of an OpenClaw archive as blobs of
+// snapshotID and seals them into a new snapshot. On error the caller must
+// drop the snapshot's refs with DeleteBySnapshotID.
+func (s *Service) importTarGz(snapshotID string, r io.Reader, password, note string) (*database.SnapshotRecord, *openclawManifest, error) {
+	ocManifest, entries, err := s.storeTarGz(snapshotID, r)
 	if err != nil {
-		return nil, fmt.Errorf("failed to build manifest: %w", err)
+		return nil, nil, fmt.Errorf("invalid OpenClaw backup: %w", err)
 	}
-	if t, parseErr := time.Parse(time.RFC3339, ocManifest.CreatedAt); parseErr == nil {
-		manifest.CreatedAt = t
+	kept, resources, dropped := convertOpenClawEntries(ocManifest, entries)
+	if len(kept) == 0 {
+		return nil, nil, errors.New("no importable resources found in the backup archive")
+	}
+	if err := s.blobs.Unref(snapshotID, dropped); err != nil {
+		return nil, nil, err
 	}
 
-	bundle, err := packBundle(manifest, resources)
+	manifest, err := buildManifest(nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to pack bundle: %w", err)
+		return nil, nil, fmt.Errorf("failed to build manifest: %w", err)
 	}
-	kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, dataNonceB64, ciphertext, err := encryptBundleWithEnvelope(password, bundle)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	manifest.Resources = resources
+	if t, parseErr := time.Parse(time.RFC3339, ocManifest.CreatedAt); parseErr == nil {
+		manifest.CreatedAt = t
 	}
 
 	summary := map[string]any{
@@ -118,48 +133,48 @@ func (s *Service) ImportFromTarGz(data []byte, password, note string) (*OpenClaw
 	}
 
 	record := &database.SnapshotRecord{
-		SnapshotID:          newSnapshotID(),
-		SnapshotVersion:     SnapshotVersion1,
+		SnapshotID:          snapshotID,
 		Note:                note,
 		Trigger:             "import_openclaw",
 		ResourceCount:       len(manifest.Resources),
 		ResourceTypesJSON:   string(resTypeJSON),
 		ManifestSummaryJSON: string(summaryJSON),
-		SizeBytes:           int64(len(ciphertext)),
-		CipherAlg:           "aes-256-gcm",
-		KDFAlg:              "argon2id",
-		KDFParamsJSON:       kdfJSON,
-		SaltB64:             saltB64,
-		WrappedDEKB64:       wrappedDEKB64,
-		WrapNonceB64:        wrapNonceB64,
-		DataNonceB64:        dataNonceB64,
-		Ciphertext:          ciphertext,
 	}
+	objects := make([]blobObject, 0, len(kept))
+	var stored int64
+	for _, e := range kept {
+		objects = append(objects, e.Object)
+		stored += e.Stored
+	}
+	if _, err := s.seal(record, manifest, nil, objects, password); err != nil {
+		return nil, nil, fmt.Errorf("failed to store backup: %w", err)
+	}
+	record.SizeBytes += stored
 	if err := s.repo.Create(record); err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to store backup: %w", err)
 	}
+	return record, ocManifest, nil
+}
 
-	return &OpenClawImportResult{
-		SnapshotID:    record.SnapshotID,
-		ResourceCount: record.ResourceCount,
-		SizeBytes:     record.SizeBytes,
-		Platform:      ocManifest.Platform,
-		RuntimeVer:    ocManifest.RuntimeVersion,
-		CreatedAt:     ocManifest.CreatedAt,
-	}, nil
+// tarEntry is a regular file of an OpenClaw archive stored by storeTarGz.
+type tarEntry struct {
+	ArchivePath string
+	storedObject
 }
 
-// parseTarGz extracts the OpenClaw manifest and all file contents from a tar.gz archive.
-func parseTarGz(data []byte) (*openclawManifest, map[string][]byte, error) {
-	gr, err := gzip.NewReader(bytes.NewReader(data))
+// storeTarGz reads an OpenClaw tar.gz archive, keeping its manifest and
+// storing every other regular file as blobs of snapshotID.
+func (s *Service) storeTarGz(snapshotID string, r io.Reader) (*openclawManifest, []tarEntry, error) {
+	gr, err := gzip.NewReader(r)
 	if err != nil {
 		return nil, nil, fmt.Errorf("not a valid gzip archive: %w", err)
 	}
 	defer gr.Close()
 
 	tr := tar.NewReader(gr)
-	files := map[string][]byte{}
+	var entries []tarEntry
 	var manifest *openclawManifest
+	var total int64
 
 	for {
 		hdr, err := tr.Next()
@@ -172,62 +187,77 @@ func parseTarGz(data []byte) (*openclawManifest, map[string][]byte, error) {
 		if hdr.Typeflag != tar.TypeReg {
 			continue
 		}
-		if hdr.Size > 100*1024*1024 {
-			continue
-		}
-		content, err := io.ReadAll(io.LimitReader(tr, 100*1024*1024+1))
-		if err != nil {
-			return nil, nil, fmt.Errorf("tar read file error: %w", err)
+		if total += hdr.Size; total > MaxBundleBytes {
+			return nil, nil, fmt.Errorf("archive too large (max %d MB)", MaxBundleBytes/(1024*1024))
 		}
 		name := path.Clean(hdr.Name)
 		if path.Base(name) == "manifest.json" {
 			var m openclawManifest
-			if err := json.Unmarshal(content, &m); err != nil {
+			if err := json.NewDecoder(io.LimitReader(tr, maxClawbakHeaderBytes)).Decode(&m); err != nil {
 				return nil, nil, fmt.Errorf("invalid manifest.json: %w", err)
 			}
 			manifest = &m
-		} else {
-			files[name] = content
+			continue
+		}
+		so, err := s.putObject(snapshotID, name, tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tar read file error: %w", err)
 		}
+		entries = append(entries, tarEntry{ArchivePath: name, storedObject: so})
 	}
 	if manifest == nil {
 		return nil, nil, errors.New("manifest.json not found in archive")
 	}
-	return manifest, files, nil
+	return manifest, entries, nil
 }
 
-// convertOpenClawToResources maps OpenClaw backup assets to ClawDeckX resource content.
-func convertOpenClawToResources(m *openclawManifest, files map[string][]byte) []ResourceContent {
-	var resources []ResourceContent
-
-	for archivePath, content := range files {
-		logicalPath, resType, displayName := classifyOpenClawAsset(archivePath, m)
-		if logicalPath == "" {
+// convertOpenClawEntries maps stored OpenClaw backup files to ClawDeckX
+// logical paths and manifest resources. When several files map to the same
+// logical path the first in archive order wins. It also returns the blobs
+// of files left out, unless a kept file shares them.
+func convertOpenClawEntries(m *openclawManifest, entries []tarEntry) ([]tarEntry, []ManifestResource, []string) {
+	var out []tarEntry
+	var resources []ManifestResource
+	kept := map[string]bool{}
+	blobsKept := map[string]bool{}
+	var left []blobObject
+	for _, e := range entries {
+		logicalPath, resType, displayName := classifyOpenClawAsset(e.ArchivePath, m)
+		if logicalPath == "" || kept[logicalPath] {
+			left = append(left, e.Object)
 			continue
 		}
+		kept[logicalPath] = true
 
 		restoreMode := RestoreModeFile
 		if logicalPath == "files/config/openclaw.json" {
 			restoreMode = RestoreModeJSON
 		}
-
-		resources = append(resources, ResourceContent{
-			Definition: ResourceDefinition{
-				ID:          logicalPath,
-				Type:        resType,
-				DisplayName: displayName,
-				LogicalPath: logicalPath,
-				RestoreMode: restoreMode,
-			},
-			Path:    archivePath,
-			Content: content,
+		e.Object.Path = logicalPath
+		out = append(out, e)
+		for _, c := range e.Object.chunks() {
+			blobsKept[c.Blob] = true
+		}
+		resources = append(resources, ManifestResource{
+			ID:          logicalPath,
+			Type:        resType,
+			DisplayName: displayName,
+			LogicalPath: logicalPath,
+			RestoreMode: restoreMode,
+			Size:        e.Size,
+			SHA256:      e.SHA256,
 		})
 	}
-
-	sort.Slice(resources, func(i, j int) bool {
-		return resources[i].Definition.ID < resources[j].Definition.ID
-	})
-	return resources
+	var dropped []string
+	for _, o := range left {
+		for _, c := range o.chunks() {
+			if !blobsKept[c.Blob] {
+				dropped = append(dropped, c.Blob)
+			}
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].ID < resources[j].ID })
+	return out, resources, dropped
 }
 
 // classifyOpenClawAsset determines the logical path, resource type, and display name
@@ -288,34 +318,51 @@ func classifyWorkspaceFile(relPath string) string {
 	}
 }
 
-// ExportAsOpenClawTarGz decrypts a snapshot and re-exports it as an OpenClaw-compatible
+// OpenClawExport is a snapshot unlocked for export as an OpenClaw-compatible
 // .tar.gz archive with a manifest.json.
-func (s *Service) ExportAsOpenClawTarGz(snapshotID, password string) ([]byte, string, error) {
+type OpenClawExport struct {
+	Name string // file name to save the archive under
+
+	svc      *Service
+	manifest SnapshotManifest
+	files    map[string][]byte
+	lazy     map[string]blobObject
+}
+
+// ExportAsOpenClawTarGz decrypts a snapshot for export as an
+// OpenClaw-compatible archive. Nothing is written until WriteTo, which
+// streams large files instead of loading them.
+func (s *Service) ExportAsOpenClawTarGz(snapshotID, password string) (*OpenClawExport, error) {
 	record, err := s.repo.FindBySnapshotID(snapshotID)
 	if err != nil {
-		return nil, "", err
-	}
-	bundle, err := decryptBundleWithEnvelope(password, record.KDFParamsJSON, record.SaltB64,
-		record.WrappedDEKB64, record.WrapNonceB64, record.DataNonceB64, record.Ciphertext)
-	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	manifest, files, err := unpackBundle(bundle)
+	manifest, files, lazy, err := s.openIndex(record, password)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
+	return &OpenClawExport{
+		Name:     "openclaw-backup-" + manifest.CreatedAt.Format("2006-01-02_150405") + ".tar.gz",
+		svc:      s,
+		manifest: manifest,
+		files:    files,
+		lazy:     lazy,
+	}, nil
+}
 
-	now := manifest.CreatedAt
+// WriteTo writes the gzipped archive to w.
+func (e *OpenClawExport) WriteTo(w io.Writer) (int64, error) {
+	now := e.manifest.CreatedAt
 	archiveRoot := now.Format("2006-01-02T15-04-05.000Z") + "-openclaw-backup"
 
 	ocManifest := openclawManifest{
 		SchemaVersion:  1,
 		CreatedAt:      now.Format(time.RFC3339),
 		ArchiveRoot:    archiveRoot,
-		RuntimeVersion: manifest.AppVersion,
+		RuntimeVersion: e.manifest.AppVersion,
 		Platform:       "clawdeckx",
 	}
-	for _, res := range manifest.Resources {
+	for _, res := range e.manifest.Resources {
 		ocManifest.Assets = append(ocManifest.Assets, struct {
 			Kind        string `json:"kind"`
 			SourcePath  string `json:"sourcePath"`
@@ -327,33 +374,39 @@ func (s *Service) ExportAsOpenClawTarGz(snapshotID, password string) ([]byte, st
 		})
 	}
 
-	var buf bytes.Buffer
-	gw := gzip.NewWriter(&buf)
+	cw := &countingWriter{w: w}
+	gw := gzip.NewWriter(cw)
 	tw := tar.NewWriter(gw)
 
 	manifestJSON, _ := json.MarshalIndent(ocManifest, "", "  ")
 	if err := writeTarEntry(tw, archiveRoot+"/manifest.json", manifestJSON, now); err != nil {
-		return nil, "", err
+		return cw.n, err
 	}
-	for _, res := range manifest.Resources {
-		content, ok := files[res.LogicalPath]
+	for _, res := range e.manifest.Resources {
+		name := archiveRoot + "/" + res.LogicalPath
+		if content, ok := e.files[res.LogicalPath]; ok {
+			if err := writeTarEntry(tw, name, content, now); err != nil {
+				return cw.n, err
+			}
+			continue
+		}
+		o, ok := e.lazy[res.LogicalPath]
 		if !ok {
 			continue
 		}
-		if err := writeTarEntry(tw, archiveRoot+"/"+res.LogicalPath, content, now); err != nil {
-			return nil, "", err
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: res.Size, ModTime: now}); err != nil {
+			return cw.n, err
+		}
+		if _, err := e.svc.writeObject(o, tw); err != nil {
+			return cw.n, err
 		}
 	}
 
 	if err := tw.Close(); err != nil {
-		return nil, "", err
-	}
-	if err := gw.Close(); err != nil {
-		return nil, "", err
+		return cw.n, err
 	}
-
-	exportName := "openclaw-backup-" + now.Format("2006-01-02_150405") + ".tar.gz"
-	return buf.Bytes(), exportName, nil
+	err := gw.Close()
+	return cw.n, err
 }
 
 func writeTarEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
@@ -380,56 +433,79 @@ type VerifyResult struct {
 }
 
 func (s *Service) VerifyIntegrity(snapshotID, password string) (*VerifyResult, error) {
+	return s.VerifyIntegrityWithProgress(snapshotID, password, nil)
+}
+
+// VerifyIntegrityWithProgress is VerifyIntegrity reporting each checked
+// file to progressFn. Large files are hashed as they are decrypted.
+func (s *Service) VerifyIntegrityWithProgress(snapshotID, password string, progressFn ProgressFn) (*VerifyResult, error) {
+	if progressFn == nil {
+		progressFn = func(evt RestoreProgressEvent) {}
+	}
 	record, err := s.repo.FindBySnapshotID(snapshotID)
 	if err != nil {
 		return nil, err
 	}
-	bundle, err := decryptBundleWithEnvelope(password, record.KDFParamsJSON, record.SaltB64,
-		record.WrappedDEKB64, record.WrapNonceB64, record.DataNonceB64, record.Ciphertext)
-	if err != nil {
-		return &VerifyResult{OK: false, Error: "decryption failed: " + err.Error()}, nil
+	manifest, files, lazy, err := s.openIndex(record, password)
+	if errors.Is(err, errBlobMismatch) {
+		return &VerifyResult{OK: false, Error: err.Error()}, nil
 	}
-	manifest, files, err := unpackBundle(bundle)
 	if err != nil {
-		return &VerifyResult{OK: false, Error: "unpack failed: " + err.Error()}, nil
+		return &VerifyResult{OK: false, Error: "decryption failed: " + err.Error()}, nil
 	}
 
 	result := &VerifyResult{
 		OK:            true,
 		ResourceCount: len(manifest.Resources),
 	}
-	for _, res := range manifest.Resources {
-		content, ok := files[res.LogicalPath]
-		if !ok {
+	for i, res := range manifest.Resources {
+		progressFn(RestoreProgressEvent{Phase: "verify", Current: i + 1, Total: len(manifest.Resources), File: res.ID, Bytes: result.TotalSizeBytes})
+		h := sha256.New()
+		if content, ok := files[res.LogicalPath]; ok {
+			h.Write(content)
+			result.TotalSizeBytes += int64(len(content))
+		} else if o, ok := lazy[res.LogicalPath]; ok {
+			n, err := s.writeObject(o, h)
+			result.TotalSizeBytes += n
+			if err != nil {
+				result.OK = false
+				result.Error = err.Error()
+				return result, nil
+			}
+		} else {
 			result.OK = false
 			result.Error = fmt.Sprintf("missing file: %s", res.LogicalPath)
 			return result, nil
 		}
-		result.TotalSizeBytes += int64(len(content))
-		if res.SHA256 != "" {
-			h := sha256.Sum256(content)
-			if hex.EncodeToString(h[:]) != res.SHA256 {
-				result.OK = false
-				result.Error = fmt.Sprintf("SHA256 mismatch for %s", res.LogicalPath)
-				return result, nil
-			}
+		if res.SHA256 != "" && hex.EncodeToString(h.Sum(nil)) != res.SHA256 {
+			result.OK = false
+			result.Error = fmt.Sprintf("SHA256 mismatch for %s", res.LogicalPath)
+			return result, nil
 		}
 		result.VerifiedCount++
 	}
+	progressFn(RestoreProgressEvent{Phase: "done", Current: len(manifest.Resources), Total: len(manifest.Resources), Bytes: result.TotalSizeBytes})
 	return result, nil
 }
 
 // Stats returns aggregate snapshot statistics.
+// TotalSizeBytes and LogicalSizeBytes add up the size of every snapshot as
+// if stored on its own; PhysicalSizeBytes is what the database actually
+// holds after blobs shared between snapshots are deduplicated.
 type SnapshotStats struct {
-	TotalCount      int     `json:"total_count"`
-	TotalSizeBytes  int64   `json:"total_size_bytes"`
-	LatestBackupAt  *string `json:"latest_backup_at"`
-	OldestBackupAt  *string `json:"oldest_backup_at"`
-	ManualCount     int     `json:"manual_count"`
-	ScheduledCount  int     `json:"scheduled_count"`
-	ImportCount     int     `json:"import_count"`
-	DaysSinceBackup int     `json:"days_since_backup"`
-	ScheduleEnabled bool    `json:"schedule_enabled"`
+	TotalCount        int     `json:"total_count"`
+	TotalSizeBytes    int64   `json:"total_size_bytes"`
+	LogicalSizeBytes  int64   `json:"logical_size_bytes"`
+	PhysicalSizeBytes int64   `json:"physical_size_bytes"`
+	BlobCount         int64   `json:"blob_count"`
+	LegacyCount       int     `json:"legacy_count"` // version 1 snapshots not yet migrated
+	LatestBackupAt    *string `json:"latest_backup_at"`
+	OldestBackupAt    *string `json:"oldest_backup_at"`
+	ManualCount       int     `json:"manual_count"`
+	ScheduledCount    int     `json:"scheduled_count"`
+	ImportCount       int     `json:"import_count"`
+	DaysSinceBackup   int     `json:"days_since_backup"`
+	ScheduleEnabled   bool    `json:"schedule_enabled"`
 }
 
 func (s *Service) Stats() (*SnapshotStats, error) {
@@ -441,6 +517,9 @@ func (s *Service) Stats() (*SnapshotStats, error) {
 	stats.TotalCount = len(records)
 	for _, r := range records {
 		stats.TotalSizeBytes += r.SizeBytes
+		if r.SnapshotVersion < SnapshotVersion2 {
+			stats.LegacyCount++
+		}
 		switch r.Trigger {
 		case "manual":
 			stats.ManualCount++
@@ -450,6 +529,13 @@ func (s *Service) Stats() (*SnapshotStats, error) {
 			stats.ImportCount++
 		}
 	}
+	stats.LogicalSizeBytes = stats.TotalSizeBytes
+	if stats.PhysicalSizeBytes, err = s.physicalSize(); err != nil {
+		return nil, err
+	}
+	if stats.BlobCount, _, err = s.blobs.Usage(); err != nil {
+		return nil, err
+	}
 	if len(records) > 0 {
 		latest := records[0].CreatedAt.Format(time.RFC3339)
 		oldest := records[len(records)-1].CreatedAt.Format(time.RFC3339)
@@ -501,7 +587,10 @@ func (s *Service) PreviewFileContent(previewToken, logicalPath string) ([]byte,
 	if err != nil {
 		return nil, err
 	}
-	content, ok := ub.Files[logicalPath]
+	content, ok, err := s.bundleFile(ub, logicalPath)
+	if err != nil {
+		return nil, err
+	}
 	if !ok {
 		return nil, fmt.Errorf("file not found: %s", logicalPath)
 	}
@@ -523,7 +612,11 @@ func (s *Service) DiffFileContent(previewToken, logicalPath string) (*FileDiff,
 		return nil, err
 	}
 	diff := &FileDiff{LogicalPath: logicalPath}
-	if content, ok := ub.Files[logicalPath]; ok {
+	content, ok, err := s.bundleFile(ub, logicalPath)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
 		diff.BackupContent = string(content)
 		diff.BackupExists = true
 	}
@@ -0,0 +1,356 @@
+package snapshots
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"ClawDeckX/internal/database"
+)
+
+// Besides the password slot kept in the envelope columns of a snapshot row,
+// a snapshot can carry extra key slots in KeySlotsJSON. Each holds the same
+// DEK sealed to an X25519 recipient in age format:
+//
+//   - recovery: the public half of a printable recovery key made by
+//     GenerateRecoveryKey. The key itself is shown once and never stored.
+//   - escrow: an age public key supplied by the user, whose identity is kept
+//     offline, for example by a second administrator.
+//
+// Wherever a snapshot password is accepted, the recovery key or the escrow
+// identity (AGE-SECRET-KEY-1...) opens the snapshot as well. Rewrap changes
+// the password and reseals the extra slots of every snapshot without
+// decrypting its data.
+
+const settingKeyConfig = "snapshot_key_config"
+
+// Key slot types.
+const (
+	KeySlotRecovery = "recovery"
+	KeySlotEscrow   = "escrow"
+)
+
+// Bounds for configurable argon2id parameters. Memory is in KiB.
+const (
+	minKDFMemory      = 19 * 1024
+	maxKDFMemory      = 1024 * 1024
+	maxKDFIterations  = 20
+	maxKDFParallelism = 16
+)
+
+// KeySlot is an extra copy of a snapshot DEK.
+type KeySlot struct {
+	Type      string `json:"type"`
+	Recipient string `json:"recipient"` // age X25519 recipient the DEK is sealed to
+	Data      string `json:"data"`      // base64 age file holding the DEK
+}
+
+// KeyConfig decides which key slots new and rewrapped snapshots get.
+type KeyConfig struct {
+	RecoveryRecipient string     `json:"recoveryRecipient,omitempty"`
+	RecoveryCreatedAt *time.Time `json:"recoveryCreatedAt,omitempty"`
+	EscrowRecipient   string     `json:"escrowRecipient,omitempty"`
+	KDF               KDFParams  `json:"kdf"` // for password slots
+}
+
+// KeyStatus reports how many snapshots are covered by the current keys.
+type KeyStatus struct {
+	KeyConfig
+	Snapshots    int `json:"snapshots"`
+	WithRecovery int `json:"withRecovery"` // sealed to the current recovery key
+	WithEscrow   int `json:"withEscrow"`   // sealed to the current escrow key
+	OutdatedKDF  int `json:"outdatedKdf"`  // password slot weaker than KDF
+}
+
+// RewrapResult reports the outcome of Rewrap.
+type RewrapResult struct {
+	Rewrapped []string `json:"rewrapped"`
+	Skipped   []string `json:"skipped"` // not opened by the old secret
+}
+
+func (p KDFParams) validate() error {
+	if p.KeyLen != 32 {
+		return errors.New("kdf key_len must be 32")
+	}
+	if p.Memory < minKDFMemory || p.Memory > maxKDFMemory {
+		return fmt.Errorf("kdf memory must be between %d and %d KiB", minKDFMemory, maxKDFMemory)
+	}
+	if p.Iterations < 1 || p.Iterations > maxKDFIterations {
+		return fmt.Errorf("kdf iterations must be between 1 and %d", maxKDFIterations)
+	}
+	if p.Parallelism < 1 || p.Parallelism > maxKDFParallelism {
+		return fmt.Errorf("kdf parallelism must be between 1 and %d", maxKDFParallelism)
+	}
+	return nil
+}
+
+func (p KDFParams) weakerThan(q KDFParams) bool {
+	return p.Memory < q.Memory || p.Iterations < q.Iterations
+}
+
+func (s *Service) KeyConfig() KeyConfig {
+	cfg := KeyConfig{KDF: defaultKDFParams()}
+	if raw, err := s.settings.Get(settingKeyConfig); err == nil && raw != "" {
+		_ = json.Unmarshal([]byte(raw), &cfg)
+	}
+	return cfg
+}
+
+func (s *Service) saveKeyConfig(cfg KeyConfig) error {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.settings.Set(settingKeyConfig, string(raw))
+}
+
+// UpdateKeyConfig sets the escrow recipient and the KDF parameters of new
+// password slots. An empty recipient stops escrow for new snapshots and
+// zero KDF parameters keep the current ones. The recovery key is managed
+// with GenerateRecoveryKey and RemoveRecoveryKey.
+func (s *Service) UpdateKeyConfig(in KeyConfig) error {
+	cfg := s.KeyConfig()
+	if in.EscrowRecipient != "" {
+		pub, err := parseAgeRecipient(in.EscrowRecipient)
+		if err != nil {
+			return err
+		}
+		in.EscrowRecipient = encodeAgeRecipient(pub)
+	}
+	cfg.EscrowRecipient = in.EscrowRecipient
+	if in.KDF != (KDFParams{}) {
+		if err := in.KDF.validate(); err != nil {
+			return err
+		}
+		cfg.KDF = in.KDF
+	}
+	return s.saveKeyConfig(cfg)
+}
+
+// GenerateRecoveryKey creates a recovery key and returns it for the user to
+// print. Only its recipient is kept: new snapshots get a slot for it, and
+// existing ones after Rewrap. A previous recovery key keeps opening the
+// snapshots sealed to it until they are rewrapped.
+func (s *Service) GenerateRecoveryKey() (string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	cfg := s.KeyConfig()
+	now := time.Now().UTC()
+	cfg.RecoveryRecipient = encodeAgeRecipient(key.PublicKey())
+	cfg.RecoveryCreatedAt = &now
+	if err := s.saveKeyConfig(cfg); err != nil {
+		return "", err
+	}
+	return encodeRecoveryKey(key.Bytes()), nil
+}
+
+// RemoveRecoveryKey stops adding recovery slots to new snapshots.
+func (s *Service) RemoveRecoveryKey() error {
+	cfg := s.KeyConfig()
+	cfg.RecoveryRecipient = ""
+	cfg.RecoveryCreatedAt = nil
+	return s.saveKeyConfig(cfg)
+}
+
+func (s *Service) KeyStatus() (*KeyStatus, error) {
+	records, err := s.repo.ListMeta()
+	if err != nil {
+		return nil, err
+	}
+	status := &KeyStatus{KeyConfig: s.KeyConfig(), Snapshots: len(records)}
+	for i := range records {
+		var p KDFParams
+		if json.Unmarshal([]byte(records[i].KDFParamsJSON), &p) != nil || p.weakerThan(status.KDF) {
+			status.OutdatedKDF++
+		}
+		for _, slot := range decodeKeySlots(records[i].KeySlotsJSON) {
+			switch {
+			case slot.Type == KeySlotRecovery && slot.Recipient == status.RecoveryRecipient:
+				status.WithRecovery++
+			case slot.Type == KeySlotEscrow && slot.Recipient == status.EscrowRecipient:
+				status.WithEscrow++
+			}
+		}
+	}
+	return status, nil
+}
+
+// Rewrap opens the DEK of every snapshot oldSecret (a password, recovery key
+// or escrow identity) unlocks, wraps it under newPassword with the current
+// KDF parameters and reseals the recovery and escrow slots to the current
+// keys. Snapshot data and blobs are not read or rewritten. Copies already
+// uploaded to remote targets keep their old keys.
+func (s *Service) Rewrap(oldSecret, newPassword string) (*RewrapResult, error) {
+	if len(newPassword) < 6 {
+		return nil, errors.New("password too short")
+	}
+	records, err := s.repo.ListMeta()
+	if err != nil {
+		return nil, err
+	}
+	cfg := s.KeyConfig()
+	result := &RewrapResult{Rewrapped: []string{}, Skipped: []string{}}
+	for i := range records {
+		rec := &records[i]
+		dek, err := recordDEK(rec, oldSecret)
+		if err != nil {
+			result.Skipped = append(result.Skipped, rec.SnapshotID)
+			continue
+		}
+		if err := wrapKeys(rec, newPassword, dek, cfg); err != nil {
+			return result, err
+		}
+		if err := s.repo.UpdateKeys(rec); err != nil {
+			return result, err
+		}
+		result.Rewrapped = append(result.Rewrapped, rec.SnapshotID)
+	}
+	return result, nil
+}
+
+// sealEnvelope encrypts plain under a fresh DEK and stores the ciphertext
+// and every key slot of the current configuration on record.
+func (s *Service) sealEnvelope(record *database.SnapshotRecord, password string, plain []byte) error {
+	dek, err := newDEK()
+	if err != nil {
+		return err
+	}
+	ciphertext, dataNonce, err := aesGCMEncrypt(dek, plain)
+	if err != nil {
+		return err
+	}
+	if err := wrapKeys(record, password, dek, s.KeyConfig()); err != nil {
+		return err
+	}
+	record.DataNonceB64 = base64.StdEncoding.EncodeToString(dataNonce)
+	record.Ciphertext = ciphertext
+	return nil
+}
+
+// wrapKeys replaces the password slot and the extra key slots of record.
+func wrapKeys(record *database.SnapshotRecord, password string, dek []byte, cfg KeyConfig) error {
+	kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, err := wrapDEK(password, dek, cfg.KDF)
+	if err != nil {
+		return err
+	}
+	var slots []KeySlot
+	for _, r := range []struct{ typ, recipient string }{
+		{KeySlotRecovery, cfg.RecoveryRecipient},
+		{KeySlotEscrow, cfg.EscrowRecipient},
+	} {
+		if r.recipient == "" {
+			continue
+		}
+		pub, err := parseAgeRecipient(r.recipient)
+		if err != nil {
+			return err
+		}
+		file, err := ageSeal(pub, dek)
+		if err != nil {
+			return err
+		}
+		slots = append(slots, KeySlot{Type: r.typ, Recipient: r.recipient, Data: base64.StdEncoding.EncodeToString(file)})
+	}
+	record.KDFAlg = "argon2id"
+	record.KDFParamsJSON = kdfJSON
+	record.SaltB64 = saltB64
+	record.WrappedDEKB64 = wrappedDEKB64
+	record.WrapNonceB64 = wrapNonceB64
+	record.KeySlotsJSON = ""
+	if len(slots) > 0 {
+		raw, _ := json.Marshal(slots)
+		record.KeySlotsJSON = string(raw)
+	}
+	return nil
+}
+
+// recordDEK unwraps the DEK of record with a password, recovery key or
+// escrow identity.
+func recordDEK(record *database.SnapshotRecord, secret string) ([]byte, error) {
+	if identity := secretIdentity(secret); identity != nil {
+		recipient := encodeAgeRecipient(identity.PublicKey())
+		for _, slot := range decodeKeySlots(record.KeySlotsJSON) {
+			if slot.Recipient != recipient {
+				continue
+			}
+			file, err := base64.StdEncoding.DecodeString(slot.Data)
+			if err != nil {
+				continue
+			}
+			if dek, err := ageOpen(identity, file); err == nil && len(dek) == 32 {
+				return dek, nil
+			}
+		}
+	}
+	return unwrapDEK(secret, record.KDFParamsJSON, record.SaltB64, record.WrappedDEKB64, record.WrapNonceB64)
+}
+
+func decodeKeySlots(raw string) []KeySlot {
+	var slots []KeySlot
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &slots)
+	}
+	return slots
+}
+
+// secretIdentity returns the X25519 key behind a recovery key or escrow
+// identity, or nil when secret is neither.
+func secretIdentity(secret string) *ecdh.PrivateKey {
+	secret = strings.TrimSpace(secret)
+	if strings.HasPrefix(strings.ToUpper(secret), strings.ToUpper(ageIdentityHRP)+"1") {
+		key, err := parseAgeIdentity(secret)
+		if err != nil {
+			return nil
+		}
+		return key
+	}
+	key, err := parseRecoveryKey(secret)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encodeRecoveryKey formats an X25519 key and a two byte checksum as groups
+// of five base32 characters.
+func encodeRecoveryKey(scalar []byte) string {
+	sum := sha256.Sum256(scalar)
+	raw := recoveryEncoding.EncodeToString(append(append([]byte{}, scalar...), sum[:2]...))
+	groups := make([]string, 0, len(raw)/5+1)
+	for len(raw) > 5 {
+		groups = append(groups, raw[:5])
+		raw = raw[5:]
+	}
+	return strings.Join(append(groups, raw), "-")
+}
+
+// parseRecoveryKey accepts a recovery key with any case, dashes or spaces.
+func parseRecoveryKey(s string) (*ecdh.PrivateKey, error) {
+	clean := strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+	raw, err := recoveryEncoding.DecodeString(clean)
+	if err != nil || len(raw) != 34 {
+		return nil, errors.New("not a recovery key")
+	}
+	sum := sha256.Sum256(raw[:32])
+	if sum[0] != raw[32] || sum[1] != raw[33] {
+		return nil, errors.New("recovery key checksum mismatch")
+	}
+	return ecdh.X25519().NewPrivateKey(raw[:32])
+}
@@ -0,0 +1,144 @@
+package snapshots
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgeKeys(t *testing.T) {
+	// Test vector from the age specification.
+	id, err := parseAgeIdentity("AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX")
+	require.NoError(t, err)
+	assert.Equal(t, "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj", encodeAgeRecipient(id.PublicKey()))
+	_, err = parseAgeRecipient("age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwq")
+	assert.Error(t, err, "bad checksum")
+
+	file, err := ageSeal(id.PublicKey(), []byte("data encryption key"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(file), "age-encryption.org/v1\n-> X25519 "))
+	plain, err := ageOpen(id, file)
+	require.NoError(t, err)
+	assert.Equal(t, "data encryption key", string(plain))
+
+	other, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = ageOpen(other, file)
+	assert.Error(t, err)
+}
+
+func TestRecoveryKeyFormat(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	printed := encodeRecoveryKey(key.Bytes())
+	assert.Len(t, strings.Split(printed, "-"), 11)
+
+	parsed, err := parseRecoveryKey(" " + strings.ToLower(strings.ReplaceAll(printed, "-", " ")) + "\n")
+	require.NoError(t, err)
+	assert.Equal(t, key.Bytes(), parsed.Bytes())
+
+	typo := []byte(printed)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	_, err = parseRecoveryKey(string(typo))
+	assert.Error(t, err)
+	assert.Nil(t, secretIdentity(testPassword))
+}
+
+func TestKeySlots_RecoveryEscrowAndRewrap(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	svc := NewService()
+	repo := database.NewSnapshotRepo()
+	files := map[string]string{"files/agents/main/SOUL.md": "calm"}
+
+	before := storeTestSnapshot(t, svc, files)
+	recoveryKey, err := svc.GenerateRecoveryKey()
+	require.NoError(t, err)
+	escrow, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NoError(t, svc.UpdateKeyConfig(KeyConfig{EscrowRecipient: encodeAgeRecipient(escrow.PublicKey())}))
+	after := storeTestSnapshot(t, svc, files)
+
+	for _, secret := range []string{testPassword, recoveryKey, encodeAgeIdentity(escrow)} {
+		_, got, err := svc.openSnapshot(after, secret)
+		require.NoError(t, err)
+		assert.Equal(t, "calm", string(got["files/agents/main/SOUL.md"]))
+	}
+	_, _, err = svc.openSnapshot(before, recoveryKey)
+	assert.Error(t, err, "snapshots taken before the recovery key have no slot for it")
+
+	kdf := defaultKDFParams()
+	kdf.Iterations++
+	require.NoError(t, svc.UpdateKeyConfig(KeyConfig{EscrowRecipient: svc.KeyConfig().EscrowRecipient, KDF: kdf}))
+	assert.Error(t, svc.UpdateKeyConfig(KeyConfig{KDF: KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1, KeyLen: 32}}))
+	status, err := svc.KeyStatus()
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.Snapshots)
+	assert.Equal(t, 1, status.WithRecovery)
+	assert.Equal(t, 1, status.WithEscrow)
+	assert.Equal(t, 2, status.OutdatedKDF)
+
+	// A forgotten password is replaced using the recovery key.
+	res, err := svc.Rewrap(recoveryKey, "new password")
+	require.NoError(t, err)
+	assert.Equal(t, []string{after.SnapshotID}, res.Rewrapped)
+	assert.Equal(t, []string{before.SnapshotID}, res.Skipped)
+	res, err = svc.Rewrap(testPassword, "new password")
+	require.NoError(t, err)
+	assert.Equal(t, []string{before.SnapshotID}, res.Rewrapped)
+
+	for _, old := range []*database.SnapshotRecord{before, after} {
+		rec, err := repo.FindBySnapshotID(old.SnapshotID)
+		require.NoError(t, err)
+		assert.Equal(t, old.Ciphertext, rec.Ciphertext, "data is not re-encrypted")
+		_, _, err = svc.openSnapshot(rec, testPassword)
+		assert.Error(t, err)
+		_, _, err = svc.openSnapshot(rec, "new password")
+		assert.NoError(t, err)
+		_, _, err = svc.openSnapshot(rec, recoveryKey)
+		assert.NoError(t, err)
+	}
+	status, err = svc.KeyStatus()
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.WithRecovery)
+	assert.Equal(t, 2, status.WithEscrow)
+	assert.Zero(t, status.OutdatedKDF)
+
+	// Key slots travel with exported snapshots.
+	data := exportClawbak(t, svc, before.SnapshotID)
+	require.NoError(t, svc.Delete(before.SnapshotID))
+	header, payload, err := DecodeClawbak(data)
+	require.NoError(t, err)
+	imported, err := svc.ImportSnapshot(header, payload)
+	require.NoError(t, err)
+	_, _, err = svc.openSnapshot(imported, encodeAgeIdentity(escrow))
+	assert.NoError(t, err)
+}
+
+func TestScheduler_ReplacePassword(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	sched := NewScheduler(NewService())
+	require.NoError(t, sched.savePassword(testPassword))
+
+	ok, err := sched.ReplacePassword("something else", "new password")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = sched.ReplacePassword(testPassword, "new password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	got, err := sched.password()
+	require.NoError(t, err)
+	assert.Equal(t, "new password", got)
+}
@@ -44,6 +44,7 @@ func buildManifest(resources []ResourceContent) (SnapshotManifest, error) {
 	return manifest, nil
 }
 
+// packBundle builds the zip bundle sealed whole in version 1 snapshots.
 func packBundle(manifest SnapshotManifest, resources []ResourceContent) ([]byte, error) {
 	buf := &bytes.Buffer{}
 	zw := zip.NewWriter(buf)
@@ -110,13 +111,16 @@ func extractConfigFields(configBytes []byte) ([]ConfigFieldEntry, error) {
 		return nil, err
 	}
 	entries := make([]ConfigFieldEntry, 0, 128)
-	walkConfigFields("", v, &entries)
+	walkConfig("", v, func(path string, v any) {
+		entries = append(entries, ConfigFieldEntry{Path: path, Kind: jsonKind(v), Hash: hashJSONValue(v)})
+	})
 	return entries, nil
 }
 
-func walkConfigFields(path string, v any, out *[]ConfigFieldEntry) {
-	entry := ConfigFieldEntry{Path: path, Kind: jsonKind(v), Hash: hashJSONValue(v)}
-	*out = append(*out, entry)
+// walkConfig calls fn for v and every value nested in it, depth first with
+// object keys sorted. Paths join keys with "." and index arrays as "[i]".
+func walkConfig(path string, v any, fn func(path string, v any)) {
+	fn(path, v)
 	switch t := v.(type) {
 	case map[string]any:
 		keys := make([]string, 0, len(t))
@@ -129,7 +133,7 @@ func walkConfigFields(path string, v any, out *[]ConfigFieldEntry) {
 			if path != "" {
 				next = path + "." + k
 			}
-			walkConfigFields(next, t[k], out)
+			walkConfig(next, t[k], fn)
 		}
 	case []any:
 		for i, item := range t {
@@ -137,7 +141,7 @@ func walkConfigFields(path string, v any, out *[]ConfigFieldEntry) {
 			if path == "" {
 				next = fmt.Sprintf("[%d]", i)
 			}
-			walkConfigFields(next, item, out)
+			walkConfig(next, item, fn)
 		}
 	}
 }
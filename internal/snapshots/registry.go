@@ -47,6 +47,20 @@ func resolveStateDir() string {
 	return filepath.Join(h, ".openclaw")
 }
 
+// agentMarkdownFiles are the per-agent files under agents/<name>/ that are
+// backed up.
+var agentMarkdownFiles = []struct {
+	fileName    string
+	idSuffix    string
+	displayName string
+}{
+	{fileName: "SOUL.md", idSuffix: "soul_md", displayName: "SOUL.md"},
+	{fileName: "USER.md", idSuffix: "user_md", displayName: "USER.md"},
+	{fileName: "MEMORY.md", idSuffix: "memory_md", displayName: "MEMORY.md"},
+	{fileName: "HEARTBEAT.md", idSuffix: "heartbeat_md", displayName: "HEARTBEAT.md"},
+	{fileName: "TOOLS.md", idSuffix: "tools_md", displayName: "TOOLS.md"},
+}
+
 func discoverAgentMarkdownResources(stateDir string) []ResourceDefinition {
 	agentsDir := filepath.Join(stateDir, "agents")
 	entries, err := os.ReadDir(agentsDir)
@@ -68,18 +82,7 @@ func discoverAgentMarkdownResources(stateDir string) []ResourceDefinition {
 			continue
 		}
 
-		type fileSpec struct {
-			fileName    string
-			idSuffix    string
-			displayName string
-		}
-		for _, spec := range []fileSpec{
-			{fileName: "SOUL.md", idSuffix: "soul_md", displayName: "SOUL.md"},
-			{fileName: "USER.md", idSuffix: "user_md", displayName: "USER.md"},
-			{fileName: "MEMORY.md", idSuffix: "memory_md", displayName: "MEMORY.md"},
-			{fileName: "HEARTBEAT.md", idSuffix: "heartbeat_md", displayName: "HEARTBEAT.md"},
-			{fileName: "TOOLS.md", idSuffix: "tools_md", displayName: "TOOLS.md"},
-		} {
+		for _, spec := range agentMarkdownFiles {
 			fullPath := filepath.Join(agentsDir, agentName, spec.fileName)
 			if !isRegularFile(fullPath) {
 				continue
@@ -0,0 +1,366 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/snapshots/targets"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// maxUploadAttempts is how often a failed upload is retried before it is
+	// left for the operator to retry by hand.
+	maxUploadAttempts  = 5
+	replicatorInterval = 5 * time.Minute
+	uploadTimeout      = 30 * time.Minute
+	probeObjectName    = ".clawdeckx-probe"
+)
+
+// RemoteSnapshot is a .clawbak file found on a target.
+type RemoteSnapshot struct {
+	targets.Object
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	Local      bool   `json:"local"` // the snapshot also exists locally
+}
+
+// Replicator copies snapshots to off-site targets. New snapshots are queued
+// for every enabled auto-upload target and uploaded in the background;
+// failed uploads are retried with backoff.
+type Replicator struct {
+	svc       *Service
+	targets   *database.SnapshotTargetRepo
+	uploads   *database.SnapshotUploadRepo
+	auditRepo *database.AuditLogRepo
+	open      func(ctx context.Context, cfg targets.Config) (targets.Target, error)
+	wake      chan struct{}
+	mu        sync.Mutex // one upload or retention pass at a time
+}
+
+func NewReplicator(svc *Service) *Replicator {
+	r := &Replicator{
+		svc:       svc,
+		targets:   database.NewSnapshotTargetRepo(),
+		uploads:   database.NewSnapshotUploadRepo(),
+		auditRepo: database.NewAuditLogRepo(),
+		open:      targets.New,
+		wake:      make(chan struct{}, 1),
+	}
+	svc.SetCreateHook(r.Enqueue)
+	return r
+}
+
+// TargetConfig decodes the stored configuration of a target.
+func TargetConfig(t *database.SnapshotTarget) (targets.Config, error) {
+	var cfg targets.Config
+	if err := json.Unmarshal([]byte(t.Config), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid target config: %w", err)
+	}
+	cfg.Type = t.Type
+	return cfg, nil
+}
+
+// Enqueue schedules a snapshot for upload to every enabled auto-upload target.
+func (r *Replicator) Enqueue(rec *database.SnapshotRecord) {
+	list, err := r.targets.ListAutoUpload()
+	if err != nil {
+		logger.Backup.Error().Err(err).Msg("list snapshot targets")
+		return
+	}
+	for _, t := range list {
+		u := &database.SnapshotUpload{SnapshotID: rec.SnapshotID, TargetID: t.ID, Status: database.UploadPending}
+		if err := r.uploads.Save(u); err != nil {
+			logger.Backup.Error().Err(err).Str("snapshot", rec.SnapshotID).Uint("target", t.ID).Msg("queue snapshot upload")
+		}
+	}
+	if len(list) > 0 {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start processes queued uploads until ctx is done.
+func (r *Replicator) Start(ctx context.Context) {
+	ticker := time.NewTicker(replicatorInterval)
+	defer ticker.Stop()
+
+	r.processQueue(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+		r.processQueue(ctx)
+	}
+}
+
+func (r *Replicator) processQueue(ctx context.Context) {
+	queue, err := r.uploads.ListRetryable(maxUploadAttempts)
+	if err != nil {
+		logger.Backup.Error().Err(err).Msg("list snapshot uploads")
+		return
+	}
+	now := time.Now()
+	for i := range queue {
+		u := &queue[i]
+		if ctx.Err() != nil {
+			return
+		}
+		// Back off linearly: a row that failed n times waits n intervals.
+		if u.Status == database.UploadFailed && now.Sub(u.UpdatedAt) < time.Duration(u.Attempts)*replicatorInterval {
+			continue
+		}
+		t, err := r.targets.GetByID(u.TargetID)
+		if err != nil || !t.Enabled {
+			continue
+		}
+		if err := r.upload(ctx, u, t); err != nil {
+			logger.Backup.Warn().Err(err).Str("snapshot", u.SnapshotID).Str("target", t.Name).
+				Int("attempt", u.Attempts).Msg("snapshot upload failed")
+		}
+	}
+}
+
+// Upload copies a snapshot to a target right away, regardless of earlier
+// attempts, and returns the resulting upload record.
+func (r *Replicator) Upload(ctx context.Context, snapshotID string, targetID uint) (*database.SnapshotUpload, error) {
+	t, err := r.targets.GetByID(targetID)
+	if err != nil {
+		return nil, err
+	}
+	u, err := r.uploads.Get(snapshotID, targetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		u = &database.SnapshotUpload{SnapshotID: snapshotID, TargetID: targetID}
+	} else if err != nil {
+		return nil, err
+	}
+	if err := r.upload(ctx, u, t); err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
+func (r *Replicator) upload(ctx context.Context, u *database.SnapshotUpload, t *database.SnapshotTarget) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exp, err := r.svc.PrepareClawbak(u.SnapshotID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Deleted locally before it could be uploaded; nothing left to retry.
+		u.Status = database.UploadFailed
+		u.Attempts = maxUploadAttempts
+		u.Error = "snapshot no longer exists"
+		_ = r.uploads.Save(u)
+		return errors.New(u.Error)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, uploadTimeout)
+	defer cancel()
+	u.Attempts++
+	name := ClawbakName(exp.Record)
+	err = r.put(ctx, t, name, exp)
+	if err != nil {
+		u.Status = database.UploadFailed
+		u.Error = err.Error()
+		_ = r.uploads.Save(u)
+		r.audit(constants.ActionSnapshotUpload, "failed", fmt.Sprintf("%s -> %s: %s", u.SnapshotID, t.Name, err))
+		return err
+	}
+	now := time.Now().UTC()
+	u.Status = database.UploadSuccess
+	u.ObjectName = name
+	u.SizeBytes = exp.Size
+	u.Error = ""
+	u.UploadedAt = &now
+	if err := r.uploads.Save(u); err != nil {
+		return err
+	}
+	r.audit(constants.ActionSnapshotUpload, "success", u.SnapshotID+" -> "+t.Name)
+	r.applyRetention(ctx, t)
+	return nil
+}
+
+// put streams the .clawbak file of exp to a target, one blob at a time.
+func (r *Replicator) put(ctx context.Context, t *database.SnapshotTarget, name string, exp *ClawbakExport) error {
+	tgt, err := r.openTarget(ctx, t)
+	if err != nil {
+		return err
+	}
+	defer tgt.Close()
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := exp.WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+	err = tgt.Put(ctx, name, pr, exp.Size)
+	// Unblock the writer if the target stopped reading early.
+	pr.CloseWithError(err)
+	return err
+}
+
+// applyRetention removes the oldest uploads beyond the target's retention
+// count. Only objects this instance uploaded or imported are considered.
+func (r *Replicator) applyRetention(ctx context.Context, t *database.SnapshotTarget) {
+	if t.RetentionCount <= 0 {
+		return
+	}
+	list, err := r.uploads.ListByTarget(t.ID, database.UploadSuccess)
+	if err != nil || len(list) <= t.RetentionCount {
+		return
+	}
+	tgt, err := r.openTarget(ctx, t)
+	if err != nil {
+		logger.Backup.Warn().Err(err).Str("target", t.Name).Msg("snapshot target retention")
+		return
+	}
+	defer tgt.Close()
+	pruned := 0
+	for i := range list[t.RetentionCount:] {
+		u := &list[t.RetentionCount+i]
+		if err := tgt.Delete(ctx, u.ObjectName); err != nil && !errors.Is(err, targets.ErrNotFound) {
+			logger.Backup.Warn().Err(err).Str("target", t.Name).Str("object", u.ObjectName).Msg("prune remote snapshot")
+			continue
+		}
+		u.Status = database.UploadPruned
+		if err := r.uploads.Save(u); err == nil {
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		r.audit(constants.ActionSnapshotTargetPrune, "success", fmt.Sprintf("%s: retention=%d,pruned=%d", t.Name, t.RetentionCount, pruned))
+	}
+}
+
+// ListRemote lists the snapshot files stored on a target, newest first.
+func (r *Replicator) ListRemote(ctx context.Context, targetID uint) ([]RemoteSnapshot, error) {
+	t, err := r.targets.GetByID(targetID)
+	if err != nil {
+		return nil, err
+	}
+	tgt, err := r.openTarget(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	defer tgt.Close()
+	objects, err := tgt.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	local := map[string]bool{}
+	if records, err := r.svc.repo.List(); err == nil {
+		for _, rec := range records {
+			local[rec.SnapshotID] = true
+		}
+	}
+	out := make([]RemoteSnapshot, 0, len(objects))
+	for _, o := range objects {
+		if !strings.HasSuffix(o.Name, ClawbakExt) {
+			continue
+		}
+		id := snapshotIDFromName(o.Name)
+		out = append(out, RemoteSnapshot{Object: o, SnapshotID: id, Local: id != "" && local[id]})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ModTime.After(out[j].ModTime) })
+	return out, nil
+}
+
+// ImportFromTarget streams a snapshot file from a target into ImportClawbak,
+// under the same size limit as an uploaded file. The snapshot stays
+// encrypted with its original password.
+func (r *Replicator) ImportFromTarget(ctx context.Context, targetID uint, name string) (*database.SnapshotRecord, error) {
+	t, err := r.targets.GetByID(targetID)
+	if err != nil {
+		return nil, err
+	}
+	tgt, err := r.openTarget(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	defer tgt.Close()
+	rc, err := tgt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	body := &countingReader{r: rc}
+	rec, err := r.svc.ImportClawbak(body, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The target already holds this snapshot; record it so it is not
+	// uploaded again and counts towards the target's retention.
+	now := time.Now().UTC()
+	_ = r.uploads.Save(&database.SnapshotUpload{
+		SnapshotID: rec.SnapshotID,
+		TargetID:   t.ID,
+		Status:     database.UploadSuccess,
+		ObjectName: name,
+		SizeBytes:  body.n,
+		UploadedAt: &now,
+	})
+	return rec, nil
+}
+
+// Test checks that a target configuration can write, list and delete objects.
+func (r *Replicator) Test(ctx context.Context, cfg targets.Config) error {
+	tgt, err := r.open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer tgt.Close()
+	if err := tgt.Put(ctx, probeObjectName, strings.NewReader("ok"), 2); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	if _, err := tgt.List(ctx); err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if err := tgt.Delete(ctx, probeObjectName); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+func (r *Replicator) openTarget(ctx context.Context, t *database.SnapshotTarget) (targets.Target, error) {
+	cfg, err := TargetConfig(t)
+	if err != nil {
+		return nil, err
+	}
+	return r.open(ctx, cfg)
+}
+
+func (r *Replicator) audit(action, result, detail string) {
+	_ = r.auditRepo.Create(&database.AuditLog{
+		Action: action,
+		Result: result,
+		Detail: detail,
+		IP:     "system",
+	})
+}
+
+// snapshotIDFromName recovers the snapshot ID from a ClawbakName.
+func snapshotIDFromName(name string) string {
+	base := strings.TrimSuffix(name, ClawbakExt)
+	i := strings.LastIndex(base, "-")
+	if i < 0 || !strings.HasPrefix(base[i+1:], "snap_") {
+		return ""
+	}
+	return base[i+1:]
+}
@@ -0,0 +1,162 @@
+package snapshots
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/snapshots/targets"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func addTestSnapshot(t *testing.T, id string, at time.Time) *database.SnapshotRecord {
+	t.Helper()
+	rec := &database.SnapshotRecord{
+		SnapshotID: id, SnapshotVersion: SnapshotVersion1, Trigger: ScheduledSnapshotTag, ResourceCount: 1,
+		CipherAlg: "aes-256-gcm", KDFAlg: "argon2id", KDFParamsJSON: "{}", SaltB64: "c2FsdA==",
+		WrappedDEKB64: "ZGVr", WrapNonceB64: "bm9uY2U=", DataNonceB64: "bm9uY2U=",
+		Ciphertext: []byte("ciphertext of " + id), CreatedAt: at,
+	}
+	require.NoError(t, database.NewSnapshotRepo().Create(rec))
+	return rec
+}
+
+func TestReplicator_UploadRetentionAndImport(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	dir := t.TempDir()
+	cfg, _ := json.Marshal(targets.Config{Type: targets.TypeFS, Path: dir})
+	target := &database.SnapshotTarget{Name: "nas", Type: targets.TypeFS, Config: string(cfg), Enabled: true, AutoUpload: true, RetentionCount: 2}
+	require.NoError(t, database.NewSnapshotTargetRepo().Create(target))
+
+	svc := NewService()
+	rep := NewReplicator(svc)
+	ctx := context.Background()
+
+	base := time.Now().UTC().Add(-time.Hour)
+	var recs []*database.SnapshotRecord
+	for i, id := range []string{"snap_a", "snap_b", "snap_c"} {
+		rec := addTestSnapshot(t, id, base.Add(time.Duration(i)*time.Minute))
+		recs = append(recs, rec)
+		rep.Enqueue(rec)
+		rep.processQueue(ctx)
+	}
+
+	// Retention keeps the two newest uploads on the target.
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	first, err := database.NewSnapshotUploadRepo().Get("snap_a", target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, database.UploadPruned, first.Status)
+	last, err := database.NewSnapshotUploadRepo().Get("snap_c", target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, database.UploadSuccess, last.Status)
+	assert.Equal(t, ClawbakName(recs[2]), last.ObjectName)
+
+	list, err := svc.List()
+	require.NoError(t, err)
+	for _, s := range list {
+		require.Len(t, s.Uploads, 1, s.ID)
+	}
+
+	// Lose the local copy, then bring it back from the target.
+	require.NoError(t, svc.Delete("snap_c"))
+	remote, err := rep.ListRemote(ctx, target.ID)
+	require.NoError(t, err)
+	require.Len(t, remote, 2)
+	assert.Equal(t, "snap_c", remote[0].SnapshotID)
+	assert.False(t, remote[0].Local)
+	assert.True(t, remote[1].Local)
+
+	rec, err := rep.ImportFromTarget(ctx, target.ID, remote[0].Name)
+	require.NoError(t, err)
+	assert.Equal(t, "snap_c", rec.SnapshotID)
+	assert.Equal(t, recs[2].Ciphertext, rec.Ciphertext)
+	assert.Equal(t, recs[2].WrappedDEKB64, rec.WrappedDEKB64)
+}
+
+func TestReplicator_FailedUploadIsRetried(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	// A regular file where the target directory should be makes uploads fail.
+	blocked := filepath.Join(t.TempDir(), "offline")
+	require.NoError(t, os.WriteFile(blocked, nil, 0o600))
+	cfg, _ := json.Marshal(targets.Config{Type: targets.TypeFS, Path: blocked})
+	target := &database.SnapshotTarget{Name: "usb", Type: targets.TypeFS, Config: string(cfg), Enabled: true, AutoUpload: true}
+	require.NoError(t, database.NewSnapshotTargetRepo().Create(target))
+
+	rep := NewReplicator(NewService())
+	rec := addTestSnapshot(t, "snap_x", time.Now().UTC())
+	rep.Enqueue(rec)
+	rep.processQueue(context.Background())
+
+	u, err := database.NewSnapshotUploadRepo().Get("snap_x", target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, database.UploadFailed, u.Status)
+	assert.Equal(t, 1, u.Attempts)
+	assert.NotEmpty(t, u.Error)
+
+	// The backoff holds the retry back; a manual upload goes through once
+	// the target is reachable.
+	rep.processQueue(context.Background())
+	u, _ = database.NewSnapshotUploadRepo().Get("snap_x", target.ID)
+	assert.Equal(t, 1, u.Attempts)
+
+	require.NoError(t, os.Remove(blocked))
+	u, err = rep.Upload(context.Background(), "snap_x", target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, database.UploadSuccess, u.Status)
+	assert.Equal(t, 2, u.Attempts)
+	_, err = os.Stat(filepath.Join(blocked, ClawbakName(rec)))
+	assert.NoError(t, err)
+}
+
+func TestReplicator_StreamsBlobSnapshots(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	dir := t.TempDir()
+	cfg, _ := json.Marshal(targets.Config{Type: targets.TypeFS, Path: dir})
+	target := &database.SnapshotTarget{Name: "nas", Type: targets.TypeFS, Config: string(cfg), Enabled: true}
+	require.NoError(t, database.NewSnapshotTargetRepo().Create(target))
+
+	svc := NewService()
+	rep := NewReplicator(svc)
+	ctx := context.Background()
+	rec := storeTestSnapshot(t, svc, map[string]string{
+		"files/agents/main/AGENTS.md": "agent instructions",
+		"files/personas/a.md":         "persona",
+	})
+	want := exportClawbak(t, svc, rec.SnapshotID)
+
+	u, err := rep.Upload(ctx, rec.SnapshotID, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), u.SizeBytes)
+	got, err := os.ReadFile(filepath.Join(dir, u.ObjectName))
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "the uploaded file is the exported .clawbak")
+
+	require.NoError(t, svc.Delete(rec.SnapshotID))
+	imported, err := rep.ImportFromTarget(ctx, target.ID, u.ObjectName)
+	require.NoError(t, err)
+	assert.Equal(t, rec.SnapshotID, imported.SnapshotID)
+	_, files, err := svc.openSnapshot(imported, testPassword)
+	require.NoError(t, err)
+	assert.Equal(t, "persona", string(files["files/personas/a.md"]))
+	u, err = database.NewSnapshotUploadRepo().Get(rec.SnapshotID, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(want)), u.SizeBytes)
+}
@@ -0,0 +1,113 @@
+package snapshots
+
+import (
+	"fmt"
+	"time"
+
+	"ClawDeckX/internal/database"
+)
+
+// RetentionPolicy is a grandfather-father-son policy: the newest KeepLast
+// snapshots are kept, plus the newest snapshot of each of the last
+// KeepHourly hours, KeepDaily days, KeepWeekly ISO weeks and KeepMonthly
+// months that have one. A policy with every count at zero keeps everything.
+type RetentionPolicy struct {
+	KeepLast    int `json:"keepLast"`
+	KeepHourly  int `json:"keepHourly"`
+	KeepDaily   int `json:"keepDaily"`
+	KeepWeekly  int `json:"keepWeekly"`
+	KeepMonthly int `json:"keepMonthly"`
+}
+
+func (p RetentionPolicy) isZero() bool {
+	return p == RetentionPolicy{}
+}
+
+func (p RetentionPolicy) validate() error {
+	for _, n := range []int{p.KeepLast, p.KeepHourly, p.KeepDaily, p.KeepWeekly, p.KeepMonthly} {
+		if n < 0 || n > MaxSnapshotCount {
+			return fmt.Errorf("retention counts must be between 0 and %d", MaxSnapshotCount)
+		}
+	}
+	return nil
+}
+
+// retainedSet returns the snapshot IDs the policy keeps. records must be
+// ordered newest first; buckets are computed in loc.
+func retainedSet(records []database.SnapshotRecord, p RetentionPolicy, loc *time.Location) map[string]bool {
+	keep := map[string]bool{}
+	if p.isZero() {
+		for _, r := range records {
+			keep[r.SnapshotID] = true
+		}
+		return keep
+	}
+	for i := 0; i < p.KeepLast && i < len(records); i++ {
+		keep[records[i].SnapshotID] = true
+	}
+	tiers := []struct {
+		n      int
+		bucket func(t time.Time) string
+	}{
+		{p.KeepHourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}},
+		{p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, tier := range tiers {
+		if tier.n <= 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, r := range records {
+			b := tier.bucket(r.CreatedAt.In(loc))
+			if seen[b] {
+				continue
+			}
+			seen[b] = true
+			keep[r.SnapshotID] = true
+			if len(seen) == tier.n {
+				break
+			}
+		}
+	}
+	return keep
+}
+
+// PruneSchedule deletes the snapshots of a schedule that its retention
+// policy no longer keeps, and returns their IDs.
+func (s *Service) PruneSchedule(scheduleID uint, p RetentionPolicy, loc *time.Location) ([]string, error) {
+	records, err := s.repo.ListBySchedule(scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	return s.prune(records, p, loc)
+}
+
+func (s *Service) prune(records []database.SnapshotRecord, p RetentionPolicy, loc *time.Location) ([]string, error) {
+	keep := retainedSet(records, p, loc)
+	var pruned []string
+	for _, r := range records {
+		if keep[r.SnapshotID] {
+			continue
+		}
+		if err := s.repo.DeleteBySnapshotID(r.SnapshotID); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, r.SnapshotID)
+	}
+	return pruned, nil
+}
+
+// PruneTrigger deletes the snapshots of a trigger, such as auto-change
+// snapshots, that p no longer keeps, and returns their IDs.
+func (s *Service) PruneTrigger(trigger string, p RetentionPolicy, loc *time.Location) ([]string, error) {
+	records, err := s.repo.ListByTriggerSince(trigger, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return s.prune(records, p, loc)
+}
@@ -0,0 +1,60 @@
+package snapshots
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetainedSet_GFS(t *testing.T) {
+	// Snapshots every 6 hours for 90 days, newest first.
+	end := time.Date(2026, 5, 31, 18, 0, 0, 0, time.UTC)
+	var records []database.SnapshotRecord
+	for i := 0; i < 90*4; i++ {
+		at := end.Add(-time.Duration(i) * 6 * time.Hour)
+		records = append(records, database.SnapshotRecord{SnapshotID: at.Format("snap_0102_15"), CreatedAt: at})
+	}
+
+	keep := retainedSet(records, RetentionPolicy{KeepLast: 2, KeepDaily: 7, KeepWeekly: 4, KeepMonthly: 3}, time.UTC)
+	assert.True(t, keep["snap_0531_18"])
+	assert.True(t, keep["snap_0531_12"])
+	assert.False(t, keep["snap_0531_06"])
+	// Daily tier: the newest snapshot of May 25..31.
+	for d := 25; d <= 30; d++ {
+		assert.True(t, keep[time.Date(2026, 5, d, 18, 0, 0, 0, time.UTC).Format("snap_0102_15")], d)
+	}
+	assert.False(t, keep["snap_0524_12"])
+	// Monthly tier reaches back to the last snapshot of April and March.
+	assert.True(t, keep["snap_0430_18"])
+	assert.True(t, keep["snap_0331_18"])
+	assert.LessOrEqual(t, len(keep), 2+7+4+3)
+
+	all := retainedSet(records, RetentionPolicy{}, time.UTC)
+	assert.Len(t, all, len(records))
+}
+
+func TestPruneSchedule_OnlyTouchesItsSchedule(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	t.Setenv("OCD_CONFIG", filepath.Join(t.TempDir(), "ClawDeckX.json"))
+
+	base := time.Now().UTC().Add(-time.Hour)
+	for i, id := range []string{"snap_1", "snap_2", "snap_3"} {
+		rec := addTestSnapshot(t, id, base.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, database.DB.Model(rec).Update("schedule_id", 1).Error)
+	}
+	addTestSnapshot(t, "snap_other", base)
+
+	pruned, err := NewService().PruneSchedule(1, RetentionPolicy{KeepLast: 1}, time.UTC)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"snap_1", "snap_2"}, pruned)
+
+	_, err = database.NewSnapshotRepo().FindBySnapshotID("snap_other")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,59 @@
+package snapshots
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConfigRollback reports what RollbackConfig restored.
+type ConfigRollback struct {
+	SnapshotID           string    `json:"snapshot_id"`
+	SnapshotAt           time.Time `json:"snapshot_at"`
+	PreRestoreSnapshotID string    `json:"pre_restore_snapshot_id"`
+}
+
+// RollbackConfig replaces openclaw.json with its copy in the newest snapshot
+// taken before the given time, unlocked with the stored schedule password.
+// The current state is snapshotted first so the rollback can be undone.
+// Pre-restore snapshots are skipped as they hold the config being replaced.
+func (s *Scheduler) RollbackConfig(before time.Time) (*ConfigRollback, error) {
+	password, err := s.password()
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.snapRepo.ListMeta()
+	if err != nil {
+		return nil, err
+	}
+	var snapshotID string
+	var snapshotAt time.Time
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].CreatedAt.Before(before) && records[i].Trigger != "pre_restore" {
+			snapshotID, snapshotAt = records[i].SnapshotID, records[i].CreatedAt
+			break
+		}
+	}
+	if snapshotID == "" {
+		return nil, fmt.Errorf("no snapshot taken before %s", before.UTC().Format(time.RFC3339))
+	}
+	record, err := s.snapRepo.FindBySnapshotID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	_, files, _, err := s.svc.openIndex(record, password)
+	if err != nil {
+		return nil, err
+	}
+	config, ok := files[configLogicalPath]
+	if !ok {
+		return nil, fmt.Errorf("snapshot %s has no openclaw config", snapshotID)
+	}
+	pre, err := s.svc.Create("auto pre-rollback backup", "pre_restore", password, nil)
+	if err != nil {
+		return nil, fmt.Errorf("pre-rollback backup: %w", err)
+	}
+	if err := s.svc.writeResource(configLogicalPath, config); err != nil {
+		return nil, err
+	}
+	return &ConfigRollback{SnapshotID: snapshotID, SnapshotAt: snapshotAt, PreRestoreSnapshotID: pre.SnapshotID}, nil
+}
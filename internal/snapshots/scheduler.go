@@ -2,7 +2,10 @@ package snapshots
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -10,6 +13,7 @@ import (
 
 	"ClawDeckX/internal/constants"
 	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/logger"
 )
 
 const (
@@ -23,9 +27,21 @@ const (
 	settingScheduleLastStatus    = "snapshot_schedule_last_status"
 	settingScheduleLastError     = "snapshot_schedule_last_error"
 	settingScheduleLastSnapshot  = "snapshot_schedule_last_snapshot_id"
-	settingScheduleLastRunDate   = "snapshot_schedule_last_run_date"
 )
 
+const (
+	// DefaultNoteTemplate is the note of scheduled snapshots. Templates may
+	// use {name}, {date}, {time} and {datetime}, rendered in the schedule's
+	// timezone.
+	DefaultNoteTemplate = "auto scheduled backup"
+	// nextRunsShown is how many upcoming runs the status API lists.
+	nextRunsShown = 5
+	// catchUpSlack separates a late tick from a missed run.
+	catchUpSlack = 2 * time.Minute
+)
+
+// ScheduleConfig is the single-schedule view of the first schedule, kept for
+// clients of the original daily HH:MM API.
 type ScheduleConfig struct {
 	Enabled        bool   `json:"enabled"`
 	Time           string `json:"time"`
@@ -43,28 +59,67 @@ type ScheduleUpdateRequest struct {
 }
 
 type ScheduleStatus struct {
-	LastRunAt      string `json:"lastRunAt,omitempty"`
-	LastSuccessAt  string `json:"lastSuccessAt,omitempty"`
-	LastStatus     string `json:"lastStatus"`
-	LastError      string `json:"lastError,omitempty"`
-	LastSnapshotID string `json:"lastSnapshotId,omitempty"`
-	Running        bool   `json:"running"`
+	LastRunAt      string         `json:"lastRunAt,omitempty"`
+	LastSuccessAt  string         `json:"lastSuccessAt,omitempty"`
+	LastStatus     string         `json:"lastStatus"`
+	LastError      string         `json:"lastError,omitempty"`
+	LastSnapshotID string         `json:"lastSnapshotId,omitempty"`
+	Running        bool           `json:"running"`
+	NextRuns       []time.Time    `json:"nextRuns"` // across all enabled schedules
+	Schedules      []ScheduleView `json:"schedules"`
+}
+
+// ScheduleView is a schedule as returned by the API.
+type ScheduleView struct {
+	ID             uint            `json:"id"`
+	Name           string          `json:"name"`
+	Cron           string          `json:"cron"`
+	Timezone       string          `json:"timezone"`
+	Enabled        bool            `json:"enabled"`
+	ResourceIDs    []string        `json:"resourceIds,omitempty"`
+	NoteTemplate   string          `json:"noteTemplate"`
+	Retention      RetentionPolicy `json:"retention"`
+	NextRuns       []time.Time     `json:"nextRuns"`
+	LastRunAt      *time.Time      `json:"lastRunAt,omitempty"`
+	LastSuccessAt  *time.Time      `json:"lastSuccessAt,omitempty"`
+	LastStatus     string          `json:"lastStatus"`
+	LastError      string          `json:"lastError,omitempty"`
+	LastSnapshotID string          `json:"lastSnapshotId,omitempty"`
+}
+
+// ScheduleInput creates or replaces a schedule.
+type ScheduleInput struct {
+	Name         string          `json:"name"`
+	Cron         string          `json:"cron"`
+	Timezone     string          `json:"timezone"`
+	Enabled      bool            `json:"enabled"`
+	ResourceIDs  []string        `json:"resourceIds"`
+	NoteTemplate string          `json:"noteTemplate"`
+	Retention    RetentionPolicy `json:"retention"`
 }
 
+// ErrScheduleNotFound is returned for an unknown schedule ID.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
 type Scheduler struct {
 	svc       *Service
 	setting   *database.SettingRepo
+	schedules *database.SnapshotScheduleRepo
+	snapRepo  *database.SnapshotRepo
 	auditRepo *database.AuditLogRepo
 	deviceID  string
 
-	mu      sync.Mutex
-	running bool
+	initOnce sync.Once
+	mu       sync.Mutex
+	running  bool
 }
 
 func NewScheduler(svc *Service) *Scheduler {
 	return &Scheduler{
 		svc:       svc,
 		setting:   database.NewSettingRepo(),
+		schedules: database.NewSnapshotScheduleRepo(),
+		snapRepo:  database.NewSnapshotRepo(),
 		auditRepo: database.NewAuditLogRepo(),
 	}
 }
@@ -73,41 +128,97 @@ func (s *Scheduler) SetDeviceID(id string) {
 	s.deviceID = id
 }
 
+// Start runs due schedules until ctx is done. A run missed while the
+// process was down or the host was asleep is caught up on the first tick.
 func (s *Scheduler) Start(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	s.runIfNeeded()
+	s.tick(time.Now())
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.runIfNeeded()
+			s.tick(time.Now())
 		}
 	}
 }
 
+// ensureSchedules converts the original single daily schedule, kept in
+// settings, into the first schedule row.
+func (s *Scheduler) ensureSchedules() {
+	s.initOnce.Do(func() {
+		if n, err := s.schedules.Count(); err != nil || n > 0 {
+			return
+		}
+		timeStr := s.getString(settingScheduleTime, "03:00")
+		h, m := parseHM(timeStr)
+		if h < 0 {
+			h, m = 3, 0
+		}
+		retention := s.getInt(settingScheduleRetention, 7)
+		if retention < 1 {
+			retention = 1
+		}
+		sched := &database.SnapshotSchedule{
+			Name:         "Daily backup",
+			Cron:         fmt.Sprintf("%d %d * * *", m, h),
+			Timezone:     s.getString(settingScheduleTimezone, DefaultScheduleTimezone),
+			Enabled:      s.getBool(settingScheduleEnabled, false),
+			NoteTemplate: DefaultNoteTemplate,
+			KeepLast:     retention,
+			LastStatus:   s.getString(settingScheduleLastStatus, ScheduleStatusNever),
+			LastError:    s.getString(settingScheduleLastError, ""),
+		}
+		sched.LastSnapshotID = s.getString(settingScheduleLastSnapshot, "")
+		sched.LastRunAt = s.getTime(settingScheduleLastRunAt)
+		sched.LastSuccessAt = s.getTime(settingScheduleLastSuccessAt)
+		// Continue from the last legacy run so a run missed during the
+		// upgrade is still caught up.
+		from := time.Now()
+		if sched.LastRunAt != nil {
+			from = *sched.LastRunAt
+		}
+		sched.NextRunAt = nextRun(sched, from)
+		if err := s.schedules.Save(sched); err != nil {
+			logger.Backup.Error().Err(err).Msg("create default snapshot schedule")
+			return
+		}
+		_ = s.snapRepo.AssignSchedule(ScheduledSnapshotTag, sched.ID)
+	})
+}
+
+// GetConfig returns the first schedule in the original single-schedule shape.
 func (s *Scheduler) GetConfig() (*ScheduleConfig, error) {
-	enabled := s.getBool(settingScheduleEnabled, false)
-	timeStr := s.getString(settingScheduleTime, "03:00")
-	retention := s.getInt(settingScheduleRetention, 7)
-	tz := s.getString(settingScheduleTimezone, DefaultScheduleTimezone)
+	s.ensureSchedules()
 	_, err := s.setting.Get(settingSchedulePassword)
-	passwordSet := err == nil
-	if retention < 1 {
-		retention = 1
+	cfg := &ScheduleConfig{
+		Time:           "03:00",
+		RetentionCount: 7,
+		Timezone:       DefaultScheduleTimezone,
+		PasswordSet:    err == nil,
+	}
+	sched, err := s.schedules.First()
+	if err != nil {
+		return cfg, nil
+	}
+	cfg.Enabled = sched.Enabled
+	cfg.Time = dailyTime(sched.Cron)
+	cfg.RetentionCount = sched.KeepLast
+	if cfg.RetentionCount < 1 {
+		cfg.RetentionCount = 1
 	}
-	return &ScheduleConfig{
-		Enabled:        enabled,
-		Time:           timeStr,
-		RetentionCount: retention,
-		Timezone:       tz,
-		PasswordSet:    passwordSet,
-	}, nil
+	if sched.Timezone != "" {
+		cfg.Timezone = sched.Timezone
+	}
+	return cfg, nil
 }
 
+// UpdateConfig applies the single-schedule settings to the first schedule
+// and stores the schedule password shared by all schedules.
 func (s *Scheduler) UpdateConfig(req ScheduleUpdateRequest, userID uint, username, ip string) error {
+	s.ensureSchedules()
 	timeStr := strings.TrimSpace(req.Time)
 	if !isValidScheduleTime(timeStr) {
 		return fmt.Errorf("invalid schedule time")
@@ -119,43 +230,30 @@ func (s *Scheduler) UpdateConfig(req ScheduleUpdateRequest, userID uint, usernam
 	if tz == "" {
 		tz = DefaultScheduleTimezone
 	}
-	if tz != DefaultScheduleTimezone && tz != "UTC" {
-		if _, loadErr := time.LoadLocation(tz); loadErr != nil {
-			return fmt.Errorf("unsupported timezone: %s", tz)
-		}
+	if _, err := scheduleLocation(tz); err != nil {
+		return err
 	}
 	if req.Password != "" && len(req.Password) < 6 {
 		return fmt.Errorf("password too short")
 	}
-	if req.Enabled {
-		hasPassword := req.Password != ""
-		if !hasPassword {
-			if p, err := s.setting.Get(settingSchedulePassword); err == nil && p != "" {
-				hasPassword = true
-			}
-		}
-		if !hasPassword {
-			return fmt.Errorf("schedule password required")
-		}
+	if req.Enabled && req.Password == "" && !s.passwordSet() {
+		return fmt.Errorf("schedule password required")
 	}
-	items := map[string]string{
-		settingScheduleEnabled:   strconv.FormatBool(req.Enabled),
-		settingScheduleTime:      timeStr,
-		settingScheduleRetention: strconv.Itoa(req.RetentionCount),
-		settingScheduleTimezone:  tz,
-	}
-	if req.Password != "" {
-		if s.deviceID != "" {
-			enc, err := EncryptSchedulePassword(req.Password, s.deviceID)
-			if err != nil {
-				return fmt.Errorf("encrypt password: %w", err)
-			}
-			items[settingSchedulePassword] = enc
-		} else {
-			items[settingSchedulePassword] = req.Password
-		}
+	if err := s.savePassword(req.Password); err != nil {
+		return err
 	}
-	if err := s.setting.SetBatch(items); err != nil {
+
+	sched, err := s.schedules.First()
+	if err != nil {
+		sched = &database.SnapshotSchedule{Name: "Daily backup", NoteTemplate: DefaultNoteTemplate, LastStatus: ScheduleStatusNever}
+	}
+	h, m := parseHM(timeStr)
+	sched.Cron = fmt.Sprintf("%d %d * * *", m, h)
+	sched.Timezone = tz
+	sched.Enabled = req.Enabled
+	sched.KeepLast = req.RetentionCount
+	sched.NextRunAt = nextRun(sched, time.Now())
+	if err := s.schedules.Save(sched); err != nil {
 		return err
 	}
 	_ = s.auditRepo.Create(&database.AuditLog{
@@ -169,52 +267,216 @@ func (s *Scheduler) UpdateConfig(req ScheduleUpdateRequest, userID uint, usernam
 	return nil
 }
 
+// ListSchedules returns all schedules with their upcoming runs.
+func (s *Scheduler) ListSchedules() ([]ScheduleView, error) {
+	s.ensureSchedules()
+	list, err := s.schedules.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	out := make([]ScheduleView, 0, len(list))
+	for i := range list {
+		out = append(out, scheduleView(&list[i], now))
+	}
+	return out, nil
+}
+
+// CreateSchedule adds a schedule.
+func (s *Scheduler) CreateSchedule(in ScheduleInput, userID uint, username, ip string) (*ScheduleView, error) {
+	s.ensureSchedules()
+	sched := &database.SnapshotSchedule{LastStatus: ScheduleStatusNever}
+	if err := s.applyInput(sched, in); err != nil {
+		return nil, err
+	}
+	if err := s.schedules.Save(sched); err != nil {
+		return nil, err
+	}
+	s.auditSchedule(constants.ActionSnapshotScheduleCreate, sched, userID, username, ip)
+	v := scheduleView(sched, time.Now())
+	return &v, nil
+}
+
+// UpdateSchedule replaces the definition of a schedule. Its run history and
+// snapshots are kept.
+func (s *Scheduler) UpdateSchedule(id uint, in ScheduleInput, userID uint, username, ip string) (*ScheduleView, error) {
+	sched, err := s.schedules.GetByID(id)
+	if err != nil {
+		return nil, ErrScheduleNotFound
+	}
+	if err := s.applyInput(sched, in); err != nil {
+		return nil, err
+	}
+	if err := s.schedules.Save(sched); err != nil {
+		return nil, err
+	}
+	s.auditSchedule(constants.ActionSnapshotScheduleUpdate, sched, userID, username, ip)
+	v := scheduleView(sched, time.Now())
+	return &v, nil
+}
+
+// DeleteSchedule removes a schedule. Snapshots it created are kept and no
+// longer pruned.
+func (s *Scheduler) DeleteSchedule(id uint, userID uint, username, ip string) error {
+	sched, err := s.schedules.GetByID(id)
+	if err != nil {
+		return ErrScheduleNotFound
+	}
+	if err := s.schedules.Delete(id); err != nil {
+		return err
+	}
+	s.auditSchedule(constants.ActionSnapshotScheduleDelete, sched, userID, username, ip)
+	return nil
+}
+
+func (s *Scheduler) applyInput(sched *database.SnapshotSchedule, in ScheduleInput) error {
+	in.Name = strings.TrimSpace(in.Name)
+	if in.Name == "" || len(in.Name) > 100 {
+		return fmt.Errorf("name is required (max 100 characters)")
+	}
+	in.Cron = strings.TrimSpace(in.Cron)
+	if _, err := ParseCron(in.Cron); err != nil {
+		return fmt.Errorf("invalid cron expression: %w", err)
+	}
+	in.Timezone = strings.TrimSpace(in.Timezone)
+	if in.Timezone == "" {
+		in.Timezone = DefaultScheduleTimezone
+	}
+	if _, err := scheduleLocation(in.Timezone); err != nil {
+		return err
+	}
+	if len(in.NoteTemplate) > 255 {
+		return fmt.Errorf("note template too long")
+	}
+	if err := in.Retention.validate(); err != nil {
+		return err
+	}
+	if in.Enabled && !s.passwordSet() {
+		return fmt.Errorf("schedule password required")
+	}
+	sched.Name = in.Name
+	sched.Cron = in.Cron
+	sched.Timezone = in.Timezone
+	sched.Enabled = in.Enabled
+	sched.NoteTemplate = in.NoteTemplate
+	sched.ResourceIDsJSON = ""
+	if len(in.ResourceIDs) > 0 {
+		raw, _ := json.Marshal(in.ResourceIDs)
+		sched.ResourceIDsJSON = string(raw)
+	}
+	sched.KeepLast = in.Retention.KeepLast
+	sched.KeepHourly = in.Retention.KeepHourly
+	sched.KeepDaily = in.Retention.KeepDaily
+	sched.KeepWeekly = in.Retention.KeepWeekly
+	sched.KeepMonthly = in.Retention.KeepMonthly
+	sched.NextRunAt = nextRun(sched, time.Now())
+	return nil
+}
+
+// GetStatus reports the most recent run across schedules and the runs
+// planned next.
 func (s *Scheduler) GetStatus() (*ScheduleStatus, error) {
+	views, err := s.ListSchedules()
+	if err != nil {
+		return nil, err
+	}
 	status := &ScheduleStatus{
-		LastRunAt:      s.getString(settingScheduleLastRunAt, ""),
-		LastSuccessAt:  s.getString(settingScheduleLastSuccessAt, ""),
-		LastStatus:     s.getString(settingScheduleLastStatus, ScheduleStatusNever),
-		LastError:      s.getString(settingScheduleLastError, ""),
-		LastSnapshotID: s.getString(settingScheduleLastSnapshot, ""),
-		Running:        s.isRunning(),
+		LastStatus: ScheduleStatusNever,
+		Running:    s.isRunning(),
+		NextRuns:   []time.Time{},
+		Schedules:  views,
+	}
+	var latest *ScheduleView
+	var lastSuccess *time.Time
+	for i := range views {
+		v := &views[i]
+		if v.LastRunAt != nil && (latest == nil || v.LastRunAt.After(*latest.LastRunAt)) {
+			latest = v
+		}
+		if v.LastSuccessAt != nil && (lastSuccess == nil || v.LastSuccessAt.After(*lastSuccess)) {
+			lastSuccess = v.LastSuccessAt
+		}
+		if v.Enabled {
+			status.NextRuns = append(status.NextRuns, v.NextRuns...)
+		}
+	}
+	if latest != nil {
+		status.LastRunAt = latest.LastRunAt.UTC().Format(time.RFC3339)
+		status.LastStatus = latest.LastStatus
+		status.LastError = latest.LastError
+		status.LastSnapshotID = latest.LastSnapshotID
+	}
+	if lastSuccess != nil {
+		status.LastSuccessAt = lastSuccess.UTC().Format(time.RFC3339)
 	}
-	if status.LastStatus == "" {
-		status.LastStatus = ScheduleStatusNever
+	sort.Slice(status.NextRuns, func(i, j int) bool { return status.NextRuns[i].Before(status.NextRuns[j]) })
+	if len(status.NextRuns) > nextRunsShown {
+		status.NextRuns = status.NextRuns[:nextRunsShown]
 	}
 	return status, nil
 }
 
-func (s *Scheduler) runIfNeeded() {
-	if !s.getBool(settingScheduleEnabled, false) {
-		return
-	}
-	cfg, err := s.GetConfig()
+// tick runs every enabled schedule whose next run time has passed.
+func (s *Scheduler) tick(now time.Time) {
+	s.ensureSchedules()
+	list, err := s.schedules.List()
 	if err != nil {
 		return
 	}
-	now := time.Now()
-	if cfg.Timezone == "UTC" {
-		now = now.UTC()
-	} else if cfg.Timezone != "" && cfg.Timezone != DefaultScheduleTimezone {
-		if loc, err := time.LoadLocation(cfg.Timezone); err == nil {
-			now = now.In(loc)
+	for i := range list {
+		sched := &list[i]
+		if !sched.Enabled {
+			continue
+		}
+		if sched.NextRunAt == nil {
+			sched.NextRunAt = nextRun(sched, now)
+			_ = s.schedules.Save(sched)
+			continue
 		}
+		due := *sched.NextRunAt
+		if due.After(now) {
+			continue
+		}
+		// Plan the next run first so a failing run is not retried every tick.
+		sched.NextRunAt = nextRun(sched, now)
+		_ = s.schedules.Save(sched)
+		label := ""
+		if now.Sub(due) > catchUpSlack {
+			label = " (catch-up of " + due.UTC().Format(time.RFC3339) + ")"
+			logger.Backup.Info().Str("schedule", sched.Name).Time("missed", due).Msg("catching up missed scheduled snapshot")
+		}
+		_, _ = s.runSchedule(sched, 0, "", "system", label)
 	}
-	nowHM := now.Format("15:04")
-	schH, schM := parseHM(cfg.Time)
-	nowH, nowM := parseHM(nowHM)
-	if nowH != schH || nowM < schM || nowM > schM+1 {
-		return
+}
+
+// RunNow triggers a schedule immediately regardless of its cron expression.
+// A zero scheduleID runs the first schedule.
+func (s *Scheduler) RunNow(scheduleID uint, userID uint, username, ip string) (*ScheduleRunNowResponse, error) {
+	s.ensureSchedules()
+	var sched *database.SnapshotSchedule
+	var err error
+	if scheduleID == 0 {
+		sched, err = s.schedules.First()
+	} else {
+		sched, err = s.schedules.GetByID(scheduleID)
 	}
-	today := now.Format("2006-01-02")
-	if s.getString(settingScheduleLastRunDate, "") == today {
-		return
+	if err != nil {
+		return nil, ErrScheduleNotFound
+	}
+	rec, err := s.runSchedule(sched, userID, username, ip, " (manual trigger)")
+	if err != nil {
+		return nil, err
 	}
+	return &ScheduleRunNowResponse{SnapshotID: rec.SnapshotID}, nil
+}
 
+// runSchedule creates a snapshot for sched, applies its retention policy and
+// records the outcome on the schedule.
+func (s *Scheduler) runSchedule(sched *database.SnapshotSchedule, userID uint, username, ip, label string) (*database.SnapshotRecord, error) {
 	s.mu.Lock()
 	if s.running {
 		s.mu.Unlock()
-		return
+		return nil, fmt.Errorf("a scheduled backup is already running")
 	}
 	s.running = true
 	s.mu.Unlock()
@@ -224,47 +486,48 @@ func (s *Scheduler) runIfNeeded() {
 		s.mu.Unlock()
 	}()
 
-	nowRFC3339 := now.UTC().Format(time.RFC3339)
-	_ = s.setting.SetBatch(map[string]string{
-		settingScheduleLastRunAt:   nowRFC3339,
-		settingScheduleLastRunDate: today,
-	})
-
-	rawPassword, err := s.setting.Get(settingSchedulePassword)
-	if err != nil || rawPassword == "" {
-		s.markFailed(nowRFC3339, "schedule password not configured")
-		return
-	}
-	password := rawPassword
-	if s.deviceID != "" {
-		if dec, decErr := DecryptSchedulePassword(rawPassword, s.deviceID); decErr == nil {
-			password = dec
-		}
-	}
-
-	rec, err := s.svc.Create("auto scheduled backup", ScheduledSnapshotTag, password, nil)
+	now := time.Now().UTC()
+	sched.LastRunAt = &now
+	loc, err := scheduleLocation(sched.Timezone)
 	if err != nil {
-		s.markFailed(nowRFC3339, err.Error())
-		return
+		loc = time.Local
 	}
 
+	password, err := s.password()
+	if err == nil {
+		var rec *database.SnapshotRecord
+		rec, err = s.svc.CreateScheduled(sched.ID, renderNote(sched, now.In(loc)), password, scheduleResourceIDs(sched))
+		if err == nil {
+			s.finishRun(sched, rec, userID, username, ip, label, loc)
+			return rec, nil
+		}
+	}
+	sched.LastStatus = ScheduleStatusFailed
+	sched.LastError = err.Error()
+	_ = s.schedules.Save(sched)
 	_ = s.auditRepo.Create(&database.AuditLog{
-		Action: constants.ActionSnapshotScheduleRun,
-		Result: "success",
-		Detail: rec.SnapshotID,
-		IP:     "system",
+		UserID:   userID,
+		Username: username,
+		Action:   constants.ActionSnapshotScheduleRun,
+		Result:   "failed",
+		Detail:   sched.Name + ": " + err.Error(),
+		IP:       ip,
 	})
+	return nil, err
+}
 
-	prunedIDs, pruneErr := s.svc.PruneScheduledBackups(cfg.RetentionCount)
-	if pruneErr == nil {
-		_ = s.auditRepo.Create(&database.AuditLog{
-			Action: constants.ActionSnapshotSchedulePrune,
-			Result: "success",
-			Detail: fmt.Sprintf("retention=%d,pruned=%d", cfg.RetentionCount, len(prunedIDs)),
-			IP:     "system",
-		})
-	}
+func (s *Scheduler) finishRun(sched *database.SnapshotSchedule, rec *database.SnapshotRecord, userID uint, username, ip, label string, loc *time.Location) {
+	_ = s.auditRepo.Create(&database.AuditLog{
+		UserID:   userID,
+		Username: username,
+		Action:   constants.ActionSnapshotScheduleRun,
+		Result:   "success",
+		Detail:   rec.SnapshotID + label,
+		IP:       ip,
+	})
 
+	policy := schedulePolicy(sched)
+	pruned, pruneErr := s.svc.PruneSchedule(sched.ID, policy, loc)
 	lastError := ""
 	if pruneErr != nil {
 		lastError = pruneErr.Error()
@@ -274,29 +537,79 @@ func (s *Scheduler) runIfNeeded() {
 			Detail: pruneErr.Error(),
 			IP:     "system",
 		})
+	} else if len(pruned) > 0 {
+		_ = s.auditRepo.Create(&database.AuditLog{
+			Action: constants.ActionSnapshotSchedulePrune,
+			Result: "success",
+			Detail: fmt.Sprintf("%s: last=%d,hourly=%d,daily=%d,weekly=%d,monthly=%d,pruned=%d", sched.Name,
+				policy.KeepLast, policy.KeepHourly, policy.KeepDaily, policy.KeepWeekly, policy.KeepMonthly, len(pruned)),
+			IP: "system",
+		})
 	}
-	_ = s.setting.SetBatch(map[string]string{
-		settingScheduleLastSuccessAt: nowRFC3339,
-		settingScheduleLastStatus:    ScheduleStatusSuccess,
-		settingScheduleLastError:     lastError,
-		settingScheduleLastSnapshot:  rec.SnapshotID,
-	})
+	sched.LastSuccessAt = sched.LastRunAt
+	sched.LastStatus = ScheduleStatusSuccess
+	sched.LastError = lastError
+	sched.LastSnapshotID = rec.SnapshotID
+	_ = s.schedules.Save(sched)
 }
 
-func (s *Scheduler) markFailed(lastRunAt, detail string) {
-	_ = s.setting.SetBatch(map[string]string{
-		settingScheduleLastRunAt:  lastRunAt,
-		settingScheduleLastStatus: ScheduleStatusFailed,
-		settingScheduleLastError:  detail,
-	})
+func (s *Scheduler) auditSchedule(action string, sched *database.SnapshotSchedule, userID uint, username, ip string) {
 	_ = s.auditRepo.Create(&database.AuditLog{
-		Action: constants.ActionSnapshotScheduleRun,
-		Result: "failed",
-		Detail: detail,
-		IP:     "system",
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Result:   "success",
+		Detail:   fmt.Sprintf("%s: cron=%q,enabled=%t", sched.Name, sched.Cron, sched.Enabled),
+		IP:       ip,
 	})
 }
 
+func (s *Scheduler) password() (string, error) {
+	raw, err := s.setting.Get(settingSchedulePassword)
+	if err != nil || raw == "" {
+		return "", fmt.Errorf("schedule password not configured")
+	}
+	if s.deviceID != "" {
+		if dec, decErr := DecryptSchedulePassword(raw, s.deviceID); decErr == nil {
+			return dec, nil
+		}
+	}
+	return raw, nil
+}
+
+func (s *Scheduler) passwordSet() bool {
+	p, err := s.setting.Get(settingSchedulePassword)
+	return err == nil && p != ""
+}
+
+func (s *Scheduler) savePassword(password string) error {
+	if password == "" {
+		return nil
+	}
+	stored := password
+	if s.deviceID != "" {
+		enc, err := EncryptSchedulePassword(password, s.deviceID)
+		if err != nil {
+			return fmt.Errorf("encrypt password: %w", err)
+		}
+		stored = enc
+	}
+	return s.setting.Set(settingSchedulePassword, stored)
+}
+
+// ReplacePassword swaps the stored schedule password for newPassword when it
+// is currently oldPassword, so scheduled snapshots follow a Rewrap.
+func (s *Scheduler) ReplacePassword(oldPassword, newPassword string) (bool, error) {
+	current, err := s.password()
+	if err != nil || current != oldPassword {
+		return false, nil
+	}
+	if err := s.savePassword(newPassword); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (s *Scheduler) isRunning() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -335,88 +648,148 @@ func (s *Scheduler) getBool(key string, fallback bool) bool {
 	return b
 }
 
-func isValidScheduleTime(v string) bool {
-	if len(v) != 5 {
-		return false
+func (s *Scheduler) getTime(key string) *time.Time {
+	t, err := time.Parse(time.RFC3339, s.getString(key, ""))
+	if err != nil {
+		return nil
 	}
-	_, err := time.Parse("15:04", v)
-	return err == nil
+	return &t
 }
 
-func parseHM(hm string) (int, int) {
-	parts := strings.SplitN(hm, ":", 2)
-	if len(parts) != 2 {
-		return -1, -1
-	}
-	h, err1 := strconv.Atoi(parts[0])
-	m, err2 := strconv.Atoi(parts[1])
-	if err1 != nil || err2 != nil {
-		return -1, -1
+func scheduleView(sched *database.SnapshotSchedule, now time.Time) ScheduleView {
+	v := ScheduleView{
+		ID:             sched.ID,
+		Name:           sched.Name,
+		Cron:           sched.Cron,
+		Timezone:       sched.Timezone,
+		Enabled:        sched.Enabled,
+		ResourceIDs:    scheduleResourceIDs(sched),
+		NoteTemplate:   sched.NoteTemplate,
+		Retention:      schedulePolicy(sched),
+		NextRuns:       []time.Time{},
+		LastRunAt:      sched.LastRunAt,
+		LastSuccessAt:  sched.LastSuccessAt,
+		LastStatus:     sched.LastStatus,
+		LastError:      sched.LastError,
+		LastSnapshotID: sched.LastSnapshotID,
+	}
+	if v.LastStatus == "" {
+		v.LastStatus = ScheduleStatusNever
+	}
+	if !sched.Enabled {
+		return v
+	}
+	cron, err := ParseCron(sched.Cron)
+	loc, locErr := scheduleLocation(sched.Timezone)
+	if err != nil || locErr != nil {
+		return v
+	}
+	// A missed run that has not been caught up yet comes first.
+	from := now.In(loc)
+	if sched.NextRunAt != nil && sched.NextRunAt.Before(now) {
+		v.NextRuns = append(v.NextRuns, *sched.NextRunAt)
+	}
+	v.NextRuns = append(v.NextRuns, cron.NextN(from, nextRunsShown-len(v.NextRuns))...)
+	return v
+}
+
+func schedulePolicy(sched *database.SnapshotSchedule) RetentionPolicy {
+	return RetentionPolicy{
+		KeepLast:    sched.KeepLast,
+		KeepHourly:  sched.KeepHourly,
+		KeepDaily:   sched.KeepDaily,
+		KeepWeekly:  sched.KeepWeekly,
+		KeepMonthly: sched.KeepMonthly,
 	}
-	return h, m
 }
 
-// RunNow triggers an immediate scheduled backup regardless of the configured time.
-func (s *Scheduler) RunNow(userID uint, username, ip string) (*ScheduleRunNowResponse, error) {
-	s.mu.Lock()
-	if s.running {
-		s.mu.Unlock()
-		return nil, fmt.Errorf("a scheduled backup is already running")
+func scheduleResourceIDs(sched *database.SnapshotSchedule) []string {
+	if sched.ResourceIDsJSON == "" {
+		return nil
 	}
-	s.running = true
-	s.mu.Unlock()
-	defer func() {
-		s.mu.Lock()
-		s.running = false
-		s.mu.Unlock()
-	}()
+	var ids []string
+	_ = json.Unmarshal([]byte(sched.ResourceIDsJSON), &ids)
+	return ids
+}
 
-	cfg, err := s.GetConfig()
+// nextRun returns the first run of sched after t, or nil when its cron
+// expression or timezone is invalid or never fires.
+func nextRun(sched *database.SnapshotSchedule, t time.Time) *time.Time {
+	cron, err := ParseCron(sched.Cron)
 	if err != nil {
-		return nil, err
+		return nil
 	}
-
-	rawPassword, err := s.setting.Get(settingSchedulePassword)
-	if err != nil || rawPassword == "" {
-		return nil, fmt.Errorf("schedule password not configured")
+	loc, err := scheduleLocation(sched.Timezone)
+	if err != nil {
+		return nil
 	}
-	password := rawPassword
-	if s.deviceID != "" {
-		if dec, decErr := DecryptSchedulePassword(rawPassword, s.deviceID); decErr == nil {
-			password = dec
-		}
+	next := cron.Next(t.In(loc))
+	if next.IsZero() {
+		return nil
 	}
+	next = next.UTC()
+	return &next
+}
 
-	nowRFC3339 := time.Now().UTC().Format(time.RFC3339)
-	_ = s.setting.SetBatch(map[string]string{
-		settingScheduleLastRunAt: nowRFC3339,
-	})
+func renderNote(sched *database.SnapshotSchedule, t time.Time) string {
+	tpl := sched.NoteTemplate
+	if tpl == "" {
+		tpl = DefaultNoteTemplate
+	}
+	return strings.NewReplacer(
+		"{name}", sched.Name,
+		"{date}", t.Format("2006-01-02"),
+		"{time}", t.Format("15:04"),
+		"{datetime}", t.Format("2006-01-02 15:04"),
+	).Replace(tpl)
+}
 
-	rec, createErr := s.svc.Create("manual trigger of scheduled backup", ScheduledSnapshotTag, password, nil)
-	if createErr != nil {
-		s.markFailed(nowRFC3339, createErr.Error())
-		return nil, createErr
+func scheduleLocation(tz string) (*time.Location, error) {
+	switch tz {
+	case "", DefaultScheduleTimezone:
+		return time.Local, nil
+	case "UTC":
+		return time.UTC, nil
 	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported timezone: %s", tz)
+	}
+	return loc, nil
+}
 
-	_ = s.auditRepo.Create(&database.AuditLog{
-		UserID:   userID,
-		Username: username,
-		Action:   constants.ActionSnapshotScheduleRun,
-		Result:   "success",
-		Detail:   rec.SnapshotID + " (manual trigger)",
-		IP:       ip,
-	})
-
-	if cfg.RetentionCount > 0 {
-		_, _ = s.svc.PruneScheduledBackups(cfg.RetentionCount)
+// dailyTime returns "HH:MM" for a "M H * * *" expression, or "" for any
+// other schedule.
+func dailyTime(expr string) string {
+	f := strings.Fields(expr)
+	if len(f) != 5 || f[2] != "*" || f[3] != "*" || f[4] != "*" {
+		return ""
+	}
+	m, err1 := strconv.Atoi(f[0])
+	h, err2 := strconv.Atoi(f[1])
+	if err1 != nil || err2 != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return ""
 	}
+	return fmt.Sprintf("%02d:%02d", h, m)
+}
 
-	_ = s.setting.SetBatch(map[string]string{
-		settingScheduleLastSuccessAt: nowRFC3339,
-		settingScheduleLastStatus:    ScheduleStatusSuccess,
-		settingScheduleLastError:     "",
-		settingScheduleLastSnapshot:  rec.SnapshotID,
-	})
+func isValidScheduleTime(v string) bool {
+	if len(v) != 5 {
+		return false
+	}
+	_, err := time.Parse("15:04", v)
+	return err == nil
+}
 
-	return &ScheduleRunNowResponse{SnapshotID: rec.SnapshotID}, nil
+func parseHM(hm string) (int, int) {
+	parts := strings.SplitN(hm, ":", 2)
+	if len(parts) != 2 {
+		return -1, -1
+	}
+	h, err1 := strconv.Atoi(parts[0])
+	m, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return -1, -1
+	}
+	return h, m
 }
@@ -0,0 +1,106 @@
+package snapshots
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/constants"
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler_MigratesLegacySettings(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	settings := database.NewSettingRepo()
+	require.NoError(t, settings.SetBatch(map[string]string{
+		settingScheduleEnabled:   "true",
+		settingScheduleTime:      "04:30",
+		settingScheduleRetention: "5",
+		settingScheduleTimezone:  "UTC",
+	}))
+	addTestSnapshot(t, "snap_legacy", time.Now().UTC())
+
+	s := NewScheduler(NewService())
+	cfg, err := s.GetConfig()
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled)
+	assert.Equal(t, "04:30", cfg.Time)
+	assert.Equal(t, 5, cfg.RetentionCount)
+
+	list, err := s.ListSchedules()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "30 4 * * *", list[0].Cron)
+	assert.Len(t, list[0].NextRuns, nextRunsShown)
+
+	recs, err := database.NewSnapshotRepo().ListBySchedule(list[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+}
+
+func TestScheduler_CatchesUpMissedRunOnce(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	s := NewScheduler(NewService())
+	missed := time.Now().UTC().Add(-26 * time.Hour)
+	sched := &database.SnapshotSchedule{Name: "nightly", Cron: "0 * * * *", Timezone: "UTC", Enabled: true, NextRunAt: &missed}
+	require.NoError(t, s.schedules.Save(sched))
+
+	// No schedule password is configured, so the run fails, but it is
+	// attempted once and the next run moves into the future.
+	now := time.Now()
+	s.tick(now)
+	got, err := s.schedules.GetByID(sched.ID)
+	require.NoError(t, err)
+	require.NotNil(t, got.LastRunAt)
+	assert.Equal(t, ScheduleStatusFailed, got.LastStatus)
+	require.NotNil(t, got.NextRunAt)
+	assert.True(t, got.NextRunAt.After(now))
+
+	s.tick(now)
+	runs, err := database.NewAuditLogRepo().ListByAction(constants.ActionSnapshotScheduleRun, 10)
+	require.NoError(t, err)
+	assert.Len(t, runs, 1)
+}
+
+func TestScheduler_RollbackConfig(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	config := writeStateFile(t, dir, "openclaw.json", `{"agents":{"defaults":{"maxConcurrent":4}}}`)
+
+	svc := NewService()
+	s := NewScheduler(svc)
+	_, err := s.RollbackConfig(time.Now())
+	assert.ErrorContains(t, err, "password not configured")
+	require.NoError(t, s.savePassword(testPassword))
+	_, err = s.RollbackConfig(time.Now())
+	assert.ErrorContains(t, err, "no snapshot taken before")
+
+	good, err := svc.Create("known good", DefaultSnapshotTag, testPassword, nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(config, []byte(`{"agents":{"defaults":{"maxConcurrent":64}}}`), 0o600))
+
+	res, err := s.RollbackConfig(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, good.SnapshotID, res.SnapshotID)
+	got, err := os.ReadFile(config)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"agents":{"defaults":{"maxConcurrent":4}}}`, string(got))
+
+	// The replaced config is kept, and never chosen by a later rollback.
+	pre, err := database.NewSnapshotRepo().FindBySnapshotID(res.PreRestoreSnapshotID)
+	require.NoError(t, err)
+	assert.Equal(t, "pre_restore", pre.Trigger)
+	again, err := s.RollbackConfig(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, good.SnapshotID, again.SnapshotID)
+}
@@ -1,6 +1,7 @@
 package snapshots
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -21,22 +22,44 @@ import (
 )
 
 type unlockedBundle struct {
-	Manifest SnapshotManifest
-	Files    map[string][]byte
-	ExpireAt time.Time
+	SnapshotID string
+	Manifest   SnapshotManifest
+	Files      map[string][]byte
+	Lazy       map[string]blobObject // tree and chunked files, read on demand
+	ExpireAt   time.Time
+}
+
+// bundleFile returns the content of a file of an unlocked snapshot.
+func (s *Service) bundleFile(ub unlockedBundle, logicalPath string) ([]byte, bool, error) {
+	if content, ok := ub.Files[logicalPath]; ok {
+		return content, true, nil
+	}
+	o, ok := ub.Lazy[logicalPath]
+	if !ok {
+		return nil, false, nil
+	}
+	content, err := s.loadObject(o)
+	return content, true, err
 }
 
 type Service struct {
 	repo     *database.SnapshotRepo
+	blobs    *database.SnapshotBlobRepo
+	uploads  *database.SnapshotUploadRepo
+	settings *database.SettingRepo
 	mu       sync.Mutex
 	tokens   map[string]unlockedBundle
 	gwClient *openclaw.GWClient
+	onCreate func(rec *database.SnapshotRecord)
 }
 
 func NewService() *Service {
 	return &Service{
-		repo:   database.NewSnapshotRepo(),
-		tokens: map[string]unlockedBundle{},
+		repo:     database.NewSnapshotRepo(),
+		blobs:    database.NewSnapshotBlobRepo(),
+		uploads:  database.NewSnapshotUploadRepo(),
+		settings: database.NewSettingRepo(),
+		tokens:   map[string]unlockedBundle{},
 	}
 }
 
@@ -44,6 +67,12 @@ func (s *Service) SetGWClient(client *openclaw.GWClient) {
 	s.gwClient = client
 }
 
+// SetCreateHook registers a function called after every snapshot Create,
+// whether manual, scheduled or pre-restore.
+func (s *Service) SetCreateHook(fn func(rec *database.SnapshotRecord)) {
+	s.onCreate = fn
+}
+
 // StartTokenCleanup runs a background goroutine that periodically removes expired preview tokens.
 func (s *Service) StartTokenCleanup(done <-chan struct{}) {
 	go func() {
@@ -71,71 +100,12 @@ func (s *Service) cleanExpiredTokens() {
 	}
 }
 
-// ExportSnapshot returns the encrypted ciphertext and metadata for a snapshot so it can be downloaded.
-func (s *Service) ExportSnapshot(snapshotID string) (*database.SnapshotRecord, error) {
-	return s.repo.FindBySnapshotID(snapshotID)
-}
-
-// ImportSnapshot imports a snapshot from an exported .clawbak envelope (header JSON + ciphertext).
-func (s *Service) ImportSnapshot(headerJSON []byte, ciphertext []byte) (*database.SnapshotRecord, error) {
-	existing, _ := s.repo.List()
-	if len(existing) >= MaxSnapshotCount {
-		return nil, fmt.Errorf("snapshot limit reached (%d), please delete old snapshots first", MaxSnapshotCount)
-	}
-	if int64(len(ciphertext)) > MaxSnapshotSizeBytes {
-		return nil, fmt.Errorf("import file too large (max %d MB)", MaxSnapshotSizeBytes/(1024*1024))
-	}
-	var envelope struct {
-		Version    int    `json:"version"`
-		SnapshotID string `json:"snapshotId"`
-		Note       string `json:"note"`
-		Trigger    string `json:"trigger"`
-		CipherAlg  string `json:"cipherAlg"`
-		KDFAlg     string `json:"kdfAlg"`
-		KDFParams  string `json:"kdfParams"`
-		Salt       string `json:"salt"`
-		WrappedDEK string `json:"wrappedDEK"`
-		WrapNonce  string `json:"wrapNonce"`
-		DataNonce  string `json:"dataNonce"`
-		ResCount   int    `json:"resourceCount"`
-		SizeBytes  int64  `json:"sizeBytes"`
-	}
-	if err := json.Unmarshal(headerJSON, &envelope); err != nil {
-		return nil, fmt.Errorf("invalid backup file header: %w", err)
-	}
-	if envelope.CipherAlg == "" || envelope.Salt == "" || envelope.WrappedDEK == "" {
-		return nil, errors.New("invalid backup file: missing encryption fields")
-	}
-	// Avoid duplicate import by snapshot ID
-	if envelope.SnapshotID != "" {
-		if _, err := s.repo.FindBySnapshotID(envelope.SnapshotID); err == nil {
-			return nil, errors.New("this backup has already been imported")
-		}
-	}
-	snapshotID := envelope.SnapshotID
-	if snapshotID == "" {
-		snapshotID = newSnapshotID()
-	}
-	record := &database.SnapshotRecord{
-		SnapshotID:      snapshotID,
-		SnapshotVersion: envelope.Version,
-		Note:            envelope.Note,
-		Trigger:         "import",
-		ResourceCount:   envelope.ResCount,
-		SizeBytes:       int64(len(ciphertext)),
-		CipherAlg:       envelope.CipherAlg,
-		KDFAlg:          envelope.KDFAlg,
-		KDFParamsJSON:   envelope.KDFParams,
-		SaltB64:         envelope.Salt,
-		WrappedDEKB64:   envelope.WrappedDEK,
-		WrapNonceB64:    envelope.WrapNonce,
-		DataNonceB64:    envelope.DataNonce,
-		Ciphertext:      ciphertext,
-	}
-	if err := s.repo.Create(record); err != nil {
-		return nil, err
-	}
-	return record, nil
+// ImportSnapshot imports a snapshot from an exported .clawbak envelope
+// (header JSON + payload) already in memory. For version 2 files the
+// payload is the sealed index followed by the blobs listed in the header.
+// Use ImportClawbak to import from a stream.
+func (s *Service) ImportSnapshot(headerJSON []byte, payload []byte) (*database.SnapshotRecord, error) {
+	return s.importClawbak(headerJSON, bytes.NewReader(payload), nil)
 }
 
 // MaxSnapshotCount is the hard limit on stored snapshots to prevent DB bloat.
@@ -144,11 +114,21 @@ const MaxSnapshotCount = 100
 // MaxSnapshotSizeBytes is the per-snapshot size ceiling (200 MB).
 const MaxSnapshotSizeBytes = 200 * 1024 * 1024
 
+// MaxBundleBytes is the size ceiling of an imported .clawbak file (4 GB).
+// Imports stream into the blob store, so this only bounds disk use.
+const MaxBundleBytes = 4 << 30
+
 func (s *Service) List() ([]SnapshotSummary, error) {
 	records, err := s.repo.List()
 	if err != nil {
 		return nil, err
 	}
+	uploads := map[string][]database.SnapshotUpload{}
+	if list, err := s.uploads.ListBySnapshots(nil); err == nil {
+		for _, u := range list {
+			uploads[u.SnapshotID] = append(uploads[u.SnapshotID], u)
+		}
+	}
 	out := make([]SnapshotSummary, 0, len(records))
 	for _, r := range records {
 		resourceIDs, resourcePaths := extractResourceSummary(r.ManifestSummaryJSON)
@@ -161,12 +141,36 @@ func (s *Service) List() ([]SnapshotSummary, error) {
 			SizeBytes:     r.SizeBytes,
 			ResourceIDs:   resourceIDs,
 			ResourcePaths: resourcePaths,
+			Uploads:       uploads[r.SnapshotID],
 		})
 	}
 	return out, nil
 }
 
 func (s *Service) Create(note, trigger, password string, resourceIDs []string) (*database.SnapshotRecord, error) {
+	return s.create(note, trigger, password, resourceIDs, 0)
+}
+
+// CreateScheduled creates a snapshot on behalf of a schedule, which owns it
+// for retention.
+func (s *Service) CreateScheduled(scheduleID uint, note, password string, resourceIDs []string) (*database.SnapshotRecord, error) {
+	return s.create(note, ScheduledSnapshotTag, password, resourceIDs, scheduleID)
+}
+
+func (s *Service) create(note, trigger, password string, resourceIDs []string, scheduleID uint) (*database.SnapshotRecord, error) {
+	if len(password) < 6 {
+		return nil, errors.New("password too short")
+	}
+	resources, err := s.collectResources(resourceIDs)
+	if err != nil {
+		return nil, err
+	}
+	return s.createFrom(note, trigger, password, resources, s.selectTrees(resourceIDs), scheduleID)
+}
+
+// createFrom stores a snapshot of resources that were already collected,
+// together with the files of trees.
+func (s *Service) createFrom(note, trigger, password string, resources []ResourceContent, trees []TreeSource, scheduleID uint) (*database.SnapshotRecord, error) {
 	if trigger == "" {
 		trigger = DefaultSnapshotTag
 	}
@@ -177,27 +181,25 @@ func (s *Service) Create(note, trigger, password string, resourceIDs []string) (
 	if len(existing) >= MaxSnapshotCount {
 		return nil, fmt.Errorf("snapshot limit reached (%d), please delete old snapshots first", MaxSnapshotCount)
 	}
-	resources, err := s.collectResources(resourceIDs)
-	if err != nil {
-		return nil, err
-	}
 	manifest, err := buildManifest(resources)
 	if err != nil {
 		return nil, err
 	}
-	bundle, err := packBundle(manifest, resources)
-	if err != nil {
-		return nil, err
-	}
-	kdfJSON, saltB64, wrappedDEKB64, wrapNonceB64, dataNonceB64, ciphertext, err := encryptBundleWithEnvelope(password, bundle)
+	snapshotID := newSnapshotID()
+	treeObjects, treeBytes, err := s.storeTrees(snapshotID, trees, &manifest)
 	if err != nil {
+		_ = s.repo.DeleteBySnapshotID(snapshotID)
 		return nil, err
 	}
+	// Tree files are summarised per tree rather than listed.
 	summary := map[string]any{
-		"resource_ids":       idsOfManifest(manifest.Resources),
-		"resource_paths":     logicalPathsOfManifest(manifest.Resources),
+		"resource_ids":       idsOfManifest(manifest.Resources[:len(resources)]),
+		"resource_paths":     logicalPathsOfManifest(manifest.Resources[:len(resources)]),
 		"config_field_count": len(manifest.ConfigFields),
 	}
+	if len(manifest.Trees) > 0 {
+		summary["trees"] = manifest.Trees
+	}
 	summaryJSON, _ := json.Marshal(summary)
 	resTypeStats := map[string]int{}
 	for _, r := range manifest.Resources {
@@ -205,26 +207,28 @@ func (s *Service) Create(note, trigger, password string, resourceIDs []string) (
 	}
 	resTypeJSON, _ := json.Marshal(resTypeStats)
 	record := &database.SnapshotRecord{
-		SnapshotID:          newSnapshotID(),
-		SnapshotVersion:     SnapshotVersion1,
+		SnapshotID:          snapshotID,
 		Note:                note,
 		Trigger:             trigger,
+		ScheduleID:          scheduleID,
 		ResourceCount:       len(manifest.Resources),
 		ResourceTypesJSON:   string(resTypeJSON),
 		ManifestSummaryJSON: string(summaryJSON),
-		SizeBytes:           int64(len(ciphertext)),
-		CipherAlg:           "aes-256-gcm",
-		KDFAlg:              "argon2id",
-		KDFParamsJSON:       kdfJSON,
-		SaltB64:             saltB64,
-		WrappedDEKB64:       wrappedDEKB64,
-		WrapNonceB64:        wrapNonceB64,
-		DataNonceB64:        dataNonceB64,
-		Ciphertext:          ciphertext,
-	}
-	if err := s.repo.Create(record); err != nil {
+	}
+	blobs, err := s.seal(record, manifest, resources, treeObjects, password)
+	if err == nil {
+		record.SizeBytes += treeBytes
+		err = s.repo.CreateWithBlobs(record, blobs)
+	}
+	if err != nil {
+		if len(treeObjects) > 0 {
+			_ = s.repo.DeleteBySnapshotID(snapshotID)
+		}
 		return nil, err
 	}
+	if s.onCreate != nil {
+		s.onCreate(record)
+	}
 	return record, nil
 }
 
@@ -233,17 +237,13 @@ func (s *Service) UnlockPreview(snapshotID, password string) (*UnlockPreviewResp
 	if err != nil {
 		return nil, err
 	}
-	bundle, err := decryptBundleWithEnvelope(password, record.KDFParamsJSON, record.SaltB64, record.WrappedDEKB64, record.WrapNonceB64, record.DataNonceB64, record.Ciphertext)
-	if err != nil {
-		return nil, err
-	}
-	manifest, files, err := unpackBundle(bundle)
+	manifest, files, lazy, err := s.openIndex(record, password)
 	if err != nil {
 		return nil, err
 	}
 	token := newPreviewToken()
 	s.mu.Lock()
-	s.tokens[token] = unlockedBundle{Manifest: manifest, Files: files, ExpireAt: time.Now().Add(PreviewTokenTTL)}
+	s.tokens[token] = unlockedBundle{SnapshotID: snapshotID, Manifest: manifest, Files: files, Lazy: lazy, ExpireAt: time.Now().Add(PreviewTokenTTL)}
 	s.mu.Unlock()
 	return &UnlockPreviewResponse{PreviewToken: token, Manifest: manifest, Resources: manifest.Resources, ConfigFields: manifest.ConfigFields}, nil
 }
@@ -253,45 +253,111 @@ func (s *Service) RestorePlan(previewToken string, sel RestoreSelections) (*Rest
 	if err != nil {
 		return nil, err
 	}
-	fileSet := map[string]struct{}{}
-	for _, id := range sel.Files {
-		fileSet[id] = struct{}{}
-	}
 	cfgSet := map[string]struct{}{}
 	for _, p := range sel.ConfigPaths {
 		cfgSet[p] = struct{}{}
 	}
-	// Check resource existence in parallel to avoid serial RPC bottleneck
-	type existResult struct {
-		id     string
-		exists bool
-	}
-	var selected []ManifestResource
-	for _, r := range ub.Manifest.Resources {
-		if r.RestoreMode == RestoreModeJSON {
-			continue
-		}
-		if _, ok := fileSet[r.ID]; ok {
-			selected = append(selected, r)
-		}
-	}
-	results := make([]existResult, len(selected))
+	selected := selectRestoreFiles(ub.Manifest, sel)
+	// Compare with the live files in parallel to avoid a serial RPC bottleneck
+	plans := make([]RestoreFilePlan, len(selected))
+	sem := make(chan struct{}, restorePlanWorkers)
 	var wg sync.WaitGroup
 	for i, r := range selected {
 		wg.Add(1)
+		sem <- struct{}{}
 		go func(idx int, res ManifestResource) {
 			defer wg.Done()
-			results[idx] = existResult{id: res.ID, exists: s.resourceExists(res.LogicalPath)}
+			defer func() { <-sem }()
+			plans[idx] = RestoreFilePlan{ID: res.ID, LogicalPath: res.LogicalPath, Status: s.liveStatus(res)}
 		}(i, r)
 	}
 	wg.Wait()
+	keep := map[string]bool{}
+	for _, id := range sel.Keep {
+		keep[id] = true
+	}
 	warnings := []string{}
-	for _, er := range results {
-		if er.exists {
-			warnings = append(warnings, fmt.Sprintf("%s will be overwritten", er.id))
+	willModify := 0
+	for i := range plans {
+		p := &plans[i]
+		if keep[p.ID] {
+			p.Action = RestoreActionKeep
+			continue
+		}
+		p.Action = RestoreActionWrite
+		if p.Status == RestoreFileUnchanged {
+			continue
+		}
+		willModify++
+		if p.Status == RestoreFileConflict {
+			warnings = append(warnings, fmt.Sprintf("%s will be overwritten", p.ID))
+		}
+	}
+	return &RestorePlanResponse{WillModifyFiles: willModify, WillModifyConfigPaths: len(cfgSet), Warnings: warnings, Files: plans}, nil
+}
+
+// selectRestoreFiles returns the file resources chosen by ID or by
+// directory.
+func selectRestoreFiles(manifest SnapshotManifest, sel RestoreSelections) []ManifestResource {
+	ids := map[string]bool{}
+	for _, id := range sel.Files {
+		ids[id] = true
+	}
+	var out []ManifestResource
+	for _, mr := range manifest.Resources {
+		if mr.RestoreMode == RestoreModeJSON {
+			continue
+		}
+		selected := ids[mr.ID]
+		for _, dir := range sel.Dirs {
+			if dir = strings.TrimSuffix(dir, "/"); dir != "" && strings.HasPrefix(mr.LogicalPath, dir+"/") {
+				selected = true
+			}
+		}
+		if selected {
+			out = append(out, mr)
+		}
+	}
+	return out
+}
+
+// liveStatus compares a snapshot file with the file it would replace.
+func (s *Service) liveStatus(mr ManifestResource) string {
+	var sum string
+	var err error
+	if isTreePath(mr.LogicalPath) {
+		sum, err = hashFile(treeFilePath(mr.LogicalPath))
+	} else {
+		var current []byte
+		if current, err = s.readCurrentFile(mr.LogicalPath); err == nil {
+			h := sha256.Sum256(current)
+			sum = hex.EncodeToString(h[:])
+		}
+	}
+	if err != nil {
+		if s.resourceExists(mr.LogicalPath) {
+			return RestoreFileConflict
 		}
+		return RestoreFileCreate
+	}
+	if sum == mr.SHA256 {
+		return RestoreFileUnchanged
+	}
+	return RestoreFileConflict
+}
+
+// writeTreeFile restores a tree file. Trees live on the gateway host's
+// disk, so they can only be restored next to a local gateway.
+func (s *Service) writeTreeFile(logicalPath string, data []byte) error {
+	if !s.isLocalGateway() {
+		return fmt.Errorf("%s: workspace files can only be restored on the gateway host", logicalPath)
+	}
+	dest := treeFilePath(logicalPath)
+	if dest == "" {
+		return fmt.Errorf("%s: not inside a tree defined on this host", logicalPath)
 	}
-	return &RestorePlanResponse{WillModifyFiles: len(fileSet), WillModifyConfigPaths: len(cfgSet), Warnings: warnings}, nil
+	s.logStoreUse("write", "local", logicalPath)
+	return writeAtomic(dest, data)
 }
 
 func (s *Service) Restore(previewToken string, sel RestoreSelections, createPreRestore bool, passwordForPreRestore string) (*RestoreResponse, error) {
@@ -308,15 +374,12 @@ func (s *Service) RestoreWithProgress(previewToken string, sel RestoreSelections
 	}
 	// Count total steps: pre-backup(0 or 1) + files + config(0 or 1)
 	var filesToRestore []ManifestResource
-	selectedFiles := map[string]struct{}{}
-	for _, id := range sel.Files {
-		selectedFiles[id] = struct{}{}
+	keep := map[string]bool{}
+	for _, id := range sel.Keep {
+		keep[id] = true
 	}
-	for _, mr := range ub.Manifest.Resources {
-		if mr.RestoreMode == RestoreModeJSON {
-			continue
-		}
-		if _, ok := selectedFiles[mr.ID]; ok {
+	for _, mr := range selectRestoreFiles(ub.Manifest, sel) {
+		if !keep[mr.ID] {
 			filesToRestore = append(filesToRestore, mr)
 		}
 	}
@@ -339,8 +402,27 @@ func (s *Service) RestoreWithProgress(previewToken string, sel RestoreSelections
 			resp.PreRestoreSnapshotID = pre.SnapshotID
 		}
 	}
+	var written int64
 	for _, mr := range filesToRestore {
-		data, ok := ub.Files[mr.LogicalPath]
+		// Large and tree files are streamed straight to disk when the
+		// gateway is local, and verified before they replace anything.
+		if o, ok := ub.Lazy[mr.LogicalPath]; ok {
+			if dest := s.localDest(mr.LogicalPath); dest != "" {
+				step++
+				progressFn(RestoreProgressEvent{Phase: "file", Current: step, Total: totalSteps, File: mr.ID, Bytes: written})
+				s.logStoreUse("write", "local", mr.LogicalPath)
+				if err := s.restoreObject(dest, o, mr.SHA256); err != nil {
+					return nil, fmt.Errorf("restore %s: %w", mr.ID, err)
+				}
+				written += mr.Size
+				resp.RestoredResources = append(resp.RestoredResources, mr.ID)
+				continue
+			}
+		}
+		data, ok, err := s.bundleFile(ub, mr.LogicalPath)
+		if err != nil {
+			return nil, err
+		}
 		if !ok {
 			continue
 		}
@@ -351,10 +433,16 @@ func (s *Service) RestoreWithProgress(previewToken string, sel RestoreSelections
 			}
 		}
 		step++
-		progressFn(RestoreProgressEvent{Phase: "file", Current: step, Total: totalSteps, File: mr.ID})
-		if err := s.writeResource(mr.LogicalPath, data); err != nil {
+		progressFn(RestoreProgressEvent{Phase: "file", Current: step, Total: totalSteps, File: mr.ID, Bytes: written})
+		if isTreePath(mr.LogicalPath) {
+			err = s.writeTreeFile(mr.LogicalPath, data)
+		} else {
+			err = s.writeResource(mr.LogicalPath, data)
+		}
+		if err != nil {
 			return nil, err
 		}
+		written += int64(len(data))
 		resp.RestoredResources = append(resp.RestoredResources, mr.ID)
 	}
 	if hasConfig {
@@ -371,7 +459,7 @@ func (s *Service) RestoreWithProgress(previewToken string, sel RestoreSelections
 	}
 	// Gateway only needs restart if config paths were modified (agent files are read on demand)
 	resp.NeedsGatewayRestart = len(resp.RestoredConfigPaths) > 0
-	progressFn(RestoreProgressEvent{Phase: "done", Current: totalSteps, Total: totalSteps})
+	progressFn(RestoreProgressEvent{Phase: "done", Current: totalSteps, Total: totalSteps, Bytes: written})
 	return resp, nil
 }
 
@@ -607,27 +695,6 @@ func parseAgentLogicalPath(logicalPath string) (string, string, bool) {
 	return agentID, fileName, true
 }
 
-func (s *Service) PruneScheduledBackups(retentionCount int) ([]string, error) {
-	if retentionCount < 1 {
-		retentionCount = 1
-	}
-	records, err := s.repo.ListByTrigger(ScheduledSnapshotTag)
-	if err != nil {
-		return nil, err
-	}
-	if len(records) <= retentionCount {
-		return nil, nil
-	}
-	pruned := make([]string, 0, len(records)-retentionCount)
-	for _, r := range records[retentionCount:] {
-		if err := s.repo.DeleteBySnapshotID(r.SnapshotID); err != nil {
-			return pruned, err
-		}
-		pruned = append(pruned, r.SnapshotID)
-	}
-	return pruned, nil
-}
-
 func (s *Service) Delete(snapshotID string) error {
 	return s.repo.DeleteBySnapshotID(snapshotID)
 }
@@ -738,6 +805,10 @@ func logicalPathToSourcePath(logicalPath string) string {
 // without relying on the registry (which only contains existing files).
 // This is needed for restore: the target file may not exist yet.
 func resolveLogicalPathDirect(logicalPath string) string {
+	// files/trees/{treeID}/{rel} → {tree root}/{rel}
+	if isTreePath(logicalPath) {
+		return treeFilePath(logicalPath)
+	}
 	stateDir := resolveStateDir()
 	if stateDir == "" {
 		return ""
@@ -0,0 +1,267 @@
+package snapshots
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Files of any size are stored and restored without holding them in
+// memory: putObject splits a file into chunks of blobChunkSize, each sealed
+// as its own convergent blob, and writeObject decrypts them back one at a
+// time. Every chunk is authenticated by its blob key, and their order by
+// the sealed index that lists them. A file that grows at its end keeps
+// sharing its leading chunks with earlier snapshots.
+
+// blobChunkSize is the largest part of a file sealed as one blob.
+const blobChunkSize = 1 << 20
+
+type blobChunk struct {
+	Blob string `json:"blob"` // blob ID
+	Key  string `json:"key"`  // base64 blob key
+}
+
+// storedObject describes a file written with putObject.
+type storedObject struct {
+	Object blobObject
+	Size   int64 // plaintext size
+	Stored int64 // stored size of its blobs, shared ones included
+	SHA256 string
+}
+
+func (o blobObject) chunks() []blobChunk {
+	if len(o.Chunks) > 0 {
+		return o.Chunks
+	}
+	return []blobChunk{{Blob: o.Blob, Key: o.Key}}
+}
+
+// lazy reports whether openIndex leaves the object unread.
+func (o blobObject) lazy() bool {
+	return isTreePath(o.Path) || len(o.Chunks) > 0
+}
+
+// contentID identifies the content of an object: its blob ID, or a hash of
+// the chunk blob IDs for split files.
+func (o blobObject) contentID() string {
+	if len(o.Chunks) == 0 {
+		return o.Blob
+	}
+	h := sha256.New()
+	for _, c := range o.Chunks {
+		h.Write([]byte(c.Blob))
+	}
+	return "chunks:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// putObject reads r to the end and stores it as blobs of snapshotID, one
+// chunk at a time. Each blob is referenced before it is written, so on
+// error the caller must drop the snapshot's refs with DeleteBySnapshotID.
+func (s *Service) putObject(snapshotID, logicalPath string, r io.Reader) (storedObject, error) {
+	out := storedObject{Object: blobObject{Path: logicalPath}}
+	h := sha256.New()
+	buf := make([]byte, blobChunkSize)
+	var chunks []blobChunk
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return out, err
+		}
+		if n > 0 || len(chunks) == 0 {
+			h.Write(buf[:n])
+			c, stored, putErr := s.putChunk(snapshotID, buf[:n])
+			if putErr != nil {
+				return out, putErr
+			}
+			chunks = append(chunks, c)
+			out.Size += int64(n)
+			out.Stored += stored
+		}
+		if err != nil {
+			break
+		}
+	}
+	if len(chunks) == 1 {
+		out.Object.Blob, out.Object.Key = chunks[0].Blob, chunks[0].Key
+	} else {
+		out.Object.Chunks = chunks
+	}
+	out.Object.Size = out.Size
+	out.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return out, nil
+}
+
+func (s *Service) putChunk(snapshotID string, content []byte) (blobChunk, int64, error) {
+	key := blobKey(content)
+	c := blobChunk{Blob: blobIDForKey(key), Key: base64.StdEncoding.EncodeToString(key)}
+	size, ok, err := s.blobs.Ref(snapshotID, c.Blob)
+	if err != nil {
+		return c, 0, err
+	}
+	// A stored copy is reused only if it still decrypts to this content;
+	// otherwise it is repaired, as seal does for whole files.
+	if ok {
+		stored, err := s.blobs.GetMany([]string{c.Blob})
+		if err != nil {
+			return c, 0, err
+		}
+		old, found := stored[c.Blob]
+		if found && blobHolds(old, key, content) {
+			return c, size, nil
+		}
+		ok = found
+	}
+	blob, _, err := sealBlob(content)
+	if err != nil {
+		return c, 0, err
+	}
+	if ok {
+		err = s.blobs.Replace(&blob)
+	} else {
+		err = s.blobs.Put(&blob)
+	}
+	if err != nil {
+		return c, 0, err
+	}
+	return c, blob.StoredBytes, nil
+}
+
+// writeObject decrypts an object into w one chunk at a time.
+func (s *Service) writeObject(o blobObject, w io.Writer) (int64, error) {
+	var n int64
+	for _, c := range o.chunks() {
+		content, err := s.loadChunk(o.Path, c)
+		if err != nil {
+			return n, err
+		}
+		written, err := w.Write(content)
+		n += int64(written)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// restoreObject streams an object to dest through a temporary file that
+// replaces dest only once the content matches sha.
+func (s *Service) restoreObject(dest string, o blobObject, sha string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp := dest + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = s.writeObject(o, io.MultiWriter(f, h))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && sha != "" && hex.EncodeToString(h.Sum(nil)) != sha {
+		err = errors.New("integrity check failed: SHA256 mismatch")
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// localDest is where a restore can stream a file on this host, or "" when
+// it has to go through the gateway.
+func (s *Service) localDest(logicalPath string) string {
+	if !s.isLocalGateway() {
+		return ""
+	}
+	if isTreePath(logicalPath) {
+		return treeFilePath(logicalPath)
+	}
+	return resolveLogicalPathDirect(logicalPath)
+}
+
+// hashFile returns the hex SHA-256 of a file, read in pieces.
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+var errFileGrew = errors.New("file grew beyond its size cap")
+
+// cappedReader reads a file that may have grown since it was listed and
+// remembers why reading it failed.
+type cappedReader struct {
+	r   io.Reader
+	max int64
+	n   int64
+	err error
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	switch {
+	case c.n > c.max:
+		c.err = errFileGrew
+		return n, c.err
+	case err != nil && err != io.EOF:
+		c.err = err
+	}
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readExactly reads n bytes that a header promised, reporting a short read
+// as truncated data.
+func readExactly(r io.Reader, n int64, what string) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("invalid backup file: truncated %s", what)
+		}
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,182 @@
+package snapshots
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// largeContent returns n bytes that do not repeat within a chunk.
+func largeContent(n int) string {
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()[:n]
+}
+
+func TestPutObject_SplitsLargeFilesIntoChunks(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	svc := NewService()
+	refs := database.NewSnapshotBlobRepo()
+
+	content := largeContent(2*blobChunkSize + 100)
+	so, err := svc.putObject("snap_a", "files/trees/workspace.default/big.log", strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Len(t, so.Object.Chunks, 3)
+	assert.Equal(t, int64(len(content)), so.Size)
+	assert.True(t, so.Object.lazy())
+
+	var buf bytes.Buffer
+	n, err := svc.writeObject(so.Object, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.Equal(t, content, buf.String())
+
+	// A file that grew at its end shares its leading chunks.
+	grown, err := svc.putObject("snap_b", "files/trees/workspace.default/big.log", strings.NewReader(content+"more\n"))
+	require.NoError(t, err)
+	assert.Equal(t, so.Object.Chunks[:2], grown.Object.Chunks[:2])
+	assert.NotEqual(t, so.Object.contentID(), grown.Object.contentID())
+	count, _, err := refs.Usage()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+
+	small, err := svc.putObject("snap_a", "files/agents/main/SOUL.md", strings.NewReader("calm"))
+	require.NoError(t, err)
+	assert.Empty(t, small.Object.Chunks)
+	assert.False(t, small.Object.lazy())
+	empty, err := svc.putObject("snap_a", "files/trees/workspace.default/empty", strings.NewReader(""))
+	require.NoError(t, err)
+	assert.NotEmpty(t, empty.Object.Blob)
+}
+
+func TestPutObject_RepairsDamagedChunks(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	svc := NewService()
+
+	content := largeContent(blobChunkSize + 100)
+	first, err := svc.putObject("snap_a", "files/trees/workspace.default/big.log", strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, first.Object.Chunks, 2)
+	bad := first.Object.Chunks[0].Blob
+	require.NoError(t, database.DB.Model(&database.SnapshotBlob{}).Where("blob_id = ?", bad).Update("data", []byte("garbage")).Error)
+
+	// Storing the same content again rewrites the damaged chunk.
+	second, err := svc.putObject("snap_b", "files/trees/workspace.default/big.log", strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, first.Object.Chunks, second.Object.Chunks)
+	var buf bytes.Buffer
+	_, err = svc.writeObject(second.Object, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, content, buf.String())
+}
+
+func TestClawbak_StreamingExportImportAndRestore(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	writeStateFile(t, dir, "openclaw.json", `{"agents":{"defaults":{"workspace":"ws"}}}`)
+	content := largeContent(blobChunkSize*3/2 + 7)
+	big := writeStateFile(t, dir, "ws/data/big.log", content)
+
+	svc := NewService()
+	cfg := DefaultTreeConfig()
+	cfg.Workspace.Enabled = true
+	require.NoError(t, svc.UpdateTreeConfig(cfg))
+	rec, err := svc.Create("large workspace", DefaultSnapshotTag, testPassword, nil)
+	require.NoError(t, err)
+
+	var events []RestoreProgressEvent
+	verify, err := svc.VerifyIntegrityWithProgress(rec.SnapshotID, testPassword, func(evt RestoreProgressEvent) { events = append(events, evt) })
+	require.NoError(t, err)
+	assert.True(t, verify.OK, verify.Error)
+	assert.Equal(t, 2, verify.VerifiedCount)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "done", events[len(events)-1].Phase)
+	assert.Equal(t, verify.TotalSizeBytes, events[len(events)-1].Bytes)
+
+	exp, err := svc.PrepareClawbak(rec.SnapshotID)
+	require.NoError(t, err)
+	var file bytes.Buffer
+	n, err := exp.WriteTo(&file)
+	require.NoError(t, err)
+	assert.Equal(t, exp.Size, n)
+	assert.Equal(t, exp.Size, int64(file.Len()))
+	require.NoError(t, svc.Delete(rec.SnapshotID))
+
+	_, err = svc.ImportClawbak(bytes.NewReader(file.Bytes()[:file.Len()-10]), nil)
+	assert.ErrorContains(t, err, "truncated")
+	left, err := database.NewSnapshotBlobRepo().ListMetaBySnapshot(rec.SnapshotID)
+	require.NoError(t, err)
+	assert.Empty(t, left, "a failed import leaves no refs behind")
+	_, err = svc.ImportClawbak(bytes.NewReader(append(file.Bytes(), 0)), nil)
+	assert.ErrorContains(t, err, "trailing data")
+
+	events = nil
+	imported, err := svc.ImportClawbak(bytes.NewReader(file.Bytes()), func(evt RestoreProgressEvent) { events = append(events, evt) })
+	require.NoError(t, err)
+	assert.Equal(t, rec.SnapshotID, imported.SnapshotID)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "import", events[0].Phase)
+	assert.Equal(t, events[0].Total, events[len(events)-2].Current)
+
+	// Restore streams the chunked file back and checks it before replacing.
+	require.NoError(t, os.WriteFile(big, []byte("truncated"), 0o600))
+	unlock, err := svc.UnlockPreview(imported.SnapshotID, testPassword)
+	require.NoError(t, err)
+	ub, err := svc.getToken(unlock.PreviewToken)
+	require.NoError(t, err)
+	assert.NotContains(t, ub.Files, "files/trees/workspace.default/data/big.log")
+	res, err := svc.Restore(unlock.PreviewToken, RestoreSelections{Dirs: []string{"files/trees/workspace.default/"}}, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"workspace.default:data/big.log"}, res.RestoredResources)
+	got, err := os.ReadFile(big)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(got))
+}
+
+func TestOpenClawExport_StreamsAndImports(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	svc := NewService()
+	content := largeContent(blobChunkSize + 1)
+	rec := storeTestSnapshot(t, svc, map[string]string{
+		"files/agents/main/SOUL.md":  "calm",
+		"files/agents/main/notes.md": content,
+	})
+
+	exp, err := svc.ExportAsOpenClawTarGz(rec.SnapshotID, testPassword)
+	require.NoError(t, err)
+	_, err = svc.ExportAsOpenClawTarGz(rec.SnapshotID, "wrong password")
+	assert.Error(t, err)
+	var archive bytes.Buffer
+	_, err = exp.WriteTo(&archive)
+	require.NoError(t, err)
+
+	result, err := svc.ImportFromTarGz(bytes.NewReader(archive.Bytes()), testPassword, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.ResourceCount)
+	imported, err := database.NewSnapshotRepo().FindBySnapshotID(result.SnapshotID)
+	require.NoError(t, err)
+	_, files, err := svc.openSnapshot(imported, testPassword)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(files["files/files/agents/main/notes.md"]))
+	verify, err := svc.VerifyIntegrity(result.SnapshotID, testPassword)
+	require.NoError(t, err)
+	assert.True(t, verify.OK, verify.Error)
+
+	_, err = svc.ImportFromTarGz(strings.NewReader("not gzip"), testPassword, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fsTarget stores objects as files in a directory, e.g. an NFS or SMB mount.
+type fsTarget struct {
+	dir string
+}
+
+func newFSTarget(cfg Config) (*fsTarget, error) {
+	dir := filepath.Join(cfg.Path, filepath.FromSlash(cleanPrefix(cfg.Prefix)))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create target directory: %w", err)
+	}
+	return &fsTarget{dir: dir}, nil
+}
+
+func (t *fsTarget) Put(_ context.Context, name string, r io.Reader, size int64) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	dest := filepath.Join(t.dir, name)
+	tmp := dest + ".part"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = copySized(f, r, size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+func (t *fsTarget) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(t.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (t *fsTarget) List(context.Context) ([]Object, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Object, 0, len(entries))
+	for _, e := range entries {
+		if !e.Type().IsRegular() || filepath.Ext(e.Name()) == ".part" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, Object{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime().UTC()})
+	}
+	return out, nil
+}
+
+func (t *fsTarget) Delete(_ context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(t.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (t *fsTarget) Close() error { return nil }
@@ -0,0 +1,199 @@
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const sftpDialTimeout = 15 * time.Second
+
+// sftpTarget stores objects as files in a directory on an SFTP server.
+type sftpTarget struct {
+	conn   *ssh.Client // nil when the sftp client runs over another transport
+	client *sftp.Client
+	dir    string
+}
+
+func dialSFTP(ctx context.Context, cfg Config) (*sftpTarget, error) {
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid host_key: %w", err)
+	}
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private_key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	clientCfg := &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auth,
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         sftpDialTimeout,
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(sftpPort(cfg.Port)))
+	d := net.Dialer{Timeout: sftpDialTimeout}
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(raw, addr, clientCfg)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+	conn := ssh.NewClient(c, chans, reqs)
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t, err := newSFTPTarget(client, cleanPrefix(cfg.Prefix))
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return nil, err
+	}
+	t.conn = conn
+	return t, nil
+}
+
+// newSFTPTarget uses dir (relative to the login directory when not absolute)
+// on an established sftp session.
+func newSFTPTarget(client *sftp.Client, dir string) (*sftpTarget, error) {
+	if dir == "" {
+		dir = "."
+	}
+	if err := client.MkdirAll(dir); err != nil {
+		return nil, fmt.Errorf("create target directory: %w", err)
+	}
+	return &sftpTarget{client: client, dir: dir}, nil
+}
+
+func sftpPort(p int) int {
+	if p == 0 {
+		return 22
+	}
+	return p
+}
+
+// ScanHostKey connects to an SSH server and returns its host key in
+// authorized_keys format, for the operator to confirm and pin.
+func ScanHostKey(ctx context.Context, host string, port int) (string, error) {
+	var found ssh.PublicKey
+	errScanned := errors.New("host key scanned")
+	clientCfg := &ssh.ClientConfig{
+		User: "clawdeckx",
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			found = key
+			return errScanned
+		},
+		Timeout: sftpDialTimeout,
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(sftpPort(port)))
+	d := net.Dialer{Timeout: sftpDialTimeout}
+	raw, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer raw.Close()
+	if _, _, _, err := ssh.NewClientConn(raw, addr, clientCfg); found == nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(found))), nil
+}
+
+func (t *sftpTarget) Put(_ context.Context, name string, r io.Reader, size int64) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	dest := path.Join(t.dir, name)
+	tmp := dest + ".part"
+	f, err := t.client.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := copySized(f, r, size); err != nil {
+		f.Close()
+		_ = t.client.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = t.client.Remove(tmp)
+		return err
+	}
+	// PosixRename replaces an existing file where the server supports it.
+	if err := t.client.PosixRename(tmp, dest); err != nil {
+		_ = t.client.Remove(dest)
+		if err := t.client.Rename(tmp, dest); err != nil {
+			_ = t.client.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *sftpTarget) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	f, err := t.client.Open(path.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (t *sftpTarget) List(context.Context) ([]Object, error) {
+	entries, err := t.client.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Object, 0, len(entries))
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || strings.HasSuffix(e.Name(), ".part") {
+			continue
+		}
+		out = append(out, Object{Name: e.Name(), Size: e.Size(), ModTime: e.ModTime().UTC()})
+	}
+	return out, nil
+}
+
+func (t *sftpTarget) Delete(_ context.Context, name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	err := t.client.Remove(path.Join(t.dir, name))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (t *sftpTarget) Close() error {
+	err := t.client.Close()
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+// Package targets stores encrypted snapshot files off-site. A Target is a flat
+// namespace of named objects on S3-compatible storage, an SFTP server or a
+// local (typically mounted) directory. Snapshots are already encrypted by the
+// snapshots package before they reach a target.
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// Target types.
+const (
+	TypeS3   = "s3"
+	TypeSFTP = "sftp"
+	TypeFS   = "fs"
+)
+
+// ErrNotFound is returned by Get and Delete for a missing object.
+var ErrNotFound = errors.New("object not found")
+
+// Object is a stored file.
+type Object struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Target is an off-site store. Names are relative to the configured prefix
+// and never contain "/". Objects are streamed, so a snapshot never has to
+// fit in memory on its way to or from a target.
+type Target interface {
+	// Put stores the size bytes read from r under name, replacing any
+	// existing object. Nothing is stored if r ends early.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// Get opens an object for reading; the caller must close it.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context) ([]Object, error)
+	Delete(ctx context.Context, name string) error
+	Close() error
+}
+
+// Config configures a target. Only the fields of the selected Type are used.
+type Config struct {
+	Type   string `json:"type"`
+	Prefix string `json:"prefix,omitempty"` // directory or key prefix inside the target
+
+	// fs
+	Path string `json:"path,omitempty"`
+
+	// s3
+	Endpoint  string `json:"endpoint,omitempty"` // empty for AWS
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	PathStyle bool   `json:"path_style,omitempty"` // bucket in the path instead of the host name
+
+	// sftp
+	Host       string `json:"host,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"` // PEM
+	HostKey    string `json:"host_key,omitempty"`    // authorized_keys format, required
+}
+
+// secretMask replaces secrets in configs returned to clients.
+const secretMask = "********"
+
+// Masked returns a copy of c with secrets replaced by a mask.
+func (c Config) Masked() Config {
+	for _, s := range []*string{&c.SecretKey, &c.Password, &c.PrivateKey} {
+		if *s != "" {
+			*s = secretMask
+		}
+	}
+	return c
+}
+
+// MergeSecrets keeps the secrets of prev for fields a client sent back masked
+// or empty, so editing a target does not require re-entering them.
+func (c Config) MergeSecrets(prev Config) Config {
+	keep := func(s *string, old string) {
+		if *s == secretMask || *s == "" {
+			*s = old
+		}
+	}
+	keep(&c.SecretKey, prev.SecretKey)
+	keep(&c.Password, prev.Password)
+	keep(&c.PrivateKey, prev.PrivateKey)
+	return c
+}
+
+// Validate checks the fields required by the target type.
+func (c Config) Validate() error {
+	switch c.Type {
+	case TypeFS:
+		if c.Path == "" {
+			return errors.New("path is required")
+		}
+	case TypeS3:
+		if c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+			return errors.New("bucket, access_key and secret_key are required")
+		}
+		if c.Endpoint == "" && c.Region == "" {
+			return errors.New("region is required for AWS S3")
+		}
+	case TypeSFTP:
+		if c.Host == "" || c.Username == "" {
+			return errors.New("host and username are required")
+		}
+		if c.Password == "" && c.PrivateKey == "" {
+			return errors.New("password or private_key is required")
+		}
+		if c.HostKey == "" {
+			return errors.New("host_key is required")
+		}
+	default:
+		return fmt.Errorf("unsupported target type %q", c.Type)
+	}
+	if strings.Contains(c.Prefix, "..") {
+		return errors.New("prefix must not contain ..")
+	}
+	return nil
+}
+
+// New opens the target described by cfg. The caller must Close it.
+func New(ctx context.Context, cfg Config) (Target, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	switch cfg.Type {
+	case TypeFS:
+		return newFSTarget(cfg)
+	case TypeS3:
+		return newS3Target(cfg, nil)
+	default:
+		return dialSFTP(ctx, cfg)
+	}
+}
+
+// checkName rejects names that could escape the target prefix.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid object name %q", name)
+	}
+	return nil
+}
+
+// copySized copies r to w, failing unless r holds exactly size bytes.
+func copySized(w io.Writer, r io.Reader, size int64) error {
+	n, err := io.Copy(w, io.LimitReader(r, size+1))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("object is %d bytes, expected %d", n, size)
+	}
+	return nil
+}
+
+// cleanPrefix normalizes a prefix to "a/b" without leading or trailing slashes.
+func cleanPrefix(p string) string {
+	p = strings.Trim(path.Clean("/"+strings.ReplaceAll(p, `\`, "/")), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+package snapshots
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "# Agent\n\nline 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\n"
+	to := "# Agent v2\n\nline 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\n"
+
+	diff, ok := unifiedDiff("a/AGENTS.md", "b/AGENTS.md", from, to)
+	assert.True(t, ok)
+	assert.Equal(t, "--- a/AGENTS.md\n+++ b/AGENTS.md\n"+
+		"@@ -1,4 +1,4 @@\n-# Agent\n+# Agent v2\n \n line 1\n line 2\n"+
+		"@@ -9,3 +9,4 @@\n line 7\n line 8\n line 9\n+line 10\n", diff)
+
+	diff, ok = unifiedDiff("a", "b", "", "KEY=1")
+	assert.True(t, ok)
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1 @@\n+KEY=1\n\\ No newline at end of file\n", diff)
+
+	diff, ok = unifiedDiff("a", "b", "same\n", "same\n")
+	assert.True(t, ok)
+	assert.Empty(t, diff)
+}
+
+func TestDiffLines_RoundTrips(t *testing.T) {
+	cases := [][2]string{
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "x\ny\n"},
+		{"", "a\nb\n"},
+		{"a\nb\na\nb\n", "b\na\nb\na\n"},
+	}
+	for _, c := range cases {
+		ops, ok := diffLines(splitLines(c[0]), splitLines(c[1]))
+		assert.True(t, ok)
+		var from, to strings.Builder
+		for _, op := range ops {
+			if op.kind != '+' {
+				from.WriteString(op.text)
+			}
+			if op.kind != '-' {
+				to.WriteString(op.text)
+			}
+		}
+		assert.Equal(t, c[0], from.String(), fmt.Sprintf("%q", c))
+		assert.Equal(t, c[1], to.String(), fmt.Sprintf("%q", c))
+	}
+}
@@ -0,0 +1,451 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Workspace trees are whole directories backed up file by file: agent
+// workspaces, the memory store and session transcripts. They are opt-in per
+// type, filtered by include/exclude globs and capped in size. Tree files are
+// read, hashed and stored as blobs one at a time, so a large workspace never
+// has to fit in memory, and unlocked snapshots load them on demand.
+
+const (
+	TreeTypeWorkspace = "workspace"
+	TreeTypeMemory    = "memory"
+	TreeTypeSessions  = "sessions"
+
+	settingTreeConfig = "snapshot_tree_config"
+	treeLogicalPrefix = "files/trees/"
+	// maxTreeSkipsListed bounds the skipped files a tree manifest names.
+	maxTreeSkipsListed = 50
+)
+
+// TreeTypeConfig selects the files of one tree type. Globs match the
+// slash-separated path relative to the tree root; "**" matches any number
+// of directories and a pattern without "/" matches the file name at any
+// depth. An empty Include list includes everything; Exclude wins.
+type TreeTypeConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Include       []string `json:"include"`
+	Exclude       []string `json:"exclude"`
+	MaxFileBytes  int64    `json:"maxFileBytes"`
+	MaxTotalBytes int64    `json:"maxTotalBytes"` // per tree
+}
+
+type TreeConfig struct {
+	Workspace TreeTypeConfig `json:"workspace"`
+	Memory    TreeTypeConfig `json:"memory"`
+	Sessions  TreeTypeConfig `json:"sessions"`
+}
+
+// TreeSource is a directory backed up as a tree.
+type TreeSource struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Root string `json:"root"`
+}
+
+// TreeManifest describes a tree in a snapshot. Its files are manifest
+// resources under files/trees/<ID>/.
+type TreeManifest struct {
+	ID           string     `json:"id"`
+	Type         string     `json:"type"`
+	Root         string     `json:"root"`
+	FileCount    int        `json:"file_count"`
+	TotalBytes   int64      `json:"total_bytes"`
+	SkippedCount int        `json:"skipped_count"`
+	Skipped      []TreeSkip `json:"skipped,omitempty"`
+}
+
+// TreeSkip is a file left out of a tree: "too_large", "total_limit" or
+// "unreadable".
+type TreeSkip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func DefaultTreeConfig() TreeConfig {
+	return TreeConfig{
+		Workspace: TreeTypeConfig{
+			Exclude:       []string{"**/.git/**", "**/node_modules/**", "**/.venv/**", ".DS_Store", "*.tmp"},
+			MaxFileBytes:  10 << 20,
+			MaxTotalBytes: 100 << 20,
+		},
+		Memory: TreeTypeConfig{
+			MaxFileBytes:  50 << 20,
+			MaxTotalBytes: 100 << 20,
+		},
+		Sessions: TreeTypeConfig{
+			Include:       []string{"*.jsonl"},
+			MaxFileBytes:  20 << 20,
+			MaxTotalBytes: 100 << 20,
+		},
+	}
+}
+
+func (c TreeConfig) forType(t string) TreeTypeConfig {
+	switch t {
+	case TreeTypeWorkspace:
+		return c.Workspace
+	case TreeTypeMemory:
+		return c.Memory
+	case TreeTypeSessions:
+		return c.Sessions
+	}
+	return TreeTypeConfig{}
+}
+
+func (c TreeConfig) validate() error {
+	for _, t := range []string{TreeTypeWorkspace, TreeTypeMemory, TreeTypeSessions} {
+		tc := c.forType(t)
+		if tc.MaxTotalBytes <= 0 || tc.MaxTotalBytes > MaxSnapshotSizeBytes {
+			return fmt.Errorf("%s: total size cap must be between 1 and %d bytes", t, int64(MaxSnapshotSizeBytes))
+		}
+		if tc.MaxFileBytes <= 0 || tc.MaxFileBytes > tc.MaxTotalBytes {
+			return fmt.Errorf("%s: file size cap must be between 1 byte and the total size cap", t)
+		}
+		for _, p := range append(append([]string{}, tc.Include...), tc.Exclude...) {
+			if p == "" {
+				return fmt.Errorf("%s: empty glob", t)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("%s: invalid glob %q", t, p)
+			}
+		}
+	}
+	return nil
+}
+
+// TreeConfig returns the stored tree settings, or the defaults.
+func (s *Service) TreeConfig() TreeConfig {
+	cfg := DefaultTreeConfig()
+	if raw, err := s.settings.Get(settingTreeConfig); err == nil && raw != "" {
+		_ = json.Unmarshal([]byte(raw), &cfg)
+	}
+	return cfg
+}
+
+func (s *Service) UpdateTreeConfig(cfg TreeConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return s.settings.Set(settingTreeConfig, string(raw))
+}
+
+// PreviewTrees lists every discovered tree with what a snapshot would
+// include under the current settings, without reading file contents.
+func (s *Service) PreviewTrees() ([]TreeManifest, error) {
+	cfg := s.TreeConfig()
+	out := []TreeManifest{}
+	for _, src := range discoverTrees(resolveStateDir()) {
+		tm, err := walkTree(src, cfg.forType(src.Type), nil)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tm)
+	}
+	return out, nil
+}
+
+// selectTrees returns the enabled trees a snapshot of resourceIDs covers:
+// all of them for a full snapshot, otherwise those whose ID is listed.
+// Trees are only read from a local gateway's disk.
+func (s *Service) selectTrees(resourceIDs []string) []TreeSource {
+	if !s.isLocalGateway() {
+		return nil
+	}
+	cfg := s.TreeConfig()
+	var out []TreeSource
+	for _, src := range discoverTrees(resolveStateDir()) {
+		if !cfg.forType(src.Type).Enabled {
+			continue
+		}
+		if len(resourceIDs) > 0 && !containsString(resourceIDs, src.ID) {
+			continue
+		}
+		out = append(out, src)
+	}
+	return out
+}
+
+// storeTrees stores the files of trees as blobs of snapshotID and adds
+// them to manifest. It returns their index objects and stored size. Blobs
+// are referenced as they are written; on error the caller must drop the
+// snapshot's refs with DeleteBySnapshotID.
+func (s *Service) storeTrees(snapshotID string, trees []TreeSource, manifest *SnapshotManifest) ([]blobObject, int64, error) {
+	cfg := s.TreeConfig()
+	var objects []blobObject
+	var stored int64
+	for _, src := range trees {
+		tm, err := walkTree(src, cfg.forType(src.Type), func(rel string, r io.Reader) error {
+			logicalPath := treeLogicalPath(src.ID, rel)
+			so, err := s.putObject(snapshotID, logicalPath, r)
+			if err != nil {
+				return err
+			}
+			stored += so.Stored
+			manifest.Resources = append(manifest.Resources, ManifestResource{
+				ID:          src.ID + ":" + rel,
+				Type:        src.Type,
+				DisplayName: rel,
+				LogicalPath: logicalPath,
+				RestoreMode: RestoreModeFile,
+				Size:        so.Size,
+				SHA256:      so.SHA256,
+			})
+			objects = append(objects, so.Object)
+			return nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		manifest.Trees = append(manifest.Trees, tm)
+	}
+	return objects, stored, nil
+}
+
+// walkTree calls fn with a reader over every file of src that cfg
+// selects, one file at a time, and describes the result. With a nil fn
+// files are only listed. A file that cannot be read to the end is skipped;
+// any other error from fn aborts the walk.
+func walkTree(src TreeSource, cfg TreeTypeConfig, fn func(rel string, r io.Reader) error) (TreeManifest, error) {
+	tm := TreeManifest{ID: src.ID, Type: src.Type, Root: src.Root}
+	skip := func(rel, reason string) {
+		tm.SkippedCount++
+		if len(tm.Skipped) < maxTreeSkipsListed {
+			tm.Skipped = append(tm.Skipped, TreeSkip{Path: rel, Reason: reason})
+		}
+	}
+	err := filepath.WalkDir(src.Root, func(p string, d fs.DirEntry, walkErr error) error {
+		rel, err := filepath.Rel(src.Root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if walkErr != nil {
+			if p == src.Root {
+				return walkErr
+			}
+			skip(rel, "unreadable")
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if p != src.Root && matchAny(cfg.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || matchAny(cfg.Exclude, rel) {
+			return nil
+		}
+		if len(cfg.Include) > 0 && !matchAny(cfg.Include, rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			skip(rel, "unreadable")
+			return nil
+		}
+		switch {
+		case info.Size() > cfg.MaxFileBytes:
+			skip(rel, "too_large")
+			return nil
+		case tm.TotalBytes+info.Size() > cfg.MaxTotalBytes:
+			skip(rel, "total_limit")
+			return nil
+		}
+		if fn != nil {
+			f, err := os.Open(p)
+			if err != nil {
+				skip(rel, "unreadable")
+				return nil
+			}
+			cr := &cappedReader{r: f, max: cfg.MaxFileBytes}
+			err = fn(rel, cr)
+			if err == nil {
+				// Whatever fn left unread still counts towards the caps.
+				_, _ = io.Copy(io.Discard, cr)
+			}
+			f.Close()
+			switch {
+			case errors.Is(cr.err, errFileGrew):
+				skip(rel, "too_large")
+				return nil
+			case cr.err != nil:
+				skip(rel, "unreadable")
+				return nil
+			case err != nil:
+				return err
+			}
+			tm.TotalBytes += cr.n
+		} else {
+			tm.TotalBytes += info.Size()
+		}
+		tm.FileCount++
+		return nil
+	})
+	return tm, err
+}
+
+// discoverTrees finds the agent workspaces named in openclaw.json (or the
+// default workspace), the memory store and the session transcript
+// directories. Only existing directories are returned.
+func discoverTrees(stateDir string) []TreeSource {
+	return treeSources(stateDir, true)
+}
+
+// treeSources lists the trees the local configuration defines, optionally
+// only those whose root directory exists.
+func treeSources(stateDir string, existingOnly bool) []TreeSource {
+	if stateDir == "" {
+		return nil
+	}
+	var out []TreeSource
+	seen := map[string]bool{}
+	add := func(id, typ, root string) {
+		root = filepath.Clean(root)
+		if seen[root] {
+			return
+		}
+		if st, err := os.Stat(root); existingOnly && (err != nil || !st.IsDir()) {
+			return
+		}
+		seen[root] = true
+		out = append(out, TreeSource{ID: id, Type: typ, Root: root})
+	}
+
+	var cfg struct {
+		Agents struct {
+			Defaults struct {
+				Workspace string `json:"workspace"`
+			} `json:"defaults"`
+			List []struct {
+				ID        string `json:"id"`
+				Workspace string `json:"workspace"`
+			} `json:"list"`
+		} `json:"agents"`
+	}
+	if data, err := os.ReadFile(filepath.Join(stateDir, "openclaw.json")); err == nil {
+		_ = json.Unmarshal(data, &cfg)
+	}
+	defaultWorkspace := filepath.Join(stateDir, "workspace")
+	if cfg.Agents.Defaults.Workspace != "" {
+		defaultWorkspace = expandTreeRoot(stateDir, cfg.Agents.Defaults.Workspace)
+	}
+	add(TreeTypeWorkspace+".default", TreeTypeWorkspace, defaultWorkspace)
+	for _, a := range cfg.Agents.List {
+		id := sanitizeResourceSegment(a.ID)
+		if id == "" || a.Workspace == "" {
+			continue
+		}
+		add(TreeTypeWorkspace+"."+id, TreeTypeWorkspace, expandTreeRoot(stateDir, a.Workspace))
+	}
+
+	add(TreeTypeMemory, TreeTypeMemory, filepath.Join(stateDir, "memory"))
+	add(TreeTypeSessions, TreeTypeSessions, filepath.Join(stateDir, "sessions"))
+	if entries, err := os.ReadDir(filepath.Join(stateDir, "agents")); err == nil {
+		for _, e := range entries {
+			if id := sanitizeResourceSegment(e.Name()); e.IsDir() && id != "" {
+				add(TreeTypeSessions+"."+id, TreeTypeSessions, filepath.Join(stateDir, "agents", e.Name(), "sessions"))
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func expandTreeRoot(stateDir, p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	if !filepath.IsAbs(p) {
+		return filepath.Join(stateDir, p)
+	}
+	return p
+}
+
+func treeLogicalPath(treeID, rel string) string {
+	return treeLogicalPrefix + treeID + "/" + rel
+}
+
+func isTreePath(logicalPath string) bool {
+	return strings.HasPrefix(logicalPath, treeLogicalPrefix)
+}
+
+// treeFilePath resolves a tree file to its place on disk, under the root the
+// local configuration gives the tree. Roots recorded in a snapshot are never
+// used, so an imported bundle cannot write outside the trees this host
+// defines. Unknown trees and paths that would leave the root resolve to "".
+func treeFilePath(logicalPath string) string {
+	id, rel, ok := strings.Cut(strings.TrimPrefix(logicalPath, treeLogicalPrefix), "/")
+	if !ok || !isTreePath(logicalPath) || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return ""
+	}
+	for _, src := range treeSources(resolveStateDir(), false) {
+		if src.ID == id {
+			return filepath.Join(src.Root, filepath.FromSlash(rel))
+		}
+	}
+	return ""
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if matchGlob(p, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a slash-separated relative path against a tree glob.
+func matchGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
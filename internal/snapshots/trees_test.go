@@ -0,0 +1,164 @@
+package snapshots
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ClawDeckX/internal/database"
+	"ClawDeckX/internal/testutil"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"*.md", "notes/today.md", true},
+		{"*.md", "today.txt", false},
+		{"notes/*.md", "notes/today.md", true},
+		{"notes/*.md", "notes/2026/today.md", false},
+		{"notes/**", "notes/2026/today.md", true},
+		{"**/.git/**", ".git", true},
+		{"**/.git/**", "repo/.git/HEAD", true},
+		{"**/node_modules/**", "app/src/index.js", false},
+		{"**/*.jsonl", "a/b/c.jsonl", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, matchGlob(c.pattern, c.rel), "%s ~ %s", c.pattern, c.rel)
+	}
+}
+
+func TestWalkTree_GlobsAndCaps(t *testing.T) {
+	root := t.TempDir()
+	writeStateFile(t, root, "notes/a.md", "aaaa")
+	writeStateFile(t, root, "notes/b.md", "bbbb")
+	writeStateFile(t, root, "big.bin", strings.Repeat("x", 64))
+	writeStateFile(t, root, ".git/HEAD", "ref")
+	writeStateFile(t, root, "scratch.tmp", "tmp")
+
+	cfg := TreeTypeConfig{Exclude: []string{"**/.git/**", "*.tmp"}, MaxFileBytes: 16, MaxTotalBytes: 6}
+	var seen []string
+	tm, err := walkTree(TreeSource{ID: "workspace.default", Type: TreeTypeWorkspace, Root: root}, cfg, func(rel string, r io.Reader) error {
+		seen = append(seen, rel)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"notes/a.md"}, seen)
+	assert.Equal(t, 1, tm.FileCount)
+	assert.Equal(t, int64(4), tm.TotalBytes)
+	assert.Equal(t, []TreeSkip{{Path: "big.bin", Reason: "too_large"}, {Path: "notes/b.md", Reason: "total_limit"}}, tm.Skipped)
+
+	cfg = TreeTypeConfig{Include: []string{"notes/**"}, MaxFileBytes: 16, MaxTotalBytes: 100}
+	tm, err = walkTree(TreeSource{Root: root}, cfg, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, tm.FileCount)
+}
+
+func TestWorkspaceTree_SnapshotAndSelectiveRestore(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	writeStateFile(t, dir, "openclaw.json", `{"agents":{"defaults":{"workspace":"ws"}}}`)
+	noteA := writeStateFile(t, dir, "ws/notes/a.md", "first\n")
+	noteB := writeStateFile(t, dir, "ws/notes/b.md", "second\n")
+	writeStateFile(t, dir, "ws/README.md", "readme\n")
+	writeStateFile(t, dir, "ws/.git/HEAD", "ref")
+
+	svc := NewService()
+	cfg := DefaultTreeConfig()
+	cfg.Workspace.Enabled = true
+	require.NoError(t, svc.UpdateTreeConfig(cfg))
+
+	rec, err := svc.Create("with workspace", DefaultSnapshotTag, testPassword, nil)
+	require.NoError(t, err)
+	refs, err := database.NewSnapshotBlobRepo().ListBySnapshot(rec.SnapshotID)
+	require.NoError(t, err)
+	assert.Len(t, refs, 4, "config and three workspace files")
+	assert.Contains(t, rec.ManifestSummaryJSON, `"trees"`)
+	assert.NotContains(t, rec.ManifestSummaryJSON, `"workspace.default:README.md"`)
+
+	unlock, err := svc.UnlockPreview(rec.SnapshotID, testPassword)
+	require.NoError(t, err)
+	require.Len(t, unlock.Manifest.Trees, 1)
+	assert.Equal(t, 3, unlock.Manifest.Trees[0].FileCount)
+	ub, err := svc.getToken(unlock.PreviewToken)
+	require.NoError(t, err)
+	assert.Len(t, ub.Lazy, 3, "tree files are not loaded on unlock")
+
+	require.NoError(t, os.WriteFile(noteA, []byte("edited\n"), 0o600))
+	require.NoError(t, os.Remove(noteB))
+
+	sel := RestoreSelections{Dirs: []string{"files/trees/workspace.default/notes/"}}
+	plan, err := svc.RestorePlan(unlock.PreviewToken, sel)
+	require.NoError(t, err)
+	status := map[string]string{}
+	for _, f := range plan.Files {
+		status[f.ID] = f.Status
+	}
+	assert.Equal(t, map[string]string{
+		"workspace.default:notes/a.md": RestoreFileConflict,
+		"workspace.default:notes/b.md": RestoreFileCreate,
+	}, status)
+	assert.Equal(t, 2, plan.WillModifyFiles)
+
+	sel.Keep = []string{"workspace.default:notes/a.md"}
+	res, err := svc.Restore(unlock.PreviewToken, sel, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"workspace.default:notes/b.md"}, res.RestoredResources)
+	b, _ := os.ReadFile(noteB)
+	assert.Equal(t, "second\n", string(b))
+	a, _ := os.ReadFile(noteA)
+	assert.Equal(t, "edited\n", string(a))
+
+	diff, err := svc.Diff(unlock.PreviewToken, "", []string{"files/trees/workspace.default/notes/a.md"})
+	require.NoError(t, err)
+	require.Len(t, diff.Resources, 1)
+	assert.Contains(t, diff.Resources[0].Diff, "-first\n+edited\n")
+
+	// A path escaping the tree root never resolves.
+	assert.Empty(t, treeFilePath("files/trees/workspace.default/../../etc/passwd"))
+	assert.Equal(t, filepath.Join(dir, "ws", "notes", "a.md"), treeFilePath("files/trees/workspace.default/notes/a.md"))
+}
+
+func TestTreeRestore_RefusesRootsOnlyInManifest(t *testing.T) {
+	cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+	dir := t.TempDir()
+	outside := t.TempDir()
+	t.Setenv("OPENCLAW_STATE_DIR", dir)
+	writeStateFile(t, dir, "openclaw.json", `{"agents":{"list":[{"id":"evil","workspace":"`+filepath.ToSlash(outside)+`"}]}}`)
+	planted := writeStateFile(t, outside, "payload.sh", "echo owned\n")
+
+	svc := NewService()
+	cfg := DefaultTreeConfig()
+	cfg.Workspace.Enabled = true
+	require.NoError(t, svc.UpdateTreeConfig(cfg))
+	rec, err := svc.Create("outside root", DefaultSnapshotTag, testPassword, nil)
+	require.NoError(t, err)
+
+	// The bundle records the outside root; this host no longer defines the tree.
+	writeStateFile(t, dir, "openclaw.json", `{}`)
+	require.NoError(t, os.Remove(planted))
+
+	unlock, err := svc.UnlockPreview(rec.SnapshotID, testPassword)
+	require.NoError(t, err)
+	var recorded []string
+	for _, tm := range unlock.Manifest.Trees {
+		recorded = append(recorded, tm.Root)
+	}
+	assert.Contains(t, recorded, outside)
+	assert.Empty(t, treeFilePath("files/trees/workspace.evil/payload.sh"))
+
+	_, err = svc.Restore(unlock.PreviewToken, RestoreSelections{Dirs: []string{"files/trees/workspace.evil/"}}, false, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not inside a tree defined on this host")
+	_, statErr := os.Stat(planted)
+	assert.True(t, os.IsNotExist(statErr), "nothing is written under the recorded root")
+}
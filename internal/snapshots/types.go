@@ -1,14 +1,21 @@
 package snapshots
 
-import "time"
+import (
+	"time"
+
+	"ClawDeckX/internal/database"
+)
 
 const (
-	SnapshotVersion1        = 1
+	SnapshotVersion1        = 1 // whole bundle sealed in the snapshot row
+	SnapshotVersion2        = 2 // content-addressed blobs, see blobstore.go
+	SnapshotVersion3        = 3 // large files split into chunk blobs, see stream.go
 	RestoreModeFile         = "file"
 	RestoreModeJSON         = "json_fields"
 	PreviewTokenTTL         = 5 * time.Minute
 	DefaultSnapshotTag      = "manual"
 	ScheduledSnapshotTag    = "scheduled"
+	AutoChangeSnapshotTag   = "auto-change"
 	ScheduleStatusNever     = "never"
 	ScheduleStatusSuccess   = "success"
 	ScheduleStatusFailed    = "failed"
@@ -54,6 +61,7 @@ type SnapshotManifest struct {
 	AppVersion      string             `json:"app_version"`
 	Resources       []ManifestResource `json:"resources"`
 	ConfigFields    []ConfigFieldEntry `json:"config_fields,omitempty"`
+	Trees           []TreeManifest     `json:"trees,omitempty"`
 }
 
 type SnapshotSummary struct {
@@ -65,6 +73,8 @@ type SnapshotSummary struct {
 	SizeBytes     int64     `json:"size_bytes"`
 	ResourceIDs   []string  `json:"resource_ids,omitempty"`
 	ResourcePaths []string  `json:"resource_paths,omitempty"`
+
+	Uploads []database.SnapshotUpload `json:"uploads,omitempty"` // copies on off-site targets
 }
 
 type UnlockPreviewResponse struct {
@@ -74,15 +84,45 @@ type UnlockPreviewResponse struct {
 	ConfigFields []ConfigFieldEntry `json:"config_fields"`
 }
 
+// RestoreSelections picks what to restore. Files are resource IDs; Dirs
+// select every file under a logical directory such as
+// files/trees/workspace.default/notes. Keep lists resource IDs to leave as
+// they are even though they were selected.
 type RestoreSelections struct {
 	Files       []string `json:"files"`
+	Dirs        []string `json:"dirs,omitempty"`
+	Keep        []string `json:"keep,omitempty"`
 	ConfigPaths []string `json:"config_paths"`
 }
 
+// Live state of a file a restore would write.
+const (
+	RestoreFileCreate    = "create"    // missing on disk
+	RestoreFileUnchanged = "unchanged" // same content as the snapshot
+	RestoreFileConflict  = "conflict"  // changed since the snapshot, or unreadable
+)
+
+// What a restore does with a selected file.
+const (
+	RestoreActionWrite = "write"
+	RestoreActionKeep  = "keep"
+)
+
+// restorePlanWorkers bounds the live files RestorePlan reads at once.
+const restorePlanWorkers = 8
+
+type RestoreFilePlan struct {
+	ID          string `json:"id"`
+	LogicalPath string `json:"logical_path"`
+	Status      string `json:"status"`
+	Action      string `json:"action"`
+}
+
 type RestorePlanResponse struct {
-	WillModifyFiles       int      `json:"will_modify_files"`
-	WillModifyConfigPaths int      `json:"will_modify_config_paths"`
-	Warnings              []string `json:"warnings"`
+	WillModifyFiles       int               `json:"will_modify_files"`
+	WillModifyConfigPaths int               `json:"will_modify_config_paths"`
+	Warnings              []string          `json:"warnings"`
+	Files                 []RestoreFilePlan `json:"files"`
 }
 
 type RestoreResponse struct {
@@ -94,16 +134,18 @@ type RestoreResponse struct {
 	GatewayRestartError  string   `json:"gateway_restart_error,omitempty"`
 }
 
-// RestoreProgressEvent is sent via SSE during restore.
+// RestoreProgressEvent is sent via SSE during restore, and during import
+// and verify when the client asks for a stream.
 type RestoreProgressEvent struct {
-	Phase   string `json:"phase"`   // "pre_backup", "file", "config", "done", "error"
-	Current int    `json:"current"` // current step index (1-based)
-	Total   int    `json:"total"`   // total steps
-	File    string `json:"file"`    // current file being restored
+	Phase   string `json:"phase"`           // "pre_backup", "file", "config", "import", "verify", "done", "error"
+	Current int    `json:"current"`         // current step index (1-based)
+	Total   int    `json:"total"`           // total steps
+	File    string `json:"file"`            // current file being restored
+	Bytes   int64  `json:"bytes,omitempty"` // bytes processed so far
 	Error   string `json:"error,omitempty"`
 }
 
-// ProgressFn is called during restore to report progress.
+// ProgressFn is called during restore, import and verify to report progress.
 type ProgressFn func(evt RestoreProgressEvent)
 
 type ScheduleRunNowResponse struct {
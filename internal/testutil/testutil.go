@@ -26,22 +26,42 @@ func SetupTestDB(t *testing.T) func() {
 	// Auto migrate all models
 	err = db.AutoMigrate(
 		&database.User{},
+		&database.Role{},
+		&database.APIToken{},
+		&database.Session{},
 		&database.Activity{},
 		&database.Alert{},
+		&database.AlertRule{},
+		&database.GatewayLifecycle{},
+		&database.GatewayAvailabilityDaily{},
+		&database.GatewaySLO{},
+		&database.RemediationPolicy{},
+		&database.RemediationRun{},
 		&database.AuditLog{},
+		&database.AuditCheckpoint{},
 		&database.MonitorState{},
+		&database.SessionFileState{},
+		&database.SessionTranscript{},
 		&database.SnapshotRecord{},
+		&database.SnapshotSchedule{},
+		&database.SnapshotBlob{},
+		&database.SnapshotBlobRef{},
 		&database.Setting{},
 		&database.CredentialScan{},
 		&database.ConnectionLog{},
 		&database.SkillHash{},
 		&database.GatewayProfile{},
+		&database.SnapshotTarget{},
+		&database.SnapshotUpload{},
 		&database.Template{},
 		&database.SkillTranslation{},
 	)
 	if err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
+	if err := database.EnsureSearchIndex(db); err != nil {
+		t.Fatalf("failed to create search index: %v", err)
+	}
 
 	// Set global DB
 	database.DB = db
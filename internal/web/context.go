@@ -14,8 +14,29 @@ const (
 	userIDKey    contextKey = "user_id"
 	usernameKey  contextKey = "username"
 	roleKey      contextKey = "role"
+	permsKey     contextKey = "perms"
+	apiTokenKey  contextKey = "api_token"
+	sessionKey   contextKey = "session"
+	routeKey     contextKey = "route"
 )
 
+// routeHolder is filled in by the Router with the matched route pattern so
+// outer middleware can label metrics without high-cardinality raw paths.
+type routeHolder struct {
+	pattern string
+}
+
+func withRouteHolder(r *http.Request) (*http.Request, *routeHolder) {
+	h := &routeHolder{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey, h)), h
+}
+
+func setRoutePattern(r *http.Request, pattern string) {
+	if h, ok := r.Context().Value(routeKey).(*routeHolder); ok {
+		h.pattern = pattern
+	}
+}
+
 func SetRequestID(r *http.Request, id string) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
 }
@@ -27,11 +48,12 @@ func GetRequestID(r *http.Request) string {
 	return ""
 }
 
-func SetUserInfo(r *http.Request, userID uint, username, role string) *http.Request {
+func SetUserInfo(r *http.Request, userID uint, username, role string, perms []string) *http.Request {
 	ctx := r.Context()
 	ctx = context.WithValue(ctx, userIDKey, userID)
 	ctx = context.WithValue(ctx, usernameKey, username)
 	ctx = context.WithValue(ctx, roleKey, role)
+	ctx = context.WithValue(ctx, permsKey, perms)
 	return r.WithContext(ctx)
 }
 
@@ -56,6 +78,54 @@ func GetRole(r *http.Request) string {
 	return ""
 }
 
+func GetPermissions(r *http.Request) []string {
+	if v, ok := r.Context().Value(permsKey).([]string); ok {
+		return v
+	}
+	return nil
+}
+
+// SetAPIToken marks the request as authenticated by the API token with the given ID.
+func SetAPIToken(r *http.Request, tokenID uint) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apiTokenKey, tokenID))
+}
+
+// GetAPIToken returns the ID of the API token used for the request, 0 for a login session.
+func GetAPIToken(r *http.Request) uint {
+	if v, ok := r.Context().Value(apiTokenKey).(uint); ok {
+		return v
+	}
+	return 0
+}
+
+// SetSessionID records the server-side session of a JWT-authenticated request.
+func SetSessionID(r *http.Request, sessionID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionKey, sessionID))
+}
+
+// GetSessionID returns the request's session ID, "" for API tokens.
+func GetSessionID(r *http.Request) string {
+	if v, ok := r.Context().Value(sessionKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// HasPermission reports whether the request's user holds perm. The admin role
+// always passes for login sessions so JWTs issued before permissions existed
+// keep working; API tokens are limited to their scopes.
+func HasPermission(r *http.Request, perm string) bool {
+	if GetRole(r) == "admin" && GetAPIToken(r) == 0 {
+		return true
+	}
+	for _, p := range GetPermissions(r) {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
 func GenerateRequestID() string {
 	b := make([]byte, 8)
 	rand.Read(b)
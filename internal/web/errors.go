@@ -54,6 +54,21 @@ var (
 	ErrSetupDone        = &AppError{"AUTH_SETUP_DONE", "admin account already exists", 409, nil}
 	ErrOldPasswordWrong = &AppError{"AUTH_OLD_PASSWORD_WRONG", "old password incorrect", 401, nil}
 	ErrLoginFailed      = &AppError{"AUTH_LOGIN_FAILED", "login failed", 500, nil}
+	ErrTOTPInvalidCode  = &AppError{"AUTH_TOTP_INVALID_CODE", "invalid two-factor code", 401, nil}
+	ErrTOTPNotEnabled   = &AppError{"AUTH_TOTP_NOT_ENABLED", "two-factor authentication is not enabled", 400, nil}
+	ErrTOTPNoEnrollment = &AppError{"AUTH_TOTP_NO_ENROLLMENT", "no pending two-factor enrollment, start again", 400, nil}
+	ErrTOTPRequired     = &AppError{"AUTH_TOTP_REQUIRED", "two-factor authentication is required for this account", 403, nil}
+	ErrMFAChallenge     = &AppError{"AUTH_MFA_CHALLENGE_INVALID", "login challenge expired, please login again", 401, nil}
+)
+
+// ---------------------------------------------------------------------------
+// Single sign-on
+// ---------------------------------------------------------------------------
+
+var (
+	ErrLocalLoginDisabled = &AppError{"AUTH_LOCAL_LOGIN_DISABLED", "password login is disabled, use single sign-on", 403, nil}
+	ErrOIDCDisabled       = &AppError{"AUTH_OIDC_DISABLED", "single sign-on is not configured", 404, nil}
+	ErrOIDCProvider       = &AppError{"AUTH_OIDC_PROVIDER", "identity provider unavailable", 502, nil}
 )
 
 // ---------------------------------------------------------------------------
@@ -83,6 +98,22 @@ var (
 	ErrUserDeleteFail = &AppError{"USER_DELETE_FAILED", "user deletion failed", 500, nil}
 	ErrUserQueryFail  = &AppError{"USER_QUERY_FAILED", "user query failed", 500, nil}
 	ErrUserSelfDelete = &AppError{"USER_SELF_DELETE", "cannot delete current user", 403, nil}
+	ErrUserSelfRole   = &AppError{"USER_SELF_ROLE", "cannot change the role of the current user", 403, nil}
+	ErrUserUpdateFail = &AppError{"USER_UPDATE_FAILED", "user update failed", 500, nil}
+	ErrRoleNotFound   = &AppError{"ROLE_NOT_FOUND", "role not found", 404, nil}
+	ErrRoleInvalid    = &AppError{"ROLE_INVALID", "invalid role", 400, nil}
+	ErrRoleExists     = &AppError{"ROLE_EXISTS", "role name already exists", 409, nil}
+	ErrRoleBuiltIn    = &AppError{"ROLE_BUILT_IN", "built-in roles cannot be modified", 403, nil}
+	ErrRoleInUse      = &AppError{"ROLE_IN_USE", "role is still assigned to users", 409, nil}
+	ErrRoleSaveFail   = &AppError{"ROLE_SAVE_FAILED", "role save failed", 500, nil}
+	ErrRoleDeleteFail = &AppError{"ROLE_DELETE_FAILED", "role deletion failed", 500, nil}
+)
+
+var (
+	ErrAPITokenNotFound = &AppError{"API_TOKEN_NOT_FOUND", "API token not found", 404, nil}
+	ErrAPITokenInvalid  = &AppError{"API_TOKEN_INVALID", "invalid API token request", 400, nil}
+	ErrAPITokenSaveFail = &AppError{"API_TOKEN_SAVE_FAILED", "API token save failed", 500, nil}
+	ErrSessionNotFound  = &AppError{"SESSION_NOT_FOUND", "session not found", 404, nil}
 )
 
 // ---------------------------------------------------------------------------
@@ -101,6 +132,7 @@ var (
 	ErrGWProfileSaveFail     = &AppError{"GW_PROFILE_SAVE_FAILED", "gateway profile save failed", 500, nil}
 	ErrGWProfileDeleteFail   = &AppError{"GW_PROFILE_DELETE_FAILED", "gateway profile delete failed", 500, nil}
 	ErrGWDiagnoseFailed      = &AppError{"GW_DIAGNOSE_FAILED", "gateway diagnosis failed", 502, nil}
+	ErrGWFleetNotConnected   = &AppError{"GW_FLEET_NOT_CONNECTED", "selected gateway is not connected in fleet mode", 404, nil}
 	ErrDaemonInstallFailed   = &AppError{"DAEMON_INSTALL_FAILED", "daemon install failed", 500, nil}
 	ErrDaemonUninstallFailed = &AppError{"DAEMON_UNINSTALL_FAILED", "daemon uninstall failed", 500, nil}
 )
@@ -174,6 +206,16 @@ var (
 	ErrSnapshotDeleteFailed  = &AppError{"SNAPSHOT_DELETE_FAILED", "backup deletion failed", 500, nil}
 )
 
+var (
+	ErrSnapshotTargetNotFound = &AppError{"SNAPSHOT_TARGET_NOT_FOUND", "backup target not found", 404, nil}
+	ErrSnapshotTargetInvalid  = &AppError{"SNAPSHOT_TARGET_INVALID", "invalid backup target", 400, nil}
+	ErrSnapshotTargetExists   = &AppError{"SNAPSHOT_TARGET_EXISTS", "backup target name already exists", 409, nil}
+	ErrSnapshotTargetFailed   = &AppError{"SNAPSHOT_TARGET_FAILED", "backup target request failed", 502, nil}
+	ErrSnapshotUploadFailed   = &AppError{"SNAPSHOT_UPLOAD_FAILED", "backup upload failed", 502, nil}
+	ErrScheduleNotFound       = &AppError{"SNAPSHOT_SCHEDULE_NOT_FOUND", "backup schedule not found", 404, nil}
+	ErrScheduleInvalid        = &AppError{"SNAPSHOT_SCHEDULE_INVALID", "invalid backup schedule", 400, nil}
+)
+
 // ---------------------------------------------------------------------------
 // Settings
 // ---------------------------------------------------------------------------
@@ -229,6 +271,58 @@ var (
 	ErrExportFailed     = &AppError{"EXPORT_FAILED", "export failed", 500, nil}
 )
 
+var (
+	ErrAuditVerifyFail     = &AppError{"AUDIT_VERIFY_FAILED", "audit log verification failed", 500, nil}
+	ErrAuditCheckpointFail = &AppError{"AUDIT_CHECKPOINT_FAILED", "audit checkpoint failed", 500, nil}
+)
+
+var (
+	ErrAlertStateConflict  = &AppError{"ALERT_STATE_CONFLICT", "alert cannot change to the requested state", 409, nil}
+	ErrAlertUpdateFail     = &AppError{"ALERT_UPDATE_FAILED", "alert update failed", 500, nil}
+	ErrAlertRuleNotFound   = &AppError{"ALERT_RULE_NOT_FOUND", "alert rule not found", 404, nil}
+	ErrAlertRuleInvalid    = &AppError{"ALERT_RULE_INVALID", "invalid alert rule", 400, nil}
+	ErrAlertRuleSaveFail   = &AppError{"ALERT_RULE_SAVE_FAILED", "alert rule save failed", 500, nil}
+	ErrAlertRuleDeleteFail = &AppError{"ALERT_RULE_DELETE_FAILED", "alert rule deletion failed", 500, nil}
+	ErrAlertRuleDryRunFail = &AppError{"ALERT_RULE_DRY_RUN_FAILED", "alert rule dry run failed", 500, nil}
+)
+
+var (
+	ErrRemediationNotFound   = &AppError{"REMEDIATION_NOT_FOUND", "remediation policy not found", 404, nil}
+	ErrRemediationInvalid    = &AppError{"REMEDIATION_INVALID", "invalid remediation policy", 400, nil}
+	ErrRemediationSaveFail   = &AppError{"REMEDIATION_SAVE_FAILED", "remediation policy save failed", 500, nil}
+	ErrRemediationDeleteFail = &AppError{"REMEDIATION_DELETE_FAILED", "remediation policy deletion failed", 500, nil}
+	ErrRemediationBusy       = &AppError{"REMEDIATION_BUSY", "remediation policy is already running", 409, nil}
+	ErrRemediationRunFail    = &AppError{"REMEDIATION_RUN_FAILED", "remediation run failed to start", 500, nil}
+)
+
+var (
+	ErrAvailabilityInvalid   = &AppError{"AVAILABILITY_INVALID", "invalid availability query", 400, nil}
+	ErrAvailabilityQueryFail = &AppError{"AVAILABILITY_QUERY_FAILED", "availability report failed", 500, nil}
+	ErrSLONotFound           = &AppError{"SLO_NOT_FOUND", "SLO not found", 404, nil}
+	ErrSLOInvalid            = &AppError{"SLO_INVALID", "invalid SLO", 400, nil}
+	ErrSLOSaveFail           = &AppError{"SLO_SAVE_FAILED", "SLO save failed", 500, nil}
+	ErrSLODeleteFail         = &AppError{"SLO_DELETE_FAILED", "SLO deletion failed", 500, nil}
+)
+
+var (
+	ErrRiskPolicyInvalid  = &AppError{"RISK_POLICY_INVALID", "invalid risk policy", 400, nil}
+	ErrRiskPolicySaveFail = &AppError{"RISK_POLICY_SAVE_FAILED", "risk policy save failed", 500, nil}
+	ErrRiskPolicyLoadFail = &AppError{"RISK_POLICY_LOAD_FAILED", "risk policy file could not be loaded", 400, nil}
+)
+
+var (
+	ErrSearchInvalid = &AppError{"SEARCH_INVALID", "invalid search query", 400, nil}
+	ErrSearchFail    = &AppError{"SEARCH_FAILED", "search failed", 500, nil}
+)
+
+var (
+	ErrRetentionInvalid  = &AppError{"RETENTION_INVALID", "invalid retention request", 400, nil}
+	ErrRetentionBusy     = &AppError{"RETENTION_BUSY", "a retention job is already running", 409, nil}
+	ErrRetentionFail     = &AppError{"RETENTION_FAILED", "retention operation failed", 500, nil}
+	ErrArchiveNotFound   = &AppError{"ARCHIVE_NOT_FOUND", "archive file not found", 404, nil}
+	ErrArchiveImportFail = &AppError{"ARCHIVE_IMPORT_FAILED", "archive import failed", 500, nil}
+)
+
 // ---------------------------------------------------------------------------
 // ClawHub
 // ---------------------------------------------------------------------------
@@ -7,19 +7,25 @@ import (
 )
 
 type JWTClaims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID   uint     `json:"user_id"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Perms    []string `json:"perms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID uint, username, role, secret string, expire time.Duration) (string, time.Time, error) {
+// GenerateJWT issues a signed token carrying the user's role, the
+// permissions that role resolved to at login time, and the server-side
+// session ID (jti) used for revocation.
+func GenerateJWT(userID uint, username, role string, perms []string, sessionID, secret string, expire time.Duration) (string, time.Time, error) {
 	expiresAt := time.Now().UTC().Add(expire)
 	claims := JWTClaims{
 		UserID:   userID,
 		Username: username,
 		Role:     role,
+		Perms:    perms,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 			Issuer:    "ClawDeckX",
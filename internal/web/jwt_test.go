@@ -11,7 +11,7 @@ import (
 const testSecret = "test-secret-key-for-unit-tests-32chars"
 
 func TestGenerateJWT(t *testing.T) {
-	token, expiresAt, err := GenerateJWT(1, "admin", "admin", testSecret, 24*time.Hour)
+	token, expiresAt, err := GenerateJWT(1, "admin", "admin", nil, "", testSecret, 24*time.Hour)
 
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
@@ -20,7 +20,7 @@ func TestGenerateJWT(t *testing.T) {
 }
 
 func TestValidateJWT_Valid(t *testing.T) {
-	token, _, err := GenerateJWT(1, "testuser", "user", testSecret, time.Hour)
+	token, _, err := GenerateJWT(1, "testuser", "user", nil, "", testSecret, time.Hour)
 	require.NoError(t, err)
 
 	claims, err := ValidateJWT(token, testSecret)
@@ -33,8 +33,28 @@ func TestValidateJWT_Valid(t *testing.T) {
 	assert.Equal(t, "ClawDeckX", claims.Issuer)
 }
 
+func TestValidateJWT_Permissions(t *testing.T) {
+	token, _, err := GenerateJWT(2, "operator", "operator", []string{"gateway.control"}, "", testSecret, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := ValidateJWT(token, testSecret)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gateway.control"}, claims.Perms)
+}
+
+func TestValidateJWT_SessionID(t *testing.T) {
+	token, _, err := GenerateJWT(1, "testuser", "user", nil, "sess-1", testSecret, time.Hour)
+	require.NoError(t, err)
+
+	claims, err := ValidateJWT(token, testSecret)
+
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", claims.ID)
+}
+
 func TestValidateJWT_InvalidSecret(t *testing.T) {
-	token, _, err := GenerateJWT(1, "testuser", "user", testSecret, time.Hour)
+	token, _, err := GenerateJWT(1, "testuser", "user", nil, "", testSecret, time.Hour)
 	require.NoError(t, err)
 
 	claims, err := ValidateJWT(token, "wrong-secret")
@@ -45,7 +65,7 @@ func TestValidateJWT_InvalidSecret(t *testing.T) {
 
 func TestValidateJWT_Expired(t *testing.T) {
 	// Generate a token that expires immediately
-	token, _, err := GenerateJWT(1, "testuser", "user", testSecret, -time.Hour)
+	token, _, err := GenerateJWT(1, "testuser", "user", nil, "", testSecret, -time.Hour)
 	require.NoError(t, err)
 
 	claims, err := ValidateJWT(token, testSecret)
@@ -93,7 +113,7 @@ func TestGenerateJWT_DifferentExpiry(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			token, expiresAt, err := GenerateJWT(1, "user", "user", testSecret, tt.expiry)
+			token, expiresAt, err := GenerateJWT(1, "user", "user", nil, "", testSecret, tt.expiry)
 
 			assert.NoError(t, err)
 			assert.NotEmpty(t, token)
@@ -10,11 +10,13 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"ClawDeckX/internal/logger"
+	"ClawDeckX/internal/metrics"
 	"ClawDeckX/internal/safego"
 )
 
@@ -34,6 +36,12 @@ func (w *statusWriter) Flush() {
 	}
 }
 
+// Unwrap lets http.ResponseController reach the connection, e.g. to set
+// write deadlines on streams.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
 		return hj.Hijack()
@@ -132,6 +140,28 @@ func RequestLogMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// MetricsMiddleware records request latency into hist, labelled by method,
+// matched route pattern and status class. Unrouted requests use route "other".
+func MetricsMiddleware(hist *metrics.HistogramVec) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			r, route := withRouteHolder(r)
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			pattern := route.pattern
+			if pattern == "" {
+				pattern = "other"
+			}
+			hist.Observe(metrics.L(
+				"method", r.Method,
+				"route", pattern,
+				"status", strconv.Itoa(sw.status/100)+"xx",
+			), time.Since(start).Seconds())
+		})
+	}
+}
+
 func CORSMiddleware(origins []string) func(http.Handler) http.Handler {
 	allowed := make(map[string]bool)
 	for _, o := range origins {
@@ -268,6 +298,64 @@ var authAuditFn AuditFunc
 // SetAuthAuditFunc registers the audit callback used by auth middleware.
 func SetAuthAuditFunc(fn AuditFunc) { authAuditFn = fn }
 
+// APITokenPrefix marks bearer credentials that are personal access tokens rather than JWTs.
+const APITokenPrefix = "cdx_"
+
+// APITokenIdentity is what a valid API token authenticates as.
+type APITokenIdentity struct {
+	TokenID   uint
+	TokenName string
+	UserID    uint
+	Role      string   // owner's role, kept for display only
+	Perms     []string // token scopes intersected with the owner's permissions
+}
+
+// APITokenFunc validates a raw API token presented from ip.
+type APITokenFunc func(token, ip string) (*APITokenIdentity, error)
+
+// apiTokenFn holds the validator set by SetAPITokenFunc; nil disables API tokens.
+var apiTokenFn APITokenFunc
+
+// SetAPITokenFunc registers the validator used by auth middleware for API tokens.
+func SetAPITokenFunc(fn APITokenFunc) { apiTokenFn = fn }
+
+// APITokenUsername is the username recorded for requests made with an API token.
+func APITokenUsername(tokenName string) string { return "token:" + tokenName }
+
+// tokenUseAuditInterval is how often repeated reads of one path with the
+// same API token are audited. Writes are audited every time.
+const tokenUseAuditInterval = time.Minute
+
+// tokenUseThrottle remembers when each token last had a read audited.
+type tokenUseThrottle struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+var tokenUses = &tokenUseThrottle{last: make(map[string]time.Time)}
+
+// record reports whether a use of tokenID should be written to the audit log.
+func (t *tokenUseThrottle) record(tokenID uint, method, path string, now time.Time) bool {
+	if method != http.MethodGet && method != http.MethodHead {
+		return true
+	}
+	key := fmt.Sprintf("%d %s", tokenID, path)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at, ok := t.last[key]; ok && now.Sub(at) < tokenUseAuditInterval {
+		return false
+	}
+	if len(t.last) >= 10000 {
+		for k, at := range t.last {
+			if now.Sub(at) >= tokenUseAuditInterval {
+				delete(t.last, k)
+			}
+		}
+	}
+	t.last[key] = now
+	return true
+}
+
 func AuthMiddleware(jwtSecret string, skipPaths []string) func(http.Handler) http.Handler {
 	skipSet := make(map[string]bool, len(skipPaths))
 	for _, sp := range skipPaths {
@@ -306,6 +394,25 @@ func AuthMiddleware(jwtSecret string, skipPaths []string) func(http.Handler) htt
 				return
 			}
 
+			if strings.HasPrefix(tokenStr, APITokenPrefix) && apiTokenFn != nil {
+				id, err := apiTokenFn(tokenStr, ClientIP(r))
+				if err != nil {
+					if authAuditFn != nil {
+						authAuditFn("auth.failed", "failed", "invalid api token: "+path, r.RemoteAddr, "", 0)
+					}
+					Fail(w, r, ErrUnauthorized.Code, ErrUnauthorized.Message, ErrUnauthorized.HTTPStatus)
+					return
+				}
+				username := APITokenUsername(id.TokenName)
+				if authAuditFn != nil && tokenUses.record(id.TokenID, r.Method, path, time.Now()) {
+					authAuditFn("api_token.use", "success", r.Method+" "+path, r.RemoteAddr, username, id.UserID)
+				}
+				r = SetUserInfo(r, id.UserID, username, id.Role, id.Perms)
+				r = SetAPIToken(r, id.TokenID)
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			claims, err := ValidateJWT(tokenStr, jwtSecret)
 			if err != nil {
 				if authAuditFn != nil {
@@ -315,17 +422,42 @@ func AuthMiddleware(jwtSecret string, skipPaths []string) func(http.Handler) htt
 				return
 			}
 
-			r = SetUserInfo(r, claims.UserID, claims.Username, claims.Role)
+			if err := checkSession(r, claims); err != nil {
+				if authAuditFn != nil {
+					authAuditFn("auth.failed", "failed", "inactive session: "+path, r.RemoteAddr, claims.Username, claims.UserID)
+				}
+				Fail(w, r, ErrTokenExpired.Code, ErrTokenExpired.Message, ErrTokenExpired.HTTPStatus)
+				return
+			}
+
+			r = SetUserInfo(r, claims.UserID, claims.Username, claims.Role, claims.Perms)
+			r = SetSessionID(r, claims.ID)
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+// RequirePermission rejects requests whose user does not hold perm.
+func RequirePermission(perm string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if GetRole(r) != "admin" {
+		if !HasPermission(r, perm) {
 			if authAuditFn != nil {
-				authAuditFn("forbidden", "denied", "admin required: "+r.URL.Path, r.RemoteAddr, GetUsername(r), GetUserID(r))
+				authAuditFn("forbidden", "denied", perm+" required: "+r.URL.Path, r.RemoteAddr, GetUsername(r), GetUserID(r))
+			}
+			Fail(w, r, ErrForbidden.Code, ErrForbidden.Message, ErrForbidden.HTTPStatus)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireSession rejects requests authenticated with an API token, for
+// endpoints that manage credentials and must only be used interactively.
+func RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if GetAPIToken(r) != 0 {
+			if authAuditFn != nil {
+				authAuditFn("forbidden", "denied", "session required: "+r.URL.Path, r.RemoteAddr, GetUsername(r), GetUserID(r))
 			}
 			Fail(w, r, ErrForbidden.Code, ErrForbidden.Message, ErrForbidden.HTTPStatus)
 			return
@@ -335,10 +467,15 @@ func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
 }
 
 // MaxBodySizeMiddleware limits request body size to prevent OOM from oversized payloads.
-func MaxBodySizeMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+// Uploads to streamPaths are streamed by their handlers, which set their own limit.
+func MaxBodySizeMiddleware(maxBytes int64, streamPaths []string) func(http.Handler) http.Handler {
+	streamSet := make(map[string]bool, len(streamPaths))
+	for _, p := range streamPaths {
+		streamSet[p] = true
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Body != nil && r.ContentLength != 0 {
+			if r.Body != nil && r.ContentLength != 0 && !streamSet[r.URL.Path] {
 				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 			}
 			next.ServeHTTP(w, r)
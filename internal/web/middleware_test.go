@@ -1,6 +1,15 @@
 package web
 
-import "testing"
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ClawDeckX/internal/metrics"
+)
 
 func TestContainsDangerousInput(t *testing.T) {
 	tests := []string{
@@ -20,3 +29,124 @@ func TestContainsDangerousInput(t *testing.T) {
 		t.Fatal("expected safe input to pass")
 	}
 }
+
+func TestMetricsMiddlewareLabelsRoutePattern(t *testing.T) {
+	router := NewRouter()
+	router.GET("/api/v1/items/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	hist := metrics.NewHistogramVec("latency", "test", []float64{1})
+	h := Chain(router, MetricsMiddleware(hist))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/items/42", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+
+	var buf bytes.Buffer
+	w := metrics.NewWriter(&buf)
+	hist.WriteTo(w)
+	_ = w.Flush()
+	out := buf.String()
+	if !strings.Contains(out, `latency_count{method="GET",route="/api/v1/items/",status="4xx"} 1`) {
+		t.Fatalf("expected route pattern label, got:\n%s", out)
+	}
+	if !strings.Contains(out, `route="other"`) {
+		t.Fatalf("expected unrouted request to be labelled other, got:\n%s", out)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	h := RequirePermission("gateway.control", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	cases := []struct {
+		role  string
+		perms []string
+		want  int
+	}{
+		{"admin", nil, http.StatusNoContent},
+		{"operator", []string{"gateway.control"}, http.StatusNoContent},
+		{"operator", []string{"config.write"}, http.StatusForbidden},
+		{"readonly", nil, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := SetUserInfo(httptest.NewRequest(http.MethodPost, "/api/v1/gateway/restart", nil), 1, "u", c.role, c.perms)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != c.want {
+			t.Fatalf("role %s perms %v: got %d, want %d", c.role, c.perms, rec.Code, c.want)
+		}
+	}
+}
+
+func TestTokenUseThrottle(t *testing.T) {
+	th := &tokenUseThrottle{last: make(map[string]time.Time)}
+	now := time.Now()
+	if !th.record(1, http.MethodGet, "/api/v1/config", now) {
+		t.Fatal("the first read must be audited")
+	}
+	if th.record(1, http.MethodGet, "/api/v1/config", now.Add(time.Second)) {
+		t.Fatal("a repeated read within the interval is throttled")
+	}
+	if !th.record(1, http.MethodGet, "/api/v1/snapshots", now.Add(time.Second)) {
+		t.Fatal("reads of another path are audited")
+	}
+	if !th.record(2, http.MethodGet, "/api/v1/config", now.Add(time.Second)) {
+		t.Fatal("reads with another token are audited")
+	}
+	if !th.record(1, http.MethodGet, "/api/v1/config", now.Add(tokenUseAuditInterval)) {
+		t.Fatal("reads are audited again after the interval")
+	}
+	for i := 0; i < 2; i++ {
+		if !th.record(1, http.MethodPost, "/api/v1/gateway/restart", now) {
+			t.Fatal("every write is audited")
+		}
+	}
+}
+
+func TestAuthMiddlewareAPIToken(t *testing.T) {
+	SetAPITokenFunc(func(token, ip string) (*APITokenIdentity, error) {
+		if token != "cdx_good" {
+			return nil, ErrUnauthorized
+		}
+		return &APITokenIdentity{TokenID: 7, TokenName: "ci", UserID: 1, Role: "admin"}, nil
+	})
+	defer SetAPITokenFunc(nil)
+	var audited []string
+	SetAuthAuditFunc(func(action, result, detail, ip, username string, userID uint) {
+		if action == "api_token.use" {
+			audited = append(audited, detail)
+		}
+	})
+	defer SetAuthAuditFunc(nil)
+
+	var gotUser string
+	var allowed bool
+	h := AuthMiddleware(testSecret, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser = GetUsername(r)
+		allowed = HasPermission(r, "config.write")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil)
+	req.Header.Set("Authorization", "Bearer cdx_good")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || gotUser != "token:ci" {
+		t.Fatalf("expected token auth to pass as token:ci, got %d %q", rec.Code, gotUser)
+	}
+	if allowed {
+		t.Fatal("an admin-owned token must still be limited to its scopes")
+	}
+
+	if len(audited) != 1 || audited[0] != "GET /api/v1/dashboard" {
+		t.Fatalf("expected the token read to be audited, got %v", audited)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/dashboard", nil)
+	req.Header.Set("Authorization", "Bearer cdx_bad")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown token, got %d", rec.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"fmt"
 	"net/http"
 )
 
@@ -26,12 +27,21 @@ func NewRouter() *Router {
 	}
 }
 
+// Handle registers handler for method and path. Registering the same method
+// and path twice panics, like http.ServeMux does for duplicate patterns,
+// rather than letting the later handler silently replace the earlier one.
 func (rt *Router) Handle(method, path string, handler http.HandlerFunc) {
+	if _, dup := rt.pathMethods[path][method]; dup {
+		panic(fmt.Sprintf("web: duplicate route %s %s", method, path))
+	}
 	rt.routes = append(rt.routes, Route{Method: method, Path: path, Handler: handler})
 
 	// wildcard method: register directly
 	if method == "*" {
-		rt.mux.HandleFunc(path, handler)
+		rt.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			setRoutePattern(r, path)
+			handler(w, r)
+		})
 		return
 	}
 
@@ -46,6 +56,7 @@ func (rt *Router) Handle(method, path string, handler http.HandlerFunc) {
 				return
 			}
 			if h, ok := rt.pathMethods[path][r.Method]; ok {
+				setRoutePattern(r, path)
 				h(w, r)
 				return
 			}
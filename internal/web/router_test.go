@@ -0,0 +1,41 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterDispatchesByMethod(t *testing.T) {
+	rt := NewRouter()
+	rt.GET("/api/v1/events", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	rt.POST("/api/v1/events", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusCreated) })
+	rt.GET("/api/v1/events/stream", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusAccepted) })
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/events", http.StatusOK},
+		{http.MethodPost, "/api/v1/events", http.StatusCreated},
+		{http.MethodGet, "/api/v1/events/stream", http.StatusAccepted},
+		{http.MethodDelete, "/api/v1/events", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.want, w.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestRouterRejectsDuplicateRoute(t *testing.T) {
+	rt := NewRouter()
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	rt.GET("/api/v1/events", h)
+	rt.POST("/api/v1/events", h)
+
+	assert.PanicsWithValue(t, "web: duplicate route GET /api/v1/events", func() {
+		rt.GET("/api/v1/events", h)
+	})
+}
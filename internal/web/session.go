@@ -0,0 +1,44 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrSessionInvalid is returned by a SessionFunc for revoked, expired, idle or unknown sessions.
+var ErrSessionInvalid = errors.New("session revoked or expired")
+
+// SessionFunc checks that the server-side session behind a JWT is still
+// active and records activity from ip.
+type SessionFunc func(sessionID string, userID uint, ip string) error
+
+// sessionFn holds the validator set by SetSessionFunc; nil trusts the JWT alone.
+var sessionFn SessionFunc
+
+// SetSessionFunc registers the session validator used by AuthMiddleware and WSHub.
+func SetSessionFunc(fn SessionFunc) { sessionFn = fn }
+
+// sessionRevokedFn is notified of revoked session IDs, e.g. to drop WebSockets.
+var sessionRevokedFn func(sessionIDs []string)
+
+// SetSessionRevokedFunc registers the listener for NotifySessionsRevoked.
+func SetSessionRevokedFunc(fn func(sessionIDs []string)) { sessionRevokedFn = fn }
+
+// NotifySessionsRevoked tells the registered listener that sessions ended.
+func NotifySessionsRevoked(sessionIDs []string) {
+	if sessionRevokedFn != nil && len(sessionIDs) > 0 {
+		sessionRevokedFn(sessionIDs)
+	}
+}
+
+// checkSession validates the session carried in claims. Tokens without a
+// session ID predate session tracking and are refused once it is enabled.
+func checkSession(r *http.Request, claims *JWTClaims) error {
+	if sessionFn == nil {
+		return nil
+	}
+	if claims.ID == "" {
+		return ErrSessionInvalid
+	}
+	return sessionFn(claims.ID, claims.UserID, ClientIP(r))
+}
@@ -3,6 +3,9 @@
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,27 +38,59 @@ func newUpgrader(allowedOrigins []string) websocket.Upgrader {
 	}
 }
 
+const (
+	// GlobalChannel is the channel of messages broadcast to every client.
+	GlobalChannel = "*"
+	// ReplaySize is the number of messages kept per channel for resuming clients.
+	ReplaySize = 512
+	// clientQueueSize bounds a client's send queue. A client that falls
+	// further behind is disconnected and resumes from its cursor.
+	clientQueueSize = 1024
+)
+
+const (
+	transportWS  = "ws"
+	transportSSE = "sse"
+)
+
 type WSClient struct {
-	hub      *WSHub
-	conn     *websocket.Conn
-	send     chan []byte
+	hub       *WSHub
+	conn      *websocket.Conn // nil for SSE clients
+	kick      func()          // drops the connection
+	send      chan wsOut
+	sessionID string
+
+	// Guarded by hub.mu.
 	channels map[string]bool
-	mu       sync.RWMutex
+	since    map[string]uint64 // channel sequence when the channel went live
+
+	mu     sync.Mutex
+	stats  ClientStats
+	cursor map[string]uint64 // last sequence written per channel
 }
 
 type WSHub struct {
 	clients        map[*WSClient]bool
 	broadcast      chan WSMessage
-	register       chan *WSClient
-	unregister     chan *WSClient
 	mu             sync.RWMutex
 	allowedOrigins []string
+
+	// Guarded by mu.
+	epoch      string
+	seq        map[string]uint64
+	replay     map[string]*replayRing
+	replaySize int
+	nextID     uint64
+	evicted    uint64
 }
 
+// WSMessage is a broadcast message. Seq numbers the messages of a channel
+// from 1; messages of the empty channel go to every client as GlobalChannel.
 type WSMessage struct {
 	Type    string      `json:"type"`
 	Data    interface{} `json:"data"`
-	Channel string      `json:"-"`
+	Channel string      `json:"channel,omitempty"`
+	Seq     uint64      `json:"seq,omitempty"`
 }
 
 func NewWSHub(allowedOrigins ...[]string) *WSHub {
@@ -66,76 +101,204 @@ func NewWSHub(allowedOrigins ...[]string) *WSHub {
 	return &WSHub{
 		clients:        make(map[*WSClient]bool),
 		broadcast:      make(chan WSMessage, 256),
-		register:       make(chan *WSClient),
-		unregister:     make(chan *WSClient),
 		allowedOrigins: origins,
+		epoch:          strconv.FormatInt(time.Now().UnixNano(), 36),
+		seq:            make(map[string]uint64),
+		replay:         make(map[string]*replayRing),
+		replaySize:     ReplaySize,
 	}
 }
 
 func (h *WSHub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			logger.WS.Debug().Int("clients", len(h.clients)).Msg("client connected")
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
-			h.mu.Unlock()
-			logger.WS.Debug().Int("clients", len(h.clients)).Msg("client disconnected")
+	for msg := range h.broadcast {
+		h.publish(msg)
+	}
+}
 
-		case msg := <-h.broadcast:
-			data, err := json.Marshal(msg)
-			if err != nil {
-				continue
-			}
-			// Collect stale clients under RLock, then clean up under Lock
-			var stale []*WSClient
-			h.mu.RLock()
-			for client := range h.clients {
-				client.mu.RLock()
-				subscribed := msg.Channel == "" || client.channels[msg.Channel]
-				client.mu.RUnlock()
-				if subscribed {
-					select {
-					case client.send <- data:
-					default:
-						stale = append(stale, client)
-					}
-				}
-			}
-			h.mu.RUnlock()
-			// Remove stale clients outside the read lock
-			if len(stale) > 0 {
-				h.mu.Lock()
-				for _, c := range stale {
-					if _, ok := h.clients[c]; ok {
-						delete(h.clients, c)
-						close(c.send)
-					}
-				}
-				h.mu.Unlock()
+func (h *WSHub) Broadcast(channel string, msgType string, data interface{}) {
+	h.broadcast <- WSMessage{Type: msgType, Data: data, Channel: channel}
+}
+
+// publish numbers msg, keeps it for replay and queues it to the subscribed
+// clients. Clients whose queue is full are disconnected.
+func (h *WSHub) publish(msg WSMessage) {
+	if msg.Channel == "" {
+		msg.Channel = GlobalChannel
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	msg.Seq = h.seq[msg.Channel] + 1
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	h.seq[msg.Channel] = msg.Seq
+	out := wsOut{channel: msg.Channel, seq: msg.Seq, data: data}
+	ring := h.replay[msg.Channel]
+	if ring == nil {
+		ring = &replayRing{}
+		h.replay[msg.Channel] = ring
+	}
+	ring.push(out, h.replaySize)
+	for client := range h.clients {
+		if msg.Channel == GlobalChannel || client.channels[msg.Channel] {
+			if !client.enqueue(out) {
+				h.evictLocked(client)
 			}
 		}
 	}
 }
 
-func (h *WSHub) Broadcast(channel string, msgType string, data interface{}) {
-	h.broadcast <- WSMessage{Type: msgType, Data: data, Channel: channel}
+func (h *WSHub) newClient(transport, sessionID, username, ip string) *WSClient {
+	h.mu.Lock()
+	h.nextID++
+	id := h.nextID
+	h.mu.Unlock()
+	return &WSClient{
+		hub:       h,
+		send:      make(chan wsOut, clientQueueSize),
+		sessionID: sessionID,
+		channels:  make(map[string]bool),
+		since:     make(map[string]uint64),
+		cursor:    make(map[string]uint64),
+		stats: ClientStats{
+			ID:          id,
+			Transport:   transport,
+			Username:    username,
+			IP:          ip,
+			ConnectedAt: time.Now().UTC(),
+			QueueSize:   clientQueueSize,
+		},
+	}
+}
+
+// add registers c, sends it the hello message and subscribes it to channels,
+// resuming them from cur.
+func (h *WSHub) add(c *WSClient, channels []string, cur Cursor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = true
+	c.since[GlobalChannel] = h.seq[GlobalChannel]
+	c.setCursor(GlobalChannel, h.seq[GlobalChannel])
+	for _, ch := range channels {
+		if ch != "" && ch != GlobalChannel {
+			c.channels[ch] = true
+			c.since[ch] = h.seq[ch]
+			c.setCursor(ch, h.seq[ch])
+		}
+	}
+	hello, _ := json.Marshal(WSMessage{Type: MsgHello, Data: WSHello{
+		Epoch:      h.epoch,
+		Seq:        copySeq(c.since),
+		ReplaySize: h.replaySize,
+	}})
+	c.enqueue(wsOut{data: hello})
+	h.resumeLocked(c, cur)
+	logger.WS.Debug().Int("clients", len(h.clients)).Str("transport", c.stats.Transport).Msg("client connected")
 }
 
+func (h *WSHub) remove(c *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	logger.WS.Debug().Int("clients", len(h.clients)).Msg("client disconnected")
+}
+
+func (h *WSHub) evictLocked(c *WSClient) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	close(c.send)
+	h.evicted++
+	logger.WS.Warn().Uint64("client", c.stats.ID).Str("user", c.stats.Username).
+		Msg("client send queue full, disconnecting")
+}
+
+// subscribe adds channels to c and resumes the channels of cur.
+func (h *WSHub) subscribe(c *WSClient, channels []string, cur Cursor) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.clients[c] {
+		return
+	}
+	for _, ch := range channels {
+		if ch == "" || ch == GlobalChannel || c.channels[ch] {
+			continue
+		}
+		c.channels[ch] = true
+		c.since[ch] = h.seq[ch]
+		c.setCursor(ch, h.seq[ch])
+	}
+	h.resumeLocked(c, cur)
+}
+
+func (h *WSHub) unsubscribe(c *WSClient, channel string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if channel == GlobalChannel {
+		return
+	}
+	delete(c.channels, channel)
+	delete(c.since, channel)
+	c.mu.Lock()
+	delete(c.cursor, channel)
+	c.mu.Unlock()
+}
+
+// CloseSessions disconnects clients authenticated by any of the given
+// sessions; their pumps unregister them as the connection drops.
+func (h *WSHub) CloseSessions(sessionIDs []string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.sessionID != "" && revoked[client.sessionID] {
+			client.kick()
+		}
+	}
+}
+
+// ClientCount returns the connected WebSocket and SSE clients.
 func (h *WSHub) ClientCount() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	return len(h.clients)
 }
 
+// Stats reports the sequence of every channel and the backpressure of every
+// client.
+func (h *WSHub) Stats() HubStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	st := HubStats{
+		Epoch:      h.epoch,
+		Seq:        copySeq(h.seq),
+		ReplaySize: h.replaySize,
+		Evicted:    h.evicted,
+		Clients:    make([]ClientStats, 0, len(h.clients)),
+	}
+	for c := range h.clients {
+		st.Clients = append(st.Clients, c.snapshot())
+	}
+	sort.Slice(st.Clients, func(i, j int) bool { return st.Clients[i].ID < st.Clients[j].ID })
+	return st
+}
+
+// HandleStats serves Stats.
+func (h *WSHub) HandleStats(w http.ResponseWriter, r *http.Request) {
+	OK(w, r, h.Stats())
+}
+
+// HandleWS upgrades to a WebSocket streaming the broadcasts of the channels
+// the client subscribes to. The channels and last_seq query parameters
+// subscribe and resume on connect, like the SSE endpoint.
 func (h *WSHub) HandleWS(jwtSecret string) http.HandlerFunc {
 	wsUpgrader := newUpgrader(h.allowedOrigins)
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -150,10 +313,20 @@ func (h *WSHub) HandleWS(jwtSecret string) http.HandlerFunc {
 			Fail(w, r, ErrUnauthorized.Code, ErrUnauthorized.Message, ErrUnauthorized.HTTPStatus)
 			return
 		}
-		if _, err := ValidateJWT(tokenStr, jwtSecret); err != nil {
+		claims, err := ValidateJWT(tokenStr, jwtSecret)
+		if err != nil {
 			Fail(w, r, ErrTokenExpired.Code, ErrTokenExpired.Message, ErrTokenExpired.HTTPStatus)
 			return
 		}
+		if err := checkSession(r, claims); err != nil {
+			Fail(w, r, ErrTokenExpired.Code, ErrTokenExpired.Message, ErrTokenExpired.HTTPStatus)
+			return
+		}
+		cur, err := ParseCursor(r.URL.Query().Get("last_seq"))
+		if err != nil {
+			FailErr(w, r, ErrInvalidParam, err.Error())
+			return
+		}
 
 		conn, err := wsUpgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -161,22 +334,29 @@ func (h *WSHub) HandleWS(jwtSecret string) http.HandlerFunc {
 			return
 		}
 
-		client := &WSClient{
-			hub:      h,
-			conn:     conn,
-			send:     make(chan []byte, 256),
-			channels: make(map[string]bool),
-		}
-		h.register <- client
+		client := h.newClient(transportWS, claims.ID, claims.Username, ClientIP(r))
+		client.conn = conn
+		client.kick = func() { conn.Close() }
+		h.add(client, splitChannels(r.URL.Query().Get("channels")), cur)
 
 		go client.writePump()
 		go client.readPump()
 	}
 }
 
+func splitChannels(s string) []string {
+	var channels []string
+	for _, ch := range strings.Split(s, ",") {
+		if ch = strings.TrimSpace(ch); ch != "" {
+			channels = append(channels, ch)
+		}
+	}
+	return channels
+}
+
 func (c *WSClient) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.remove(c)
 		c.conn.Close()
 	}()
 	c.conn.SetReadDeadline(time.Now().Add(90 * time.Second))
@@ -190,34 +370,23 @@ func (c *WSClient) readPump() {
 			break
 		}
 		var msg struct {
-			Action   string   `json:"action"`
-			Channel  string   `json:"channel"`
-			Channels []string `json:"channels"`
+			Action   string            `json:"action"`
+			Channel  string            `json:"channel"`
+			Channels []string          `json:"channels"`
+			Epoch    string            `json:"epoch"`
+			LastSeq  map[string]uint64 `json:"last_seq"`
 		}
 		if err := json.Unmarshal(message, &msg); err != nil {
 			continue
 		}
 		switch msg.Action {
 		case "subscribe":
-			c.mu.Lock()
-			for _, ch := range msg.Channels {
-				c.channels[ch] = true
-			}
-			c.mu.Unlock()
-		case "unsubscribe":
-			c.mu.Lock()
-			delete(c.channels, msg.Channel)
-			c.mu.Unlock()
-		case "pause":
-			c.mu.Lock()
-			delete(c.channels, msg.Channel)
-			c.mu.Unlock()
+			c.hub.subscribe(c, msg.Channels, Cursor{Epoch: msg.Epoch, Seq: msg.LastSeq})
+		case "unsubscribe", "pause":
+			c.hub.unsubscribe(c, msg.Channel)
 		case "ping":
 			resp, _ := json.Marshal(map[string]string{"action": "pong"})
-			select {
-			case c.send <- resp:
-			default:
-			}
+			c.hub.reply(c, resp)
 		}
 	}
 }
@@ -230,15 +399,16 @@ func (c *WSClient) writePump() {
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
+		case out, ok := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, out.data); err != nil {
 				return
 			}
+			c.sent(out)
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -0,0 +1,210 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testMsg struct {
+	Type    string          `json:"type"`
+	Channel string          `json:"channel"`
+	Seq     uint64          `json:"seq"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// queued drains the messages queued to c.
+func queued(t *testing.T, c *WSClient) []testMsg {
+	t.Helper()
+	var msgs []testMsg
+	for {
+		select {
+		case out, ok := <-c.send:
+			if !ok {
+				return msgs
+			}
+			c.sent(out)
+			var m testMsg
+			require.NoError(t, json.Unmarshal(out.data, &m))
+			msgs = append(msgs, m)
+		default:
+			return msgs
+		}
+	}
+}
+
+func seqs(msgs []testMsg) []string {
+	var s []string
+	for _, m := range msgs {
+		s = append(s, fmt.Sprintf("%s@%s:%d", m.Type, m.Channel, m.Seq))
+	}
+	return s
+}
+
+func TestCursor(t *testing.T) {
+	cur := Cursor{Epoch: "k2x", Seq: map[string]uint64{"activity": 12, GlobalChannel: 3}}
+	assert.Equal(t, "k2x;*:3,activity:12", cur.String())
+	got, err := ParseCursor(cur.String())
+	require.NoError(t, err)
+	assert.Equal(t, cur, got)
+
+	got, err = ParseCursor("")
+	require.NoError(t, err)
+	assert.Empty(t, got.Epoch)
+	for _, bad := range []string{"k2x", ";activity:1", "k2x;activity", "k2x;activity:x"} {
+		_, err := ParseCursor(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestWSHubResume(t *testing.T) {
+	h := NewWSHub()
+	for i := 0; i < 3; i++ {
+		h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	}
+	h.publish(WSMessage{Type: "badge_update"})
+
+	c := h.newClient(transportWS, "", "admin", "127.0.0.1")
+	h.add(c, []string{"activity"}, Cursor{Epoch: h.epoch, Seq: map[string]uint64{"activity": 1, GlobalChannel: 0}})
+	msgs := queued(t, c)
+	require.Len(t, msgs, 4)
+	var hello WSHello
+	require.NoError(t, json.Unmarshal(msgs[0].Data, &hello))
+	assert.Equal(t, MsgHello, msgs[0].Type)
+	assert.Equal(t, map[string]uint64{"activity": 3, GlobalChannel: 1}, hello.Seq)
+	assert.Equal(t, []string{"badge_update@*:1", "activity@activity:2", "activity@activity:3"}, seqs(msgs[1:]))
+
+	// Live messages continue the sequence; other channels are not sent.
+	h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	h.publish(WSMessage{Channel: "alert", Type: "alert"})
+	assert.Equal(t, []string{"activity@activity:4"}, seqs(queued(t, c)))
+	assert.Equal(t, map[string]uint64{"activity": 4, GlobalChannel: 1}, c.Cursor().Seq)
+
+	st := h.Stats()
+	require.Len(t, st.Clients, 1)
+	assert.EqualValues(t, 3, st.Clients[0].Replayed)
+	assert.EqualValues(t, 5, st.Clients[0].Sent)
+	assert.Zero(t, st.Clients[0].Lag)
+	assert.Equal(t, []string{"activity"}, st.Clients[0].Channels)
+}
+
+func TestWSHubResync(t *testing.T) {
+	h := NewWSHub()
+	h.replaySize = 2
+	for i := 0; i < 5; i++ {
+		h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	}
+
+	// Messages 2 and 3 fell out of the replay buffer.
+	c := h.newClient(transportWS, "", "", "")
+	h.add(c, []string{"activity"}, Cursor{Epoch: h.epoch, Seq: map[string]uint64{"activity": 1}})
+	msgs := queued(t, c)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, MsgResync, msgs[1].Type)
+	var rs WSResync
+	require.NoError(t, json.Unmarshal(msgs[1].Data, &rs))
+	assert.Equal(t, WSResync{Reason: ResyncGap, LastSeq: 1, Oldest: 4, Seq: 5}, rs)
+	assert.EqualValues(t, 5, c.Cursor().Seq["activity"])
+
+	// A cursor from before a restart cannot be resumed at all.
+	c = h.newClient(transportSSE, "", "", "")
+	h.add(c, []string{"activity"}, Cursor{Epoch: "old", Seq: map[string]uint64{"activity": 4}})
+	msgs = queued(t, c)
+	require.Len(t, msgs, 2)
+	require.NoError(t, json.Unmarshal(msgs[1].Data, &rs))
+	assert.Equal(t, ResyncRestart, rs.Reason)
+	assert.EqualValues(t, 1, h.Stats().Clients[1].Resyncs)
+}
+
+func TestWSHubEvictsSlowClient(t *testing.T) {
+	h := NewWSHub()
+	c := h.newClient(transportWS, "", "", "")
+	h.add(c, []string{"gw_event"}, Cursor{})
+	for i := 0; i < clientQueueSize; i++ {
+		h.publish(WSMessage{Channel: "gw_event", Type: "chat"})
+	}
+	assert.Equal(t, 0, h.ClientCount())
+	assert.EqualValues(t, 1, h.Stats().Evicted)
+	msgs := queued(t, c)
+	require.Len(t, msgs, clientQueueSize, "queued messages are still written before the close")
+
+	// The client comes back and picks up where its queue ended.
+	last := msgs[len(msgs)-1].Seq
+	c = h.newClient(transportWS, "", "", "")
+	h.add(c, []string{"gw_event"}, Cursor{Epoch: h.epoch, Seq: map[string]uint64{"gw_event": last}})
+	assert.Equal(t, []string{fmt.Sprintf("chat@gw_event:%d", last+1)}, seqs(queued(t, c)[1:]))
+}
+
+// readEvent returns the next SSE event carrying data.
+func readEvent(t *testing.T, br *bufio.Reader) (id string, msg testMsg) {
+	t.Helper()
+	var data string
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && data != "":
+			require.NoError(t, json.Unmarshal([]byte(data), &msg))
+			return id, msg
+		}
+	}
+}
+
+func TestHandleSSE(t *testing.T) {
+	h := NewWSHub()
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleSSE))
+	defer srv.Close()
+
+	connect := func(lastEventID string) (*bufio.Reader, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?channels=activity", nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body), cancel
+	}
+
+	br, cancel := connect("")
+	_, msg := readEvent(t, br)
+	require.Equal(t, MsgHello, msg.Type)
+	h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	id, msg := readEvent(t, br)
+	assert.EqualValues(t, 1, msg.Seq)
+	assert.Equal(t, h.epoch+";*:0,activity:1", id)
+	cancel()
+
+	// Missed while disconnected, replayed on reconnect.
+	h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	h.publish(WSMessage{Channel: "activity", Type: "activity"})
+	br, cancel = connect(id)
+	defer cancel()
+	_, msg = readEvent(t, br)
+	require.Equal(t, MsgHello, msg.Type)
+	for _, want := range []uint64{2, 3} {
+		id, msg = readEvent(t, br)
+		assert.Equal(t, want, msg.Seq)
+	}
+	assert.Equal(t, h.epoch+";*:0,activity:3", id)
+
+	resp, err := http.Get(srv.URL + "?last_seq=bogus")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,384 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message types the hub sends on its own.
+const (
+	// MsgHello is the first message of a connection, carrying a WSHello.
+	MsgHello = "hello"
+	// MsgResync tells the client that messages of a channel are lost and its
+	// state has to be reloaded; it carries a WSResync.
+	MsgResync = "resync"
+)
+
+// Resync reasons.
+const (
+	ResyncRestart = "restart" // the cursor is from before a server restart
+	ResyncGap     = "gap"     // the missed messages are no longer buffered
+)
+
+// WSHello tells a client where its channels start.
+type WSHello struct {
+	Epoch      string            `json:"epoch"`
+	Seq        map[string]uint64 `json:"seq"` // current sequence of each subscribed channel
+	ReplaySize int               `json:"replay_size"`
+}
+
+// WSResync reports the messages a client cannot be sent. The live messages of
+// the channel continue after Seq.
+type WSResync struct {
+	Reason  string `json:"reason"`
+	LastSeq uint64 `json:"last_seq"`
+	Oldest  uint64 `json:"oldest,omitempty"` // oldest buffered sequence
+	Seq     uint64 `json:"seq"`
+}
+
+// ClientStats reports a client's backpressure.
+type ClientStats struct {
+	ID          uint64            `json:"id"`
+	Transport   string            `json:"transport"` // "ws" or "sse"
+	Username    string            `json:"username,omitempty"`
+	IP          string            `json:"ip"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	Channels    []string          `json:"channels"`
+	Queued      int               `json:"queued"`     // messages waiting to be written
+	QueueSize   int               `json:"queue_size"` // queued messages at which the client is dropped
+	MaxQueued   int               `json:"max_queued"` // high-water mark of queued
+	Lag         uint64            `json:"lag"`        // messages published but not yet written
+	Sent        uint64            `json:"sent"`
+	SentBytes   uint64            `json:"sent_bytes"`
+	Replayed    uint64            `json:"replayed"`
+	Resyncs     uint64            `json:"resyncs"`
+	LastSeq     map[string]uint64 `json:"last_seq"`
+	LastSentAt  *time.Time        `json:"last_sent_at,omitempty"`
+}
+
+// HubStats reports the hub's channels and clients.
+type HubStats struct {
+	Epoch      string            `json:"epoch"`
+	Seq        map[string]uint64 `json:"seq"`
+	ReplaySize int               `json:"replay_size"`
+	Evicted    uint64            `json:"evicted"` // clients dropped for a full queue
+	Clients    []ClientStats     `json:"clients"`
+}
+
+// Cursor is a client's position in the event stream: the hub epoch, which
+// changes on every server start, and the last sequence seen per channel.
+type Cursor struct {
+	Epoch string
+	Seq   map[string]uint64
+}
+
+// String encodes the cursor as "epoch;channel:seq,...", the format of the
+// last_seq parameter and of SSE event IDs.
+func (c Cursor) String() string {
+	channels := make([]string, 0, len(c.Seq))
+	for ch := range c.Seq {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	var b strings.Builder
+	b.WriteString(c.Epoch)
+	b.WriteByte(';')
+	for i, ch := range channels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(ch)
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(c.Seq[ch], 10))
+	}
+	return b.String()
+}
+
+// ParseCursor decodes Cursor.String; "" is the cursor of a new client.
+func ParseCursor(s string) (Cursor, error) {
+	var cur Cursor
+	if s == "" {
+		return cur, nil
+	}
+	epoch, rest, ok := strings.Cut(s, ";")
+	if !ok || epoch == "" {
+		return cur, fmt.Errorf("invalid cursor %q", s)
+	}
+	cur.Epoch = epoch
+	cur.Seq = make(map[string]uint64)
+	if rest == "" {
+		return cur, nil
+	}
+	for _, part := range strings.Split(rest, ",") {
+		ch, n, ok := strings.Cut(part, ":")
+		seq, err := strconv.ParseUint(n, 10, 64)
+		if !ok || ch == "" || err != nil {
+			return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+		}
+		cur.Seq[ch] = seq
+	}
+	return cur, nil
+}
+
+// wsOut is a message queued to a client. Seq is 0 for messages outside the
+// channel sequences (hello, pong).
+type wsOut struct {
+	channel string
+	seq     uint64
+	data    []byte
+}
+
+// replayRing keeps the last messages of a channel, whose sequences are
+// consecutive.
+type replayRing struct {
+	msgs []wsOut
+	next int // index of the oldest message once the ring is full
+}
+
+func (r *replayRing) push(m wsOut, size int) {
+	if len(r.msgs) < size {
+		r.msgs = append(r.msgs, m)
+		return
+	}
+	r.msgs[r.next] = m
+	r.next = (r.next + 1) % len(r.msgs)
+}
+
+func (r *replayRing) oldest() uint64 {
+	if len(r.msgs) == 0 {
+		return 0
+	}
+	return r.msgs[r.next].seq
+}
+
+// after returns the messages following last, oldest first; last must not
+// be before oldest()-1.
+func (r *replayRing) after(last uint64) []wsOut {
+	n := len(r.msgs)
+	skip := int(last + 1 - r.oldest())
+	if n == 0 || skip >= n {
+		return nil
+	}
+	out := make([]wsOut, 0, n-skip)
+	for i := skip; i < n; i++ {
+		out = append(out, r.msgs[(r.next+i)%n])
+	}
+	return out
+}
+
+func copySeq(m map[string]uint64) map[string]uint64 {
+	cp := make(map[string]uint64, len(m))
+	for k, v := range m {
+		cp[k] = v
+	}
+	return cp
+}
+
+// resumeLocked brings the channels of cur up to date for c: it queues the
+// messages c missed before they went live, or a resync message when those
+// are gone. Called with h.mu held.
+func (h *WSHub) resumeLocked(c *WSClient, cur Cursor) {
+	channels := make([]string, 0, len(cur.Seq))
+	for ch := range cur.Seq {
+		if _, ok := c.since[ch]; ok {
+			channels = append(channels, ch)
+		}
+	}
+	sort.Strings(channels)
+	for _, ch := range channels {
+		last, live := cur.Seq[ch], c.since[ch]
+		ring := h.replay[ch]
+		switch {
+		case cur.Epoch != h.epoch:
+			if !h.resyncLocked(c, ch, ResyncRestart, last, live) {
+				return
+			}
+		case last >= live:
+			// nothing missed
+		case ring == nil || last+1 < ring.oldest() || live-last > uint64(cap(c.send)-len(c.send)):
+			if !h.resyncLocked(c, ch, ResyncGap, last, live) {
+				return
+			}
+		default:
+			c.setCursor(ch, last)
+			var n uint64
+			for _, out := range ring.after(last) {
+				if out.seq > live {
+					break
+				}
+				if !c.enqueue(out) {
+					h.evictLocked(c)
+					return
+				}
+				n++
+			}
+			c.mu.Lock()
+			c.stats.Replayed += n
+			c.mu.Unlock()
+		}
+	}
+}
+
+func (h *WSHub) resyncLocked(c *WSClient, ch, reason string, last, live uint64) bool {
+	msg := WSResync{Reason: reason, LastSeq: last, Seq: live}
+	if ring := h.replay[ch]; ring != nil && reason == ResyncGap {
+		msg.Oldest = ring.oldest()
+	}
+	data, _ := json.Marshal(WSMessage{Type: MsgResync, Channel: ch, Data: msg})
+	c.mu.Lock()
+	c.stats.Resyncs++
+	c.mu.Unlock()
+	if !c.enqueue(wsOut{channel: ch, seq: live, data: data}) {
+		h.evictLocked(c)
+		return false
+	}
+	return true
+}
+
+// reply queues an unsequenced message to c unless it has been removed.
+func (h *WSHub) reply(c *WSClient, data []byte) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.clients[c] {
+		c.enqueue(wsOut{data: data})
+	}
+}
+
+// enqueue queues out without blocking; false means the queue is full.
+func (c *WSClient) enqueue(out wsOut) bool {
+	select {
+	case c.send <- out:
+	default:
+		return false
+	}
+	c.mu.Lock()
+	if n := len(c.send); n > c.stats.MaxQueued {
+		c.stats.MaxQueued = n
+	}
+	c.mu.Unlock()
+	return true
+}
+
+// sent records a message written to the connection.
+func (c *WSClient) sent(out wsOut) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now().UTC()
+	c.stats.Sent++
+	c.stats.SentBytes += uint64(len(out.data))
+	c.stats.LastSentAt = &now
+	if out.seq > 0 {
+		c.cursor[out.channel] = out.seq
+	}
+}
+
+func (c *WSClient) setCursor(channel string, seq uint64) {
+	c.mu.Lock()
+	c.cursor[channel] = seq
+	c.mu.Unlock()
+}
+
+// Cursor returns the position of the messages written to c.
+func (c *WSClient) Cursor() Cursor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Cursor{Epoch: c.hub.epoch, Seq: copySeq(c.cursor)}
+}
+
+// snapshot returns c's stats. Called with h.mu held.
+func (c *WSClient) snapshot() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Queued = len(c.send)
+	st.LastSeq = copySeq(c.cursor)
+	st.Channels = make([]string, 0, len(c.channels))
+	for ch := range c.channels {
+		st.Channels = append(st.Channels, ch)
+	}
+	sort.Strings(st.Channels)
+	for ch, seq := range c.cursor {
+		if cur := c.hub.seq[ch]; cur > seq {
+			st.Lag += cur - seq
+		}
+	}
+	return st
+}
+
+// HandleSSE streams the broadcasts of the channels query parameter as
+// server-sent events, for clients that cannot use WebSockets; it runs behind
+// AuthMiddleware. Events carry the same JSON as WebSocket messages, and the
+// client's cursor as their ID, so a reconnecting EventSource resumes through
+// Last-Event-ID. Other clients resume with the last_seq parameter.
+func (h *WSHub) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_seq")
+	}
+	cur, err := ParseCursor(last)
+	if err != nil {
+		FailErr(w, r, ErrInvalidParam, err.Error())
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.WriteString(w, "retry: 3000\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	c := h.newClient(transportSSE, GetSessionID(r), GetUsername(r), ClientIP(r))
+	c.kick = cancel
+	h.add(c, splitChannels(r.URL.Query().Get("channels")), cur)
+	defer h.remove(c)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case out, ok := <-c.send:
+			if !ok {
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			err = c.writeEvent(w, out)
+		case <-ticker.C:
+			rc.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			_, err = io.WriteString(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *WSClient) writeEvent(w io.Writer, out wsOut) error {
+	c.sent(out)
+	if out.seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s\n", c.Cursor()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", out.data)
+	return err
+}
@@ -21,8 +21,30 @@ type ServerConfig struct {
 }
 
 type AuthConfig struct {
-	JWTSecret string `json:"jwt_secret"`
-	JWTExpire string `json:"jwt_expire"`
+	JWTSecret   string     `json:"jwt_secret"`
+	JWTExpire   string     `json:"jwt_expire"`
+	IdleTimeout string     `json:"idle_timeout"` // sessions unused this long are revoked; "0" disables
+	OIDC        OIDCConfig `json:"oidc"`
+}
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider.
+// Users are matched by issuer and subject; their role is taken from RoleClaim
+// via RoleMapping on every login, falling back to DefaultRole.
+type OIDCConfig struct {
+	Enabled               bool              `json:"enabled"`
+	ProviderName          string            `json:"provider_name"` // login button label
+	Issuer                string            `json:"issuer"`
+	ClientID              string            `json:"client_id"`
+	ClientSecret          string            `json:"client_secret"` // empty for public clients (PKCE only)
+	RedirectURL           string            `json:"redirect_url"`  // must point at /api/v1/auth/oidc/callback
+	Scopes                []string          `json:"scopes"`
+	UsernameClaim         string            `json:"username_claim"`
+	RoleClaim             string            `json:"role_claim"`
+	RoleMapping           map[string]string `json:"role_mapping"` // claim value -> role name
+	DefaultRole           string            `json:"default_role"` // empty denies users no mapping matches
+	AutoProvision         bool              `json:"auto_provision"`
+	DisableLocalLogin     bool              `json:"disable_local_login"` // loopback clients can still use passwords
+	PostLogoutRedirectURL string            `json:"post_logout_redirect_url"`
 }
 
 type DatabaseConfig struct {
@@ -60,6 +82,13 @@ type AlertConfig struct {
 	Channels   []string `json:"channels"`
 }
 
+// MetricsConfig controls the Prometheus /metrics endpoint. Loopback clients
+// may always scrape it; remote clients must present Token as a bearer token.
+type MetricsConfig struct {
+	Enabled bool   `json:"enabled"`
+	Token   string `json:"token"`
+}
+
 type SkillHubConfig struct {
 	DataURL string `json:"data_url"`
 }
@@ -73,6 +102,7 @@ type Config struct {
 	Monitor  MonitorConfig  `json:"monitor"`
 	Alert    AlertConfig    `json:"alert"`
 	SkillHub SkillHubConfig `json:"skillhub"`
+	Metrics  MetricsConfig  `json:"metrics"`
 }
 
 // DataDir returns the default data directory for the application.
@@ -106,8 +136,16 @@ func Default() Config {
 			CORSOrigins: []string{},
 		},
 		Auth: AuthConfig{
-			JWTSecret: "",
-			JWTExpire: "24h",
+			JWTSecret:   "",
+			JWTExpire:   "24h",
+			IdleTimeout: "2h",
+			OIDC: OIDCConfig{
+				ProviderName:  "SSO",
+				Scopes:        []string{"openid", "profile", "email"},
+				UsernameClaim: "preferred_username",
+				RoleMapping:   map[string]string{},
+				AutoProvision: true,
+			},
 		},
 		Database: DatabaseConfig{
 			Driver:     "sqlite",
@@ -140,6 +178,9 @@ func Default() Config {
 		SkillHub: SkillHubConfig{
 			DataURL: "https://cloudcache.tencentcs.com/qcloud/tea/app/data/skills.33d56946.json",
 		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
 	}
 }
 
@@ -186,6 +227,13 @@ func Load() (Config, error) {
 		}
 		cfg.OpenClaw.GatewayToken = token
 	}
+	if cfg.Auth.OIDC.ClientSecret != "" {
+		secret, err := secretutil.DecryptString(cfg.Auth.OIDC.ClientSecret, cfg.Auth.JWTSecret)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Auth.OIDC.ClientSecret = secret
+	}
 
 	return cfg, nil
 }
@@ -203,6 +251,13 @@ func Save(cfg Config) error {
 		}
 		storable.OpenClaw.GatewayToken = encryptedToken
 	}
+	if storable.Auth.OIDC.ClientSecret != "" {
+		encryptedSecret, err := secretutil.EncryptString(storable.Auth.OIDC.ClientSecret, storable.Auth.JWTSecret)
+		if err != nil {
+			return err
+		}
+		storable.Auth.OIDC.ClientSecret = encryptedSecret
+	}
 	data, err := json.MarshalIndent(storable, "", "  ")
 	if err != nil {
 		return err
@@ -222,6 +277,15 @@ func (c *Config) JWTExpireDuration() time.Duration {
 	return d
 }
 
+// IdleTimeoutDuration returns the session idle timeout; 0 disables it.
+func (c *Config) IdleTimeoutDuration() time.Duration {
+	d, err := time.ParseDuration(c.Auth.IdleTimeout)
+	if err != nil || d < 0 {
+		return 2 * time.Hour
+	}
+	return d
+}
+
 func (c *Config) IsDebug() bool {
 	return strings.EqualFold(c.Log.Mode, "debug")
 }
@@ -250,6 +314,9 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OCD_JWT_EXPIRE"); v != "" {
 		cfg.Auth.JWTExpire = v
 	}
+	if v := os.Getenv("OCD_IDLE_TIMEOUT"); v != "" {
+		cfg.Auth.IdleTimeout = v
+	}
 	if v := os.Getenv("OCD_LOG_LEVEL"); v != "" {
 		cfg.Log.Level = v
 	}
@@ -292,6 +359,30 @@ func applyEnvOverrides(cfg *Config) {
 	if v := os.Getenv("OCD_ALERT_WEBHOOK_URL"); v != "" {
 		cfg.Alert.WebhookURL = v
 	}
+	if v := os.Getenv("OCD_METRICS_ENABLED"); v != "" {
+		cfg.Metrics.Enabled = strings.EqualFold(v, "true")
+	}
+	if v := os.Getenv("OCD_METRICS_TOKEN"); v != "" {
+		cfg.Metrics.Token = v
+	}
+	if v := os.Getenv("OCD_OIDC_ENABLED"); v != "" {
+		cfg.Auth.OIDC.Enabled = strings.EqualFold(v, "true")
+	}
+	if v := os.Getenv("OCD_OIDC_ISSUER"); v != "" {
+		cfg.Auth.OIDC.Issuer = v
+	}
+	if v := os.Getenv("OCD_OIDC_CLIENT_ID"); v != "" {
+		cfg.Auth.OIDC.ClientID = v
+	}
+	if v := os.Getenv("OCD_OIDC_CLIENT_SECRET"); v != "" {
+		cfg.Auth.OIDC.ClientSecret = v
+	}
+	if v := os.Getenv("OCD_OIDC_REDIRECT_URL"); v != "" {
+		cfg.Auth.OIDC.RedirectURL = v
+	}
+	if v := os.Getenv("OCD_OIDC_DISABLE_LOCAL_LOGIN"); v != "" {
+		cfg.Auth.OIDC.DisableLocalLogin = strings.EqualFold(v, "true")
+	}
 }
 
 func generateSecret(n int) (string, error) {
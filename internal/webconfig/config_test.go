@@ -46,6 +46,10 @@ func TestDefault(t *testing.T) {
 
 	// Alert defaults
 	assert.False(t, cfg.Alert.Enabled)
+
+	// Metrics defaults: enabled, loopback-only until a token is set
+	assert.True(t, cfg.Metrics.Enabled)
+	assert.Empty(t, cfg.Metrics.Token)
 }
 
 func TestConfig_ListenAddr(t *testing.T) {
@@ -230,3 +234,24 @@ func TestSaveLoad_EncryptsGatewayToken(t *testing.T) {
 	assert.Equal(t, "test-jwt-secret", loaded.Auth.JWTSecret)
 	assert.True(t, strings.Contains(string(raw), "\"gateway_token\""))
 }
+
+func TestSaveLoad_EncryptsOIDCClientSecret(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "ClawDeckX.json")
+	t.Setenv("OCD_CONFIG", configPath)
+
+	cfg := Default()
+	cfg.Auth.JWTSecret = "test-jwt-secret"
+	cfg.Auth.OIDC.ClientSecret = "oidc-client-secret"
+
+	require.NoError(t, Save(cfg))
+
+	raw, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "oidc-client-secret")
+
+	loaded, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "oidc-client-secret", loaded.Auth.OIDC.ClientSecret)
+	assert.Equal(t, "preferred_username", loaded.Auth.OIDC.UsernameClaim)
+}
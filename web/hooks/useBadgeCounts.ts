@@ -30,6 +30,10 @@ export function useBadgeCounts(enabled = true): Record<WindowID, number> {
           setBadges(msg.data);
           return;
         }
+        if (msg.type === 'resync') {
+          fetchRef.current();
+          return;
+        }
         if (msg.type === 'alert') {
           setTimeout(() => fetchRef.current(), 2000);
         }
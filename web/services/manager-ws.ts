@@ -2,6 +2,8 @@ type ManagerWSStatus = 'connecting' | 'open' | 'closed';
 type ManagerWSMessageHandler = (msg: any) => void;
 type ManagerWSStatusHandler = (status: ManagerWSStatus) => void;
 
+const CHANNELS = ['gw_event', 'alert', 'activity'];
+
 class ManagerWSBus {
   private ws: WebSocket | null = null;
   private reconnectTimer: number | null = null;
@@ -9,6 +11,11 @@ class ManagerWSBus {
   private subscribers = new Set<ManagerWSMessageHandler>();
   private statusSubscribers = new Set<ManagerWSStatusHandler>();
   private refCount = 0;
+  // Resume position: the server epoch and the last seq seen per channel.
+  // Reconnects send it as last_seq so missed messages are replayed, or a
+  // `resync` message is delivered when they are gone.
+  private epoch = '';
+  private lastSeq: Record<string, number> = {};
 
   subscribe(onMessage: ManagerWSMessageHandler, onStatus?: ManagerWSStatusHandler) {
     this.refCount += 1;
@@ -48,18 +55,20 @@ class ManagerWSBus {
 
     const proto = location.protocol === 'https:' ? 'wss:' : 'ws:';
     // Auth via HttpOnly claw_token cookie (set on login) — avoids leaking JWT in console on connection errors
-    const ws = new WebSocket(`${proto}//${location.host}/api/v1/ws`);
+    const params = new URLSearchParams({ channels: CHANNELS.join(',') });
+    if (this.epoch) params.set('last_seq', this.cursor());
+    const ws = new WebSocket(`${proto}//${location.host}/api/v1/ws?${params}`);
     this.ws = ws;
 
     ws.onopen = () => {
       this.backoffMs = 800;
-      ws.send(JSON.stringify({ action: 'subscribe', channels: ['gw_event', 'alert', 'activity'] }));
       this.notifyStatus('open');
     };
 
     ws.onmessage = (evt) => {
       try {
         const msg = JSON.parse(evt.data);
+        if (!this.track(msg)) return;
         for (const fn of this.subscribers) fn(msg);
       } catch {
         // ignore parse errors
@@ -77,6 +86,31 @@ class ManagerWSBus {
     };
   }
 
+  private cursor() {
+    const parts = Object.entries(this.lastSeq).map(([ch, seq]) => `${ch}:${seq}`);
+    return `${this.epoch};${parts.join(',')}`;
+  }
+
+  // track updates the resume position and reports whether msg is new.
+  private track(msg: any): boolean {
+    if (msg.type === 'hello') {
+      for (const [ch, seq] of Object.entries<number>(msg.data?.seq || {})) {
+        if (this.epoch !== msg.data.epoch || !(ch in this.lastSeq)) this.lastSeq[ch] = seq;
+      }
+      this.epoch = msg.data?.epoch || '';
+      return false;
+    }
+    if (msg.type === 'resync') {
+      this.lastSeq[msg.channel] = msg.data?.seq || 0;
+      return true;
+    }
+    if (msg.channel && msg.seq) {
+      if (msg.seq <= (this.lastSeq[msg.channel] || 0)) return false;
+      this.lastSeq[msg.channel] = msg.seq;
+    }
+    return true;
+  }
+
   private scheduleReconnect() {
     if (this.refCount === 0) return;
     if (this.reconnectTimer != null) return;